@@ -20,6 +20,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
@@ -211,8 +212,11 @@ func (s *SelfSignedCA) GetCA() *x509.Certificate {
 	return s.caCert
 }
 
-// IssueCert issues a certificate for the given domain.
+// IssueCert issues a certificate for the given domain. IP literals may be
+// bracketed or carry an IPv6 zone, e.g. "[fe80::1%eth0]", and share one
+// certificate per address.
 func (s *SelfSignedCA) IssueCert(domain string) (*tls.Certificate, error) {
+	domain = canonicalName(domain)
 	if cert, ok := s.certCache.Get(domain); ok {
 		return cert, nil
 	}
@@ -232,6 +236,19 @@ func (s *SelfSignedCA) IssueCert(domain string) (*tls.Certificate, error) {
 	return cert.(*tls.Certificate), nil
 }
 
+// canonicalName returns IP literals without brackets or zone in their
+// canonical form. Host names are returned unchanged.
+func canonicalName(domain string) string {
+	host := strings.TrimSuffix(strings.TrimPrefix(domain, "["), "]")
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return domain
+}
+
 func (s *SelfSignedCA) issue(domain string) (*tls.Certificate, error) {
 	priv, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
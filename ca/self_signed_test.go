@@ -144,6 +144,21 @@ func TestSelfSignedCA_IssueCert(t *testing.T) {
 			require.NoError(t, err)
 		})
 	}
+	t.Run("ipv6 literals", func(t *testing.T) {
+		cert, err := ca.IssueCert("[2001:db8::1]")
+		require.NoError(t, err)
+		leafCert := parseLeafCert(t, cert)
+		require.Empty(t, leafCert.DNSNames)
+		require.Len(t, leafCert.IPAddresses, 1)
+		require.True(t, leafCert.IPAddresses[0].Equal(net.ParseIP("2001:db8::1")))
+		same, err := ca.IssueCert("2001:DB8:0::1")
+		require.NoError(t, err)
+		require.Equal(t, cert, same)
+
+		cert, err = ca.IssueCert("fe80::1%eth0")
+		require.NoError(t, err)
+		require.True(t, parseLeafCert(t, cert).IPAddresses[0].Equal(net.ParseIP("fe80::1")))
+	})
 	t.Run("issue cached cert", func(t *testing.T) {
 		domain := "cached.example.com"
 		cert1, err := ca.IssueCert(domain)
@@ -0,0 +1,224 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/auth"
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// 支持的访问日志格式
+const (
+	// FormatCommon Apache通用日志格式
+	FormatCommon = "common"
+
+	// FormatCombined Apache组合日志格式，在通用格式后追加 Referer 和 User-Agent
+	FormatCombined = "combined"
+
+	// FormatJSON 每行一个JSON对象
+	FormatJSON = "json"
+)
+
+// clfTime 通用日志格式的时间格式
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// Entry JSON格式的一条访问日志
+type Entry struct {
+	Time      time.Time `json:"time"`
+	FlowID    string    `json:"flow_id"`
+	Client    string    `json:"client"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	Proto     string    `json:"proto,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	BytesIn   int       `json:"bytes_in"`
+	BytesOut  int       `json:"bytes_out"`
+	Duration  float64   `json:"duration_ms"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Upstream  string    `json:"upstream,omitempty"`
+	Responder string    `json:"responder,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode string    `json:"error_code,omitempty"`
+	ReplayOf  string    `json:"replay_of,omitempty"`
+}
+
+// Writer 每个结束的流写一行访问日志，不记录请求体和响应体
+type Writer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	format string
+}
+
+// New 创建写入 w 的访问日志，format 为空时使用组合日志格式
+func New(w io.Writer, format string) (*Writer, error) {
+	format, err := checkFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, format: format}, nil
+}
+
+// checkFormat 检查访问日志格式，为空时返回组合日志格式
+func checkFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return FormatCombined, nil
+	case FormatCommon, FormatCombined, FormatJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown access log format %q (supported: common, combined, json)", format)
+}
+
+// Open 以追加方式打开访问日志文件，path 为 "-" 时写入标准输出
+func Open(path, format string) (*Writer, error) {
+	if path == "-" {
+		return New(os.Stdout, format)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open access log: %w", err)
+	}
+	w, err := New(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.closer = f
+	return w, nil
+}
+
+// Add 写入流的访问日志，签名与 flow.Bus.OnFinished 的回调一致，错误只记录日志
+func (w *Writer) Add(f *flow.Flow) {
+	if err := w.Write(f); err != nil {
+		log.Printf("Failed to write access log for flow %s: %v", f.ID, err)
+	}
+}
+
+// Write 写入流的访问日志
+func (w *Writer) Write(f *flow.Flow) error {
+	line, err := formatEntry(NewEntry(f), w.format)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.w.Write(append(line, '\n'))
+	return err
+}
+
+// formatEntry 按格式输出一条访问日志，不含换行
+func formatEntry(e *Entry, format string) ([]byte, error) {
+	if format == FormatJSON {
+		return json.Marshal(e)
+	}
+	return []byte(formatCLF(e, format == FormatCombined)), nil
+}
+
+// Close 关闭访问日志文件
+func (w *Writer) Close() error {
+	if w.closer == nil {
+		return nil
+	}
+	return w.closer.Close()
+}
+
+// NewEntry 返回流的访问日志条目
+func NewEntry(f *flow.Flow) *Entry {
+	e := &Entry{
+		Time:      f.StartTime,
+		FlowID:    f.ID,
+		Client:    f.ClientAddr,
+		Duration:  float64(f.Duration()) / float64(time.Millisecond),
+		Upstream:  f.ServerAddr,
+		Responder: f.Responder,
+		Error:     f.Error,
+		ErrorCode: string(f.ErrorCode),
+		ReplayOf:  f.ReplayOf,
+		User:      f.ProxyUser,
+	}
+	if host, _, err := net.SplitHostPort(f.ClientAddr); err == nil {
+		e.Client = host
+	}
+	if f.Request != nil {
+		e.Method = f.Request.Method
+		e.URL = f.Request.URL
+		e.Proto = f.Request.Proto
+		e.BytesIn = int(f.Request.BodyLen())
+		e.Referer = f.Request.Header.Get("Referer")
+		e.UserAgent = f.Request.Header.Get("User-Agent")
+		// 代理未校验认证时头部会随流保留
+		if user, _, ok := auth.ParseBasic(f.Request.Header.Get("Proxy-Authorization")); ok && e.User == "" {
+			e.User = user
+		}
+	}
+	if f.Response != nil {
+		e.Status = f.Response.StatusCode
+		e.BytesOut = int(f.Response.BodyLen())
+	}
+	return e
+}
+
+// formatCLF 按通用或组合日志格式输出一行，没有响应的流状态码为 "-"
+func formatCLF(e *Entry, combined bool) string {
+	status := "-"
+	if e.Status != 0 {
+		status = strconv.Itoa(e.Status)
+	}
+	size := "-"
+	if e.BytesOut > 0 {
+		size = strconv.Itoa(e.BytesOut)
+	}
+	request := strings.TrimSpace(e.Method + " " + e.URL + " " + e.Proto)
+	line := fmt.Sprintf("%s - %s [%s] %s %s %s",
+		orDash(e.Client), orDash(e.User), e.Time.Format(clfTime), quote(request), status, size)
+	if combined {
+		line += " " + quote(e.Referer) + " " + quote(e.UserAgent)
+	}
+	return line
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// quote 用双引号括起字段，转义引号、反斜杠和控制字符
+func quote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
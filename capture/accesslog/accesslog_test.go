@@ -0,0 +1,175 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package accesslog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func newFlow() *flow.Flow {
+	start := time.Date(2025, 3, 4, 10, 20, 30, 0, time.FixedZone("", 8*3600))
+	return &flow.Flow{
+		ID:         "abc",
+		StartTime:  start,
+		EndTime:    start.Add(42 * time.Millisecond),
+		ClientAddr: "192.0.2.10:51234",
+		ServerAddr: "203.0.113.5:443",
+		Request: &flow.Request{
+			Method: "GET",
+			URL:    "https://api.example.com/v1?q=\"x\"",
+			Proto:  "HTTP/1.1",
+			Header: http.Header{
+				"User-Agent":          {"curl/8.0"},
+				"Proxy-Authorization": {"Basic YWxpY2U6c2VjcmV0"},
+			},
+		},
+		Response: &flow.Response{StatusCode: 200, Body: []byte("hello")},
+	}
+}
+
+// --- 测试代码 ---
+func TestWriter_CLF(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New(&buf, "")
+	require.NoError(t, err)
+
+	w.Add(newFlow())
+	failed := newFlow()
+	failed.Response = nil
+	failed.Request.Header = http.Header{}
+	failed.Error = "dial tcp: connection refused"
+	w.Add(failed)
+
+	require.Equal(t,
+		`192.0.2.10 - alice [04/Mar/2025:10:20:30 +0800] "GET https://api.example.com/v1?q=\"x\" HTTP/1.1" 200 5 "-" "curl/8.0"`+"\n"+
+			`192.0.2.10 - - [04/Mar/2025:10:20:30 +0800] "GET https://api.example.com/v1?q=\"x\" HTTP/1.1" - - "-" "-"`+"\n",
+		buf.String())
+
+	buf.Reset()
+	w, err = New(&buf, FormatCommon)
+	require.NoError(t, err)
+	w.Add(newFlow())
+	require.Equal(t, `192.0.2.10 - alice [04/Mar/2025:10:20:30 +0800] "GET https://api.example.com/v1?q=\"x\" HTTP/1.1" 200 5`+"\n", buf.String())
+
+	_, err = New(&buf, "xml")
+	require.Error(t, err)
+}
+
+func TestWriter_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	w, err := Open(path, FormatJSON)
+	require.NoError(t, err)
+	w.Add(newFlow())
+	require.NoError(t, w.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var e Entry
+	require.NoError(t, json.Unmarshal(data, &e))
+	require.Equal(t, "abc", e.FlowID)
+	require.Equal(t, "192.0.2.10", e.Client)
+	require.Equal(t, "alice", e.User)
+	require.Equal(t, 200, e.Status)
+	require.Equal(t, 5, e.BytesOut)
+	require.Equal(t, float64(42), e.Duration)
+	require.Equal(t, "203.0.113.5:443", e.Upstream)
+}
+
+func TestSyslog_UDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	s, err := DialSyslog("udp://"+pc.LocalAddr().String(), FormatCommon, "local3")
+	require.NoError(t, err)
+	defer s.Close()
+	s.hostname, s.procID = "box", "42"
+	s.Add(newFlow())
+
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, `<158>1 2025-03-04T10:20:30.000000+08:00 box sniffy 42 access `+
+		`[sniffy@32473 flow_id="abc" method="GET" status="200" duration_ms="42.000"] `+
+		`192.0.2.10 - alice [04/Mar/2025:10:20:30 +0800] "GET https://api.example.com/v1?q=\"x\" HTTP/1.1" 200 5`, string(buf[:n]))
+}
+
+func TestSyslog_TCPFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	received := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			for {
+				size, err := r.ReadString(' ')
+				if err != nil {
+					break
+				}
+				n, _ := strconv.Atoi(strings.TrimSpace(size))
+				msg := make([]byte, n)
+				if _, err := io.ReadFull(r, msg); err != nil {
+					break
+				}
+				received <- string(msg)
+			}
+			conn.Close()
+		}
+	}()
+
+	s, err := DialSyslog("tcp://"+ln.Addr().String(), FormatJSON, "")
+	require.NoError(t, err)
+	defer s.Close()
+
+	failed := newFlow()
+	failed.Response = nil
+	failed.Error = `dial "x": refused]`
+	require.NoError(t, s.Write(failed))
+	msg := <-received
+	require.True(t, strings.HasPrefix(msg, "<131>1 "), msg) // local0.err
+	require.Contains(t, msg, `status="0"`)
+	_, body, ok := strings.Cut(msg, "] {")
+	require.True(t, ok)
+	var e Entry
+	require.NoError(t, json.Unmarshal([]byte("{"+body), &e))
+	require.Equal(t, "abc", e.FlowID)
+}
+
+func TestDialSyslog_Errors(t *testing.T) {
+	_, err := DialSyslog("http://localhost:514", "", "")
+	require.ErrorContains(t, err, "unsupported syslog transport")
+	_, err = DialSyslog("udp://localhost:514", "", "local9")
+	require.ErrorContains(t, err, "unknown syslog facility")
+	_, err = DialSyslog("udp://localhost:514", "xml", "")
+	require.ErrorContains(t, err, "unknown access log format")
+	_, err = DialSyslog("localhost:514", "", "")
+	require.Error(t, err)
+}
+
+func TestSDEscape(t *testing.T) {
+	require.Equal(t, `a\"b\\c\]`, sdEscape(`a"b\c]`))
+}
@@ -0,0 +1,197 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package accesslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// facilities syslog 设施的名称和代码
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslog 严重级别
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+// sdID 结构化数据的ID，32473 为 RFC 5612 中保留给文档示例的企业编号
+const sdID = "sniffy@32473"
+
+// Syslog 以 RFC 5424 格式将访问日志发送到syslog服务器。
+// UDP 每条日志一个数据报，TCP 和 TLS 按 RFC 6587 的八位组计数分帧，连接断开后自动重连
+type Syslog struct {
+	mu       sync.Mutex
+	network  string
+	addr     string
+	tls      *tls.Config
+	facility int
+	format   string
+	hostname string
+	procID   string
+	timeout  time.Duration
+	conn     net.Conn
+}
+
+// DialSyslog 连接 udp://host:514、tcp://host:514 或 tls://host:6514 的syslog服务器，
+// format 为消息的访问日志格式，facility 为空时使用 local0
+func DialSyslog(rawURL, format, facility string) (*Syslog, error) {
+	format, err := checkFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	if facility == "" {
+		facility = "local0"
+	}
+	code, ok := facilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid syslog address %q (expected udp://, tcp:// or tls://host:port)", rawURL)
+	}
+	s := &Syslog{
+		addr:     u.Host,
+		facility: code,
+		format:   format,
+		hostname: "-",
+		procID:   strconv.Itoa(os.Getpid()),
+		timeout:  5 * time.Second,
+	}
+	if h, err := os.Hostname(); err == nil && h != "" {
+		s.hostname = h
+	}
+	defaultPort := "514"
+	switch u.Scheme {
+	case "udp", "tcp":
+		s.network = u.Scheme
+	case "tls":
+		s.network = "tcp"
+		s.tls = &tls.Config{ServerName: u.Hostname()}
+		defaultPort = "6514"
+	default:
+		return nil, fmt.Errorf("unsupported syslog transport %q (expected udp, tcp or tls)", u.Scheme)
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add 发送流的访问日志，签名与 flow.Bus.OnFinished 的回调一致，错误只记录日志
+func (s *Syslog) Add(f *flow.Flow) {
+	if err := s.Write(f); err != nil {
+		log.Printf("Failed to send access log for flow %s to syslog: %v", f.ID, err)
+	}
+}
+
+// Write 发送流的访问日志，发送失败时重连一次
+func (s *Syslog) Write(f *flow.Flow) error {
+	msg, err := s.message(NewEntry(f), time.Now())
+	if err != nil {
+		return err
+	}
+	if s.network == "tcp" {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			if err = s.connect(); err != nil {
+				return err
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+		if _, err = s.conn.Write(msg); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+// message 生成 RFC 5424 格式的消息，时间戳为流开始的时间
+func (s *Syslog) message(e *Entry, now time.Time) ([]byte, error) {
+	body, err := formatEntry(e, s.format)
+	if err != nil {
+		return nil, err
+	}
+	severity := severityInfo
+	switch {
+	case e.Error != "":
+		severity = severityError
+	case e.Status >= 500:
+		severity = severityWarning
+	}
+	ts := e.Time
+	if ts.IsZero() {
+		ts = now
+	}
+	sd := fmt.Sprintf(`[%s flow_id="%s" method="%s" status="%d" duration_ms="%.3f"]`,
+		sdID, sdEscape(e.FlowID), sdEscape(e.Method), e.Status, e.Duration)
+	header := fmt.Sprintf("<%d>1 %s %s sniffy %s access %s ",
+		s.facility*8+severity, ts.Format("2006-01-02T15:04:05.000000Z07:00"), s.hostname, s.procID, sd)
+	return append([]byte(header), body...), nil
+}
+
+// sdEscape 转义结构化数据参数值中的 "、\ 和 ]
+func sdEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+// connect 连接syslog服务器，调用方需持有锁或在初始化时调用
+func (s *Syslog) connect() error {
+	d := net.Dialer{Timeout: s.timeout}
+	var conn net.Conn
+	var err error
+	if s.tls != nil {
+		conn, err = tls.DialWithDialer(&d, s.network, s.addr, s.tls)
+	} else {
+		conn, err = d.Dial(s.network, s.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to syslog %s: %w", s.addr, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// Close 关闭连接
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
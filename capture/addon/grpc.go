@@ -0,0 +1,231 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package addon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/hooks"
+)
+
+const (
+	serviceName        = "sniffy.addon.v1.Addon"
+	onRequestMethod    = "/" + serviceName + "/OnRequest"
+	onResponseMethod   = "/" + serviceName + "/OnResponse"
+	defaultCallTimeout = 5 * time.Second
+)
+
+// Client 通过gRPC调用进程外插件的钩子，实现 hooks.Hook。
+// 插件服务按 addon.proto 实现，每条流在请求和响应阶段各调用一次。
+type Client struct {
+	hooks.Base
+
+	target   string
+	conn     *grpc.ClientConn
+	timeout  time.Duration
+	failOpen bool
+}
+
+// NewClient 创建插件客户端，连接在第一次调用时建立，target 为 host:port 或gRPC目标地址
+func NewClient(target string) (*Client, error) {
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("addon %s: %w", target, err)
+	}
+	return &Client{target: target, conn: conn, timeout: defaultCallTimeout}, nil
+}
+
+// SetTimeout 设置单次调用超时，0 表示不超时
+func (c *Client) SetTimeout(d time.Duration) {
+	c.timeout = d
+}
+
+// SetFailOpen 设置插件不可用时的处理方式：true 时记录日志并放行流，默认中止流
+func (c *Client) SetFailOpen(failOpen bool) {
+	c.failOpen = failOpen
+}
+
+// Close 关闭到插件的连接
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// String 返回插件描述
+func (c *Client) String() string {
+	return "addon " + c.target
+}
+
+// OnRequest 实现 hooks.Hook 接口
+func (c *Client) OnRequest(ctx context.Context, f *flow.Flow) (context.Context, error) {
+	if f.Request == nil {
+		return ctx, nil
+	}
+	return ctx, c.call(ctx, onRequestMethod, f)
+}
+
+// OnResponse 实现 hooks.Hook 接口
+func (c *Client) OnResponse(ctx context.Context, f *flow.Flow) error {
+	if f.Request == nil || f.Response == nil {
+		return nil
+	}
+	return c.call(ctx, onResponseMethod, f)
+}
+
+// call 调用插件并执行返回的决定
+func (c *Client) call(ctx context.Context, method string, f *flow.Flow) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	verdict := &Verdict{}
+	if err := c.conn.Invoke(ctx, method, flowMessage(f), verdict); err != nil {
+		if c.failOpen {
+			log.Printf("%s unavailable, passing flow %s through: %v", c, f.ID, err)
+			return nil
+		}
+		return fmt.Errorf("%s: %w", c, err)
+	}
+	return c.apply(f, verdict)
+}
+
+// apply 执行插件返回的决定
+func (c *Client) apply(f *flow.Flow, v *Verdict) error {
+	for _, tag := range v.Tags {
+		f.Tag(tag)
+	}
+	switch v.Action {
+	case ActionContinue:
+	case ActionModify:
+		if m := v.Request; m != nil {
+			if m.Method != "" {
+				f.Request.Method = m.Method
+			}
+			if m.URL != "" {
+				f.Request.URL = m.URL
+			}
+			if m.Host != "" {
+				f.Request.Host = m.Host
+			}
+			f.Request.Header = m.HTTPHeader()
+			f.Request.Body = m.Body
+		}
+		if m := v.Response; m != nil && f.Response != nil {
+			if m.Status != 0 && int(m.Status) != f.Response.StatusCode {
+				f.Response.StatusCode = int(m.Status)
+				f.Response.Status = fmt.Sprintf("%d %s", m.Status, http.StatusText(int(m.Status)))
+			}
+			f.Response.Header = m.HTTPHeader()
+			f.Response.Body = m.Body
+		}
+	case ActionRespond:
+		if f.Response != nil {
+			return fmt.Errorf("%s: respond is only allowed in OnRequest", c)
+		}
+		m := v.Response
+		if m == nil {
+			m = &Message{}
+		}
+		status := int(m.Status)
+		if status == 0 {
+			status = http.StatusOK
+		}
+		f.Response = &flow.Response{
+			StatusCode: status,
+			Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			Proto:      "HTTP/1.1",
+			Header:     m.HTTPHeader(),
+			Body:       m.Body,
+		}
+		f.Responder = c.String()
+	case ActionAbort:
+		reason := v.Reason
+		if reason == "" {
+			reason = "aborted"
+		}
+		return fmt.Errorf("%s: %s", c, reason)
+	default:
+		return fmt.Errorf("%s: unknown action %d", c, v.Action)
+	}
+	return nil
+}
+
+// flowMessage 返回发给插件的流，内容已解码
+func flowMessage(f *flow.Flow) *Flow {
+	out := &Flow{
+		ID:         f.ID,
+		ClientAddr: f.ClientAddr,
+		ServerAddr: f.ServerAddr,
+		Tags:       f.Tags,
+		Request:    message(f.Request.Header, f.Request.Body),
+	}
+	out.Request.Method = f.Request.Method
+	out.Request.URL = f.Request.URL
+	out.Request.Host = f.Request.Host
+	if f.Response != nil {
+		out.Response = message(f.Response.Header, f.Response.Body)
+		out.Response.Status = int32(f.Response.StatusCode)
+	}
+	return out
+}
+
+// message 返回解码后的内容和对应的头部，无法解码时保留原始内容和 Content-Encoding
+func message(header http.Header, body []byte) *Message {
+	decoded, _, err := flow.DecodeBody(header, body)
+	if err != nil {
+		return &Message{Headers: headerList(header, "Content-Length"), Body: body}
+	}
+	return &Message{Headers: headerList(header, "Content-Length", "Content-Encoding"), Body: decoded}
+}
+
+// Server 插件服务，供使用Go实现插件时注册到 grpc.Server
+type Server interface {
+	OnRequest(ctx context.Context, f *Flow) (*Verdict, error)
+	OnResponse(ctx context.Context, f *Flow) (*Verdict, error)
+}
+
+// RegisterServer 将插件服务注册到gRPC服务器
+func RegisterServer(s grpc.ServiceRegistrar, srv Server) {
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: serviceName,
+		HandlerType: (*Server)(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "OnRequest", Handler: handler(onRequestMethod, Server.OnRequest)},
+			{MethodName: "OnResponse", Handler: handler(onResponseMethod, Server.OnResponse)},
+		},
+		Metadata: "addon.proto",
+	}, srv)
+}
+
+// handler 创建一元方法的处理函数
+func handler(method string, call func(Server, context.Context, *Flow) (*Verdict, error)) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		in := &Flow{}
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(Server), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: method}
+		return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+			f, ok := req.(*Flow)
+			if !ok {
+				return nil, errors.New("unexpected request type")
+			}
+			return call(srv.(Server), ctx, f)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package addon
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// testAddon 按URL路径决定处理方式的插件
+type testAddon struct {
+	requests []*Flow
+}
+
+func (a *testAddon) OnRequest(_ context.Context, f *Flow) (*Verdict, error) {
+	a.requests = append(a.requests, f)
+	switch {
+	case strings.HasSuffix(f.Request.URL, "/blocked"):
+		return &Verdict{Action: ActionAbort, Reason: "blocked by policy"}, nil
+	case strings.HasSuffix(f.Request.URL, "/mock"):
+		return &Verdict{Action: ActionRespond, Response: &Message{
+			Status:  http.StatusTeapot,
+			Headers: []*Header{{Name: "X-Addon", Value: "1"}},
+			Body:    []byte("mocked"),
+		}}, nil
+	}
+	req := f.Request
+	req.Headers = append(req.Headers, &Header{Name: "X-Scanned", Value: "yes"})
+	return &Verdict{Action: ActionModify, Request: req, Tags: []string{"scanned"}}, nil
+}
+
+func (a *testAddon) OnResponse(_ context.Context, f *Flow) (*Verdict, error) {
+	if bytes.Contains(f.Response.Body, []byte("secret")) {
+		resp := f.Response
+		resp.Body = bytes.ReplaceAll(resp.Body, []byte("secret"), []byte("******"))
+		return &Verdict{Action: ActionModify, Response: resp, Tags: []string{"dlp"}}, nil
+	}
+	return &Verdict{}, nil
+}
+
+func startAddon(t *testing.T, srv Server) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	RegisterServer(s, srv)
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+	return ln.Addr().String()
+}
+
+func testFlow(url string) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{Method: "POST", URL: url, Host: "api.example.com", Header: http.Header{}, Body: []byte("x")}
+	return f
+}
+
+// --- 测试代码 ---
+func TestClient(t *testing.T) {
+	srv := &testAddon{}
+	c, err := NewClient(startAddon(t, srv))
+	require.NoError(t, err)
+	defer c.Close()
+	ctx := context.Background()
+
+	f := testFlow("https://api.example.com/items")
+	_, err = c.OnRequest(ctx, f)
+	require.NoError(t, err)
+	require.Equal(t, "yes", f.Request.Header.Get("X-Scanned"))
+	require.Equal(t, "x", string(f.Request.Body))
+	require.Equal(t, "POST", f.Request.Method)
+	require.Equal(t, []string{"scanned"}, f.Tags)
+
+	// 响应内容解码后发给插件，修改后写回明文
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, _ = w.Write([]byte(`{"token":"secret"}`))
+	require.NoError(t, w.Close())
+	f.Response = &flow.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Encoding": {"gzip"}, "Content-Type": {"application/json"}},
+		Body:       gz.Bytes(),
+	}
+	require.NoError(t, c.OnResponse(ctx, f))
+	require.Equal(t, `{"token":"******"}`, string(f.Response.Body))
+	require.Empty(t, f.Response.Header.Get("Content-Encoding"))
+	require.Equal(t, "application/json", f.Response.Header.Get("Content-Type"))
+	require.Equal(t, []string{"scanned", "dlp"}, f.Tags)
+
+	f = testFlow("https://api.example.com/mock")
+	_, err = c.OnRequest(ctx, f)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusTeapot, f.Response.StatusCode)
+	require.Equal(t, "1", f.Response.Header.Get("X-Addon"))
+	require.Equal(t, "mocked", string(f.Response.Body))
+	require.Equal(t, "addon "+c.target, f.Responder)
+
+	_, err = c.OnRequest(ctx, testFlow("https://api.example.com/blocked"))
+	require.ErrorContains(t, err, "blocked by policy")
+	require.Len(t, srv.requests, 3)
+}
+
+func TestClient_Unavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	c, err := NewClient(addr)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.OnRequest(context.Background(), testFlow("http://example.com/"))
+	require.Error(t, err)
+
+	c.SetFailOpen(true)
+	f := testFlow("http://example.com/")
+	_, err = c.OnRequest(context.Background(), f)
+	require.NoError(t, err)
+	require.Nil(t, f.Response)
+}
@@ -0,0 +1,130 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package addon
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// 以下消息与 addon.proto 对应，通过 protobuf 结构标签直接编解码，不依赖生成代码
+
+// Action 插件对流的处理决定
+type Action int32
+
+const (
+	// ActionContinue 不修改流
+	ActionContinue Action = 0
+	// ActionModify 用 Verdict 中的请求和/或响应整体替换流中的对应部分
+	ActionModify Action = 1
+	// ActionRespond 仅 OnRequest：用 Verdict 中的响应直接回复客户端
+	ActionRespond Action = 2
+	// ActionAbort 中止流
+	ActionAbort Action = 3
+)
+
+// Flow 发给插件的流
+type Flow struct {
+	ID         string   `protobuf:"bytes,1,opt,name=id,proto3"`
+	ClientAddr string   `protobuf:"bytes,2,opt,name=client_addr,proto3"`
+	ServerAddr string   `protobuf:"bytes,3,opt,name=server_addr,proto3"`
+	Tags       []string `protobuf:"bytes,4,rep,name=tags,proto3"`
+	Request    *Message `protobuf:"bytes,5,opt,name=request,proto3"`
+	Response   *Message `protobuf:"bytes,6,opt,name=response,proto3"`
+}
+
+// Message 请求或响应，Body 为解码后的内容
+type Message struct {
+	Method  string    `protobuf:"bytes,1,opt,name=method,proto3"`
+	URL     string    `protobuf:"bytes,2,opt,name=url,proto3"`
+	Host    string    `protobuf:"bytes,3,opt,name=host,proto3"`
+	Status  int32     `protobuf:"varint,4,opt,name=status,proto3"`
+	Headers []*Header `protobuf:"bytes,5,rep,name=headers,proto3"`
+	Body    []byte    `protobuf:"bytes,6,opt,name=body,proto3"`
+}
+
+// Header 单个头部
+type Header struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+// Verdict 插件返回的处理决定
+type Verdict struct {
+	Action   Action   `protobuf:"varint,1,opt,name=action,proto3"`
+	Request  *Message `protobuf:"bytes,2,opt,name=request,proto3"`
+	Response *Message `protobuf:"bytes,3,opt,name=response,proto3"`
+	Tags     []string `protobuf:"bytes,4,rep,name=tags,proto3"`
+	Reason   string   `protobuf:"bytes,5,opt,name=reason,proto3"`
+}
+
+// Reset 实现 protoadapt.MessageV1 接口
+func (m *Flow) Reset() { *m = Flow{} }
+
+// String 实现 protoadapt.MessageV1 接口
+func (m *Flow) String() string { return text(m) }
+
+// ProtoMessage 实现 protoadapt.MessageV1 接口
+func (*Flow) ProtoMessage() {}
+
+// Reset 实现 protoadapt.MessageV1 接口
+func (m *Message) Reset() { *m = Message{} }
+
+// String 实现 protoadapt.MessageV1 接口
+func (m *Message) String() string { return text(m) }
+
+// ProtoMessage 实现 protoadapt.MessageV1 接口
+func (*Message) ProtoMessage() {}
+
+// Reset 实现 protoadapt.MessageV1 接口
+func (m *Header) Reset() { *m = Header{} }
+
+// String 实现 protoadapt.MessageV1 接口
+func (m *Header) String() string { return text(m) }
+
+// ProtoMessage 实现 protoadapt.MessageV1 接口
+func (*Header) ProtoMessage() {}
+
+// Reset 实现 protoadapt.MessageV1 接口
+func (m *Verdict) Reset() { *m = Verdict{} }
+
+// String 实现 protoadapt.MessageV1 接口
+func (m *Verdict) String() string { return text(m) }
+
+// ProtoMessage 实现 protoadapt.MessageV1 接口
+func (*Verdict) ProtoMessage() {}
+
+// text 返回消息的文本格式
+func text(m protoadapt.MessageV1) string {
+	return prototext.Format(protoadapt.MessageV2Of(m))
+}
+
+// HTTPHeader 将头部列表转换为 http.Header
+func (m *Message) HTTPHeader() http.Header {
+	h := make(http.Header, len(m.Headers))
+	for _, hdr := range m.Headers {
+		h.Add(hdr.Name, hdr.Value)
+	}
+	return h
+}
+
+// headerList 将 http.Header 按名称排序转换为头部列表，跳过 skip 中的头部
+func headerList(h http.Header, skip ...string) []*Header {
+	var out []*Header
+	for _, name := range slices.Sorted(maps.Keys(h)) {
+		if slices.Contains(skip, http.CanonicalHeaderKey(name)) {
+			continue
+		}
+		for _, v := range h[name] {
+			out = append(out, &Header{Name: name, Value: v})
+		}
+	}
+	return out
+}
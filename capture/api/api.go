@@ -0,0 +1,267 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/ca"
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/dialer"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/limits"
+	"github.com/f-dong/sniffy/capture/pac"
+	"github.com/f-dong/sniffy/capture/pool"
+	"github.com/f-dong/sniffy/capture/replay"
+	"github.com/f-dong/sniffy/capture/sample"
+	"github.com/f-dong/sniffy/capture/stats"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// Prefix 当前版本接口的路径前缀，不兼容的修改使用新的版本前缀
+const Prefix = "/api/v1"
+
+// Server 控制端口上的REST API，供Web界面和外部工具使用。
+// 请求和响应均为JSON，错误响应为 {"error": "..."}。
+//
+// 流：
+//
+//	GET    /api/v1/flows?filter=<表达式>&after=<流ID>&limit=<n>  流摘要列表，after 用于增量获取新流
+//	DELETE /api/v1/flows                                       清空内存中的流
+//	GET    /api/v1/flows/stats                                 内存流存储的统计，包括因内存上限丢弃的流和内容
+//	GET    /api/v1/flows/{id}                                  流详情，包含解码后的内容
+//	PATCH  /api/v1/flows/{id}                                  修改流的标签、备注、星标和标记，请求体为 Annotation
+//	GET    /api/v1/flows/{id}/request/body?raw=1               请求体，默认按 Content-Encoding 解码
+//	GET    /api/v1/flows/{id}/response/body?raw=1              响应体
+//	POST   /api/v1/flows/{id}/replay                           重放流，请求体为可选的 replay.Options
+//	POST   /api/v1/flows/{id}/compare                          把请求重放到两个环境并比较响应 {"a": "https://staging.example.com", "b": "https://api.example.com"}
+//	GET    /api/v1/diff?a=<流ID>&b=<流ID>&text=1               比较两个流的状态、头部和消息体，支持 ignore_headers、ignore_paths 和 response_only
+//	GET    /api/v1/flows/{id}/curl?insecure=1&proxy=<URL>      以 curl 命令的形式返回请求
+//	GET    /api/v1/flows/{id}/code?lang=go|python|curl         以代码的形式返回请求，同样支持 insecure 和 proxy
+//	GET    /api/v1/traces/{id}                                 W3C追踪ID或关联ID（如 X-Request-ID）为 id 的流摘要
+//	POST   /api/v1/curl                                        经由代理发送请求体中的 curl 命令，返回 replay.Result
+//	POST   /api/v1/compose                                     经由代理发送请求体中 Compose 描述的新请求，返回 replay.Result
+//	GET    /api/v1/export?format=har|pcapng|session|openapi|postman|postman-environment|csv&filter=<表达式>  导出流，openapi 由流生成API文档，postman 生成集合，postman-environment 导出集合的变量，
+//	       csv 导出摘要，columns=time,method,... 选择列
+//	POST   /api/v1/import?format=session|har|mitmproxy|charles|fiddler|curl  导入请求体中的流到内存
+//	GET    /api/v1/events?filter=<表达式>&types=<类型,...>         以 Server-Sent Events 推送流生命周期事件
+//	GET    /api/v1/cookies?client=<客户端>&filter=<表达式>          每个客户端的Cookie设置、删除和发送的时间线
+//	GET    /api/v1/sessions?cookie=<名字>&filter=<表达式>           按会话Cookie的值分组的流，未指定名字时识别常见的会话Cookie
+//	GET    /api/v1/security-headers?format=json|html&filter=<表达式>  按主机检查 HSTS、CSP、X-Content-Type-Options、Cookie 属性和 CORS 配置
+//	GET    /api/v1/cache?filter=<表达式>                         重复请求的资源被重新校验、不必要地重新下载和过期的情况
+//	GET    /api/v1/duplicates?window=2s&ignore=<参数,...>&filter=<表达式>  窗口内方法、URL和请求体都相同的重复请求
+//
+// 控制：
+//
+//	GET    /api/v1/breakpoints                                 断点规则
+//	POST   /api/v1/breakpoints                                 添加断点规则 {"phase": "request", "match": "[METHOD ]host[/path]"}
+//	DELETE /api/v1/breakpoints/{id}                            删除断点规则
+//	GET    /api/v1/intercepted                                 断点暂停中的流
+//	POST   /api/v1/intercepted/{id}/resume                     继续暂停的流，请求体为可选的 Edit
+//	POST   /api/v1/intercepted/{id}/abort                      中止暂停的流
+//	GET    /api/v1/tls/rules                                   运行时的拦截/透传规则
+//	PUT    /api/v1/tls/rules                                   设置规则 {"host": "*.example.com", "action": "passthrough"}
+//	DELETE /api/v1/tls/rules/{host}                            删除规则
+//	GET    /api/v1/tls/report?filter=<表达式>                    每个源站协商的TLS版本、密码套件、证书链、OCSP装订和较弱的配置
+//	GET    /api/v1/tls/pinning                                 客户端疑似固定证书而拒绝握手的主机
+//	GET    /api/v1/ca?format=pem|der                           下载MITM根证书
+//	GET    /api/v1/proxy.pac                                   只让配置的主机经过代理、其余主机直接连接的PAC文件
+//	GET    /api/v1/pool                                        上游连接池的统计
+//	GET    /api/v1/limits                                      并发限制的统计
+//	GET    /api/v1/sampling                                    流采样的统计
+//	GET    /api/v1/stats?by=path|host&host=<主机>&window=5m&limit=<n>  按主机和路径模板统计请求数、错误率、延迟分位数和流量
+//	GET    /api/v1/runtime                                     代理进程的goroutine、内存、GC、进行中的流和连接池的状态
+//	POST   /api/v1/reload                                      重新加载配置文件，应用规则、上游和日志的修改，返回需要重启才能生效的配置项
+//
+// 为防止用户访问的网页调用接口，来自其他站点的 Origin 和不是IP地址、localhost 或
+// SetAllowedHosts 设置的 Host 返回403。POST、PUT 和 PATCH 请求必须带有
+// Content-Type: application/json，即使没有请求体；/curl 和 /import 的请求体不是JSON，
+// 接受 text/plain 和表单以外的任意类型。
+type Server struct {
+	store       *flow.Store
+	breakpoints *breakpoint.Manager
+	replayer    *replay.Replayer
+	dialer      *dialer.Dialer
+	authority   ca.CA
+	pac         *pac.File
+	hostRules   *tlsinfo.HostRules
+	pinning     *tlsinfo.Pinning
+	events      *flow.Bus
+	pool        *pool.Pool
+	limiter     *limits.Limiter
+	sampler     *sample.Sampler
+	traffic     *stats.Collector
+	config      json.RawMessage
+	reload      func() (ReloadResult, error)
+	started     time.Time
+	hosts       map[string]bool
+	mux         *http.ServeMux
+}
+
+// New 创建管理 store 中流的API
+func New(store *flow.Store) *Server {
+	s := &Server{store: store, started: time.Now(), mux: http.NewServeMux()}
+	s.handle("GET /flows", s.listFlows)
+	s.handle("DELETE /flows", s.clearFlows)
+	s.handle("GET /flows/stats", s.storeStats)
+	s.handle("GET /flows/{id}", s.getFlow)
+	s.handle("GET /traces/{id}", s.traceFlows)
+	s.handle("PATCH /flows/{id}", s.annotateFlow)
+	s.handle("GET /flows/{id}/{part}/body", s.getBody)
+	s.handle("POST /flows/{id}/replay", s.replayFlow)
+	s.handle("POST /flows/{id}/compare", s.compareFlow)
+	s.handle("GET /diff", s.diffFlows)
+	s.handle("GET /flows/{id}/curl", s.curlFlow)
+	s.handle("GET /flows/{id}/code", s.codeFlow)
+	s.handleRaw("POST /curl", s.sendCurl)
+	s.handle("POST /compose", s.compose)
+	s.handle("GET /export", s.export)
+	s.handleRaw("POST /import", s.importFlows)
+	s.handle("GET /events", s.streamEvents)
+	s.handle("GET /cookies", s.cookieTimelines)
+	s.handle("GET /sessions", s.cookieSessions)
+	s.handle("GET /security-headers", s.securityHeaders)
+	s.handle("GET /cache", s.cacheReport)
+	s.handle("GET /duplicates", s.duplicateRequests)
+	s.handle("GET /breakpoints", s.listBreakpoints)
+	s.handle("POST /breakpoints", s.addBreakpoint)
+	s.handle("DELETE /breakpoints/{id}", s.removeBreakpoint)
+	s.handle("GET /intercepted", s.listIntercepted)
+	s.handle("POST /intercepted/{id}/resume", s.resume)
+	s.handle("POST /intercepted/{id}/abort", s.abort)
+	s.handle("GET /tls/rules", s.listHostRules)
+	s.handle("PUT /tls/rules", s.setHostRule)
+	s.handle("DELETE /tls/rules/{host}", s.removeHostRule)
+	s.handle("GET /tls/report", s.tlsReport)
+	s.handle("GET /tls/pinning", s.listPinning)
+	s.handle("GET /ca", s.downloadCA)
+	s.handle("GET /proxy.pac", s.proxyPAC)
+	s.handle("GET /pool", s.poolStats)
+	s.handle("GET /limits", s.limitStats)
+	s.handle("GET /sampling", s.sampleStats)
+	s.handle("GET /stats", s.trafficStats)
+	s.handle("GET /runtime", s.runtimeStats)
+	s.handle("POST /reload", s.reloadConfig)
+	s.mux.HandleFunc(Prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, errNotFound("endpoint"))
+	})
+	return s
+}
+
+// handle 注册 Prefix 下的接口，pattern 为 "METHOD /path"，修改状态的接口要求JSON请求体
+func (s *Server) handle(pattern string, fn http.HandlerFunc) {
+	method, path, _ := strings.Cut(pattern, " ")
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		fn = requireContentType("application/json", fn)
+	}
+	s.mux.HandleFunc(method+" "+Prefix+path, fn)
+}
+
+// handleRaw 注册请求体不是JSON的接口，拒绝网页可以跨站发送的请求体类型
+func (s *Server) handleRaw(pattern string, fn http.HandlerFunc) {
+	method, path, _ := strings.Cut(pattern, " ")
+	s.mux.HandleFunc(method+" "+Prefix+path, requireContentType("", fn))
+}
+
+// SetBreakpoints 设置断点管理器，未设置时断点接口返回501
+func (s *Server) SetBreakpoints(m *breakpoint.Manager) {
+	s.breakpoints = m
+}
+
+// SetReplayer 设置重放使用的重放器，未设置时重放接口返回501
+func (s *Server) SetReplayer(r *replay.Replayer) {
+	s.replayer = r
+}
+
+// SetDialer 设置上游拨号器，用于登记新请求携带的客户端证书，未设置时不支持指定客户端证书
+func (s *Server) SetDialer(d *dialer.Dialer) {
+	s.dialer = d
+}
+
+// SetCA 设置MITM使用的CA，未设置时证书下载接口返回404
+func (s *Server) SetCA(authority ca.CA) {
+	s.authority = authority
+}
+
+// SetPAC 设置客户端自动配置使用的PAC文件，未设置时PAC接口返回501
+func (s *Server) SetPAC(f *pac.File) {
+	s.pac = f
+}
+
+// SetHostRules 设置运行时的拦截/透传规则，未设置时规则接口返回501
+func (s *Server) SetHostRules(rules *tlsinfo.HostRules) {
+	s.hostRules = rules
+}
+
+// SetPinning 设置疑似证书固定导致的握手失败的记录，未设置时接口返回501
+func (s *Server) SetPinning(p *tlsinfo.Pinning) {
+	s.pinning = p
+}
+
+// SetEvents 设置流事件总线，未设置时事件流接口返回501
+func (s *Server) SetEvents(b *flow.Bus) {
+	s.events = b
+}
+
+// SetPool 设置上游连接池，未设置时统计接口返回空的统计
+func (s *Server) SetPool(p *pool.Pool) {
+	s.pool = p
+}
+
+// SetLimiter 设置并发限制，未设置时统计接口返回空的统计
+func (s *Server) SetLimiter(l *limits.Limiter) {
+	s.limiter = l
+}
+
+// SetSampler 设置流采样器，未设置时统计接口返回空的统计
+func (s *Server) SetSampler(sm *sample.Sampler) {
+	s.sampler = sm
+}
+
+// SetStats 设置流量统计，未设置时统计接口不可用
+func (s *Server) SetStats(c *stats.Collector) {
+	s.traffic = c
+}
+
+// SetSessionConfig 设置导出会话时保存的捕获配置
+func (s *Server) SetSessionConfig(config json.RawMessage) {
+	s.config = config
+}
+
+// SetReload 设置重新加载配置的函数，未设置时重新加载接口返回501
+func (s *Server) SetReload(fn func() (ReloadResult, error)) {
+	s.reload = fn
+}
+
+// ServeHTTP 实现 http.Handler 接口
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Protect(s.mux).ServeHTTP(w, r)
+}
+
+// errNotFound 返回资源不存在的错误
+func errNotFound(what string) error {
+	return fmt.Errorf("%s not found", what)
+}
+
+// writeJSON 写入JSON响应
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write API response: %v", err)
+	}
+}
+
+// writeError 写入JSON格式的错误响应
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
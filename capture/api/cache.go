@@ -0,0 +1,22 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/f-dong/sniffy/capture/cachereport"
+)
+
+// cacheReport 分析满足过滤条件的流中重复请求的资源的缓存表现
+func (s *Server) cacheReport(w http.ResponseWriter, r *http.Request) {
+	flows, err := s.query(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cachereport.Analyze(flows))
+}
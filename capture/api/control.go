@@ -0,0 +1,419 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/pac"
+	"github.com/f-dong/sniffy/capture/stats"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// BreakpointRequest 添加断点规则的请求
+type BreakpointRequest struct {
+	// Phase 触发阶段：request 或 response
+	Phase string `json:"phase"`
+
+	// Match 匹配规则，格式为 [METHOD ]host[/path]
+	Match string `json:"match"`
+}
+
+// RuntimeStats 代理进程自身的运行状态，用于诊断代理的性能问题
+type RuntimeStats struct {
+	GoVersion  string `json:"go_version"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+
+	// Uptime 控制端口启动以来的秒数
+	Uptime float64 `json:"uptime_seconds"`
+
+	// Goroutines 当前的goroutine数量
+	Goroutines int `json:"goroutines"`
+
+	// HeapAlloc、HeapObjects 和 Sys 堆上已分配的字节数、对象数和从系统获得的内存
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapObjects uint64 `json:"heap_objects"`
+	Sys         uint64 `json:"sys"`
+
+	// NumGC 和 GCPauseTotal 完成的GC次数和累计暂停的毫秒数
+	NumGC        uint32    `json:"num_gc"`
+	GCPauseTotal float64   `json:"gc_pause_total_ms"`
+	LastGC       time.Time `json:"last_gc,omitzero"`
+
+	// ActiveFlows 正在进行中的流，StoredFlows 和 StoredBytes 内存中保存的流及其占用的内存
+	ActiveFlows int64 `json:"active_flows"`
+	StoredFlows int   `json:"stored_flows"`
+	StoredBytes int64 `json:"stored_bytes"`
+
+	// ClientConns 当前的客户端连接数
+	ClientConns int64 `json:"client_conns"`
+
+	// PoolIdle、PoolInUse、PoolHTTP2 和 PoolStreams 连接池中所有源站的连接数合计，含义见 pool.OriginStats
+	PoolIdle    int `json:"pool_idle"`
+	PoolInUse   int `json:"pool_in_use"`
+	PoolHTTP2   int `json:"pool_http2"`
+	PoolStreams int `json:"pool_streams"`
+}
+
+// ReloadResult 重新加载配置的结果
+type ReloadResult struct {
+	// Restart 已修改但需要重启才能生效的配置项
+	Restart []string `json:"restart_required,omitempty"`
+}
+
+// Edit 继续暂停的流之前对请求或响应的修改，零值字段保持不变。
+// 请求阶段修改请求，响应阶段修改响应
+type Edit struct {
+	// Method 替换请求方法，仅请求阶段
+	Method string `json:"method,omitempty"`
+
+	// URL 替换请求URL，仅请求阶段
+	URL string `json:"url,omitempty"`
+
+	// Status 替换响应状态码，仅响应阶段
+	Status int `json:"status,omitempty"`
+
+	// Header 设置的头部，覆盖同名的原始头部
+	Header http.Header `json:"header,omitempty"`
+
+	// RemoveHeaders 删除的头部
+	RemoveHeaders []string `json:"remove_headers,omitempty"`
+
+	// Body 替换内容（base64），为nil时保持不变
+	Body []byte `json:"body,omitempty"`
+}
+
+// listBreakpoints 返回断点规则
+func (s *Server) listBreakpoints(w http.ResponseWriter, _ *http.Request) {
+	if !s.requireBreakpoints(w) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.breakpoints.Rules())
+}
+
+// addBreakpoint 添加断点规则
+func (s *Server) addBreakpoint(w http.ResponseWriter, r *http.Request) {
+	if !s.requireBreakpoints(w) {
+		return
+	}
+	var req BreakpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid breakpoint: %w", err))
+		return
+	}
+	phase, err := breakpoint.ParsePhase(req.Phase)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	rule := s.breakpoints.AddRule(phase, flow.ParseMatcher(req.Match))
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+// removeBreakpoint 删除断点规则
+func (s *Server) removeBreakpoint(w http.ResponseWriter, r *http.Request) {
+	if !s.requireBreakpoints(w) {
+		return
+	}
+	if err := s.breakpoints.RemoveRule(r.PathValue("id")); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listIntercepted 返回断点暂停中的流
+func (s *Server) listIntercepted(w http.ResponseWriter, _ *http.Request) {
+	if !s.requireBreakpoints(w) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.breakpoints.Pending())
+}
+
+// resume 继续暂停的流，请求体中的 Edit 在继续前应用到流上
+func (s *Server) resume(w http.ResponseWriter, r *http.Request) {
+	if !s.requireBreakpoints(w) {
+		return
+	}
+	id := r.PathValue("id")
+	p, ok := s.breakpoints.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, breakpoint.ErrNotFound)
+		return
+	}
+	var edit *Edit
+	if r.ContentLength != 0 {
+		edit = &Edit{}
+		if err := json.NewDecoder(r.Body).Decode(edit); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid edit: %w", err))
+			return
+		}
+	}
+	var apply func(*flow.Flow)
+	if edit != nil {
+		phase := p.Phase
+		apply = func(f *flow.Flow) { edit.apply(phase, f) }
+	}
+	if err := s.breakpoints.Resume(id, apply); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// abort 中止暂停的流
+func (s *Server) abort(w http.ResponseWriter, r *http.Request) {
+	if !s.requireBreakpoints(w) {
+		return
+	}
+	if err := s.breakpoints.Abort(r.PathValue("id")); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireBreakpoints 未设置断点管理器时返回501
+func (s *Server) requireBreakpoints(w http.ResponseWriter) bool {
+	if s.breakpoints == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("breakpoints are not available"))
+		return false
+	}
+	return true
+}
+
+// listHostRules 返回运行时的拦截/透传规则
+func (s *Server) listHostRules(w http.ResponseWriter, _ *http.Request) {
+	if !s.requireHostRules(w) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.hostRules.List())
+}
+
+// setHostRule 设置主机的拦截/透传规则
+func (s *Server) setHostRule(w http.ResponseWriter, r *http.Request) {
+	if !s.requireHostRules(w) {
+		return
+	}
+	var rule tlsinfo.HostRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid TLS rule: %w", err))
+		return
+	}
+	if rule.Host == "" || rule.Action == tlsinfo.ActionDefault {
+		writeError(w, http.StatusBadRequest, errors.New("invalid TLS rule: host and action are required"))
+		return
+	}
+	s.hostRules.Set(rule.Host, rule.Action)
+	writeJSON(w, http.StatusOK, s.hostRules.List())
+}
+
+// removeHostRule 删除主机的拦截/透传规则
+func (s *Server) removeHostRule(w http.ResponseWriter, r *http.Request) {
+	if !s.requireHostRules(w) {
+		return
+	}
+	if !s.hostRules.Remove(r.PathValue("host")) {
+		writeError(w, http.StatusNotFound, errNotFound("TLS rule"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listPinning 返回客户端疑似固定证书的主机
+func (s *Server) listPinning(w http.ResponseWriter, _ *http.Request) {
+	if s.pinning == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("pinning detection is not available"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.pinning.Hosts())
+}
+
+// requireHostRules 未设置主机规则时返回501
+func (s *Server) requireHostRules(w http.ResponseWriter) bool {
+	if s.hostRules == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("TLS rules are not available"))
+		return false
+	}
+	return true
+}
+
+// downloadCA 下载MITM根证书，默认为PEM格式
+func (s *Server) downloadCA(w http.ResponseWriter, r *http.Request) {
+	if s.authority == nil {
+		writeError(w, http.StatusNotFound, errNotFound("CA certificate"))
+		return
+	}
+	der := s.authority.GetCA().Raw
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "pem":
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Header().Set("Content-Disposition", `attachment; filename="sniffy-ca.pem"`)
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	case "der", "crt", "cer":
+		w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+		w.Header().Set("Content-Disposition", `attachment; filename="sniffy-ca.crt"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(der)))
+		w.Write(der)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported certificate format %q", format))
+	}
+}
+
+// proxyPAC 返回PAC文件，代理地址未指定时使用客户端访问控制端口的主机
+func (s *Server) proxyPAC(w http.ResponseWriter, r *http.Request) {
+	if s.pac == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("PAC file is not available"))
+		return
+	}
+	w.Header().Set("Content-Type", pac.ContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(w, s.pac.Script(r.Host))
+}
+
+// poolStats 返回上游连接池的统计
+func (s *Server) poolStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.pool.Stats())
+}
+
+// runtimeStats 返回代理进程的运行状态
+func (s *Server) runtimeStats(w http.ResponseWriter, _ *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	store := s.store.Stats()
+	stats := RuntimeStats{
+		GoVersion:    runtime.Version(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		Uptime:       time.Since(s.started).Seconds(),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    mem.HeapAlloc,
+		HeapObjects:  mem.HeapObjects,
+		Sys:          mem.Sys,
+		NumGC:        mem.NumGC,
+		GCPauseTotal: float64(mem.PauseTotalNs) / float64(time.Millisecond),
+		ActiveFlows:  s.events.InFlight(),
+		StoredFlows:  store.Flows,
+		StoredBytes:  store.Bytes,
+		ClientConns:  s.limiter.Stats().Conns,
+	}
+	if mem.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(mem.LastGC))
+	}
+	for _, o := range s.pool.Stats().Origins {
+		stats.PoolIdle += o.Idle
+		stats.PoolInUse += o.InUse
+		stats.PoolHTTP2 += o.HTTP2
+		stats.PoolStreams += o.Streams
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// reloadConfig 重新加载配置，配置无效时返回422并保留当前配置
+func (s *Server) reloadConfig(w http.ResponseWriter, _ *http.Request) {
+	if s.reload == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("configuration reload is not available"))
+		return
+	}
+	result, err := s.reload()
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// limitStats 返回并发限制的统计
+func (s *Server) limitStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.limiter.Stats())
+}
+
+// sampleStats 返回流采样的统计
+func (s *Server) sampleStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.sampler.Stats())
+}
+
+// trafficStats 返回窗口内按主机或路径模板分组的流量统计
+func (s *Server) trafficStats(w http.ResponseWriter, r *http.Request) {
+	if s.traffic == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("traffic statistics are not available"))
+		return
+	}
+	params := r.URL.Query()
+	q := stats.Query{By: params.Get("by"), Host: params.Get("host")}
+	if v := params.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid window %q", v))
+			return
+		}
+		q.Window = d
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v))
+			return
+		}
+		q.Limit = n
+	}
+	report, err := s.traffic.Query(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// apply 将修改应用到暂停阶段对应的请求或响应
+func (e *Edit) apply(phase breakpoint.Phase, f *flow.Flow) {
+	var header *http.Header
+	var body *[]byte
+	switch {
+	case phase == breakpoint.PhaseRequest && f.Request != nil:
+		if e.Method != "" {
+			f.Request.Method = e.Method
+		}
+		if e.URL != "" {
+			f.Request.URL = e.URL
+		}
+		header, body = &f.Request.Header, &f.Request.Body
+	case phase == breakpoint.PhaseResponse && f.Response != nil:
+		if e.Status != 0 {
+			f.Response.StatusCode = e.Status
+			f.Response.Status = fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status))
+		}
+		header, body = &f.Response.Header, &f.Response.Body
+	default:
+		return
+	}
+
+	if *header == nil {
+		*header = http.Header{}
+	}
+	for name, values := range e.Header {
+		(*header)[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+	}
+	for _, name := range e.RemoveHeaders {
+		header.Del(name)
+	}
+	if e.Body != nil {
+		// 新内容未经压缩
+		*body = e.Body
+		header.Del("Content-Encoding")
+		if header.Get("Content-Length") != "" {
+			header.Set("Content-Length", strconv.Itoa(len(e.Body)))
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/ca"
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/pac"
+	"github.com/f-dong/sniffy/capture/stats"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// do 以本机控制端口的 Host 发送 method 请求，请求体为JSON，v 不为空时解析响应
+func do(t *testing.T, h http.Handler, method, target, body string, v any) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	req.Host = "127.0.0.1:8081"
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if v != nil {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), rec.Body.String())
+	}
+	return rec
+}
+
+// pauseFlow 在后台暂停流，返回接收决定的通道
+func pauseFlow(t *testing.T, m *breakpoint.Manager, phase breakpoint.Phase, f *flow.Flow) <-chan breakpoint.Decision {
+	ch := make(chan breakpoint.Decision, 1)
+	go func() {
+		d, _ := m.Pause(context.Background(), phase, f)
+		ch <- d
+	}()
+	require.Eventually(t, func() bool {
+		_, ok := m.Get(f.ID + "-" + phase.String())
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	return ch
+}
+
+// --- 测试代码 ---
+func TestServer_Unavailable(t *testing.T) {
+	s := New(flow.NewStore())
+	require.Equal(t, http.StatusNotImplemented, do(t, s, http.MethodGet, "/api/v1/breakpoints", "", nil).Code)
+	require.Equal(t, http.StatusNotImplemented, do(t, s, http.MethodGet, "/api/v1/intercepted", "", nil).Code)
+	require.Equal(t, http.StatusNotImplemented, do(t, s, http.MethodGet, "/api/v1/tls/rules", "", nil).Code)
+	require.Equal(t, http.StatusNotFound, do(t, s, http.MethodGet, "/api/v1/ca", "", nil).Code)
+	require.Equal(t, http.StatusNotImplemented, do(t, s, http.MethodGet, "/api/v1/stats", "", nil).Code)
+}
+
+func TestServer_Stats(t *testing.T) {
+	s := New(flow.NewStore())
+	traffic := stats.New(time.Minute)
+	s.SetStats(traffic)
+	for _, u := range []string{"https://a.test/users/1", "https://a.test/users/2", "https://b.test/"} {
+		f := flow.New()
+		f.Request = &flow.Request{Method: "GET", URL: u}
+		f.Response = &flow.Response{StatusCode: 200}
+		traffic.Add(f)
+	}
+
+	var report stats.Report
+	require.Equal(t, http.StatusOK, do(t, s, http.MethodGet, "/api/v1/stats?window=30s", "", &report).Code)
+	require.EqualValues(t, 3, report.Total.Requests)
+	require.Len(t, report.Rows, 2)
+	require.Equal(t, "/users/{userId}", report.Rows[0].Path)
+	require.EqualValues(t, 2, report.Rows[0].Requests)
+
+	report = stats.Report{}
+	require.Equal(t, http.StatusOK, do(t, s, http.MethodGet, "/api/v1/stats?by=host&host=b.test", "", &report).Code)
+	require.Len(t, report.Rows, 1)
+	require.Equal(t, "b.test", report.Rows[0].Host)
+
+	require.Equal(t, http.StatusBadRequest, do(t, s, http.MethodGet, "/api/v1/stats?by=status", "", nil).Code)
+	require.Equal(t, http.StatusBadRequest, do(t, s, http.MethodGet, "/api/v1/stats?window=soon", "", nil).Code)
+	require.Equal(t, http.StatusBadRequest, do(t, s, http.MethodGet, "/api/v1/stats?limit=0", "", nil).Code)
+}
+
+func TestServer_Runtime(t *testing.T) {
+	store := flow.NewStore()
+	s := New(store)
+	bus := flow.NewBus()
+	s.SetEvents(bus)
+	done := flow.New()
+	done.Request = &flow.Request{Method: "GET", URL: "https://a.test/"}
+	store.Add(done)
+	active := flow.New()
+	active.Request = &flow.Request{Method: "GET", URL: "https://a.test/slow"}
+	bus.Started(active)
+
+	var stats RuntimeStats
+	require.Equal(t, http.StatusOK, do(t, s, http.MethodGet, "/api/v1/runtime", "", &stats).Code)
+	require.Positive(t, stats.Goroutines)
+	require.Positive(t, stats.HeapAlloc)
+	require.EqualValues(t, 1, stats.ActiveFlows)
+	require.Equal(t, 1, stats.StoredFlows)
+
+	bus.Finished(active)
+	require.Equal(t, http.StatusOK, do(t, s, http.MethodGet, "/api/v1/runtime", "", &stats).Code)
+	require.Zero(t, stats.ActiveFlows)
+}
+
+func TestServer_Reload(t *testing.T) {
+	s := New(flow.NewStore())
+	require.Equal(t, http.StatusNotImplemented, do(t, s, http.MethodPost, "/api/v1/reload", "", nil).Code)
+
+	var err error
+	s.SetReload(func() (ReloadResult, error) {
+		return ReloadResult{Restart: []string{"port"}}, err
+	})
+	var result ReloadResult
+	require.Equal(t, http.StatusOK, do(t, s, http.MethodPost, "/api/v1/reload", "", &result).Code)
+	require.Equal(t, []string{"port"}, result.Restart)
+
+	err = errors.New("config.yaml: line 3: unknown key \"prot\"")
+	var body map[string]string
+	require.Equal(t, http.StatusUnprocessableEntity, do(t, s, http.MethodPost, "/api/v1/reload", "", &body).Code)
+	require.Equal(t, err.Error(), body["error"])
+}
+
+func TestServer_Breakpoints(t *testing.T) {
+	s := New(flow.NewStore())
+	m := breakpoint.NewManager()
+	s.SetBreakpoints(m)
+
+	var rule breakpoint.Rule
+	rec := do(t, s, http.MethodPost, "/api/v1/breakpoints", `{"phase":"request","match":"POST api.example.com/v1"}`, &rule)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, "1", rule.ID)
+	require.Equal(t, breakpoint.PhaseRequest, rule.Phase)
+
+	require.Equal(t, http.StatusBadRequest, do(t, s, http.MethodPost, "/api/v1/breakpoints", `{"phase":"later"}`, nil).Code)
+	require.Equal(t, http.StatusBadRequest, do(t, s, http.MethodPost, "/api/v1/breakpoints", `{`, nil).Code)
+
+	var rules []json.RawMessage
+	do(t, s, http.MethodGet, "/api/v1/breakpoints", "", &rules)
+	require.Len(t, rules, 1)
+
+	require.Equal(t, http.StatusNoContent, do(t, s, http.MethodDelete, "/api/v1/breakpoints/1", "", nil).Code)
+	require.Equal(t, http.StatusNotFound, do(t, s, http.MethodDelete, "/api/v1/breakpoints/1", "", nil).Code)
+	require.Empty(t, m.Rules())
+}
+
+func TestServer_Intercepted(t *testing.T) {
+	s := New(flow.NewStore())
+	m := breakpoint.NewManager()
+	s.SetBreakpoints(m)
+	m.AddRule(breakpoint.PhaseRequest, flow.ParseMatcher("api.example.com"))
+	m.AddRule(breakpoint.PhaseResponse, flow.ParseMatcher("api.example.com"))
+
+	req := flow.New()
+	req.Request = &flow.Request{Method: "GET", URL: "https://api.example.com/a", Host: "api.example.com", Header: http.Header{"X-Old": {"1"}}}
+	reqDone := pauseFlow(t, m, breakpoint.PhaseRequest, req)
+
+	resp := flow.New()
+	resp.Request = &flow.Request{Method: "GET", URL: "https://api.example.com/b", Host: "api.example.com"}
+	resp.Response = &flow.Response{StatusCode: 200, Status: "200 OK", Header: http.Header{"Content-Encoding": {"gzip"}, "Content-Length": {"20"}}, Body: []byte("compressed")}
+	respDone := pauseFlow(t, m, breakpoint.PhaseResponse, resp)
+
+	var pending []struct {
+		ID    string          `json:"id"`
+		Phase string          `json:"phase"`
+		Flow  json.RawMessage `json:"flow"`
+	}
+	do(t, s, http.MethodGet, "/api/v1/intercepted", "", &pending)
+	require.Len(t, pending, 2)
+	require.Equal(t, "request", pending[0].Phase)
+	require.Equal(t, "response", pending[1].Phase)
+
+	// 编辑请求后继续
+	rec := do(t, s, http.MethodPost, "/api/v1/intercepted/"+pending[0].ID+"/resume",
+		`{"method":"PUT","url":"https://api.example.com/edited","header":{"x-new":["2"]},"remove_headers":["X-Old"]}`, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.Equal(t, breakpoint.DecisionResume, <-reqDone)
+	require.Equal(t, "PUT", req.Request.Method)
+	require.Equal(t, "https://api.example.com/edited", req.Request.URL)
+	require.Equal(t, http.Header{"X-New": {"2"}}, req.Request.Header)
+
+	// 编辑响应，新内容去掉压缩
+	rec = do(t, s, http.MethodPost, "/api/v1/intercepted/"+pending[1].ID+"/resume", `{"status":418,"body":"cGxhaW4="}`, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.Equal(t, breakpoint.DecisionResume, <-respDone)
+	require.Equal(t, 418, resp.Response.StatusCode)
+	require.Equal(t, "418 I'm a teapot", resp.Response.Status)
+	require.Equal(t, "plain", string(resp.Response.Body))
+	require.Empty(t, resp.Response.Header.Get("Content-Encoding"))
+	require.Equal(t, "5", resp.Response.Header.Get("Content-Length"))
+
+	// 中止
+	abort := flow.New()
+	abort.Request = &flow.Request{Method: "GET", URL: "https://api.example.com/c", Host: "api.example.com"}
+	abortDone := pauseFlow(t, m, breakpoint.PhaseRequest, abort)
+	require.Equal(t, http.StatusNoContent, do(t, s, http.MethodPost, "/api/v1/intercepted/"+abort.ID+"-request/abort", "", nil).Code)
+	require.Equal(t, breakpoint.DecisionAbort, <-abortDone)
+
+	require.Equal(t, http.StatusNotFound, do(t, s, http.MethodPost, "/api/v1/intercepted/missing/resume", "", nil).Code)
+	require.Equal(t, http.StatusNotFound, do(t, s, http.MethodPost, "/api/v1/intercepted/missing/abort", "", nil).Code)
+}
+
+func TestServer_HostRules(t *testing.T) {
+	s := New(flow.NewStore())
+	rules := tlsinfo.NewHostRules()
+	s.SetHostRules(rules)
+
+	var list []tlsinfo.HostRule
+	rec := do(t, s, http.MethodPut, "/api/v1/tls/rules", `{"host":"*.bank.example","action":"passthrough"}`, &list)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, []tlsinfo.HostRule{{Host: "*.bank.example", Action: tlsinfo.ActionPassthrough}}, list)
+	require.Equal(t, tlsinfo.ActionPassthrough, rules.Policy()("www.bank.example:443", &tlsinfo.ClientHello{ServerName: "www.bank.example"}))
+
+	require.Equal(t, http.StatusBadRequest, do(t, s, http.MethodPut, "/api/v1/tls/rules", `{"host":"a.example","action":"drop"}`, nil).Code)
+	require.Equal(t, http.StatusBadRequest, do(t, s, http.MethodPut, "/api/v1/tls/rules", `{"host":"a.example"}`, nil).Code)
+
+	do(t, s, http.MethodGet, "/api/v1/tls/rules", "", &list)
+	require.Len(t, list, 1)
+	require.Equal(t, http.StatusNoContent, do(t, s, http.MethodDelete, "/api/v1/tls/rules/*.bank.example", "", nil).Code)
+	require.Equal(t, http.StatusNotFound, do(t, s, http.MethodDelete, "/api/v1/tls/rules/*.bank.example", "", nil).Code)
+}
+
+func TestServer_Pinning(t *testing.T) {
+	s := New(flow.NewStore())
+	require.Equal(t, http.StatusNotImplemented, do(t, s, http.MethodGet, "/api/v1/tls/pinning", "", nil).Code)
+
+	pinning := tlsinfo.NewPinning(tlsinfo.NewHostRules())
+	pinning.Record("app.example.com", "client sent alert: bad certificate")
+	s.SetPinning(pinning)
+	var hosts []tlsinfo.PinnedHost
+	require.Equal(t, http.StatusOK, do(t, s, http.MethodGet, "/api/v1/tls/pinning", "", &hosts).Code)
+	require.Len(t, hosts, 1)
+	require.Equal(t, "app.example.com", hosts[0].Host)
+	require.True(t, hosts[0].Passthrough)
+}
+
+func TestServer_DownloadCA(t *testing.T) {
+	authority, err := ca.NewInMemorySelfSignedCA()
+	require.NoError(t, err)
+	s := New(flow.NewStore())
+	s.SetCA(authority)
+
+	rec := do(t, s, http.MethodGet, "/api/v1/ca", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	block, _ := pem.Decode(rec.Body.Bytes())
+	require.NotNil(t, block)
+	require.Equal(t, authority.GetCA().Raw, block.Bytes)
+
+	rec = do(t, s, http.MethodGet, "/api/v1/ca?format=der", "", nil)
+	cert, err := x509.ParseCertificate(rec.Body.Bytes())
+	require.NoError(t, err)
+	require.True(t, cert.IsCA)
+
+	require.Equal(t, http.StatusBadRequest, do(t, s, http.MethodGet, "/api/v1/ca?format=p12", "", nil).Code)
+}
+
+func TestServer_ProxyPAC(t *testing.T) {
+	s := New(flow.NewStore())
+	require.Equal(t, http.StatusNotImplemented, do(t, s, http.MethodGet, "/api/v1/proxy.pac", "", nil).Code)
+
+	f, err := pac.New("0.0.0.0:8080", []string{"*.example.com"})
+	require.NoError(t, err)
+	s.SetPAC(f)
+	rec := do(t, s, http.MethodGet, "/api/v1/proxy.pac", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, pac.ContentType, rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Body.String(), `dnsDomainIs(host, ".example.com")`)
+
+	// 代理监听所有地址时使用客户端访问控制端口的主机
+	s.SetAllowedHosts([]string{"sniffy.lan"})
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://sniffy.lan:8081/api/v1/proxy.pac", nil)
+	s.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"PROXY sniffy.lan:8080"`)
+}
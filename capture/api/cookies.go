@@ -0,0 +1,36 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/f-dong/sniffy/capture/cookies"
+)
+
+// cookieTimelines 返回满足过滤条件的流中每个客户端的Cookie时间线，client 参数只返回该客户端
+func (s *Server) cookieTimelines(w http.ResponseWriter, r *http.Request) {
+	flows, err := s.query(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cookies.Timelines(flows, r.URL.Query().Get("client")))
+}
+
+// cookieSessions 按会话Cookie的值对满足过滤条件的流分组，cookie 参数指定会话Cookie的名字
+func (s *Server) cookieSessions(w http.ResponseWriter, r *http.Request) {
+	flows, err := s.query(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	sessions := cookies.Sessions(flows, r.URL.Query().Get("cookie"))
+	if sessions == nil {
+		sessions = []*cookies.Session{}
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
@@ -0,0 +1,127 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/diff"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/replay"
+)
+
+// Compare 把同一请求重放到两个环境并比较响应
+type Compare struct {
+	// A 和 B 两个环境的源，例如 https://staging.example.com，替换原始URL的协议和主机
+	A string `json:"a"`
+	B string `json:"b"`
+
+	// IgnoreHeaders 不比较的头部，为空时使用 diff.DefaultIgnoreHeaders
+	IgnoreHeaders []string `json:"ignore_headers,omitempty"`
+
+	// IgnorePaths 不比较的JSON路径，例如 $.timestamp
+	IgnorePaths []string `json:"ignore_paths,omitempty"`
+}
+
+// CompareResult 两次重放的结果及响应的差异
+type CompareResult struct {
+	A    *replay.Result `json:"a"`
+	B    *replay.Result `json:"b"`
+	Diff *diff.Result   `json:"diff"`
+}
+
+// diffOptions 由查询参数构造比较选项，ignore_headers 和 ignore_paths 以逗号分隔
+func diffOptions(q url.Values) *diff.Options {
+	opts := &diff.Options{ResponseOnly: q.Get("response_only") != ""}
+	if h := q.Get("ignore_headers"); h != "" {
+		opts.IgnoreHeaders = strings.Split(h, ",")
+	}
+	if p := q.Get("ignore_paths"); p != "" {
+		opts.IgnorePaths = strings.Split(p, ",")
+	}
+	return opts
+}
+
+// diffFlows 比较 a 和 b 两个流，text 不为空时返回文本形式的差异
+func (s *Server) diffFlows(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	a, okA := s.store.Get(q.Get("a"))
+	b, okB := s.store.Get(q.Get("b"))
+	if !okA || !okB {
+		writeError(w, http.StatusNotFound, errNotFound("flow"))
+		return
+	}
+	result := diff.Flows(a, b, diffOptions(q))
+	if q.Get("text") != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		result.WriteText(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// compareFlow 把流的请求分别重放到两个环境，返回两次重放的结果和响应的差异
+func (s *Server) compareFlow(w http.ResponseWriter, r *http.Request) {
+	if s.replayer == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("replay is not available"))
+		return
+	}
+	f, ok := s.store.Get(r.PathValue("id"))
+	if !ok || f.Request == nil {
+		writeError(w, http.StatusNotFound, errNotFound("flow"))
+		return
+	}
+	var c Compare
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	urlA, err := rebase(f.Request.URL, c.A)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	urlB, err := rebase(f.Request.URL, c.B)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result := &CompareResult{}
+	if result.A, err = s.replayer.Replay(r.Context(), f, &replay.Options{URL: urlA}); err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	if result.B, err = s.replayer.Replay(r.Context(), f, &replay.Options{URL: urlB}); err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	result.Diff = diff.Flows(
+		&flow.Flow{ID: result.A.FlowID, Response: result.A.Response},
+		&flow.Flow{ID: result.B.FlowID, Response: result.B.Response},
+		&diff.Options{IgnoreHeaders: c.IgnoreHeaders, IgnorePaths: c.IgnorePaths, ResponseOnly: true},
+	)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// rebase 用 origin 的协议和主机替换 rawURL 的协议和主机
+func rebase(rawURL, origin string) (string, error) {
+	o, err := url.Parse(origin)
+	if err != nil || (o.Scheme != "http" && o.Scheme != "https") || o.Host == "" || strings.Trim(o.Path, "/") != "" {
+		return "", fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid request URL: %w", err)
+	}
+	u.Scheme, u.Host = o.Scheme, o.Host
+	return u.String(), nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/duplicates"
+)
+
+// duplicateRequests 找出满足过滤条件的流中窗口内重复的请求
+func (s *Server) duplicateRequests(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	var opts duplicates.Options
+	if v := params.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid window %q", v))
+			return
+		}
+		opts.Window = d
+	}
+	if v := params.Get("ignore"); v != "" {
+		opts.IgnoreParams = strings.Split(v, ",")
+	}
+	flows, err := s.query(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, duplicates.Analyze(flows, opts))
+}
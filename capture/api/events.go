@@ -0,0 +1,89 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// eventBuffer 每个事件流连接的缓冲事件数，客户端读取过慢时超出的事件被丢弃
+const eventBuffer = 256
+
+// heartbeatInterval 事件流的心跳间隔，防止空闲连接被中间代理断开
+const heartbeatInterval = 15 * time.Second
+
+// streamEvents 以 Server-Sent Events 推送流生命周期事件，事件名为事件类型，数据为 flow.Event 的JSON。
+// filter 参数按事件发生时的流状态过滤，types 参数为逗号分隔的事件类型
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	if s.events == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("event stream is not available"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	var match func(*flow.Flow) bool
+	if expr := r.URL.Query().Get("filter"); expr != "" {
+		fl, err := filter.Compile(expr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		match = fl.Match
+	}
+	var types map[flow.EventType]bool
+	if v := r.URL.Query().Get("types"); v != "" {
+		types = make(map[flow.EventType]bool)
+		for _, name := range strings.Split(v, ",") {
+			types[flow.EventType(strings.TrimSpace(name))] = true
+		}
+	}
+
+	events, cancel := s.events.Subscribe(eventBuffer, match)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case e := <-events:
+			if types != nil && !types[e.Type] {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// readEvent 读取下一个SSE事件，返回事件名和数据
+func readEvent(t *testing.T, r *bufio.Reader) (string, flow.Event) {
+	var name string
+	var e flow.Event
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if name != "" {
+				return name, e
+			}
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e))
+		}
+	}
+}
+
+// --- 测试代码 ---
+func TestServer_Events(t *testing.T) {
+	bus := flow.NewBus()
+	s := New(flow.NewStore())
+	s.SetEvents(bus)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/events?filter=" + url.QueryEscape("host == api.example.com") + "&types=request_started,body_chunk,completed")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	require.Eventually(t, bus.Active, time.Second, 10*time.Millisecond)
+
+	other := flow.New()
+	other.Request = &flow.Request{Method: "GET", URL: "https://other.example.com/", Host: "other.example.com"}
+	bus.Started(other)
+
+	f := flow.New()
+	f.Request = &flow.Request{Method: "POST", URL: "https://api.example.com/v1", Host: "api.example.com", Header: http.Header{"X-Id": {"1"}}}
+	bus.Started(f)
+	f.Response = &flow.Response{StatusCode: 200, Header: http.Header{}}
+	bus.ResponseHeaders(f)
+	body := bus.BodyReader(f, "response", strings.NewReader("hello"))
+	buf := make([]byte, 3)
+	body.Read(buf)
+	body.Read(buf)
+	f.EndTime = f.StartTime.Add(time.Second)
+	bus.Finished(f)
+
+	r := bufio.NewReader(resp.Body)
+	name, e := readEvent(t, r)
+	require.Equal(t, "request_started", name)
+	require.Equal(t, f.ID, e.FlowID)
+	require.Equal(t, "POST", e.Method)
+	require.Equal(t, "1", e.Header.Get("X-Id"))
+
+	_, e = readEvent(t, r)
+	require.Equal(t, flow.EventBodyChunk, e.Type)
+	require.Equal(t, "response", e.Part)
+	require.Equal(t, 3, e.Size)
+	_, e = readEvent(t, r)
+	require.Equal(t, int64(3), e.Offset)
+	require.Equal(t, 2, e.Size)
+
+	name, e = readEvent(t, r)
+	require.Equal(t, "completed", name)
+	require.Equal(t, float64(1000), e.Duration)
+	require.Equal(t, "POST", e.Method)
+	require.Equal(t, 200, e.StatusCode)
+}
+
+func TestServer_EventsUnavailable(t *testing.T) {
+	s := New(flow.NewStore())
+	require.Equal(t, http.StatusNotImplemented, do(t, s, http.MethodGet, "/api/v1/events", "", nil).Code)
+
+	s.SetEvents(flow.NewBus())
+	require.Equal(t, http.StatusBadRequest, do(t, s, http.MethodGet, "/api/v1/events?filter=status+>>", "", nil).Code)
+}
@@ -0,0 +1,642 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/f-dong/sniffy/capture/charles"
+	"github.com/f-dong/sniffy/capture/codegen"
+	"github.com/f-dong/sniffy/capture/curl"
+	"github.com/f-dong/sniffy/capture/dialer"
+	"github.com/f-dong/sniffy/capture/fiddler"
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/flowcsv"
+	"github.com/f-dong/sniffy/capture/har"
+	"github.com/f-dong/sniffy/capture/mitmproxy"
+	"github.com/f-dong/sniffy/capture/openapi"
+	"github.com/f-dong/sniffy/capture/pcapng"
+	"github.com/f-dong/sniffy/capture/postman"
+	"github.com/f-dong/sniffy/capture/replay"
+	"github.com/f-dong/sniffy/capture/session"
+)
+
+// defaultLimit 列表接口默认返回的最大流数量
+const defaultLimit = 1000
+
+// Summary 流列表中的一行
+type Summary struct {
+	ID          string    `json:"id"`
+	StartTime   time.Time `json:"start_time"`
+	Duration    float64   `json:"duration_ms"`
+	ClientAddr  string    `json:"client_addr"`
+	Listener    string    `json:"listener,omitempty"`
+	Container   string    `json:"container,omitempty"`
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	Host        string    `json:"host"`
+	Status      int       `json:"status,omitempty"`
+	Size        int       `json:"size"`
+	Type        string    `json:"content_type,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Comment     string    `json:"comment,omitempty"`
+	Starred     bool      `json:"starred,omitempty"`
+	Marker      string    `json:"marker,omitempty"`
+	Violations  int       `json:"violations,omitempty"`
+	Credentials int       `json:"credentials,omitempty"`
+	Responder   string    `json:"responder,omitempty"`
+	ReplayOf    string    `json:"replay_of,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	ErrorCode   string    `json:"error_code,omitempty"`
+	TimedOut    string    `json:"timed_out,omitempty"`
+
+	// TraceID、CorrelationID 请求的W3C追踪ID和关联ID
+	TraceID       string `json:"trace_id,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// Annotation 对流的标签、备注、星标和标记的修改，nil 字段保持不变
+type Annotation struct {
+	// Tags 替换全部标签
+	Tags *[]string `json:"tags,omitempty"`
+
+	// AddTags 添加的标签
+	AddTags []string `json:"add_tags,omitempty"`
+
+	// RemoveTags 删除的标签
+	RemoveTags []string `json:"remove_tags,omitempty"`
+
+	// Comment 备注，空字符串清除备注
+	Comment *string `json:"comment,omitempty"`
+
+	// Starred 是否加星标
+	Starred *bool `json:"starred,omitempty"`
+
+	// Marker 标记颜色，取值见 flow.Markers，空字符串清除标记
+	Marker *string `json:"marker,omitempty"`
+}
+
+// apply 将修改写入流，标记颜色已经检查过
+func (a *Annotation) apply(f *flow.Flow) {
+	if a.Tags != nil {
+		f.Tags = nil
+		for _, tag := range *a.Tags {
+			f.Tag(tag)
+		}
+	}
+	for _, tag := range a.AddTags {
+		f.Tag(tag)
+	}
+	for _, tag := range a.RemoveTags {
+		f.Untag(tag)
+	}
+	if a.Comment != nil {
+		f.Comment = *a.Comment
+	}
+	if a.Starred != nil {
+		f.Starred = *a.Starred
+	}
+	if a.Marker != nil {
+		f.Marker = *a.Marker
+	}
+}
+
+// Compose 从头构造的新请求，经由代理发送并记录为新的流
+type Compose struct {
+	// Method 请求方法，默认为GET
+	Method string `json:"method,omitempty"`
+
+	// URL 完整的请求URL
+	URL string `json:"url"`
+
+	// Header 请求头部
+	Header http.Header `json:"header,omitempty"`
+
+	// Body 请求体（base64）
+	Body []byte `json:"body,omitempty"`
+
+	// ClientCert 上游要求双向TLS时出示的客户端证书，为nil时使用按主机配置的证书
+	ClientCert *ClientCert `json:"client_cert,omitempty"`
+}
+
+// ClientCert 请求携带的客户端证书，PEM格式的证书和私钥，或PKCS#12格式的证书
+type ClientCert struct {
+	// CertPEM PEM格式的证书链
+	CertPEM string `json:"cert_pem,omitempty"`
+
+	// KeyPEM PEM格式的私钥
+	KeyPEM string `json:"key_pem,omitempty"`
+
+	// PKCS12 PKCS#12格式的证书（base64）
+	PKCS12 []byte `json:"pkcs12,omitempty"`
+
+	// Password PKCS#12的密码
+	Password string `json:"password,omitempty"`
+}
+
+// load 解析客户端证书
+func (c *ClientCert) load() (tls.Certificate, error) {
+	if len(c.PKCS12) > 0 {
+		return dialer.ParsePKCS12(c.PKCS12, c.Password)
+	}
+	if c.CertPEM == "" || c.KeyPEM == "" {
+		return tls.Certificate{}, errors.New("client certificate requires cert_pem and key_pem, or pkcs12")
+	}
+	return tls.X509KeyPair([]byte(c.CertPEM), []byte(c.KeyPEM))
+}
+
+// Detail 流详情，Flow 之外附带解码后的请求体和响应体
+type Detail struct {
+	*flow.Flow
+
+	RequestBody  *Body `json:"request_body,omitempty"`
+	ResponseBody *Body `json:"response_body,omitempty"`
+}
+
+// Body 解码后的内容，文本内容放在 Text 中，二进制内容以base64放在 Base64 中
+type Body struct {
+	Text    string `json:"text,omitempty"`
+	Base64  []byte `json:"base64,omitempty"`
+	Size    int    `json:"size"`
+	Encoded bool   `json:"encoded,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	// Truncated 内容超过捕获限制，只包含开头部分，完整内容通过 body 接口获取
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// listFlows 返回满足过滤条件的流摘要，按捕获顺序排列
+func (s *Server) listFlows(w http.ResponseWriter, r *http.Request) {
+	flows, err := s.query(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit := defaultLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", s))
+			return
+		}
+	}
+	// 超过数量限制时保留最新的流
+	if len(flows) > limit {
+		flows = flows[len(flows)-limit:]
+	}
+	out := make([]*Summary, 0, len(flows))
+	for _, f := range flows {
+		out = append(out, summarize(f))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// getFlow 返回流详情
+func (s *Server) getFlow(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.store.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errNotFound("flow"))
+		return
+	}
+	detail := &Detail{Flow: f}
+	if f.Request != nil && len(f.Request.Body) > 0 {
+		detail.RequestBody = decodeBody(f.Request.Header, f.Request.Body)
+		detail.RequestBody.Truncated = f.Request.Truncated()
+	}
+	if f.Response != nil && len(f.Response.Body) > 0 {
+		detail.ResponseBody = decodeBody(f.Response.Header, f.Response.Body)
+		detail.ResponseBody.Truncated = f.Response.Truncated()
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// annotateFlow 修改流的标签、备注、星标和标记，返回修改后的流摘要
+func (s *Server) annotateFlow(w http.ResponseWriter, r *http.Request) {
+	var a Annotation
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid annotation: %w", err))
+		return
+	}
+	if a.Marker != nil {
+		if err := flow.CheckMarker(*a.Marker); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	f, ok := s.store.Update(r.PathValue("id"), a.apply)
+	if !ok {
+		writeError(w, http.StatusNotFound, errNotFound("flow"))
+		return
+	}
+	writeJSON(w, http.StatusOK, summarize(f))
+}
+
+// clearFlows 清空内存中的流，已写入持久化存储的流不受影响
+func (s *Server) clearFlows(w http.ResponseWriter, _ *http.Request) {
+	s.store.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storeStats 返回内存流存储的统计
+func (s *Server) storeStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.store.Stats())
+}
+
+// getBody 返回请求体或响应体，默认按 Content-Encoding 解码，raw 参数不为空时返回原始内容。
+// 超过捕获限制的内容保存在临时文件中时返回完整内容，否则只有捕获的开头部分
+func (s *Server) getBody(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.store.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errNotFound("flow"))
+		return
+	}
+	var header http.Header
+	var open func() (io.ReadCloser, error)
+	var size int64
+	spilled := false
+	switch part := r.PathValue("part"); {
+	case part == "request" && f.Request != nil:
+		header, open, size = f.Request.Header, f.Request.OpenBody, int64(len(f.Request.Body))
+		if spilled = f.Request.BodyFile != ""; spilled {
+			size = f.Request.BodyLen()
+		}
+	case part == "response" && f.Response != nil:
+		header, open, size = f.Response.Header, f.Response.OpenBody, int64(len(f.Response.Body))
+		if spilled = f.Response.BodyFile != ""; spilled {
+			size = f.Response.BodyLen()
+		}
+	case part == "request" || part == "response":
+		writeError(w, http.StatusNotFound, errNotFound(part))
+		return
+	default:
+		writeError(w, http.StatusNotFound, errNotFound("endpoint"))
+		return
+	}
+
+	body, err := open()
+	if err != nil {
+		writeError(w, http.StatusGone, fmt.Errorf("open body: %w", err))
+		return
+	}
+	defer body.Close()
+	var reader io.Reader = body
+	if r.URL.Query().Get("raw") == "" {
+		decoded, encoded, err := flow.DecodeReader(header, body)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		defer decoded.Close()
+		if encoded {
+			header = header.Clone()
+			header.Del("Content-Encoding")
+			// 临时文件中的内容边读边解码，长度未知；内存中的内容先解码，出错时返回422
+			reader, size = decoded, -1
+			if !spilled {
+				buf, err := io.ReadAll(decoded)
+				if err != nil {
+					writeError(w, http.StatusUnprocessableEntity, fmt.Errorf("decode body: %w", err))
+					return
+				}
+				reader, size = bytes.NewReader(buf), int64(len(buf))
+			}
+		}
+	} else if encoding := header.Get("Content-Encoding"); encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	if size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	io.Copy(w, reader)
+}
+
+// replayFlow 重放流，请求体中的 replay.Options 用于编辑后重放
+func (s *Server) replayFlow(w http.ResponseWriter, r *http.Request) {
+	if s.replayer == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("replay is not available"))
+		return
+	}
+	f, ok := s.store.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errNotFound("flow"))
+		return
+	}
+	var opts replay.Options
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &opts); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid replay options: %w", err))
+			return
+		}
+	}
+	result, err := s.replayer.Replay(r.Context(), f, &opts)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// sendCurl 解析请求体中的 curl 命令并经由代理发送，请求和响应记录为新的流
+func (s *Server) sendCurl(w http.ResponseWriter, r *http.Request) {
+	if s.replayer == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("replay is not available"))
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	req, err := curl.Parse(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid curl command: %w", err))
+		return
+	}
+	result, err := s.replayer.Send(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// compose 经由代理发送请求体中 Compose 描述的新请求，请求经过规则、断点等完整处理流程
+func (s *Server) compose(w http.ResponseWriter, r *http.Request) {
+	if s.replayer == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("replay is not available"))
+		return
+	}
+	var c Compose
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	if c.URL == "" {
+		writeError(w, http.StatusBadRequest, errors.New("url is required"))
+		return
+	}
+
+	opts := &replay.Options{}
+	if c.ClientCert != nil {
+		if s.dialer == nil {
+			writeError(w, http.StatusNotImplemented, errors.New("client certificates are not available"))
+			return
+		}
+		cert, err := c.ClientCert.load()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid client certificate: %w", err))
+			return
+		}
+		if opts.ClientCert, err = s.dialer.RegisterCertificate(cert); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid client certificate: %w", err))
+			return
+		}
+	}
+
+	req := &flow.Request{
+		Method: cmp.Or(strings.ToUpper(c.Method), http.MethodGet),
+		URL:    c.URL,
+		Header: c.Header,
+		Body:   c.Body,
+	}
+	result, err := s.replayer.Replay(r.Context(), &flow.Flow{Request: req}, opts)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// curlFlow 以 curl 命令的形式返回请求，insecure 不为空时添加 --insecure，proxy 指定经由的代理
+func (s *Server) curlFlow(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.store.Get(r.PathValue("id"))
+	if !ok || f.Request == nil {
+		writeError(w, http.StatusNotFound, errNotFound("flow"))
+		return
+	}
+	q := r.URL.Query()
+	cmd := f.ToCurl(flow.CurlOptions{Insecure: q.Get("insecure") != "", Proxy: q.Get("proxy")})
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, cmd+"\n")
+}
+
+// codeFlow 以 lang 指定语言的代码返回请求
+func (s *Server) codeFlow(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.store.Get(r.PathValue("id"))
+	if !ok || f.Request == nil {
+		writeError(w, http.StatusNotFound, errNotFound("flow"))
+		return
+	}
+	q := r.URL.Query()
+	code, err := codegen.Generate(q.Get("lang"), f, codegen.Options{Insecure: q.Get("insecure") != "", Proxy: q.Get("proxy")})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, code)
+}
+
+// export 将满足过滤条件的流导出为HAR、pcapng、会话文件、OpenAPI 文档、Postman 集合或CSV摘要
+func (s *Server) export(w http.ResponseWriter, r *http.Request) {
+	flows, err := s.query(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var buf bytes.Buffer
+	var contentType, ext string
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "har":
+		err = har.Write(&buf, flows)
+		contentType, ext = "application/json", "har"
+	case "csv":
+		var columns []string
+		if v := r.URL.Query().Get("columns"); v != "" {
+			columns = strings.Split(v, ",")
+		}
+		if err := flowcsv.Write(&buf, flows, columns); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		contentType, ext = "text/csv; charset=utf-8", "csv"
+	case "pcapng":
+		err = pcapng.Write(&buf, flows)
+		contentType, ext = "application/octet-stream", "pcapng"
+	case "session":
+		err = session.Save(&buf, &session.Session{Header: session.Header{Config: s.config}, Flows: flows})
+		contentType, ext = "application/gzip", "sniffy"
+	case "openapi":
+		doc := openapi.Generate(flows, openapi.Options{Title: r.URL.Query().Get("title")})
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(doc)
+		contentType, ext = "application/json", "openapi.json"
+	case "postman", "postman-environment":
+		c := postman.Export(flows, postman.Options{Name: r.URL.Query().Get("title")})
+		var v any = c
+		contentType, ext = "application/json", "postman_collection.json"
+		if format == "postman-environment" {
+			v, ext = c.SplitEnvironment(), "postman_environment.json"
+		}
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(v)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported export format %q", format))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="sniffy-%s.%s"`, time.Now().Format("20060102-150405"), ext))
+	w.Write(buf.Bytes())
+}
+
+// importFlows 将请求体中的流加入内存存储，ID已存在的流被忽略
+func (s *Server) importFlows(w http.ResponseWriter, r *http.Request) {
+	var flows []*flow.Flow
+	var err error
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "session":
+		flows, err = session.Read(r.Body)
+	case "har":
+		flows, err = har.Read(r.Body)
+	case "mitmproxy":
+		flows, err = mitmproxy.Read(r.Body)
+	case "charles":
+		flows, err = charles.Read(r.Body)
+	case "fiddler":
+		flows, err = fiddler.Read(r.Body)
+	case "curl":
+		flows, err = curl.Read(r.Body)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported import format %q", format))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, f := range flows {
+		s.store.Add(f)
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"imported": len(flows)})
+}
+
+// query 按 filter 和 after 参数筛选流
+func (s *Server) query(params url.Values) ([]*flow.Flow, error) {
+	flows := s.store.List()
+	if after := params.Get("after"); after != "" {
+		// after 对应的流已被丢弃时返回全部流
+		for i, f := range flows {
+			if f.ID == after {
+				flows = flows[i+1:]
+				break
+			}
+		}
+	}
+	expr := params.Get("filter")
+	if expr == "" {
+		return flows, nil
+	}
+	fl, err := filter.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	out := flows[:0:0]
+	for _, f := range flows {
+		if fl.Match(f) {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// containerName 返回发起流的容器名称，不是来自容器的流返回空
+func containerName(f *flow.Flow) string {
+	if f.Container == nil {
+		return ""
+	}
+	return f.Container.Name
+}
+
+// summarize 返回流摘要
+func summarize(f *flow.Flow) *Summary {
+	s := &Summary{
+		ID:          f.ID,
+		StartTime:   f.StartTime,
+		Duration:    float64(f.Duration()) / float64(time.Millisecond),
+		ClientAddr:  f.ClientAddr,
+		Listener:    f.Listener,
+		Container:   containerName(f),
+		Tags:        f.Tags,
+		Comment:     f.Comment,
+		Starred:     f.Starred,
+		Marker:      f.Marker,
+		Violations:  len(f.Violations),
+		Credentials: len(f.Credentials),
+		Responder:   f.Responder,
+		ReplayOf:    f.ReplayOf,
+		Error:       f.Error,
+		ErrorCode:   string(f.ErrorCode),
+		TimedOut:    f.TimedOut,
+	}
+	s.TraceID, s.CorrelationID = f.TraceID, f.CorrelationID
+	if f.Request != nil {
+		s.Method = f.Request.Method
+		s.URL = f.Request.URL
+		s.Host = f.Request.Host
+	}
+	if f.Response != nil {
+		s.Status = f.Response.StatusCode
+		s.Size = int(f.Response.BodyLen())
+		s.Type = f.Response.Header.Get("Content-Type")
+	}
+	return s
+}
+
+// decodeBody 按 Content-Encoding 解码内容，无法解码时返回原始内容和错误信息
+func decodeBody(header http.Header, body []byte) *Body {
+	out := &Body{}
+	decoded, encoded, err := flow.DecodeBody(header, body)
+	if err != nil {
+		out.Error = err.Error()
+		decoded = body
+	}
+	out.Size = len(decoded)
+	out.Encoded = encoded
+	if utf8.Valid(decoded) && !bytes.ContainsRune(decoded, 0) {
+		out.Text = string(decoded)
+	} else {
+		out.Base64 = decoded
+	}
+	return out
+}
@@ -0,0 +1,597 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/cachereport"
+	"github.com/f-dong/sniffy/capture/cookies"
+	"github.com/f-dong/sniffy/capture/dialer"
+	"github.com/f-dong/sniffy/capture/diff"
+	"github.com/f-dong/sniffy/capture/duplicates"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/replay"
+	"github.com/f-dong/sniffy/capture/secheaders"
+	"github.com/f-dong/sniffy/capture/session"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+	"github.com/f-dong/sniffy/capture/tlsreport"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func newCertificate(t *testing.T) (certPEM, keyPEM string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	return certPEM, keyPEM
+}
+
+func newFlow(id, rawURL string, status int, body []byte, header http.Header) *flow.Flow {
+	f := flow.New()
+	f.ID = id
+	f.Request = &flow.Request{Method: "GET", URL: rawURL, Host: strings.Split(strings.TrimPrefix(rawURL, "https://"), "/")[0], Header: http.Header{}}
+	f.Response = &flow.Response{StatusCode: status, Status: http.StatusText(status), Header: header, Body: body}
+	return f
+}
+
+func newServer() *Server {
+	store := flow.NewStore()
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(`{"ok":true}`))
+	w.Close()
+	store.Add(newFlow("a", "https://api.example.com/users", 200, gz.Bytes(), http.Header{
+		"Content-Type":     {"application/json"},
+		"Content-Encoding": {"gzip"},
+	}))
+	store.Add(newFlow("b", "https://cdn.example.com/logo.png", 404, []byte{0x89, 'P', 'N', 'G', 0}, http.Header{"Content-Type": {"image/png"}}))
+	store.Add(newFlow("c", "https://api.example.com/items", 500, nil, http.Header{}))
+	return New(store)
+}
+
+func get(t *testing.T, h http.Handler, target string, v any) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Host = "127.0.0.1:8081"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if v != nil {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), rec.Body.String())
+	}
+	return rec
+}
+
+func ids(summaries []*Summary) []string {
+	var out []string
+	for _, s := range summaries {
+		out = append(out, s.ID)
+	}
+	return out
+}
+
+// --- 测试代码 ---
+func TestServer_ListFlows(t *testing.T) {
+	d := newServer()
+
+	var all []*Summary
+	require.Equal(t, http.StatusOK, get(t, d, "/api/v1/flows", &all).Code)
+	require.Equal(t, []string{"a", "b", "c"}, ids(all))
+	require.Equal(t, "api.example.com", all[0].Host)
+	require.Equal(t, 200, all[0].Status)
+	require.Equal(t, "application/json", all[0].Type)
+
+	var newer []*Summary
+	get(t, d, "/api/v1/flows?after=a", &newer)
+	require.Equal(t, []string{"b", "c"}, ids(newer))
+
+	var filtered []*Summary
+	get(t, d, "/api/v1/flows?filter="+url.QueryEscape("host == api.example.com && status >= 400"), &filtered)
+	require.Equal(t, []string{"c"}, ids(filtered))
+
+	var limited []*Summary
+	get(t, d, "/api/v1/flows?limit=2", &limited)
+	require.Equal(t, []string{"b", "c"}, ids(limited))
+
+	var errResp map[string]string
+	require.Equal(t, http.StatusBadRequest, get(t, d, "/api/v1/flows?filter=status+>>", &errResp).Code)
+	require.NotEmpty(t, errResp["error"])
+	require.Equal(t, http.StatusBadRequest, get(t, d, "/api/v1/flows?limit=x", nil).Code)
+}
+
+func TestServer_GetFlow(t *testing.T) {
+	d := newServer()
+
+	type detail struct {
+		ID           string `json:"id"`
+		ResponseBody *Body  `json:"response_body"`
+	}
+	var text detail
+	require.Equal(t, http.StatusOK, get(t, d, "/api/v1/flows/a", &text).Code)
+	require.Equal(t, "a", text.ID)
+	require.Equal(t, `{"ok":true}`, text.ResponseBody.Text)
+	require.True(t, text.ResponseBody.Encoded)
+
+	var binary detail
+	get(t, d, "/api/v1/flows/b", &binary)
+	require.Empty(t, binary.ResponseBody.Text)
+	require.Equal(t, []byte{0x89, 'P', 'N', 'G', 0}, binary.ResponseBody.Base64)
+
+	require.Equal(t, http.StatusNotFound, get(t, d, "/api/v1/flows/missing", nil).Code)
+}
+
+func TestServer_GetBody(t *testing.T) {
+	d := newServer()
+
+	rec := get(t, d, "/api/v1/flows/a/response/body", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, `{"ok":true}`, rec.Body.String())
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	require.Empty(t, rec.Header().Get("Content-Encoding"))
+
+	rec = get(t, d, "/api/v1/flows/a/response/body?raw=1", nil)
+	require.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	require.NotEqual(t, `{"ok":true}`, rec.Body.String())
+
+	rec = get(t, d, "/api/v1/flows/b/request/body", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+	require.Empty(t, rec.Body.Bytes())
+
+	require.Equal(t, http.StatusNotFound, get(t, d, "/api/v1/flows/a/trailer/body", nil).Code)
+	require.Equal(t, http.StatusNotFound, get(t, d, "/api/v1/flows/missing/request/body", nil).Code)
+}
+
+func TestServer_ClearFlows(t *testing.T) {
+	d := newServer()
+	require.Equal(t, http.StatusNoContent, do(t, d, http.MethodDelete, "/api/v1/flows", "", nil).Code)
+
+	var all []*Summary
+	get(t, d, "/api/v1/flows", &all)
+	require.Empty(t, all)
+
+	var errResp map[string]string
+	require.Equal(t, http.StatusNotFound, get(t, d, "/api/v1/unknown", &errResp).Code)
+	require.Equal(t, "endpoint not found", errResp["error"])
+}
+
+func TestServer_StoreStats(t *testing.T) {
+	d := newServer()
+	var st flow.StoreStats
+	require.Equal(t, http.StatusOK, get(t, d, "/api/v1/flows/stats", &st).Code)
+	require.Equal(t, 3, st.Flows)
+	require.Positive(t, st.Bytes)
+	require.Zero(t, st.Evicted)
+}
+
+func TestServer_Replay(t *testing.T) {
+	d := newServer()
+	require.Equal(t, http.StatusNotImplemented, do(t, d, http.MethodPost, "/api/v1/flows/a/replay", "", nil).Code)
+
+	var got *http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		io.WriteString(w, "replayed")
+	}))
+	defer proxy.Close()
+	r, err := replay.New(strings.TrimPrefix(proxy.URL, "http://"), nil)
+	require.NoError(t, err)
+	d.SetReplayer(r)
+
+	// 编辑后重放
+	rec := do(t, d, http.MethodPost, "/api/v1/flows/a/replay", `{"method":"POST","url":"http://api.example.com/v2"}`, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var result replay.Result
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	require.NotEmpty(t, result.FlowID)
+	require.Equal(t, "replayed", string(result.Response.Body))
+	require.Equal(t, "POST", got.Method)
+	require.Equal(t, "http://api.example.com/v2", got.URL.String())
+
+	require.Equal(t, http.StatusBadRequest, do(t, d, http.MethodPost, "/api/v1/flows/a/replay", `{`, nil).Code)
+}
+
+func TestServer_SendCurl(t *testing.T) {
+	d := newServer()
+	require.Equal(t, http.StatusNotImplemented, do(t, d, http.MethodPost, "/api/v1/curl", "curl https://example.com/", nil).Code)
+
+	var got *http.Request
+	var body string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		io.WriteString(w, "sent")
+	}))
+	defer proxy.Close()
+	r, err := replay.New(strings.TrimPrefix(proxy.URL, "http://"), nil)
+	require.NoError(t, err)
+	d.SetReplayer(r)
+
+	var result replay.Result
+	rec := do(t, d, http.MethodPost, "/api/v1/curl", "curl 'http://api.example.com/items' \\\n  -H 'X-Token: t' \\\n  --data-raw 'a=1'", &result)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, "sent", string(result.Response.Body))
+	require.Equal(t, "POST", got.Method)
+	require.Equal(t, "http://api.example.com/items", got.URL.String())
+	require.Equal(t, "t", got.Header.Get("X-Token"))
+	require.Equal(t, "a=1", body)
+
+	require.Equal(t, http.StatusBadRequest, do(t, d, http.MethodPost, "/api/v1/curl", "wget http://example.com/", nil).Code)
+}
+
+func TestServer_Compose(t *testing.T) {
+	d := newServer()
+	require.Equal(t, http.StatusNotImplemented, do(t, d, http.MethodPost, "/api/v1/compose", `{"url":"http://example.com/"}`, nil).Code)
+
+	var got *http.Request
+	var body string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		io.WriteString(w, "composed")
+	}))
+	defer proxy.Close()
+	r, err := replay.New(strings.TrimPrefix(proxy.URL, "http://"), nil)
+	require.NoError(t, err)
+	d.SetReplayer(r)
+
+	var result replay.Result
+	rec := do(t, d, http.MethodPost, "/api/v1/compose", `{"method":"put","url":"http://api.example.com/items/1","header":{"X-Token":["t"]},"body":"eyJhIjoxfQ=="}`, &result)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, "composed", string(result.Response.Body))
+	require.Equal(t, "PUT", got.Method)
+	require.Equal(t, "http://api.example.com/items/1", got.URL.String())
+	require.Equal(t, "t", got.Header.Get("X-Token"))
+	require.Empty(t, got.Header.Get(flow.ClientCertHeader))
+	require.Equal(t, `{"a":1}`, body)
+
+	// 客户端证书登记到拨号器，代理据此在上游连接上出示
+	certPEM, keyPEM := newCertificate(t)
+	c, err := json.Marshal(Compose{URL: "http://api.example.com/", ClientCert: &ClientCert{CertPEM: certPEM, KeyPEM: keyPEM}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotImplemented, do(t, d, http.MethodPost, "/api/v1/compose", string(c), nil).Code)
+	upstream := dialer.New()
+	d.SetDialer(upstream)
+	rec = do(t, d, http.MethodPost, "/api/v1/compose", string(c), &result)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, "GET", got.Method)
+	id := got.Header.Get(flow.ClientCertHeader)
+	require.NotNil(t, upstream.RegisteredCertificate(id))
+	again, err := upstream.RegisterCertificate(*upstream.RegisteredCertificate(id))
+	require.NoError(t, err)
+	require.Equal(t, id, again)
+
+	require.Equal(t, http.StatusBadRequest, do(t, d, http.MethodPost, "/api/v1/compose", `{"method":"GET"}`, nil).Code)
+	require.Equal(t, http.StatusBadRequest, do(t, d, http.MethodPost, "/api/v1/compose", `{"url":"http://a/","client_cert":{"cert_pem":"x"}}`, nil).Code)
+}
+
+func TestServer_Cookies(t *testing.T) {
+	s := newServer()
+	login := newFlow("d", "https://api.example.com/login", 200, nil, http.Header{"Set-Cookie": {"session=s1; HttpOnly"}})
+	login.ClientAddr = "10.0.0.1:5000"
+	me := newFlow("e", "https://api.example.com/me", 200, nil, http.Header{})
+	me.ClientAddr = "10.0.0.1:5001"
+	me.Request.Header.Set("Cookie", "session=s1")
+	s.store.Add(login)
+	s.store.Add(me)
+
+	var timelines []*cookies.Timeline
+	require.Equal(t, http.StatusOK, get(t, s, "/api/v1/cookies?client=10.0.0.1", &timelines).Code)
+	require.Len(t, timelines, 1)
+	require.Len(t, timelines[0].Events, 1)
+	require.Equal(t, cookies.ActionSet, timelines[0].Events[0].Action)
+
+	var sessions []*cookies.Session
+	require.Equal(t, http.StatusOK, get(t, s, "/api/v1/sessions", &sessions).Code)
+	require.Len(t, sessions, 1)
+	require.Equal(t, []string{"d", "e"}, sessions[0].Flows)
+
+	require.Equal(t, http.StatusOK, get(t, s, "/api/v1/sessions?cookie=other", &sessions).Code)
+	require.Empty(t, sessions)
+	require.Equal(t, http.StatusBadRequest, get(t, s, "/api/v1/cookies?filter=(", nil).Code)
+}
+
+func TestServer_SecurityHeaders(t *testing.T) {
+	s := newServer()
+	var report secheaders.Report
+	require.Equal(t, http.StatusOK, get(t, s, "/api/v1/security-headers?filter=host+==+api.example.com", &report).Code)
+	require.Len(t, report.Hosts, 1)
+	require.Equal(t, "api.example.com", report.Hosts[0].Host)
+	require.Equal(t, 2, report.Hosts[0].Responses)
+	require.Equal(t, secheaders.CheckHSTS, report.Hosts[0].Findings[0].Check)
+
+	rec := get(t, s, "/api/v1/security-headers?format=html", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Body.String(), "<h2>cdn.example.com</h2>")
+	require.Equal(t, http.StatusBadRequest, get(t, s, "/api/v1/security-headers?format=pdf", nil).Code)
+}
+
+func TestServer_TLSReport(t *testing.T) {
+	s := newServer()
+	f, _ := s.store.Get("a")
+	f.UpstreamTLS = &tlsinfo.UpstreamTLS{Version: tls.VersionTLS11, CipherSuite: tls.TLS_AES_128_GCM_SHA256, Verified: true}
+
+	var report tlsreport.Report
+	require.Equal(t, http.StatusOK, get(t, s, "/api/v1/tls/report", &report).Code)
+	require.Len(t, report.Origins, 1)
+	require.Equal(t, "api.example.com:443", report.Origins[0].Origin)
+	require.Equal(t, 1, report.Weak)
+	require.Equal(t, http.StatusBadRequest, get(t, s, "/api/v1/tls/report?filter=(", nil).Code)
+}
+
+func TestServer_CacheReport(t *testing.T) {
+	s := newServer()
+	s.store.Add(newFlow("d", "https://cdn.example.com/logo.png", 200, []byte("PNG"), http.Header{"Etag": {`"1"`}}))
+	s.store.Add(newFlow("e", "https://cdn.example.com/logo.png", 200, []byte("PNG"), http.Header{"Etag": {`"1"`}}))
+
+	var report cachereport.Report
+	require.Equal(t, http.StatusOK, get(t, s, "/api/v1/cache", &report).Code)
+	require.Len(t, report.Resources, 1)
+	require.Equal(t, "https://cdn.example.com/logo.png", report.Resources[0].URL)
+	require.Equal(t, 1, report.Resources[0].Redownloaded)
+	require.Equal(t, int64(3), report.WastedBytes)
+
+	require.Equal(t, http.StatusOK, get(t, s, "/api/v1/cache?filter=status+==+200", &report).Code)
+	require.Equal(t, 2, report.Requests)
+	require.Equal(t, http.StatusBadRequest, get(t, s, "/api/v1/cache?filter=(", nil).Code)
+}
+
+func TestServer_Duplicates(t *testing.T) {
+	s := newServer()
+	s.store.Add(newFlow("d", "https://api.example.com/users?_=1", 200, nil, http.Header{}))
+
+	var report duplicates.Report
+	require.Equal(t, http.StatusOK, get(t, s, "/api/v1/duplicates", &report).Code)
+	require.Equal(t, 4, report.Requests)
+	require.Empty(t, report.Groups)
+
+	require.Equal(t, http.StatusOK, get(t, s, "/api/v1/duplicates?window=1m&ignore=_,t&filter=host+==+api.example.com", &report).Code)
+	require.Equal(t, "1m0s", report.Window)
+	require.Len(t, report.Groups, 1)
+	require.Equal(t, []string{"a", "d"}, report.Groups[0].Flows)
+
+	require.Equal(t, http.StatusBadRequest, get(t, s, "/api/v1/duplicates?window=soon", nil).Code)
+	require.Equal(t, http.StatusBadRequest, get(t, s, "/api/v1/duplicates?filter=(", nil).Code)
+}
+
+func TestServer_Traces(t *testing.T) {
+	s := newServer()
+	a, _ := s.store.Get("a")
+	a.TraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	c, _ := s.store.Get("c")
+	c.TraceID, c.CorrelationID = "4bf92f3577b34da6a3ce929d0e0e4736", "req-42"
+
+	var list []*Summary
+	require.Equal(t, http.StatusOK, get(t, s, "/api/v1/traces/4bf92f3577b34da6a3ce929d0e0e4736", &list).Code)
+	require.Equal(t, []string{"a", "c"}, ids(list))
+	require.Equal(t, "req-42", list[1].CorrelationID)
+	require.Equal(t, http.StatusOK, get(t, s, "/api/v1/traces/req-42", &list).Code)
+	require.Equal(t, []string{"c"}, ids(list))
+	require.Equal(t, http.StatusNotFound, get(t, s, "/api/v1/traces/missing", nil).Code)
+}
+
+func TestServer_Annotate(t *testing.T) {
+	d := newServer()
+	old, _ := d.store.Get("a")
+	var updated []*flow.Flow
+	d.store.OnUpdate(func(f *flow.Flow) { updated = append(updated, f) })
+
+	var sum Summary
+	rec := do(t, d, http.MethodPatch, "/api/v1/flows/a", `{"add_tags":["checkout","slow"],"comment":"retried","starred":true,"marker":"red"}`, &sum)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, []string{"checkout", "slow"}, sum.Tags)
+	require.Equal(t, "retried", sum.Comment)
+	require.True(t, sum.Starred)
+	require.Equal(t, "red", sum.Marker)
+	require.Len(t, updated, 1)
+
+	// 已经取得的流不受影响
+	require.Empty(t, old.Tags)
+	require.False(t, old.Starred)
+
+	sum = Summary{}
+	rec = do(t, d, http.MethodPatch, "/api/v1/flows/a", `{"remove_tags":["slow"],"starred":false,"marker":""}`, &sum)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, []string{"checkout"}, sum.Tags)
+	require.Equal(t, "retried", sum.Comment)
+	require.False(t, sum.Starred)
+	require.Empty(t, sum.Marker)
+
+	var list []*Summary
+	get(t, d, "/api/v1/flows?filter="+url.QueryEscape("tag == checkout"), &list)
+	require.Len(t, list, 1)
+	require.Equal(t, "a", list[0].ID)
+
+	sum = Summary{}
+	do(t, d, http.MethodPatch, "/api/v1/flows/a", `{"tags":[]}`, &sum)
+	require.Empty(t, sum.Tags)
+
+	require.Equal(t, http.StatusBadRequest, do(t, d, http.MethodPatch, "/api/v1/flows/a", `{"marker":"pink"}`, nil).Code)
+	require.Equal(t, http.StatusNotFound, do(t, d, http.MethodPatch, "/api/v1/flows/missing", `{"starred":true}`, nil).Code)
+}
+
+func TestServer_Diff(t *testing.T) {
+	d := newServer()
+	var result diff.Result
+	rec := get(t, d, "/api/v1/diff?a=a&b=c", &result)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "a", result.A)
+	require.Equal(t, "url", result.Request.Fields[0].Path)
+	require.Equal(t, "status", result.Response.Fields[0].Path)
+	require.Equal(t, "removed", string(result.Response.Header[0].Kind))
+
+	rec = get(t, d, "/api/v1/diff?a=a&b=c&response_only=1&ignore_headers=content-type,content-encoding&text=1", nil)
+	require.Equal(t, "--- a\n+++ c\nresponse status: 200 -> 500\nresponse body:\n  - {\"ok\":true}\n", rec.Body.String())
+	require.Equal(t, http.StatusNotFound, get(t, d, "/api/v1/diff?a=a&b=missing", nil).Code)
+}
+
+func TestServer_Compare(t *testing.T) {
+	d := newServer()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Host == "staging.test" {
+			io.WriteString(w, `{"users":[],"version":"2"}`)
+			return
+		}
+		io.WriteString(w, `{"users":[],"version":"1"}`)
+	}))
+	defer proxy.Close()
+	r, err := replay.New(strings.TrimPrefix(proxy.URL, "http://"), nil)
+	require.NoError(t, err)
+	d.SetReplayer(r)
+
+	var result CompareResult
+	rec := do(t, d, http.MethodPost, "/api/v1/flows/a/compare", `{"a":"http://staging.test","b":"http://prod.test/"}`, &result)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NotEqual(t, result.A.FlowID, result.B.FlowID)
+	require.Nil(t, result.Diff.Request)
+	require.Equal(t, []*diff.Change{{Kind: diff.Changed, Path: "$.version", A: "2", B: "1"}}, result.Diff.Response.Body.Changes)
+
+	var same CompareResult
+	rec = do(t, d, http.MethodPost, "/api/v1/flows/a/compare", `{"a":"http://staging.test","b":"http://prod.test/","ignore_paths":["$.version"]}`, &same)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.True(t, same.Diff.Equal())
+
+	require.Equal(t, http.StatusBadRequest, do(t, d, http.MethodPost, "/api/v1/flows/a/compare", `{"a":"staging.test","b":"http://prod.test"}`, nil).Code)
+	require.Equal(t, http.StatusNotFound, do(t, d, http.MethodPost, "/api/v1/flows/missing/compare", `{}`, nil).Code)
+}
+
+func TestServer_Curl(t *testing.T) {
+	d := newServer()
+	rec := get(t, d, "/api/v1/flows/a/curl?insecure=1&proxy=http://127.0.0.1:8080", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Equal(t, "curl \\\n  --insecure \\\n  --proxy http://127.0.0.1:8080 \\\n  https://api.example.com/users\n", rec.Body.String())
+
+	require.Equal(t, http.StatusNotFound, get(t, d, "/api/v1/flows/missing/curl", nil).Code)
+
+	rec = get(t, d, "/api/v1/flows/a/code?lang=python", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `response = requests.request("GET", url)`)
+	rec = get(t, d, "/api/v1/flows/a/code?lang=go&insecure=1", nil)
+	require.Contains(t, rec.Body.String(), "InsecureSkipVerify: true")
+	require.Equal(t, http.StatusBadRequest, get(t, d, "/api/v1/flows/a/code?lang=cobol", nil).Code)
+}
+
+func TestServer_Export(t *testing.T) {
+	d := newServer()
+
+	rec := get(t, d, "/api/v1/export?filter=status+>=+400", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Disposition"), ".har")
+	var doc struct {
+		Log struct {
+			Entries []json.RawMessage `json:"entries"`
+		} `json:"log"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	require.Len(t, doc.Log.Entries, 2)
+
+	rec = get(t, d, "/api/v1/export?format=pcapng", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Disposition"), ".pcapng")
+	require.NotEmpty(t, rec.Body.Bytes())
+
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Info    struct{ Title string }     `json:"info"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	rec = get(t, d, "/api/v1/export?format=openapi&title=Example&filter=host+contains+api", &spec)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Disposition"), ".openapi.json")
+	require.Equal(t, "Example", spec.Info.Title)
+	require.Len(t, spec.Paths, 2)
+
+	var collection struct {
+		Info struct{ Name, Schema string } `json:"info"`
+		Item []json.RawMessage             `json:"item"`
+	}
+	rec = get(t, d, "/api/v1/export?format=postman&title=Example", &collection)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Disposition"), ".postman_collection.json")
+	require.Equal(t, "Example", collection.Info.Name)
+	require.Contains(t, collection.Info.Schema, "v2.1.0")
+	require.NotEmpty(t, collection.Item)
+
+	var env struct {
+		Values []struct{ Key, Value string } `json:"values"`
+	}
+	rec = get(t, d, "/api/v1/export?format=postman-environment", &env)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Disposition"), ".postman_environment.json")
+	require.NotEmpty(t, env.Values)
+
+	rec = get(t, d, "/api/v1/export?format=csv&columns=id,status&filter=status+>=+400", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Disposition"), ".csv")
+	require.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Len(t, strings.Split(strings.TrimSpace(rec.Body.String()), "\n"), 3)
+	require.True(t, strings.HasPrefix(rec.Body.String(), "id,status\n"))
+	require.Equal(t, http.StatusBadRequest, get(t, d, "/api/v1/export?format=csv&columns=nope", nil).Code)
+
+	require.Equal(t, http.StatusBadRequest, get(t, d, "/api/v1/export?format=xml", nil).Code)
+}
+
+func TestServer_SessionExportImport(t *testing.T) {
+	d := newServer()
+	d.SetSessionConfig(json.RawMessage(`{"port":8080}`))
+
+	rec := get(t, d, "/api/v1/export?format=session&filter=host+==+api.example.com", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Disposition"), ".sniffy")
+	s, err := session.Load(bytes.NewReader(rec.Body.Bytes()))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"port":8080}`, string(s.Config))
+	require.Len(t, s.Flows, 2)
+
+	// 导入到新的存储，已存在的流被忽略
+	other := New(flow.NewStore())
+	var result map[string]int
+	require.Equal(t, http.StatusOK, do(t, other, http.MethodPost, "/api/v1/import", rec.Body.String(), &result).Code)
+	require.Equal(t, 2, result["imported"])
+	do(t, other, http.MethodPost, "/api/v1/import", rec.Body.String(), nil)
+	var all []*Summary
+	get(t, other, "/api/v1/flows", &all)
+	require.Equal(t, []string{"a", "c"}, ids(all))
+
+	require.Equal(t, http.StatusBadRequest, do(t, other, http.MethodPost, "/api/v1/import", "not a session", nil).Code)
+	require.Equal(t, http.StatusBadRequest, do(t, other, http.MethodPost, "/api/v1/import?format=xml", "", nil).Code)
+
+	require.Equal(t, http.StatusOK, do(t, other, http.MethodPost, "/api/v1/import?format=curl", "curl http://a/\ncurl http://b/", &result).Code)
+	require.Equal(t, 2, result["imported"])
+}
@@ -0,0 +1,115 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// SetAllowedHosts 设置除IP地址和 localhost 外允许出现在 Host 头部中的主机名，
+// 例如经由反向代理或DNS名访问控制端口时使用的名字
+func (s *Server) SetAllowedHosts(hosts []string) {
+	s.hosts = make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		s.hosts[strings.ToLower(h)] = true
+	}
+}
+
+// Protect 返回先检查 Origin 和 Host 再交给 h 处理的处理器，用于挂载在同一端口上的其他处理器，
+// 例如CDP桥接和 /debug/pprof
+func (s *Server) Protect(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.checkRequest(r); err != nil {
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// checkRequest 拒绝用户访问的网页发出的请求：其他站点的 Origin，
+// 以及DNS重绑定后带有外部域名的 Host
+func (s *Server) checkRequest(r *http.Request) error {
+	if err := checkOrigin(r); err != nil {
+		return err
+	}
+	return s.checkHost(r)
+}
+
+// checkOrigin 与 cdp 相同，只接受没有 Origin 的客户端、DevTools 前端和同源页面
+func checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+	switch {
+	case u.Scheme == "devtools" || u.Scheme == "chrome-devtools":
+	case (u.Scheme == "http" || u.Scheme == "https") && u.Host == r.Host:
+	default:
+		return fmt.Errorf("origin %q is not allowed", origin)
+	}
+	return nil
+}
+
+// checkHost 只接受IP地址、localhost 和 SetAllowedHosts 设置的主机名，
+// 防止外部域名重新解析到本机后，网页以同源的身份读取捕获的流量。unix 套接字上的请求不受限制
+func (s *Server) checkHost(r *http.Request) error {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+		return nil
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	if _, err := netip.ParseAddr(host); err == nil {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || s.hosts[host] {
+		return nil
+	}
+	return fmt.Errorf("host %q is not allowed", r.Host)
+}
+
+// requireContentType 要求修改状态的请求声明请求体类型。浏览器不允许网页跨站发送
+// application/json 等类型而不经过CORS预检，表单和简单请求因此无法调用接口。
+// want 为空时接受 text/plain、表单以外的任意类型，用于请求体不是JSON的接口
+func requireContentType(want string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch {
+		case err != nil:
+			err = fmt.Errorf("missing or invalid Content-Type, expected %s", expectedType(want))
+		case want == "" && (mediaType == "text/plain" || mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data"):
+			err = fmt.Errorf("unsupported Content-Type %q, expected %s", mediaType, expectedType(want))
+		case want != "" && mediaType != want:
+			err = fmt.Errorf("unsupported Content-Type %q, expected %s", mediaType, expectedType(want))
+		}
+		if err != nil {
+			writeError(w, http.StatusUnsupportedMediaType, err)
+			return
+		}
+		fn(w, r)
+	}
+}
+
+// expectedType 返回错误信息中期望的请求体类型
+func expectedType(want string) string {
+	if want == "" {
+		return "a type other than text/plain or form data"
+	}
+	return want
+}
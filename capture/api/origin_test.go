@@ -0,0 +1,115 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// send 以指定的 Host、Origin 和 Content-Type 发送请求，返回状态码
+func send(h http.Handler, method, host, target, origin, contentType, body string) int {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Host = host
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// --- 测试代码 ---
+
+func TestServer_Origin(t *testing.T) {
+	s := New(flow.NewStore())
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		{"", http.StatusOK},
+		{"http://127.0.0.1:8081", http.StatusOK},
+		{"devtools://devtools", http.StatusOK},
+		{"https://evil.example", http.StatusForbidden},
+		{"http://127.0.0.1:9999", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			require.Equal(t, tt.want, send(s, http.MethodGet, "127.0.0.1:8081", "/api/v1/flows", tt.origin, "", ""))
+		})
+	}
+}
+
+func TestServer_Host(t *testing.T) {
+	s := New(flow.NewStore())
+	s.SetAllowedHosts([]string{"Sniffy.Internal"})
+	tests := []struct {
+		host string
+		want int
+	}{
+		{"127.0.0.1:8081", http.StatusOK},
+		{"[::1]:8081", http.StatusOK},
+		{"192.0.2.10", http.StatusOK},
+		{"localhost:8081", http.StatusOK},
+		{"app.localhost", http.StatusOK},
+		{"sniffy.internal:8081", http.StatusOK},
+		// DNS重绑定后浏览器发送攻击者的域名
+		{"rebind.evil.example:8081", http.StatusForbidden},
+		{"localhost.evil.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			require.Equal(t, tt.want, send(s, http.MethodGet, tt.host, "/api/v1/flows", "", "", ""))
+		})
+	}
+
+	// unix 套接字上的请求不检查 Host
+	req := httptest.NewRequest(http.MethodGet, "http://sniffy/api/v1/flows", nil)
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.UnixAddr{Name: "/run/sniffy.sock", Net: "unix"}))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestServer_ContentType(t *testing.T) {
+	s := New(flow.NewStore())
+	s.SetBreakpoints(breakpoint.NewManager())
+	rule := `{"phase":"request","match":"api.example.com"}`
+	tests := []struct {
+		target      string
+		contentType string
+		want        int
+	}{
+		{"/api/v1/breakpoints", "", http.StatusUnsupportedMediaType},
+		{"/api/v1/breakpoints", "text/plain", http.StatusUnsupportedMediaType},
+		{"/api/v1/breakpoints", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"/api/v1/breakpoints", "application/json; charset=utf-8", http.StatusCreated},
+		// curl 命令不是JSON，接受表单和 text/plain 以外的类型
+		{"/api/v1/curl", "text/plain;charset=UTF-8", http.StatusUnsupportedMediaType},
+		{"/api/v1/curl", "multipart/form-data; boundary=x", http.StatusUnsupportedMediaType},
+		{"/api/v1/curl", "", http.StatusUnsupportedMediaType},
+		{"/api/v1/curl", "application/octet-stream", http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target+" "+tt.contentType, func(t *testing.T) {
+			require.Equal(t, tt.want, send(s, http.MethodPost, "127.0.0.1:8081", tt.target, "", tt.contentType, rule))
+		})
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/f-dong/sniffy/capture/secheaders"
+	"github.com/f-dong/sniffy/capture/tlsreport"
+)
+
+// securityHeaders 按主机检查满足过滤条件的流的安全头部，format=html 时返回HTML报告
+func (s *Server) securityHeaders(w http.ResponseWriter, r *http.Request) {
+	flows, err := s.query(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	report := secheaders.Analyze(flows)
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		writeJSON(w, http.StatusOK, report)
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		report.WriteHTML(w)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported report format %q", format))
+	}
+}
+
+// tlsReport 汇总满足过滤条件的流中每个源站的TLS会话
+func (s *Server) tlsReport(w http.ResponseWriter, r *http.Request) {
+	flows, err := s.query(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tlsreport.Analyze(flows))
+}
@@ -0,0 +1,28 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/f-dong/sniffy/capture/tracecontext"
+)
+
+// traceFlows 返回追踪ID或关联ID为 {id} 的流摘要，没有匹配的流时返回404
+func (s *Server) traceFlows(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var out []*Summary
+	for _, f := range s.store.List() {
+		if tracecontext.Matches(f, id) {
+			out = append(out, summarize(f))
+		}
+	}
+	if len(out) == 0 {
+		writeError(w, http.StatusNotFound, errNotFound("trace"))
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
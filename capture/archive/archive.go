@@ -0,0 +1,263 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+const (
+	// DefaultInterval 默认的轮转间隔
+	DefaultInterval = time.Hour
+
+	// Ext 轮转的会话文件的扩展名
+	Ext = ".sniffy"
+
+	// uploadedDir 上传后保留在本地的文件所在的子目录
+	uploadedDir = "uploaded"
+)
+
+// Options 归档配置
+type Options struct {
+	// URL 归档位置，格式为 s3://bucket/prefix
+	URL string
+
+	// Endpoint S3兼容存储的地址，例如 http://minio:9000，为空时使用 AWS S3
+	Endpoint string
+
+	// Region 签名使用的区域，为空时使用 us-east-1
+	Region string
+
+	// Credentials 访问凭证
+	Credentials Credentials
+
+	// Dir 保存轮转的会话文件的目录，上传失败的文件保留在这里，下次轮转时重试
+	Dir string
+
+	// Interval 轮转间隔，0 使用 DefaultInterval
+	Interval time.Duration
+
+	// Retention 存储中的会话文件保留的时间，超过后删除，0表示永久保留
+	Retention time.Duration
+
+	// KeepLocal 上传后本地文件保留的时间，0表示上传后立即删除
+	KeepLocal time.Duration
+
+	// Save 将流写入会话文件，由调用方按配置加密
+	Save func(path string, flows []*flow.Flow) error
+}
+
+// Archiver 定期将新完成的流轮转为会话文件并上传到S3兼容存储，同时按保留策略清理存储和本地文件
+type Archiver struct {
+	opts   Options
+	client *s3Client
+	prefix string
+
+	mu       sync.Mutex
+	pending  []*flow.Flow
+	rotateMu sync.Mutex
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New 创建归档器并启动定期轮转
+func New(opts Options) (*Archiver, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid archive URL %q (expected s3://bucket/prefix)", opts.URL)
+	}
+	if opts.Save == nil {
+		return nil, errors.New("archive requires a session writer")
+	}
+	if opts.Dir == "" {
+		return nil, errors.New("archive requires a spool directory")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if err := os.MkdirAll(filepath.Join(opts.Dir, uploadedDir), 0o700); err != nil {
+		return nil, fmt.Errorf("create archive directory: %w", err)
+	}
+	client, err := newS3Client(opts.Endpoint, u.Host, opts.Region, opts.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimPrefix(u.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	a := &Archiver{opts: opts, client: client, prefix: prefix, done: make(chan struct{})}
+	a.wg.Add(1)
+	go a.run()
+	return a, nil
+}
+
+// Add 将流加入下一个会话文件，签名与 flow.Store.OnAdd 的回调一致
+func (a *Archiver) Add(f *flow.Flow) {
+	a.mu.Lock()
+	a.pending = append(a.pending, f)
+	a.mu.Unlock()
+}
+
+// Rotate 将新完成的流写入会话文件，上传目录中所有未上传的文件并执行保留策略
+func (a *Archiver) Rotate(ctx context.Context) error {
+	a.rotateMu.Lock()
+	defer a.rotateMu.Unlock()
+
+	a.mu.Lock()
+	flows := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+
+	var errs []error
+	if len(flows) > 0 {
+		if err := a.write(flows); err != nil {
+			// 写入失败的流放回，下次轮转时重试
+			a.mu.Lock()
+			a.pending = append(flows, a.pending...)
+			a.mu.Unlock()
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, a.upload(ctx), a.prune(ctx))
+	return errors.Join(errs...)
+}
+
+// write 将流写入以当前时间命名的会话文件，先写入临时文件再重命名，避免上传写了一半的文件
+func (a *Archiver) write(flows []*flow.Flow) error {
+	name := "sniffy-" + time.Now().UTC().Format("20060102T150405.000Z") + Ext
+	path := filepath.Join(a.opts.Dir, name)
+	tmp := path + ".tmp"
+	if err := a.opts.Save(tmp, flows); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// upload 按文件名顺序上传目录中的会话文件
+func (a *Archiver) upload(ctx context.Context) error {
+	names, err := sessionFiles(a.opts.Dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		path := filepath.Join(a.opts.Dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := a.client.put(ctx, a.prefix+name, data); err != nil {
+			return fmt.Errorf("upload %s: %w", name, err)
+		}
+		log.Printf("Archived %s to s3://%s/%s%s", name, a.client.bucket, a.prefix, name)
+		if a.opts.KeepLocal > 0 {
+			err = os.Rename(path, filepath.Join(a.opts.Dir, uploadedDir, name))
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune 删除超过保留时间的存储对象和本地文件
+func (a *Archiver) prune(ctx context.Context) error {
+	now := time.Now()
+	var errs []error
+	if a.opts.Retention > 0 {
+		objects, err := a.client.list(ctx, a.prefix)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, obj := range objects {
+			// 只删除归档器在前缀下直接写入的会话文件
+			name := strings.TrimPrefix(obj.Key, a.prefix)
+			if !strings.HasPrefix(name, "sniffy-") || !strings.HasSuffix(name, Ext) || strings.Contains(name, "/") ||
+				now.Sub(obj.LastModified) < a.opts.Retention {
+				continue
+			}
+			if err := a.client.delete(ctx, obj.Key); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			log.Printf("Deleted archived session s3://%s/%s past retention", a.client.bucket, obj.Key)
+		}
+	}
+
+	dir := filepath.Join(a.opts.Dir, uploadedDir)
+	names, err := sessionFiles(dir)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err == nil && now.Sub(info.ModTime()) >= a.opts.KeepLocal {
+			err = os.Remove(filepath.Join(dir, name))
+		}
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sessionFiles 返回目录中的会话文件名，按名称即时间排序
+func sessionFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), Ext) {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Close 停止定期轮转，将剩余的流轮转并上传
+func (a *Archiver) Close(ctx context.Context) error {
+	close(a.done)
+	a.wg.Wait()
+	return a.Rotate(ctx)
+}
+
+// run 定期轮转
+func (a *Archiver) run() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+		if err := a.Rotate(context.Background()); err != nil {
+			log.Printf("Session archive failed: %v", err)
+		}
+	}
+}
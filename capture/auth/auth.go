@@ -0,0 +1,177 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// DefaultRealm 407 质询中的默认认证域
+const DefaultRealm = "sniffy"
+
+// Authenticator 代理访问控制：客户端IP白名单和 Proxy-Authorization Basic 认证，
+// 两者都未配置时允许所有客户端。nil Authenticator 允许所有客户端
+type Authenticator struct {
+	mu       sync.RWMutex
+	realm    string
+	users    map[string][32]byte
+	prefixes []netip.Prefix
+}
+
+// New 创建访问控制，realm 为空时使用 DefaultRealm
+func New(realm string) *Authenticator {
+	if realm == "" {
+		realm = DefaultRealm
+	}
+	return &Authenticator{realm: realm, users: make(map[string][32]byte)}
+}
+
+// AddUser 添加允许的用户，已存在的用户更新密码
+func (a *Authenticator) AddUser(user, password string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users[user] = sha256.Sum256([]byte(password))
+}
+
+// AllowClient 将IP地址或CIDR加入客户端白名单
+func (a *Authenticator) AllowClient(s string) error {
+	prefix, err := ParseClient(s)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prefixes = append(a.prefixes, prefix)
+	return nil
+}
+
+// RequiresCredentials 是否要求 Proxy-Authorization 认证
+func (a *Authenticator) RequiresCredentials() bool {
+	if a == nil {
+		return false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.users) > 0
+}
+
+// AllowAddr 检查客户端地址是否在白名单中，未配置白名单时允许所有地址
+func (a *Authenticator) AllowAddr(addr net.Addr) bool {
+	if a == nil {
+		return true
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if len(a.prefixes) == 0 {
+		return true
+	}
+	ip, ok := addrIP(addr)
+	if !ok {
+		return false
+	}
+	for _, p := range a.prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check 校验请求的 Proxy-Authorization 头部，返回认证通过的用户名。
+// 未配置用户时总是通过，用户名为空
+func (a *Authenticator) Check(header http.Header) (string, bool) {
+	if !a.RequiresCredentials() {
+		return "", true
+	}
+	user, password, ok := ParseBasic(header.Get("Proxy-Authorization"))
+	if !ok || !a.CheckUser(user, password) {
+		return "", false
+	}
+	return user, true
+}
+
+// CheckUser 校验用户名和密码，用于不使用HTTP头部的协议，例如SOCKS5。未配置用户时总是通过
+func (a *Authenticator) CheckUser(user, password string) bool {
+	if !a.RequiresCredentials() {
+		return true
+	}
+	a.mu.RLock()
+	want, exists := a.users[user]
+	a.mu.RUnlock()
+	got := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(got[:], want[:]) == 1 && exists
+}
+
+// Challenge 返回 407 响应的 Proxy-Authenticate 头部值
+func (a *Authenticator) Challenge() string {
+	return fmt.Sprintf("Basic realm=%q", a.realm)
+}
+
+// ParseBasic 解析 Basic 认证头部值
+func ParseBasic(value string) (user, password string, ok bool) {
+	scheme, credentials, found := strings.Cut(value, " ")
+	if !found || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// ParseUser 解析 user:password 形式的用户配置
+func ParseUser(s string) (user, password string, err error) {
+	user, password, ok := strings.Cut(s, ":")
+	if !ok || user == "" {
+		return "", "", fmt.Errorf("invalid proxy user %q (expected user:password)", s)
+	}
+	return user, password, nil
+}
+
+// ParseClient 解析IP地址或CIDR，单个IP视为完整长度的前缀
+func ParseClient(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid client network %q: %w", s, err)
+		}
+		return prefix.Masked(), nil
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid client address %q: %w", s, err)
+	}
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// addrIP 返回网络地址中的IP，IPv4映射的IPv6地址转换为IPv4
+func addrIP(addr net.Addr) (netip.Addr, bool) {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			host = addr.String()
+		}
+		ip = net.ParseIP(host)
+	}
+	parsed, ok := netip.AddrFromSlice(ip)
+	return parsed.Unmap(), ok
+}
@@ -0,0 +1,84 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+func TestAuthenticator_Nil(t *testing.T) {
+	var a *Authenticator
+	require.False(t, a.RequiresCredentials())
+	require.True(t, a.AllowAddr(&net.TCPAddr{IP: net.ParseIP("192.0.2.1")}))
+	user, ok := a.Check(http.Header{})
+	require.True(t, ok)
+	require.Empty(t, user)
+}
+
+func TestAuthenticator_Check(t *testing.T) {
+	a := New("")
+	a.AddUser("alice", "s3cret:with-colon")
+	require.True(t, a.RequiresCredentials())
+	require.Equal(t, `Basic realm="sniffy"`, a.Challenge())
+
+	header := func(value string) http.Header {
+		return http.Header{"Proxy-Authorization": {value}}
+	}
+	// alice:s3cret:with-colon
+	user, ok := a.Check(header("Basic YWxpY2U6czNjcmV0OndpdGgtY29sb24="))
+	require.True(t, ok)
+	require.Equal(t, "alice", user)
+
+	for _, value := range []string{
+		"",
+		"Bearer token",
+		"Basic !!!",
+		"Basic YWxpY2U6d3Jvbmc=", // alice:wrong
+		"Basic Ym9iOnMzY3JldA==", // bob:s3cret
+	} {
+		_, ok := a.Check(header(value))
+		require.False(t, ok, value)
+	}
+
+	require.True(t, a.CheckUser("alice", "s3cret:with-colon"))
+	require.False(t, a.CheckUser("alice", "wrong"))
+	require.False(t, a.CheckUser("bob", "s3cret:with-colon"))
+	require.True(t, New("").CheckUser("anyone", ""))
+}
+
+func TestAuthenticator_AllowAddr(t *testing.T) {
+	a := New("")
+	require.NoError(t, a.AllowClient("10.0.0.0/8"))
+	require.NoError(t, a.AllowClient("2001:db8::1"))
+	require.Error(t, a.AllowClient("10.0.0.0/33"))
+	require.Error(t, a.AllowClient("localhost"))
+
+	require.True(t, a.AllowAddr(&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 1234}))
+	require.True(t, a.AllowAddr(&net.TCPAddr{IP: net.ParseIP("::ffff:10.1.2.3")}))
+	require.True(t, a.AllowAddr(&net.TCPAddr{IP: net.ParseIP("2001:db8::1")}))
+	require.False(t, a.AllowAddr(&net.TCPAddr{IP: net.ParseIP("2001:db8::2")}))
+	require.False(t, a.AllowAddr(&net.TCPAddr{IP: net.ParseIP("192.0.2.1")}))
+
+	// 其他类型的地址按字符串解析
+	other, err := net.ResolveUnixAddr("unix", "/tmp/sock")
+	require.NoError(t, err)
+	require.False(t, a.AllowAddr(other))
+	require.False(t, a.RequiresCredentials())
+}
+
+func TestParseUser(t *testing.T) {
+	user, password, err := ParseUser("alice:pa:ss")
+	require.NoError(t, err)
+	require.Equal(t, "alice", user)
+	require.Equal(t, "pa:ss", password)
+	_, _, err = ParseUser("alice")
+	require.Error(t, err)
+}
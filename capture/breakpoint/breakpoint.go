@@ -0,0 +1,318 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package breakpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// ErrNotFound 断点规则或暂停的流不存在
+var ErrNotFound = errors.New("breakpoint not found")
+
+// Phase 断点触发阶段
+type Phase int
+
+const (
+	// PhaseRequest 请求发往上游之前
+	PhaseRequest Phase = iota
+	// PhaseResponse 响应返回客户端之前
+	PhaseResponse
+)
+
+// String 返回阶段名称
+func (p Phase) String() string {
+	switch p {
+	case PhaseRequest:
+		return "request"
+	case PhaseResponse:
+		return "response"
+	default:
+		return fmt.Sprintf("Phase(%d)", int(p))
+	}
+}
+
+// MarshalText 实现 encoding.TextMarshaler
+func (p Phase) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler
+func (p *Phase) UnmarshalText(text []byte) error {
+	phase, err := ParsePhase(string(text))
+	if err != nil {
+		return err
+	}
+	*p = phase
+	return nil
+}
+
+// ParsePhase 解析阶段名称
+func ParsePhase(s string) (Phase, error) {
+	switch strings.ToLower(s) {
+	case "request", "req":
+		return PhaseRequest, nil
+	case "response", "resp":
+		return PhaseResponse, nil
+	default:
+		return 0, fmt.Errorf("invalid breakpoint phase %q (expected request or response)", s)
+	}
+}
+
+// Decision 用户对暂停的流做出的决定
+type Decision int
+
+const (
+	// DecisionResume 使用（可能已修改的）流继续
+	DecisionResume Decision = iota
+	// DecisionAbort 中止流，向客户端返回错误
+	DecisionAbort
+)
+
+// String 返回决定名称
+func (d Decision) String() string {
+	if d == DecisionAbort {
+		return "abort"
+	}
+	return "resume"
+}
+
+// Rule 断点规则
+type Rule struct {
+	ID    string       `json:"id"`
+	Phase Phase        `json:"phase"`
+	Match flow.Matcher `json:"match"`
+}
+
+// ParseRule 解析命令行格式 phase:matcher，例如 "request:POST api.example.com/v1"
+func ParseRule(s string) (Phase, flow.Matcher, error) {
+	phase, pattern, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, flow.Matcher{}, fmt.Errorf("invalid breakpoint %q (expected phase:[METHOD ]host[/path])", s)
+	}
+	p, err := ParsePhase(phase)
+	if err != nil {
+		return 0, flow.Matcher{}, err
+	}
+	return p, flow.ParseMatcher(pattern), nil
+}
+
+// Pending 暂停等待处理的流
+type Pending struct {
+	ID       string     `json:"id"`
+	RuleID   string     `json:"rule_id"`
+	Phase    Phase      `json:"phase"`
+	Flow     *flow.Flow `json:"flow"`
+	PausedAt time.Time  `json:"paused_at"`
+
+	done chan Decision
+}
+
+// Manager 断点管理器，在请求发往上游前或响应返回客户端前暂停匹配的流，
+// 等待用户修改后继续或中止
+type Manager struct {
+	mu       sync.Mutex
+	rules    []*Rule
+	pending  map[string]*Pending
+	order    []string
+	nextRule int
+	timeout  time.Duration
+	onPause  func(*Pending)
+}
+
+// NewManager 创建断点管理器
+func NewManager() *Manager {
+	return &Manager{
+		pending: make(map[string]*Pending),
+	}
+}
+
+// SetTimeout 设置暂停超时，超时后流自动继续，0表示一直等待
+func (m *Manager) SetTimeout(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timeout = d
+}
+
+// OnPause 设置流暂停时的回调，用于通知控制界面
+func (m *Manager) OnPause(fn func(*Pending)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onPause = fn
+}
+
+// AddRule 添加断点规则，返回新规则
+func (m *Manager) AddRule(phase Phase, match flow.Matcher) *Rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextRule++
+	r := &Rule{ID: strconv.Itoa(m.nextRule), Phase: phase, Match: match}
+	m.rules = append(m.rules, r)
+	return r
+}
+
+// RemoveRule 删除断点规则，已暂停的流不受影响
+func (m *Manager) RemoveRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			m.rules = append(m.rules[:i], m.rules[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Rules 返回所有断点规则的快照
+func (m *Manager) Rules() []Rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := make([]Rule, len(m.rules))
+	for i, r := range m.rules {
+		rules[i] = *r
+	}
+	return rules
+}
+
+// Match 返回在该阶段匹配流的第一条规则，没有匹配时返回nil
+func (m *Manager) Match(phase Phase, f *flow.Flow) *Rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.rules {
+		if r.Phase == phase && r.Match.Match(f) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Pause 若存在匹配的规则则暂停流，阻塞直到用户继续、中止、超时或ctx结束。
+// 没有匹配规则时立即返回 DecisionResume。
+func (m *Manager) Pause(ctx context.Context, phase Phase, f *flow.Flow) (Decision, error) {
+	rule := m.Match(phase, f)
+	if rule == nil {
+		return DecisionResume, nil
+	}
+
+	p := &Pending{
+		ID:       f.ID + "-" + phase.String(),
+		RuleID:   rule.ID,
+		Phase:    phase,
+		Flow:     f,
+		PausedAt: time.Now(),
+		done:     make(chan Decision, 1),
+	}
+
+	m.mu.Lock()
+	m.pending[p.ID] = p
+	m.order = append(m.order, p.ID)
+	timeout, onPause := m.timeout, m.onPause
+	m.mu.Unlock()
+
+	if onPause != nil {
+		onPause(p)
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case d := <-p.done:
+		return d, nil
+	case <-expired:
+		if !m.remove(p.ID) {
+			// 超时的同时用户已做出决定，等待修改完成
+			return <-p.done, nil
+		}
+		return DecisionResume, nil
+	case <-ctx.Done():
+		if !m.remove(p.ID) {
+			<-p.done
+		}
+		return DecisionAbort, ctx.Err()
+	}
+}
+
+// Pending 返回所有暂停中的流，按暂停顺序
+func (m *Manager) Pending() []*Pending {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]*Pending, 0, len(m.order))
+	for _, id := range m.order {
+		list = append(list, m.pending[id])
+	}
+	return list
+}
+
+// Get 根据ID获取暂停中的流
+func (m *Manager) Get(id string) (*Pending, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.pending[id]
+	return p, ok
+}
+
+// Resume 继续暂停的流，edit 不为nil时先用它修改流的请求或响应
+func (m *Manager) Resume(id string, edit func(*flow.Flow)) error {
+	return m.decide(id, DecisionResume, edit)
+}
+
+// Abort 中止暂停的流
+func (m *Manager) Abort(id string) error {
+	return m.decide(id, DecisionAbort, nil)
+}
+
+func (m *Manager) decide(id string, d Decision, edit func(*flow.Flow)) error {
+	m.mu.Lock()
+	p, ok := m.pending[id]
+	if ok {
+		delete(m.pending, id)
+		m.removeOrder(id)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+
+	if edit != nil {
+		edit(p.Flow)
+	}
+	p.done <- d
+	return nil
+}
+
+// remove 移除暂停的流，返回false表示已被 Resume 或 Abort 取走
+func (m *Manager) remove(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.pending[id]; !ok {
+		return false
+	}
+	delete(m.pending, id)
+	m.removeOrder(id)
+	return true
+}
+
+func (m *Manager) removeOrder(id string) {
+	for i, v := range m.order {
+		if v == id {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package breakpoint
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func newFlow(method, url string) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{Method: method, URL: url}
+	return f
+}
+
+// waitPending 等待流进入暂停状态
+func waitPending(t *testing.T, m *Manager) *Pending {
+	require.Eventually(t, func() bool { return len(m.Pending()) > 0 }, time.Second, time.Millisecond)
+	return m.Pending()[0]
+}
+
+// --- 测试代码 ---
+func TestParseRule(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		phase   Phase
+		match   flow.Matcher
+		wantErr bool
+	}{
+		{"host only", "request:example.com", PhaseRequest, flow.Matcher{Host: "example.com"}, false},
+		{"method and path", "response:POST *.example.com/api", PhaseResponse, flow.Matcher{Method: "POST", Host: "*.example.com", Path: "/api"}, false},
+		{"any host", "req:*/login", PhaseRequest, flow.Matcher{Path: "/login"}, false},
+		{"bad phase", "upstream:example.com", 0, flow.Matcher{}, true},
+		{"missing phase", "example.com", 0, flow.Matcher{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			phase, match, err := ParseRule(tc.input)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.phase, phase)
+			require.Equal(t, tc.match, match)
+		})
+	}
+}
+
+func TestManager_Match(t *testing.T) {
+	m := NewManager()
+	r := m.AddRule(PhaseRequest, flow.ParseMatcher("POST api.example.com/v1"))
+
+	require.Equal(t, r, m.Match(PhaseRequest, newFlow("POST", "https://api.example.com/v1/users")))
+	require.Nil(t, m.Match(PhaseResponse, newFlow("POST", "https://api.example.com/v1/users")))
+	require.Nil(t, m.Match(PhaseRequest, newFlow("GET", "https://api.example.com/v1/users")))
+	require.Nil(t, m.Match(PhaseRequest, newFlow("POST", "https://example.com/v1")))
+
+	require.NoError(t, m.RemoveRule(r.ID))
+	require.ErrorIs(t, m.RemoveRule(r.ID), ErrNotFound)
+	require.Empty(t, m.Rules())
+}
+
+func TestManager_PauseResume(t *testing.T) {
+	m := NewManager()
+	m.AddRule(PhaseRequest, flow.ParseMatcher("example.com"))
+	f := newFlow("GET", "http://example.com/")
+
+	done := make(chan Decision, 1)
+	go func() {
+		d, err := m.Pause(context.Background(), PhaseRequest, f)
+		require.NoError(t, err)
+		done <- d
+	}()
+
+	p := waitPending(t, m)
+	require.Equal(t, f, p.Flow)
+	require.NoError(t, m.Resume(p.ID, func(f *flow.Flow) {
+		f.Request.Method = "HEAD"
+	}))
+	require.Equal(t, DecisionResume, <-done)
+	require.Equal(t, "HEAD", f.Request.Method)
+	require.Empty(t, m.Pending())
+	require.ErrorIs(t, m.Resume(p.ID, nil), ErrNotFound)
+}
+
+func TestManager_PauseAbort(t *testing.T) {
+	m := NewManager()
+	m.AddRule(PhaseResponse, flow.Matcher{})
+
+	done := make(chan Decision, 1)
+	go func() {
+		d, _ := m.Pause(context.Background(), PhaseResponse, newFlow("GET", "http://example.com/"))
+		done <- d
+	}()
+
+	require.NoError(t, m.Abort(waitPending(t, m).ID))
+	require.Equal(t, DecisionAbort, <-done)
+}
+
+func TestManager_PauseTimeout(t *testing.T) {
+	m := NewManager()
+	m.SetTimeout(10 * time.Millisecond)
+	m.AddRule(PhaseRequest, flow.Matcher{})
+
+	d, err := m.Pause(context.Background(), PhaseRequest, newFlow("GET", "http://example.com/"))
+	require.NoError(t, err)
+	require.Equal(t, DecisionResume, d)
+	require.Empty(t, m.Pending())
+}
+
+func TestManager_PauseNoMatch(t *testing.T) {
+	m := NewManager()
+	m.AddRule(PhaseRequest, flow.ParseMatcher("example.com"))
+
+	d, err := m.Pause(context.Background(), PhaseRequest, newFlow("GET", "http://other.org/"))
+	require.NoError(t, err)
+	require.Equal(t, DecisionResume, d)
+}
+
+func TestManager_PauseContextCanceled(t *testing.T) {
+	m := NewManager()
+	m.AddRule(PhaseRequest, flow.Matcher{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	d, err := m.Pause(ctx, PhaseRequest, newFlow("GET", "http://example.com/"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, DecisionAbort, d)
+	require.Empty(t, m.Pending())
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bufpool
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sync"
+)
+
+// Size 拷贝缓冲区的大小，与 io.Copy 自行分配的缓冲区相同
+const Size = 32 << 10
+
+var (
+	buffers = sync.Pool{New: func() any {
+		b := make([]byte, Size)
+		return &b
+	}}
+	readers sync.Pool
+	writers sync.Pool
+)
+
+// Get 从池中取出 Size 字节的缓冲区，用完后调用 Put 归还
+func Get() *[]byte {
+	return buffers.Get().(*[]byte)
+}
+
+// Put 归还 Get 取出的缓冲区，归还后不能再使用
+func Put(b *[]byte) {
+	if len(*b) == Size {
+		buffers.Put(b)
+	}
+}
+
+// Copy 使用池中的缓冲区把 src 拷贝到 dst。两端都是TCP连接时交给 io.Copy 由内核直接拷贝，
+// 其他情况不使用 ReaderFrom/WriterTo，避免 net.TCPConn 等实现在内部另外分配缓冲区
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	if _, ok := dst.(*net.TCPConn); ok {
+		if _, ok := src.(*net.TCPConn); ok {
+			return io.Copy(dst, src)
+		}
+	}
+	buf := Get()
+	defer Put(buf)
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+// NewReader 从池中取出读取 r 的 bufio.Reader，缓冲区为默认大小，用完后调用 PutReader 归还
+func NewReader(r io.Reader) *bufio.Reader {
+	if br, ok := readers.Get().(*bufio.Reader); ok {
+		br.Reset(r)
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+// PutReader 归还 NewReader 取出的读取器，未读出的缓冲数据被丢弃
+func PutReader(br *bufio.Reader) {
+	br.Reset(nil)
+	readers.Put(br)
+}
+
+// NewWriter 从池中取出写入 w 的 bufio.Writer，缓冲区为默认大小，用完后调用 PutWriter 归还
+func NewWriter(w io.Writer) *bufio.Writer {
+	if bw, ok := writers.Get().(*bufio.Writer); ok {
+		bw.Reset(w)
+		return bw
+	}
+	return bufio.NewWriter(w)
+}
+
+// PutWriter 归还 NewWriter 取出的写入器，调用前需要 Flush，未写出的数据被丢弃
+func PutWriter(bw *bufio.Writer) {
+	bw.Reset(nil)
+	writers.Put(bw)
+}
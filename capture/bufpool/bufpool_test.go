@@ -0,0 +1,157 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package bufpool
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// request 基准测试中解析的请求头部
+const request = "GET http://example.com/path?q=1 HTTP/1.1\r\nHost: example.com\r\n" +
+	"User-Agent: bench\r\nAccept: */*\r\nAccept-Encoding: gzip\r\n\r\n"
+
+// onlyReader 隐藏 WriterTo 等接口的 Reader，模拟经过包装的连接
+type onlyReader struct{ io.Reader }
+
+// onlyWriter 隐藏 ReaderFrom 等接口的 Writer
+type onlyWriter struct{ io.Writer }
+
+// tcpPair 返回一对相连的TCP连接
+func tcpPair(t testing.TB) (*net.TCPConn, *net.TCPConn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := ln.Accept()
+		accepted <- c
+	}()
+	c, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	s := <-accepted
+	t.Cleanup(func() {
+		c.Close()
+		s.Close()
+	})
+	return c.(*net.TCPConn), s.(*net.TCPConn)
+}
+
+// --- 测试代码 ---
+
+func TestCopy(t *testing.T) {
+	data := bytes.Repeat([]byte("sniffy"), 20000)
+	var dst bytes.Buffer
+	n, err := Copy(onlyWriter{&dst}, onlyReader{bytes.NewReader(data)})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.Equal(t, data, dst.Bytes())
+
+	// TCP连接之间直接拷贝
+	src, peer := tcpPair(t)
+	out, sink := tcpPair(t)
+	go func() {
+		peer.Write(data)
+		peer.Close()
+	}()
+	received := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(sink)
+		received <- b
+	}()
+	n, err = Copy(out, src)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	out.CloseWrite()
+	require.Equal(t, data, <-received)
+}
+
+func TestReaderWriter(t *testing.T) {
+	br := NewReader(strings.NewReader("first"))
+	line, _ := br.ReadString(0)
+	require.Equal(t, "first", line)
+	PutReader(br)
+
+	// 池中取出的读取器不保留之前的数据
+	br = NewReader(strings.NewReader("second"))
+	line, _ = br.ReadString(0)
+	require.Equal(t, "second", line)
+	PutReader(br)
+
+	var out bytes.Buffer
+	bw := NewWriter(&out)
+	bw.WriteString("data")
+	require.NoError(t, bw.Flush())
+	PutWriter(bw)
+	require.Equal(t, "data", out.String())
+
+	buf := Get()
+	require.Len(t, *buf, Size)
+	Put(buf)
+}
+
+func BenchmarkCopy(b *testing.B) {
+	data := make([]byte, 256<<10)
+	b.Run("io.Copy", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			io.Copy(onlyWriter{io.Discard}, onlyReader{bytes.NewReader(data)})
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			Copy(onlyWriter{io.Discard}, onlyReader{bytes.NewReader(data)})
+		}
+	})
+}
+
+func BenchmarkReadRequest(b *testing.B) {
+	b.Run("bufio", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			br := bufio.NewReader(strings.NewReader(request))
+			http.ReadRequest(br)
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			br := NewReader(strings.NewReader(request))
+			http.ReadRequest(br)
+			PutReader(br)
+		}
+	})
+}
+
+func BenchmarkWriteRequest(b *testing.B) {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/path", nil)
+	b.Run("unbuffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			req.Write(onlyWriter{io.Discard})
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			bw := NewWriter(onlyWriter{io.Discard})
+			req.Write(bw)
+			bw.Flush()
+			PutWriter(bw)
+		}
+	})
+}
@@ -0,0 +1,348 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cachereport
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Resource 一个被多次请求的资源在缓存方面的表现
+type Resource struct {
+	// URL 资源地址，不含片段
+	URL string `json:"url"`
+
+	// Requests GET请求数
+	Requests int `json:"requests"`
+
+	// Revalidated 条件请求得到304的次数
+	Revalidated int `json:"revalidated"`
+
+	// Redownloaded 没有发送条件请求而完整下载了未变化内容的次数
+	Redownloaded int `json:"redownloaded"`
+
+	// IgnoredConditional 发送了条件请求，服务端仍返回完整的未变化内容的次数
+	IgnoredConditional int `json:"ignored_conditional"`
+
+	// WhileFresh 上一个响应仍在新鲜期内就再次请求的次数
+	WhileFresh int `json:"while_fresh"`
+
+	// Stale 响应的 Age 超过新鲜期，即中间缓存返回了过期内容的次数
+	Stale int `json:"stale"`
+
+	// WastedBytes 重新下载未变化内容的字节数
+	WastedBytes int64 `json:"wasted_bytes"`
+
+	// CacheControl 最后一个响应的 Cache-Control
+	CacheControl string `json:"cache_control,omitempty"`
+
+	// ETag、LastModified 最后一个响应是否带有校验器
+	ETag         bool `json:"etag"`
+	LastModified bool `json:"last_modified"`
+
+	// Findings 可改进之处
+	Findings []string `json:"findings"`
+}
+
+// Report 会话中重复请求的资源的缓存表现
+type Report struct {
+	Generated time.Time `json:"generated"`
+
+	// 所有资源的合计
+	Requests           int   `json:"requests"`
+	Revalidated        int   `json:"revalidated"`
+	Redownloaded       int   `json:"redownloaded"`
+	IgnoredConditional int   `json:"ignored_conditional"`
+	WhileFresh         int   `json:"while_fresh"`
+	Stale              int   `json:"stale"`
+	WastedBytes        int64 `json:"wasted_bytes"`
+
+	// Resources 按浪费的字节数和请求数排序
+	Resources []*Resource `json:"resources"`
+}
+
+// cached 资源最近一个响应的缓存状态
+type cached struct {
+	content    string
+	etag       string
+	noStore    bool
+	lifetime   time.Duration
+	freshUntil time.Time
+}
+
+// Analyze 按时间顺序分析GET请求的 ETag、Last-Modified、Cache-Control 等头部，报告被重新校验、
+// 不必要地重新下载以及过期的资源。只包含请求超过一次或返回过过期内容的资源
+func Analyze(flows []*flow.Flow) *Report {
+	flows = slices.Clone(flows)
+	slices.SortStableFunc(flows, func(a, b *flow.Flow) int { return a.StartTime.Compare(b.StartTime) })
+
+	byURL := map[string]*Resource{}
+	state := map[string]*cached{}
+	for _, f := range flows {
+		if f.Request == nil || f.Response == nil || f.Request.Method != http.MethodGet {
+			continue
+		}
+		key := resourceURL(f.Request.URL)
+		r := byURL[key]
+		if r == nil {
+			r = &Resource{URL: key, Findings: []string{}}
+			byURL[key] = r
+		}
+		state[key] = r.observe(f, state[key])
+	}
+
+	report := &Report{Generated: time.Now().UTC(), Resources: []*Resource{}}
+	for _, r := range byURL {
+		if r.Requests < 2 && r.Stale == 0 {
+			continue
+		}
+		r.findings()
+		report.Requests += r.Requests
+		report.Revalidated += r.Revalidated
+		report.Redownloaded += r.Redownloaded
+		report.IgnoredConditional += r.IgnoredConditional
+		report.WhileFresh += r.WhileFresh
+		report.Stale += r.Stale
+		report.WastedBytes += r.WastedBytes
+		report.Resources = append(report.Resources, r)
+	}
+	slices.SortFunc(report.Resources, func(a, b *Resource) int {
+		if c := cmp.Compare(b.WastedBytes, a.WastedBytes); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Requests, a.Requests); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.URL, b.URL)
+	})
+	return report
+}
+
+// observe 记录一次请求，返回资源新的缓存状态
+func (r *Resource) observe(f *flow.Flow, prev *cached) *cached {
+	req, resp := f.Request, f.Response
+	r.Requests++
+	r.CacheControl = resp.Header.Get("Cache-Control")
+	if resp.StatusCode != http.StatusNotModified {
+		r.ETag = resp.Header.Get("ETag") != ""
+		r.LastModified = resp.Header.Get("Last-Modified") != ""
+	}
+
+	received := f.EndTime
+	if received.IsZero() {
+		received = f.StartTime
+	}
+	cc := directives(resp.Header)
+	lifetime, explicit := freshness(resp.Header)
+	age := headerSeconds(resp.Header, "Age")
+	// no-cache 和 no-store 的响应本就需要重新校验，不算过期
+	if (explicit && age > lifetime && !cc["no-cache"] && !cc["no-store"]) || strings.HasPrefix(resp.Header.Get("Warning"), "110") {
+		r.Stale++
+	}
+
+	if prev != nil && !prev.noStore && f.StartTime.Before(prev.freshUntil) && !reload(req.Header) {
+		r.WhileFresh++
+	}
+
+	conditional := req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+	if resp.StatusCode == http.StatusNotModified {
+		if conditional {
+			r.Revalidated++
+		}
+		if prev == nil {
+			return nil
+		}
+		// 304 更新缓存副本的新鲜期，内容不变；没有缓存头部时沿用原来的新鲜期
+		next := *prev
+		if explicit {
+			next.lifetime = lifetime
+		}
+		next.freshUntil = received.Add(next.lifetime - age)
+		if cc["no-store"] {
+			next.noStore = true
+		}
+		return &next
+	}
+
+	next := &cached{
+		content:    contentID(resp),
+		etag:       strings.TrimPrefix(resp.Header.Get("ETag"), "W/"),
+		noStore:    cc["no-store"],
+		lifetime:   lifetime,
+		freshUntil: received.Add(lifetime - age),
+	}
+	if prev == nil || prev.noStore || resp.StatusCode != http.StatusOK {
+		return next
+	}
+	unchanged := (next.etag != "" && next.etag == prev.etag) || (next.content != "" && next.content == prev.content)
+	if !unchanged {
+		return next
+	}
+	if conditional {
+		r.IgnoredConditional++
+	} else {
+		r.Redownloaded++
+	}
+	r.WastedBytes += bodySize(resp)
+	return next
+}
+
+// findings 根据计数生成可改进之处
+func (r *Resource) findings() {
+	validators := r.ETag || r.LastModified
+	switch {
+	case r.Redownloaded > 0 && validators:
+		r.Findings = append(r.Findings, fmt.Sprintf("unchanged content downloaded again %d times without If-None-Match or If-Modified-Since", r.Redownloaded))
+	case r.Redownloaded > 0:
+		r.Findings = append(r.Findings, fmt.Sprintf("unchanged content downloaded again %d times; responses carry no ETag or Last-Modified to revalidate against", r.Redownloaded))
+	}
+	if r.IgnoredConditional > 0 {
+		r.Findings = append(r.Findings, fmt.Sprintf("server returned the full unchanged content for %d conditional requests instead of 304", r.IgnoredConditional))
+	}
+	if r.WhileFresh > 0 {
+		r.Findings = append(r.Findings, fmt.Sprintf("requested %d times while the cached copy was still fresh", r.WhileFresh))
+	}
+	if r.Stale > 0 {
+		r.Findings = append(r.Findings, fmt.Sprintf("served stale %d times (Age exceeds the freshness lifetime)", r.Stale))
+	}
+	if r.Requests > 1 && r.CacheControl == "" && !validators {
+		r.Findings = append(r.Findings, "no Cache-Control, ETag or Last-Modified; clients cannot cache this resource")
+	}
+}
+
+// freshness 返回响应的新鲜期，依次使用 Cache-Control 的 max-age 和 Expires 与 Date 之差。
+// explicit 表示响应明确给出了新鲜期，no-cache 和 no-store 的新鲜期为0
+func freshness(h http.Header) (lifetime time.Duration, explicit bool) {
+	cc := directives(h)
+	if cc["no-store"] || cc["no-cache"] {
+		return 0, true
+	}
+	if v, ok := maxAge(h.Values("Cache-Control")); ok {
+		return v, true
+	}
+	if expires := h.Get("Expires"); expires != "" {
+		exp, err := http.ParseTime(expires)
+		if err != nil {
+			// 无效的 Expires 表示已过期
+			return 0, true
+		}
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			return 0, false
+		}
+		return max(exp.Sub(date), 0), true
+	}
+	return 0, false
+}
+
+// directives 返回 Cache-Control 中不带参数的指令
+func directives(h http.Header) map[string]bool {
+	out := map[string]bool{}
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(d), "=")
+			out[strings.ToLower(name)] = true
+		}
+	}
+	return out
+}
+
+// maxAge 返回 Cache-Control 的 max-age
+func maxAge(values []string) (time.Duration, bool) {
+	for _, v := range values {
+		for _, d := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if !strings.EqualFold(name, "max-age") {
+				continue
+			}
+			n, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || n < 0 {
+				return 0, true
+			}
+			return time.Duration(n) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// reload 判断客户端是否要求跳过缓存，例如强制刷新
+func reload(h http.Header) bool {
+	if strings.EqualFold(h.Get("Pragma"), "no-cache") {
+		return true
+	}
+	cc := directives(h)
+	if cc["no-cache"] || cc["no-store"] {
+		return true
+	}
+	v, ok := maxAge(h.Values("Cache-Control"))
+	return ok && v == 0
+}
+
+// headerSeconds 解析以秒为单位的头部
+func headerSeconds(h http.Header, name string) time.Duration {
+	n, err := strconv.Atoi(strings.TrimSpace(h.Get(name)))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// contentID 返回完整捕获的响应体的摘要，响应体为空或被截断时返回空字符串
+func contentID(resp *flow.Response) string {
+	if len(resp.Body) == 0 || resp.BodySize > 0 {
+		return ""
+	}
+	sum := sha256.Sum256(resp.Body)
+	return string(sum[:])
+}
+
+// bodySize 返回响应体的完整长度
+func bodySize(resp *flow.Response) int64 {
+	if resp.BodySize > 0 {
+		return resp.BodySize
+	}
+	return int64(len(resp.Body))
+}
+
+// resourceURL 返回去掉片段的URL
+func resourceURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Fragment, u.RawFragment = "", ""
+	return u.String()
+}
+
+// WriteText 以文本形式输出报告
+func (r *Report) WriteText(w io.Writer) error {
+	for _, res := range r.Resources {
+		_, err := fmt.Fprintf(w, "%s  %d requests, %d revalidated, %d re-downloaded, %d stale, %d bytes wasted\n",
+			res.URL, res.Requests, res.Revalidated, res.Redownloaded+res.IgnoredConditional, res.Stale, res.WastedBytes)
+		if err != nil {
+			return err
+		}
+		if res.CacheControl != "" {
+			fmt.Fprintf(w, "  cache-control: %s\n", res.CacheControl)
+		}
+		for _, f := range res.Findings {
+			fmt.Fprintf(w, "  - %s\n", f)
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d resources, %d requests, %d revalidated, %d re-downloaded, %d while fresh, %d stale, %d bytes wasted\n",
+		len(r.Resources), r.Requests, r.Revalidated, r.Redownloaded+r.IgnoredConditional, r.WhileFresh, r.Stale, r.WastedBytes)
+	return err
+}
@@ -0,0 +1,134 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cachereport
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+var start = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// newFlow 返回在 start 之后 offset 发起的GET请求
+func newFlow(rawURL string, offset time.Duration, reqHeader http.Header, status int, respHeader http.Header, body string) *flow.Flow {
+	f := flow.New()
+	f.StartTime = start.Add(offset)
+	f.EndTime = f.StartTime.Add(10 * time.Millisecond)
+	if reqHeader == nil {
+		reqHeader = http.Header{}
+	}
+	if respHeader == nil {
+		respHeader = http.Header{}
+	}
+	f.Request = &flow.Request{Method: "GET", URL: rawURL, Header: reqHeader}
+	f.Response = &flow.Response{StatusCode: status, Header: respHeader, Body: []byte(body)}
+	return f
+}
+
+// resource 返回报告中地址为 rawURL 的资源
+func resource(r *Report, rawURL string) *Resource {
+	for _, res := range r.Resources {
+		if res.URL == rawURL {
+			return res
+		}
+	}
+	return nil
+}
+
+// --- 测试代码 ---
+
+func TestAnalyze_Revalidation(t *testing.T) {
+	etag := http.Header{"Etag": {`"v1"`}, "Cache-Control": {"max-age=60"}}
+	report := Analyze([]*flow.Flow{
+		newFlow("https://cdn.example.com/app.js", 0, nil, 200, etag, "console.log(1)"),
+		newFlow("https://cdn.example.com/app.js#main", 2*time.Minute, http.Header{"If-None-Match": {`"v1"`}}, 304, http.Header{"Etag": {`"v1"`}}, ""),
+		// 304 沿用 max-age=60，30秒后的请求仍在新鲜期内
+		newFlow("https://cdn.example.com/app.js", 2*time.Minute+30*time.Second, http.Header{"If-None-Match": {`"v1"`}}, 304, nil, ""),
+		// 强制刷新不算新鲜期内的请求
+		newFlow("https://cdn.example.com/app.js", 2*time.Minute+40*time.Second, http.Header{"Cache-Control": {"no-cache"}, "If-None-Match": {`"v1"`}}, 304, nil, ""),
+		newFlow("https://cdn.example.com/once.css", 0, nil, 200, nil, "body{}"),
+	})
+	require.Len(t, report.Resources, 1)
+	res := report.Resources[0]
+	require.Equal(t, "https://cdn.example.com/app.js", res.URL)
+	require.Equal(t, 4, res.Requests)
+	require.Equal(t, 3, res.Revalidated)
+	require.Equal(t, 1, res.WhileFresh)
+	require.Zero(t, res.Redownloaded)
+	require.True(t, res.ETag)
+	require.Equal(t, []string{"requested 1 times while the cached copy was still fresh"}, res.Findings)
+}
+
+func TestAnalyze_Redownloaded(t *testing.T) {
+	validated := http.Header{"Last-Modified": {"Sat, 01 Mar 2025 10:00:00 GMT"}, "Cache-Control": {"no-cache"}}
+	plain := http.Header{}
+	report := Analyze([]*flow.Flow{
+		newFlow("https://api.example.com/config", 0, nil, 200, validated, "{\"a\":1}"),
+		newFlow("https://api.example.com/config", time.Minute, nil, 200, validated, "{\"a\":1}"),
+		newFlow("https://api.example.com/config", 2*time.Minute, http.Header{"If-Modified-Since": {"Sat, 01 Mar 2025 10:00:00 GMT"}}, 200, validated, "{\"a\":1}"),
+		newFlow("https://api.example.com/config", 3*time.Minute, nil, 200, validated, "{\"a\":2}"),
+		newFlow("https://api.example.com/logo.png", 0, nil, 200, plain, "PNG"),
+		newFlow("https://api.example.com/logo.png", time.Second, nil, 200, plain, "PNG"),
+		newFlow("https://api.example.com/private", 0, nil, 200, http.Header{"Cache-Control": {"no-store"}}, "x"),
+		newFlow("https://api.example.com/private", time.Second, nil, 200, http.Header{"Cache-Control": {"no-store"}}, "x"),
+	})
+	require.Equal(t, 8, report.Requests)
+	require.Equal(t, int64(17), report.WastedBytes)
+
+	config := resource(report, "https://api.example.com/config")
+	require.Equal(t, 1, config.Redownloaded)
+	require.Equal(t, 1, config.IgnoredConditional)
+	require.Equal(t, int64(14), config.WastedBytes)
+	require.Equal(t, []string{
+		"unchanged content downloaded again 1 times without If-None-Match or If-Modified-Since",
+		"server returned the full unchanged content for 1 conditional requests instead of 304",
+	}, config.Findings)
+	require.Equal(t, config, report.Resources[0])
+
+	logo := resource(report, "https://api.example.com/logo.png")
+	require.Equal(t, 1, logo.Redownloaded)
+	require.Equal(t, []string{
+		"unchanged content downloaded again 1 times; responses carry no ETag or Last-Modified to revalidate against",
+		"no Cache-Control, ETag or Last-Modified; clients cannot cache this resource",
+	}, logo.Findings)
+
+	private := resource(report, "https://api.example.com/private")
+	require.Zero(t, private.Redownloaded)
+	require.Empty(t, private.Findings)
+}
+
+func TestAnalyze_Stale(t *testing.T) {
+	report := Analyze([]*flow.Flow{
+		newFlow("https://www.example.com/", 0, nil, 200, http.Header{"Cache-Control": {"max-age=300"}, "Age": {"900"}}, "<html>"),
+		newFlow("https://www.example.com/news", 0, nil, 200, http.Header{"Date": {"Sat, 01 Mar 2025 12:00:00 GMT"}, "Expires": {"Sat, 01 Mar 2025 12:01:00 GMT"}, "Age": {"30"}}, "<html>"),
+		newFlow("https://www.example.com/old", 0, nil, 200, http.Header{"Warning": {`110 - "Response is Stale"`}}, "<html>"),
+	})
+	require.Equal(t, 2, report.Stale)
+	require.Equal(t, 1, resource(report, "https://www.example.com/").Stale)
+	require.Nil(t, resource(report, "https://www.example.com/news"))
+	require.Equal(t, []string{"served stale 1 times (Age exceeds the freshness lifetime)"}, resource(report, "https://www.example.com/old").Findings)
+}
+
+func TestReport_WriteText(t *testing.T) {
+	h := http.Header{"Cache-Control": {"public, max-age=60"}, "Etag": {`"a"`}}
+	report := Analyze([]*flow.Flow{
+		newFlow("https://a.example.com/x", 0, nil, 200, h, "abc"),
+		newFlow("https://a.example.com/x", 2*time.Minute, nil, 200, h, "abc"),
+	})
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteText(&buf))
+	require.Equal(t, "https://a.example.com/x  2 requests, 0 revalidated, 1 re-downloaded, 0 stale, 3 bytes wasted\n"+
+		"  cache-control: public, max-age=60\n"+
+		"  - unchanged content downloaded again 1 times without If-None-Match or If-Modified-Since\n"+
+		"1 resources, 2 requests, 0 revalidated, 1 re-downloaded, 0 while fresh, 0 stale, 3 bytes wasted\n", buf.String())
+}
@@ -0,0 +1,213 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Recorder 将完成的流逐行写入磁带文件（JSON Lines），每条流一行
+type Recorder struct {
+	mu   sync.Mutex
+	file io.WriteCloser
+	enc  *json.Encoder
+}
+
+// OpenRecorder 创建或截断磁带文件
+func OpenRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open cassette: %w", err)
+	}
+	return NewRecorder(file), nil
+}
+
+// NewRecorder 将流写入 w，例如加密的文件，Close 时关闭 w
+func NewRecorder(w io.WriteCloser) *Recorder {
+	return &Recorder{file: w, enc: json.NewEncoder(w)}
+}
+
+// Add 写入一条流，没有响应的流不会被记录
+func (r *Recorder) Add(f *flow.Flow) {
+	if f.Response == nil || f.Request == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	_ = r.enc.Encode(f)
+}
+
+// Close 关闭磁带文件
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// Load 读取磁带文件中的所有流
+func Load(path string) ([]*flow.Flow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open cassette: %w", err)
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// Read 从 JSON Lines 格式读取流
+func Read(r io.Reader) ([]*flow.Flow, error) {
+	var flows []*flow.Flow
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		f := &flow.Flow{}
+		if err := json.Unmarshal(scanner.Bytes(), f); err != nil {
+			return nil, fmt.Errorf("cassette line %d: %w", line, err)
+		}
+		if f.Request == nil || f.Response == nil {
+			continue
+		}
+		flows = append(flows, f)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+	return flows, nil
+}
+
+// Player 按方法和URL匹配磁带中的流并返回录制的响应，实现 rules.Responder。
+// 同一请求录制了多次时按顺序返回，用完后重复最后一次；请求体相同的录制优先。
+type Player struct {
+	name string
+
+	// strict 为true时未录制的请求返回502，保证不访问网络
+	strict bool
+
+	mu      sync.Mutex
+	entries map[string][]*entry
+}
+
+type entry struct {
+	flow *flow.Flow
+	used bool
+}
+
+// NewPlayer 创建磁带回放器，name 用于流记录中的 Responder 描述，
+// strict 为true时未录制的请求返回502而不是转发到上游，没有响应的流会被忽略
+func NewPlayer(name string, flows []*flow.Flow, strict bool) *Player {
+	p := &Player{
+		name:    name,
+		strict:  strict,
+		entries: make(map[string][]*entry),
+	}
+	for _, f := range flows {
+		if f.Request == nil || f.Response == nil {
+			continue
+		}
+		key := requestKey(f.Request.Method, f.Request.URL)
+		p.entries[key] = append(p.entries[key], &entry{flow: f})
+	}
+	return p
+}
+
+// Respond 实现 rules.Responder 接口
+func (p *Player) Respond(f *flow.Flow) (*flow.Response, bool) {
+	if f.Request == nil {
+		return nil, false
+	}
+	recorded := p.take(f.Request)
+	if recorded == nil {
+		if !p.strict {
+			return nil, false
+		}
+		msg := "no recorded response for " + f.Request.Method + " " + f.Request.URL
+		return &flow.Response{
+			StatusCode: http.StatusBadGateway,
+			Status:     "502 Bad Gateway",
+			Proto:      "HTTP/1.1",
+			Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			Body:       []byte(msg),
+		}, true
+	}
+
+	resp := *recorded.Response
+	resp.Header = recorded.Response.Header.Clone()
+	resp.Body = append([]byte(nil), recorded.Response.Body...)
+	return &resp, true
+}
+
+// Delay 实现 rules.Responder 接口，回放不模拟录制时的耗时
+func (p *Player) Delay() time.Duration {
+	return 0
+}
+
+// String 实现 rules.Responder 接口
+func (p *Player) String() string {
+	return "cassette " + p.name
+}
+
+// take 取出与请求匹配的下一条录制
+func (p *Player) take(req *flow.Request) *flow.Flow {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entries := p.entries[requestKey(req.Method, req.URL)]
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var chosen *entry
+	for _, e := range entries {
+		if !e.used && bytes.Equal(e.flow.Request.Body, req.Body) {
+			chosen = e
+			break
+		}
+	}
+	if chosen == nil {
+		for _, e := range entries {
+			if !e.used {
+				chosen = e
+				break
+			}
+		}
+	}
+	if chosen == nil {
+		chosen = entries[len(entries)-1]
+	}
+	chosen.used = true
+	return chosen.flow
+}
+
+// requestKey 生成匹配键，查询参数按名称排序
+func requestKey(method, rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		u.RawQuery = u.Query().Encode()
+		u.Fragment = ""
+		rawURL = u.String()
+	}
+	return method + " " + rawURL
+}
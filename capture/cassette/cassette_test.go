@@ -0,0 +1,87 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cassette
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func recordedFlow(method, url, reqBody, respBody string) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{Method: method, URL: url, Body: []byte(reqBody)}
+	f.Response = &flow.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       []byte(respBody),
+	}
+	return f
+}
+
+func requestFlow(method, url, body string) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{Method: method, URL: url, Body: []byte(body)}
+	return f
+}
+
+// --- 测试代码 ---
+func TestRecorder_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	rec, err := OpenRecorder(path)
+	require.NoError(t, err)
+
+	rec.Add(recordedFlow("GET", "https://api.example.com/a", "", "a"))
+	rec.Add(requestFlow("GET", "https://api.example.com/failed", ""))
+	rec.Add(recordedFlow("POST", "https://api.example.com/b", "x", "b"))
+	require.NoError(t, rec.Close())
+	rec.Add(recordedFlow("GET", "https://api.example.com/late", "", "late"))
+
+	flows, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, flows, 2)
+	require.Equal(t, "https://api.example.com/a", flows[0].Request.URL)
+	require.Equal(t, "b", string(flows[1].Response.Body))
+	require.Equal(t, []byte("x"), flows[1].Request.Body)
+}
+
+func TestPlayer_Respond(t *testing.T) {
+	p := NewPlayer("test", []*flow.Flow{
+		recordedFlow("GET", "https://api.example.com/items?b=2&a=1", "", "first"),
+		recordedFlow("GET", "https://api.example.com/items?a=1&b=2", "", "second"),
+		recordedFlow("POST", "https://api.example.com/items", "x", "post x"),
+		recordedFlow("POST", "https://api.example.com/items", "y", "post y"),
+	}, true)
+
+	// 同一请求按录制顺序返回，用完后重复最后一次，查询参数顺序无关
+	for _, want := range []string{"first", "second", "second"} {
+		resp, ok := p.Respond(requestFlow("GET", "https://api.example.com/items?a=1&b=2", ""))
+		require.True(t, ok)
+		require.Equal(t, want, string(resp.Body))
+	}
+
+	// 请求体相同的录制优先
+	resp, ok := p.Respond(requestFlow("POST", "https://api.example.com/items", "y"))
+	require.True(t, ok)
+	require.Equal(t, "post y", string(resp.Body))
+
+	// 严格模式下未录制的请求返回502
+	resp, ok = p.Respond(requestFlow("GET", "https://api.example.com/missing", ""))
+	require.True(t, ok)
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	require.Equal(t, "cassette test", p.String())
+}
+
+func TestPlayer_Passthrough(t *testing.T) {
+	p := NewPlayer("test", nil, false)
+	_, ok := p.Respond(requestFlow("GET", "https://api.example.com/", ""))
+	require.False(t, ok)
+}
@@ -0,0 +1,109 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cdp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"golang.org/x/net/websocket"
+)
+
+// TargetID 唯一的调试目标的ID
+const TargetID = "sniffy"
+
+// Patterns Bridge 处理的路径前缀，调用方将它们挂载到控制端口
+var Patterns = []string{"/json", "/json/", "/devtools/"}
+
+// Bridge 通过 Chrome DevTools Protocol 的 Network 域提供捕获的流，
+// Chrome 的 Network 面板或其他CDP客户端连接后先收到存储中的流，之后实时收到新的流。
+//
+//	GET /json/version             浏览器版本信息
+//	GET /json、/json/list         调试目标列表，只有一个目标
+//	/devtools/page/sniffy         目标的 WebSocket 地址
+type Bridge struct {
+	store  *flow.Store
+	events *flow.Bus
+	mux    *http.ServeMux
+}
+
+// New 创建CDP桥接，events 为nil时只提供存储中已有的流
+func New(store *flow.Store, events *flow.Bus) *Bridge {
+	b := &Bridge{store: store, events: events, mux: http.NewServeMux()}
+	b.mux.HandleFunc("GET /json/version", b.version)
+	b.mux.HandleFunc("GET /json", b.list)
+	b.mux.HandleFunc("GET /json/list", b.list)
+	b.mux.Handle("/devtools/page/"+TargetID, websocket.Server{Handshake: checkOrigin, Handler: b.serve})
+	return b
+}
+
+// ServeHTTP 实现 http.Handler 接口
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mux.ServeHTTP(w, r)
+}
+
+// version 返回 /json/version
+func (b *Bridge) version(w http.ResponseWriter, r *http.Request) {
+	scheme, addr := webSocketAddr(r)
+	writeJSON(w, map[string]string{
+		"Browser":              "sniffy",
+		"Protocol-Version":     "1.3",
+		"User-Agent":           "sniffy",
+		"webSocketDebuggerUrl": scheme + "://" + addr,
+	})
+}
+
+// list 返回 /json/list
+func (b *Bridge) list(w http.ResponseWriter, r *http.Request) {
+	scheme, addr := webSocketAddr(r)
+	writeJSON(w, []map[string]string{{
+		"id":                   TargetID,
+		"type":                 "page",
+		"title":                "sniffy",
+		"description":          "Flows captured by sniffy",
+		"url":                  pageURL,
+		"webSocketDebuggerUrl": scheme + "://" + addr,
+		"devtoolsFrontendUrl":  "devtools://devtools/bundled/inspector.html?" + scheme + "=" + addr,
+	}})
+}
+
+// webSocketAddr 返回按请求的主机名访问目标的 WebSocket 协议和不含协议的地址
+func webSocketAddr(r *http.Request) (scheme, addr string) {
+	scheme = "ws"
+	if r.TLS != nil {
+		scheme = "wss"
+	}
+	return scheme, r.Host + "/devtools/page/" + TargetID
+}
+
+// checkOrigin 只接受没有 Origin 的客户端、DevTools 前端和同源页面，
+// 防止用户访问的网页通过 WebSocket 读取捕获的流量
+func checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.Scheme == "devtools" || u.Scheme == "chrome-devtools":
+	case (u.Scheme == "http" || u.Scheme == "https") && u.Host == r.Host:
+	default:
+		return fmt.Errorf("origin %q is not allowed", origin)
+	}
+	config.Origin = u
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,248 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cdp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// --- 辅助函数 ---
+
+var start = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newFlow(id, url string, body []byte, header http.Header) *flow.Flow {
+	return &flow.Flow{
+		ID:         id,
+		StartTime:  start,
+		EndTime:    start.Add(20 * time.Millisecond),
+		ServerAddr: "93.184.216.34:443",
+		Request:    &flow.Request{Method: "POST", URL: url, Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{"q":1}`)},
+		Response: &flow.Response{
+			StatusCode: 200,
+			Status:     "200 OK",
+			Proto:      "HTTP/2.0",
+			Header:     header,
+			Body:       body,
+		},
+	}
+}
+
+// received 客户端收到的消息，命令结果和事件共用
+type received struct {
+	ID     int64           `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type client struct {
+	t  *testing.T
+	ws *websocket.Conn
+	id int64
+}
+
+func dial(t *testing.T, srv *httptest.Server, origin string) (*client, error) {
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/devtools/page/"+TargetID, srv.URL)
+	require.NoError(t, err)
+	// 空的 Origin 相当于没有 Origin 的客户端
+	config.Origin, err = url.Parse(origin)
+	require.NoError(t, err)
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { ws.Close() })
+	return &client{t: t, ws: ws}, nil
+}
+
+// call 发送命令，返回结果之前收到的事件和结果
+func (c *client) call(method string, params any) ([]received, received) {
+	c.id++
+	require.NoError(c.t, websocket.JSON.Send(c.ws, map[string]any{"id": c.id, "method": method, "params": params}))
+	var events []received
+	for {
+		m := c.read()
+		if m.Method == "" {
+			require.Equal(c.t, c.id, m.ID)
+			return events, m
+		}
+		events = append(events, m)
+	}
+}
+
+func (c *client) read() received {
+	c.ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var m received
+	require.NoError(c.t, websocket.JSON.Receive(c.ws, &m))
+	return m
+}
+
+// --- 测试代码 ---
+
+func TestBridge_Discovery(t *testing.T) {
+	srv := httptest.NewServer(New(flow.NewStore(), nil))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	resp, err := http.Get(srv.URL + "/json/version")
+	require.NoError(t, err)
+	var version map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&version))
+	resp.Body.Close()
+	require.Equal(t, "ws://"+host+"/devtools/page/sniffy", version["webSocketDebuggerUrl"])
+
+	for _, path := range []string{"/json", "/json/list"} {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		var targets []map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&targets))
+		resp.Body.Close()
+		require.Len(t, targets, 1)
+		require.Equal(t, "page", targets[0]["type"])
+		require.Equal(t, "devtools://devtools/bundled/inspector.html?ws="+host+"/devtools/page/sniffy", targets[0]["devtoolsFrontendUrl"])
+	}
+}
+
+func TestBridge_ReplaysStoredFlows(t *testing.T) {
+	store := flow.NewStore()
+	store.Add(newFlow("a", "https://example.com/api", []byte(`{"ok":true}`), http.Header{"Content-Type": {"application/json; charset=utf-8"}}))
+	failed := &flow.Flow{ID: "b", StartTime: start, Request: &flow.Request{Method: "GET", URL: "http://example.com/down"}, Error: "connection refused"}
+	store.Add(failed)
+	srv := httptest.NewServer(New(store, flow.NewBus()))
+	defer srv.Close()
+
+	c, err := dial(t, srv, "")
+	require.NoError(t, err)
+	_, result := c.call("Network.enable", nil)
+	require.Nil(t, result.Error)
+
+	var methods []string
+	var sent requestWillBeSentParams
+	var got responseReceivedParams
+	for range 5 {
+		m := c.read()
+		methods = append(methods, m.Method)
+		switch m.Method {
+		case "Network.requestWillBeSent":
+			if sent.RequestID == "" {
+				require.NoError(t, json.Unmarshal(m.Params, &sent))
+			}
+		case "Network.responseReceived":
+			require.NoError(t, json.Unmarshal(m.Params, &got))
+		}
+	}
+	require.Equal(t, []string{
+		"Network.requestWillBeSent", "Network.responseReceived", "Network.loadingFinished",
+		"Network.requestWillBeSent", "Network.loadingFailed",
+	}, methods)
+	require.Equal(t, "a", sent.RequestID)
+	require.Equal(t, `{"q":1}`, sent.Request.PostData)
+	require.Equal(t, "application/json", sent.Request.Headers["Content-Type"])
+	require.Equal(t, "OK", got.Response.StatusText)
+	require.Equal(t, "application/json", got.Response.MimeType)
+	require.Equal(t, "utf-8", got.Response.Charset)
+	require.Equal(t, "h2", got.Response.Protocol)
+	require.Equal(t, "secure", got.Response.SecurityState)
+	require.Equal(t, "93.184.216.34", got.Response.RemoteIPAddress)
+	require.Equal(t, "Fetch", got.Type)
+}
+
+func TestBridge_LiveEvents(t *testing.T) {
+	store := flow.NewStore()
+	bus := flow.NewBus()
+	srv := httptest.NewServer(New(store, bus))
+	defer srv.Close()
+
+	c, err := dial(t, srv, "")
+	require.NoError(t, err)
+	c.call("Network.enable", nil)
+
+	f := newFlow("live", "http://example.com/", []byte("hi"), http.Header{"Content-Type": {"text/html"}})
+	bus.Started(f)
+	bus.ResponseHeaders(f)
+	store.Add(f)
+	bus.Finished(f)
+
+	var methods []string
+	for range 3 {
+		methods = append(methods, c.read().Method)
+	}
+	require.Equal(t, []string{"Network.requestWillBeSent", "Network.responseReceived", "Network.loadingFinished"}, methods)
+}
+
+func TestBridge_GetResponseBody(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("hello"))
+	w.Close()
+	store := flow.NewStore()
+	store.Add(newFlow("text", "https://example.com/", gz.Bytes(), http.Header{"Content-Encoding": {"gzip"}}))
+	store.Add(newFlow("binary", "https://example.com/", []byte{0xff, 0x00}, http.Header{}))
+	srv := httptest.NewServer(New(store, nil))
+	defer srv.Close()
+
+	c, err := dial(t, srv, "")
+	require.NoError(t, err)
+	var body struct {
+		Body          string `json:"body"`
+		Base64Encoded bool   `json:"base64Encoded"`
+	}
+	_, result := c.call("Network.getResponseBody", map[string]string{"requestId": "text"})
+	require.NoError(t, json.Unmarshal(result.Result, &body))
+	require.Equal(t, "hello", body.Body)
+	require.False(t, body.Base64Encoded)
+
+	_, result = c.call("Network.getResponseBody", map[string]string{"requestId": "binary"})
+	require.NoError(t, json.Unmarshal(result.Result, &body))
+	require.Equal(t, base64.StdEncoding.EncodeToString([]byte{0xff, 0x00}), body.Body)
+	require.True(t, body.Base64Encoded)
+
+	_, result = c.call("Network.getRequestPostData", map[string]string{"requestId": "text"})
+	require.JSONEq(t, `{"postData":"{\"q\":1}"}`, string(result.Result))
+
+	_, result = c.call("Network.getResponseBody", map[string]string{"requestId": "missing"})
+	require.Equal(t, codeServerError, result.Error.Code)
+}
+
+func TestBridge_UnknownMethods(t *testing.T) {
+	srv := httptest.NewServer(New(flow.NewStore(), nil))
+	defer srv.Close()
+	c, err := dial(t, srv, "")
+	require.NoError(t, err)
+
+	_, result := c.call("Runtime.enable", nil)
+	require.Nil(t, result.Error)
+	_, result = c.call("Emulation.setDeviceMetricsOverride", map[string]int{"width": 100})
+	require.Nil(t, result.Error)
+	_, result = c.call("Runtime.evaluate", map[string]string{"expression": "1"})
+	require.Equal(t, codeMethodNotFound, result.Error.Code)
+}
+
+func TestBridge_RejectsCrossOrigin(t *testing.T) {
+	srv := httptest.NewServer(New(flow.NewStore(), nil))
+	defer srv.Close()
+
+	_, err := dial(t, srv, "https://evil.example")
+	require.Error(t, err)
+	_, err = dial(t, srv, "devtools://devtools")
+	require.NoError(t, err)
+	_, err = dial(t, srv, srv.URL)
+	require.NoError(t, err)
+}
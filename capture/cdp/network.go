@@ -0,0 +1,379 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cdp
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+const (
+	// pageURL 调试目标的地址，只起标识作用
+	pageURL = "sniffy://flows"
+
+	// loaderID 所有请求共用的加载器ID
+	loaderID = "sniffy"
+
+	// maxPostData 随 requestWillBeSent 发送的请求体的最大长度，更长的由客户端按需获取
+	maxPostData = 64 << 10
+
+	// maxBody getResponseBody 和 getRequestPostData 返回的内容的最大长度
+	maxBody = 64 << 20
+)
+
+// cdpRequest Network.Request
+type cdpRequest struct {
+	URL             string            `json:"url"`
+	Method          string            `json:"method"`
+	Headers         map[string]string `json:"headers"`
+	PostData        string            `json:"postData,omitempty"`
+	HasPostData     bool              `json:"hasPostData,omitempty"`
+	InitialPriority string            `json:"initialPriority"`
+	ReferrerPolicy  string            `json:"referrerPolicy"`
+}
+
+// cdpResponse Network.Response
+type cdpResponse struct {
+	URL               string            `json:"url"`
+	Status            int               `json:"status"`
+	StatusText        string            `json:"statusText"`
+	Headers           map[string]string `json:"headers"`
+	MimeType          string            `json:"mimeType"`
+	Charset           string            `json:"charset"`
+	ConnectionReused  bool              `json:"connectionReused"`
+	ConnectionID      int               `json:"connectionId"`
+	RemoteIPAddress   string            `json:"remoteIPAddress,omitempty"`
+	RemotePort        int               `json:"remotePort,omitempty"`
+	FromDiskCache     bool              `json:"fromDiskCache"`
+	FromServiceWorker bool              `json:"fromServiceWorker"`
+	FromPrefetchCache bool              `json:"fromPrefetchCache"`
+	EncodedDataLength int64             `json:"encodedDataLength"`
+	Timing            *resourceTiming   `json:"timing,omitempty"`
+	Protocol          string            `json:"protocol,omitempty"`
+	SecurityState     string            `json:"securityState"`
+}
+
+// resourceTiming Network.ResourceTiming，各阶段为相对 RequestTime 的毫秒数，-1 表示没有该阶段
+type resourceTiming struct {
+	RequestTime              float64 `json:"requestTime"`
+	ProxyStart               float64 `json:"proxyStart"`
+	ProxyEnd                 float64 `json:"proxyEnd"`
+	DNSStart                 float64 `json:"dnsStart"`
+	DNSEnd                   float64 `json:"dnsEnd"`
+	ConnectStart             float64 `json:"connectStart"`
+	ConnectEnd               float64 `json:"connectEnd"`
+	SSLStart                 float64 `json:"sslStart"`
+	SSLEnd                   float64 `json:"sslEnd"`
+	WorkerStart              float64 `json:"workerStart"`
+	WorkerReady              float64 `json:"workerReady"`
+	WorkerFetchStart         float64 `json:"workerFetchStart"`
+	WorkerRespondWithSettled float64 `json:"workerRespondWithSettled"`
+	SendStart                float64 `json:"sendStart"`
+	SendEnd                  float64 `json:"sendEnd"`
+	PushStart                float64 `json:"pushStart"`
+	PushEnd                  float64 `json:"pushEnd"`
+	ReceiveHeadersStart      float64 `json:"receiveHeadersStart"`
+	ReceiveHeadersEnd        float64 `json:"receiveHeadersEnd"`
+}
+
+// initiator Network.Initiator
+type initiator struct {
+	Type string `json:"type"`
+}
+
+// requestWillBeSentParams Network.requestWillBeSent 事件
+type requestWillBeSentParams struct {
+	RequestID   string     `json:"requestId"`
+	LoaderID    string     `json:"loaderId"`
+	DocumentURL string     `json:"documentURL"`
+	Request     cdpRequest `json:"request"`
+	Timestamp   float64    `json:"timestamp"`
+	WallTime    float64    `json:"wallTime"`
+	Initiator   initiator  `json:"initiator"`
+	Type        string     `json:"type,omitempty"`
+	FrameID     string     `json:"frameId"`
+}
+
+// responseReceivedParams Network.responseReceived 事件
+type responseReceivedParams struct {
+	RequestID string      `json:"requestId"`
+	LoaderID  string      `json:"loaderId"`
+	Timestamp float64     `json:"timestamp"`
+	Type      string      `json:"type"`
+	Response  cdpResponse `json:"response"`
+	FrameID   string      `json:"frameId"`
+}
+
+// dataReceived Network.dataReceived 事件
+type dataReceived struct {
+	RequestID         string  `json:"requestId"`
+	Timestamp         float64 `json:"timestamp"`
+	DataLength        int     `json:"dataLength"`
+	EncodedDataLength int     `json:"encodedDataLength"`
+}
+
+// loadingFinished Network.loadingFinished 事件
+type loadingFinished struct {
+	RequestID         string  `json:"requestId"`
+	Timestamp         float64 `json:"timestamp"`
+	EncodedDataLength int64   `json:"encodedDataLength"`
+}
+
+// loadingFailedParams Network.loadingFailed 事件
+type loadingFailedParams struct {
+	RequestID string  `json:"requestId"`
+	Timestamp float64 `json:"timestamp"`
+	Type      string  `json:"type"`
+	ErrorText string  `json:"errorText"`
+	Canceled  bool    `json:"canceled"`
+}
+
+// requestWillBeSent 生成 requestWillBeSent 事件，req 为nil时表示请求体还未读取
+func requestWillBeSent(id string, t time.Time, url, method string, header http.Header, req *flow.Request, typ string) requestWillBeSentParams {
+	r := cdpRequest{
+		URL:             url,
+		Method:          method,
+		Headers:         headers(header),
+		InitialPriority: "High",
+		ReferrerPolicy:  "strict-origin-when-cross-origin",
+	}
+	if req != nil {
+		r.HasPostData = req.BodyLen() > 0
+		if r.HasPostData && !req.Truncated() && len(req.Body) <= maxPostData {
+			if body, _, err := flow.DecodeBody(req.Header, req.Body); err == nil && utf8.Valid(body) {
+				r.PostData = string(body)
+			}
+		}
+	} else {
+		length := header.Get("Content-Length")
+		r.HasPostData = (length != "" && length != "0") || header.Get("Transfer-Encoding") != ""
+	}
+	return requestWillBeSentParams{
+		RequestID:   id,
+		LoaderID:    loaderID,
+		DocumentURL: url,
+		Request:     r,
+		Timestamp:   timestamp(t),
+		WallTime:    timestamp(t),
+		Initiator:   initiator{Type: "other"},
+		Type:        typ,
+		FrameID:     TargetID,
+	}
+}
+
+// responseReceived 生成 responseReceived 事件，f 不为nil时包含连接信息和各阶段的时间
+func responseReceived(id string, t time.Time, url string, resp *flow.Response, f *flow.Flow) responseReceivedParams {
+	r := cdpResponse{
+		URL:           url,
+		Status:        resp.StatusCode,
+		StatusText:    http.StatusText(resp.StatusCode),
+		Headers:       headers(resp.Header),
+		SecurityState: "insecure",
+	}
+	if _, text, ok := strings.Cut(resp.Status, " "); ok {
+		r.StatusText = text
+	}
+	if mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		r.MimeType, r.Charset = mediaType, params["charset"]
+	}
+	if strings.HasPrefix(url, "https:") {
+		r.SecurityState = "secure"
+	}
+	switch {
+	case strings.HasPrefix(resp.Proto, "HTTP/2"):
+		r.Protocol = "h2"
+	case strings.HasPrefix(resp.Proto, "HTTP/3"):
+		r.Protocol = "h3"
+	case resp.Proto != "":
+		r.Protocol = strings.ToLower(resp.Proto)
+	}
+	if f != nil {
+		r.ConnectionReused = f.ConnReused
+		r.EncodedDataLength = resp.BodyLen()
+		if host, port, err := net.SplitHostPort(f.ServerAddr); err == nil {
+			r.RemoteIPAddress = host
+			r.RemotePort, _ = strconv.Atoi(port)
+		}
+		r.Timing = timing(f)
+	}
+	return responseReceivedParams{
+		RequestID: id,
+		LoaderID:  loaderID,
+		Timestamp: timestamp(t),
+		Type:      resourceType(resp),
+		Response:  r,
+		FrameID:   TargetID,
+	}
+}
+
+// loadingFailed 生成 loadingFailed 事件
+func loadingFailed(id string, t time.Time, text string, code flow.ErrorCode) loadingFailedParams {
+	return loadingFailedParams{
+		RequestID: id,
+		Timestamp: timestamp(t),
+		Type:      "Other",
+		ErrorText: text,
+		Canceled:  code == flow.CodeClientAbort || code == flow.CodeCanceled,
+	}
+}
+
+// timing 将流的各阶段时间转换为相对开始时间的毫秒数，没有记录时返回nil
+func timing(f *flow.Flow) *resourceTiming {
+	t := f.Timings
+	if t == nil || f.StartTime.IsZero() {
+		return nil
+	}
+	ms := func(ts time.Time) float64 {
+		if ts.IsZero() {
+			return -1
+		}
+		return float64(ts.Sub(f.StartTime)) / float64(time.Millisecond)
+	}
+	rt := &resourceTiming{
+		RequestTime:              timestamp(f.StartTime),
+		ProxyStart:               -1,
+		ProxyEnd:                 -1,
+		DNSStart:                 ms(t.DNSStart),
+		DNSEnd:                   ms(t.DNSDone),
+		ConnectStart:             ms(t.ConnectStart),
+		ConnectEnd:               ms(t.ConnectDone),
+		SSLStart:                 ms(t.TLSStart),
+		SSLEnd:                   ms(t.TLSDone),
+		WorkerStart:              -1,
+		WorkerReady:              -1,
+		WorkerFetchStart:         -1,
+		WorkerRespondWithSettled: -1,
+		SendEnd:                  ms(t.RequestSent),
+		ReceiveHeadersStart:      ms(t.FirstByte),
+		ReceiveHeadersEnd:        ms(t.FirstByte),
+	}
+	// DevTools 中的连接阶段包含TLS握手
+	if rt.SSLEnd > rt.ConnectEnd {
+		rt.ConnectEnd = rt.SSLEnd
+	}
+	rt.SendStart = max(rt.ConnectEnd, rt.DNSEnd, 0)
+	if rt.SendEnd < rt.SendStart {
+		rt.SendEnd = rt.SendStart
+	}
+	return rt
+}
+
+// resourceType 按响应的内容类型推断 Network.ResourceType
+func resourceType(resp *flow.Response) string {
+	if resp == nil {
+		return "Other"
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return "Document"
+	case mediaType == "text/css":
+		return "Stylesheet"
+	case strings.Contains(mediaType, "javascript") || mediaType == "text/ecmascript":
+		return "Script"
+	case strings.HasPrefix(mediaType, "image/"):
+		return "Image"
+	case strings.HasPrefix(mediaType, "font/") || strings.Contains(mediaType, "font-"):
+		return "Font"
+	case strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/"):
+		return "Media"
+	case mediaType == "text/event-stream":
+		return "EventSource"
+	case strings.Contains(mediaType, "json") || strings.Contains(mediaType, "xml"):
+		return "Fetch"
+	}
+	return "Other"
+}
+
+// headers 将头部转换为CDP的格式，多个值以换行分隔
+func headers(h http.Header) map[string]string {
+	m := make(map[string]string, len(h))
+	for name, values := range h {
+		m[name] = strings.Join(values, "\n")
+	}
+	return m
+}
+
+// timestamp 返回以秒为单位的Unix时间
+func timestamp(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// responseBody 执行 Network.getResponseBody
+func (s *session) responseBody(id string) (any, *rpcError) {
+	f, ok := s.bridge.store.Get(id)
+	if !ok || f.Response == nil {
+		return nil, &rpcError{Code: codeServerError, Message: "No resource with given identifier found"}
+	}
+	body, err := readBody(f.Response.Header, f.Response.OpenBody)
+	if err != nil {
+		return nil, &rpcError{Code: codeServerError, Message: err.Error()}
+	}
+	if utf8.Valid(body) {
+		return map[string]any{"body": string(body), "base64Encoded": false}, nil
+	}
+	return map[string]any{"body": base64.StdEncoding.EncodeToString(body), "base64Encoded": true}, nil
+}
+
+// postData 执行 Network.getRequestPostData
+func (s *session) postData(id string) (any, *rpcError) {
+	f, ok := s.bridge.store.Get(id)
+	if !ok || f.Request == nil || f.Request.BodyLen() == 0 {
+		return nil, &rpcError{Code: codeServerError, Message: "No post data available for the request"}
+	}
+	body, err := readBody(f.Request.Header, f.Request.OpenBody)
+	if err != nil {
+		return nil, &rpcError{Code: codeServerError, Message: err.Error()}
+	}
+	if utf8.Valid(body) {
+		return map[string]any{"postData": string(body)}, nil
+	}
+	return map[string]any{"postData": base64.StdEncoding.EncodeToString(body), "base64Encoded": true}, nil
+}
+
+// readBody 读取并按 Content-Encoding 解码内容，最多读取 maxBody 字节
+func readBody(header http.Header, open func() (io.ReadCloser, error)) ([]byte, error) {
+	body, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	decoded, _, err := flow.DecodeReader(header, body)
+	if err != nil {
+		return nil, err
+	}
+	defer decoded.Close()
+	return io.ReadAll(io.LimitReader(decoded, maxBody))
+}
+
+// resourceTree 执行 Page.getResourceTree，只有一个不包含资源的框架
+func resourceTree() any {
+	return map[string]any{
+		"frameTree": map[string]any{
+			"frame": map[string]any{
+				"id":                             TargetID,
+				"loaderId":                       loaderID,
+				"url":                            pageURL,
+				"domainAndRegistry":              "",
+				"securityOrigin":                 pageURL,
+				"mimeType":                       "text/html",
+				"secureContextType":              "InsecureScheme",
+				"crossOriginIsolatedContextType": "NotIsolated",
+				"gatedAPIFeatures":               []string{},
+			},
+			"resources": []any{},
+		},
+	}
+}
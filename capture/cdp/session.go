@@ -0,0 +1,286 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cdp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"golang.org/x/net/websocket"
+)
+
+// JSON-RPC 错误码
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeServerError    = -32000
+)
+
+// message 客户端发送的命令
+type message struct {
+	ID        int64           `json:"id"`
+	Method    string          `json:"method"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+}
+
+// response 命令的结果
+type response struct {
+	ID        int64     `json:"id"`
+	Result    any       `json:"result,omitempty"`
+	Error     *rpcError `json:"error,omitempty"`
+	SessionID string    `json:"sessionId,omitempty"`
+}
+
+// event 发送给客户端的事件
+type event struct {
+	Method string `json:"method"`
+	Params any    `json:"params"`
+}
+
+// rpcError 命令失败的原因
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// session 一个 WebSocket 连接，所有发送都在 serve 的goroutine中进行
+type session struct {
+	bridge *Bridge
+	ws     *websocket.Conn
+
+	// events 启用 Network 域后订阅的事件，未启用时为nil
+	events <-chan flow.Event
+	cancel func()
+
+	// pending 已发送 requestWillBeSent 但还没有结束的请求的URL
+	pending map[string]string
+
+	// replayed 启用时从存储中回放的流，订阅后、读取存储前发生的事件会重复，需要忽略
+	replayed map[string]bool
+}
+
+// serve 处理一个 WebSocket 连接
+func (b *Bridge) serve(ws *websocket.Conn) {
+	defer ws.Close()
+	s := &session{bridge: b, ws: ws}
+	defer s.disable()
+
+	commands := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(commands)
+		for {
+			var data string
+			if err := websocket.Message.Receive(ws, &data); err != nil {
+				return
+			}
+			select {
+			case commands <- data:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		var err error
+		select {
+		case data, ok := <-commands:
+			if !ok {
+				return
+			}
+			err = s.handle(data)
+		case e, ok := <-s.events:
+			if !ok {
+				s.events = nil
+				continue
+			}
+			err = s.event(e)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle 执行命令并发送结果，启用 Network 域时在结果之后回放存储中的流
+func (s *session) handle(data string) error {
+	var m message
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		return s.send(response{Error: &rpcError{Code: codeParseError, Message: "invalid message: " + err.Error()}})
+	}
+	result, rerr := s.call(m.Method, m.Params)
+	resp := response{ID: m.ID, SessionID: m.SessionID, Result: result, Error: rerr}
+	if rerr != nil {
+		resp.Result = nil
+	}
+	if err := s.send(resp); err != nil {
+		return err
+	}
+	if m.Method == "Network.enable" && rerr == nil {
+		return s.replay()
+	}
+	return nil
+}
+
+// call 执行命令，不支持的 enable、disable 和 set 命令视为成功，便于 DevTools 前端正常启动
+func (s *session) call(method string, params json.RawMessage) (any, *rpcError) {
+	var p struct {
+		RequestID string `json:"requestId"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: "invalid params: " + err.Error()}
+		}
+	}
+	switch method {
+	case "Network.enable":
+		s.enable()
+		return struct{}{}, nil
+	case "Network.disable":
+		s.disable()
+		return struct{}{}, nil
+	case "Network.getResponseBody":
+		return s.responseBody(p.RequestID)
+	case "Network.getRequestPostData":
+		return s.postData(p.RequestID)
+	case "Page.getResourceTree":
+		return resourceTree(), nil
+	}
+	_, name, _ := strings.Cut(method, ".")
+	if name == "enable" || name == "disable" || strings.HasPrefix(name, "set") {
+		return struct{}{}, nil
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("'%s' wasn't found", method)}
+}
+
+// enable 订阅流事件，先订阅再读取存储，避免遗漏读取期间结束的流
+func (s *session) enable() {
+	if s.cancel != nil {
+		return
+	}
+	s.pending = make(map[string]string)
+	s.replayed = make(map[string]bool)
+	s.cancel = func() {}
+	if s.bridge.events != nil {
+		s.events, s.cancel = s.bridge.events.Subscribe(256, nil)
+	}
+}
+
+// disable 取消订阅
+func (s *session) disable() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.cancel, s.events = nil, nil
+	s.pending, s.replayed = nil, nil
+}
+
+// replay 发送存储中所有流的完整事件序列
+func (s *session) replay() error {
+	for _, f := range s.bridge.store.List() {
+		s.replayed[f.ID] = true
+		if err := s.sendFlow(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// event 将流事件转换为 Network 域的事件
+func (s *session) event(e flow.Event) error {
+	if s.replayed[e.FlowID] {
+		if e.Type == flow.EventCompleted || e.Type == flow.EventError {
+			delete(s.replayed, e.FlowID)
+		}
+		return nil
+	}
+	url, started := s.pending[e.FlowID]
+	switch e.Type {
+	case flow.EventRequestStarted:
+		s.pending[e.FlowID] = e.URL
+		return s.emit("Network.requestWillBeSent", requestWillBeSent(e.FlowID, e.Time, e.URL, e.Method, e.Header, nil, ""))
+	case flow.EventResponseHeaders:
+		if !started {
+			return nil
+		}
+		return s.emit("Network.responseReceived", responseReceived(e.FlowID, e.Time, url, &flow.Response{
+			StatusCode: e.StatusCode,
+			Header:     e.Header,
+		}, nil))
+	case flow.EventBodyChunk:
+		if !started || e.Part != "response" {
+			return nil
+		}
+		return s.emit("Network.dataReceived", dataReceived{RequestID: e.FlowID, Timestamp: timestamp(e.Time), DataLength: e.Size, EncodedDataLength: e.Size})
+	case flow.EventCompleted, flow.EventError:
+		delete(s.pending, e.FlowID)
+		f, ok := s.bridge.store.Get(e.FlowID)
+		if !started {
+			// 订阅前开始的流，存储中有时发送完整序列
+			if !ok {
+				return nil
+			}
+			return s.sendFlow(f)
+		}
+		if e.Type == flow.EventError {
+			return s.emit("Network.loadingFailed", loadingFailed(e.FlowID, e.Time, e.Error, e.ErrorCode))
+		}
+		var size int64
+		if ok && f.Response != nil {
+			size = f.Response.BodyLen()
+		}
+		return s.emit("Network.loadingFinished", loadingFinished{RequestID: e.FlowID, Timestamp: timestamp(e.Time), EncodedDataLength: size})
+	}
+	return nil
+}
+
+// sendFlow 发送结束的流的完整事件序列
+func (s *session) sendFlow(f *flow.Flow) error {
+	if f.Request == nil {
+		return nil
+	}
+	end := f.EndTime
+	if end.IsZero() {
+		end = f.StartTime
+	}
+	if err := s.emit("Network.requestWillBeSent", requestWillBeSent(f.ID, f.StartTime, f.Request.URL, f.Request.Method, f.Request.Header, f.Request, resourceType(f.Response))); err != nil {
+		return err
+	}
+	if f.Response != nil {
+		responseTime := end
+		if f.Timings != nil && !f.Timings.FirstByte.IsZero() {
+			responseTime = f.Timings.FirstByte
+		}
+		if err := s.emit("Network.responseReceived", responseReceived(f.ID, responseTime, f.Request.URL, f.Response, f)); err != nil {
+			return err
+		}
+	}
+	if f.Error != "" {
+		return s.emit("Network.loadingFailed", loadingFailed(f.ID, end, f.Error, f.ErrorCode))
+	}
+	var size int64
+	if f.Response != nil {
+		size = f.Response.BodyLen()
+	}
+	return s.emit("Network.loadingFinished", loadingFinished{RequestID: f.ID, Timestamp: timestamp(end), EncodedDataLength: size})
+}
+
+// emit 发送事件
+func (s *session) emit(method string, params any) error {
+	return s.send(event{Method: method, Params: params})
+}
+
+// send 以JSON文本消息发送 v
+func (s *session) send(v any) error {
+	return websocket.JSON.Send(s.ws, v)
+}
@@ -0,0 +1,296 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package chaos
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Action 注入的故障类型
+type Action string
+
+const (
+	// ActionDelay 转发请求前等待固定或随机的时间
+	ActionDelay Action = "delay"
+
+	// ActionStatus 不访问上游，直接返回指定的错误状态码
+	ActionStatus Action = "status"
+
+	// ActionReset 发送部分响应体后以TCP RST重置客户端连接
+	ActionReset Action = "reset"
+
+	// ActionTruncate 发送部分响应体后正常关闭客户端连接，响应头部仍声明完整长度
+	ActionTruncate Action = "truncate"
+
+	// ActionDNS 模拟上游主机名解析失败
+	ActionDNS Action = "dns"
+)
+
+// Rule 故障注入规则
+type Rule struct {
+	// Match 请求匹配规则
+	Match flow.Matcher `json:"match"`
+
+	// Action 故障类型
+	Action Action `json:"action"`
+
+	// Probability 匹配的请求触发故障的概率，取值 (0, 1]，0 表示总是触发
+	Probability float64 `json:"probability,omitempty"`
+
+	// Delay 和 DelayMax delay 的等待时间，DelayMax 大于 Delay 时在两者之间均匀随机
+	Delay    time.Duration `json:"delay,omitempty"`
+	DelayMax time.Duration `json:"delay_max,omitempty"`
+
+	// Status status 返回的状态码，默认503
+	Status int `json:"status,omitempty"`
+
+	// Amount reset 和 truncate 在关闭连接前发送的响应体字节数（如 1024）或百分比（如 50%），
+	// 为空时发送一半
+	Amount string `json:"amount,omitempty"`
+}
+
+// ParseRule 解析命令行格式 pattern=action[:arg][,probability]，例如：
+//
+//	api.example.com=delay:500ms
+//	api.example.com=delay:100ms-2s,30%
+//	POST api.example.com/upload=status:503,0.2
+//	cdn.example.com=reset:1024
+//	cdn.example.com=truncate:50%
+//	*.internal=dns
+func ParseRule(s string) (*Rule, error) {
+	pattern, spec, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(pattern) == "" || strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("invalid chaos rule %q (expected [METHOD ]host[/path]=action[:arg][,probability])", s)
+	}
+	r := &Rule{Match: flow.ParseMatcher(pattern)}
+
+	if before, prob, ok := strings.Cut(spec, ","); ok {
+		p, err := parseProbability(prob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chaos rule %q: %w", s, err)
+		}
+		r.Probability = p
+		spec = before
+	}
+	action, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	r.Action = Action(strings.ToLower(action))
+
+	var err error
+	switch r.Action {
+	case ActionDelay:
+		err = r.parseDelay(arg)
+	case ActionStatus:
+		r.Status = http.StatusServiceUnavailable
+		if arg != "" {
+			r.Status, err = strconv.Atoi(arg)
+			if err == nil && (r.Status < 100 || r.Status > 999) {
+				err = fmt.Errorf("status code %d out of range", r.Status)
+			}
+		}
+	case ActionReset, ActionTruncate:
+		r.Amount = arg
+		_, err = r.cutoff(0)
+	case ActionDNS:
+		if arg != "" {
+			err = fmt.Errorf("dns takes no argument")
+		}
+	default:
+		return nil, fmt.Errorf("unknown chaos action %q in %q (supported: delay, status, reset, truncate, dns)", action, s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid chaos rule %q: %w", s, err)
+	}
+	return r, nil
+}
+
+// parseDelay 解析 500ms 或 100ms-2s 形式的等待时间
+func (r *Rule) parseDelay(arg string) error {
+	lo, hi, ranged := strings.Cut(arg, "-")
+	var err error
+	if r.Delay, err = time.ParseDuration(lo); err != nil {
+		return err
+	}
+	if ranged {
+		if r.DelayMax, err = time.ParseDuration(hi); err != nil {
+			return err
+		}
+		if r.DelayMax < r.Delay {
+			return fmt.Errorf("delay range %s is reversed", arg)
+		}
+	}
+	if r.Delay < 0 {
+		return fmt.Errorf("delay must not be negative")
+	}
+	return nil
+}
+
+// parseProbability 解析 0.2 或 20% 形式的概率
+func parseProbability(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	scale := 1.0
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		s, scale = pct, 100
+	}
+	p, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid probability %q", s)
+	}
+	p /= scale
+	if p <= 0 || p > 1 {
+		return 0, fmt.Errorf("probability %v out of range (0, 1]", p)
+	}
+	return p, nil
+}
+
+// String 返回规则的文本形式，记录在流的 Fault 字段
+func (r *Rule) String() string {
+	s := r.Match.String() + "=" + string(r.Action)
+	switch r.Action {
+	case ActionDelay:
+		s += ":" + r.Delay.String()
+		if r.DelayMax > r.Delay {
+			s += "-" + r.DelayMax.String()
+		}
+	case ActionStatus:
+		s += ":" + strconv.Itoa(r.Status)
+	case ActionReset, ActionTruncate:
+		if r.Amount != "" {
+			s += ":" + r.Amount
+		}
+	}
+	if r.Probability > 0 && r.Probability < 1 {
+		s += "," + strconv.FormatFloat(r.Probability*100, 'f', -1, 64) + "%"
+	}
+	return s
+}
+
+// Cutoff 返回长度为 n 的响应体在关闭连接前发送的字节数
+func (r *Rule) Cutoff(n int) int {
+	cut, _ := r.cutoff(n)
+	return cut
+}
+
+// cutoff 按 Amount 计算发送的字节数
+func (r *Rule) cutoff(n int) (int, error) {
+	if r.Amount == "" {
+		return n / 2, nil
+	}
+	if pct, ok := strings.CutSuffix(r.Amount, "%"); ok {
+		p, err := strconv.ParseFloat(pct, 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("invalid percentage %q", r.Amount)
+		}
+		return int(float64(n) * p / 100), nil
+	}
+	b, err := strconv.ParseInt(r.Amount, 10, 64)
+	if err != nil || b < 0 {
+		return 0, fmt.Errorf("invalid byte count %q", r.Amount)
+	}
+	return int(min(b, int64(n))), nil
+}
+
+// Response 返回 status 规则的本地响应
+func (r *Rule) Response() *flow.Response {
+	body := fmt.Sprintf("fault injected by sniffy: %s", r)
+	return &flow.Response{
+		StatusCode: r.Status,
+		Status:     fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:       []byte(body),
+	}
+}
+
+// Decision 一个流触发的故障
+type Decision struct {
+	// Delay 所有触发的 delay 规则的等待时间之和
+	Delay time.Duration
+
+	// Delays 触发的 delay 规则
+	Delays []*Rule
+
+	// Fault 第一条触发的其他规则，为nil表示不注入故障
+	Fault *Rule
+}
+
+// Faults 返回触发的规则描述
+func (d Decision) Faults() []string {
+	var faults []string
+	for _, r := range d.Delays {
+		faults = append(faults, r.String())
+	}
+	if d.Fault != nil {
+		faults = append(faults, d.Fault.String())
+	}
+	return faults
+}
+
+// Engine 故障注入规则集合，按添加顺序匹配，并发安全。nil Engine 不注入任何故障
+type Engine struct {
+	mu    sync.RWMutex
+	rules []*Rule
+
+	// roll 返回 [0, 1) 的随机数，测试时替换
+	roll func() float64
+}
+
+// New 创建没有规则的引擎
+func New() *Engine {
+	return &Engine{roll: rand.Float64}
+}
+
+// Add 添加规则
+func (e *Engine) Add(r *Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = append(e.rules, r)
+}
+
+// Rules 返回所有规则
+func (e *Engine) Rules() []*Rule {
+	if e == nil {
+		return nil
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]*Rule(nil), e.rules...)
+}
+
+// Decide 为流掷骰子决定注入的故障：累加所有触发的 delay 规则，其他类型只取第一条触发的规则
+func (e *Engine) Decide(f *flow.Flow) Decision {
+	var d Decision
+	if e == nil {
+		return d
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, r := range e.rules {
+		if !r.Match.Match(f) || (r.Action != ActionDelay && d.Fault != nil) {
+			continue
+		}
+		if r.Probability > 0 && e.roll() >= r.Probability {
+			continue
+		}
+		if r.Action == ActionDelay {
+			d.Delay += r.Delay
+			if r.DelayMax > r.Delay {
+				d.Delay += time.Duration(e.roll() * float64(r.DelayMax-r.Delay))
+			}
+			d.Delays = append(d.Delays, r)
+			continue
+		}
+		d.Fault = r
+	}
+	return d
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package chaos
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+func newEngine(t *testing.T, rolls []float64, rules ...string) *Engine {
+	t.Helper()
+	e := New()
+	e.roll = func() float64 {
+		require.NotEmpty(t, rolls, "unexpected roll")
+		r := rolls[0]
+		rolls = rolls[1:]
+		return r
+	}
+	for _, s := range rules {
+		r, err := ParseRule(s)
+		require.NoError(t, err)
+		e.Add(r)
+	}
+	return e
+}
+
+func newFlow(method, url string) *flow.Flow {
+	return &flow.Flow{Request: &flow.Request{Method: method, URL: url}}
+}
+
+// --- 测试代码 ---
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("api.example.com=delay:100ms-2s,30%")
+	require.NoError(t, err)
+	require.Equal(t, ActionDelay, r.Action)
+	require.Equal(t, 100*time.Millisecond, r.Delay)
+	require.Equal(t, 2*time.Second, r.DelayMax)
+	require.InDelta(t, 0.3, r.Probability, 1e-9)
+	require.Equal(t, "api.example.com=delay:100ms-2s,30%", r.String())
+
+	r, err = ParseRule("POST api.example.com/upload=status:502,0.5")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadGateway, r.Status)
+	require.Equal(t, "POST api.example.com/upload=status:502,50%", r.String())
+
+	r, err = ParseRule("*=STATUS")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, r.Status)
+	resp := r.Response()
+	require.Equal(t, "503 Service Unavailable", resp.Status)
+	require.Contains(t, string(resp.Body), "status:503")
+
+	r, err = ParseRule("cdn.example.com=reset:1024,1")
+	require.NoError(t, err)
+	require.Equal(t, "cdn.example.com=reset:1024", r.String())
+
+	for _, s := range []string{
+		"",
+		"api.example.com",
+		"=dns",
+		"api.example.com=explode",
+		"api.example.com=delay",
+		"api.example.com=delay:2s-1s",
+		"api.example.com=delay:-1s",
+		"api.example.com=status:42",
+		"api.example.com=status:bad",
+		"api.example.com=reset:-1",
+		"api.example.com=truncate:150%",
+		"api.example.com=dns:1",
+		"api.example.com=dns,0",
+		"api.example.com=dns,2",
+		"api.example.com=dns,often",
+	} {
+		_, err := ParseRule(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestRule_Cutoff(t *testing.T) {
+	for amount, want := range map[string]int{
+		"":     500,
+		"0":    0,
+		"100":  100,
+		"5000": 1000,
+		"25%":  250,
+		"0%":   0,
+	} {
+		r := &Rule{Action: ActionTruncate, Amount: amount}
+		require.Equal(t, want, r.Cutoff(1000), amount)
+	}
+}
+
+func TestEngine_Decide(t *testing.T) {
+	// 依次消耗：第一条 delay 的概率、其随机延迟，第二条 delay 没有概率，status 的概率
+	e := newEngine(t, []float64{0.1, 0.5, 0.9},
+		"api.example.com=delay:100ms-300ms,50%",
+		"*=delay:1s",
+		"api.example.com=status:500,50%",
+		"api.example.com/fail=reset",
+		"api.example.com=dns",
+	)
+	d := e.Decide(newFlow("GET", "https://api.example.com/fail"))
+	require.Equal(t, 1200*time.Millisecond, d.Delay)
+	require.Len(t, d.Delays, 2)
+	require.NotNil(t, d.Fault)
+	require.Equal(t, ActionReset, d.Fault.Action)
+	require.Equal(t, []string{
+		"api.example.com=delay:100ms-300ms,50%",
+		"*=delay:1s",
+		"api.example.com/fail=reset",
+	}, d.Faults())
+
+	// 第一条触发的故障之后的规则不再掷骰子
+	e = newEngine(t, []float64{0.9, 0.2},
+		"api.example.com=delay:10ms,50%",
+		"api.example.com=status:500,50%",
+		"api.example.com=dns,50%",
+	)
+	d = e.Decide(newFlow("GET", "https://api.example.com/"))
+	require.Zero(t, d.Delay)
+	require.Equal(t, 500, d.Fault.Status)
+
+	d = newEngine(t, nil, "api.example.com=dns").Decide(newFlow("GET", "http://example.org/"))
+	require.Nil(t, d.Fault)
+	require.Empty(t, d.Faults())
+
+	var nilEngine *Engine
+	require.Nil(t, nilEngine.Decide(newFlow("GET", "http://example.org/")).Fault)
+	require.Nil(t, nilEngine.Rules())
+}
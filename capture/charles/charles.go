@@ -0,0 +1,249 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package charles
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// ErrBinarySession 二进制的 .chls 会话是Java序列化格式，无法直接读取
+var ErrBinarySession = errors.New("binary Charles session (.chls) is not supported, export it from Charles as a JSON session (.chlsj)")
+
+// Transaction Charles JSON会话（.chlsj）中的一次请求
+type Transaction struct {
+	Method          string    `json:"method"`
+	ProtocolVersion string    `json:"protocolVersion"`
+	Scheme          string    `json:"scheme"`
+	Host            string    `json:"host"`
+	Port            int       `json:"port"`
+	ActualPort      int       `json:"actualPort"`
+	Path            string    `json:"path"`
+	Query           string    `json:"query"`
+	Tunnel          bool      `json:"tunnel"`
+	ClientAddress   string    `json:"clientAddress"`
+	ClientPort      int       `json:"clientPort"`
+	RemoteAddress   string    `json:"remoteAddress"`
+	Times           *Times    `json:"times"`
+	Request         *Message  `json:"request"`
+	Response        *Message  `json:"response"`
+	ErrorMessage    string    `json:"errorMessage"`
+	SSL             *struct{} `json:"ssl"`
+}
+
+// Times 各阶段的时间点，格式为带时区的 ISO 8601
+type Times struct {
+	Start           string `json:"start"`
+	RequestBegin    string `json:"requestBegin"`
+	RequestComplete string `json:"requestComplete"`
+	ResponseBegin   string `json:"responseBegin"`
+	End             string `json:"end"`
+}
+
+// Message 请求或响应
+type Message struct {
+	Status int     `json:"status"`
+	Header *Header `json:"header"`
+	Body   *Body   `json:"body"`
+}
+
+// Header 首行和头部
+type Header struct {
+	FirstLine string `json:"firstLine"`
+	Headers   []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"headers"`
+}
+
+// Body 文本内容保存在 Text 中，二进制内容以base64保存在 Encoded 中。
+// Decoded 表示 Charles 已按 Content-Encoding 解压
+type Body struct {
+	Text    *string `json:"text"`
+	Encoded string  `json:"encoded"`
+	Decoded bool    `json:"decoded"`
+}
+
+// Load 读取 Charles 会话文件
+func Load(path string) ([]*flow.Flow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open charles session: %w", err)
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// Read 解析 Charles JSON会话，CONNECT 隧道和未完成的请求被忽略
+func Read(r io.Reader) ([]*flow.Flow, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0xac, 0xed}) {
+		return nil, ErrBinarySession
+	}
+	var txs []*Transaction
+	if err := json.NewDecoder(br).Decode(&txs); err != nil {
+		return nil, fmt.Errorf("decode charles session: %w", err)
+	}
+	var flows []*flow.Flow
+	for i, tx := range txs {
+		if tx == nil || tx.Tunnel || tx.Method == http.MethodConnect {
+			continue
+		}
+		f, err := tx.Flow()
+		if err != nil {
+			return nil, fmt.Errorf("charles transaction %d: %w", i, err)
+		}
+		flows = append(flows, f)
+	}
+	return flows, nil
+}
+
+// Flow 将一次请求转换为流，失败的请求转换为 Error
+func (tx *Transaction) Flow() (*flow.Flow, error) {
+	if tx.Host == "" || tx.Request == nil {
+		return nil, errors.New("missing request")
+	}
+	f := flow.New()
+	if tx.Times != nil {
+		if start := parseTime(tx.Times.Start); !start.IsZero() {
+			f.StartTime = start
+		}
+		f.EndTime = parseTime(tx.Times.End)
+		f.Timings = &flow.Timings{
+			RequestSent:  parseTime(tx.Times.RequestComplete),
+			FirstByte:    parseTime(tx.Times.ResponseBegin),
+			ResponseDone: f.EndTime,
+		}
+	}
+	f.ClientAddr = joinAddr(tx.ClientAddress, tx.ClientPort)
+	f.ServerAddr = joinAddr(tx.RemoteAddress, tx.ActualPort)
+	f.Intercepted = tx.SSL != nil
+
+	scheme := cmp.Or(tx.Scheme, "http")
+	host := tx.Host
+	if tx.Port > 0 && !(scheme == "http" && tx.Port == 80) && !(scheme == "https" && tx.Port == 443) {
+		host = net.JoinHostPort(host, strconv.Itoa(tx.Port))
+	}
+	u := scheme + "://" + host + cmp.Or(tx.Path, "/")
+	if tx.Query != "" {
+		u += "?" + tx.Query
+	}
+
+	body, err := tx.Request.body()
+	if err != nil {
+		return nil, err
+	}
+	f.Request = &flow.Request{
+		Method: cmp.Or(tx.Method, http.MethodGet),
+		URL:    u,
+		Host:   host,
+		Proto:  tx.ProtocolVersion,
+		Header: tx.Request.headers(),
+		Body:   body,
+	}
+	f.Request.Header.Del("Host")
+
+	if tx.Response != nil && tx.Response.Status > 0 {
+		body, err := tx.Response.body()
+		if err != nil {
+			return nil, err
+		}
+		f.Response = &flow.Response{
+			StatusCode: tx.Response.Status,
+			Status:     status(tx.Response),
+			Proto:      tx.ProtocolVersion,
+			Header:     tx.Response.headers(),
+			Body:       body,
+		}
+		if tx.Response.Body != nil && tx.Response.Body.Decoded {
+			f.Response.Header.Del("Content-Encoding")
+		}
+	} else {
+		f.Error = cmp.Or(tx.ErrorMessage, "no response")
+	}
+	return f, nil
+}
+
+func (m *Message) headers() http.Header {
+	h := http.Header{}
+	if m.Header != nil {
+		for _, nv := range m.Header.Headers {
+			// HTTP/2 的伪头部不是真正的头部
+			if !strings.HasPrefix(nv.Name, ":") {
+				h.Add(nv.Name, nv.Value)
+			}
+		}
+	}
+	return h
+}
+
+func (m *Message) body() ([]byte, error) {
+	b := m.Body
+	switch {
+	case b == nil:
+		return nil, nil
+	case b.Text != nil:
+		return []byte(*b.Text), nil
+	case b.Encoded != "":
+		data, err := base64.StdEncoding.DecodeString(b.Encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body encoding: %w", err)
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// status 从首行取出状态文本，例如 "HTTP/1.1 404 Not Found"
+func status(m *Message) string {
+	code := strconv.Itoa(m.Status)
+	if m.Header != nil {
+		if _, rest, ok := strings.Cut(m.Header.FirstLine, " "+code+" "); ok {
+			return code + " " + rest
+		}
+	}
+	return code + " " + http.StatusText(m.Status)
+}
+
+// joinAddr 连接地址和端口，Charles 的地址形如 "host/1.2.3.4" 或 "/1.2.3.4"
+func joinAddr(addr string, port int) string {
+	if i := strings.LastIndexByte(addr, '/'); i >= 0 {
+		addr = addr[i+1:]
+	}
+	if addr == "" {
+		return ""
+	}
+	if port <= 0 {
+		return addr
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+// timeLayouts Charles 不同版本使用的时间格式
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.000-0700"}
+
+func parseTime(s string) time.Time {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,97 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package charles
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// session Charles 4 导出的JSON会话，包含一次HTTPS请求、一个隧道和一次失败的请求
+const session = `[
+  {
+    "status": "COMPLETE", "method": "POST", "protocolVersion": "HTTP/1.1",
+    "scheme": "https", "host": "api.example.com", "actualPort": 443, "port": 443,
+    "path": "/v1/login", "query": "next=%2Fhome", "tunnel": false,
+    "clientAddress": "/127.0.0.1", "clientPort": 53000, "remoteAddress": "api.example.com/93.184.216.34",
+    "times": {
+      "start": "2024-03-01T10:00:00.000+01:00", "requestBegin": "2024-03-01T10:00:00.050+01:00",
+      "requestComplete": "2024-03-01T10:00:00.060+01:00", "responseBegin": "2024-03-01T10:00:00.200+01:00",
+      "end": "2024-03-01T10:00:00.250+0100"
+    },
+    "ssl": {"protocol": "TLSv1.3"},
+    "request": {
+      "header": {"firstLine": "POST /v1/login?next=%2Fhome HTTP/1.1", "headers": [
+        {"name": "Host", "value": "api.example.com"}, {"name": "Content-Type", "value": "application/json"}
+      ]},
+      "body": {"text": "{\"user\":\"a\"}", "charset": "UTF-8"}
+    },
+    "response": {
+      "status": 401,
+      "header": {"firstLine": "HTTP/1.1 401 Login Required", "headers": [
+        {"name": "Content-Type", "value": "image/png"}, {"name": "Content-Encoding", "value": "gzip"}
+      ]},
+      "body": {"encoded": "iVBORw==", "decoded": true}
+    }
+  },
+  {"method": "CONNECT", "host": "tunnel.example.com", "port": 443, "tunnel": true},
+  {
+    "status": "FAILED", "method": "GET", "scheme": "http", "host": "down.example.com", "port": 8080,
+    "path": "/", "request": {"header": {"headers": [{"name": ":authority", "value": "down.example.com"}]}},
+    "errorMessage": "Connection refused"
+  }
+]`
+
+// --- 测试代码 ---
+func TestRead(t *testing.T) {
+	flows, err := Read(strings.NewReader(session))
+	require.NoError(t, err)
+	require.Len(t, flows, 2)
+
+	f := flows[0]
+	require.Equal(t, "POST", f.Request.Method)
+	require.Equal(t, "https://api.example.com/v1/login?next=%2Fhome", f.Request.URL)
+	require.Equal(t, "api.example.com", f.Request.Host)
+	require.Empty(t, f.Request.Header.Get("Host"))
+	require.Equal(t, `{"user":"a"}`, string(f.Request.Body))
+	require.Equal(t, "401 Login Required", f.Response.Status)
+	require.Equal(t, []byte{0x89, 'P', 'N', 'G'}, f.Response.Body)
+	require.Empty(t, f.Response.Header.Get("Content-Encoding"))
+	require.Equal(t, "127.0.0.1:53000", f.ClientAddr)
+	require.Equal(t, "93.184.216.34:443", f.ServerAddr)
+	require.True(t, f.Intercepted)
+	require.Equal(t, 250*time.Millisecond, f.Duration())
+	require.Equal(t, 200*time.Millisecond, f.Timings.FirstByte.Sub(f.StartTime))
+
+	failed := flows[1]
+	require.Equal(t, "http://down.example.com:8080/", failed.Request.URL)
+	require.Empty(t, failed.Request.Header)
+	require.Nil(t, failed.Response)
+	require.Equal(t, "Connection refused", failed.Error)
+	require.False(t, failed.Intercepted)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "session.chls")
+	require.NoError(t, os.WriteFile(binary, []byte{0xac, 0xed, 0x00, 0x05}, 0o600))
+	_, err := Load(binary)
+	require.ErrorIs(t, err, ErrBinarySession)
+
+	_, err = Read(strings.NewReader(`{"not": "a list"}`))
+	require.ErrorContains(t, err, "decode charles session")
+	_, err = Read(strings.NewReader(`[{"method": "GET"}]`))
+	require.ErrorContains(t, err, "missing request")
+	_, err = Read(strings.NewReader(`[{"host": "a", "request": {"body": {"encoded": "!!"}}}]`))
+	require.ErrorContains(t, err, "invalid body encoding")
+}
@@ -0,0 +1,97 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// ErrNoRequest 流没有请求
+var ErrNoRequest = errors.New("flow has no request")
+
+// Options 生成代码的选项
+type Options struct {
+	// Insecure 不校验服务器证书，例如经过MITM代理时
+	Insecure bool
+
+	// Proxy 经由该代理发送请求
+	Proxy string
+}
+
+// Generator 将请求转换为可以直接运行的代码，以换行结尾
+type Generator func(f *flow.Flow, opts Options) string
+
+// generators 支持的语言
+var generators = map[string]Generator{
+	"curl": func(f *flow.Flow, opts Options) string {
+		return f.ToCurl(flow.CurlOptions{Insecure: opts.Insecure, Proxy: opts.Proxy}) + "\n"
+	},
+	"go":     Go,
+	"python": Python,
+}
+
+// Languages 返回支持的语言
+func Languages() []string {
+	return slices.Sorted(maps.Keys(generators))
+}
+
+// Generate 用指定语言的生成器转换流的请求
+func Generate(lang string, f *flow.Flow, opts Options) (string, error) {
+	gen, ok := generators[strings.ToLower(lang)]
+	if !ok {
+		return "", fmt.Errorf("unsupported language %q, want one of %s", lang, strings.Join(Languages(), ", "))
+	}
+	if f.Request == nil {
+		return "", ErrNoRequest
+	}
+	return gen(f, opts), nil
+}
+
+// skipHeaders HTTP客户端自动生成或自动处理的头部。
+// Accept-Encoding 由客户端协商，声明客户端不能解码的编码会得到无法读取的响应
+var skipHeaders = map[string]bool{
+	"Accept-Encoding":   true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	flow.ReplayHeader:   true,
+}
+
+// header 需要写入代码的一个头部
+type header struct {
+	name   string
+	values []string
+}
+
+// headers 按名称排序返回需要写入代码的头部，Host 与URL中的主机不同时放在最前面
+func headers(req *flow.Request) []header {
+	var out []header
+	if u, err := url.Parse(req.URL); err == nil && req.Host != "" && !strings.EqualFold(req.Host, u.Host) {
+		out = append(out, header{"Host", []string{req.Host}})
+	}
+	for _, name := range slices.Sorted(maps.Keys(req.Header)) {
+		if !skipHeaders[http.CanonicalHeaderKey(name)] && !strings.EqualFold(name, "Host") {
+			out = append(out, header{name, req.Header[name]})
+		}
+	}
+	return out
+}
+
+// truncated 返回请求体被截断时的说明
+func truncated(req *flow.Request) string {
+	if req.BodyFile == "" && req.Truncated() {
+		return fmt.Sprintf("request body truncated to %d of %d bytes", len(req.Body), req.BodySize)
+	}
+	return ""
+}
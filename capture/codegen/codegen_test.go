@@ -0,0 +1,110 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package codegen
+
+import (
+	"go/format"
+	"net/http"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func newFlow(body []byte) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{
+		Method: http.MethodPost,
+		URL:    "https://127.0.0.1:8443/api?q=1",
+		Host:   "api.example.com",
+		Header: http.Header{
+			"Accept-Encoding": {"gzip, br"},
+			"Content-Length":  {"12"},
+			"Content-Type":    {"application/json"},
+			"Cookie":          {"a=1", "b=2"},
+		},
+		Body: body,
+	}
+	return f
+}
+
+// --- 测试代码 ---
+func TestGo(t *testing.T) {
+	code := Go(newFlow([]byte(`{"a":"b"}`)), Options{Insecure: true, Proxy: "http://127.0.0.1:8080"})
+	formatted, err := format.Source([]byte(code))
+	require.NoError(t, err, code)
+	require.Equal(t, code, string(formatted))
+	require.Contains(t, code, "\"crypto/tls\"\n")
+	require.Contains(t, code, "http.NewRequest(\"POST\", \"https://127.0.0.1:8443/api?q=1\", strings.NewReader(`{\"a\":\"b\"}`))")
+	require.Contains(t, code, `req.Host = "api.example.com"`)
+	require.Contains(t, code, `req.Header.Set("Cookie", "a=1")`)
+	require.Contains(t, code, `req.Header.Add("Cookie", "b=2")`)
+	require.Contains(t, code, "TLSClientConfig: &tls.Config{InsecureSkipVerify: true}")
+	require.Contains(t, code, "Proxy:           http.ProxyURL(proxy),")
+	require.NotContains(t, code, "Accept-Encoding")
+	require.NotContains(t, code, "Content-Length")
+
+	// 没有请求体和选项时使用默认客户端，二进制内容使用转义
+	f := newFlow(nil)
+	f.Request.Method, f.Request.Host = http.MethodGet, "127.0.0.1:8443"
+	code = Go(f, Options{})
+	_, err = format.Source([]byte(code))
+	require.NoError(t, err, code)
+	require.Contains(t, code, `"https://127.0.0.1:8443/api?q=1", nil)`)
+	require.Contains(t, code, "http.DefaultClient.Do(req)")
+	require.NotContains(t, code, "req.Host")
+	require.NotContains(t, code, "strings")
+
+	code = Go(newFlow([]byte{0, 0xff, '`'}), Options{})
+	require.Contains(t, code, `strings.NewReader("\x00\xff`+"`"+`")`)
+
+	f = newFlow(nil)
+	f.Request.BodyFile = "/tmp/body"
+	code = Go(f, Options{})
+	_, err = format.Source([]byte(code))
+	require.NoError(t, err, code)
+	require.Contains(t, code, `os.Open("/tmp/body")`)
+}
+
+func TestPython(t *testing.T) {
+	code := Python(newFlow([]byte(`{"a":"b"}`)), Options{Insecure: true, Proxy: "http://127.0.0.1:8080"})
+	require.Equal(t, `import requests
+
+url = "https://127.0.0.1:8443/api?q=1"
+headers = {
+    "Host": "api.example.com",
+    "Content-Type": "application/json",
+    "Cookie": "a=1; b=2",
+}
+data = "{\"a\":\"b\"}"
+proxies = {"http": "http://127.0.0.1:8080", "https": "http://127.0.0.1:8080"}
+
+response = requests.request("POST", url, headers=headers, data=data, proxies=proxies, verify=False)
+print(response.status_code, response.reason)
+print(response.text)
+`, code)
+
+	f := newFlow([]byte{'a', 0, 0xff, '"'})
+	f.Request.BodySize = 10
+	code = Python(f, Options{})
+	require.Contains(t, code, "# request body truncated to 4 of 10 bytes\n")
+	require.Contains(t, code, `data = b"a\x00\xff\""`)
+	require.Contains(t, code, `response = requests.request("POST", url, headers=headers, data=data)`)
+}
+
+func TestGenerate(t *testing.T) {
+	require.Equal(t, []string{"curl", "go", "python"}, Languages())
+
+	code, err := Generate("CURL", newFlow(nil), Options{Insecure: true})
+	require.NoError(t, err)
+	require.Contains(t, code, "--insecure")
+
+	_, err = Generate("rust", newFlow(nil), Options{})
+	require.ErrorContains(t, err, "unsupported language")
+	_, err = Generate("go", flow.New(), Options{})
+	require.ErrorIs(t, err, ErrNoRequest)
+}
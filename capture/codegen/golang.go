@@ -0,0 +1,109 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package codegen
+
+import (
+	"fmt"
+	"go/format"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Go 将请求转换为使用 net/http 的Go程序
+func Go(f *flow.Flow, opts Options) string {
+	req := f.Request
+	imports := []string{"fmt", "io", "net/http"}
+	var body string
+	switch {
+	case req.BodyFile != "":
+		imports = append(imports, "os")
+		body = "body"
+	case len(req.Body) > 0:
+		imports = append(imports, "strings")
+		body = "strings.NewReader(" + goQuote(string(req.Body)) + ")"
+	default:
+		body = "nil"
+	}
+	if opts.Insecure {
+		imports = append(imports, "crypto/tls")
+	}
+	if opts.Proxy != "" {
+		imports = append(imports, "net/url")
+	}
+	slices.Sort(imports)
+
+	var b strings.Builder
+	b.WriteString("package main\n\nimport (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(&b, "\t%q\n", imp)
+	}
+	b.WriteString(")\n\nfunc main() {\n")
+	if req.BodyFile != "" {
+		fmt.Fprintf(&b, "\tbody, err := os.Open(%s)\n", strconv.Quote(req.BodyFile))
+		b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n\tdefer body.Close()\n\n")
+	}
+	if note := truncated(req); note != "" {
+		fmt.Fprintf(&b, "\t// %s\n", note)
+	}
+	fmt.Fprintf(&b, "\treq, err := http.NewRequest(%s, %s, %s)\n", strconv.Quote(req.Method), strconv.Quote(req.URL), body)
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	for _, h := range headers(req) {
+		if h.name == "Host" {
+			fmt.Fprintf(&b, "\treq.Host = %s\n", strconv.Quote(h.values[0]))
+			continue
+		}
+		for i, v := range h.values {
+			method := "Set"
+			if i > 0 {
+				method = "Add"
+			}
+			fmt.Fprintf(&b, "\treq.Header.%s(%s, %s)\n", method, strconv.Quote(h.name), goQuote(v))
+		}
+	}
+	b.WriteString("\n")
+
+	client := "http.DefaultClient"
+	if opts.Insecure || opts.Proxy != "" {
+		client = "client"
+		if opts.Proxy != "" {
+			fmt.Fprintf(&b, "\tproxy, err := url.Parse(%s)\n", strconv.Quote(opts.Proxy))
+			b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+		}
+		b.WriteString("\tclient := &http.Client{Transport: &http.Transport{\n")
+		if opts.Proxy != "" {
+			b.WriteString("\t\tProxy: http.ProxyURL(proxy),\n")
+		}
+		if opts.Insecure {
+			b.WriteString("\t\tTLSClientConfig: &tls.Config{InsecureSkipVerify: true},\n")
+		}
+		b.WriteString("\t}}\n")
+	}
+	fmt.Fprintf(&b, "\tresp, err := %s.Do(req)\n", client)
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n\tdefer resp.Body.Close()\n\n")
+	b.WriteString("\tdata, err := io.ReadAll(resp.Body)\n\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	b.WriteString("\tfmt.Println(resp.Status)\n\tfmt.Println(string(data))\n}\n")
+	// 由 gofmt 对齐结构体字段
+	if src, err := format.Source([]byte(b.String())); err == nil {
+		return string(src)
+	}
+	return b.String()
+}
+
+// goQuote 返回 s 的Go字符串字面量，包含引号或换行的文本使用原始字符串
+func goQuote(s string) string {
+	raw := utf8.ValidString(s) && strings.ContainsAny(s, "\"\n") && strings.IndexFunc(s, func(r rune) bool {
+		return r == '`' || r == '\r' || !unicode.IsPrint(r) && r != '\n' && r != '\t'
+	}) < 0
+	if raw {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
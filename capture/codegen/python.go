@@ -0,0 +1,102 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package codegen
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Python 将请求转换为使用 requests 的Python脚本
+func Python(f *flow.Flow, opts Options) string {
+	req := f.Request
+	var b strings.Builder
+	b.WriteString("import requests\n\n")
+	if note := truncated(req); note != "" {
+		fmt.Fprintf(&b, "# %s\n", note)
+	}
+	fmt.Fprintf(&b, "url = %s\n", pyQuote(req.URL))
+	args := []string{pyQuote(req.Method), "url"}
+
+	if hs := headers(req); len(hs) > 0 {
+		b.WriteString("headers = {\n")
+		for _, h := range hs {
+			// requests 的头部是字典，同名头部按RFC 9110合并，Cookie 使用分号
+			sep := ", "
+			if strings.EqualFold(h.name, "Cookie") {
+				sep = "; "
+			}
+			fmt.Fprintf(&b, "    %s: %s,\n", pyQuote(h.name), pyQuote(strings.Join(h.values, sep)))
+		}
+		b.WriteString("}\n")
+		args = append(args, "headers=headers")
+	}
+	switch {
+	case req.BodyFile != "":
+		fmt.Fprintf(&b, "data = open(%s, \"rb\")\n", pyQuote(req.BodyFile))
+		args = append(args, "data=data")
+	case len(req.Body) > 0:
+		fmt.Fprintf(&b, "data = %s\n", pyQuote(string(req.Body)))
+		args = append(args, "data=data")
+	}
+	if opts.Proxy != "" {
+		fmt.Fprintf(&b, "proxies = {\"http\": %[1]s, \"https\": %[1]s}\n", pyQuote(opts.Proxy))
+		args = append(args, "proxies=proxies")
+	}
+	if opts.Insecure {
+		args = append(args, "verify=False")
+	}
+	fmt.Fprintf(&b, "\nresponse = requests.request(%s)\n", strings.Join(args, ", "))
+	b.WriteString("print(response.status_code, response.reason)\nprint(response.text)\n")
+	return b.String()
+}
+
+// pyQuote 返回 s 的Python字面量，不是有效UTF-8文本时使用字节串
+func pyQuote(s string) string {
+	text := utf8.ValidString(s)
+	var b strings.Builder
+	if !text {
+		b.WriteByte('b')
+	}
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := rune(s[i]), 1
+		if text {
+			r, size = utf8.DecodeRuneInString(s[i:])
+		}
+		switch {
+		case r == '\\' || r == '"':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case !text && (r < 0x20 || r >= 0x7f):
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case text && !unicode.IsPrint(r):
+			switch {
+			case r < 0x100:
+				fmt.Fprintf(&b, `\x%02x`, r)
+			case r < 0x10000:
+				fmt.Fprintf(&b, `\u%04x`, r)
+			default:
+				fmt.Fprintf(&b, `\U%08x`, r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,430 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package console
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/replay"
+)
+
+// maxLogLines 事件日志保留的最大行数
+const maxLogLines = 1000
+
+// view 当前显示的界面
+type view int
+
+const (
+	viewList view = iota
+	viewDetail
+	viewIntercept
+	viewLog
+	viewHelp
+)
+
+// detail 视图中的标签页
+const (
+	tabRequest = iota
+	tabResponse
+	tabInfo
+	tabCount
+)
+
+// prompt 底部的单行输入
+type prompt struct {
+	label  string
+	text   []rune
+	submit func(string)
+}
+
+// Console 类似mitmproxy的终端界面：可滚动的流列表、键盘操作的详情视图和拦截控制，
+// 适合通过SSH使用。同时实现 io.Writer，日志写入后显示在事件日志中。
+type Console struct {
+	store       *flow.Store
+	breakpoints *breakpoint.Manager
+	replayer    *replay.Replayer
+
+	mu      sync.Mutex
+	view    view
+	back    view
+	width   int
+	height  int
+	prompt  *prompt
+	message string
+	logs    []string
+	partial []byte
+
+	// 流列表
+	filterText string
+	filter     *filter.Filter
+	flows      []*flow.Flow
+	cursor     int
+	offset     int
+	follow     bool
+
+	// 详情视图
+	current *flow.Flow
+	tab     int
+	scroll  int
+
+	// 拦截视图
+	pending int
+
+	redraw chan struct{}
+}
+
+// New 创建展示 store 中流的终端界面，breakpoints 为nil时不提供拦截功能
+func New(store *flow.Store, breakpoints *breakpoint.Manager) *Console {
+	c := &Console{
+		store:       store,
+		breakpoints: breakpoints,
+		width:       80,
+		height:      24,
+		follow:      true,
+		redraw:      make(chan struct{}, 1),
+	}
+	store.OnAdd(func(*flow.Flow) { c.notify() })
+	if breakpoints != nil {
+		breakpoints.OnPause(func(p *breakpoint.Pending) {
+			c.mu.Lock()
+			c.message = fmt.Sprintf("Intercepted %s %s (press I to handle)", p.Phase, requestLine(p.Flow))
+			c.mu.Unlock()
+			c.notify()
+		})
+	}
+	c.refresh()
+	return c
+}
+
+// SetReplayer 设置重放使用的重放器，未设置时不能重放
+func (c *Console) SetReplayer(r *replay.Replayer) {
+	c.replayer = r
+}
+
+// Write 实现 io.Writer 接口，按行记录到事件日志
+func (c *Console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	c.partial = append(c.partial, p...)
+	for {
+		i := bytes.IndexByte(c.partial, '\n')
+		if i < 0 {
+			break
+		}
+		c.logs = append(c.logs, string(c.partial[:i]))
+		c.partial = c.partial[i+1:]
+	}
+	if n := len(c.logs) - maxLogLines; n > 0 {
+		c.logs = append(c.logs[:0:0], c.logs[n:]...)
+	}
+	c.mu.Unlock()
+	c.notify()
+	return len(p), nil
+}
+
+// notify 请求重绘界面
+func (c *Console) notify() {
+	select {
+	case c.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// refresh 按过滤器重新获取流列表，光标在末尾时跟随最新的流
+func (c *Console) refresh() {
+	flows := c.store.List()
+	if c.filter != nil {
+		matched := flows[:0:0]
+		for _, f := range flows {
+			if c.filter.Match(f) {
+				matched = append(matched, f)
+			}
+		}
+		flows = matched
+	}
+	c.flows = flows
+	if c.follow || c.cursor >= len(flows) {
+		c.cursor = len(flows) - 1
+	}
+	c.cursor = max(c.cursor, 0)
+}
+
+// rows 返回列表区域的行数
+func (c *Console) rows() int {
+	return max(c.height-2, 1)
+}
+
+// selected 返回光标处的流
+func (c *Console) selected() *flow.Flow {
+	if c.cursor < 0 || c.cursor >= len(c.flows) {
+		return nil
+	}
+	return c.flows[c.cursor]
+}
+
+// moveCursor 移动列表光标
+func (c *Console) moveCursor(delta int) {
+	c.cursor = min(max(c.cursor+delta, 0), max(len(c.flows)-1, 0))
+	c.follow = c.cursor == len(c.flows)-1
+}
+
+// handleKey 处理按键，返回true表示退出
+func (c *Console) handleKey(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+
+	if c.prompt != nil {
+		c.promptKey(key)
+		return false
+	}
+	if key == "ctrl+c" {
+		return true
+	}
+	if c.view == viewHelp {
+		c.view = c.back
+		return false
+	}
+	if key == "?" {
+		c.back, c.view = c.view, viewHelp
+		return false
+	}
+	c.message = ""
+
+	switch c.view {
+	case viewList:
+		return c.listKey(key)
+	case viewDetail:
+		c.detailKey(key)
+	case viewIntercept:
+		c.interceptKey(key)
+	case viewLog:
+		if key == "q" || key == "esc" {
+			c.view = viewList
+		}
+	}
+	return false
+}
+
+// promptKey 处理输入框中的按键
+func (c *Console) promptKey(key string) {
+	p := c.prompt
+	switch key {
+	case "enter":
+		c.prompt = nil
+		p.submit(strings.TrimSpace(string(p.text)))
+	case "esc", "ctrl+c":
+		c.prompt = nil
+	case "backspace":
+		if len(p.text) > 0 {
+			p.text = p.text[:len(p.text)-1]
+		}
+	case "space":
+		p.text = append(p.text, ' ')
+	default:
+		if r := []rune(key); len(r) == 1 {
+			p.text = append(p.text, r[0])
+		}
+	}
+}
+
+// listKey 处理流列表中的按键
+func (c *Console) listKey(key string) bool {
+	switch key {
+	case "q":
+		return true
+	case "up", "k":
+		c.moveCursor(-1)
+	case "down", "j":
+		c.moveCursor(1)
+	case "pgup":
+		c.moveCursor(-c.rows())
+	case "pgdn", "space":
+		c.moveCursor(c.rows())
+	case "home", "g":
+		c.moveCursor(-len(c.flows))
+	case "end", "G":
+		c.moveCursor(len(c.flows))
+	case "enter":
+		if f := c.selected(); f != nil {
+			c.current, c.tab, c.scroll = f, tabRequest, 0
+			c.view = viewDetail
+		}
+	case "f":
+		c.prompt = &prompt{label: "Filter: ", text: []rune(c.filterText), submit: c.setFilter}
+	case "i":
+		c.interceptPrompt()
+	case "I":
+		c.view, c.pending = viewIntercept, 0
+	case "r":
+		c.replay(c.selected())
+	case "z":
+		c.store.Clear()
+		c.refresh()
+		c.message = "Cleared flow list"
+	case "e":
+		c.view = viewLog
+	}
+	return false
+}
+
+// detailKey 处理详情视图中的按键
+func (c *Console) detailKey(key string) {
+	switch key {
+	case "q", "esc":
+		c.view = viewList
+	case "up", "k":
+		c.scroll = max(c.scroll-1, 0)
+	case "down", "j":
+		c.scroll++
+	case "pgup":
+		c.scroll = max(c.scroll-c.rows(), 0)
+	case "pgdn", "space":
+		c.scroll += c.rows()
+	case "home", "g":
+		c.scroll = 0
+	case "tab", "right", "l":
+		c.tab, c.scroll = (c.tab+1)%tabCount, 0
+	case "left", "h":
+		c.tab, c.scroll = (c.tab+tabCount-1)%tabCount, 0
+	case "r":
+		c.replay(c.current)
+	}
+}
+
+// interceptKey 处理拦截视图中的按键
+func (c *Console) interceptKey(key string) {
+	if c.breakpoints == nil {
+		if key == "q" || key == "esc" {
+			c.view = viewList
+		}
+		return
+	}
+	pending := c.breakpoints.Pending()
+	c.pending = min(c.pending, max(len(pending)-1, 0))
+	switch key {
+	case "q", "esc":
+		c.view = viewList
+	case "up", "k":
+		c.pending = max(c.pending-1, 0)
+	case "down", "j":
+		c.pending = min(c.pending+1, max(len(pending)-1, 0))
+	case "a":
+		if c.pending < len(pending) {
+			c.decide(pending[c.pending], breakpoint.DecisionResume)
+		}
+	case "A":
+		for _, p := range pending {
+			c.decide(p, breakpoint.DecisionResume)
+		}
+	case "x":
+		if c.pending < len(pending) {
+			c.decide(pending[c.pending], breakpoint.DecisionAbort)
+		}
+	case "i":
+		c.interceptPrompt()
+	case "d":
+		c.prompt = &prompt{label: "Delete intercept rule: ", submit: func(id string) {
+			if err := c.breakpoints.RemoveRule(id); err != nil {
+				c.message = fmt.Sprintf("No intercept rule %q", id)
+				return
+			}
+			c.message = "Deleted intercept rule " + id
+		}}
+	}
+}
+
+// interceptPrompt 提示输入新的断点规则
+func (c *Console) interceptPrompt() {
+	if c.breakpoints == nil {
+		c.message = "Interception is not available"
+		return
+	}
+	c.prompt = &prompt{label: "Intercept (request|response:[METHOD ]host[/path]): ", submit: func(s string) {
+		if s == "" {
+			return
+		}
+		phase, match, err := breakpoint.ParseRule(s)
+		if err != nil {
+			c.message = err.Error()
+			return
+		}
+		rule := c.breakpoints.AddRule(phase, match)
+		c.message = fmt.Sprintf("Added intercept rule %s: %s %s", rule.ID, phase, match)
+	}}
+}
+
+// decide 继续或中止暂停的流
+func (c *Console) decide(p *breakpoint.Pending, d breakpoint.Decision) {
+	var err error
+	if d == breakpoint.DecisionAbort {
+		err = c.breakpoints.Abort(p.ID)
+	} else {
+		err = c.breakpoints.Resume(p.ID, nil)
+	}
+	if err != nil {
+		c.message = err.Error()
+		return
+	}
+	c.message = fmt.Sprintf("%s %s", d, requestLine(p.Flow))
+}
+
+// setFilter 设置列表过滤表达式，空表达式显示所有流
+func (c *Console) setFilter(expr string) {
+	if expr == "" {
+		c.filterText, c.filter = "", nil
+		c.refresh()
+		return
+	}
+	fl, err := filter.Compile(expr)
+	if err != nil {
+		c.message = err.Error()
+		return
+	}
+	c.filterText, c.filter = expr, fl
+	c.follow = true
+	c.refresh()
+}
+
+// replay 在后台重放流，完成后在状态栏显示结果
+func (c *Console) replay(f *flow.Flow) {
+	if f == nil {
+		return
+	}
+	if c.replayer == nil {
+		c.message = "Replay is not available"
+		return
+	}
+	c.message = "Replaying " + requestLine(f)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		result, err := c.replayer.Replay(ctx, f, nil)
+		c.mu.Lock()
+		if err != nil {
+			c.message = err.Error()
+		} else {
+			c.message = fmt.Sprintf("Replayed as flow %s: %s", result.FlowID, result.Response.Status)
+		}
+		c.mu.Unlock()
+		c.notify()
+	}()
+}
+
+// requestLine 返回流的请求行
+func requestLine(f *flow.Flow) string {
+	if f.Request == nil {
+		return f.ID
+	}
+	return f.Request.Method + " " + f.Request.URL
+}
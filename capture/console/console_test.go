@@ -0,0 +1,266 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package console
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+var ansi = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+func newFlow(id, rawURL string, status int, body string) *flow.Flow {
+	f := flow.New()
+	f.ID = id
+	f.Request = &flow.Request{Method: "GET", URL: rawURL, Proto: "HTTP/1.1", Header: http.Header{"Accept": {"*/*"}}}
+	f.Response = &flow.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       []byte(body),
+	}
+	f.EndTime = f.StartTime.Add(12 * time.Millisecond)
+	return f
+}
+
+func newConsole(flows int, bp *breakpoint.Manager) (*Console, *flow.Store) {
+	store := flow.NewStore()
+	for i := 0; i < flows; i++ {
+		store.Add(newFlow(fmt.Sprintf("f%d", i), fmt.Sprintf("https://api.example.com/items/%d", i), 200+i%4*100, "line1\nline2"))
+	}
+	c := New(store, bp)
+	c.resize(100, 10)
+	return c, store
+}
+
+// screen 返回去掉颜色的屏幕内容
+func screen(c *Console) string {
+	return ansi.ReplaceAllString(strings.Join(c.render(), "\n"), "")
+}
+
+func press(c *Console, keys ...string) bool {
+	for _, k := range keys {
+		if c.handleKey(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// --- 测试代码 ---
+func TestParseKeys(t *testing.T) {
+	require.Equal(t, []string{"up", "down", "j", "enter"}, parseKeys([]byte("\x1b[A\x1b[Bj\r")))
+	require.Equal(t, []string{"esc"}, parseKeys([]byte("\x1b")))
+	require.Equal(t, []string{"pgup", "pgdn", "space", "backspace", "ctrl+c", "tab"}, parseKeys([]byte("\x1b[5~\x1b[6~ \x7f\x03\t")))
+	// 不认识的序列被忽略
+	require.Equal(t, []string{"a"}, parseKeys([]byte("\x1b[1;5Pa")))
+	require.Equal(t, []string{"中", "q"}, parseKeys([]byte("中q")))
+}
+
+func TestConsole_List(t *testing.T) {
+	c, store := newConsole(20, nil)
+
+	// 默认跟随最新的流
+	out := screen(c)
+	require.Contains(t, out, "20 flows")
+	require.Contains(t, out, "> ")
+	require.Contains(t, out, "/items/19")
+	require.NotContains(t, out, "/items/0\n")
+	require.Len(t, c.render(), 10)
+
+	press(c, "g")
+	out = screen(c)
+	require.Contains(t, out, "> "+listLine(c.flows[0])[:8])
+	require.Equal(t, 0, c.cursor)
+	require.Contains(t, out, "/items/0")
+	require.NotContains(t, out, "/items/19")
+
+	press(c, "j", "j", "down")
+	require.Equal(t, 3, c.cursor)
+	press(c, "k")
+	require.Equal(t, 2, c.cursor)
+	press(c, "pgdn")
+	require.Equal(t, 10, c.cursor)
+
+	// 光标不在末尾时新流不会移动光标
+	store.Add(newFlow("new", "https://api.example.com/new", 200, ""))
+	press(c, "j")
+	require.Equal(t, 11, c.cursor)
+	press(c, "G")
+	require.Equal(t, "new", c.selected().ID)
+	store.Add(newFlow("newer", "https://api.example.com/newer", 200, ""))
+	screen(c)
+	require.Equal(t, "newer", c.selected().ID)
+
+	require.True(t, press(c, "q"))
+}
+
+func TestConsole_Filter(t *testing.T) {
+	c, _ := newConsole(8, nil)
+
+	press(c, "f")
+	require.Contains(t, screen(c), "Filter: _")
+	press(c, strings.Split("status >= 400", "")...)
+	press(c, "backspace", "0", "enter")
+	require.Equal(t, "status >= 400", c.filterText)
+	out := screen(c)
+	require.Contains(t, out, "4 flows")
+	require.Contains(t, out, "filter: status >= 400")
+
+	// 无效的表达式保留原过滤器
+	press(c, "f", "backspace", "backspace", "backspace", "=", "enter")
+	require.Equal(t, "status >= 400", c.filterText)
+	require.NotEmpty(t, c.message)
+
+	// ESC 取消输入
+	press(c, "f", "x", "esc")
+	require.Nil(t, c.prompt)
+	require.Equal(t, "status >= 400", c.filterText)
+
+	// 清空过滤器
+	press(c, "f")
+	for range c.filterText {
+		press(c, "backspace")
+	}
+	press(c, "enter")
+	require.Contains(t, screen(c), "8 flows")
+}
+
+func TestConsole_Detail(t *testing.T) {
+	c, _ := newConsole(3, nil)
+	c.resize(100, 30)
+	c.flows[2].Tag("slow")
+
+	press(c, "enter")
+	out := screen(c)
+	require.Contains(t, out, "[Request]")
+	require.Contains(t, out, "GET https://api.example.com/items/2 HTTP/1.1")
+	require.Contains(t, out, "Accept: */*")
+
+	press(c, "tab")
+	out = screen(c)
+	require.Contains(t, out, "[Response]")
+	require.Contains(t, out, "HTTP/1.1 400 Bad Request")
+	require.Contains(t, out, "Content-Type: text/plain")
+	require.Contains(t, out, "line1\nline2")
+
+	press(c, "tab")
+	out = screen(c)
+	require.Contains(t, out, "ID:          f2")
+	require.Contains(t, out, "Tags:        slow")
+
+	press(c, "left", "left")
+	require.Equal(t, tabRequest, c.tab)
+	press(c, "q")
+	require.Equal(t, viewList, c.view)
+}
+
+func TestConsole_BinaryBody(t *testing.T) {
+	lines := bodyLines(http.Header{}, []byte{0, 1, 2, 'A'})
+	require.Len(t, lines, 1)
+	require.Contains(t, lines[0], "00 01 02 41")
+
+	lines = bodyLines(http.Header{"Content-Encoding": {"br"}}, []byte("x"))
+	require.Contains(t, lines[0], "unsupported content encoding")
+	require.Equal(t, "x", lines[1])
+}
+
+func TestConsole_Intercept(t *testing.T) {
+	bp := breakpoint.NewManager()
+	c, _ := newConsole(1, bp)
+
+	press(c, "i")
+	press(c, strings.Split("request:api.example.com", "")...)
+	press(c, "enter")
+	require.Len(t, bp.Rules(), 1)
+	require.Contains(t, c.message, "Added intercept rule 1")
+
+	// 暂停两个流
+	results := make(chan breakpoint.Decision, 2)
+	for _, id := range []string{"p1", "p2"} {
+		f := newFlow(id, "https://api.example.com/"+id, 200, "")
+		go func() {
+			d, _ := bp.Pause(context.Background(), breakpoint.PhaseRequest, f)
+			results <- d
+		}()
+	}
+	require.Eventually(t, func() bool { return len(bp.Pending()) == 2 }, time.Second, 10*time.Millisecond)
+	require.Contains(t, screen(c), "Intercepted request GET https://api.example.com/")
+	require.Contains(t, screen(c), "2 intercepted")
+
+	press(c, "I")
+	out := screen(c)
+	require.Contains(t, out, "Intercepted flows")
+	require.Contains(t, out, "request:api.example.com")
+
+	press(c, "x")
+	require.Equal(t, breakpoint.DecisionAbort, <-results)
+	press(c, "a")
+	require.Equal(t, breakpoint.DecisionResume, <-results)
+	require.Empty(t, bp.Pending())
+	require.Contains(t, screen(c), "(none)")
+
+	press(c, "d", "1", "enter")
+	require.Empty(t, bp.Rules())
+	press(c, "d", "9", "enter")
+	require.Contains(t, c.message, `No intercept rule "9"`)
+
+	press(c, "esc")
+	require.Equal(t, viewList, c.view)
+}
+
+func TestConsole_NoIntercept(t *testing.T) {
+	c, _ := newConsole(1, nil)
+	press(c, "i")
+	require.Nil(t, c.prompt)
+	require.Equal(t, "Interception is not available", c.message)
+	press(c, "r")
+	require.Equal(t, "Replay is not available", c.message)
+}
+
+func TestConsole_LogAndHelp(t *testing.T) {
+	c, _ := newConsole(1, nil)
+	c.resize(100, 30)
+	fmt.Fprintf(c, "first line\nsecond ")
+	fmt.Fprintf(c, "line\npartial")
+
+	press(c, "e")
+	out := screen(c)
+	require.Contains(t, out, "first line")
+	require.Contains(t, out, "second line")
+	require.NotContains(t, out, "partial")
+
+	press(c, "?")
+	require.Contains(t, screen(c), "Intercepted flows")
+	press(c, "x")
+	require.Equal(t, viewLog, c.view)
+	press(c, "q")
+	require.Equal(t, viewList, c.view)
+
+	press(c, "z")
+	require.Contains(t, screen(c), "0 flows")
+	require.True(t, press(c, "ctrl+c"))
+}
+
+func TestTruncate(t *testing.T) {
+	require.Equal(t, "abc", truncate("abc", 5))
+	require.Equal(t, "ab…", truncate("abcdef", 3))
+	require.Equal(t, "ab", truncate("a\x1bb", 5))
+	require.Equal(t, "ab   ", pad("ab", 5))
+	require.Equal(t, "1.5k", humanSize(1536))
+	require.Equal(t, "12ms", duration(12*time.Millisecond))
+}
@@ -0,0 +1,468 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package console
+
+import (
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// ANSI 控制序列
+const (
+	reverse = "\x1b[7m"
+	bold    = "\x1b[1m"
+	red     = "\x1b[31m"
+	yellow  = "\x1b[33m"
+	cyan    = "\x1b[36m"
+	reset   = "\x1b[0m"
+)
+
+// maxHexDump 详情视图中二进制内容显示的最大字节数
+const maxHexDump = 4096
+
+// help 帮助界面的内容
+var help = []string{
+	"Flow list",
+	"  up/k down/j   move        pgup/pgdn  page        g/G  first/last",
+	"  enter         view flow   f          filter      r    replay",
+	"  i             intercept   I          intercepted flows",
+	"  z             clear list  e          event log   q    quit",
+	"",
+	"Flow detail",
+	"  tab/left/right  switch tab   up/down/pgup/pgdn  scroll",
+	"  r               replay       q/esc              back",
+	"",
+	"Intercepted flows",
+	"  a  resume      A  resume all   x  abort",
+	"  i  add rule    d  delete rule  q  back",
+	"",
+	"Filters use the capture filter syntax, e.g. host == api.example.com && status >= 400",
+	"Intercept rules use the breakpoint syntax, e.g. request:POST api.example.com/v1",
+	"",
+	"Press any key to continue",
+}
+
+// render 返回当前界面的所有行，行数等于终端高度
+func (c *Console) render() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+
+	var body []string
+	switch c.view {
+	case viewList:
+		body = c.renderList()
+	case viewDetail:
+		body = c.renderDetail()
+	case viewIntercept:
+		body = c.renderIntercept()
+	case viewLog:
+		body = truncateAll(tail(c.logs, c.rows()), c.width)
+	case viewHelp:
+		body = truncateAll(help, c.width)
+	}
+
+	lines := make([]string, 0, c.height)
+	lines = append(lines, reverse+pad(c.title(), c.width)+reset)
+	for i := 0; i < c.rows(); i++ {
+		if i < len(body) {
+			lines = append(lines, body[i])
+		} else {
+			lines = append(lines, "")
+		}
+	}
+	lines = append(lines, c.status())
+	return lines
+}
+
+// title 返回标题栏
+func (c *Console) title() string {
+	parts := []string{"sniffy", fmt.Sprintf("%d flows", len(c.flows))}
+	if c.filterText != "" {
+		parts = append(parts, "filter: "+c.filterText)
+	}
+	if c.breakpoints != nil {
+		if n := len(c.breakpoints.Rules()); n > 0 {
+			parts = append(parts, fmt.Sprintf("intercept: %d rules", n))
+		}
+		if n := len(c.breakpoints.Pending()); n > 0 {
+			parts = append(parts, fmt.Sprintf("%d intercepted", n))
+		}
+	}
+	return " " + strings.Join(parts, " | ")
+}
+
+// status 返回底部状态栏：输入框、消息或按键提示
+func (c *Console) status() string {
+	switch {
+	case c.prompt != nil:
+		return truncate(c.prompt.label+string(c.prompt.text)+"_", c.width)
+	case c.message != "":
+		return truncate(c.message, c.width)
+	}
+	hints := map[view]string{
+		viewList:      "enter:view f:filter i:intercept I:intercepted r:replay e:log ?:help q:quit",
+		viewDetail:    "tab:switch r:replay q:back ?:help",
+		viewIntercept: "a:resume A:resume all x:abort i:add rule d:delete rule q:back",
+		viewLog:       "q:back",
+		viewHelp:      "",
+	}
+	return cyan + truncate(hints[c.view], c.width) + reset
+}
+
+// renderList 返回流列表，保持光标可见
+func (c *Console) renderList() []string {
+	rows := c.rows()
+	if c.cursor < c.offset {
+		c.offset = c.cursor
+	}
+	if c.cursor >= c.offset+rows {
+		c.offset = c.cursor - rows + 1
+	}
+	c.offset = max(min(c.offset, len(c.flows)-rows), 0)
+
+	var lines []string
+	for i := c.offset; i < len(c.flows) && i < c.offset+rows; i++ {
+		f := c.flows[i]
+		line := truncate(listLine(f), c.width-2)
+		if i == c.cursor {
+			lines = append(lines, reverse+"> "+pad(line, c.width-2)+reset)
+			continue
+		}
+		lines = append(lines, colorize(f, "  "+line))
+	}
+	return lines
+}
+
+// listLine 返回列表中一条流的文本
+func listLine(f *flow.Flow) string {
+	status := "   "
+	size := ""
+	switch {
+	case f.Error != "":
+		status = "ERR"
+	case f.Response != nil:
+		status = fmt.Sprint(f.Response.StatusCode)
+		size = humanSize(int(f.Response.BodyLen()))
+	}
+	method, url := "", ""
+	if f.Request != nil {
+		method, url = f.Request.Method, f.Request.URL
+	}
+	line := fmt.Sprintf("%s %-7s %s %7s %6s %s", f.StartTime.Format("15:04:05"), method, status, size, duration(f.Duration()), url)
+	if len(f.Tags) > 0 {
+		line += " [" + strings.Join(f.Tags, ",") + "]"
+	}
+	if f.Starred {
+		line += " *"
+	}
+	return line
+}
+
+// colorize 按状态码为列表行着色
+func colorize(f *flow.Flow, line string) string {
+	switch {
+	case f.Error != "" || (f.Response != nil && f.Response.StatusCode >= 500):
+		return red + line + reset
+	case f.Response != nil && f.Response.StatusCode >= 400:
+		return yellow + line + reset
+	}
+	return line
+}
+
+// renderDetail 返回详情视图当前标签页的内容
+func (c *Console) renderDetail() []string {
+	f := c.current
+	tabs := []string{"Request", "Response", "Detail"}
+	var header []string
+	for i, name := range tabs {
+		if i == c.tab {
+			name = bold + "[" + name + "]" + reset
+		} else {
+			name = " " + name + " "
+		}
+		header = append(header, name)
+	}
+	lines := []string{strings.Join(header, " "), ""}
+
+	var content []string
+	switch c.tab {
+	case tabRequest:
+		if r := f.Request; r != nil {
+			content = append(content, fmt.Sprintf("%s %s %s", r.Method, r.URL, r.Proto))
+			content = append(content, headerLines(r.Header)...)
+			content = append(content, "")
+			content = append(content, bodyLines(r.Header, r.Body)...)
+		}
+	case tabResponse:
+		if r := f.Response; r != nil {
+			content = append(content, fmt.Sprintf("%s %s", r.Proto, r.Status))
+			content = append(content, headerLines(r.Header)...)
+			content = append(content, "")
+			content = append(content, bodyLines(r.Header, r.Body)...)
+		} else if f.Error != "" {
+			content = append(content, f.Error)
+		} else {
+			content = append(content, "(no response)")
+		}
+	case tabInfo:
+		content = infoLines(f)
+	}
+
+	// 内容为纯文本，截断后再着色，第一行为请求行或状态行
+	rows := c.rows() - len(lines)
+	c.scroll = max(min(c.scroll, len(content)-rows), 0)
+	for i := c.scroll; i < len(content) && len(lines) < c.rows(); i++ {
+		line := truncate(content[i], c.width)
+		if i == 0 && c.tab != tabInfo {
+			line = bold + line + reset
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// infoLines 返回流的元数据
+func infoLines(f *flow.Flow) []string {
+	lines := []string{
+		"ID:          " + f.ID,
+		"Client:      " + f.ClientAddr,
+		"Server:      " + f.ServerAddr,
+		"Started:     " + f.StartTime.Format(time.RFC3339Nano),
+		"Duration:    " + f.Duration().String(),
+		fmt.Sprintf("Intercepted: %t", f.Intercepted),
+	}
+	if f.PeerAddr != "" {
+		lines = append(lines, "Peer:        "+f.PeerAddr)
+	}
+	if phases := timingPhases(f.Timings); phases != "" {
+		lines = append(lines, "Timings:     "+phases)
+	}
+	if f.Process != nil {
+		lines = append(lines, fmt.Sprintf("Process:     %s (%d)", f.Process.Name, f.Process.PID))
+		if f.Process.Cgroup != "" {
+			lines = append(lines, "Cgroup:      "+f.Process.Cgroup)
+		}
+	}
+	if f.Fingerprints != nil {
+		lines = append(lines, "JA3:         "+f.Fingerprints.JA3, "JA4:         "+f.Fingerprints.JA4)
+	}
+	if f.Responder != "" {
+		lines = append(lines, "Responder:   "+f.Responder)
+	}
+	if f.ReplayOf != "" {
+		lines = append(lines, "Replay of:   "+f.ReplayOf)
+	}
+	if f.TraceID != "" {
+		lines = append(lines, "Trace ID:    "+f.TraceID)
+	}
+	if f.CorrelationID != "" {
+		lines = append(lines, "Correlation: "+f.CorrelationID)
+	}
+	if len(f.Tags) > 0 {
+		lines = append(lines, "Tags:        "+strings.Join(f.Tags, ", "))
+	}
+	if f.Starred {
+		lines = append(lines, "Starred:     yes")
+	}
+	if f.Marker != "" {
+		lines = append(lines, "Marker:      "+f.Marker)
+	}
+	if f.Comment != "" {
+		lines = append(lines, "Comment:     "+f.Comment)
+	}
+	if f.Error != "" {
+		lines = append(lines, "Error:       "+f.Error)
+	}
+	if f.ErrorCode != "" {
+		lines = append(lines, "Error code:  "+string(f.ErrorCode))
+	}
+	for _, v := range f.Violations {
+		lines = append(lines, "Violation:   "+violation(v))
+	}
+	for _, c := range f.Credentials {
+		lines = append(lines, "Credential:  "+credential(c))
+	}
+	return lines
+}
+
+// renderIntercept 返回暂停中的流和断点规则
+func (c *Console) renderIntercept() []string {
+	if c.breakpoints == nil {
+		return []string{"Interception is not available"}
+	}
+	pending := c.breakpoints.Pending()
+	c.pending = min(c.pending, max(len(pending)-1, 0))
+
+	lines := []string{bold + "Intercepted flows" + reset}
+	if len(pending) == 0 {
+		lines = append(lines, "  (none)")
+	}
+	for i, p := range pending {
+		line := truncate(fmt.Sprintf("%-8s %5s  %s", p.Phase, duration(time.Since(p.PausedAt)), requestLine(p.Flow)), c.width-2)
+		if i == c.pending {
+			lines = append(lines, reverse+"> "+pad(line, c.width-2)+reset)
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+
+	lines = append(lines, "", bold+"Intercept rules"+reset)
+	rules := c.breakpoints.Rules()
+	if len(rules) == 0 {
+		lines = append(lines, "  (none)")
+	}
+	for _, r := range rules {
+		lines = append(lines, truncate(fmt.Sprintf("  %s  %s:%s", r.ID, r.Phase, r.Match), c.width))
+	}
+	return lines
+}
+
+// headerLines 返回按名称排序的头部
+func headerLines(h http.Header) []string {
+	var lines []string
+	for _, name := range slices.Sorted(maps.Keys(h)) {
+		for _, v := range h[name] {
+			lines = append(lines, name+": "+v)
+		}
+	}
+	return lines
+}
+
+// bodyLines 返回解码后的内容，二进制内容显示为十六进制
+func bodyLines(header http.Header, body []byte) []string {
+	if len(body) == 0 {
+		return nil
+	}
+	var lines []string
+	decoded, _, err := flow.DecodeBody(header, body)
+	if err != nil {
+		lines = append(lines, "("+err.Error()+")")
+		decoded = body
+	}
+	if utf8.Valid(decoded) && !slices.Contains(decoded, 0) {
+		text := strings.ReplaceAll(string(decoded), "\t", "    ")
+		return append(lines, strings.Split(strings.TrimRight(text, "\r\n"), "\n")...)
+	}
+	dump := decoded[:min(len(decoded), maxHexDump)]
+	lines = append(lines, strings.Split(strings.TrimRight(hex.Dump(dump), "\n"), "\n")...)
+	if len(decoded) > len(dump) {
+		lines = append(lines, fmt.Sprintf("... %d more bytes", len(decoded)-len(dump)))
+	}
+	return lines
+}
+
+// tail 返回最后 n 行
+func tail(lines []string, n int) []string {
+	return lines[max(len(lines)-n, 0):]
+}
+
+// truncate 将文本截断到 width 个字符，去掉控制字符
+func truncate(s string, width int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:width-1]) + "…"
+}
+
+// truncateAll 截断每一行
+func truncateAll(lines []string, width int) []string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = truncate(line, width)
+	}
+	return out
+}
+
+// pad 用空格将文本补齐到 width 个字符
+func pad(s string, width int) string {
+	s = truncate(s, width)
+	if n := width - utf8.RuneCountInString(s); n > 0 {
+		s += strings.Repeat(" ", n)
+	}
+	return s
+}
+
+// humanSize 返回易读的字节数
+func humanSize(n int) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%db", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1fk", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%.1fm", float64(n)/(1024*1024))
+	}
+}
+
+// duration 返回易读的持续时间
+func duration(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return ""
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	default:
+		return d.Truncate(time.Second).String()
+	}
+}
+
+// timingPhases 返回已记录阶段的耗时，例如 "dns 1.2ms, connect 3ms, wait 20ms"
+func timingPhases(t *flow.Timings) string {
+	if t == nil {
+		return ""
+	}
+	var parts []string
+	add := func(name string, start, end time.Time) {
+		if !start.IsZero() && !end.IsZero() {
+			parts = append(parts, name+" "+end.Sub(start).Round(100*time.Microsecond).String())
+		}
+	}
+	add("client tls", t.ClientTLSStart, t.ClientTLSDone)
+	add("dns", t.DNSStart, t.DNSDone)
+	add("connect", t.ConnectStart, t.ConnectDone)
+	add("tls", t.TLSStart, t.TLSDone)
+	add("wait", t.RequestSent, t.FirstByte)
+	add("receive", t.FirstByte, t.ResponseDone)
+	return strings.Join(parts, ", ")
+}
+
+// credential 返回检测到的凭据的单行描述
+func credential(c *flow.Credential) string {
+	s := c.Kind + " " + c.Location + " " + c.Fingerprint
+	if c.Hint != "" {
+		s += " (" + c.Hint + ")"
+	}
+	return s
+}
+
+// violation 返回不符合API规范的问题的单行描述
+func violation(v *flow.Violation) string {
+	if v.Location == "" {
+		return v.Kind + ": " + v.Message
+	}
+	return v.Kind + " " + v.Location + ": " + v.Message
+}
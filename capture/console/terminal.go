@@ -0,0 +1,179 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package console
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// refreshInterval 没有事件时的重绘间隔，用于更新暂停时间和终端尺寸
+const refreshInterval = time.Second
+
+// keySequences 终端发送的转义序列
+var keySequences = map[string]string{
+	"\x1b[A":  "up",
+	"\x1b[B":  "down",
+	"\x1b[C":  "right",
+	"\x1b[D":  "left",
+	"\x1bOA":  "up",
+	"\x1bOB":  "down",
+	"\x1bOC":  "right",
+	"\x1bOD":  "left",
+	"\x1b[5~": "pgup",
+	"\x1b[6~": "pgdn",
+	"\x1b[H":  "home",
+	"\x1b[F":  "end",
+	"\x1b[1~": "home",
+	"\x1b[4~": "end",
+}
+
+// Run 在终端中运行界面，直到用户退出或ctx结束。
+// in 必须是终端，运行期间切换到原始模式和备用屏幕，返回前恢复
+func (c *Console) Run(ctx context.Context, in, out *os.File) error {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("console requires a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	io.WriteString(out, "\x1b[?1049h\x1b[?25l")
+	defer io.WriteString(out, "\x1b[?25h\x1b[?1049l")
+
+	// 读取goroutine在退出后仍阻塞在 Read 上，直到下一次按键或进程退出
+	input := make(chan []byte)
+	go func() {
+		defer close(input)
+		buf := make([]byte, 256)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case input <- append([]byte(nil), buf[:n]...):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	w := bufio.NewWriter(out)
+	for {
+		if width, height, err := term.GetSize(fd); err == nil {
+			c.resize(width, height)
+		}
+		c.draw(w)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case b, ok := <-input:
+			if !ok {
+				return nil
+			}
+			for _, key := range parseKeys(b) {
+				if c.handleKey(key) {
+					return nil
+				}
+			}
+		case <-c.redraw:
+		case <-ticker.C:
+		}
+	}
+}
+
+// resize 更新终端尺寸
+func (c *Console) resize(width, height int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.width, c.height = width, height
+}
+
+// draw 从左上角开始重绘整个屏幕
+func (c *Console) draw(w io.Writer) {
+	var sb strings.Builder
+	sb.WriteString("\x1b[H")
+	for i, line := range c.render() {
+		if i > 0 {
+			sb.WriteString("\r\n")
+		}
+		sb.WriteString(line)
+		sb.WriteString("\x1b[K")
+	}
+	sb.WriteString("\x1b[J")
+	io.WriteString(w, sb.String())
+}
+
+// parseKeys 将一次读取的输入拆分为按键名称，可打印字符保持原样
+func parseKeys(b []byte) []string {
+	var keys []string
+	s := string(b)
+	for len(s) > 0 {
+		if s[0] == 0x1b {
+			matched := false
+			for seq, name := range keySequences {
+				if strings.HasPrefix(s, seq) {
+					keys = append(keys, name)
+					s = s[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+			// 跳过不认识的CSI/SS3序列，其余情况为单独的 ESC
+			if len(s) > 1 && (s[1] == '[' || s[1] == 'O') {
+				s = strings.TrimLeft(s[2:], "0123456789;")
+				if len(s) > 0 {
+					s = s[1:]
+				}
+				continue
+			}
+			keys = append(keys, "esc")
+			s = s[1:]
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s)
+		switch r {
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case '\t':
+			keys = append(keys, "tab")
+		case 0x7f, 0x08:
+			keys = append(keys, "backspace")
+		case 0x03:
+			keys = append(keys, "ctrl+c")
+		case ' ':
+			keys = append(keys, "space")
+		default:
+			if r >= ' ' {
+				keys = append(keys, string(r))
+			}
+		}
+		s = s[size:]
+	}
+	return keys
+}
@@ -0,0 +1,304 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cookies
+
+import (
+	"cmp"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Action 时间线上的Cookie变化
+type Action string
+
+const (
+	// ActionSet 服务器通过 Set-Cookie 设置或修改 Cookie
+	ActionSet Action = "set"
+
+	// ActionDeleted 服务器通过过期的 Set-Cookie 删除 Cookie
+	ActionDeleted Action = "deleted"
+
+	// ActionSent 客户端发送了服务器没有设置过的值，例如由脚本设置或在捕获开始前已存在
+	ActionSent Action = "sent"
+)
+
+// SessionNames 常见的会话Cookie名，不区分大小写
+var SessionNames = []string{
+	"sid", "session", "sessionid", "session_id", "jsessionid", "phpsessid",
+	"asp.net_sessionid", "connect.sid", "laravel_session", "_session_id",
+}
+
+// Cookie 客户端当前持有的Cookie
+type Cookie struct {
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path,omitempty"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Expires  time.Time `json:"expires,omitzero"`
+	Secure   bool      `json:"secure,omitempty"`
+	HTTPOnly bool      `json:"http_only,omitempty"`
+	SameSite string    `json:"same_site,omitempty"`
+}
+
+// Event 时间线上的一次Cookie变化
+type Event struct {
+	Time   time.Time `json:"time"`
+	FlowID string    `json:"flow_id"`
+	Action Action    `json:"action"`
+	Cookie
+}
+
+// Timeline 一个客户端的Cookie变化和最后持有的Cookie
+type Timeline struct {
+	Client  string    `json:"client"`
+	Events  []*Event  `json:"events"`
+	Cookies []*Cookie `json:"cookies"`
+}
+
+// Session 携带同一会话Cookie值的流
+type Session struct {
+	Name    string    `json:"name"`
+	Value   string    `json:"value"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Clients []string  `json:"clients"`
+	Hosts   []string  `json:"hosts"`
+	Flows   []string  `json:"flows"`
+}
+
+// Request 返回请求携带的Cookie
+func Request(req *flow.Request) []*http.Cookie {
+	if req == nil {
+		return nil
+	}
+	return (&http.Request{Header: req.Header}).Cookies()
+}
+
+// Response 返回响应设置的Cookie
+func Response(resp *flow.Response) []*http.Cookie {
+	if resp == nil {
+		return nil
+	}
+	return (&http.Response{Header: resp.Header}).Cookies()
+}
+
+// Client 返回流所属的客户端，通过代理认证时为用户名，否则为客户端IP
+func Client(f *flow.Flow) string {
+	if f.ProxyUser != "" {
+		return f.ProxyUser
+	}
+	if host, _, err := net.SplitHostPort(f.ClientAddr); err == nil {
+		return host
+	}
+	return f.ClientAddr
+}
+
+// IsSessionName 判断Cookie名是否像会话Cookie
+func IsSessionName(name string) bool {
+	name = strings.ToLower(name)
+	return slices.Contains(SessionNames, name) || strings.Contains(name, "session") || strings.HasSuffix(name, "sessid")
+}
+
+// jarKey 区分同名Cookie的作用域
+type jarKey struct {
+	domain, path, name string
+}
+
+// Timelines 按时间顺序回放流中的 Cookie 和 Set-Cookie，返回每个客户端的时间线，client 不为空时只返回该客户端
+func Timelines(flows []*flow.Flow, client string) []*Timeline {
+	byClient := map[string]*Timeline{}
+	jars := map[string]map[jarKey]*Cookie{}
+	var order []string
+	for _, f := range sorted(flows) {
+		if f.Request == nil {
+			continue
+		}
+		c := Client(f)
+		if client != "" && c != client {
+			continue
+		}
+		t := byClient[c]
+		if t == nil {
+			t = &Timeline{Client: c, Events: []*Event{}}
+			byClient[c] = t
+			jars[c] = map[jarKey]*Cookie{}
+			order = append(order, c)
+		}
+		jar := jars[c]
+		host := requestHost(f.Request)
+
+		// 服务器未设置过的值说明Cookie来自客户端
+		for _, hc := range Request(f.Request) {
+			if known := lookup(jar, host, hc.Name); known != nil && known.Value == hc.Value {
+				continue
+			}
+			ck := &Cookie{Domain: host, Path: "/", Name: hc.Name, Value: hc.Value}
+			jar[jarKey{ck.Domain, ck.Path, ck.Name}] = ck
+			t.Events = append(t.Events, &Event{Time: f.StartTime, FlowID: f.ID, Action: ActionSent, Cookie: *ck})
+		}
+
+		at := f.EndTime
+		if at.IsZero() {
+			at = f.StartTime
+		}
+		for _, hc := range Response(f.Response) {
+			ck := newCookie(hc, host)
+			key := jarKey{ck.Domain, ck.Path, ck.Name}
+			if hc.MaxAge < 0 || !hc.Expires.IsZero() && hc.Expires.Before(at) {
+				delete(jar, key)
+				t.Events = append(t.Events, &Event{Time: at, FlowID: f.ID, Action: ActionDeleted, Cookie: *ck})
+				continue
+			}
+			if hc.MaxAge > 0 {
+				ck.Expires = at.Add(time.Duration(hc.MaxAge) * time.Second).UTC()
+			}
+			jar[key] = ck
+			t.Events = append(t.Events, &Event{Time: at, FlowID: f.ID, Action: ActionSet, Cookie: *ck})
+		}
+	}
+
+	out := make([]*Timeline, 0, len(order))
+	for _, c := range order {
+		t := byClient[c]
+		t.Cookies = make([]*Cookie, 0, len(jars[c]))
+		for _, ck := range jars[c] {
+			t.Cookies = append(t.Cookies, ck)
+		}
+		slices.SortFunc(t.Cookies, func(a, b *Cookie) int {
+			return cmp.Or(cmp.Compare(a.Domain, b.Domain), cmp.Compare(a.Name, b.Name), cmp.Compare(a.Path, b.Path))
+		})
+		out = append(out, t)
+	}
+	return out
+}
+
+// Sessions 按会话Cookie的值对流分组，name 为空时使用看起来像会话Cookie的名字。
+// 设置会话Cookie的响应所在的流归入它建立的会话，按会话开始的时间排序
+func Sessions(flows []*flow.Flow, name string) []*Session {
+	byKey := map[[2]string]*Session{}
+	var out []*Session
+	for _, f := range sorted(flows) {
+		n, v := SessionCookie(f, name)
+		if v == "" {
+			continue
+		}
+		key := [2]string{n, v}
+		s := byKey[key]
+		if s == nil {
+			s = &Session{Name: n, Value: v, Start: f.StartTime, Clients: []string{}, Hosts: []string{}}
+			byKey[key] = s
+			out = append(out, s)
+		}
+		s.Flows = append(s.Flows, f.ID)
+		for _, t := range []time.Time{f.StartTime, f.EndTime} {
+			if t.After(s.End) {
+				s.End = t
+			}
+		}
+		if c := Client(f); !slices.Contains(s.Clients, c) {
+			s.Clients = append(s.Clients, c)
+		}
+		if h := requestHost(f.Request); !slices.Contains(s.Hosts, h) {
+			s.Hosts = append(s.Hosts, h)
+		}
+	}
+	return out
+}
+
+// SessionCookie 返回流携带或设置的会话Cookie的名字和值，name 为空时使用看起来像会话Cookie的名字，请求中的值优先
+func SessionCookie(f *flow.Flow, name string) (string, string) {
+	match := func(n string) bool {
+		if name != "" {
+			return n == name
+		}
+		return IsSessionName(n)
+	}
+	for _, c := range Request(f.Request) {
+		if match(c.Name) && c.Value != "" {
+			return c.Name, c.Value
+		}
+	}
+	for _, c := range Response(f.Response) {
+		if match(c.Name) && c.Value != "" && c.MaxAge >= 0 {
+			return c.Name, c.Value
+		}
+	}
+	return "", ""
+}
+
+// lookup 返回作用于主机的同名Cookie，优先匹配更具体的域名
+func lookup(jar map[jarKey]*Cookie, host, name string) *Cookie {
+	var best *Cookie
+	for key, c := range jar {
+		if key.name != name || !domainMatch(host, key.domain) {
+			continue
+		}
+		if best == nil || len(c.Domain) > len(best.Domain) {
+			best = c
+		}
+	}
+	return best
+}
+
+// domainMatch 判断主机是否在Cookie的域内
+func domainMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// newCookie 转换 Set-Cookie，没有 Domain 属性时作用于响应的主机
+func newCookie(hc *http.Cookie, host string) *Cookie {
+	c := &Cookie{
+		Domain:   strings.TrimPrefix(strings.ToLower(hc.Domain), "."),
+		Path:     hc.Path,
+		Name:     hc.Name,
+		Value:    hc.Value,
+		Secure:   hc.Secure,
+		HTTPOnly: hc.HttpOnly,
+	}
+	if c.Domain == "" {
+		c.Domain = host
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if !hc.Expires.IsZero() {
+		c.Expires = hc.Expires.UTC()
+	}
+	switch hc.SameSite {
+	case http.SameSiteLaxMode:
+		c.SameSite = "Lax"
+	case http.SameSiteStrictMode:
+		c.SameSite = "Strict"
+	case http.SameSiteNoneMode:
+		c.SameSite = "None"
+	}
+	return c
+}
+
+// requestHost 返回请求的主机名，不含端口
+func requestHost(req *flow.Request) string {
+	host := req.Host
+	if u, err := url.Parse(req.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// sorted 返回按开始时间排序的流，不修改原切片
+func sorted(flows []*flow.Flow) []*flow.Flow {
+	out := slices.Clone(flows)
+	slices.SortStableFunc(out, func(a, b *flow.Flow) int { return a.StartTime.Compare(b.StartTime) })
+	return out
+}
@@ -0,0 +1,113 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package cookies
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+var start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newFlow 创建客户端 client 在第 n 秒发出的请求，cookie 为请求的 Cookie 头部，setCookies 为响应的 Set-Cookie
+func newFlow(id, client string, n int, rawURL, cookie string, setCookies ...string) *flow.Flow {
+	f := &flow.Flow{
+		ID:         id,
+		ClientAddr: client + ":50000",
+		StartTime:  start.Add(time.Duration(n) * time.Second),
+		EndTime:    start.Add(time.Duration(n)*time.Second + 100*time.Millisecond),
+		Request:    &flow.Request{Method: "GET", URL: rawURL, Header: http.Header{}},
+		Response:   &flow.Response{StatusCode: 200, Header: http.Header{}},
+	}
+	if cookie != "" {
+		f.Request.Header.Set("Cookie", cookie)
+	}
+	for _, c := range setCookies {
+		f.Response.Header.Add("Set-Cookie", c)
+	}
+	return f
+}
+
+// --- 测试代码 ---
+
+func TestTimelines(t *testing.T) {
+	flows := []*flow.Flow{
+		newFlow("2", "10.0.0.1", 1, "https://www.example.com/app", "sid=abc; theme=dark"),
+		newFlow("1", "10.0.0.1", 0, "https://example.com/login", "",
+			"sid=abc; Domain=.example.com; Path=/; Secure; HttpOnly; SameSite=Lax", "csrf=x; Max-Age=60"),
+		newFlow("3", "10.0.0.1", 2, "https://example.com/logout", "sid=abc", "sid=; Domain=example.com; Max-Age=0"),
+		newFlow("4", "10.0.0.2", 3, "https://example.com/", "sid=other"),
+	}
+	timelines := Timelines(flows, "")
+	require.Len(t, timelines, 2)
+
+	tl := timelines[0]
+	require.Equal(t, "10.0.0.1", tl.Client)
+	var got []string
+	for _, e := range tl.Events {
+		got = append(got, e.FlowID+" "+string(e.Action)+" "+e.Domain+" "+e.Name)
+	}
+	require.Equal(t, []string{
+		"1 set example.com sid",
+		"1 set example.com csrf",
+		"2 sent www.example.com theme",
+		"3 deleted example.com sid",
+	}, got)
+	sid := tl.Events[0]
+	require.True(t, sid.Secure)
+	require.True(t, sid.HTTPOnly)
+	require.Equal(t, "Lax", sid.SameSite)
+	require.Equal(t, start.Add(100*time.Millisecond), sid.Time)
+	require.Equal(t, start.Add(60*time.Second+100*time.Millisecond), tl.Events[1].Expires)
+
+	// 删除后只剩 csrf 和脚本设置的 theme
+	require.Len(t, tl.Cookies, 2)
+	require.Equal(t, "csrf", tl.Cookies[0].Name)
+	require.Equal(t, "theme", tl.Cookies[1].Name)
+
+	timelines = Timelines(flows, "10.0.0.2")
+	require.Len(t, timelines, 1)
+	require.Equal(t, ActionSent, timelines[0].Events[0].Action)
+}
+
+func TestSessions(t *testing.T) {
+	flows := []*flow.Flow{
+		newFlow("1", "10.0.0.1", 0, "https://example.com/login", "", "JSESSIONID=s1; Path=/"),
+		newFlow("2", "10.0.0.1", 1, "https://api.example.com/me", "JSESSIONID=s1; theme=dark"),
+		newFlow("3", "10.0.0.2", 2, "https://example.com/", "JSESSIONID=s2"),
+		newFlow("4", "10.0.0.1", 3, "https://example.com/logout", "JSESSIONID=s1", "JSESSIONID=; Max-Age=0"),
+		newFlow("5", "10.0.0.1", 4, "https://example.com/", "theme=dark"),
+	}
+	sessions := Sessions(flows, "")
+	require.Len(t, sessions, 2)
+	require.Equal(t, "JSESSIONID", sessions[0].Name)
+	require.Equal(t, "s1", sessions[0].Value)
+	require.Equal(t, []string{"1", "2", "4"}, sessions[0].Flows)
+	require.Equal(t, []string{"example.com", "api.example.com"}, sessions[0].Hosts)
+	require.Equal(t, []string{"10.0.0.1"}, sessions[0].Clients)
+	require.Equal(t, start, sessions[0].Start)
+	require.Equal(t, start.Add(3*time.Second+100*time.Millisecond), sessions[0].End)
+	require.Equal(t, []string{"3"}, sessions[1].Flows)
+
+	sessions = Sessions(flows, "theme")
+	require.Len(t, sessions, 1)
+	require.Equal(t, []string{"2", "5"}, sessions[0].Flows)
+}
+
+func TestIsSessionName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"PHPSESSID": true, "connect.sid": true, "my_app_session": true, "sid": true,
+		"theme": false, "_ga": false,
+	} {
+		require.Equal(t, want, IsSessionName(name), name)
+	}
+}
@@ -0,0 +1,561 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// ErrNoCommand 输入中没有 curl 命令
+var ErrNoCommand = errors.New("no curl command found")
+
+// shortOptions 单字母选项对应的长选项
+var shortOptions = map[byte]string{
+	'X': "request",
+	'H': "header",
+	'd': "data",
+	'b': "cookie",
+	'A': "user-agent",
+	'e': "referer",
+	'u': "user",
+	'r': "range",
+	'G': "get",
+	'I': "head",
+	'F': "form",
+	'T': "upload-file",
+	'K': "config",
+	'0': "http1.0",
+	'o': "output",
+	'x': "proxy",
+	'm': "max-time",
+	'w': "write-out",
+	'E': "cert",
+	'U': "proxy-user",
+	'c': "cookie-jar",
+	'D': "dump-header",
+	'C': "continue-at",
+	'Y': "speed-limit",
+	'y': "speed-time",
+	'z': "time-cond",
+	't': "telnet-option",
+	'P': "ftp-port",
+	'Q': "quote",
+}
+
+// valueOptions 需要参数的长选项，其他选项视为开关
+var valueOptions = map[string]bool{
+	"request": true, "header": true, "data": true, "data-ascii": true, "data-raw": true,
+	"data-binary": true, "data-urlencode": true, "json": true, "cookie": true, "user-agent": true,
+	"referer": true, "user": true, "range": true, "url": true, "form": true, "form-string": true,
+	"upload-file": true, "config": true,
+	"output": true, "proxy": true, "max-time": true, "connect-timeout": true, "write-out": true,
+	"cert": true, "key": true, "cacert": true, "capath": true, "cert-type": true, "key-type": true,
+	"pass": true, "resolve": true, "connect-to": true, "retry": true, "retry-delay": true,
+	"retry-max-time": true, "limit-rate": true, "proxy-user": true, "cookie-jar": true,
+	"dump-header": true, "continue-at": true, "speed-limit": true, "speed-time": true,
+	"time-cond": true, "telnet-option": true, "ftp-port": true, "quote": true, "interface": true,
+	"local-port": true, "max-redirs": true, "max-filesize": true, "ciphers": true, "tls-max": true,
+	"unix-socket": true, "abstract-unix-socket": true, "dns-servers": true, "preproxy": true,
+	"proxy-header": true, "noproxy": true, "oauth2-bearer": true, "aws-sigv4": true,
+	"trace": true, "trace-ascii": true, "stderr": true, "output-dir": true, "expect100-timeout": true,
+	"happy-eyeballs-timeout-ms": true, "keepalive-time": true, "request-target": true,
+}
+
+// unsupported 无法转换为单个请求的选项
+var unsupported = map[string]string{
+	"form":        "multipart forms are not supported",
+	"form-string": "multipart forms are not supported",
+	"upload-file": "uploading files is not supported",
+	"config":      "reading options from a config file is not supported",
+}
+
+// Parse 将一条 curl 命令（例如浏览器开发者工具中“复制为 cURL (bash)”的结果）转换为请求。
+// 只使用决定请求内容的选项，输出、超时、代理等选项被忽略；需要读取本地文件的选项返回错误
+func Parse(cmd string) (*flow.Request, error) {
+	commands, err := split(cmd)
+	if err != nil {
+		return nil, err
+	}
+	switch len(commands) {
+	case 0:
+		return nil, ErrNoCommand
+	case 1:
+		return parseArgs(commands[0])
+	}
+	return nil, fmt.Errorf("expected a single curl command, got %d", len(commands))
+}
+
+// Read 读取每行一条（可以用反斜杠续行）的 curl 命令，转换为只有请求的流
+func Read(r io.Reader) ([]*flow.Flow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	commands, err := split(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(commands) == 0 {
+		return nil, ErrNoCommand
+	}
+	flows := make([]*flow.Flow, 0, len(commands))
+	for i, args := range commands {
+		req, err := parseArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("command %d: %w", i+1, err)
+		}
+		f := flow.New()
+		f.Request = req
+		flows = append(flows, f)
+	}
+	return flows, nil
+}
+
+// request 解析过程中的请求
+type request struct {
+	method     string
+	header     http.Header
+	data       []string
+	get        bool
+	head       bool
+	json       bool
+	compressed bool
+	proto      string
+}
+
+func parseArgs(args []string) (*flow.Request, error) {
+	if name := path.Base(strings.ReplaceAll(args[0], `\`, "/")); name != "curl" && name != "curl.exe" {
+		return nil, fmt.Errorf("not a curl command: %q", args[0])
+	}
+	r := &request{header: http.Header{}, proto: "HTTP/1.1"}
+	var urls []string
+	options := true
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !options || arg == "-" || !strings.HasPrefix(arg, "-") {
+			urls = append(urls, arg)
+			continue
+		}
+		if arg == "--" {
+			options = false
+			continue
+		}
+
+		var names []string
+		var value string
+		hasValue := false
+		if strings.HasPrefix(arg, "--") {
+			names = []string{strings.TrimPrefix(arg, "--")}
+		} else {
+			// 合并的短选项，例如 -sSL 或 -XPOST
+			for j := 1; j < len(arg); j++ {
+				name, ok := shortOptions[arg[j]]
+				if !ok {
+					continue
+				}
+				names = append(names, name)
+				if valueOptions[name] {
+					if j+1 < len(arg) {
+						value, hasValue = arg[j+1:], true
+					}
+					break
+				}
+			}
+		}
+		for _, name := range names {
+			if !valueOptions[name] {
+				r.flag(name)
+				continue
+			}
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("option %s requires a value", arg)
+				}
+				i++
+				value = args[i]
+			}
+			if name == "url" {
+				urls = append(urls, value)
+				continue
+			}
+			if err := r.option(name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch len(urls) {
+	case 0:
+		return nil, errors.New("missing URL")
+	case 1:
+	default:
+		return nil, errors.New("multiple URLs are not supported")
+	}
+	return r.build(urls[0])
+}
+
+// flag 处理开关选项，未知的选项被忽略
+func (r *request) flag(name string) {
+	switch name {
+	case "get":
+		r.get = true
+	case "head":
+		r.head = true
+	case "compressed":
+		r.compressed = true
+	case "http1.0":
+		r.proto = "HTTP/1.0"
+	case "http1.1":
+		r.proto = "HTTP/1.1"
+	case "http2", "http2-prior-knowledge":
+		r.proto = "HTTP/2.0"
+	}
+}
+
+// option 处理带参数的选项，与请求无关的选项被忽略
+func (r *request) option(name, value string) error {
+	if msg, ok := unsupported[name]; ok {
+		return errors.New(msg)
+	}
+	switch name {
+	case "request":
+		r.method = value
+	case "header":
+		r.addHeader(value)
+	case "data", "data-ascii", "data-binary", "json":
+		if strings.HasPrefix(value, "@") {
+			return errors.New("reading request data from a file is not supported")
+		}
+		r.data = append(r.data, value)
+		r.json = r.json || name == "json"
+	case "data-raw":
+		r.data = append(r.data, value)
+	case "data-urlencode":
+		encoded, err := urlencode(value)
+		if err != nil {
+			return err
+		}
+		r.data = append(r.data, encoded)
+	case "cookie":
+		if !strings.Contains(value, "=") {
+			return errors.New("reading cookies from a file is not supported")
+		}
+		if old := r.header.Get("Cookie"); old != "" {
+			value = old + "; " + value
+		}
+		r.header.Set("Cookie", value)
+	case "user-agent":
+		r.header.Set("User-Agent", value)
+	case "referer":
+		r.header.Set("Referer", strings.TrimSuffix(value, ";auto"))
+	case "user":
+		if !strings.Contains(value, ":") {
+			value += ":"
+		}
+		r.header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(value)))
+	case "range":
+		r.header.Set("Range", "bytes="+value)
+	}
+	return nil
+}
+
+// addHeader 添加 -H 指定的头部，"Name:" 删除头部，"Name;" 添加空值的头部
+func (r *request) addHeader(h string) {
+	if name, ok := strings.CutSuffix(h, ";"); ok && !strings.Contains(name, ":") {
+		r.header.Add(strings.TrimSpace(name), "")
+		return
+	}
+	name, value, ok := strings.Cut(h, ":")
+	if !ok {
+		return
+	}
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if value == "" {
+		r.header.Del(name)
+		return
+	}
+	r.header.Add(name, value)
+}
+
+// build 按 curl 的规则确定方法和默认头部
+func (r *request) build(rawURL string) (*flow.Request, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q: missing host", rawURL)
+	}
+
+	data := strings.Join(r.data, "&")
+	if r.json {
+		data = strings.Join(r.data, "")
+	}
+	hasData := len(r.data) > 0
+	if hasData && r.get {
+		// -G 把数据放在查询字符串中
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += data
+		hasData, data = false, ""
+	}
+
+	req := &flow.Request{Method: r.method, URL: u.String(), Proto: r.proto, Header: r.header}
+	if req.Method == "" {
+		switch {
+		case r.head:
+			req.Method = http.MethodHead
+		case hasData:
+			req.Method = http.MethodPost
+		default:
+			req.Method = http.MethodGet
+		}
+	}
+	if hasData {
+		req.Body = []byte(data)
+		switch {
+		case r.json:
+			setDefault(req.Header, "Content-Type", "application/json")
+			setDefault(req.Header, "Accept", "application/json")
+		default:
+			setDefault(req.Header, "Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if r.compressed {
+		setDefault(req.Header, "Accept-Encoding", "gzip, deflate, br")
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	} else {
+		req.Host = u.Host
+	}
+	return req, nil
+}
+
+func setDefault(h http.Header, name, value string) {
+	if h.Get(name) == "" {
+		h.Set(name, value)
+	}
+}
+
+// urlencode 按 --data-urlencode 的规则编码，支持 content、=content 和 name=content，
+// 与 curl 相同，没有 = 但包含 @ 的参数表示读取文件
+func urlencode(v string) (string, error) {
+	name, content, ok := strings.Cut(v, "=")
+	if !ok {
+		if strings.Contains(v, "@") {
+			return "", errors.New("reading request data from a file is not supported")
+		}
+		return url.QueryEscape(v), nil
+	}
+	if name == "" {
+		return url.QueryEscape(content), nil
+	}
+	return name + "=" + url.QueryEscape(content), nil
+}
+
+// split 按 POSIX shell 的规则拆分命令，支持单引号、双引号、$'...'、反斜杠续行和 # 注释，
+// 未转义的换行结束一条命令
+func split(s string) ([][]string, error) {
+	var commands [][]string
+	var args []string
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord {
+			args = append(args, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(args) > 0 {
+			commands = append(commands, args)
+			args = nil
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\n':
+			endCommand()
+		case c == ' ' || c == '\t' || c == '\r':
+			endWord()
+		case c == '#' && !inWord:
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			endCommand()
+		case c == '\\':
+			// 行尾的反斜杠续行
+			j := i + 1
+			if j < len(s) && s[j] == '\r' {
+				j++
+			}
+			if j >= len(s) || s[j] == '\n' {
+				i = j
+				continue
+			}
+			word.WriteByte(s[j])
+			inWord = true
+			i = j
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			inWord = true
+			i += end + 1
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			n, err := ansiC(&word, s[i+2:])
+			if err != nil {
+				return nil, err
+			}
+			inWord = true
+			i += n + 2
+		case c == '"':
+			n, err := doubleQuoted(&word, s[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			inWord = true
+			i += n + 1
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands, nil
+}
+
+// doubleQuoted 读取双引号中的内容，返回包括结束引号在内读取的字节数。
+// 反斜杠只转义 $、`、"、\ 和换行
+func doubleQuoted(b *strings.Builder, s string) (int, error) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return i + 1, nil
+		case '\\':
+			if i+1 < len(s) {
+				switch next := s[i+1]; next {
+				case '$', '`', '"', '\\':
+					b.WriteByte(next)
+					i++
+					continue
+				case '\n':
+					i++
+					continue
+				}
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return 0, errors.New("unterminated double quote")
+}
+
+// ansiC 读取 $'...' 中的内容，返回包括结束引号在内读取的字节数
+func ansiC(b *strings.Builder, s string) (int, error) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\'' {
+			return i + 1, nil
+		}
+		if c != '\\' || i+1 >= len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'e', 'E':
+			b.WriteByte(0x1b)
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		case 'x':
+			n := hexDigits(s[i+1:], 2)
+			if n == 0 {
+				b.WriteString(`\x`)
+				continue
+			}
+			v, _ := strconv.ParseUint(s[i+1:i+1+n], 16, 8)
+			b.WriteByte(byte(v))
+			i += n
+		case 'u', 'U':
+			digits := 4
+			if s[i] == 'U' {
+				digits = 8
+			}
+			n := hexDigits(s[i+1:], digits)
+			if n == 0 {
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+				continue
+			}
+			v, _ := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if r := rune(v); utf8.ValidRune(r) {
+				b.WriteRune(r)
+			}
+			i += n
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n := 1
+			for n < 3 && i+n < len(s) && s[i+n] >= '0' && s[i+n] <= '7' {
+				n++
+			}
+			v, _ := strconv.ParseUint(s[i:i+n], 8, 8)
+			b.WriteByte(byte(v))
+			i += n - 1
+		default:
+			// \\、\'、\" 和 \? 表示字符本身
+			b.WriteByte(s[i])
+		}
+	}
+	return 0, errors.New("unterminated $' quote")
+}
+
+// hexDigits 返回 s 开头最多 limit 个十六进制数字的数量
+func hexDigits(s string, limit int) int {
+	n := 0
+	for n < limit && n < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[n]) >= 0 {
+		n++
+	}
+	return n
+}
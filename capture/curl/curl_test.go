@@ -0,0 +1,152 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+func TestParse_DevTools(t *testing.T) {
+	// Chrome “复制为 cURL (bash)” 的输出
+	cmd := `curl 'https://api.example.com/v1/items?page=2' \
+  -H 'accept: application/json' \
+  -H 'authorization: Bearer abc' \
+  -H 'content-type: application/json' \
+  -b 'sid=1; theme=dark' \
+  --data-raw $'{"name":"it\'s","note":"a\nb"}' \
+  --compressed`
+	req, err := Parse(cmd)
+	require.NoError(t, err)
+	require.Equal(t, http.MethodPost, req.Method)
+	require.Equal(t, "https://api.example.com/v1/items?page=2", req.URL)
+	require.Equal(t, "api.example.com", req.Host)
+	require.Equal(t, "HTTP/1.1", req.Proto)
+	require.Equal(t, "Bearer abc", req.Header.Get("Authorization"))
+	require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	require.Equal(t, "sid=1; theme=dark", req.Header.Get("Cookie"))
+	require.Equal(t, "gzip, deflate, br", req.Header.Get("Accept-Encoding"))
+	require.Equal(t, "{\"name\":\"it's\",\"note\":\"a\nb\"}", string(req.Body))
+}
+
+func TestParse_Options(t *testing.T) {
+	tests := []struct {
+		cmd   string
+		check func(t *testing.T, req *flow.Request)
+	}{
+		{`curl example.com/x`, func(t *testing.T, req *flow.Request) {
+			require.Equal(t, "GET", req.Method)
+			require.Equal(t, "http://example.com/x", req.URL)
+		}},
+		{`curl -sSL -XDELETE "https://example.com/a b?q=\"1\""`, func(t *testing.T, req *flow.Request) {
+			require.Equal(t, "DELETE", req.Method)
+			require.Equal(t, `https://example.com/a%20b?q="1"`, req.URL)
+		}},
+		{`curl -d a=1 -d b=2 https://example.com/form`, func(t *testing.T, req *flow.Request) {
+			require.Equal(t, "POST", req.Method)
+			require.Equal(t, "a=1&b=2", string(req.Body))
+			require.Equal(t, "application/x-www-form-urlencoded", req.Header.Get("Content-Type"))
+		}},
+		{`curl -G -d q=go --data-urlencode 'name=a b' https://example.com/search?x=1`, func(t *testing.T, req *flow.Request) {
+			require.Equal(t, "GET", req.Method)
+			require.Equal(t, "https://example.com/search?x=1&q=go&name=a+b", req.URL)
+			require.Empty(t, req.Body)
+		}},
+		{`curl --json '{"a":1}' https://example.com/`, func(t *testing.T, req *flow.Request) {
+			require.Equal(t, "POST", req.Method)
+			require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+			require.Equal(t, "application/json", req.Header.Get("Accept"))
+		}},
+		{`curl -I -u bob:secret -A agent -e https://ref/ -r 0-99 --http2 https://example.com/`, func(t *testing.T, req *flow.Request) {
+			require.Equal(t, "HEAD", req.Method)
+			require.Equal(t, "Basic Ym9iOnNlY3JldA==", req.Header.Get("Authorization"))
+			require.Equal(t, "agent", req.Header.Get("User-Agent"))
+			require.Equal(t, "https://ref/", req.Header.Get("Referer"))
+			require.Equal(t, "bytes=0-99", req.Header.Get("Range"))
+			require.Equal(t, "HTTP/2.0", req.Proto)
+		}},
+		{`curl -H 'Host: internal' -H 'X-Empty;' -H 'Accept:' -o /dev/null -m 5 --url http://10.0.0.1/`, func(t *testing.T, req *flow.Request) {
+			require.Equal(t, "internal", req.Host)
+			require.Equal(t, "http://10.0.0.1/", req.URL)
+			require.Equal(t, []string{""}, req.Header["X-Empty"])
+			require.NotContains(t, req.Header, "Accept")
+			require.NotContains(t, req.Header, "Host")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			req, err := Parse(tt.cmd)
+			require.NoError(t, err)
+			tt.check(t, req)
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		cmd string
+		msg string
+	}{
+		{``, "no curl command"},
+		{`wget https://example.com`, "not a curl command"},
+		{`curl -H`, "requires a value"},
+		{`curl`, "missing URL"},
+		{`curl https://a https://b`, "multiple URLs"},
+		{`curl ftp://example.com/`, "unsupported URL scheme"},
+		{`curl -d @body.json https://example.com/`, "from a file"},
+		{`curl -F file=@a.png https://example.com/`, "multipart"},
+		{`curl -b cookies.txt https://example.com/`, "cookies from a file"},
+		{`curl 'https://example.com`, "unterminated single quote"},
+		{"curl a\ncurl b", "single curl command"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.cmd)
+		require.ErrorContains(t, err, tt.msg, tt.cmd)
+	}
+}
+
+func TestParse_RoundTrip(t *testing.T) {
+	f := flow.New()
+	f.Request = &flow.Request{
+		Method: "PUT",
+		URL:    "https://api.example.com/v1/items/1",
+		Host:   "api.example.com",
+		Proto:  "HTTP/1.1",
+		Header: http.Header{"Content-Type": {"application/json"}, "X-Note": {"tab\there"}},
+		Body:   []byte("{\"name\":\"it's\"}\n\xff"),
+	}
+	req, err := Parse(f.ToCurl(flow.CurlOptions{Insecure: true, Proxy: "http://127.0.0.1:8080"}))
+	require.NoError(t, err)
+	require.Equal(t, f.Request.Method, req.Method)
+	require.Equal(t, f.Request.URL, req.URL)
+	require.Equal(t, f.Request.Host, req.Host)
+	require.Equal(t, f.Request.Header, req.Header)
+	require.Equal(t, f.Request.Body, req.Body)
+}
+
+func TestRead(t *testing.T) {
+	input := `# captured requests
+curl https://example.com/a
+
+curl -X POST https://example.com/b \
+  -d x=1
+`
+	flows, err := Read(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, flows, 2)
+	require.Equal(t, "https://example.com/a", flows[0].Request.URL)
+	require.Equal(t, "POST", flows[1].Request.Method)
+	require.Equal(t, "x=1", string(flows[1].Request.Body))
+	require.NotEmpty(t, flows[1].ID)
+
+	_, err = Read(strings.NewReader("curl https://example.com/\ncurl -H\n"))
+	require.ErrorContains(t, err, "command 2")
+}
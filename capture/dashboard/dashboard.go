@@ -0,0 +1,44 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/f-dong/sniffy/capture/api"
+)
+
+//go:embed static
+var static embed.FS
+
+// Dashboard 内嵌的Web界面，展示实时流列表和流详情，支持过滤、重放、编辑后重放和导出。
+// 页面通过同一端口上的 api.Server 获取数据
+type Dashboard struct {
+	server *api.Server
+	mux    *http.ServeMux
+}
+
+// New 创建Web界面，server 挂载在 api.Prefix 下
+func New(server *api.Server) *Dashboard {
+	// static 目录在编译时嵌入，fs.Sub 不会失败
+	assets, _ := fs.Sub(static, "static")
+	d := &Dashboard{server: server, mux: http.NewServeMux()}
+	d.mux.Handle("/", http.FileServerFS(assets))
+	d.mux.Handle(api.Prefix+"/", server)
+	return d
+}
+
+// Handle 在同一端口上挂载其他处理器，例如CDP桥接，请求与API一样检查 Origin 和 Host
+func (d *Dashboard) Handle(pattern string, h http.Handler) {
+	d.mux.Handle(pattern, d.server.Protect(h))
+}
+
+// ServeHTTP 实现 http.Handler 接口
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mux.ServeHTTP(w, r)
+}
@@ -0,0 +1,62 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/api"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+func TestDashboard(t *testing.T) {
+	store := flow.NewStore()
+	f := flow.New()
+	f.Request = &flow.Request{Method: "GET", URL: "https://api.example.com/"}
+	store.Add(f)
+	d := New(api.New(store))
+
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://127.0.0.1:8081/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, rec.Body.String(), api.Prefix+"/flows")
+
+	rec = httptest.NewRecorder()
+	d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://127.0.0.1:8081"+api.Prefix+"/flows/"+f.ID, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), f.ID)
+}
+
+func TestDashboard_HandleProtected(t *testing.T) {
+	d := New(api.New(flow.NewStore()))
+	d.Handle("/debug/pprof/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("profile"))
+	}))
+
+	// 挂载的处理器与API一样拒绝其他站点和重绑定的域名
+	for _, tt := range []struct {
+		host, origin string
+		want         int
+	}{
+		{"127.0.0.1:8081", "", http.StatusOK},
+		{"127.0.0.1:8081", "https://evil.example", http.StatusForbidden},
+		{"rebind.evil.example:8081", "", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+		req.Host = tt.host
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, req)
+		require.Equal(t, tt.want, rec.Code, tt.host+" "+tt.origin)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dialer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// clientCert 按主机模式配置的客户端证书
+type clientCert struct {
+	pattern string
+	cert    *tls.Certificate
+}
+
+// AddClientCertificate 为匹配的主机配置上游要求双向TLS时出示的客户端证书，
+// 模式支持 "*.example.com"，"*" 匹配所有主机，先添加的优先
+func (d *Dialer) AddClientCertificate(pattern string, cert tls.Certificate) error {
+	if cert.Leaf == nil && len(cert.Certificate) > 0 {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+		cert.Leaf = leaf
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clientCerts = append(d.clientCerts, clientCert{pattern: pattern, cert: &cert})
+	return nil
+}
+
+// ClientCertificate 返回为主机配置的客户端证书，未配置时返回nil
+func (d *Dialer) ClientCertificate(host string) *tls.Certificate {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, c := range d.clientCerts {
+		if c.pattern == "*" || tlsinfo.MatchHost(c.pattern, host) {
+			return c.cert
+		}
+	}
+	return nil
+}
+
+type clientCertKey struct{}
+
+// WithClientCertificate 在context中记录请求指定的客户端证书，id 为 RegisterCertificate 的返回值，
+// 拨号时代替按主机配置的证书
+func WithClientCertificate(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, clientCertKey{}, id)
+}
+
+// ClientCertificateID 从context中获取请求指定的客户端证书，未指定时返回空字符串
+func ClientCertificateID(ctx context.Context) string {
+	id, _ := ctx.Value(clientCertKey{}).(string)
+	return id
+}
+
+// RegisterCertificate 登记单个请求使用的客户端证书，返回随机生成的标识，
+// 代理的其他客户端无法由公开的证书推算出标识。相同的证书只登记一次，登记的证书在进程退出前一直有效
+func (d *Dialer) RegisterCertificate(cert tls.Certificate) (string, error) {
+	if len(cert.Certificate) == 0 {
+		return "", errors.New("client certificate is empty")
+	}
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return "", err
+		}
+		cert.Leaf = leaf
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	fingerprint := hex.EncodeToString(sum[:])
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if id, ok := d.fingerprints[fingerprint]; ok {
+		return id, nil
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b[:])
+	if d.registered == nil {
+		d.registered = map[string]*tls.Certificate{}
+		d.fingerprints = map[string]string{}
+	}
+	d.registered[id] = &cert
+	d.fingerprints[fingerprint] = id
+	return id, nil
+}
+
+// RegisteredCertificate 返回登记的客户端证书，不存在时返回nil
+func (d *Dialer) RegisteredCertificate(id string) *tls.Certificate {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.registered[id]
+}
+
+// LoadX509KeyPair 从PEM格式的证书和私钥文件加载客户端证书
+func LoadX509KeyPair(certFile, keyFile string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("load client certificate %s: %w", certFile, err)
+	}
+	return cert, nil
+}
+
+// LoadPKCS12 从PKCS#12 (.p12/.pfx) 文件加载客户端证书及其证书链
+func LoadPKCS12(path, password string) (tls.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	cert, err := ParsePKCS12(data, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("%w: %s", err, path)
+	}
+	return cert, nil
+}
+
+// ParsePKCS12 解析PKCS#12格式的客户端证书及其证书链
+func ParsePKCS12(data []byte, password string) (tls.Certificate, error) {
+	key, leaf, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("decode PKCS#12: %w", err)
+	}
+
+	cert := tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return cert, nil
+}
@@ -0,0 +1,329 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dialer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/proxyproto"
+	"github.com/f-dong/sniffy/capture/throttle"
+	"github.com/f-dong/sniffy/capture/timeouts"
+)
+
+// DefaultDialTimeout 默认拨号超时时间
+const DefaultDialTimeout = 30 * time.Second
+
+// sourceAddrKey 原始客户端地址的context键
+type sourceAddrKey struct{}
+
+// WithSourceAddr 在context中记录原始客户端地址，用于向上游发送PROXY protocol头部
+func WithSourceAddr(ctx context.Context, addr net.Addr) context.Context {
+	return context.WithValue(ctx, sourceAddrKey{}, addr)
+}
+
+// SourceAddrFromContext 从context中获取原始客户端地址
+func SourceAddrFromContext(ctx context.Context) (net.Addr, bool) {
+	addr, ok := ctx.Value(sourceAddrKey{}).(net.Addr)
+	return addr, ok
+}
+
+// timingsKey 拨号阶段计时的context键
+type timingsKey struct{}
+
+// WithTimings 在context中记录流的计时，拨号时写入DNS、TCP连接和TLS握手的时间点
+func WithTimings(ctx context.Context, t *flow.Timings) context.Context {
+	return context.WithValue(ctx, timingsKey{}, t)
+}
+
+// timingsFromContext 从context中获取流的计时
+func timingsFromContext(ctx context.Context) *flow.Timings {
+	t, _ := ctx.Value(timingsKey{}).(*flow.Timings)
+	return t
+}
+
+// Dialer 上游连接拨号器，支持静态主机映射和自定义DNS解析器
+type Dialer struct {
+	mu         sync.RWMutex
+	hosts      map[string]string
+	resolver   *net.Resolver
+	timeout    time.Duration
+	proxyProto int
+
+	// helloProfile 连接上游TLS时模拟的ClientHello
+	helloProfile string
+
+	// verify 上游证书校验策略
+	verify *VerifyPolicy
+
+	// clientCerts 按主机配置的双向TLS客户端证书
+	clientCerts []clientCert
+
+	// registered 单个请求指定的客户端证书，fingerprints 为证书的SHA-256指纹到标识的映射
+	registered   map[string]*tls.Certificate
+	fingerprints map[string]string
+
+	// upstream 上游代理，为nil时按 envProxy 选择，都为nil时直接连接
+	upstream *UpstreamProxy
+
+	// envProxy 按环境变量为每个上游选择的代理
+	envProxy *EnvironmentProxy
+
+	// shaper 按主机模拟的网络条件
+	shaper *throttle.Shaper
+
+	// timeouts 按主机的拨号和TLS握手超时，为0的阶段使用 timeout
+	timeouts *timeouts.Policy
+}
+
+// New 创建新的拨号器，默认使用系统解析器
+func New() *Dialer {
+	return &Dialer{
+		hosts:   make(map[string]string),
+		timeout: DefaultDialTimeout,
+	}
+}
+
+// MapHost 添加静态主机映射，host 支持 "*.example.com" 形式的通配符，
+// target 可以是IP地址、主机名或 host:port
+func (d *Dialer) MapHost(host, target string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hosts[strings.ToLower(host)] = target
+}
+
+// UnmapHost 删除静态主机映射
+func (d *Dialer) UnmapHost(host string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.hosts, strings.ToLower(host))
+}
+
+// SetResolver 设置自定义解析器，传入nil恢复系统解析器
+func (d *Dialer) SetResolver(resolver *net.Resolver) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.resolver = resolver
+}
+
+// SetTimeout 设置拨号超时时间
+func (d *Dialer) SetTimeout(timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.timeout = timeout
+}
+
+// SetTimeouts 设置按主机的拨号和TLS握手超时，拨号超时为0的主机使用 SetTimeout 设置的超时
+func (d *Dialer) SetTimeouts(p *timeouts.Policy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.timeouts = p
+}
+
+// SetProxyProtocol 设置连接上游后发送的PROXY protocol版本，0表示不发送
+func (d *Dialer) SetProxyProtocol(version int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.proxyProto = version
+}
+
+// ProxyProtocol 返回连接上游后发送的PROXY protocol版本，0表示不发送
+func (d *Dialer) ProxyProtocol() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.proxyProto
+}
+
+// SetShaper 设置按主机模拟网络条件的Shaper，传入nil时不限速
+func (d *Dialer) SetShaper(s *throttle.Shaper) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.shaper = s
+}
+
+// Replace 用另一个拨号器的配置原子地替换当前配置，登记的单个请求客户端证书保留。
+// 已建立的连接不受影响，之后的拨号使用新配置
+func (d *Dialer) Replace(other *Dialer) {
+	other.mu.RLock()
+	hosts := make(map[string]string, len(other.hosts))
+	for host, target := range other.hosts {
+		hosts[host] = target
+	}
+	resolver, timeout, proxyProto := other.resolver, other.timeout, other.proxyProto
+	helloProfile, verify := other.helloProfile, other.verify
+	clientCerts := append([]clientCert(nil), other.clientCerts...)
+	upstream, envProxy, shaper, limits := other.upstream, other.envProxy, other.shaper, other.timeouts
+	other.mu.RUnlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hosts, d.resolver, d.timeout, d.proxyProto = hosts, resolver, timeout, proxyProto
+	d.helloProfile, d.verify, d.clientCerts = helloProfile, verify, clientCerts
+	d.upstream, d.envProxy, d.shaper, d.timeouts = upstream, envProxy, shaper, limits
+}
+
+// Lookup 返回主机映射后的目标地址，未命中映射时返回原地址
+func (d *Dialer) Lookup(host string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	host = strings.ToLower(host)
+	if target, ok := d.hosts[host]; ok {
+		return target
+	}
+
+	// 通配符匹配，从最长的后缀开始
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		if target, ok := d.hosts["*."+host]; ok {
+			return target
+		}
+	}
+
+	return ""
+}
+
+// LookupHost 先应用主机映射，再使用配置的解析器解析主机名，返回IP地址
+func (d *Dialer) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if target := d.Lookup(host); target != "" {
+		if h, _, err := net.SplitHostPort(target); err == nil {
+			target = h
+		}
+		host = target
+	}
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	d.mu.RLock()
+	resolver := d.resolver
+	d.mu.RUnlock()
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return resolver.LookupHost(ctx, host)
+}
+
+// DialContext 连接到指定地址，先应用主机映射，再使用配置的解析器解析
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	name, namePort := host, port
+
+	if target := d.Lookup(host); target != "" {
+		if h, p, err := net.SplitHostPort(target); err == nil {
+			host, port = h, p
+		} else {
+			host = target
+		}
+	}
+
+	d.mu.RLock()
+	nd := &net.Dialer{
+		Timeout:  d.timeout,
+		Resolver: d.resolver,
+	}
+	if t := d.timeouts.For(name).Dial; t > 0 {
+		nd.Timeout = t
+	}
+	version := d.proxyProto
+	upstream := d.upstream
+	if upstream == nil {
+		// NO_PROXY 按客户端请求的主机匹配，不受主机映射影响
+		upstream = d.envProxy.For(schemeFromContext(ctx, namePort), name, namePort)
+	}
+	shaper := d.shaper
+	d.mu.RUnlock()
+
+	if t := timingsFromContext(ctx); t != nil {
+		// 第一次尝试连接时解析已完成，之后的时间计入TCP连接
+		t.DNSStart = time.Now()
+		nd.ControlContext = func(context.Context, string, string, syscall.RawConn) error {
+			if t.DNSDone.IsZero() {
+				t.DNSDone = time.Now()
+				t.ConnectStart = t.DNSDone
+			}
+			return nil
+		}
+		defer func() {
+			if t.DNSDone.IsZero() {
+				// 解析失败，没有尝试连接
+				t.DNSDone = time.Now()
+			} else {
+				t.ConnectDone = time.Now()
+			}
+		}()
+	}
+
+	var conn net.Conn
+	if upstream != nil {
+		// 计时中的TCP连接阶段包含与上游代理的CONNECT握手
+		conn, err = dialViaProxy(ctx, nd, network, upstream, net.JoinHostPort(host, port))
+	} else {
+		conn, err = dialHappyEyeballs(ctx, nd, network, net.JoinHostPort(host, port))
+	}
+	if err != nil {
+		// context 到期时由调用方归类超时
+		if ctx.Err() == nil {
+			err = timeouts.Wrap(err, timeouts.PhaseDial, nd.Timeout)
+		}
+		return nil, err
+	}
+	// 按请求的主机名而不是映射后的地址匹配网络条件
+	conn = shaper.Wrap(name, conn)
+	if version == 0 {
+		return conn, nil
+	}
+
+	src, ok := SourceAddrFromContext(ctx)
+	if !ok {
+		src = conn.LocalAddr()
+	}
+	if _, err := proxyproto.NewHeader(version, src, conn.RemoteAddr()).WriteTo(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("write PROXY protocol header: %w", err)
+	}
+	return conn, nil
+}
+
+// Dial 使用后台context连接到指定地址
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// ParseHostMapping 解析 "host=target" 形式的主机映射
+func ParseHostMapping(s string) (host, target string, err error) {
+	host, target, ok := strings.Cut(s, "=")
+	host = strings.TrimSpace(host)
+	target = strings.TrimSpace(target)
+	if !ok || host == "" || target == "" {
+		return "", "", fmt.Errorf("invalid host mapping %q (expected host=target)", s)
+	}
+	return host, target, nil
+}
+
+// NewDNSResolver 创建通过指定DNS服务器解析的解析器，server 格式为 ip 或 ip:port
+func NewDNSResolver(server string) *net.Resolver {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var nd net.Dialer
+			return nd.DialContext(ctx, network, server)
+		},
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dialer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+
+func TestLookup(t *testing.T) {
+	d := New()
+	d.MapHost("api.example.com", "10.0.0.1:8443")
+	d.MapHost("*.example.com", "10.0.0.2")
+	d.MapHost("*.internal.example.com", "10.0.0.3:80")
+	d.MapHost("Upper.Test", "10.0.0.4")
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"api.example.com", "10.0.0.1:8443"},
+		{"API.Example.com", "10.0.0.1:8443"},
+		{"www.example.com", "10.0.0.2"},
+		{"a.b.example.com", "10.0.0.2"},
+		{"db.internal.example.com", "10.0.0.3:80"},
+		{"x.db.internal.example.com", "10.0.0.3:80"},
+		{"upper.test", "10.0.0.4"},
+		// 通配符不匹配域名本身
+		{"example.com", ""},
+		{"example.org", ""},
+		{"notexample.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			require.Equal(t, tt.want, d.Lookup(tt.host))
+		})
+	}
+
+	d.UnmapHost("API.example.com")
+	require.Equal(t, "10.0.0.2", d.Lookup("api.example.com"))
+}
+
+func TestLookupHost_Mapping(t *testing.T) {
+	d := New()
+	d.MapHost("api.test", "192.0.2.1:8443")
+	d.MapHost("*.v6.test", "[2001:db8::1]:443")
+
+	addrs, err := d.LookupHost(context.Background(), "api.test")
+	require.NoError(t, err)
+	require.Equal(t, []string{"192.0.2.1"}, addrs)
+	addrs, err = d.LookupHost(context.Background(), "www.v6.test")
+	require.NoError(t, err)
+	require.Equal(t, []string{"2001:db8::1"}, addrs)
+}
+
+func TestDialContext_HostMapping(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer echo.Close()
+	_, port, err := net.SplitHostPort(echo.Addr().String())
+	require.NoError(t, err)
+
+	d := New()
+	d.MapHost("api.test", echo.Addr().String())
+	d.MapHost("*.svc.test", echo.Addr().String())
+	d.MapHost("ip.test", "127.0.0.1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// 目标带端口时替换请求的端口，只有地址时保留请求的端口
+	for _, address := range []string{"api.test:443", "web.svc.test:80", "a.b.svc.test:8080", "ip.test:" + port} {
+		conn, err := d.DialContext(ctx, "tcp", address)
+		require.NoError(t, err, address)
+		require.Equal(t, echo.Addr().String(), conn.RemoteAddr().String(), address)
+		conn.Close()
+	}
+
+	_, err = d.DialContext(ctx, "tcp", "api.test")
+	require.ErrorContains(t, err, `invalid address "api.test"`)
+}
+
+func TestParseHostMapping(t *testing.T) {
+	tests := []struct {
+		in           string
+		host, target string
+	}{
+		{"api.example.com=127.0.0.1", "api.example.com", "127.0.0.1"},
+		{"*.example.com=127.0.0.1:8443", "*.example.com", "127.0.0.1:8443"},
+		{" api.test = [::1]:443 ", "api.test", "[::1]:443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			host, target, err := ParseHostMapping(tt.in)
+			require.NoError(t, err)
+			require.Equal(t, tt.host, host)
+			require.Equal(t, tt.target, target)
+		})
+	}
+
+	for _, in := range []string{"", "api.test", "api.test=", "=127.0.0.1", " = ", "api.test 127.0.0.1"} {
+		_, _, err := ParseHostMapping(in)
+		require.ErrorContains(t, err, "expected host=target", in)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dialer
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// schemeKey 上游请求协议的context键
+type schemeKey struct{}
+
+// WithScheme 在context中记录上游请求的协议，按环境变量选择上游代理时使用。
+// DialTLSContext 总是视为 https，未记录时443端口视为 https，其余视为 http
+func WithScheme(ctx context.Context, scheme string) context.Context {
+	return context.WithValue(ctx, schemeKey{}, scheme)
+}
+
+// schemeFromContext 返回上游请求的协议
+func schemeFromContext(ctx context.Context, port string) string {
+	if scheme, ok := ctx.Value(schemeKey{}).(string); ok && scheme != "" {
+		return scheme
+	}
+	if port == "443" {
+		return "https"
+	}
+	return "http"
+}
+
+// EnvironmentProxy 按 HTTP_PROXY、HTTPS_PROXY 和 NO_PROXY 的约定为每个上游选择代理，
+// 与 curl 和 Go 的 http.ProxyFromEnvironment 一致，localhost 和回环地址总是直接连接
+type EnvironmentProxy struct {
+	proxies map[string]*UpstreamProxy
+	match   func(*url.URL) (*url.URL, error)
+}
+
+// NewEnvironmentProxy 根据 config 创建按协议选择的上游代理，两种协议都没有代理时返回nil
+func NewEnvironmentProxy(config *httpproxy.Config) (*EnvironmentProxy, error) {
+	e := &EnvironmentProxy{proxies: make(map[string]*UpstreamProxy)}
+	for scheme, value := range map[string]string{"http": config.HTTPProxy, "https": config.HTTPSProxy} {
+		if value == "" {
+			continue
+		}
+		p, err := ParseUpstreamProxy(value)
+		if err != nil {
+			return nil, err
+		}
+		e.proxies[scheme] = p
+	}
+	if len(e.proxies) == 0 {
+		return nil, nil
+	}
+	e.match = config.ProxyFunc()
+	return e, nil
+}
+
+// For 返回到 scheme://host:port 使用的上游代理，直接连接时返回nil
+func (e *EnvironmentProxy) For(scheme, host, port string) *UpstreamProxy {
+	if e == nil {
+		return nil
+	}
+	p := e.proxies[scheme]
+	if p == nil {
+		return nil
+	}
+	// ProxyFunc 只在主机不匹配 NO_PROXY 时返回代理
+	if u, err := e.match(&url.URL{Scheme: scheme, Host: net.JoinHostPort(host, port)}); err != nil || u == nil {
+		return nil
+	}
+	return p
+}
+
+// Proxies 返回每种协议的上游代理
+func (e *EnvironmentProxy) Proxies() map[string]*UpstreamProxy {
+	if e == nil {
+		return nil
+	}
+	return e.proxies
+}
+
+// SetEnvironmentProxy 设置按环境变量选择的上游代理，仅在没有设置 SetUpstreamProxy 时使用
+func (d *Dialer) SetEnvironmentProxy(e *EnvironmentProxy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.envProxy = e
+}
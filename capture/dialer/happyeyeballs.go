@@ -0,0 +1,150 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dialer
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// connectionAttemptDelay RFC 8305 建议的相邻两次连接尝试之间的间隔
+const connectionAttemptDelay = 250 * time.Millisecond
+
+// dialHappyEyeballs 按 RFC 8305 (Happy Eyeballs v2) 连接 address：解析 A 和 AAAA 记录后交替排列两种地址族，
+// 每隔 connectionAttemptDelay 或上一次尝试失败后开始下一次尝试，使用最先建立的连接。
+// nd.Timeout 限制包括解析在内的整个连接过程
+func dialHappyEyeballs(ctx context.Context, nd *net.Dialer, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil || (network != "tcp" && network != "tcp4" && network != "tcp6") {
+		return nd.DialContext(ctx, network, address)
+	}
+	if nd.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, nd.Timeout)
+		defer cancel()
+	}
+	resolver := nd.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ips, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	addrs := interleave(filterFamily(network, ips))
+	if len(addrs) == 0 {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: &net.AddrError{Err: "no suitable address found", Addr: host}}
+	}
+
+	// 整个过程的超时由 ctx 控制
+	attempt := *nd
+	attempt.Timeout = 0
+	return dialAddrs(ctx, addrs, connectionAttemptDelay, func(ctx context.Context, ip net.IPAddr) (net.Conn, error) {
+		return attempt.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+	})
+}
+
+// filterFamily 返回 network 允许的地址族的地址
+func filterFamily(network string, ips []net.IPAddr) []net.IPAddr {
+	if network == "tcp" {
+		return ips
+	}
+	var out []net.IPAddr
+	for _, ip := range ips {
+		if (ip.IP.To4() != nil) == (network == "tcp4") {
+			out = append(out, ip)
+		}
+	}
+	return out
+}
+
+// interleave 按 RFC 8305 第4节交替排列两种地址族的地址，解析器返回的第一个地址的地址族在前。
+// 解析器已按 RFC 6724 排序，同一地址族内保持原来的顺序
+func interleave(ips []net.IPAddr) []net.IPAddr {
+	if len(ips) < 2 {
+		return ips
+	}
+	first := ips[0].IP.To4() != nil
+	var primary, secondary []net.IPAddr
+	for _, ip := range ips {
+		if (ip.IP.To4() != nil) == first {
+			primary = append(primary, ip)
+		} else {
+			secondary = append(secondary, ip)
+		}
+	}
+	out := make([]net.IPAddr, 0, len(ips))
+	for i := 0; i < len(primary) || i < len(secondary); i++ {
+		if i < len(primary) {
+			out = append(out, primary[i])
+		}
+		if i < len(secondary) {
+			out = append(out, secondary[i])
+		}
+	}
+	return out
+}
+
+// dialAddrs 按顺序开始连接 ips，每隔 delay 或上一次尝试失败后开始下一次尝试。
+// 返回最先建立的连接并取消其余尝试，之后建立的连接被关闭，全部失败时返回第一个错误
+func dialAddrs(ctx context.Context, ips []net.IPAddr, delay time.Duration, dial func(context.Context, net.IPAddr) (net.Conn, error)) (net.Conn, error) {
+	if len(ips) == 1 {
+		return dial(ctx, ips[0])
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(ips))
+	next, pending := 0, 0
+	start := func() {
+		ip := ips[next]
+		next++
+		pending++
+		go func() {
+			conn, err := dial(ctx, ip)
+			results <- result{conn, err}
+		}()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	start()
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				go func(n int) {
+					for range n {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(ips) {
+				start()
+				timer.Reset(delay)
+			}
+		case <-timer.C:
+			if next < len(ips) {
+				start()
+				timer.Reset(delay)
+			}
+		}
+	}
+	return nil, firstErr
+}
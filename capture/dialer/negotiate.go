@@ -0,0 +1,145 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dialer
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// negotiateAuth 使用Kerberos的SPNEGO认证
+type negotiateAuth struct {
+	spn string
+
+	// newClient 创建Kerberos客户端，首次握手时调用
+	newClient func() (*client.Client, error)
+
+	mu     sync.Mutex
+	client *client.Client
+}
+
+// NegotiateAuth 返回使用当前凭据缓存（KRB5CCNAME，默认 /tmp/krb5cc_<uid>）中Kerberos票据的SPNEGO认证。
+// spn 为代理的服务主体名称，为空时使用 HTTP/<代理主机名>
+func NegotiateAuth(spn string) (ProxyAuth, error) {
+	return &negotiateAuth{spn: spn, newClient: clientFromCCache}, nil
+}
+
+// NegotiatePasswordAuth 返回使用 user@REALM 和密码登录KDC的SPNEGO认证
+func NegotiatePasswordAuth(principal, password string) (ProxyAuth, error) {
+	user, realm, ok := strings.Cut(principal, "@")
+	if !ok || user == "" || realm == "" {
+		return nil, fmt.Errorf("invalid Kerberos principal %q (expected user@REALM)", principal)
+	}
+	return &negotiateAuth{newClient: func() (*client.Client, error) {
+		cfg, err := loadKrb5Config()
+		if err != nil {
+			return nil, err
+		}
+		return client.NewWithPassword(user, realm, password, cfg, client.DisablePAFXFAST(true)), nil
+	}}, nil
+}
+
+// Scheme 实现 ProxyAuth 接口
+func (a *negotiateAuth) Scheme() string {
+	return "Negotiate"
+}
+
+// NewHandshake 实现 ProxyAuth 接口
+func (a *negotiateAuth) NewHandshake(proxyHost string) (Handshake, error) {
+	cl, err := a.kerberosClient()
+	if err != nil {
+		return nil, err
+	}
+	spn := a.spn
+	if spn == "" {
+		spn = "HTTP/" + strings.TrimSuffix(proxyHost, ".")
+	}
+	return &negotiateHandshake{client: cl, spn: spn}, nil
+}
+
+// kerberosClient 返回已登录的Kerberos客户端
+func (a *negotiateAuth) kerberosClient() (*client.Client, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.client == nil {
+		cl, err := a.newClient()
+		if err != nil {
+			return nil, err
+		}
+		a.client = cl
+	}
+	if err := a.client.AffirmLogin(); err != nil {
+		return nil, fmt.Errorf("kerberos login: %w", err)
+	}
+	return a.client, nil
+}
+
+// negotiateHandshake 一次SPNEGO握手，Kerberos只需要发送一次初始令牌
+type negotiateHandshake struct {
+	client *client.Client
+	spn    string
+	sent   bool
+}
+
+// Step 实现 Handshake 接口
+func (h *negotiateHandshake) Step(challenge []byte) (string, error) {
+	if h.sent {
+		return "", errors.New("proxy requested another SPNEGO round trip, which Kerberos does not need")
+	}
+	h.sent = true
+	token, err := spnego.SPNEGOClient(h.client, h.spn).InitSecContext()
+	if err != nil {
+		return "", fmt.Errorf("get service ticket for %s: %w", h.spn, err)
+	}
+	b, err := token.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return "Negotiate " + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// clientFromCCache 使用krb5.conf和凭据缓存创建Kerberos客户端
+func clientFromCCache() (*client.Client, error) {
+	cfg, err := loadKrb5Config()
+	if err != nil {
+		return nil, err
+	}
+	path := strings.TrimPrefix(os.Getenv("KRB5CCNAME"), "FILE:")
+	if path == "" {
+		path = fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+	}
+	cc, err := credentials.LoadCCache(path)
+	if err != nil {
+		return nil, fmt.Errorf("load Kerberos credential cache %s (run kinit first): %w", path, err)
+	}
+	cl, err := client.NewFromCCache(cc, cfg, client.DisablePAFXFAST(true))
+	if err != nil {
+		return nil, fmt.Errorf("kerberos client from credential cache: %w", err)
+	}
+	return cl, nil
+}
+
+// loadKrb5Config 加载 KRB5_CONFIG 指定或默认的 /etc/krb5.conf
+func loadKrb5Config() (*config.Config, error) {
+	path := os.Getenv("KRB5_CONFIG")
+	if path == "" {
+		path = "/etc/krb5.conf"
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("load Kerberos configuration %s: %w", path, err)
+	}
+	return cfg, nil
+}
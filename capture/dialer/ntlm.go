@@ -0,0 +1,268 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dialer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// NTLM协商标志，取值见 MS-NLMP 2.2.2.5
+const (
+	ntlmNegotiateUnicode         = 0x00000001
+	ntlmNegotiateOEM             = 0x00000002
+	ntlmRequestTarget            = 0x00000004
+	ntlmNegotiateNTLM            = 0x00000200
+	ntlmNegotiateAlwaysSign      = 0x00008000
+	ntlmNegotiateExtendedSession = 0x00080000
+	ntlmNegotiateTargetInfo      = 0x00800000
+	ntlmNegotiate128             = 0x20000000
+	ntlmNegotiate56              = 0x80000000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmNegotiateOEM | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSession | ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+)
+
+// ntlmSignature NTLM消息的签名
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// msvAvTimestamp 目标信息中服务端时间戳的AV_PAIR类型
+const msvAvTimestamp = 7
+
+// ntlmAuth NTLMv2认证
+type ntlmAuth struct {
+	domain   string
+	user     string
+	password string
+}
+
+// NTLMAuth 返回使用域账号的NTLMv2认证，domain 为空时使用代理质询中的目标域
+func NTLMAuth(domain, user, password string) ProxyAuth {
+	return &ntlmAuth{domain: domain, user: user, password: password}
+}
+
+// Scheme 实现 ProxyAuth 接口
+func (a *ntlmAuth) Scheme() string {
+	return "NTLM"
+}
+
+// NewHandshake 实现 ProxyAuth 接口
+func (a *ntlmAuth) NewHandshake(string) (Handshake, error) {
+	return &ntlmHandshake{auth: a}, nil
+}
+
+// ntlmHandshake 一次NTLM握手：先发送NEGOTIATE消息，再根据CHALLENGE消息发送AUTHENTICATE消息
+type ntlmHandshake struct {
+	auth *ntlmAuth
+	sent bool
+}
+
+// Step 实现 Handshake 接口
+func (h *ntlmHandshake) Step(challenge []byte) (string, error) {
+	if !h.sent {
+		h.sent = true
+		return "NTLM " + base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()), nil
+	}
+	msg, err := h.auth.authenticate(challenge)
+	if err != nil {
+		return "", err
+	}
+	return "NTLM " + base64.StdEncoding.EncodeToString(msg), nil
+}
+
+// ntlmNegotiateMessage 返回不带域和工作站名称的NEGOTIATE消息
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmNegotiateFlags)
+	return msg
+}
+
+// ntlmChallenge 解析后的CHALLENGE消息
+type ntlmChallenge struct {
+	flags         uint32
+	serverNonce   []byte
+	targetName    []byte
+	targetInfo    []byte
+	serverTimeSet bool
+	serverTime    uint64
+}
+
+// parseNTLMChallenge 解析代理返回的CHALLENGE消息
+func parseNTLMChallenge(b []byte) (*ntlmChallenge, error) {
+	if len(b) < 32 || !bytes.Equal(b[:8], ntlmSignature) || binary.LittleEndian.Uint32(b[8:]) != 2 {
+		return nil, errors.New("invalid NTLM challenge message")
+	}
+	c := &ntlmChallenge{
+		flags:       binary.LittleEndian.Uint32(b[20:]),
+		serverNonce: b[24:32],
+	}
+	var ok bool
+	if c.targetName, ok = ntlmField(b, 12); !ok {
+		return nil, errors.New("invalid NTLM challenge target name")
+	}
+	if len(b) >= 48 {
+		if c.targetInfo, ok = ntlmField(b, 40); !ok {
+			return nil, errors.New("invalid NTLM challenge target info")
+		}
+	}
+
+	// 目标信息为 AV_PAIR 序列，查找服务端时间戳
+	for info := c.targetInfo; len(info) >= 4; {
+		id := binary.LittleEndian.Uint16(info)
+		n := int(binary.LittleEndian.Uint16(info[2:]))
+		if id == 0 || len(info) < 4+n {
+			break
+		}
+		if id == msvAvTimestamp && n == 8 {
+			c.serverTime = binary.LittleEndian.Uint64(info[4:])
+			c.serverTimeSet = true
+		}
+		info = info[4+n:]
+	}
+	return c, nil
+}
+
+// ntlmField 读取消息中 offset 处的长度/偏移描述符指向的数据
+func ntlmField(b []byte, offset int) ([]byte, bool) {
+	n := int(binary.LittleEndian.Uint16(b[offset:]))
+	start := int(binary.LittleEndian.Uint32(b[offset+4:]))
+	if n == 0 {
+		return nil, true
+	}
+	if start < 0 || start+n > len(b) {
+		return nil, false
+	}
+	return b[start : start+n], true
+}
+
+// authenticate 根据CHALLENGE消息生成NTLMv2的AUTHENTICATE消息
+func (a *ntlmAuth) authenticate(challenge []byte) ([]byte, error) {
+	c, err := parseNTLMChallenge(challenge)
+	if err != nil {
+		return nil, err
+	}
+	unicode := c.flags&ntlmNegotiateUnicode != 0
+	encode := func(s string) []byte {
+		if unicode {
+			return utf16le(s)
+		}
+		return []byte(s)
+	}
+
+	domain := a.domain
+	if domain == "" {
+		// 未指定域时使用代理所在的域
+		domain = decodeNTLMString(c.targetName, unicode)
+	}
+
+	clientNonce := make([]byte, 8)
+	if _, err := rand.Read(clientNonce); err != nil {
+		return nil, err
+	}
+	timestamp := c.serverTime
+	if !c.serverTimeSet {
+		timestamp = fileTime(time.Now())
+	}
+
+	key := ntowfv2(a.user, a.password, domain)
+	nt, lm := ntlmV2Response(key, c.serverNonce, clientNonce, timestamp, c.targetInfo)
+	if c.serverTimeSet {
+		// 服务端提供时间戳时不发送LMv2响应，见 MS-NLMP 3.1.5.1.2
+		lm = make([]byte, 24)
+	}
+
+	fields := [][]byte{lm, nt, encode(domain), encode(a.user), nil, nil}
+	flags := c.flags & ntlmNegotiateFlags
+	if unicode {
+		flags &^= ntlmNegotiateOEM
+	}
+
+	const headerLen = 64
+	msg := make([]byte, headerLen)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	offset := headerLen
+	for i, f := range fields {
+		pos := 12 + i*8
+		binary.LittleEndian.PutUint16(msg[pos:], uint16(len(f)))
+		binary.LittleEndian.PutUint16(msg[pos+2:], uint16(len(f)))
+		binary.LittleEndian.PutUint32(msg[pos+4:], uint32(offset))
+		msg = append(msg, f...)
+		offset += len(f)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], flags)
+	return msg, nil
+}
+
+// ntowfv2 计算NTLMv2的响应密钥，见 MS-NLMP 3.3.2
+func ntowfv2(user, password, domain string) []byte {
+	h := md4.New()
+	h.Write(utf16le(password))
+	mac := hmac.New(md5.New, h.Sum(nil))
+	mac.Write(utf16le(strings.ToUpper(user) + domain))
+	return mac.Sum(nil)
+}
+
+// ntlmV2Response 计算NTLMv2和LMv2响应
+func ntlmV2Response(key, serverNonce, clientNonce []byte, timestamp uint64, targetInfo []byte) (nt, lm []byte) {
+	temp := make([]byte, 28, 28+len(targetInfo)+4)
+	temp[0], temp[1] = 1, 1
+	binary.LittleEndian.PutUint64(temp[8:], timestamp)
+	copy(temp[16:], clientNonce)
+	temp = append(temp, targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+
+	mac := hmac.New(md5.New, key)
+	mac.Write(serverNonce)
+	mac.Write(temp)
+	nt = append(mac.Sum(nil), temp...)
+
+	mac.Reset()
+	mac.Write(serverNonce)
+	mac.Write(clientNonce)
+	lm = append(mac.Sum(nil), clientNonce...)
+	return nt, lm
+}
+
+// fileTime 返回Windows FILETIME表示的时间，即自1601年起的100纳秒数
+func fileTime(t time.Time) uint64 {
+	const epochDiff = 116444736000000000
+	return uint64(t.UnixNano()/100) + epochDiff
+}
+
+// decodeNTLMString 解码消息中的字符串字段
+func decodeNTLMString(b []byte, unicode bool) string {
+	if !unicode {
+		return string(b)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// utf16le 返回字符串的UTF-16LE编码
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
@@ -0,0 +1,282 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dialer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/timeouts"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// ProfileGo 使用Go标准库默认的ClientHello
+const ProfileGo = "go"
+
+// clientHelloProfiles 可模拟的浏览器ClientHello，randomized 每次握手随机生成并声明调用方的ALPN
+var clientHelloProfiles = map[string]utls.ClientHelloID{
+	"chrome":     utls.HelloChrome_Auto,
+	"firefox":    utls.HelloFirefox_Auto,
+	"safari":     utls.HelloSafari_Auto,
+	"ios":        utls.HelloIOS_Auto,
+	"edge":       utls.HelloEdge_Auto,
+	"randomized": utls.HelloRandomizedALPN,
+}
+
+// ClientHelloProfiles 返回支持的ClientHello模拟配置名称
+func ClientHelloProfiles() []string {
+	names := []string{ProfileGo}
+	for name := range clientHelloProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TLSConn 已完成握手的上游TLS连接
+type TLSConn struct {
+	net.Conn
+
+	// State 握手完成后的连接状态
+	State tls.ConnectionState
+
+	// ServerHello 上游返回的ServerHello，解析失败时为nil
+	ServerHello *tlsinfo.ServerHello
+
+	// Info 上游会话信息与证书校验结果
+	Info *tlsinfo.UpstreamTLS
+}
+
+// ConnectionState 返回握手完成后的连接状态
+func (c *TLSConn) ConnectionState() tls.ConnectionState {
+	return c.State
+}
+
+// SetClientHelloProfile 设置连接上游时模拟的ClientHello，空字符串或 "go" 使用标准库
+func (d *Dialer) SetClientHelloProfile(profile string) error {
+	profile = strings.ToLower(profile)
+	if profile != "" && profile != ProfileGo {
+		if _, ok := clientHelloProfiles[profile]; !ok {
+			return fmt.Errorf("unknown ClientHello profile %q (supported: %s)", profile, strings.Join(ClientHelloProfiles(), ", "))
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.helloProfile = profile
+	return nil
+}
+
+// SetVerifyPolicy 设置上游证书校验策略，传入nil恢复为仅使用系统根证书
+func (d *Dialer) SetVerifyPolicy(policy *VerifyPolicy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.verify = policy
+}
+
+// DialTLSContext 连接上游并完成TLS握手，按配置的ClientHello模拟浏览器指纹，
+// 握手后按校验策略检查证书链。config.InsecureSkipVerify 为true时仍记录校验结果但不拒绝连接
+func (d *Dialer) DialTLSContext(ctx context.Context, network, address string, config *tls.Config) (*TLSConn, error) {
+	raw, err := d.DialContext(WithScheme(ctx, "https"), network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	profile := d.helloProfile
+	policy := d.verify
+	handshakeTimeout := d.timeouts.For(address).TLSHandshake
+	d.mu.RUnlock()
+	if policy == nil {
+		policy = defaultVerifyPolicy()
+	}
+
+	// 证书校验由策略在握手后完成，以便记录被跳过的校验结果
+	skip := config.InsecureSkipVerify
+	config = config.Clone()
+	config.InsecureSkipVerify = true
+
+	// 上游要求双向TLS时出示请求指定的或为该主机配置的客户端证书
+	var presented *tls.Certificate
+	if len(config.Certificates) == 0 && config.GetClientCertificate == nil {
+		cert := d.ClientCertificate(config.ServerName)
+		if id := ClientCertificateID(ctx); id != "" {
+			if cert = d.RegisteredCertificate(id); cert == nil {
+				return nil, fmt.Errorf("unknown client certificate %s", id)
+			}
+		}
+		if cert != nil {
+			config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				presented = cert
+				return cert, nil
+			}
+		}
+	}
+
+	t := timingsFromContext(ctx)
+	if t != nil {
+		t.TLSStart = time.Now()
+	}
+	hctx := ctx
+	if handshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		hctx, cancel = context.WithTimeout(ctx, handshakeTimeout)
+		defer cancel()
+	}
+	rec := tlsinfo.NewRecordingConn(raw)
+	var conn *TLSConn
+	if id, ok := clientHelloProfiles[profile]; ok {
+		conn, err = handshakeUTLS(hctx, rec, config, id)
+	} else {
+		conn, err = handshakeStd(hctx, rec, config)
+	}
+	if t != nil {
+		t.TLSDone = time.Now()
+	}
+	if err != nil {
+		raw.Close()
+		err = fmt.Errorf("upstream TLS handshake with %s failed: %w", address, err)
+		if ctx.Err() == nil && hctx.Err() != nil {
+			err = &timeouts.Error{Phase: timeouts.PhaseTLSHandshake, Limit: handshakeTimeout, Err: err}
+		}
+		return nil, flow.Annotate(err, flow.CodeTLSHandshakeFailure)
+	}
+
+	if sh, err := rec.ServerHello(); err == nil {
+		conn.ServerHello = sh
+	}
+	rec.Stop()
+
+	conn.Info, err = policy.Verify(config.ServerName, conn.State)
+	if presented != nil && presented.Leaf != nil {
+		conn.Info.ClientCertificate = presented.Leaf.Subject.String()
+	}
+	if err != nil && !skip {
+		conn.Close()
+		return nil, flow.NewError(flow.CodeTLSVerifyFailure, err)
+	}
+	if err != nil {
+		conn.Info.SkipVerify = true
+	}
+	return conn, nil
+}
+
+var (
+	defaultPolicyOnce sync.Once
+	defaultPolicy     *VerifyPolicy
+)
+
+// defaultVerifyPolicy 返回共享的仅使用系统根证书的校验策略
+func defaultVerifyPolicy() *VerifyPolicy {
+	defaultPolicyOnce.Do(func() {
+		defaultPolicy = NewVerifyPolicy()
+	})
+	return defaultPolicy
+}
+
+func handshakeStd(ctx context.Context, conn net.Conn, config *tls.Config) (*TLSConn, error) {
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return &TLSConn{Conn: tlsConn, State: tlsConn.ConnectionState()}, nil
+}
+
+func handshakeUTLS(ctx context.Context, conn net.Conn, config *tls.Config, id utls.ClientHelloID) (*TLSConn, error) {
+	uconfig := &utls.Config{
+		ServerName:         config.ServerName,
+		NextProtos:         config.NextProtos,
+		RootCAs:            config.RootCAs,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		KeyLogWriter:       config.KeyLogWriter,
+	}
+	if config.GetClientCertificate != nil {
+		uconfig.GetClientCertificate = func(info *utls.CertificateRequestInfo) (*utls.Certificate, error) {
+			cert, err := config.GetClientCertificate(&tls.CertificateRequestInfo{
+				AcceptableCAs: info.AcceptableCAs,
+				Version:       info.Version,
+			})
+			if err != nil || cert == nil {
+				return nil, err
+			}
+			return &utls.Certificate{
+				Certificate: cert.Certificate,
+				PrivateKey:  cert.PrivateKey,
+				Leaf:        cert.Leaf,
+			}, nil
+		}
+	}
+
+	// 预设的ALPN声明了h2，按调用方支持的协议改写后以自定义配置握手，
+	// 否则握手时会重新应用预设
+	spec, err := utls.UTLSIdToSpec(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range spec.Extensions {
+		if alpn, ok := ext.(*utls.ALPNExtension); ok {
+			alpn.AlpnProtocols = config.NextProtos
+		}
+	}
+	dropHybridCurves(&spec)
+	uconn := utls.UClient(conn, uconfig, utls.HelloCustom)
+	if err := uconn.ApplyPreset(&spec); err != nil {
+		return nil, err
+	}
+
+	if err := uconn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+
+	us := uconn.ConnectionState()
+	return &TLSConn{
+		Conn: uconn,
+		State: tls.ConnectionState{
+			Version:            us.Version,
+			HandshakeComplete:  us.HandshakeComplete,
+			DidResume:          us.DidResume,
+			CipherSuite:        us.CipherSuite,
+			NegotiatedProtocol: us.NegotiatedProtocol,
+			ServerName:         us.ServerName,
+			PeerCertificates:   us.PeerCertificates,
+			VerifiedChains:     us.VerifiedChains,
+			OCSPResponse:       us.OCSPResponse,
+		},
+	}, nil
+}
+
+// hybridCurves 只能在首个ClientHello中携带密钥的混合密钥交换组，utls 无法在 HelloRetryRequest 后补发
+var hybridCurves = []utls.CurveID{utls.X25519MLKEM768, utls.X25519Kyber768Draft00}
+
+// dropHybridCurves 从支持的曲线中去掉没有携带密钥的混合密钥交换组。随机生成的配置可能只声明不发送密钥，
+// 服务端优先选择时会要求重发，导致握手失败
+func dropHybridCurves(spec *utls.ClientHelloSpec) {
+	var shares []utls.CurveID
+	for _, ext := range spec.Extensions {
+		if ks, ok := ext.(*utls.KeyShareExtension); ok {
+			for _, share := range ks.KeyShares {
+				shares = append(shares, share.Group)
+			}
+		}
+	}
+	for _, ext := range spec.Extensions {
+		if sc, ok := ext.(*utls.SupportedCurvesExtension); ok {
+			sc.Curves = slices.DeleteFunc(sc.Curves, func(c utls.CurveID) bool {
+				return slices.Contains(hybridCurves, c) && !slices.Contains(shares, c)
+			})
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dialer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/f-dong/sniffy/ca"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// --- 辅助函数 ---
+
+// startH2Server 启动同时支持h2和HTTP/1.1的TLS服务，服务端优先选择h2
+func startH2Server(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.Listener.Addr().String()
+}
+
+// dialProfile 以 profile 模拟的ClientHello连接 addr，只声明 protos
+func dialProfile(t *testing.T, addr, profile string, protos ...string) (*TLSConn, error) {
+	t.Helper()
+	d := New()
+	require.NoError(t, d.SetClientHelloProfile(profile))
+	return d.DialTLSContext(context.Background(), "tcp", addr, &tls.Config{
+		ServerName:         "example.com",
+		NextProtos:         protos,
+		InsecureSkipVerify: true,
+	})
+}
+
+// testChain 用测试CA为 host 签发证书，返回信任该CA的校验策略、握手后的连接状态、叶子证书和CA证书
+func testChain(t *testing.T, host string) (*VerifyPolicy, tls.ConnectionState, *x509.Certificate, *x509.Certificate) {
+	t.Helper()
+	authority, err := ca.NewInMemorySelfSignedCA()
+	require.NoError(t, err)
+	cert, err := authority.IssueCert(host)
+	require.NoError(t, err)
+	var state tls.ConnectionState
+	for _, der := range cert.Certificate {
+		c, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		state.PeerCertificates = append(state.PeerCertificates, c)
+	}
+
+	policy := NewVerifyPolicy()
+	root := authority.GetCA()
+	require.NoError(t, policy.AddRootsPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})))
+	return policy, state, state.PeerCertificates[0], root
+}
+
+// pinOf 返回证书的 "sha256/<base64>" 公钥固定值
+func pinOf(cert *x509.Certificate) string {
+	return "sha256/" + tlsinfo.SPKIHash(cert)
+}
+
+// --- 测试代码 ---
+
+func TestDialTLSContext_ProfileALPN(t *testing.T) {
+	addr := startH2Server(t)
+	for _, profile := range ClientHelloProfiles() {
+		t.Run(profile, func(t *testing.T) {
+			conn, err := dialProfile(t, addr, profile, "http/1.1")
+			require.NoError(t, err)
+			defer conn.Close()
+			require.Equal(t, "http/1.1", conn.State.NegotiatedProtocol)
+
+			conn, err = dialProfile(t, addr, profile, "h2", "http/1.1")
+			require.NoError(t, err)
+			defer conn.Close()
+			require.Equal(t, "h2", conn.State.NegotiatedProtocol)
+		})
+	}
+}
+
+func TestDialTLSContext_RandomizedProfile(t *testing.T) {
+	addr := startH2Server(t)
+	// 每次握手生成不同的ClientHello，多次握手覆盖不同的曲线组合
+	for i := 0; i < 50; i++ {
+		conn, err := dialProfile(t, addr, "randomized", "http/1.1")
+		require.NoError(t, err, "handshake %d", i)
+		require.Equal(t, "http/1.1", conn.State.NegotiatedProtocol)
+		conn.Close()
+	}
+}
+
+func TestSetClientHelloProfile(t *testing.T) {
+	d := New()
+	require.NoError(t, d.SetClientHelloProfile("Chrome"))
+	require.NoError(t, d.SetClientHelloProfile(""))
+	require.ErrorContains(t, d.SetClientHelloProfile("opera"), `unknown ClientHello profile "opera"`)
+}
+
+func TestVerifyPolicy_Pins(t *testing.T) {
+	// 另一个CA签发的同名证书
+	_, _, otherLeaf, _ := testChain(t, "api.example.com")
+
+	tests := []struct {
+		name    string
+		pattern string
+		pin     func(leaf, root *x509.Certificate) string
+		pinned  bool
+		err     string
+	}{
+		{"leaf pin", "api.example.com", func(leaf, _ *x509.Certificate) string { return pinOf(leaf) }, true, ""},
+		{"CA pin", "api.example.com", func(_, root *x509.Certificate) string { return pinOf(root) }, true, ""},
+		{"wildcard pattern", "*.example.com", func(leaf, _ *x509.Certificate) string { return pinOf(leaf) }, true, ""},
+		{"pin for another host", "www.example.com", func(*x509.Certificate, *x509.Certificate) string { return pinOf(otherLeaf) }, false, ""},
+		{"mismatched pin", "api.example.com", func(*x509.Certificate, *x509.Certificate) string { return pinOf(otherLeaf) }, false, "no certificate in the chain matches the configured pins"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, state, leaf, root := testChain(t, "api.example.com")
+			policy.Pin(tt.pattern, tt.pin(leaf, root))
+			info, err := policy.Verify("api.example.com", state)
+			require.True(t, info.Verified, "chain should verify against the test CA")
+			require.Equal(t, tt.pinned, info.Pinned)
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			var verifyErr *VerifyError
+			require.True(t, errors.As(err, &verifyErr))
+			require.ErrorContains(t, err, tt.err)
+			require.Equal(t, tt.err, info.VerifyError)
+		})
+	}
+}
+
+func TestVerifyPolicy_SkipVerifyWithPin(t *testing.T) {
+	_, state, leaf, _ := testChain(t, "api.example.com")
+	_, _, otherLeaf, _ := testChain(t, "api.example.com")
+
+	// 不信任测试CA，证书链校验失败但被跳过，公钥固定仍然生效
+	policy := NewVerifyPolicy()
+	policy.SkipVerify("*.example.com")
+	policy.Pin("api.example.com", pinOf(leaf))
+	info, err := policy.Verify("api.example.com", state)
+	require.NoError(t, err)
+	require.True(t, info.SkipVerify)
+	require.False(t, info.Verified)
+	require.True(t, info.Pinned)
+
+	policy = NewVerifyPolicy()
+	policy.SkipVerify("*.example.com")
+	policy.Pin("api.example.com", pinOf(otherLeaf))
+	_, err = policy.Verify("api.example.com", state)
+	require.ErrorContains(t, err, "no certificate in the chain matches the configured pins")
+
+	// 不匹配跳过模式的主机仍然校验证书链
+	policy = NewVerifyPolicy()
+	policy.SkipVerify("*.example.org")
+	_, err = policy.Verify("api.example.com", state)
+	var verifyErr *VerifyError
+	require.True(t, errors.As(err, &verifyErr))
+}
+
+func TestParsePin(t *testing.T) {
+	host, pin, err := ParsePin("*.example.com=sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+	require.NoError(t, err)
+	require.Equal(t, "*.example.com", host)
+	require.Equal(t, "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", pin)
+
+	for _, s := range []string{
+		"example.com=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		"example.com=sha1/47DEQpj8HBSa",
+		"example.com",
+		"=sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+	} {
+		_, _, err := ParsePin(s)
+		require.ErrorContains(t, err, "expected host=sha256/<base64>", s)
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dialer
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxProxyAuthRounds 与上游代理认证握手的最大往返次数，NTLM需要两次
+const maxProxyAuthRounds = 4
+
+// ProxyAuth 上游代理认证方式
+type ProxyAuth interface {
+	// Scheme 认证方案名称，与 Proxy-Authenticate 头部比较时不区分大小写
+	Scheme() string
+
+	// NewHandshake 为一次到 proxyHost 的CONNECT开始新的认证握手
+	NewHandshake(proxyHost string) (Handshake, error)
+}
+
+// Handshake 一次上游代理认证握手的状态，NTLM等方案需要在同一连接上完成多次往返
+type Handshake interface {
+	// Step 根据代理上次返回的质询数据生成下一个 Proxy-Authorization 头部值，首次调用时 challenge 为nil
+	Step(challenge []byte) (string, error)
+}
+
+// UpstreamProxy 上游HTTP代理，所有上游连接都通过它的CONNECT隧道建立
+type UpstreamProxy struct {
+	// URL 代理地址，支持 http 和 https 协议，端口为空时分别使用8080和443
+	URL *url.URL
+
+	// Auth 代理认证方式，为nil时不认证
+	Auth ProxyAuth
+}
+
+// ProxyAuthError 上游代理拒绝认证
+type ProxyAuthError struct {
+	// Status 代理最后返回的状态行
+	Status string
+
+	// Offered 代理支持的认证方案
+	Offered []string
+}
+
+func (e *ProxyAuthError) Error() string {
+	if len(e.Offered) == 0 {
+		return fmt.Sprintf("upstream proxy authentication failed: %s", e.Status)
+	}
+	return fmt.Sprintf("upstream proxy authentication failed: %s (proxy offers %s)", e.Status, strings.Join(e.Offered, ", "))
+}
+
+// ParseUpstreamProxy 解析上游代理地址，缺少协议时视为 http，URL中的用户信息作为Basic认证凭据
+func ParseUpstreamProxy(s string) (*UpstreamProxy, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream proxy %q: %w", s, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid upstream proxy %q: unsupported scheme %q", s, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid upstream proxy %q: missing host", s)
+	}
+
+	p := &UpstreamProxy{URL: u}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		p.Auth = BasicAuth(u.User.Username(), password)
+		u.User = nil
+	}
+	return p, nil
+}
+
+// address 返回代理的 host:port
+func (p *UpstreamProxy) address() string {
+	if port := p.URL.Port(); port != "" {
+		return p.URL.Host
+	}
+	if p.URL.Scheme == "https" {
+		return net.JoinHostPort(p.URL.Hostname(), "443")
+	}
+	return net.JoinHostPort(p.URL.Hostname(), "8080")
+}
+
+// SetUpstreamProxy 设置上游代理，传入nil时直接连接上游
+func (d *Dialer) SetUpstreamProxy(p *UpstreamProxy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.upstream = p
+}
+
+// UpstreamProxy 返回当前的上游代理，未设置时为nil
+func (d *Dialer) UpstreamProxy() *UpstreamProxy {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.upstream
+}
+
+// dialViaProxy 连接上游代理并建立到 address 的CONNECT隧道。
+// 代理在认证往返中关闭连接时重新连接并从头开始握手
+func dialViaProxy(ctx context.Context, nd *net.Dialer, network string, p *UpstreamProxy, address string) (net.Conn, error) {
+	var hs Handshake
+	if p.Auth != nil {
+		var err error
+		if hs, err = p.Auth.NewHandshake(p.URL.Hostname()); err != nil {
+			return nil, fmt.Errorf("upstream proxy %s authentication: %w", p.Auth.Scheme(), err)
+		}
+	}
+
+	var challenge []byte
+	for range maxProxyAuthRounds {
+		conn, err := dialHappyEyeballs(ctx, nd, network, p.address())
+		if err != nil {
+			return nil, fmt.Errorf("dial upstream proxy: %w", err)
+		}
+		if p.URL.Scheme == "https" {
+			tc := tls.Client(conn, &tls.Config{ServerName: p.URL.Hostname()})
+			if err := tc.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("upstream proxy TLS handshake: %w", err)
+			}
+			conn = tc
+		}
+
+		retry, err := connectTunnel(ctx, conn, p, hs, challenge, address)
+		if err == nil {
+			return conn, nil
+		}
+		conn.Close()
+		if !retry {
+			return nil, err
+		}
+		// 代理关闭了连接，多次往返的握手需要重新开始
+		challenge = nil
+		if p.Auth != nil {
+			if hs, err = p.Auth.NewHandshake(p.URL.Hostname()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, errors.New("upstream proxy closed the connection during authentication")
+}
+
+// connectTunnel 在 conn 上发送CONNECT并按需完成认证握手。
+// 返回 retry 为true表示代理要求认证但关闭了连接，应重新连接后重试
+func connectTunnel(ctx context.Context, conn net.Conn, p *UpstreamProxy, hs Handshake, challenge []byte, address string) (retry bool, err error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	br := bufio.NewReader(conn)
+
+	for range maxProxyAuthRounds {
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: address},
+			Host:   address,
+			Header: make(http.Header),
+		}
+		if hs != nil {
+			value, err := hs.Step(challenge)
+			if err != nil {
+				return false, fmt.Errorf("upstream proxy %s authentication: %w", p.Auth.Scheme(), err)
+			}
+			if value != "" {
+				req.Header.Set("Proxy-Authorization", value)
+			}
+		}
+		if err := req.Write(conn); err != nil {
+			return false, fmt.Errorf("write CONNECT to upstream proxy: %w", err)
+		}
+
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			return false, fmt.Errorf("read CONNECT response from upstream proxy: %w", err)
+		}
+		if resp.StatusCode/100 == 2 {
+			if br.Buffered() > 0 {
+				return false, errors.New("upstream proxy sent data before the tunnel was established")
+			}
+			return false, nil
+		}
+
+		closing := resp.Close
+		if !closing {
+			// 丢弃响应体以便在同一连接上继续握手
+			if _, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxDiscardBody)); err != nil {
+				closing = true
+			}
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusProxyAuthRequired {
+			return false, fmt.Errorf("upstream proxy refused CONNECT %s: %s", address, resp.Status)
+		}
+		offered := resp.Header.Values("Proxy-Authenticate")
+		if hs == nil {
+			return false, &ProxyAuthError{Status: resp.Status, Offered: authSchemes(offered)}
+		}
+		next, ok := findChallenge(offered, p.Auth.Scheme())
+		if !ok || (len(next) == 0 && req.Header.Get("Proxy-Authorization") != "") {
+			// 代理不支持该方案，或没有继续握手的质询，即拒绝了已发送的凭据
+			return false, &ProxyAuthError{Status: resp.Status, Offered: authSchemes(offered)}
+		}
+		challenge = next
+		if closing {
+			return true, nil
+		}
+	}
+	return false, errors.New("upstream proxy authentication did not complete")
+}
+
+// maxDiscardBody 为继续认证握手而丢弃的407响应体最大长度
+const maxDiscardBody = 64 << 10
+
+// findChallenge 在 Proxy-Authenticate 头部中查找 scheme 方案的质询数据
+func findChallenge(values []string, scheme string) ([]byte, bool) {
+	for _, v := range values {
+		name, data, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if !strings.EqualFold(name, scheme) {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "" || strings.Contains(data, "=") && strings.Contains(data, "\"") {
+			// 不带数据或为 realm="..." 形式的参数
+			return nil, true
+		}
+		b, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, true
+		}
+		return b, true
+	}
+	return nil, false
+}
+
+// authSchemes 返回 Proxy-Authenticate 头部中的认证方案名称
+func authSchemes(values []string) []string {
+	var schemes []string
+	for _, v := range values {
+		name, _, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if name != "" {
+			schemes = append(schemes, name)
+		}
+	}
+	return schemes
+}
+
+// basicAuth Basic认证
+type basicAuth struct {
+	value string
+}
+
+// BasicAuth 返回使用用户名和密码的Basic认证
+func BasicAuth(user, password string) ProxyAuth {
+	return &basicAuth{value: "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))}
+}
+
+// Scheme 实现 ProxyAuth 接口
+func (a *basicAuth) Scheme() string {
+	return "Basic"
+}
+
+// NewHandshake 实现 ProxyAuth 接口
+func (a *basicAuth) NewHandshake(string) (Handshake, error) {
+	return a, nil
+}
+
+// Step 实现 Handshake 接口，Basic认证只有一次往返
+func (a *basicAuth) Step([]byte) (string, error) {
+	return a.value, nil
+}
+
+// ParseProxyAuth 解析上游代理认证配置，格式为：
+//
+//	basic:user:password
+//	ntlm:DOMAIN\user:password
+//	negotiate[:spn]
+//	negotiate:user@REALM:password
+func ParseProxyAuth(s string) (ProxyAuth, error) {
+	scheme, rest, _ := strings.Cut(s, ":")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		user, password, ok := strings.Cut(rest, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("invalid proxy auth %q (expected basic:user:password)", s)
+		}
+		return BasicAuth(user, password), nil
+	case "ntlm":
+		account, password, ok := strings.Cut(rest, ":")
+		if !ok || account == "" {
+			return nil, fmt.Errorf("invalid proxy auth %q (expected ntlm:DOMAIN\\user:password)", s)
+		}
+		domain, user, ok := strings.Cut(account, `\`)
+		if !ok {
+			user, domain, _ = strings.Cut(account, "@")
+		}
+		if user == "" {
+			return nil, fmt.Errorf("invalid proxy auth %q: missing user", s)
+		}
+		return NTLMAuth(domain, user, password), nil
+	case "negotiate", "kerberos":
+		principal, password, ok := strings.Cut(rest, ":")
+		if ok && strings.Contains(principal, "@") {
+			return NegotiatePasswordAuth(principal, password)
+		}
+		return NegotiateAuth(rest)
+	default:
+		return nil, fmt.Errorf("unknown proxy auth scheme %q (supported: basic, ntlm, negotiate)", scheme)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package dialer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// VerifyError 上游证书校验失败，携带已获取的证书链信息
+type VerifyError struct {
+	Info *tlsinfo.UpstreamTLS
+	Err  error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("upstream certificate verification for %s failed: %v", e.Info.ServerName, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyPolicy 上游证书校验策略：系统根证书加额外根证书、按主机跳过校验以及SPKI公钥固定
+type VerifyPolicy struct {
+	mu    sync.RWMutex
+	roots *x509.CertPool
+	skip  []string
+	pins  map[string][]string
+}
+
+// NewVerifyPolicy 创建使用系统根证书的校验策略
+func NewVerifyPolicy() *VerifyPolicy {
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+	return &VerifyPolicy{
+		roots: roots,
+		pins:  make(map[string][]string),
+	}
+}
+
+// AddRootsPEM 添加PEM编码的额外根证书
+func (p *VerifyPolicy) AddRootsPEM(pemData []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.roots.AppendCertsFromPEM(pemData) {
+		return errors.New("no certificates found in PEM data")
+	}
+	return nil
+}
+
+// AddRootsFile 从文件添加PEM编码的额外根证书
+func (p *VerifyPolicy) AddRootsFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := p.AddRootsPEM(data); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// SkipVerify 对匹配的主机跳过证书校验，模式支持 "*.example.com"，"*" 匹配所有主机
+func (p *VerifyPolicy) SkipVerify(patterns ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.skip = append(p.skip, patterns...)
+}
+
+// Pin 为匹配的主机固定证书链中某个证书的公钥，pin 格式为 "sha256/<base64>"
+func (p *VerifyPolicy) Pin(pattern string, pins ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pin := range pins {
+		p.pins[pattern] = append(p.pins[pattern], strings.TrimPrefix(pin, "sha256/"))
+	}
+}
+
+// ParsePin 解析 "host=sha256/<base64>" 形式的公钥固定配置
+func ParsePin(s string) (host, pin string, err error) {
+	host, pin, ok := strings.Cut(s, "=")
+	if !ok || host == "" || !strings.HasPrefix(pin, "sha256/") {
+		return "", "", fmt.Errorf("invalid pin %q (expected host=sha256/<base64>)", s)
+	}
+	return host, pin, nil
+}
+
+// Verify 校验上游连接状态，返回会话信息；校验失败且未跳过时返回 *VerifyError
+func (p *VerifyPolicy) Verify(serverName string, state tls.ConnectionState) (*tlsinfo.UpstreamTLS, error) {
+	info := tlsinfo.NewUpstreamTLS(serverName, state)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	info.SkipVerify = p.shouldSkip(serverName)
+	chains, err := p.verifyChain(serverName, state.PeerCertificates)
+	if err == nil {
+		info.Verified = true
+	} else {
+		info.VerifyError = err.Error()
+		if !info.SkipVerify {
+			return info, &VerifyError{Info: info, Err: err}
+		}
+	}
+
+	if pins := p.pinsFor(serverName); len(pins) > 0 {
+		if !matchPins(pins, state.PeerCertificates, chains) {
+			err := errors.New("no certificate in the chain matches the configured pins")
+			info.VerifyError = err.Error()
+			return info, &VerifyError{Info: info, Err: err}
+		}
+		info.Pinned = true
+	}
+
+	return info, nil
+}
+
+func (p *VerifyPolicy) verifyChain(serverName string, certs []*x509.Certificate) ([][]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates presented")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	return certs[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         p.roots,
+		Intermediates: intermediates,
+	})
+}
+
+func (p *VerifyPolicy) shouldSkip(host string) bool {
+	for _, pattern := range p.skip {
+		if pattern == "*" || tlsinfo.MatchHost(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *VerifyPolicy) pinsFor(host string) []string {
+	var pins []string
+	for pattern, values := range p.pins {
+		if pattern == "*" || tlsinfo.MatchHost(pattern, host) {
+			pins = append(pins, values...)
+		}
+	}
+	return pins
+}
+
+func matchPins(pins []string, certs []*x509.Certificate, chains [][]*x509.Certificate) bool {
+	candidates := append([]*x509.Certificate(nil), certs...)
+	for _, chain := range chains {
+		candidates = append(candidates, chain...)
+	}
+	for _, cert := range candidates {
+		hash := tlsinfo.SPKIHash(cert)
+		for _, pin := range pins {
+			if pin == hash {
+				return true
+			}
+		}
+	}
+	return false
+}
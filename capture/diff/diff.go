@@ -0,0 +1,459 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// DefaultIgnoreHeaders 默认不比较的头部，每次请求都会变化，或者只与传输有关（消息体按解码后的内容比较），
+// 比较它们只会产生噪音
+var DefaultIgnoreHeaders = []string{
+	"Date",
+	"Age",
+	"Expires",
+	"Content-Length",
+	"Content-Encoding",
+	"Traceparent",
+	"Tracestate",
+	"X-Request-Id",
+	"X-Amzn-Trace-Id",
+	"X-Amzn-Requestid",
+	"Cf-Ray",
+	"Server-Timing",
+}
+
+// maxLines 文本消息体逐行比较的最大行数乘积，超过时只报告内容不同
+const maxLines = 4 << 20
+
+// contextLines 文本差异中变化行前后保留的上下文行数
+const contextLines = 2
+
+// Kind 差异的类型
+type Kind string
+
+const (
+	// Added 只存在于 B
+	Added Kind = "added"
+	// Removed 只存在于 A
+	Removed Kind = "removed"
+	// Changed 两边的值不同
+	Changed Kind = "changed"
+)
+
+// Change 一处差异
+type Change struct {
+	Kind Kind `json:"kind"`
+
+	// Path 差异的位置：字段名、头部名称，或消息体中的JSON路径，例如 $.items[0].id
+	Path string `json:"path"`
+
+	// A 和 B 两边的值，不存在的一边为nil
+	A any `json:"a,omitempty"`
+	B any `json:"b,omitempty"`
+}
+
+// Body 消息体的差异
+type Body struct {
+	// Format 比较方式：json 按结构比较，text 逐行比较，binary 只比较内容是否相同
+	Format string `json:"format"`
+
+	// Changes JSON消息体的差异
+	Changes []*Change `json:"changes,omitempty"`
+
+	// Diff 文本消息体的差异，类似 unified diff 的格式
+	Diff string `json:"diff,omitempty"`
+
+	// SizeA 和 SizeB 两边解码后的消息体大小
+	SizeA int `json:"size_a"`
+	SizeB int `json:"size_b"`
+
+	// Note 无法完整比较的原因，例如消息体超过捕获限制被截断
+	Note string `json:"note,omitempty"`
+}
+
+// Part 请求或响应的差异
+type Part struct {
+	// Fields 方法、URL、状态码、协议等字段的差异
+	Fields []*Change `json:"fields,omitempty"`
+
+	// Header 头部的差异
+	Header []*Change `json:"header,omitempty"`
+
+	// Body 消息体的差异，内容相同时为nil
+	Body *Body `json:"body,omitempty"`
+}
+
+// Equal 报告请求或响应是否没有差异
+func (p *Part) Equal() bool {
+	return p == nil || (len(p.Fields) == 0 && len(p.Header) == 0 && p.Body == nil)
+}
+
+// Result 两个流的差异
+type Result struct {
+	// A 和 B 比较的两个流的ID
+	A string `json:"a"`
+	B string `json:"b"`
+
+	Request  *Part `json:"request,omitempty"`
+	Response *Part `json:"response,omitempty"`
+}
+
+// Equal 报告两个流是否没有差异
+func (r *Result) Equal() bool {
+	return r.Request.Equal() && r.Response.Equal()
+}
+
+// Options 比较选项
+type Options struct {
+	// IgnoreHeaders 不比较的头部，为nil时使用 DefaultIgnoreHeaders
+	IgnoreHeaders []string
+
+	// IgnorePaths 不比较的JSON路径，例如 $.timestamp，路径下的内容同样被忽略
+	IgnorePaths []string
+
+	// ResponseOnly 只比较响应，例如同一请求发往两个环境的结果
+	ResponseOnly bool
+}
+
+// Flows 比较两个流的请求和响应，opts 为nil时使用默认选项
+func Flows(a, b *flow.Flow, opts *Options) *Result {
+	if opts == nil {
+		opts = &Options{}
+	}
+	d := &differ{opts: opts}
+	r := &Result{A: a.ID, B: b.ID}
+	if !opts.ResponseOnly {
+		r.Request = d.requests(a.Request, b.Request)
+	}
+	r.Response = d.responses(a.Response, b.Response)
+	return r
+}
+
+// differ 保存比较选项
+type differ struct {
+	opts *Options
+}
+
+func (d *differ) requests(a, b *flow.Request) *Part {
+	if a == nil || b == nil {
+		return missing(a == nil, b == nil, "request")
+	}
+	p := &Part{}
+	p.Fields = fields(p.Fields, "method", a.Method, b.Method)
+	p.Fields = fields(p.Fields, "url", a.URL, b.URL)
+	p.Fields = fields(p.Fields, "proto", a.Proto, b.Proto)
+	p.Header = d.headers(a.Header, b.Header)
+	p.Body = d.body(a.Header, a.Body, a.Truncated(), b.Header, b.Body, b.Truncated())
+	return p
+}
+
+func (d *differ) responses(a, b *flow.Response) *Part {
+	if a == nil || b == nil {
+		return missing(a == nil, b == nil, "response")
+	}
+	p := &Part{}
+	if a.StatusCode != b.StatusCode {
+		p.Fields = append(p.Fields, &Change{Kind: Changed, Path: "status", A: a.StatusCode, B: b.StatusCode})
+	}
+	p.Fields = fields(p.Fields, "proto", a.Proto, b.Proto)
+	p.Header = d.headers(a.Header, b.Header)
+	p.Body = d.body(a.Header, a.Body, a.Truncated(), b.Header, b.Body, b.Truncated())
+	return p
+}
+
+// missing 返回只有一边存在请求或响应时的差异
+func missing(noA, noB bool, what string) *Part {
+	switch {
+	case noA && noB:
+		return nil
+	case noA:
+		return &Part{Fields: []*Change{{Kind: Added, Path: what}}}
+	default:
+		return &Part{Fields: []*Change{{Kind: Removed, Path: what}}}
+	}
+}
+
+// fields 在值不同时追加字段的差异
+func fields(changes []*Change, name, a, b string) []*Change {
+	if a == b {
+		return changes
+	}
+	return append(changes, &Change{Kind: Changed, Path: name, A: a, B: b})
+}
+
+// headers 按名称比较头部，同名头部的多个值整体比较
+func (d *differ) headers(a, b http.Header) []*Change {
+	ignore := d.opts.IgnoreHeaders
+	if ignore == nil {
+		ignore = DefaultIgnoreHeaders
+	}
+	skip := func(name string) bool {
+		return slices.ContainsFunc(ignore, func(h string) bool { return strings.EqualFold(h, name) })
+	}
+
+	var names []string
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var changes []*Change
+	for _, name := range names {
+		if skip(name) {
+			continue
+		}
+		va, inA := a[name]
+		vb, inB := b[name]
+		switch {
+		case !inA:
+			changes = append(changes, &Change{Kind: Added, Path: name, B: headerValue(vb)})
+		case !inB:
+			changes = append(changes, &Change{Kind: Removed, Path: name, A: headerValue(va)})
+		case !slices.Equal(va, vb):
+			changes = append(changes, &Change{Kind: Changed, Path: name, A: headerValue(va), B: headerValue(vb)})
+		}
+	}
+	return changes
+}
+
+// headerValue 返回头部取值的展示形式，单个值时为字符串
+func headerValue(values []string) any {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// body 比较解码后的消息体，内容相同时返回nil，超过捕获限制的消息体只比较捕获的部分
+func (d *differ) body(ha http.Header, a []byte, truncA bool, hb http.Header, b []byte, truncB bool) *Body {
+	a, errA := decode(ha, a)
+	b, errB := decode(hb, b)
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	result := &Body{SizeA: len(a), SizeB: len(b)}
+	switch {
+	case errA != nil || errB != nil:
+		result.Note = "cannot decode body, compared encoded content"
+	case truncA || truncB:
+		result.Note = "body exceeded the capture limit, compared the captured part"
+	}
+
+	if va, vb, ok := parseJSON(a, b); ok {
+		result.Format = "json"
+		d.json(&result.Changes, "$", va, vb)
+		if len(result.Changes) == 0 && result.Note == "" {
+			// 只有格式（空白、键的顺序）不同
+			return nil
+		}
+		return result
+	}
+	if utf8.Valid(a) && utf8.Valid(b) {
+		result.Format = "text"
+		if text, ok := lines(string(a), string(b)); ok {
+			result.Diff = text
+		} else {
+			result.Note = "body is too large to compare line by line"
+		}
+		return result
+	}
+	result.Format = "binary"
+	return result
+}
+
+// decode 按 Content-Encoding 解码消息体，失败时返回原始内容
+func decode(header http.Header, body []byte) ([]byte, error) {
+	decoded, _, err := flow.DecodeBody(header, body)
+	if err != nil {
+		return body, err
+	}
+	return decoded, nil
+}
+
+// parseJSON 解析两边的JSON消息体，任意一边不是JSON时返回false
+func parseJSON(a, b []byte) (va, vb any, ok bool) {
+	parse := func(data []byte) (any, bool) {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil || dec.More() {
+			return nil, false
+		}
+		return v, true
+	}
+	if len(bytes.TrimSpace(a)) == 0 || len(bytes.TrimSpace(b)) == 0 {
+		return nil, nil, false
+	}
+	if va, ok = parse(a); !ok {
+		return nil, nil, false
+	}
+	vb, ok = parse(b)
+	return va, vb, ok
+}
+
+// json 递归比较JSON值，对象按键比较，数组按下标比较
+func (d *differ) json(changes *[]*Change, path string, a, b any) {
+	if slices.Contains(d.opts.IgnorePaths, path) {
+		return
+	}
+	switch va := a.(type) {
+	case map[string]any:
+		vb, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		var keys []string
+		for k := range va {
+			keys = append(keys, k)
+		}
+		for k := range vb {
+			if _, ok := va[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			p := path + member(k)
+			x, inA := va[k]
+			y, inB := vb[k]
+			switch {
+			case slices.Contains(d.opts.IgnorePaths, p):
+			case !inA:
+				*changes = append(*changes, &Change{Kind: Added, Path: p, B: y})
+			case !inB:
+				*changes = append(*changes, &Change{Kind: Removed, Path: p, A: x})
+			default:
+				d.json(changes, p, x, y)
+			}
+		}
+		return
+	case []any:
+		vb, ok := b.([]any)
+		if !ok {
+			break
+		}
+		for i := range max(len(va), len(vb)) {
+			p := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case slices.Contains(d.opts.IgnorePaths, p):
+			case i >= len(va):
+				*changes = append(*changes, &Change{Kind: Added, Path: p, B: vb[i]})
+			case i >= len(vb):
+				*changes = append(*changes, &Change{Kind: Removed, Path: p, A: va[i]})
+			default:
+				d.json(changes, p, va[i], vb[i])
+			}
+		}
+		return
+	default:
+		if a == b {
+			return
+		}
+	}
+	*changes = append(*changes, &Change{Kind: Changed, Path: path, A: a, B: b})
+}
+
+// member 返回对象成员的路径片段，不是标识符的键使用方括号形式
+func member(key string) string {
+	ident := key != ""
+	for i, r := range key {
+		if !(r == '_' || r == '$' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || i > 0 && '0' <= r && r <= '9') {
+			ident = false
+			break
+		}
+	}
+	if ident {
+		return "." + key
+	}
+	return "[" + strconv.Quote(key) + "]"
+}
+
+// lines 逐行比较文本，返回带上下文的差异，行数过多时返回false
+func lines(a, b string) (string, bool) {
+	la, lb := splitLines(a), splitLines(b)
+	if len(la)*len(lb) > maxLines {
+		return "", false
+	}
+
+	// lcs[i][j] 为 la[i:] 和 lb[j:] 的最长公共子序列长度
+	lcs := make([][]int32, len(la)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(lb)+1)
+	}
+	for i := len(la) - 1; i >= 0; i-- {
+		for j := len(lb) - 1; j >= 0; j-- {
+			if la[i] == lb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type op struct {
+		kind byte
+		text string
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(la) || j < len(lb) {
+		switch {
+		case i < len(la) && j < len(lb) && la[i] == lb[j]:
+			ops = append(ops, op{' ', la[i]})
+			i, j = i+1, j+1
+		case i < len(la) && (j == len(lb) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', la[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', lb[j]})
+			j++
+		}
+	}
+
+	// 只保留变化行及其上下文，省略的部分用 ... 表示
+	keep := make([]bool, len(ops))
+	for k, o := range ops {
+		if o.kind != ' ' {
+			for c := max(0, k-contextLines); c <= min(len(ops)-1, k+contextLines); c++ {
+				keep[c] = true
+			}
+		}
+	}
+	var sb strings.Builder
+	for k, o := range ops {
+		if !keep[k] {
+			if k > 0 && keep[k-1] {
+				sb.WriteString("...\n")
+			}
+			continue
+		}
+		fmt.Fprintf(&sb, "%c %s\n", o.kind, o.text)
+	}
+	return sb.String(), true
+}
+
+// splitLines 按行分割文本，结尾的换行不产生空行
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
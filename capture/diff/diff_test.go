@@ -0,0 +1,151 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package diff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func newFlow(id string, status int, contentType, body string) *flow.Flow {
+	f := flow.New()
+	f.ID = id
+	f.Request = &flow.Request{Method: "GET", URL: "https://api.example.com/v1/items", Proto: "HTTP/1.1", Header: http.Header{}}
+	f.Response = &flow.Response{
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {contentType}, "Date": {"Mon, 01 Jan 2024 00:00:00 GMT"}},
+		Body:       []byte(body),
+	}
+	return f
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// --- 测试代码 ---
+func TestFlows_Equal(t *testing.T) {
+	a := newFlow("a", 200, "application/json", `{"id":1,"tags":["x"]}`)
+	b := newFlow("b", 200, "application/json", "{\n  \"tags\": [\"x\"],\n  \"id\": 1\n}")
+	b.Response.Header.Set("Date", "Tue, 02 Jan 2024 00:00:00 GMT")
+	a.Response.Header.Set("Content-Encoding", "gzip")
+	a.Response.Body = gzipped(t, string(a.Response.Body))
+
+	r := Flows(a, b, nil)
+	require.True(t, r.Equal(), "%+v", r.Response)
+	require.Equal(t, "a", r.A)
+	require.Equal(t, "b", r.B)
+}
+
+func TestFlows_JSON(t *testing.T) {
+	a := newFlow("a", 200, "application/json", `{"id":1,"name":"old","items":[1,2,3],"meta":{"ts":1},"gone":true,"a b":1}`)
+	b := newFlow("b", 500, "application/json", `{"id":"1","name":"new","items":[1,5],"meta":{"ts":2},"extra":null,"a b":2}`)
+	b.Request.URL = "https://staging.example.com/v1/items"
+	b.Response.Header.Set("X-Cache", "MISS")
+
+	r := Flows(a, b, &Options{IgnorePaths: []string{"$.meta.ts"}})
+	require.False(t, r.Equal())
+	require.Equal(t, []*Change{{Kind: Changed, Path: "url", A: a.Request.URL, B: b.Request.URL}}, r.Request.Fields)
+	require.Equal(t, []*Change{{Kind: Changed, Path: "status", A: 200, B: 500}}, r.Response.Fields)
+	require.Equal(t, []*Change{{Kind: Added, Path: "X-Cache", B: "MISS"}}, r.Response.Header)
+
+	body := r.Response.Body
+	require.Equal(t, "json", body.Format)
+	var paths []string
+	for _, c := range body.Changes {
+		paths = append(paths, string(c.Kind)+" "+c.Path)
+	}
+	require.Equal(t, []string{
+		`changed $["a b"]`,
+		"added $.extra",
+		"removed $.gone",
+		"changed $.id",
+		"changed $.items[1]",
+		"removed $.items[2]",
+		"changed $.name",
+	}, paths)
+	require.Equal(t, json.Number("1"), body.Changes[3].A)
+	require.Equal(t, "1", body.Changes[3].B)
+
+	// 只比较响应时忽略请求的差异
+	r = Flows(a, b, &Options{ResponseOnly: true})
+	require.Nil(t, r.Request)
+	require.Len(t, r.Response.Body.Changes, 8)
+}
+
+func TestFlows_Text(t *testing.T) {
+	a := newFlow("a", 200, "text/plain", "one\ntwo\nthree\nfour\nfive\nsix\nseven\n")
+	b := newFlow("b", 200, "text/plain", "one\ntwo\nthree\nFOUR\nfive\nsix\nseven\neight\n")
+	r := Flows(a, b, nil)
+	require.Equal(t, "text", r.Response.Body.Format)
+	require.Equal(t, `  two
+  three
+- four
++ FOUR
+  five
+  six
+  seven
++ eight
+`, r.Response.Body.Diff)
+
+	a.Response.Body = []byte{0xff, 0x00}
+	b.Response.Body = []byte{0xff, 0x01}
+	r = Flows(a, b, nil)
+	require.Equal(t, &Body{Format: "binary", SizeA: 2, SizeB: 2}, r.Response.Body)
+}
+
+func TestFlows_Headers(t *testing.T) {
+	a := newFlow("a", 200, "text/plain", "")
+	b := newFlow("b", 200, "text/html", "")
+	a.Request.Header["X-Multi"] = []string{"1", "2"}
+	b.Request.Header.Set("X-Request-Id", "r1")
+
+	r := Flows(a, b, nil)
+	require.Equal(t, []*Change{{Kind: Removed, Path: "X-Multi", A: []string{"1", "2"}}}, r.Request.Header)
+	require.Equal(t, []*Change{{Kind: Changed, Path: "Content-Type", A: "text/plain", B: "text/html"}}, r.Response.Header)
+
+	r = Flows(a, b, &Options{IgnoreHeaders: []string{"content-type", "x-multi"}})
+	require.Equal(t, []*Change{{Kind: Added, Path: "X-Request-Id", B: "r1"}}, r.Request.Header)
+	require.True(t, r.Response.Equal())
+
+	b.Response = nil
+	r = Flows(a, b, nil)
+	require.Equal(t, []*Change{{Kind: Removed, Path: "response"}}, r.Response.Fields)
+}
+
+func TestWriteText(t *testing.T) {
+	a := newFlow("a", 200, "application/json", `{"id":1}`)
+	b := newFlow("b", 404, "application/json", `{"id":2,"error":"missing"}`)
+	b.Response.Header.Del("Content-Type")
+
+	var out strings.Builder
+	require.NoError(t, Flows(a, b, nil).WriteText(&out))
+	require.Equal(t, `--- a
++++ b
+response status: 200 -> 404
+response header Content-Type: removed "application/json"
+response body $.error: added "missing"
+response body $.id: 1 -> 2
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, Flows(a, a, nil).WriteText(&out))
+	require.Equal(t, "--- a\n+++ a\nno differences\n", out.String())
+}
@@ -0,0 +1,82 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package diff
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteText 以便于阅读的文本形式写出差异，每处差异一行，文本消息体的差异逐行列出
+func (r *Result) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "--- %s\n+++ %s\n", r.A, r.B)
+	if r.Equal() {
+		fmt.Fprintln(bw, "no differences")
+	}
+	writePart(bw, "request", r.Request)
+	writePart(bw, "response", r.Response)
+	return bw.Flush()
+}
+
+func writePart(w io.Writer, name string, p *Part) {
+	if p.Equal() {
+		return
+	}
+	for _, c := range p.Fields {
+		writeChange(w, name+" "+c.Path, c)
+	}
+	for _, c := range p.Header {
+		writeChange(w, name+" header "+c.Path, c)
+	}
+	if b := p.Body; b != nil {
+		prefix := name + " body"
+		if b.Note != "" {
+			fmt.Fprintf(w, "%s: %s\n", prefix, b.Note)
+		}
+		switch {
+		case len(b.Changes) > 0:
+			for _, c := range b.Changes {
+				writeChange(w, prefix+" "+c.Path, c)
+			}
+		case b.Diff != "":
+			fmt.Fprintf(w, "%s:\n", prefix)
+			for line := range strings.Lines(b.Diff) {
+				fmt.Fprintf(w, "  %s", line)
+			}
+		default:
+			fmt.Fprintf(w, "%s: %s content differs (%d -> %d bytes)\n", prefix, b.Format, b.SizeA, b.SizeB)
+		}
+	}
+}
+
+func writeChange(w io.Writer, label string, c *Change) {
+	var line string
+	switch c.Kind {
+	case Added:
+		line = fmt.Sprintf("%s: added %s", label, value(c.B))
+	case Removed:
+		line = fmt.Sprintf("%s: removed %s", label, value(c.A))
+	default:
+		line = fmt.Sprintf("%s: %s -> %s", label, value(c.A), value(c.B))
+	}
+	fmt.Fprintln(w, strings.TrimRight(line, " "))
+}
+
+// value 返回差异一边的值的紧凑JSON形式
+func value(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,301 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultHost 未设置 DOCKER_HOST 时连接的Docker守护进程地址
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// requestTimeout 除执行命令以外每个API请求的超时
+const requestTimeout = 5 * time.Second
+
+// Container 容器的标识
+type Container struct {
+	// ID 容器的完整ID
+	ID string `json:"id"`
+
+	// Name 容器名称，不含开头的 /
+	Name string `json:"name"`
+
+	// Image 创建容器使用的镜像
+	Image string `json:"image,omitempty"`
+}
+
+// Network Docker网络
+type Network struct {
+	ID     string
+	Name   string
+	Driver string
+
+	// Bridge bridge 网络在主机上的网桥名称，例如 docker0
+	Bridge string
+
+	// Subnets 网络的IPv4和IPv6子网
+	Subnets []*net.IPNet
+}
+
+// Client Docker Engine API 客户端，只实现 sniffy 需要的接口
+type Client struct {
+	http *http.Client
+	base string
+}
+
+// NewClient 创建连接 host 的客户端，host 为 unix:///path 或 tcp://host:port，为空时使用
+// DOCKER_HOST 环境变量，仍为空时使用 DefaultHost。不支持 TLS 和 Windows 命名管道
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		if path == "" {
+			return nil, fmt.Errorf("invalid docker host %q: missing socket path", host)
+		}
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+		return &Client{http: &http.Client{Transport: transport}, base: "http://docker"}, nil
+	case "tcp", "http":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid docker host %q: missing address", host)
+		}
+		return &Client{http: &http.Client{}, base: "http://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q (expected unix:// or tcp://)", host)
+	}
+}
+
+// apiError 守护进程返回的错误
+type apiError struct {
+	Message string `json:"message"`
+}
+
+// do 发送请求并检查状态码，body 不为nil时以 contentType 发送
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var e apiError
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e) != nil || e.Message == "" {
+			e.Message = resp.Status
+		}
+		return nil, fmt.Errorf("docker: %s", e.Message)
+	}
+	return resp, nil
+}
+
+// call 发送JSON请求并把JSON响应解码到 out，out 为nil时丢弃响应
+func (c *Client) call(ctx context.Context, method, path string, in, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	resp, err := c.do(ctx, method, path, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("docker: decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// containerSummary GET /containers/json 返回的容器
+type containerSummary struct {
+	ID              string   `json:"Id"`
+	Names           []string `json:"Names"`
+	Image           string   `json:"Image"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress         string `json:"IPAddress"`
+			GlobalIPv6Address string `json:"GlobalIPv6Address"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// Addresses 返回运行中的容器在各个网络上的IP地址对应的容器
+func (c *Client) Addresses(ctx context.Context) (map[string]*Container, error) {
+	var list []containerSummary
+	if err := c.call(ctx, http.MethodGet, "/containers/json", nil, &list); err != nil {
+		return nil, err
+	}
+	addrs := make(map[string]*Container)
+	for _, s := range list {
+		container := &Container{ID: s.ID, Image: s.Image}
+		if len(s.Names) > 0 {
+			container.Name = strings.TrimPrefix(s.Names[0], "/")
+		}
+		for _, n := range s.NetworkSettings.Networks {
+			for _, addr := range []string{n.IPAddress, n.GlobalIPv6Address} {
+				if ip := net.ParseIP(addr); ip != nil {
+					addrs[ip.String()] = container
+				}
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// Network 返回名称或ID为 name 的网络
+func (c *Client) Network(ctx context.Context, name string) (*Network, error) {
+	var resp struct {
+		ID      string            `json:"Id"`
+		Name    string            `json:"Name"`
+		Driver  string            `json:"Driver"`
+		Options map[string]string `json:"Options"`
+		IPAM    struct {
+			Config []struct {
+				Subnet string `json:"Subnet"`
+			} `json:"Config"`
+		} `json:"IPAM"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/networks/"+url.PathEscape(name), nil, &resp); err != nil {
+		return nil, err
+	}
+	n := &Network{ID: resp.ID, Name: resp.Name, Driver: resp.Driver}
+	if n.Driver == "bridge" {
+		// 自定义 bridge 网络的网桥名称默认为 br- 加网络ID的前12位
+		n.Bridge = resp.Options["com.docker.network.bridge.name"]
+		if n.Bridge == "" && len(n.ID) >= 12 {
+			n.Bridge = "br-" + n.ID[:12]
+		}
+	}
+	for _, cfg := range resp.IPAM.Config {
+		if _, subnet, err := net.ParseCIDR(cfg.Subnet); err == nil {
+			n.Subnets = append(n.Subnets, subnet)
+		}
+	}
+	return n, nil
+}
+
+// CopyFile 以 mode 权限把 data 写入容器中的 dir/name，dir 必须已经存在
+func (c *Client) CopyFile(ctx context.Context, container, dir, name string, data []byte, mode int64) error {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	path := "/containers/" + url.PathEscape(container) + "/archive?path=" + url.QueryEscape(dir)
+	resp, err := c.do(ctx, http.MethodPut, path, "application/x-tar", &archive)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Exec 以 user 身份在容器中执行 cmd，返回退出码和合并的标准输出与标准错误
+func (c *Client) Exec(ctx context.Context, container, user string, cmd []string) (int, []byte, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := c.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(container)+"/exec", map[string]any{
+		"User":         user,
+		"Cmd":          cmd,
+		"AttachStdout": true,
+		"AttachStderr": true,
+	}, &created)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	start, err := json.Marshal(map[string]any{"Detach": false, "Tty": false})
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/exec/"+created.ID+"/start", "application/json", bytes.NewReader(start))
+	if err != nil {
+		return 0, nil, err
+	}
+	output, err := demux(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return 0, output, fmt.Errorf("docker: read exec output: %w", err)
+	}
+
+	var inspect struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/exec/"+created.ID+"/json", nil, &inspect); err != nil {
+		return 0, output, err
+	}
+	return inspect.ExitCode, output, nil
+}
+
+// demux 读取没有分配终端时的多路复用输出流：每帧以1字节的流类型、3字节填充和4字节大端长度开头
+func demux(r io.Reader) ([]byte, error) {
+	var out bytes.Buffer
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return out.Bytes(), nil
+			}
+			return out.Bytes(), err
+		}
+		if _, err := io.CopyN(&out, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return out.Bytes(), err
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// startDaemon 在 unix 套接字上启动模拟的Docker守护进程，返回连接它的客户端
+func startDaemon(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient("unix://" + path)
+	require.NoError(t, err)
+	return client
+}
+
+// writeJSON 以JSON写入响应
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// frame 编码一帧多路复用输出
+func frame(stream byte, data string) []byte {
+	header := make([]byte, 8, 8+len(data))
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	return append(header, data...)
+}
+
+const containersJSON = `[
+	{"Id": "c1", "Names": ["/web"], "Image": "nginx:alpine",
+	 "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.2", "GlobalIPv6Address": "fd00::2"}}}},
+	{"Id": "c2", "Names": ["/db"], "Image": "postgres",
+	 "NetworkSettings": {"Networks": {"app": {"IPAddress": "172.18.0.3", "GlobalIPv6Address": ""}}}}
+]`
+
+// --- 测试代码 ---
+
+func TestNewClient(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "tcp://127.0.0.1:2375")
+	client, err := NewClient("")
+	require.NoError(t, err)
+	require.Equal(t, "http://127.0.0.1:2375", client.base)
+
+	for _, host := range []string{"npipe:////./pipe/docker_engine", "unix://", "tcp://", "ssh://user@host"} {
+		_, err := NewClient(host)
+		require.Error(t, err, host)
+	}
+}
+
+func TestClient(t *testing.T) {
+	var archive []byte
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/json", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, containersJSON)
+	})
+	mux.HandleFunc("GET /networks/{name}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("name") {
+		case "bridge":
+			io.WriteString(w, `{"Id": "0123456789abcdef", "Name": "bridge", "Driver": "bridge",
+				"Options": {"com.docker.network.bridge.name": "docker0"},
+				"IPAM": {"Config": [{"Subnet": "172.17.0.0/16"}, {"Subnet": "fd00::/64"}]}}`)
+		case "app":
+			io.WriteString(w, `{"Id": "fedcba9876543210", "Name": "app", "Driver": "bridge", "Options": {},
+				"IPAM": {"Config": [{"Subnet": "172.18.0.0/16"}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]string{"message": "No such network: " + r.PathValue("name")})
+		}
+	})
+	mux.HandleFunc("PUT /containers/web/archive", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/tmp", r.URL.Query().Get("path"))
+		archive, _ = io.ReadAll(r.Body)
+	})
+	mux.HandleFunc("POST /containers/web/exec", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			User string
+			Cmd  []string
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "0", req.User)
+		require.Equal(t, []string{"update-ca-certificates"}, req.Cmd)
+		writeJSON(w, map[string]string{"Id": "e1"})
+	})
+	mux.HandleFunc("POST /exec/e1/start", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(frame(1, "Updating certificates\n"))
+		w.Write(frame(2, "1 added\n"))
+	})
+	mux.HandleFunc("GET /exec/e1/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]int{"ExitCode": 3})
+	})
+	client := startDaemon(t, mux)
+	ctx := context.Background()
+
+	addrs, err := client.Addresses(ctx)
+	require.NoError(t, err)
+	require.Len(t, addrs, 3)
+	require.Equal(t, &Container{ID: "c1", Name: "web", Image: "nginx:alpine"}, addrs["172.17.0.2"])
+	require.Same(t, addrs["172.17.0.2"], addrs["fd00::2"])
+	require.Equal(t, "db", addrs["172.18.0.3"].Name)
+
+	_, err = client.Network(ctx, "missing")
+	require.EqualError(t, err, "docker: No such network: missing")
+
+	n, err := client.Network(ctx, "bridge")
+	require.NoError(t, err)
+	require.Equal(t, "docker0", n.Bridge)
+	require.Len(t, n.Subnets, 2)
+	n, err = client.Network(ctx, "app")
+	require.NoError(t, err)
+	require.Equal(t, "br-fedcba987654", n.Bridge)
+
+	require.NoError(t, client.CopyFile(ctx, "web", "/tmp", "sniffy-ca.crt", []byte("PEM"), 0o644))
+	tr := tar.NewReader(bytes.NewReader(archive))
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, "sniffy-ca.crt", hdr.Name)
+	data, _ := io.ReadAll(tr)
+	require.Equal(t, "PEM", string(data))
+
+	code, output, err := client.Exec(ctx, "web", "0", []string{"update-ca-certificates"})
+	require.NoError(t, err)
+	require.Equal(t, 3, code)
+	require.Equal(t, "Updating certificates\n1 added\n", string(output))
+}
+
+func TestResolver(t *testing.T) {
+	var calls atomic.Int32
+	client := startDaemon(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		io.WriteString(w, containersJSON)
+	}))
+	r := NewResolver(client)
+	ctx := context.Background()
+
+	c, err := r.Lookup(ctx, net.ParseIP("172.17.0.2"))
+	require.NoError(t, err)
+	require.Equal(t, "web", c.Name)
+	c, err = r.Lookup(ctx, net.ParseIP("172.18.0.3"))
+	require.NoError(t, err)
+	require.Equal(t, "db", c.Name)
+
+	// 刚刷新过时未知地址不再列出容器
+	c, err = r.Lookup(ctx, net.ParseIP("10.0.0.1"))
+	require.NoError(t, err)
+	require.Nil(t, c)
+	require.EqualValues(t, 1, calls.Load())
+
+	var none *Resolver
+	c, err = none.Lookup(ctx, net.ParseIP("172.17.0.2"))
+	require.NoError(t, err)
+	require.Nil(t, c)
+}
+
+func TestRedirectRules(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("172.17.0.0/16")
+	_, v6, _ := net.ParseCIDR("fd00::/64")
+	n := &Network{Name: "bridge", Driver: "bridge", Bridge: "docker0", Subnets: []*net.IPNet{v4, v6}}
+
+	rules, err := RedirectRules(n, 8081, []int{80, 443}, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"iptables -t nat -A PREROUTING -i docker0 -s 172.17.0.0/16 ! -d 172.17.0.0/16 -p tcp -m multiport --dports 80,443 -m comment --comment sniffy -j REDIRECT --to-ports 8081",
+		"ip6tables -t nat -A PREROUTING -i docker0 -s fd00::/64 ! -d fd00::/64 -p tcp -m multiport --dports 80,443 -m comment --comment sniffy -j REDIRECT --to-ports 8081",
+	}, rules)
+
+	rules, err = RedirectRules(n, 8081, []int{80}, true)
+	require.NoError(t, err)
+	require.Contains(t, rules[0], "-t nat -D PREROUTING")
+
+	_, err = RedirectRules(&Network{Name: "host", Driver: "host"}, 8081, []int{80}, false)
+	require.EqualError(t, err, "network host uses the host driver, only bridge networks can be redirected")
+}
@@ -0,0 +1,56 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ruleComment 添加的规则带有的注释，便于在 iptables -t nat -S 的输出中找到
+const ruleComment = "sniffy"
+
+// RedirectRules 返回把网络 n 中的容器发往 ports 端口的TCP连接重定向到本机 proxyPort 端口的
+// iptables 和 ip6tables 命令，remove 为true时返回删除这些规则的命令。
+// 规则位于 nat 表的 PREROUTING 链，只匹配从网桥进入的连接，代理自己发起的连接不受影响
+func RedirectRules(n *Network, proxyPort int, ports []int, remove bool) ([]string, error) {
+	if n.Driver != "bridge" || n.Bridge == "" {
+		return nil, fmt.Errorf("network %s uses the %s driver, only bridge networks can be redirected", n.Name, n.Driver)
+	}
+	if len(n.Subnets) == 0 {
+		return nil, fmt.Errorf("network %s has no subnet", n.Name)
+	}
+	if len(ports) == 0 || len(ports) > 15 {
+		return nil, fmt.Errorf("expected 1 to 15 destination ports, got %d", len(ports))
+	}
+	action := "-A"
+	if remove {
+		action = "-D"
+	}
+	dports := make([]string, len(ports))
+	for i, p := range ports {
+		dports[i] = strconv.Itoa(p)
+	}
+
+	var rules []string
+	for _, subnet := range n.Subnets {
+		command := "iptables"
+		if subnet.IP.To4() == nil {
+			command = "ip6tables"
+		}
+		// 同一网络内容器之间的连接不重定向
+		rules = append(rules, strings.Join([]string{
+			command, "-t nat", action, "PREROUTING",
+			"-i", n.Bridge,
+			"-s", subnet.String(), "!", "-d", subnet.String(),
+			"-p tcp -m multiport --dports", strings.Join(dports, ","),
+			"-m comment --comment", ruleComment,
+			"-j REDIRECT --to-ports", strconv.Itoa(proxyPort),
+		}, " "))
+	}
+	return rules, nil
+}
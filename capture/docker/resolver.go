@@ -0,0 +1,61 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// missInterval 未知地址触发重新列出容器的最小间隔
+	missInterval = 2 * time.Second
+
+	// maxAge 缓存的地址的有效期，容器停止后地址可能分配给新的容器
+	maxAge = 30 * time.Second
+)
+
+// Resolver 按客户端IP地址查找发起连接的容器，缓存容器列表
+type Resolver struct {
+	client *Client
+
+	mu        sync.Mutex
+	addrs     map[string]*Container
+	refreshed time.Time
+}
+
+// NewResolver 创建通过 client 列出容器的查找器
+func NewResolver(client *Client) *Resolver {
+	return &Resolver{client: client}
+}
+
+// Lookup 返回地址为 ip 的容器，不是容器的地址时返回nil。
+// 地址不在缓存中时最多每 missInterval 重新列出一次容器，新启动的容器也能找到
+func (r *Resolver) Lookup(ctx context.Context, ip net.IP) (*Container, error) {
+	if r == nil || ip == nil {
+		return nil, nil
+	}
+	key := ip.String()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	age := time.Since(r.refreshed)
+	if c, ok := r.addrs[key]; ok && age < maxAge {
+		return c, nil
+	}
+	if age < missInterval {
+		return nil, nil
+	}
+	r.refreshed = time.Now()
+	addrs, err := r.client.Addresses(ctx)
+	if err != nil {
+		r.addrs = nil
+		return nil, err
+	}
+	r.addrs = addrs
+	return addrs[key], nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package duplicates
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Tag 重复请求的标签，添加在窗口内第二个及之后的请求上
+const Tag = "duplicate"
+
+// DefaultWindow 默认的时间窗口
+const DefaultWindow = 2 * time.Second
+
+// Options 判断重复请求的条件
+type Options struct {
+	// Window 与上一个相同请求的间隔不超过该时间时视为重复，0表示 DefaultWindow
+	Window time.Duration
+
+	// IgnoreParams 比较URL时忽略的查询参数，例如防缓存的时间戳 _、t
+	IgnoreParams []string
+}
+
+// window 返回时间窗口
+func (o Options) window() time.Duration {
+	if o.Window <= 0 {
+		return DefaultWindow
+	}
+	return o.Window
+}
+
+// Key 请求的指纹，方法、URL和请求体都相同的请求指纹相同
+type Key struct {
+	Method string `json:"method"`
+
+	// URL 规范化后的URL：主机名小写、不含片段和忽略的参数、查询参数排序
+	URL string `json:"url"`
+
+	// BodyHash 请求体的SHA-256（十六进制），JSON请求体先按键排序，没有请求体时为空
+	BodyHash string `json:"body_hash,omitempty"`
+}
+
+// NewKey 返回请求的指纹
+func (o Options) NewKey(req *flow.Request) Key {
+	return Key{Method: strings.ToUpper(req.Method), URL: o.normalize(req.URL), BodyHash: bodyHash(req.Body)}
+}
+
+// normalize 规范化URL，查询参数的顺序不影响比较
+func (o Options) normalize(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment, u.RawFragment = "", ""
+	if u.RawQuery != "" {
+		q := u.Query()
+		for _, name := range o.IgnoreParams {
+			q.Del(name)
+		}
+		// Encode 按参数名排序
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// bodyHash 返回请求体的摘要，JSON请求体重新编码以忽略键的顺序和空白
+func bodyHash(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v any
+	if json.Valid(body) && json.Unmarshal(body, &v) == nil {
+		if canonical, err := json.Marshal(v); err == nil {
+			body = canonical
+		}
+	} else {
+		body = bytes.TrimSpace(body)
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Tracker 在代理运行时标记窗口内的重复请求，可以并发使用
+type Tracker struct {
+	opts Options
+
+	mu     sync.Mutex
+	last   map[Key]time.Time
+	pruned time.Time
+}
+
+// NewTracker 创建重复请求的标记器
+func NewTracker(opts Options) *Tracker {
+	return &Tracker{opts: opts, last: map[Key]time.Time{}}
+}
+
+// Apply 记录流的请求，与窗口内的相同请求重复时添加 Tag 标签。为nil时不做任何处理
+func (t *Tracker) Apply(f *flow.Flow) {
+	if t == nil || f.Request == nil {
+		return
+	}
+	window := t.opts.window()
+	key := t.opts.NewKey(f.Request)
+	at := f.StartTime
+
+	t.mu.Lock()
+	prev, ok := t.last[key]
+	if !ok || at.After(prev) {
+		t.last[key] = at
+	}
+	// 定期清理窗口外的记录，避免长时间运行时无限增长
+	if at.Sub(t.pruned) > window {
+		for k, seen := range t.last {
+			if at.Sub(seen) > window {
+				delete(t.last, k)
+			}
+		}
+		t.pruned = at
+	}
+	t.mu.Unlock()
+
+	if ok && absDuration(at.Sub(prev)) <= window {
+		f.Tag(Tag)
+	}
+}
+
+// Group 一组在窗口内连续发出的相同请求
+type Group struct {
+	Key
+
+	// Count 组内的请求数
+	Count int `json:"count"`
+
+	// Flows 组内的流ID，按请求时间排序
+	Flows []string `json:"flows"`
+
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+
+	// MinGapMS 相邻请求的最短间隔（毫秒）
+	MinGapMS float64 `json:"min_gap_ms"`
+}
+
+// Report 重复请求的汇总
+type Report struct {
+	Generated time.Time `json:"generated"`
+
+	// Window 判断重复使用的时间窗口，例如 "2s"
+	Window string `json:"window"`
+
+	// Requests 参与分析的请求数
+	Requests int `json:"requests"`
+
+	// Duplicates 多余的请求数，即每组请求数减一之和
+	Duplicates int `json:"duplicates"`
+
+	// Groups 按请求数排序
+	Groups []*Group `json:"groups"`
+}
+
+// Analyze 按请求时间找出窗口内的重复请求。同一指纹的请求与前一个请求的间隔不超过窗口时归入同一组，
+// 只报告包含两个及以上请求的组
+func Analyze(flows []*flow.Flow, opts Options) *Report {
+	window := opts.window()
+	flows = slices.Clone(flows)
+	slices.SortStableFunc(flows, func(a, b *flow.Flow) int { return a.StartTime.Compare(b.StartTime) })
+
+	report := &Report{Generated: time.Now().UTC(), Window: window.String(), Groups: []*Group{}}
+	open := map[Key]*Group{}
+	var groups []*Group
+	for _, f := range flows {
+		if f.Request == nil {
+			continue
+		}
+		report.Requests++
+		key := opts.NewKey(f.Request)
+		g := open[key]
+		if g != nil && f.StartTime.Sub(g.Last) <= window {
+			gap := float64(f.StartTime.Sub(g.Last)) / float64(time.Millisecond)
+			if g.Count == 1 || gap < g.MinGapMS {
+				g.MinGapMS = gap
+			}
+			g.Count++
+			g.Flows = append(g.Flows, f.ID)
+			g.Last = f.StartTime
+			continue
+		}
+		g = &Group{Key: key, Count: 1, Flows: []string{f.ID}, First: f.StartTime, Last: f.StartTime}
+		open[key] = g
+		groups = append(groups, g)
+	}
+	for _, g := range groups {
+		if g.Count < 2 {
+			continue
+		}
+		report.Duplicates += g.Count - 1
+		report.Groups = append(report.Groups, g)
+	}
+	slices.SortStableFunc(report.Groups, func(a, b *Group) int { return cmp.Compare(b.Count, a.Count) })
+	return report
+}
+
+// WriteText 以文本形式输出报告
+func (r *Report) WriteText(w io.Writer) error {
+	for _, g := range r.Groups {
+		line := fmt.Sprintf("%dx %s %s", g.Count, g.Method, g.URL)
+		if g.BodyHash != "" {
+			line += "  body " + g.BodyHash[:12]
+		}
+		_, err := fmt.Fprintf(w, "%s  within %v (min gap %.0fms)\n  flows: %s\n",
+			line, g.Last.Sub(g.First).Round(time.Millisecond), g.MinGapMS, strings.Join(g.Flows, " "))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d requests, %d duplicates in %d groups (window %s)\n", r.Requests, r.Duplicates, len(r.Groups), r.Window)
+	return err
+}
+
+// absDuration 返回时间间隔的绝对值
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
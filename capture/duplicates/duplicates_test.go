@@ -0,0 +1,100 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package duplicates
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+var start = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// newFlow 返回在 start 之后 offset 发起的请求
+func newFlow(id, method, rawURL, body string, offset time.Duration) *flow.Flow {
+	f := flow.New()
+	f.ID = id
+	f.StartTime = start.Add(offset)
+	f.Request = &flow.Request{Method: method, URL: rawURL, Body: []byte(body)}
+	return f
+}
+
+// --- 测试代码 ---
+
+func TestOptions_NewKey(t *testing.T) {
+	opts := Options{IgnoreParams: []string{"_"}}
+	a := opts.NewKey(&flow.Request{Method: "post", URL: "https://API.example.com/search?b=2&a=1&_=123#top", Body: []byte(`{"q":"x","page":1}`)})
+	b := opts.NewKey(&flow.Request{Method: "POST", URL: "https://api.example.com/search?a=1&b=2&_=456", Body: []byte(`{ "page": 1, "q": "x" }`)})
+	require.Equal(t, a, b)
+	require.Equal(t, "https://api.example.com/search?a=1&b=2", a.URL)
+	require.Len(t, a.BodyHash, 64)
+
+	c := opts.NewKey(&flow.Request{Method: "POST", URL: "https://api.example.com/search?a=1&b=2", Body: []byte(`{"q":"y","page":1}`)})
+	require.NotEqual(t, a, c)
+	require.Empty(t, opts.NewKey(&flow.Request{Method: "GET", URL: "/"}).BodyHash)
+}
+
+func TestAnalyze(t *testing.T) {
+	report := Analyze([]*flow.Flow{
+		newFlow("1", "GET", "https://api.example.com/feed", "", 0),
+		newFlow("3", "GET", "https://api.example.com/feed", "", 900*time.Millisecond),
+		newFlow("2", "GET", "https://api.example.com/feed", "", 300*time.Millisecond),
+		// 与上一个请求间隔超过窗口，开始新的一组
+		newFlow("4", "GET", "https://api.example.com/feed", "", 5*time.Second),
+		newFlow("5", "POST", "https://api.example.com/like", `{"id":1}`, 0),
+		newFlow("6", "POST", "https://api.example.com/like", `{"id":1}`, time.Second),
+		newFlow("7", "POST", "https://api.example.com/like", `{"id":2}`, time.Second),
+	}, Options{Window: time.Second})
+	require.Equal(t, "1s", report.Window)
+	require.Equal(t, 7, report.Requests)
+	require.Equal(t, 3, report.Duplicates)
+	require.Len(t, report.Groups, 2)
+
+	feed := report.Groups[0]
+	require.Equal(t, []string{"1", "2", "3"}, feed.Flows)
+	require.Equal(t, 3, feed.Count)
+	require.Equal(t, float64(300), feed.MinGapMS)
+	require.Equal(t, start.Add(900*time.Millisecond), feed.Last)
+
+	like := report.Groups[1]
+	require.Equal(t, "POST", like.Method)
+	require.Equal(t, []string{"5", "6"}, like.Flows)
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker(Options{})
+	first := newFlow("1", "GET", "https://api.example.com/feed", "", 0)
+	retry := newFlow("2", "GET", "https://api.example.com/feed", "", time.Second)
+	later := newFlow("3", "GET", "https://api.example.com/feed", "", 10*time.Second)
+	other := newFlow("4", "GET", "https://api.example.com/other", "", 10*time.Second)
+	for _, f := range []*flow.Flow{first, retry, later, other} {
+		tracker.Apply(f)
+	}
+	require.Empty(t, first.Tags)
+	require.Equal(t, []string{Tag}, retry.Tags)
+	require.Empty(t, later.Tags)
+	require.Empty(t, other.Tags)
+
+	// 窗口外的记录被清理
+	require.Len(t, tracker.last, 2)
+	(*Tracker)(nil).Apply(first)
+}
+
+func TestReport_WriteText(t *testing.T) {
+	report := Analyze([]*flow.Flow{
+		newFlow("a", "GET", "https://x.example.com/", "", 0),
+		newFlow("b", "GET", "https://x.example.com/", "", 250*time.Millisecond),
+	}, Options{})
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteText(&buf))
+	require.Equal(t, "2x GET https://x.example.com/  within 250ms (min gap 250ms)\n  flows: a b\n"+
+		"2 requests, 1 duplicates in 1 groups (window 2s)\n", buf.String())
+}
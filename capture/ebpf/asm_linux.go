@@ -0,0 +1,190 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package ebpf
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// 寄存器，r0 为返回值，r1-r5 为参数且在调用后失效，r6-r9 在调用后保留，r10 为只读的栈帧指针
+const (
+	r0 uint8 = iota
+	r1
+	r2
+	r3
+	r4
+	r5
+	r6
+	r7
+	r8
+	r9
+	r10
+)
+
+// 内核辅助函数编号，见 include/uapi/linux/bpf.h 中的 __BPF_FUNC_MAPPER
+const (
+	fnMapLookupElem      = 1
+	fnMapUpdateElem      = 2
+	fnMapDeleteElem      = 3
+	fnGetCurrentPidTgid  = 14
+	fnGetSocketCookie    = 46
+	fnGetCurrentCgroupID = 80
+)
+
+// insnSize 一条指令的字节数，加载64位立即数的指令占两条
+const insnSize = 8
+
+// instruction 一条eBPF指令。label 不为空时是标记下一条指令位置的伪指令，
+// jump 不为空时指令的偏移量由 assemble 按目标标记计算
+type instruction struct {
+	op    uint8
+	dst   uint8
+	src   uint8
+	off   int16
+	imm   int32
+	label string
+	jump  string
+}
+
+// slots 指令占用的指令槽数量
+func (i instruction) slots() int {
+	switch {
+	case i.label != "":
+		return 0
+	case i.op == unix.BPF_LD|unix.BPF_DW|unix.BPF_IMM:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// label 标记下一条指令的位置
+func label(name string) instruction {
+	return instruction{label: name}
+}
+
+// movReg dst = src
+func movReg(dst, src uint8) instruction {
+	return instruction{op: unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_X, dst: dst, src: src}
+}
+
+// movImm dst = imm，立即数按符号扩展到64位
+func movImm(dst uint8, imm int32) instruction {
+	return instruction{op: unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K, dst: dst, imm: imm}
+}
+
+// mov32Imm 低32位 dst = imm，高32位清零
+func mov32Imm(dst uint8, imm uint32) instruction {
+	return instruction{op: unix.BPF_ALU | unix.BPF_MOV | unix.BPF_K, dst: dst, imm: int32(imm)}
+}
+
+// aluImm dst op= imm，op 为 BPF_ADD、BPF_RSH 等
+func aluImm(op, dst uint8, imm int32) instruction {
+	return instruction{op: unix.BPF_ALU64 | op | unix.BPF_K, dst: dst, imm: imm}
+}
+
+// alu32Imm 低32位 dst op= imm
+func alu32Imm(op, dst uint8, imm uint32) instruction {
+	return instruction{op: unix.BPF_ALU | op | unix.BPF_K, dst: dst, imm: int32(imm)}
+}
+
+// load dst = *(size *)(src + off)，size 为 BPF_W、BPF_H 等
+func load(size, dst, src uint8, off int16) instruction {
+	return instruction{op: unix.BPF_LDX | unix.BPF_MEM | size, dst: dst, src: src, off: off}
+}
+
+// store *(size *)(dst + off) = src
+func store(size, dst uint8, off int16, src uint8) instruction {
+	return instruction{op: unix.BPF_STX | unix.BPF_MEM | size, dst: dst, src: src, off: off}
+}
+
+// storeImm *(size *)(dst + off) = imm，内核不允许以这种方式写入上下文
+func storeImm(size, dst uint8, off int16, imm int32) instruction {
+	return instruction{op: unix.BPF_ST | unix.BPF_MEM | size, dst: dst, off: off, imm: imm}
+}
+
+// jump64Imm 64位比较 dst op imm 成立时跳转到 target
+func jump64Imm(op, dst uint8, imm int32, target string) instruction {
+	return instruction{op: unix.BPF_JMP | op | unix.BPF_K, dst: dst, imm: imm, jump: target}
+}
+
+// jumpImm 32位比较 dst op imm 成立时跳转到 target，寄存器中从上下文读取的32位字段不受符号扩展影响
+func jumpImm(op, dst uint8, imm uint32, target string) instruction {
+	return instruction{op: unix.BPF_JMP32 | op | unix.BPF_K, dst: dst, imm: int32(imm), jump: target}
+}
+
+// jumpTo 无条件跳转到 target
+func jumpTo(target string) instruction {
+	return instruction{op: unix.BPF_JMP | unix.BPF_JA, jump: target}
+}
+
+// call 调用内核辅助函数 fn，参数为 r1-r5，返回值在 r0
+func call(fn int32) instruction {
+	return instruction{op: unix.BPF_JMP | unix.BPF_CALL, imm: fn}
+}
+
+// exit 返回 r0
+func exit() instruction {
+	return instruction{op: unix.BPF_JMP | unix.BPF_EXIT}
+}
+
+// loadMap dst = 文件描述符为 fd 的映射，加载程序时内核替换为映射的地址
+func loadMap(dst uint8, fd int) instruction {
+	return instruction{op: unix.BPF_LD | unix.BPF_DW | unix.BPF_IMM, dst: dst, src: unix.BPF_PSEUDO_MAP_FD, imm: int32(fd)}
+}
+
+// assemble 计算跳转偏移量并按本机字节序编码指令
+func assemble(insns []instruction) ([]byte, error) {
+	labels := make(map[string]int)
+	pc := 0
+	for _, i := range insns {
+		if i.label != "" {
+			if _, ok := labels[i.label]; ok {
+				return nil, fmt.Errorf("ebpf: duplicate label %q", i.label)
+			}
+			labels[i.label] = pc
+		}
+		pc += i.slots()
+	}
+
+	out := make([]byte, 0, pc*insnSize)
+	pc = 0
+	for _, i := range insns {
+		if i.label != "" {
+			continue
+		}
+		if i.jump != "" {
+			target, ok := labels[i.jump]
+			if !ok {
+				return nil, fmt.Errorf("ebpf: undefined label %q", i.jump)
+			}
+			i.off = int16(target - pc - 1)
+		}
+		out = appendInsn(out, i.op, i.dst, i.src, i.off, i.imm)
+		if i.slots() == 2 {
+			// 第二个指令槽保存立即数的高32位
+			out = appendInsn(out, 0, 0, 0, 0, 0)
+		}
+		pc += i.slots()
+	}
+	return out, nil
+}
+
+// appendInsn 编码一个 struct bpf_insn，寄存器字段是4位的位域，在大端机器上顺序相反
+func appendInsn(b []byte, op, dst, src uint8, off int16, imm int32) []byte {
+	regs := src<<4 | dst
+	if binary.NativeEndian.Uint16([]byte{0, 1}) == 1 {
+		regs = dst<<4 | src
+	}
+	b = append(b, op, regs)
+	b = binary.NativeEndian.AppendUint16(b, uint16(off))
+	return binary.NativeEndian.AppendUint32(b, uint32(imm))
+}
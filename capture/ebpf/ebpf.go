@@ -0,0 +1,63 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/procinfo"
+)
+
+// ErrUnsupported 当前平台不支持eBPF重定向
+var ErrUnsupported = errors.New("ebpf: socket redirection is only supported on Linux")
+
+// ErrNotRedirected 连接不是由eBPF程序重定向到代理的
+var ErrNotRedirected = errors.New("ebpf: connection was not redirected to the proxy")
+
+// DefaultCgroup 默认附加程序的 cgroup v2 根目录，其中所有进程的连接都被重定向
+const DefaultCgroup = "/sys/fs/cgroup"
+
+// Options 附加eBPF程序的设置
+type Options struct {
+	// Cgroup 附加程序的 cgroup v2 目录，为空时使用 DefaultCgroup。
+	// 目录及其子目录中的进程发起的TCP连接被重定向，代理进程自己的连接除外
+	Cgroup string
+
+	// Port 接收重定向连接的监听器在 127.0.0.1 上的端口
+	Port int
+
+	// Ports 重定向的目标端口，为空时重定向所有端口
+	Ports []int
+}
+
+// Origin 被重定向的连接原来的目标地址和发起连接的进程
+type Origin struct {
+	// Dst 连接原来的目标地址
+	Dst *net.TCPAddr
+
+	// Process 调用 connect 的进程和所在的 cgroup，进程已经退出时只有PID和cgroup
+	Process *procinfo.Process
+}
+
+// ParsePorts 解析逗号分隔的目标端口列表，例如 "80,443"，空字符串表示所有端口
+func ParsePorts(s string) ([]int, error) {
+	var ports []int
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		p, err := strconv.Atoi(item)
+		if err != nil || p < 1 || p > 65535 {
+			return nil, fmt.Errorf("invalid port %q", item)
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
@@ -0,0 +1,385 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package ebpf
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/f-dong/sniffy/capture/procinfo"
+	"github.com/f-dong/sniffy/capture/types"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// originEntries 等待连接建立的 connect 记录数，未建立的连接由LRU淘汰
+	originEntries = 16384
+
+	// portEntries 等待代理接受的连接数，每个客户端端口一项
+	portEntries = 65536
+
+	// missInterval 未知的 cgroup ID 触发重新扫描 cgroup 目录的最小间隔
+	missInterval = 2 * time.Second
+
+	// logSize 加载失败时读取的校验器日志大小
+	logSize = 1 << 20
+)
+
+// license 程序声明的许可证，只使用不要求GPL的辅助函数
+var license = []byte("Apache-2.0\x00")
+
+// Redirector 附加到 cgroup 的eBPF程序：connect4/connect6 把TCP连接重定向到代理并记录原目标地址，
+// sockops 在连接建立后按客户端端口索引记录。关闭后程序与 cgroup 分离，进程退出时同样自动分离
+type Redirector struct {
+	// fds 映射、程序和链接的文件描述符，按相反顺序关闭
+	fds    []int
+	byPort int
+
+	// root cgroup v2 的挂载点，dir 附加程序的目录
+	root string
+	dir  string
+
+	mu      sync.Mutex
+	cgroups map[uint64]string
+	scanned time.Time
+}
+
+// Attach 加载程序并附加到 opts.Cgroup，需要 root 或 CAP_BPF 和 CAP_NET_ADMIN
+func Attach(opts Options) (*Redirector, error) {
+	if opts.Port < 1 || opts.Port > 65535 {
+		return nil, fmt.Errorf("ebpf: invalid proxy port %d", opts.Port)
+	}
+	for _, p := range opts.Ports {
+		if p < 1 || p > 65535 {
+			return nil, fmt.Errorf("ebpf: invalid port %d", p)
+		}
+	}
+	dir, err := filepath.Abs(cmp.Or(opts.Cgroup, DefaultCgroup))
+	if err != nil {
+		return nil, err
+	}
+	cgroup, err := openCgroup(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(cgroup)
+
+	r := &Redirector{dir: dir, root: mountRoot(dir), cgroups: make(map[uint64]string)}
+	if err := r.attach(cgroup, opts); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// attach 创建映射，加载三个程序并链接到 cgroup
+func (r *Redirector) attach(cgroup int, opts Options) error {
+	origins, err := createMap("sniffy_origins", 8, originEntries)
+	if err != nil {
+		return err
+	}
+	r.fds = append(r.fds, origins)
+	if r.byPort, err = createMap("sniffy_ports", 4, portEntries); err != nil {
+		return err
+	}
+	r.fds = append(r.fds, r.byPort)
+
+	spec := redirect{port: opts.Port, ports: opts.Ports, self: os.Getpid(), origins: origins, byPort: r.byPort}
+	programs := []struct {
+		name       string
+		progType   uint32
+		attachType uint32
+		insns      []instruction
+	}{
+		{"sniffy_connect4", unix.BPF_PROG_TYPE_CGROUP_SOCK_ADDR, unix.BPF_CGROUP_INET4_CONNECT, spec.connect4()},
+		{"sniffy_connect6", unix.BPF_PROG_TYPE_CGROUP_SOCK_ADDR, unix.BPF_CGROUP_INET6_CONNECT, spec.connect6()},
+		{"sniffy_sockops", unix.BPF_PROG_TYPE_SOCK_OPS, unix.BPF_CGROUP_SOCK_OPS, spec.sockops()},
+	}
+	// 先链接 sockops，重定向开始时已经能记录客户端端口
+	for i := len(programs) - 1; i >= 0; i-- {
+		p := programs[i]
+		prog, err := loadProgram(p.name, p.progType, p.attachType, p.insns)
+		if err != nil {
+			return err
+		}
+		r.fds = append(r.fds, prog)
+		link, err := createLink(prog, cgroup, p.attachType)
+		if err != nil {
+			return fmt.Errorf("ebpf: attach %s to %s: %w", p.name, r.dir, err)
+		}
+		r.fds = append(r.fds, link)
+	}
+	return nil
+}
+
+// Close 分离程序并释放映射
+func (r *Redirector) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for i := len(r.fds) - 1; i >= 0; i-- {
+		if err := unix.Close(r.fds[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	r.fds = nil
+	return errors.Join(errs...)
+}
+
+// Cgroup 返回附加程序的 cgroup 目录
+func (r *Redirector) Cgroup() string {
+	return r.dir
+}
+
+// Origin 返回代理接受的连接 conn 原来的目标地址和发起连接的进程，每个连接只能查询一次。
+// 不是由程序重定向的连接返回 ErrNotRedirected
+func (r *Redirector) Origin(conn net.Conn) (*Origin, error) {
+	remote, ok := types.RawConn(conn).RemoteAddr().(*net.TCPAddr)
+	if !ok || !remote.IP.IsLoopback() {
+		return nil, ErrNotRedirected
+	}
+	key := make([]byte, 4)
+	binary.NativeEndian.PutUint32(key, uint32(remote.Port))
+	value := make([]byte, originSize)
+	if err := mapElem(unix.BPF_MAP_LOOKUP_ELEM, r.byPort, key, value); err != nil {
+		if errors.Is(err, unix.ENOENT) {
+			return nil, ErrNotRedirected
+		}
+		return nil, fmt.Errorf("ebpf: look up client port %d: %w", remote.Port, err)
+	}
+	mapElem(unix.BPF_MAP_DELETE_ELEM, r.byPort, key, nil)
+
+	dst := &net.TCPAddr{Port: int(binary.BigEndian.Uint16(value[originPort:]))}
+	if binary.NativeEndian.Uint16(value[originFamily:]) == unix.AF_INET {
+		dst.IP = net.IP(bytes.Clone(value[originIP : originIP+4]))
+	} else {
+		dst.IP = net.IP(bytes.Clone(value[originIP : originIP+16]))
+	}
+	// 进程ID属于初始的PID命名空间，代理运行在容器中时可能找不到对应的进程
+	pid := int(binary.NativeEndian.Uint32(value[originPID:]))
+	process := procinfo.ForPID(pid)
+	process.Cgroup = r.cgroupPath(binary.NativeEndian.Uint64(value[originCgroup:]))
+	return &Origin{Dst: dst, Process: process}, nil
+}
+
+// cgroupPath 返回 cgroup ID 对应的目录相对于 cgroup v2 挂载点的路径，例如 /system.slice/nginx.service。
+// cgroup ID 是目录的 inode 号，第一次遇到时扫描附加程序的目录
+func (r *Redirector) cgroupPath(id uint64) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if path, ok := r.cgroups[id]; ok || time.Since(r.scanned) < missInterval {
+		return path
+	}
+	r.scanned = time.Now()
+	filepath.WalkDir(r.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			rel, _ := filepath.Rel(r.root, path)
+			if rel == "." {
+				rel = ""
+			}
+			r.cgroups[st.Ino] = "/" + filepath.ToSlash(rel)
+		}
+		return nil
+	})
+	return r.cgroups[id]
+}
+
+// openCgroup 打开 cgroup v2 目录
+func openCgroup(dir string) (int, error) {
+	fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("ebpf: open cgroup: %w", err)
+	}
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(fd, &st); err != nil || st.Type != unix.CGROUP2_SUPER_MAGIC {
+		unix.Close(fd)
+		return -1, fmt.Errorf("ebpf: %s is not a cgroup v2 directory", dir)
+	}
+	return fd, nil
+}
+
+// mountRoot 返回 dir 所在的 cgroup v2 挂载点，即与 dir 在同一文件系统中的最上层目录
+func mountRoot(dir string) string {
+	var st unix.Stat_t
+	if unix.Stat(dir, &st) != nil {
+		return dir
+	}
+	for dir != "/" {
+		parent := filepath.Dir(dir)
+		var pst unix.Stat_t
+		if unix.Stat(parent, &pst) != nil || pst.Dev != st.Dev {
+			break
+		}
+		dir = parent
+	}
+	return dir
+}
+
+// bpf 执行 bpf(2) 系统调用
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// pointer 返回 b 的地址，传给内核的 __aligned_u64 字段。调用方在系统调用之后 runtime.KeepAlive(b)
+func pointer(b []byte) uint64 {
+	if len(b) == 0 {
+		return 0
+	}
+	return uint64(uintptr(unsafe.Pointer(&b[0])))
+}
+
+// mapCreateAttr BPF_MAP_CREATE 使用的 union bpf_attr
+type mapCreateAttr struct {
+	mapType    uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+	flags      uint32
+	innerMap   uint32
+	numaNode   uint32
+	name       [unix.BPF_OBJ_NAME_LEN]byte
+}
+
+// createMap 创建值为 struct origin 的LRU哈希映射
+func createMap(name string, keySize, entries uint32) (int, error) {
+	attr := mapCreateAttr{mapType: unix.BPF_MAP_TYPE_LRU_HASH, keySize: keySize, valueSize: originSize, maxEntries: entries}
+	copy(attr.name[:], name)
+	fd, err := bpf(unix.BPF_MAP_CREATE, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		return -1, fmt.Errorf("ebpf: create map %s: %w", name, permissionHint(err))
+	}
+	return fd, nil
+}
+
+// mapElemAttr BPF_MAP_*_ELEM 使用的 union bpf_attr
+type mapElemAttr struct {
+	mapFd uint32
+	_     uint32
+	key   uint64
+	value uint64
+	flags uint64
+}
+
+// mapElem 对映射 fd 中的键 key 执行 cmd，查找时值写入 value
+func mapElem(cmd, fd int, key, value []byte) error {
+	attr := mapElemAttr{mapFd: uint32(fd), key: pointer(key), value: pointer(value)}
+	_, err := bpf(cmd, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(key)
+	runtime.KeepAlive(value)
+	return err
+}
+
+// progLoadAttr BPF_PROG_LOAD 使用的 union bpf_attr
+type progLoadAttr struct {
+	progType           uint32
+	insnCnt            uint32
+	insns              uint64
+	license            uint64
+	logLevel           uint32
+	logSize            uint32
+	logBuf             uint64
+	kernVersion        uint32
+	progFlags          uint32
+	name               [unix.BPF_OBJ_NAME_LEN]byte
+	ifindex            uint32
+	expectedAttachType uint32
+}
+
+// loadProgram 汇编并加载程序，校验失败时错误中包含校验器日志的最后几行
+func loadProgram(name string, progType, attachType uint32, insns []instruction) (int, error) {
+	code, err := assemble(insns)
+	if err != nil {
+		return -1, err
+	}
+	attr := progLoadAttr{
+		progType:           progType,
+		insnCnt:            uint32(len(code) / insnSize),
+		insns:              pointer(code),
+		license:            pointer(license),
+		expectedAttachType: attachType,
+	}
+	copy(attr.name[:], name)
+	fd, err := bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err == nil {
+		runtime.KeepAlive(code)
+		return fd, nil
+	}
+
+	log := make([]byte, logSize)
+	attr.logLevel, attr.logSize, attr.logBuf = 1, logSize, pointer(log)
+	if fd, err := bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err == nil {
+		// 只在记录日志时才通过校验，不应发生
+		unix.Close(fd)
+	}
+	runtime.KeepAlive(code)
+	runtime.KeepAlive(log)
+	return -1, fmt.Errorf("ebpf: load %s: %w%s", name, permissionHint(err), verifierLog(log))
+}
+
+// verifierLog 返回校验器日志的最后几行
+func verifierLog(log []byte) string {
+	text := strings.TrimSpace(string(bytes.TrimRight(log, "\x00")))
+	if text == "" {
+		return ""
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) > 5 {
+		lines = lines[len(lines)-5:]
+	}
+	return ": " + strings.Join(lines, "; ")
+}
+
+// linkCreateAttr BPF_LINK_CREATE 使用的 union bpf_attr
+type linkCreateAttr struct {
+	progFd     uint32
+	targetFd   uint32
+	attachType uint32
+	flags      uint32
+}
+
+// createLink 将程序链接到 cgroup，链接的文件描述符关闭后程序分离
+func createLink(prog, cgroup int, attachType uint32) (int, error) {
+	attr := linkCreateAttr{progFd: uint32(prog), targetFd: uint32(cgroup), attachType: attachType}
+	fd, err := bpf(unix.BPF_LINK_CREATE, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		return -1, permissionHint(err)
+	}
+	return fd, nil
+}
+
+// permissionHint 权限不足时说明需要的权限
+func permissionHint(err error) error {
+	if errors.Is(err, unix.EPERM) {
+		return fmt.Errorf("%w (requires root or CAP_BPF and CAP_NET_ADMIN)", err)
+	}
+	return err
+}
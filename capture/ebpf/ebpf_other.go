@@ -0,0 +1,33 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package ebpf
+
+import "net"
+
+// Redirector 附加到 cgroup 的eBPF程序，只在 Linux 上可用
+type Redirector struct{}
+
+// Attach 返回 ErrUnsupported
+func Attach(opts Options) (*Redirector, error) {
+	return nil, ErrUnsupported
+}
+
+// Close 什么也不做
+func (r *Redirector) Close() error {
+	return nil
+}
+
+// Cgroup 返回空字符串
+func (r *Redirector) Cgroup() string {
+	return ""
+}
+
+// Origin 返回 ErrUnsupported
+func (r *Redirector) Origin(conn net.Conn) (*Origin, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,216 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package ebpf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// --- 辅助函数 ---
+
+// requireBPF 没有权限创建映射时跳过测试
+func requireBPF(t *testing.T) {
+	t.Helper()
+	fd, err := createMap("sniffy_test", 4, 1)
+	if err != nil {
+		t.Skipf("bpf not available: %v", err)
+	}
+	unix.Close(fd)
+}
+
+// testCgroup 在 cgroup v2 挂载点下创建测试用的 cgroup，无法创建时跳过测试
+func testCgroup(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	require.NoError(t, err)
+	for _, line := range strings.Split(string(data), "\n") {
+		// 挂载点是第5个字段，文件系统类型在 " - " 之后
+		fields := strings.Fields(line)
+		_, fs, ok := strings.Cut(line, " - ")
+		if !ok || len(fields) < 5 || !strings.HasPrefix(fs, "cgroup2 ") {
+			continue
+		}
+		dir := filepath.Join(fields[4], "sniffy-test-"+strconv.Itoa(os.Getpid()))
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Skipf("cannot create cgroup: %v", err)
+		}
+		t.Cleanup(func() { os.Remove(dir) })
+		return dir
+	}
+	t.Skip("cgroup v2 not mounted")
+	return ""
+}
+
+// dialInCgroup 在 cgroup dir 中启动测试进程连接 addr，发送一行请求并返回读到的响应
+func dialInCgroup(t *testing.T, dir, addr string) (string, error) {
+	t.Helper()
+	fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	require.NoError(t, err)
+	defer unix.Close(fd)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperDial$")
+	cmd.Env = append(os.Environ(), "SNIFFY_TEST_DIAL="+addr)
+	cmd.SysProcAttr = &syscall.SysProcAttr{UseCgroupFD: true, CgroupFD: fd}
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// --- 测试代码 ---
+
+// TestHelperDial 由 dialInCgroup 在 cgroup 中运行的子进程
+func TestHelperDial(t *testing.T) {
+	addr := os.Getenv("SNIFFY_TEST_DIAL")
+	if addr == "" {
+		t.Skip("helper process")
+	}
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		fmt.Fprint(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	fmt.Fprintln(conn, "hello")
+	reply, _ := io.ReadAll(conn)
+	fmt.Print(string(reply))
+	os.Exit(0)
+}
+
+func TestAssemble(t *testing.T) {
+	code, err := assemble([]instruction{
+		movImm(r0, 1),
+		jumpImm(unix.BPF_JEQ, r1, 7, "out"),
+		loadMap(r1, 5),
+		label("out"),
+		exit(),
+	})
+	require.NoError(t, err)
+	require.Len(t, code, 5*insnSize)
+
+	// 跳过占两个指令槽的 loadMap
+	insn := code[insnSize : 2*insnSize]
+	require.Equal(t, uint8(unix.BPF_JMP32|unix.BPF_JEQ|unix.BPF_K), insn[0])
+	require.Equal(t, int16(2), int16(binary.NativeEndian.Uint16(insn[2:])))
+	require.Equal(t, uint32(7), binary.NativeEndian.Uint32(insn[4:]))
+	require.Equal(t, uint32(5), binary.NativeEndian.Uint32(code[2*insnSize+4:]))
+	require.Equal(t, make([]byte, insnSize), code[3*insnSize:4*insnSize])
+
+	_, err = assemble([]instruction{jumpTo("missing"), exit()})
+	require.ErrorContains(t, err, `undefined label "missing"`)
+	_, err = assemble([]instruction{label("a"), label("a"), exit()})
+	require.ErrorContains(t, err, `duplicate label "a"`)
+}
+
+func TestWire(t *testing.T) {
+	b := make([]byte, 4)
+	binary.NativeEndian.PutUint32(b, wire(127, 0, 0, 1))
+	require.Equal(t, []byte{127, 0, 0, 1}, b)
+	binary.NativeEndian.PutUint16(b, uint16(wirePort(8080)))
+	require.Equal(t, uint16(8080), binary.BigEndian.Uint16(b))
+}
+
+func TestPrograms_Verifier(t *testing.T) {
+	requireBPF(t)
+	origins, err := createMap("sniffy_origins", 8, 16)
+	require.NoError(t, err)
+	defer unix.Close(origins)
+	byPort, err := createMap("sniffy_ports", 4, 16)
+	require.NoError(t, err)
+	defer unix.Close(byPort)
+
+	for _, ports := range [][]int{nil, {80, 443}} {
+		spec := redirect{port: 15002, ports: ports, self: os.Getpid(), origins: origins, byPort: byPort}
+		for name, p := range map[string]struct {
+			progType, attachType uint32
+			insns                []instruction
+		}{
+			"connect4": {unix.BPF_PROG_TYPE_CGROUP_SOCK_ADDR, unix.BPF_CGROUP_INET4_CONNECT, spec.connect4()},
+			"connect6": {unix.BPF_PROG_TYPE_CGROUP_SOCK_ADDR, unix.BPF_CGROUP_INET6_CONNECT, spec.connect6()},
+			"sockops":  {unix.BPF_PROG_TYPE_SOCK_OPS, unix.BPF_CGROUP_SOCK_OPS, spec.sockops()},
+		} {
+			fd, err := loadProgram(name, p.progType, p.attachType, p.insns)
+			require.NoError(t, err, "%s with ports %v", name, ports)
+			unix.Close(fd)
+		}
+	}
+}
+
+func TestAttach_Errors(t *testing.T) {
+	_, err := Attach(Options{Port: 0})
+	require.ErrorContains(t, err, "invalid proxy port")
+	_, err = Attach(Options{Port: 15002, Ports: []int{70000}})
+	require.ErrorContains(t, err, "invalid port 70000")
+	_, err = Attach(Options{Cgroup: t.TempDir(), Port: 15002})
+	require.ErrorContains(t, err, "is not a cgroup v2 directory")
+}
+
+func TestAttach_Redirect(t *testing.T) {
+	requireBPF(t)
+	dir := testCgroup(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	r, err := Attach(Options{Cgroup: dir, Port: ln.Addr().(*net.TCPAddr).Port, Ports: []int{80}})
+	require.NoError(t, err)
+	defer r.Close()
+
+	type result struct {
+		origin *Origin
+		err    error
+	}
+	results := make(chan result, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			origin, err := r.Origin(conn)
+			results <- result{origin, err}
+			bufio.NewReader(conn).ReadString('\n')
+			io.WriteString(conn, "redirected")
+			conn.Close()
+		}
+	}()
+
+	for _, addr := range []string{"192.0.2.1:80", "[2001:db8::1]:80"} {
+		reply, err := dialInCgroup(t, dir, addr)
+		require.NoError(t, err, addr)
+		require.Equal(t, "redirected", reply)
+		res := <-results
+		require.NoError(t, res.err)
+		require.Equal(t, addr, res.origin.Dst.String())
+		require.NotZero(t, res.origin.Process.PID)
+		require.Equal(t, "/"+filepath.Base(dir), res.origin.Process.Cgroup)
+	}
+
+	// 不在 Ports 中的端口不重定向
+	_, err = dialInCgroup(t, dir, "192.0.2.1:81")
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(err, &exitErr), "connection to an unlisted port should not be redirected")
+
+	// 直接连接代理的连接没有原目标地址
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.ErrorIs(t, (<-results).err, ErrNotRedirected)
+}
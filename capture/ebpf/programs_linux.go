@@ -0,0 +1,225 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package ebpf
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/sys/unix"
+)
+
+// struct bpf_sock_addr 中的字段偏移，地址和端口为网络字节序
+const (
+	sockAddrUserIP4 = 4
+	sockAddrUserIP6 = 8
+	sockAddrPort    = 24
+	sockAddrType    = 32
+)
+
+// struct bpf_sock_ops 中的字段偏移，local_port 为主机字节序
+const (
+	sockOpsOp        = 0
+	sockOpsLocalPort = 68
+)
+
+// origins 映射的值 struct origin 中的字段偏移：原目标地址（IPv4地址只占前4字节）、
+// 网络字节序的端口、地址族、进程ID和 cgroup ID
+const (
+	originIP     = 0
+	originPort   = 16
+	originFamily = 18
+	originPID    = 20
+	originCgroup = 24
+	originSize   = 32
+)
+
+// 程序在栈上保存 struct origin 和 socket cookie 的位置
+const (
+	stackOrigin = -originSize
+	stackCookie = stackOrigin - 8
+)
+
+// redirect 生成程序使用的参数
+type redirect struct {
+	// port 代理在 127.0.0.1 上的端口
+	port int
+
+	// ports 重定向的目标端口，为空时重定向所有端口
+	ports []int
+
+	// self 代理的进程ID，代理连接上游时不重定向
+	self int
+
+	// origins 按 socket cookie 保存原目标地址的映射，ports 按客户端端口保存原目标地址的映射
+	origins int
+	byPort  int
+}
+
+// wire 返回内存中的网络字节序数据 b 作为32位字段读入寄存器后的值
+func wire(b ...byte) uint32 {
+	return binary.NativeEndian.Uint32(b)
+}
+
+// wirePort 返回网络字节序的端口 port 读入寄存器后的值
+func wirePort(port int) uint32 {
+	return uint32(binary.NativeEndian.Uint16([]byte{byte(port >> 8), byte(port)}))
+}
+
+// connect4 cgroup/connect4 程序：记录IPv4 TCP连接的原目标地址和进程，
+// 然后把目标改为 127.0.0.1 上的代理端口。回环地址和不在 ports 中的端口不重定向
+func (r redirect) connect4() []instruction {
+	insns := []instruction{
+		movReg(r6, r1),
+		load(unix.BPF_W, r2, r6, sockAddrType),
+		jumpImm(unix.BPF_JNE, r2, unix.SOCK_STREAM, "allow"),
+		load(unix.BPF_W, r2, r6, sockAddrUserIP4),
+		alu32Imm(unix.BPF_AND, r2, wire(0xff, 0, 0, 0)),
+		jumpImm(unix.BPF_JEQ, r2, wire(127, 0, 0, 0), "allow"),
+		jumpImm(unix.BPF_JEQ, r2, 0, "allow"),
+	}
+	insns = append(insns, r.matchPort()...)
+	insns = append(insns, r.record(unix.AF_INET, []instruction{
+		load(unix.BPF_W, r2, r6, sockAddrUserIP4),
+		store(unix.BPF_W, r10, stackOrigin+originIP, r2),
+	})...)
+	return append(insns,
+		mov32Imm(r2, wire(127, 0, 0, 1)),
+		store(unix.BPF_W, r6, sockAddrUserIP4, r2),
+		mov32Imm(r2, wirePort(r.port)),
+		store(unix.BPF_W, r6, sockAddrPort, r2),
+		label("allow"),
+		movImm(r0, 1),
+		exit(),
+	)
+}
+
+// connect6 cgroup/connect6 程序：与 connect4 相同，目标改为IPv4映射地址 ::ffff:127.0.0.1，
+// 由同一个IPv4监听器接收。设置了 IPV6_V6ONLY 的套接字无法连接这个地址
+func (r redirect) connect6() []instruction {
+	insns := []instruction{
+		movReg(r6, r1),
+		load(unix.BPF_W, r2, r6, sockAddrType),
+		jumpImm(unix.BPF_JNE, r2, unix.SOCK_STREAM, "allow"),
+		// ::、::1 和IPv4映射的回环地址不重定向
+		load(unix.BPF_W, r2, r6, sockAddrUserIP6),
+		jumpImm(unix.BPF_JNE, r2, 0, "remote"),
+		load(unix.BPF_W, r2, r6, sockAddrUserIP6+4),
+		jumpImm(unix.BPF_JNE, r2, 0, "remote"),
+		load(unix.BPF_W, r2, r6, sockAddrUserIP6+8),
+		jumpImm(unix.BPF_JEQ, r2, 0, "allow"),
+		jumpImm(unix.BPF_JNE, r2, wire(0, 0, 0xff, 0xff), "remote"),
+		load(unix.BPF_W, r2, r6, sockAddrUserIP6+12),
+		alu32Imm(unix.BPF_AND, r2, wire(0xff, 0, 0, 0)),
+		jumpImm(unix.BPF_JEQ, r2, wire(127, 0, 0, 0), "allow"),
+		jumpImm(unix.BPF_JEQ, r2, 0, "allow"),
+		label("remote"),
+	}
+	insns = append(insns, r.matchPort()...)
+	var saveIP []instruction
+	for i := int16(0); i < 16; i += 4 {
+		saveIP = append(saveIP,
+			load(unix.BPF_W, r2, r6, sockAddrUserIP6+i),
+			store(unix.BPF_W, r10, stackOrigin+originIP+i, r2),
+		)
+	}
+	insns = append(insns, r.record(unix.AF_INET6, saveIP)...)
+	for i, word := range []uint32{0, 0, wire(0, 0, 0xff, 0xff), wire(127, 0, 0, 1)} {
+		insns = append(insns,
+			mov32Imm(r2, word),
+			store(unix.BPF_W, r6, sockAddrUserIP6+int16(i)*4, r2),
+		)
+	}
+	return append(insns,
+		mov32Imm(r2, wirePort(r.port)),
+		store(unix.BPF_W, r6, sockAddrPort, r2),
+		label("allow"),
+		movImm(r0, 1),
+		exit(),
+	)
+}
+
+// matchPort 目标端口不在 ports 中时跳转到 allow
+func (r redirect) matchPort() []instruction {
+	if len(r.ports) == 0 {
+		return nil
+	}
+	insns := []instruction{load(unix.BPF_W, r2, r6, sockAddrPort)}
+	for _, port := range r.ports {
+		insns = append(insns, jumpImm(unix.BPF_JEQ, r2, wirePort(port), "redirect"))
+	}
+	return append(insns, jumpTo("allow"), label("redirect"))
+}
+
+// record 跳过代理自己的连接，把 saveIP 保存的原目标地址、端口、进程ID和 cgroup ID
+// 按 socket cookie 写入 origins。写入失败时跳转到 allow，不重定向代理无法还原目标的连接
+func (r redirect) record(family int16, saveIP []instruction) []instruction {
+	insns := []instruction{
+		call(fnGetCurrentPidTgid),
+		aluImm(unix.BPF_RSH, r0, 32),
+		jumpImm(unix.BPF_JEQ, r0, uint32(r.self), "allow"),
+		movReg(r9, r0),
+	}
+	// 映射的值必须完全初始化
+	for off := int16(0); off < originSize; off += 8 {
+		insns = append(insns, storeImm(unix.BPF_DW, r10, stackOrigin+off, 0))
+	}
+	insns = append(insns, saveIP...)
+	return append(insns,
+		load(unix.BPF_W, r2, r6, sockAddrPort),
+		store(unix.BPF_H, r10, stackOrigin+originPort, r2),
+		storeImm(unix.BPF_H, r10, stackOrigin+originFamily, int32(family)),
+		store(unix.BPF_W, r10, stackOrigin+originPID, r9),
+		call(fnGetCurrentCgroupID),
+		store(unix.BPF_DW, r10, stackOrigin+originCgroup, r0),
+		movReg(r1, r6),
+		call(fnGetSocketCookie),
+		store(unix.BPF_DW, r10, stackCookie, r0),
+		loadMap(r1, r.origins),
+		movReg(r2, r10),
+		aluImm(unix.BPF_ADD, r2, stackCookie),
+		movReg(r3, r10),
+		aluImm(unix.BPF_ADD, r3, stackOrigin),
+		movImm(r4, unix.BPF_ANY),
+		call(fnMapUpdateElem),
+		jump64Imm(unix.BPF_JNE, r0, 0, "allow"),
+	)
+}
+
+// sockops sockops 程序：被重定向的连接建立时，connect 时还没有分配的客户端端口已经确定，
+// 把原目标地址从按 socket cookie 索引的 origins 移到按客户端端口索引的 byPort，代理接受连接后按远端端口查找
+func (r redirect) sockops() []instruction {
+	return []instruction{
+		movReg(r6, r1),
+		load(unix.BPF_W, r2, r6, sockOpsOp),
+		jumpImm(unix.BPF_JNE, r2, unix.BPF_SOCK_OPS_ACTIVE_ESTABLISHED_CB, "out"),
+		movReg(r1, r6),
+		call(fnGetSocketCookie),
+		store(unix.BPF_DW, r10, -8, r0),
+		loadMap(r1, r.origins),
+		movReg(r2, r10),
+		aluImm(unix.BPF_ADD, r2, -8),
+		call(fnMapLookupElem),
+		jump64Imm(unix.BPF_JEQ, r0, 0, "out"),
+		movReg(r7, r0),
+		load(unix.BPF_W, r2, r6, sockOpsLocalPort),
+		store(unix.BPF_W, r10, -16, r2),
+		loadMap(r1, r.byPort),
+		movReg(r2, r10),
+		aluImm(unix.BPF_ADD, r2, -16),
+		movReg(r3, r7),
+		movImm(r4, unix.BPF_ANY),
+		call(fnMapUpdateElem),
+		loadMap(r1, r.origins),
+		movReg(r2, r10),
+		aluImm(unix.BPF_ADD, r2, -8),
+		call(fnMapDeleteElem),
+		label("out"),
+		movImm(r0, 1),
+		exit(),
+	}
+}
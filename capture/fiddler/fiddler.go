@@ -0,0 +1,234 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package fiddler
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// maxEntry 归档中单个文件解压后的最大长度
+const maxEntry = 256 << 20
+
+// Session Fiddler 会话的元数据，保存在 raw/<n>_m.xml 中
+type Session struct {
+	SID    string `xml:"SID,attr"`
+	Timers Timers `xml:"SessionTimers"`
+	Flags  []struct {
+		Name  string `xml:"N,attr"`
+		Value string `xml:"V,attr"`
+	} `xml:"SessionFlags>SessionFlag"`
+}
+
+// Timers 会话各阶段的时间点，格式为带时区的 ISO 8601，未经历的阶段为 0001-01-01
+type Timers struct {
+	ClientBeginRequest  string `xml:"ClientBeginRequest,attr"`
+	ServerConnected     string `xml:"ServerConnected,attr"`
+	ServerGotRequest    string `xml:"ServerGotRequest,attr"`
+	ServerBeginResponse string `xml:"ServerBeginResponse,attr"`
+	ServerDoneResponse  string `xml:"ServerDoneResponse,attr"`
+	ClientDoneResponse  string `xml:"ClientDoneResponse,attr"`
+}
+
+// flag 返回会话标志的值
+func (s *Session) flag(name string) string {
+	for _, f := range s.Flags {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Load 读取 Fiddler 的 .saz 归档
+func Load(path string) ([]*flow.Flow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("open saz archive: %w", err)
+	}
+	return parse(data)
+}
+
+// Read 解析 .saz 归档。归档是zip文件，每个会话由 raw/<n>_c.txt（原始请求）、
+// raw/<n>_s.txt（原始响应）和 raw/<n>_m.xml（元数据）组成，CONNECT 隧道被忽略
+func Read(r io.Reader) ([]*flow.Flow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read saz archive: %w", err)
+	}
+	return parse(data)
+}
+
+func parse(data []byte) ([]*flow.Flow, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open saz archive: %w", err)
+	}
+	files := map[string]*zip.File{}
+	var ids []string
+	for _, zf := range zr.File {
+		name := path.Base(zf.Name)
+		files[name] = zf
+		if id, ok := strings.CutSuffix(name, "_c.txt"); ok && strings.HasPrefix(zf.Name, "raw/") {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+
+	var flows []*flow.Flow
+	for _, id := range ids {
+		f, err := convert(files, id)
+		if err != nil {
+			return nil, fmt.Errorf("saz session %s: %w", id, err)
+		}
+		if f != nil {
+			flows = append(flows, f)
+		}
+	}
+	return flows, nil
+}
+
+// convert 转换一个会话，CONNECT 隧道返回nil
+func convert(files map[string]*zip.File, id string) (*flow.Flow, error) {
+	raw, err := readFile(files[id+"_c.txt"])
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("parse request: %w", err)
+	}
+	if req.Method == http.MethodConnect {
+		return nil, nil
+	}
+	reqBody, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read request body: %w", err)
+	}
+
+	var meta Session
+	if zf := files[id+"_m.xml"]; zf != nil {
+		data, err := readFile(zf)
+		if err != nil {
+			return nil, err
+		}
+		if err := xml.Unmarshal(data, &meta); err != nil {
+			return nil, fmt.Errorf("parse metadata: %w", err)
+		}
+	}
+
+	f := flow.New()
+	if start := parseTime(meta.Timers.ClientBeginRequest); !start.IsZero() {
+		f.StartTime = start
+	}
+	f.EndTime = parseTime(meta.Timers.ClientDoneResponse)
+	f.Timings = &flow.Timings{
+		ConnectDone:  parseTime(meta.Timers.ServerConnected),
+		RequestSent:  parseTime(meta.Timers.ServerGotRequest),
+		FirstByte:    parseTime(meta.Timers.ServerBeginResponse),
+		ResponseDone: parseTime(meta.Timers.ServerDoneResponse),
+	}
+	if *f.Timings == (flow.Timings{}) {
+		f.Timings = nil
+	}
+	if ip := strings.TrimPrefix(meta.flag("x-clientip"), "::ffff:"); ip != "" {
+		f.ClientAddr = ip
+		if port := meta.flag("x-clientport"); port != "" {
+			f.ClientAddr = net.JoinHostPort(ip, port)
+		}
+	}
+	f.ServerAddr = meta.flag("x-hostip")
+
+	// 解密的HTTPS请求使用源形式的请求目标，经代理的明文请求使用绝对形式
+	u := req.URL
+	if !u.IsAbs() {
+		u.Scheme, u.Host = "https", req.Host
+		f.Intercepted = true
+	}
+	header := req.Header.Clone()
+	header.Del("Host")
+	f.Request = &flow.Request{
+		Method: req.Method,
+		URL:    u.String(),
+		Host:   req.Host,
+		Proto:  req.Proto,
+		Header: header,
+		Body:   reqBody,
+	}
+
+	// 请求失败或被中止的会话没有响应
+	raw, err = readFile(files[id+"_s.txt"])
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		f.Error = "no response"
+		return f, nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), req)
+	if err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("read response body: %w", err)
+	}
+	f.Response = &flow.Response{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Proto:      resp.Proto,
+		Header:     resp.Header,
+		Body:       respBody,
+	}
+	return f, nil
+}
+
+func readFile(zf *zip.File) ([]byte, error) {
+	if zf == nil {
+		return nil, os.ErrNotExist
+	}
+	r, err := zf.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", zf.Name, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxEntry+1))
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", zf.Name, err)
+	}
+	if len(data) > maxEntry {
+		return nil, fmt.Errorf("%s too large", zf.Name)
+	}
+	return data, nil
+}
+
+// parseTime 解析时间，未经历的阶段（0001-01-01）返回零值
+func parseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil || t.Year() <= 1 {
+		return time.Time{}
+	}
+	return t
+}
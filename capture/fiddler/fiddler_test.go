@@ -0,0 +1,99 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package fiddler
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func saz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+const metadata = `<?xml version="1.0" encoding="utf-8"?>
+<Session SID="2" BitFlags="0">
+  <SessionTimers ClientConnected="2024-03-01T10:00:00.0000000+01:00" ClientBeginRequest="2024-03-01T10:00:00.1000000+01:00"
+    ServerConnected="0001-01-01T00:00:00" ServerGotRequest="2024-03-01T10:00:00.1500000+01:00"
+    ServerBeginResponse="2024-03-01T10:00:00.3000000+01:00" ServerDoneResponse="2024-03-01T10:00:00.3500000+01:00"
+    ClientDoneResponse="2024-03-01T10:00:00.4000000+01:00" />
+  <SessionFlags>
+    <SessionFlag N="x-clientip" V="::ffff:127.0.0.1" />
+    <SessionFlag N="x-clientport" V="50123" />
+    <SessionFlag N="x-hostip" V="93.184.216.34" />
+  </SessionFlags>
+</Session>`
+
+// --- 测试代码 ---
+func TestRead(t *testing.T) {
+	data := saz(t, map[string]string{
+		"[Content_Types].xml": "<Types/>",
+		"_index.htm":          "<html/>",
+		"raw/01_c.txt":        "CONNECT api.example.com:443 HTTP/1.1\r\nHost: api.example.com:443\r\n\r\n",
+		"raw/01_s.txt":        "HTTP/1.1 200 Connection Established\r\n\r\n",
+		"raw/02_c.txt":        "POST /v1/items?x=1 HTTP/1.1\r\nHost: api.example.com\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\nhello",
+		"raw/02_s.txt":        "HTTP/1.1 201 Created\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nok\r\n0\r\n\r\n",
+		"raw/02_m.xml":        metadata,
+		"raw/10_c.txt":        "GET http://plain.example.com/ HTTP/1.1\r\nHost: plain.example.com\r\n\r\n",
+		"raw/10_s.txt":        "",
+	})
+	flows, err := Read(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Len(t, flows, 2)
+
+	f := flows[0]
+	require.Equal(t, "POST", f.Request.Method)
+	require.Equal(t, "https://api.example.com/v1/items?x=1", f.Request.URL)
+	require.Equal(t, "api.example.com", f.Request.Host)
+	require.Empty(t, f.Request.Header.Get("Host"))
+	require.Equal(t, "hello", string(f.Request.Body))
+	require.True(t, f.Intercepted)
+	require.Equal(t, "201 Created", f.Response.Status)
+	require.Equal(t, "ok", string(f.Response.Body))
+	require.Equal(t, "127.0.0.1:50123", f.ClientAddr)
+	require.Equal(t, "93.184.216.34", f.ServerAddr)
+	require.Equal(t, 300*time.Millisecond, f.Duration())
+	require.True(t, f.Timings.ConnectDone.IsZero())
+	require.Equal(t, 200*time.Millisecond, f.Timings.FirstByte.Sub(f.StartTime))
+
+	plain := flows[1]
+	require.Equal(t, "http://plain.example.com/", plain.Request.URL)
+	require.False(t, plain.Intercepted)
+	require.Nil(t, plain.Response)
+	require.Equal(t, "no response", plain.Error)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.saz")
+	require.NoError(t, os.WriteFile(path, []byte("not a zip"), 0o600))
+	_, err := Load(path)
+	require.ErrorContains(t, err, "open saz archive")
+
+	_, err = Read(bytes.NewReader(saz(t, map[string]string{"raw/1_c.txt": "garbage"})))
+	require.ErrorContains(t, err, "saz session 1: parse request")
+	_, err = Read(bytes.NewReader(saz(t, map[string]string{
+		"raw/1_c.txt": "GET / HTTP/1.1\r\nHost: a\r\n\r\n",
+		"raw/1_m.xml": "<Session",
+	})))
+	require.ErrorContains(t, err, "parse metadata")
+}
@@ -0,0 +1,592 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/cookies"
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// ErrUnknownField 表达式引用了不存在的字段
+var ErrUnknownField = errors.New("unknown field")
+
+// Filter 编译后的流过滤表达式，可安全地并发使用。
+//
+// 表达式由比较组成，使用 &&（and）、||（or）、!（not）和括号组合，例如：
+//
+//	host =~ "api\\..*" && status >= 500 && body contains "timeout"
+//
+// 双引号字符串按Go语法处理转义，单引号字符串不处理转义，适合书写正则表达式。
+// 字符串字段支持 ==、!=、=~、!~（正则）和 contains，数值字段支持 ==、!=、<、<=、>、>=。
+// 只写字段名表示字段存在且非空，例如 "intercepted" 或 "resp.header.Set-Cookie"。
+// cookie.<Name>、req.cookie.<Name>、resp.cookie.<Name> 为请求携带或响应设置的Cookie值，
+// session 为看起来像会话Cookie（见 cookies.IsSessionName）的值。
+// req.field.<path>、resp.field.<path> 访问结构化消息体（见 flow.Parsed）中的字段，
+// 同时支持字符串和数值比较，例如 resp.field.items.0.price > 10。
+// 多值字段（头部、body）任意一个值满足条件即匹配，!= 和 !~ 要求所有值都不满足
+type Filter struct {
+	expr string
+	root node
+}
+
+// Compile 编译过滤表达式
+func Compile(expr string) (*Filter, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", expr, err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", expr, err)
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("filter %q: %w", expr, unexpected(t, "expected && or ||"))
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// MustCompile 编译过滤表达式，失败时panic，用于固定的表达式
+func MustCompile(expr string) *Filter {
+	f, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// Match 判断流是否满足表达式，nil 过滤器匹配所有流
+func (f *Filter) Match(fl *flow.Flow) bool {
+	if f == nil {
+		return true
+	}
+	return f.root.eval(fl)
+}
+
+// String 返回原始表达式
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Fields 返回支持的字段名，头部字段以 header.<Name>、req.header.<Name>、resp.header.<Name> 表示
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// node 表达式语法树节点
+type node interface {
+	eval(f *flow.Flow) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n *andNode) eval(f *flow.Flow) bool { return n.left.eval(f) && n.right.eval(f) }
+
+type orNode struct{ left, right node }
+
+func (n *orNode) eval(f *flow.Flow) bool { return n.left.eval(f) || n.right.eval(f) }
+
+type notNode struct{ inner node }
+
+func (n *notNode) eval(f *flow.Flow) bool { return !n.inner.eval(f) }
+
+// truthNode 字段存在且非空（数值字段非零）
+type truthNode struct{ field *field }
+
+func (n *truthNode) eval(f *flow.Flow) bool {
+	if n.field.num != nil {
+		v, ok := n.field.num(f)
+		return ok && v != 0
+	}
+	for _, v := range n.field.str(f) {
+		if v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// compareNode 字段与常量比较
+type compareNode struct {
+	field  *field
+	op     string
+	value  string
+	number float64
+	re     *regexp.Regexp
+
+	// numeric 动态字段使用数值比较
+	numeric bool
+}
+
+func compareNumbers(v float64, op string, number float64) bool {
+	switch op {
+	case "==":
+		return v == number
+	case "!=":
+		return v != number
+	case "<":
+		return v < number
+	case "<=":
+		return v <= number
+	case ">":
+		return v > number
+	default:
+		return v >= number
+	}
+}
+
+func (n *compareNode) eval(f *flow.Flow) bool {
+	if n.field.num != nil {
+		v, ok := n.field.num(f)
+		if !ok {
+			return n.op == "!="
+		}
+		return compareNumbers(v, n.op, n.number)
+	}
+
+	values := n.field.str(f)
+	if n.numeric {
+		for _, s := range values {
+			if v, err := strconv.ParseFloat(s, 64); err == nil && compareNumbers(v, n.op, n.number) {
+				return true
+			}
+		}
+		return false
+	}
+	switch n.op {
+	case "!=":
+		return !n.any(values, "==")
+	case "!~":
+		return !n.any(values, "=~")
+	default:
+		return n.any(values, n.op)
+	}
+}
+
+// any 判断是否有值满足运算符
+func (n *compareNode) any(values []string, op string) bool {
+	for _, v := range values {
+		switch op {
+		case "==":
+			if v == n.value || (n.field.fold && strings.EqualFold(v, n.value)) {
+				return true
+			}
+		case "=~":
+			if n.re.MatchString(v) {
+				return true
+			}
+		case "contains":
+			if strings.Contains(v, n.value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// field 可过滤的流字段，str 和 num 二选一
+type field struct {
+	name string
+	str  func(*flow.Flow) []string
+	num  func(*flow.Flow) (float64, bool)
+
+	// fold 为true时 == 比较忽略大小写
+	fold bool
+
+	// duration 为true时数值可使用带单位的时长
+	duration bool
+
+	// dynamic 为true时字符串字段也支持数值比较，比较时把值解析为数字
+	dynamic bool
+}
+
+// fields 内置字段，头部字段由 lookupField 动态生成
+var fields = map[string]*field{
+	"id":           {str: one(func(f *flow.Flow) string { return f.ID })},
+	"method":       {str: request(func(r *flow.Request) string { return r.Method }), fold: true},
+	"url":          {str: request(func(r *flow.Request) string { return r.URL })},
+	"scheme":       {str: parsedURL(func(u *url.URL) string { return u.Scheme }), fold: true},
+	"host":         {str: one(host), fold: true},
+	"path":         {str: parsedURL(func(u *url.URL) string { return u.Path })},
+	"query":        {str: parsedURL(func(u *url.URL) string { return u.RawQuery })},
+	"proto":        {str: request(func(r *flow.Request) string { return r.Proto })},
+	"status":       {num: responseNum(func(r *flow.Response) float64 { return float64(r.StatusCode) })},
+	"content_type": {str: response(func(r *flow.Response) string { return r.Header.Get("Content-Type") })},
+	"body":         {str: bodies(true, true)},
+	"req.body":     {str: bodies(true, false)},
+	"resp.body":    {str: bodies(false, true)},
+	"size":         {num: responseNum(func(r *flow.Response) float64 { return float64(r.BodyLen()) })},
+	"req.size": {num: func(f *flow.Flow) (float64, bool) {
+		if f.Request == nil {
+			return 0, false
+		}
+		return float64(f.Request.BodyLen()), true
+	}},
+	"duration": {num: func(f *flow.Flow) (float64, bool) {
+		if f.EndTime.IsZero() {
+			return 0, false
+		}
+		return float64(f.Duration()) / float64(time.Millisecond), true
+	}, duration: true},
+	"client":    {str: one(func(f *flow.Flow) string { return f.ClientAddr })},
+	"server":    {str: one(func(f *flow.Flow) string { return f.ServerAddr })},
+	"listener":  {str: one(func(f *flow.Flow) string { return f.Listener })},
+	"responder": {str: one(func(f *flow.Flow) string { return f.Responder })},
+	"replay":    {str: one(func(f *flow.Flow) string { return f.ReplayOf })},
+	"fault":     {str: func(f *flow.Flow) []string { return f.Faults }},
+	"tag":       {str: func(f *flow.Flow) []string { return f.Tags }},
+	"comment":   {str: one(func(f *flow.Flow) string { return f.Comment })},
+	"marker":    {str: one(func(f *flow.Flow) string { return f.Marker }), fold: true},
+	"starred": {str: one(func(f *flow.Flow) string {
+		if f.Starred {
+			return "true"
+		}
+		return ""
+	})},
+	"session": {str: one(func(f *flow.Flow) string {
+		_, v := cookies.SessionCookie(f, "")
+		return v
+	})},
+	"error":      {str: one(func(f *flow.Flow) string { return f.Error })},
+	"timeout":    {str: one(func(f *flow.Flow) string { return f.TimedOut })},
+	"error_code": {str: one(func(f *flow.Flow) string { return string(f.ErrorCode) })},
+	"intercepted": {str: one(func(f *flow.Flow) string {
+		if f.Intercepted {
+			return "true"
+		}
+		return ""
+	})},
+	"sni": {str: one(func(f *flow.Flow) string {
+		if f.ClientHello == nil {
+			return ""
+		}
+		return f.ClientHello.ServerName
+	}), fold: true},
+	"ja3":  {str: one(func(f *flow.Flow) string { return fingerprint(f, 0) })},
+	"ja4":  {str: one(func(f *flow.Flow) string { return fingerprint(f, 1) })},
+	"ja3s": {str: one(func(f *flow.Flow) string { return fingerprint(f, 2) })},
+	"process": {str: one(func(f *flow.Flow) string {
+		if f.Process == nil {
+			return ""
+		}
+		return f.Process.Name
+	})},
+	"cgroup": {str: one(func(f *flow.Flow) string {
+		if f.Process == nil {
+			return ""
+		}
+		return f.Process.Cgroup
+	})},
+	"container": {str: func(f *flow.Flow) []string {
+		if f.Container == nil {
+			return nil
+		}
+		return []string{f.Container.Name, f.Container.ID}
+	}},
+	"pod": {str: one(func(f *flow.Flow) string {
+		if f.Pod == nil {
+			return ""
+		}
+		return f.Pod.Name
+	})},
+	"namespace": {str: one(func(f *flow.Flow) string {
+		if f.Pod == nil {
+			return ""
+		}
+		return f.Pod.Namespace
+	})},
+	"trace_id":       {str: one(func(f *flow.Flow) string { return f.TraceID }), fold: true},
+	"correlation_id": {str: one(func(f *flow.Flow) string { return f.CorrelationID })},
+	"graphql": {str: func(f *flow.Flow) []string {
+		if len(f.GraphQL) == 0 {
+			return nil
+		}
+		return []string{"true"}
+	}},
+	"graphql.name":  {str: graphql(func(op *flow.GraphQLOperation) string { return op.Name })},
+	"graphql.type":  {str: graphql(func(op *flow.GraphQLOperation) string { return op.Type }), fold: true},
+	"graphql.query": {str: graphql(func(op *flow.GraphQLOperation) string { return op.Query })},
+	"graphql.hash":  {str: graphql(func(op *flow.GraphQLOperation) string { return op.PersistedHash })},
+	"violation": {str: func(f *flow.Flow) []string {
+		kinds := make([]string, 0, len(f.Violations))
+		for _, v := range f.Violations {
+			kinds = append(kinds, v.Kind)
+		}
+		return kinds
+	}},
+	"credential": {str: func(f *flow.Flow) []string {
+		kinds := make([]string, 0, len(f.Credentials))
+		for _, c := range f.Credentials {
+			kinds = append(kinds, c.Kind)
+		}
+		return kinds
+	}},
+	"pid": {num: func(f *flow.Flow) (float64, bool) {
+		if f.Process == nil {
+			return 0, false
+		}
+		return float64(f.Process.PID), true
+	}},
+}
+
+// aliases 字段别名
+var aliases = map[string]string{
+	"request.body":      "req.body",
+	"response.body":     "resp.body",
+	"request.size":      "req.size",
+	"code":              "status",
+	"graphql.operation": "graphql.name",
+}
+
+func init() {
+	for name, fd := range fields {
+		fd.name = name
+	}
+}
+
+// lookupField 解析字段名，名称大小写不敏感，头部名称保留原样
+func lookupField(name string) (*field, error) {
+	lower := strings.ToLower(name)
+	if alias, ok := aliases[lower]; ok {
+		lower = alias
+	}
+	if fd, ok := fields[lower]; ok {
+		return fd, nil
+	}
+
+	for _, h := range []struct {
+		prefix    string
+		req, resp bool
+	}{
+		{"field.", true, true},
+		{"req.field.", true, false},
+		{"request.field.", true, false},
+		{"resp.field.", false, true},
+		{"response.field.", false, true},
+	} {
+		if strings.HasPrefix(lower, h.prefix) && len(name) > len(h.prefix) {
+			return &field{name: name, str: parsedFields(name[len(h.prefix):], h.req, h.resp), dynamic: true}, nil
+		}
+	}
+
+	for _, h := range []struct {
+		prefix    string
+		req, resp bool
+	}{
+		{"header.", true, true},
+		{"req.header.", true, false},
+		{"request.header.", true, false},
+		{"resp.header.", false, true},
+		{"response.header.", false, true},
+	} {
+		if strings.HasPrefix(lower, h.prefix) && len(name) > len(h.prefix) {
+			return &field{name: name, str: headers(name[len(h.prefix):], h.req, h.resp)}, nil
+		}
+	}
+
+	for _, h := range []struct {
+		prefix    string
+		req, resp bool
+	}{
+		{"cookie.", true, true},
+		{"req.cookie.", true, false},
+		{"request.cookie.", true, false},
+		{"resp.cookie.", false, true},
+		{"response.cookie.", false, true},
+	} {
+		if strings.HasPrefix(lower, h.prefix) && len(name) > len(h.prefix) {
+			return &field{name: name, str: cookieValues(name[len(h.prefix):], h.req, h.resp)}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownField, name)
+}
+
+func one(fn func(*flow.Flow) string) func(*flow.Flow) []string {
+	return func(f *flow.Flow) []string {
+		return []string{fn(f)}
+	}
+}
+
+func request(fn func(*flow.Request) string) func(*flow.Flow) []string {
+	return func(f *flow.Flow) []string {
+		if f.Request == nil {
+			return nil
+		}
+		return []string{fn(f.Request)}
+	}
+}
+
+func response(fn func(*flow.Response) string) func(*flow.Flow) []string {
+	return func(f *flow.Flow) []string {
+		if f.Response == nil {
+			return nil
+		}
+		return []string{fn(f.Response)}
+	}
+}
+
+func responseNum(fn func(*flow.Response) float64) func(*flow.Flow) (float64, bool) {
+	return func(f *flow.Flow) (float64, bool) {
+		if f.Response == nil {
+			return 0, false
+		}
+		return fn(f.Response), true
+	}
+}
+
+func parsedURL(fn func(*url.URL) string) func(*flow.Flow) []string {
+	return func(f *flow.Flow) []string {
+		if f.Request == nil {
+			return nil
+		}
+		u, err := url.Parse(f.Request.URL)
+		if err != nil {
+			return nil
+		}
+		return []string{fn(u)}
+	}
+}
+
+// host 返回不含端口的主机名，优先使用 Host 头部
+func host(f *flow.Flow) string {
+	if f.Request == nil {
+		return ""
+	}
+	h := f.Request.Host
+	if h == "" {
+		if u, err := url.Parse(f.Request.URL); err == nil {
+			h = u.Host
+		}
+	}
+	if name, _, err := net.SplitHostPort(h); err == nil {
+		h = name
+	}
+	return h
+}
+
+// graphql 返回所有GraphQL操作的字段值
+func graphql(fn func(*flow.GraphQLOperation) string) func(*flow.Flow) []string {
+	return func(f *flow.Flow) []string {
+		out := make([]string, 0, len(f.GraphQL))
+		for _, op := range f.GraphQL {
+			out = append(out, fn(op))
+		}
+		return out
+	}
+}
+
+func fingerprint(f *flow.Flow, which int) string {
+	if f.Fingerprints == nil {
+		return ""
+	}
+	return [...]string{f.Fingerprints.JA3, f.Fingerprints.JA4, f.Fingerprints.JA3S}[which]
+}
+
+// bodies 返回解码后的请求体和/或响应体
+func bodies(req, resp bool) func(*flow.Flow) []string {
+	return func(f *flow.Flow) []string {
+		var out []string
+		if req && f.Request != nil {
+			out = append(out, decoded(f.Request.Header, f.Request.Body))
+		}
+		if resp && f.Response != nil {
+			out = append(out, decoded(f.Response.Header, f.Response.Body))
+		}
+		return out
+	}
+}
+
+func decoded(h http.Header, body []byte) string {
+	if d, _, err := flow.DecodeBody(h, body); err == nil {
+		return string(d)
+	}
+	return string(body)
+}
+
+// parsedFields 返回结构化请求体和/或响应体中指定路径的值，非字符串的值编码为JSON
+func parsedFields(path string, req, resp bool) func(*flow.Flow) []string {
+	return func(f *flow.Flow) []string {
+		var out []string
+		add := func(p *flow.Parsed) {
+			v, ok := p.Field(path)
+			if !ok {
+				return
+			}
+			switch v := v.(type) {
+			case string:
+				out = append(out, v)
+			case nil:
+				out = append(out, "")
+			default:
+				b, err := json.Marshal(v)
+				if err == nil {
+					out = append(out, string(b))
+				}
+			}
+		}
+		if req && f.Request != nil {
+			add(f.Request.Parsed)
+		}
+		if resp && f.Response != nil {
+			add(f.Response.Parsed)
+		}
+		return out
+	}
+}
+
+// cookieValues 返回请求携带和/或响应设置的指定Cookie的所有值，Cookie名区分大小写
+func cookieValues(name string, req, resp bool) func(*flow.Flow) []string {
+	return func(f *flow.Flow) []string {
+		var out []string
+		if req {
+			for _, c := range cookies.Request(f.Request) {
+				if c.Name == name {
+					out = append(out, c.Value)
+				}
+			}
+		}
+		if resp {
+			for _, c := range cookies.Response(f.Response) {
+				if c.Name == name {
+					out = append(out, c.Value)
+				}
+			}
+		}
+		return out
+	}
+}
+
+// headers 返回请求和/或响应中指定头部的所有值
+func headers(name string, req, resp bool) func(*flow.Flow) []string {
+	name = http.CanonicalHeaderKey(name)
+	return func(f *flow.Flow) []string {
+		var out []string
+		if req && f.Request != nil {
+			out = append(out, f.Request.Header.Values(name)...)
+		}
+		if resp && f.Response != nil {
+			out = append(out, f.Response.Header.Values(name)...)
+		}
+		return out
+	}
+}
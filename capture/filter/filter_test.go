@@ -0,0 +1,271 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/procinfo"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	gz.Close()
+	return buf.Bytes()
+}
+
+func sampleFlow() *flow.Flow {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &flow.Flow{
+		ID:           "abc",
+		StartTime:    start,
+		EndTime:      start.Add(1500 * time.Millisecond),
+		ClientAddr:   "127.0.0.1:50000",
+		Process:      &procinfo.Process{PID: 42, Name: "curl", Cgroup: "/system.slice/backup.service"},
+		ClientHello:  &tlsinfo.ClientHello{ServerName: "api.example.com"},
+		Fingerprints: &tlsinfo.Fingerprints{JA4: "t13d1516h2_8daaf6152771_e5627efa2ab1"},
+		Intercepted:  true,
+		Request: &flow.Request{
+			Method: "POST",
+			URL:    "https://api.example.com:8443/v1/users?debug=1",
+			Proto:  "HTTP/2.0",
+			Header: http.Header{"Authorization": {"Bearer x"}, "Accept": {"text/html", "application/json"}},
+			Body:   []byte(`{"name": "bob"}`),
+		},
+		Response: &flow.Response{
+			StatusCode: http.StatusGatewayTimeout,
+			Header:     http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {"gzip"}},
+			Body:       gzipped(`{"error": "upstream timeout"}`),
+		},
+	}
+}
+
+// --- 测试代码 ---
+func TestFilter_Match(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`host =~ "api\\..*" && status >= 500 && body contains "timeout"`, true},
+		{`host =~ 'api\..*'`, true},
+		{`host == API.EXAMPLE.COM`, true},
+		{`method = post`, true},
+		{`path == "/v1/users" and query contains debug`, true},
+		{`scheme == https`, true},
+		{`status == 200 || status == 504`, true},
+		{`status < 500`, false},
+		{`!(status < 500)`, true},
+		{`not intercepted`, false},
+		{`intercepted && !replay && !error`, true},
+		{`duration > 1s && duration <= 1500`, true},
+		{`duration < 1.5s`, false},
+		{`size > 0 && req.size == 15`, true},
+		{`req.body contains bob && !(resp.body contains bob)`, true},
+		{`resp.body =~ "upstream\\s+timeout"`, true},
+		{`content_type contains json`, true},
+		{`header.authorization`, true},
+		{`resp.header.Authorization`, false},
+		{`req.header.Accept == "application/json"`, true},
+		{`req.header.Accept != "application/json"`, false},
+		{`req.header.Accept !~ "xml"`, true},
+		{`header.X-Missing != "a"`, true},
+		{`sni == api.example.com && ja4 matches "^t13"`, true},
+		{`process == curl && pid == 42`, true},
+		{`cgroup matches "^/system.slice/"`, true},
+		{`proto == HTTP/2.0`, true},
+		{`host == other.example.com || status == 0`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := Compile(tt.expr)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, f.Match(sampleFlow()))
+		})
+	}
+}
+
+func TestFilter_NoResponse(t *testing.T) {
+	fl := sampleFlow()
+	fl.Response = nil
+	fl.Error = "dial upstream: connection refused"
+
+	for expr, want := range map[string]bool{
+		`status >= 500`:               false,
+		`status != 200`:               true,
+		`error contains refused`:      true,
+		`resp.body contains "x"`:      false,
+		`content_type != "text/html"`: true,
+	} {
+		require.Equal(t, want, MustCompile(expr).Match(fl), expr)
+	}
+	var nilFilter *Filter
+	require.True(t, nilFilter.Match(fl))
+}
+
+func TestFilter_ParsedFields(t *testing.T) {
+	fl := sampleFlow()
+	fl.Request.Parsed = &flow.Parsed{Format: "json", Value: map[string]any{
+		"user":  map[string]any{"name": "bob"},
+		"items": []any{map[string]any{"price": json.Number("12.5")}},
+	}}
+
+	for expr, want := range map[string]bool{
+		`req.field.user.name == bob`:        true,
+		`field.user.name == alice`:          false,
+		`req.field.items.0.price > 10`:      true,
+		`req.field.items.0.price < 10`:      false,
+		`req.field.user contains "bob"`:     true,
+		`req.field.missing`:                 false,
+		`resp.field.user.name`:              false,
+		`req.field.items.0.price == "12.5"`: true,
+	} {
+		require.Equal(t, want, MustCompile(expr).Match(fl), expr)
+	}
+	_, err := Compile(`req.field.x > abc`)
+	require.ErrorContains(t, err, "invalid value")
+}
+
+func TestFilter_GraphQL(t *testing.T) {
+	fl := sampleFlow()
+	require.False(t, MustCompile("graphql").Match(fl))
+
+	fl.GraphQL = []*flow.GraphQLOperation{{Name: "GetUser", Type: "query"}, {Name: "Save", Type: "mutation"}}
+	for expr, want := range map[string]bool{
+		`graphql`:                      true,
+		`graphql.operation == Save`:    true,
+		`graphql.name =~ "^Get"`:       true,
+		`graphql.type == MUTATION`:     true,
+		`graphql.type != subscription`: true,
+		`graphql.name == Delete`:       false,
+	} {
+		require.Equal(t, want, MustCompile(expr).Match(fl), expr)
+	}
+}
+
+func TestFilter_Violation(t *testing.T) {
+	fl := sampleFlow()
+	require.False(t, MustCompile("violation").Match(fl))
+
+	fl.Violations = []*flow.Violation{{Kind: "unknown-field", Location: "response.body.id"}, {Kind: "undocumented-status"}}
+	for expr, want := range map[string]bool{
+		`violation`:                       true,
+		`violation == unknown-field`:      true,
+		`violation contains undocumented`: true,
+		`violation == missing-field`:      false,
+	} {
+		require.Equal(t, want, MustCompile(expr).Match(fl), expr)
+	}
+}
+
+func TestFilter_Credential(t *testing.T) {
+	fl := sampleFlow()
+	require.False(t, MustCompile("credential").Match(fl))
+
+	fl.Credentials = []*flow.Credential{{Kind: "basic-auth", Location: "request.header.Authorization"}}
+	for expr, want := range map[string]bool{
+		`credential`:                 true,
+		`credential == basic-auth`:   true,
+		`credential == aws-sigv4`:    false,
+		`credential != bearer-token`: true,
+	} {
+		require.Equal(t, want, MustCompile(expr).Match(fl), expr)
+	}
+}
+
+func TestFilter_Annotations(t *testing.T) {
+	fl := sampleFlow()
+	require.False(t, MustCompile("starred || tag || comment || marker").Match(fl))
+
+	fl.Tag("checkout")
+	fl.Tag("slow")
+	fl.Comment = "retried by the client"
+	fl.Starred = true
+	fl.Marker = "red"
+	for expr, want := range map[string]bool{
+		`starred && marker == RED`:  true,
+		`tag == slow`:               true,
+		`tag != slow`:               false,
+		`comment contains retried`:  true,
+		`!starred || tag == search`: false,
+	} {
+		require.Equal(t, want, MustCompile(expr).Match(fl), expr)
+	}
+}
+
+func TestFilter_Cookies(t *testing.T) {
+	fl := sampleFlow()
+	fl.Request.Header.Set("Cookie", "theme=dark; JSESSIONID=s1")
+	fl.Response.Header.Add("Set-Cookie", "token=t2; Path=/; HttpOnly")
+	for expr, want := range map[string]bool{
+		`cookie.theme == dark`:    true,
+		`req.cookie.token`:        false,
+		`resp.cookie.token == t2`: true,
+		`cookie.Theme`:            false,
+		`session == s1`:           true,
+	} {
+		require.Equal(t, want, MustCompile(expr).Match(fl), expr)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		expr string
+		msg  string
+	}{
+		{``, "unexpected end"},
+		{`host ==`, "expected value"},
+		{`(host == a`, "expected )"},
+		{`host == a b`, "expected && or ||"},
+		{`status contains 5`, "not supported for numeric field"},
+		{`status >= abc`, "invalid value"},
+		{`host > a`, "not supported for field"},
+		{`host =~ "("`, "invalid regular expression"},
+		{`host == "abc`, "unterminated string"},
+		{`host == $`, "unexpected character"},
+		{`nope == 1`, "unknown field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Compile(tt.expr)
+			require.ErrorContains(t, err, tt.msg)
+			if tt.msg == "unknown field" {
+				require.ErrorIs(t, err, ErrUnknownField)
+			}
+		})
+	}
+}
+
+func TestFields(t *testing.T) {
+	names := Fields()
+	require.Contains(t, names, "host")
+	require.Contains(t, names, "resp.body")
+	require.IsIncreasing(t, names)
+}
+
+func TestFilter_TraceID(t *testing.T) {
+	fl := sampleFlow()
+	fl.TraceID, fl.CorrelationID = "4bf92f3577b34da6a3ce929d0e0e4736", "req-42"
+	for expr, want := range map[string]bool{
+		`trace_id == 4BF92F3577B34DA6A3CE929D0E0E4736`: true,
+		`trace_id =~ "^4bf9"`:                          true,
+		`correlation_id == req-42`:                     true,
+		`correlation_id == REQ-42`:                     false,
+	} {
+		require.Equal(t, want, MustCompile(expr).Match(fl), expr)
+	}
+	require.False(t, MustCompile("trace_id").Match(sampleFlow()))
+}
@@ -0,0 +1,292 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// tokenKind 词法单元类型
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+// token 词法单元
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators 按长度从长到短排列，保证优先匹配两字符运算符
+var operators = []string{"&&", "||", "==", "!=", "=~", "!~", "<=", ">=", "<", ">", "!", "="}
+
+// lex 将表达式拆分为词法单元
+func lex(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			s, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %w", i, err)
+			}
+			tokens = append(tokens, token{tokString, s, i})
+			i = end + 1
+		case c == '\'':
+			// 单引号字符串不处理转义，便于书写正则表达式
+			end := strings.IndexByte(expr[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, token{tokString, expr[i+1 : i+1+end], i})
+			i += end + 2
+		default:
+			if op := matchOperator(expr[i:]); op != "" {
+				tokens = append(tokens, token{tokOp, op, i})
+				i += len(op)
+				continue
+			}
+			end := i
+			for end < len(expr) && isWordByte(expr[end]) {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+			tokens = append(tokens, token{tokWord, expr[i:end], i})
+			i = end
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(expr)}), nil
+}
+
+func matchOperator(s string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// isWordByte 判断字节是否可以出现在字段名或不带引号的值中
+func isWordByte(c byte) bool {
+	return c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) ||
+		strings.IndexByte("_.-:/*+@%", c) >= 0
+}
+
+// parser 递归下降语法分析器，优先级从低到高为 ||、&&、!
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isKeyword 判断当前词是否为指定的运算符或同义关键字
+func (p *parser) isKeyword(op, keyword string) bool {
+	t := p.peek()
+	return (t.kind == tokOp && t.text == op) || (t.kind == tokWord && strings.EqualFold(t.text, keyword))
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("||", "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("&&", "and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isKeyword("!", "not") {
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, unexpected(closing, "expected )")
+		}
+		return n, nil
+	case tokWord:
+		fd, err := lookupField(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("%w at position %d", err, t.pos)
+		}
+		op, ok := p.comparison()
+		if !ok {
+			return &truthNode{fd}, nil
+		}
+		value := p.next()
+		if value.kind != tokWord && value.kind != tokString {
+			return nil, unexpected(value, "expected value")
+		}
+		return newCompare(fd, op, value)
+	default:
+		return nil, unexpected(t, "expected field or (")
+	}
+}
+
+// comparison 读取比较运算符，没有时返回false
+func (p *parser) comparison() (string, bool) {
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && t.text == "=":
+		p.next()
+		return "==", true
+	case t.kind == tokOp && t.text != "&&" && t.text != "||" && t.text != "!":
+		p.next()
+		return t.text, true
+	case t.kind == tokWord && strings.EqualFold(t.text, "contains"):
+		p.next()
+		return "contains", true
+	case t.kind == tokWord && strings.EqualFold(t.text, "matches"):
+		p.next()
+		return "=~", true
+	}
+	return "", false
+}
+
+// newCompare 创建比较节点，并按字段类型检查运算符和值
+func newCompare(fd *field, op string, value token) (node, error) {
+	n := &compareNode{field: fd, op: op, value: value.text}
+	if fd.num != nil {
+		switch op {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return nil, fmt.Errorf("operator %s not supported for numeric field %s at position %d", op, fd.name, value.pos)
+		}
+		num, err := parseNumber(fd, value.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for %s at position %d", value.text, fd.name, value.pos)
+		}
+		n.number = num
+		return n, nil
+	}
+
+	if fd.dynamic {
+		switch op {
+		case "<", "<=", ">", ">=":
+			num, err := strconv.ParseFloat(value.text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for %s at position %d", value.text, fd.name, value.pos)
+			}
+			n.number, n.numeric = num, true
+			return n, nil
+		}
+	}
+
+	switch op {
+	case "==", "!=", "contains":
+	case "=~", "!~":
+		re, err := regexp.Compile(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression at position %d: %w", value.pos, err)
+		}
+		n.re = re
+	default:
+		return nil, fmt.Errorf("operator %s not supported for field %s at position %d", op, fd.name, value.pos)
+	}
+	return n, nil
+}
+
+// parseNumber 解析数值，duration 字段接受带单位的时长（例如 1.5s），不带单位时为毫秒
+func parseNumber(fd *field, s string) (float64, error) {
+	if fd.duration && strings.IndexFunc(s, unicode.IsLetter) >= 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+		return float64(d) / float64(time.Millisecond), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func unexpected(t token, want string) error {
+	if t.kind == tokEOF {
+		return fmt.Errorf("unexpected end of expression, %s", want)
+	}
+	return fmt.Errorf("unexpected %q at position %d, %s", t.text, t.pos, want)
+}
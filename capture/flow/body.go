@@ -0,0 +1,66 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrUnsupportedEncoding 不支持的内容编码
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// DecodeBody 按 Content-Encoding 解码内容，encoded 表示内容经过了压缩
+func DecodeBody(header http.Header, body []byte) (decoded []byte, encoded bool, err error) {
+	reader, encoded, err := DecodeReader(header, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	if !encoded {
+		return body, false, nil
+	}
+	defer reader.Close()
+	decoded, err = io.ReadAll(reader)
+	if err != nil {
+		return nil, false, fmt.Errorf("decode body: %w", err)
+	}
+	return decoded, true, nil
+}
+
+// DecodeReader 返回按 Content-Encoding 边读边解码 r 的 Reader，用于不能完整读入内存的内容
+func DecodeReader(header http.Header, r io.Reader) (decoded io.ReadCloser, encoded bool, err error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return io.NopCloser(r), false, nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, false, fmt.Errorf("decode gzip body: %w", err)
+		}
+		return gz, true, nil
+	case "deflate":
+		// 大多数实现发送zlib封装的数据，少数发送原始deflate流，按zlib头部区分
+		br := bufio.NewReader(r)
+		if head, _ := br.Peek(2); len(head) == 2 && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, false, fmt.Errorf("decode deflate body: %w", err)
+			}
+			return zr, true, nil
+		}
+		return flate.NewReader(br), true, nil
+	default:
+		return nil, false, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultBodyLimit 默认在内存中保留的最大内容长度
+const DefaultBodyLimit = 8 << 20
+
+// BodyPolicy 内容捕获策略。不超过 Limit 的内容完整读入内存，可以被钩子、断点和改写规则修改；
+// 更长的内容边读边转发，内存中只保留前 Limit 字节，设置了 SpillDir 时完整内容另外写入其中的临时文件。
+// 为nil时所有内容完整读入内存
+type BodyPolicy struct {
+	// Limit 内存中保留的最大内容长度，0 表示不限制
+	Limit int64
+
+	// SpillDir 保存超长内容的目录，为空时只保留前 Limit 字节
+	SpillDir string
+}
+
+// MemoryLimit 返回内存中保留的最大内容长度，0 表示不限制
+func (p *BodyPolicy) MemoryLimit() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.Limit
+}
+
+// NewCapture 创建按策略记录内容的 Capture
+func (p *BodyPolicy) NewCapture() *Capture {
+	c := &Capture{limit: p.MemoryLimit()}
+	if p != nil {
+		c.dir = p.SpillDir
+	}
+	return c
+}
+
+// Capture 记录转发的内容，内存中只保留前 limit 字节，超出时把完整内容写入临时文件。
+// 写入总是成功，临时文件出错时放弃文件，只保留内存中的部分，不影响转发
+type Capture struct {
+	limit int64
+	dir   string
+	buf   []byte
+	n     int64
+	file  *os.File
+	err   error
+}
+
+// Write 实现 io.Writer 接口
+func (c *Capture) Write(p []byte) (int, error) {
+	if c.file == nil && c.err == nil && c.dir != "" && c.limit > 0 && c.n+int64(len(p)) > c.limit {
+		c.spill()
+	}
+	if c.file != nil {
+		if _, err := c.file.Write(p); err != nil {
+			c.discard(err)
+		}
+	}
+	if room := c.limit - int64(len(c.buf)); c.limit <= 0 || room >= int64(len(p)) {
+		c.buf = append(c.buf, p...)
+	} else if room > 0 {
+		c.buf = append(c.buf, p[:room]...)
+	}
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// spill 创建临时文件并写入已保存在内存中的内容
+func (c *Capture) spill() {
+	file, err := os.CreateTemp(c.dir, "body-*")
+	if err != nil {
+		c.err = fmt.Errorf("create body file: %w", err)
+		return
+	}
+	c.file = file
+	if _, err := file.Write(c.buf); err != nil {
+		c.discard(err)
+	}
+}
+
+// discard 删除临时文件并记录错误
+func (c *Capture) discard(err error) {
+	c.file.Close()
+	os.Remove(c.file.Name())
+	c.file = nil
+	c.err = fmt.Errorf("write body file: %w", err)
+}
+
+// Len 返回已写入的总长度
+func (c *Capture) Len() int64 {
+	return c.n
+}
+
+// finish 关闭临时文件，返回内存中的内容、截断时的完整长度和临时文件路径
+func (c *Capture) finish() (body []byte, size int64, file string, err error) {
+	if c.file != nil {
+		file = c.file.Name()
+		if err := c.file.Close(); err != nil {
+			os.Remove(file)
+			file, c.err = "", fmt.Errorf("close body file: %w", err)
+		}
+		c.file = nil
+	}
+	if c.n > int64(len(c.buf)) {
+		size = c.n
+	}
+	return c.buf, size, file, c.err
+}
+
+// SetBody 用 c 记录的内容设置请求体，返回写入临时文件的错误
+func (r *Request) SetBody(c *Capture) error {
+	var err error
+	r.Body, r.BodySize, r.BodyFile, err = c.finish()
+	return err
+}
+
+// BodyLen 返回请求体的完整长度
+func (r *Request) BodyLen() int64 {
+	return bodyLen(r.Body, r.BodySize)
+}
+
+// Truncated 判断 Body 是否只包含请求体的开头部分
+func (r *Request) Truncated() bool {
+	return r.BodySize > int64(len(r.Body))
+}
+
+// OpenBody 打开完整的请求体，内容被截断且没有临时文件时只能读到 Body 中的部分
+func (r *Request) OpenBody() (io.ReadCloser, error) {
+	return openBody(r.Body, r.BodyFile)
+}
+
+// SetBody 用 c 记录的内容设置响应体，返回写入临时文件的错误
+func (r *Response) SetBody(c *Capture) error {
+	var err error
+	r.Body, r.BodySize, r.BodyFile, err = c.finish()
+	return err
+}
+
+// BodyLen 返回响应体的完整长度
+func (r *Response) BodyLen() int64 {
+	return bodyLen(r.Body, r.BodySize)
+}
+
+// Truncated 判断 Body 是否只包含响应体的开头部分
+func (r *Response) Truncated() bool {
+	return r.BodySize > int64(len(r.Body))
+}
+
+// OpenBody 打开完整的响应体，内容被截断且没有临时文件时只能读到 Body 中的部分
+func (r *Response) OpenBody() (io.ReadCloser, error) {
+	return openBody(r.Body, r.BodyFile)
+}
+
+// RemoveBodyFiles 删除保存请求体和响应体的临时文件
+func (f *Flow) RemoveBodyFiles() {
+	if f.Request != nil && f.Request.BodyFile != "" {
+		os.Remove(f.Request.BodyFile)
+	}
+	if f.Response != nil && f.Response.BodyFile != "" {
+		os.Remove(f.Response.BodyFile)
+	}
+}
+
+func bodyLen(body []byte, size int64) int64 {
+	if size > int64(len(body)) {
+		return size
+	}
+	return int64(len(body))
+}
+
+func openBody(body []byte, file string) (io.ReadCloser, error) {
+	if file != "" {
+		return os.Open(file)
+	}
+	return io.NopCloser(bytes.NewReader(body)), nil
+}
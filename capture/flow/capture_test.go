@@ -0,0 +1,244 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+
+func TestCapture_Limit(t *testing.T) {
+	p := &BodyPolicy{Limit: 4}
+	c := p.NewCapture()
+	c.Write([]byte("abc"))
+	c.Write([]byte("defgh"))
+	require.Equal(t, int64(8), c.Len())
+
+	r := &Response{}
+	require.NoError(t, r.SetBody(c))
+	require.Equal(t, "abcd", string(r.Body))
+	require.True(t, r.Truncated())
+	require.Equal(t, int64(8), r.BodyLen())
+	require.Empty(t, r.BodyFile)
+
+	// 没有临时文件时只能读到开头部分
+	body, err := r.OpenBody()
+	require.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	require.Equal(t, "abcd", string(data))
+
+	// 未超过限制的内容完整保留
+	c = p.NewCapture()
+	c.Write([]byte("abcd"))
+	req := &Request{}
+	require.NoError(t, req.SetBody(c))
+	require.False(t, req.Truncated())
+	require.Equal(t, int64(4), req.BodyLen())
+
+	// nil 策略不限制
+	c = (*BodyPolicy)(nil).NewCapture()
+	c.Write(bytes.Repeat([]byte("x"), 1024))
+	require.NoError(t, req.SetBody(c))
+	require.Len(t, req.Body, 1024)
+	require.Zero(t, req.BodySize)
+}
+
+func TestCapture_Spill(t *testing.T) {
+	dir := t.TempDir()
+	c := (&BodyPolicy{Limit: 4, SpillDir: dir}).NewCapture()
+	c.Write([]byte("ab"))
+	c.Write([]byte("cdef"))
+	c.Write([]byte("gh"))
+
+	f := &Flow{Response: &Response{}}
+	require.NoError(t, f.Response.SetBody(c))
+	require.Equal(t, "abcd", string(f.Response.Body))
+	require.Equal(t, int64(8), f.Response.BodyLen())
+	require.NotEmpty(t, f.Response.BodyFile)
+
+	body, err := f.Response.OpenBody()
+	require.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	require.Equal(t, "abcdefgh", string(data))
+
+	f.RemoveBodyFiles()
+	_, err = os.Stat(f.Response.BodyFile)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// 目录不可用时只保留开头部分
+	c = (&BodyPolicy{Limit: 4, SpillDir: dir + "/missing"}).NewCapture()
+	c.Write([]byte("abcdefgh"))
+	r := &Response{}
+	require.Error(t, r.SetBody(c))
+	require.Equal(t, "abcd", string(r.Body))
+	require.Empty(t, r.BodyFile)
+}
+
+func TestStore_RemovesBodyFiles(t *testing.T) {
+	dir := t.TempDir()
+	add := func(s *Store, id string) *Flow {
+		c := (&BodyPolicy{Limit: 1, SpillDir: dir}).NewCapture()
+		c.Write([]byte("body"))
+		f := &Flow{ID: id, Response: &Response{}}
+		require.NoError(t, f.Response.SetBody(c))
+		s.Add(f)
+		return f
+	}
+	exists := func(f *Flow) bool {
+		_, err := os.Stat(f.Response.BodyFile)
+		return err == nil
+	}
+
+	s := NewStore()
+	s.SetLimit(1)
+	first := add(s, "1")
+	second := add(s, "2")
+	require.False(t, exists(first))
+	require.True(t, exists(second))
+
+	s.Clear()
+	require.False(t, exists(second))
+}
+
+func TestStore_MemoryLimit(t *testing.T) {
+	newFlow := func(id string) *Flow {
+		return &Flow{
+			ID:       id,
+			Request:  &Request{URL: "http://example.com/" + id},
+			Response: &Response{Body: bytes.Repeat([]byte("x"), 10<<10)},
+		}
+	}
+	full := memSize(newFlow("1"))
+	stub := memSize(stripBodies(newFlow("1")))
+
+	s := NewStore()
+	s.SetMemoryLimit(2*full + stub)
+	first := newFlow("1")
+	s.Add(first)
+	s.Add(newFlow("2"))
+	s.Add(newFlow("3"))
+
+	// 超出上限时先丢弃最早的流的内容，已取得的流不受影响
+	stored, ok := s.Get("1")
+	require.True(t, ok)
+	require.Nil(t, stored.Response.Body)
+	require.True(t, stored.Response.Truncated())
+	require.Equal(t, int64(10<<10), stored.Response.BodyLen())
+	require.Len(t, first.Response.Body, 10<<10)
+	require.Same(t, stored, s.List()[0])
+	require.Equal(t, StoreStats{Flows: 3, Bytes: 2*full + stub, MemoryLimit: 2*full + stub, DroppedBodies: 1}, s.Stats())
+
+	s.Add(newFlow("4"))
+	require.Equal(t, int64(3), s.Stats().DroppedBodies)
+	require.Equal(t, 4, s.Len())
+
+	// 丢弃所有内容后仍然超出时丢弃最早的流
+	s.SetMemoryLimit(2 * stub)
+	st := s.Stats()
+	require.Equal(t, int64(4), st.DroppedBodies)
+	require.Equal(t, int64(2), st.Evicted)
+	require.Equal(t, 2*stub, st.Bytes)
+	_, ok = s.Get("2")
+	require.False(t, ok)
+	require.Equal(t, "3", s.List()[0].ID)
+
+	s.Clear()
+	require.Zero(t, s.Stats().Bytes)
+}
+
+func TestDecodeReader(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("hello"))
+	gz.Close()
+
+	r, encoded, err := DecodeReader(http.Header{"Content-Encoding": {"gzip"}}, &buf)
+	require.NoError(t, err)
+	require.True(t, encoded)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	r, encoded, err = DecodeReader(http.Header{}, strings.NewReader("plain"))
+	require.NoError(t, err)
+	require.False(t, encoded)
+	data, _ = io.ReadAll(r)
+	require.Equal(t, "plain", string(data))
+
+	// deflate 同时支持zlib封装和原始deflate流
+	var zbuf, fbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write([]byte("zlib"))
+	zw.Close()
+	fw, _ := flate.NewWriter(&fbuf, flate.DefaultCompression)
+	fw.Write([]byte("flate"))
+	fw.Close()
+	for want, body := range map[string][]byte{"zlib": zbuf.Bytes(), "flate": fbuf.Bytes()} {
+		decoded, encoded, err := DecodeBody(http.Header{"Content-Encoding": {"deflate"}}, body)
+		require.NoError(t, err)
+		require.True(t, encoded)
+		require.Equal(t, want, string(decoded))
+	}
+
+	_, _, err = DecodeReader(http.Header{"Content-Encoding": {"br"}}, strings.NewReader(""))
+	require.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
+
+func TestFlow_ToCurl(t *testing.T) {
+	f := New()
+	f.Request = &Request{
+		Method: http.MethodGet,
+		URL:    "https://example.com/a?b=1&c=2",
+		Host:   "example.com",
+		Proto:  "HTTP/1.1",
+		Header: http.Header{
+			"Accept-Encoding": {"gzip"},
+			"Content-Length":  {"0"},
+			"User-Agent":      {"it's me"},
+			ReplayHeader:      {"a b"},
+		},
+	}
+	require.Equal(t, `curl \
+  -H 'Accept-Encoding: gzip' \
+  -H 'User-Agent: it'\''s me' \
+  --compressed \
+  'https://example.com/a?b=1&c=2'`, f.ToCurl(CurlOptions{}))
+
+	// POST 带请求体时不需要 -X，二进制内容使用 $'...'
+	f.Request = &Request{
+		Method: http.MethodPost,
+		URL:    "http://127.0.0.1:8080/upload",
+		Host:   "api.local",
+		Proto:  "HTTP/2.0",
+		Header: http.Header{},
+		Body:   []byte("a\x00'\n"),
+	}
+	require.Equal(t, `curl \
+  --http2 \
+  --insecure \
+  --proxy http://127.0.0.1:8888 \
+  -H 'Host: api.local' \
+  --data-binary $'a\x00\'\n' \
+  http://127.0.0.1:8080/upload`, f.ToCurl(CurlOptions{Insecure: true, Proxy: "http://127.0.0.1:8888"}))
+
+	f.Request = &Request{Method: http.MethodPut, URL: "http://x/", BodyFile: "/tmp/body", BodySize: 10}
+	require.Equal(t, "curl \\\n  -X PUT \\\n  --data-binary @/tmp/body \\\n  http://x/", f.ToCurl(CurlOptions{}))
+
+	f.Request = &Request{Method: http.MethodHead, URL: "http://x/", Body: []byte("ab"), BodySize: 5}
+	require.True(t, strings.HasPrefix(f.ToCurl(CurlOptions{}), "# request body truncated to 2 of 5 bytes\ncurl \\\n  --head"))
+}
@@ -0,0 +1,147 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CurlOptions 生成 curl 命令的选项
+type CurlOptions struct {
+	// Insecure 添加 --insecure，不校验服务器证书，例如经过MITM代理时
+	Insecure bool
+
+	// Proxy 添加 --proxy，经由该代理发送请求
+	Proxy string
+}
+
+// curlSkipHeaders curl 自动生成的头部
+var curlSkipHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	ReplayHeader:        true,
+}
+
+// ToCurl 将请求转换为可以在 POSIX shell 中执行的 curl 命令，每个选项一行。
+// 请求体保存在临时文件中时使用 --data-binary @文件，内容被截断时添加注释
+func (f *Flow) ToCurl(opts CurlOptions) string {
+	req := f.Request
+	if req == nil {
+		return ""
+	}
+	args := []string{"curl"}
+	add := func(parts ...string) {
+		args = append(args, strings.Join(parts, " "))
+	}
+
+	hasBody := len(req.Body) > 0 || req.BodyFile != ""
+	switch {
+	case req.Method == http.MethodHead:
+		add("--head")
+	case req.Method == http.MethodPost && hasBody:
+	case req.Method != "" && req.Method != http.MethodGet:
+		add("-X", shellQuote(req.Method))
+	}
+	switch req.Proto {
+	case "HTTP/1.0":
+		add("--http1.0")
+	case "HTTP/2.0", "HTTP/2":
+		add("--http2")
+	}
+	if opts.Insecure {
+		add("--insecure")
+	}
+	if opts.Proxy != "" {
+		add("--proxy", shellQuote(opts.Proxy))
+	}
+
+	// Host 与URL中的主机不同时需要显式指定
+	if u, err := url.Parse(req.URL); err == nil && req.Host != "" && !strings.EqualFold(req.Host, u.Host) {
+		add("-H", shellQuote("Host: "+req.Host))
+	}
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		if !curlSkipHeaders[http.CanonicalHeaderKey(name)] {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	compressed := false
+	for _, name := range names {
+		for _, v := range req.Header[name] {
+			add("-H", shellQuote(name+": "+v))
+		}
+		if strings.EqualFold(name, "Accept-Encoding") {
+			compressed = true
+		}
+	}
+	if compressed {
+		add("--compressed")
+	}
+
+	switch {
+	case req.BodyFile != "":
+		add("--data-binary", shellQuote("@"+req.BodyFile))
+	case len(req.Body) > 0:
+		add("--data-binary", shellQuote(string(req.Body)))
+	}
+	add(shellQuote(req.URL))
+
+	cmd := strings.Join(args, " \\\n  ")
+	if req.BodyFile == "" && req.Truncated() {
+		cmd = fmt.Sprintf("# request body truncated to %d of %d bytes\n%s", len(req.Body), req.BodySize, cmd)
+	}
+	return cmd
+}
+
+// shellQuote 返回 s 在 POSIX shell 中的字面量，包含不可打印字符时使用 $'...'
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r < utf8.RuneSelf && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./-_", r)))
+	}) < 0 {
+		return s
+	}
+	printable := utf8.ValidString(s) && strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsPrint(r) && r != '\n' && r != '\t'
+	}) < 0
+	if printable {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+	var b strings.Builder
+	b.WriteString("$'")
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		case r == '\\' || r == '\'':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case !unicode.IsPrint(r):
+			for j := range size {
+				fmt.Fprintf(&b, `\x%02x`, s[i+j])
+			}
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
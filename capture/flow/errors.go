@@ -0,0 +1,176 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/textproto"
+	"syscall"
+)
+
+// ErrorCode 流失败的分类，钩子和导出器据此区分失败原因而不必匹配错误信息
+type ErrorCode string
+
+const (
+	// CodeDNSFailure 上游主机名解析失败
+	CodeDNSFailure ErrorCode = "dns_failure"
+
+	// CodeDialRefused 上游拒绝连接
+	CodeDialRefused ErrorCode = "dial_refused"
+
+	// CodeDialFailed 连接上游失败，例如网络不可达或上游代理拒绝
+	CodeDialFailed ErrorCode = "dial_failed"
+
+	// CodeTLSVerifyFailure 上游证书校验失败
+	CodeTLSVerifyFailure ErrorCode = "tls_verify_failure"
+
+	// CodeTLSHandshakeFailure 与上游的TLS握手失败
+	CodeTLSHandshakeFailure ErrorCode = "tls_handshake_failure"
+
+	// CodeClientTLSFailure 客户端拒绝代理签发的证书，例如客户端固定了证书
+	CodeClientTLSFailure ErrorCode = "client_tls_failure"
+
+	// CodeClientAbort 客户端在流结束前断开连接
+	CodeClientAbort ErrorCode = "client_abort"
+
+	// CodeClientTimeout 读取请求或写入响应时客户端超时
+	CodeClientTimeout ErrorCode = "client_timeout"
+
+	// CodeUpstreamTimeout 连接上游或等待上游响应超时
+	CodeUpstreamTimeout ErrorCode = "upstream_timeout"
+
+	// CodeUpstreamReset 上游在响应完成前断开连接
+	CodeUpstreamReset ErrorCode = "upstream_reset"
+
+	// CodeProtocolError 请求或响应不符合HTTP协议
+	CodeProtocolError ErrorCode = "protocol_error"
+
+	// CodeRateLimited 超出限流
+	CodeRateLimited ErrorCode = "rate_limited"
+
+	// CodeOverloaded 超出代理的并发限制
+	CodeOverloaded ErrorCode = "overloaded"
+
+	// CodeHookFailure 钩子、脚本或断点处理失败
+	CodeHookFailure ErrorCode = "hook_failure"
+
+	// CodeCanceled 流被取消，例如代理关闭
+	CodeCanceled ErrorCode = "canceled"
+
+	// CodeOther 无法分类的错误
+	CodeOther ErrorCode = "other"
+)
+
+// Error 带分类的流错误，错误信息与底层错误相同
+type Error struct {
+	// Code 错误分类
+	Code ErrorCode
+
+	// Err 底层错误
+	Err error
+}
+
+// NewError 创建带分类的错误
+func NewError(code ErrorCode, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return string(e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Annotate 返回分类为 code 的错误，err 已能分类时原样返回
+func Annotate(err error, code ErrorCode) error {
+	if err == nil || Classify(err) != CodeOther {
+		return err
+	}
+	return NewError(code, err)
+}
+
+// Classify 返回错误的分类，优先使用错误链中最外层 *Error 的分类，
+// 其次按DNS、连接、TLS、超时和协议错误的类型判断，都不匹配时返回 CodeOther，nil 返回空
+func Classify(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	var fe *Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return CodeDNSFailure
+	}
+	if isVerifyError(err) {
+		return CodeTLSVerifyFailure
+	}
+	var alert tls.AlertError
+	var record tls.RecordHeaderError
+	if errors.As(err, &alert) || errors.As(err, &record) {
+		return CodeTLSHandshakeFailure
+	}
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return CodeUpstreamTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return CodeCanceled
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return CodeDialRefused
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return CodeDialFailed
+	}
+	var protoErr *http.ProtocolError
+	var textErr textproto.ProtocolError
+	if errors.As(err, &protoErr) || errors.As(err, &textErr) {
+		return CodeProtocolError
+	}
+	return CodeOther
+}
+
+// isVerifyError 判断是否为证书校验错误
+func isVerifyError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &verifyErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
+
+// Fail 记录流的错误信息和分类
+func (f *Flow) Fail(err error) {
+	f.Error = err.Error()
+	f.ErrorCode = Classify(err)
+}
+
+// Err 返回流的错误，流没有失败时返回nil。从文件导入的流没有分类时为 CodeOther
+func (f *Flow) Err() error {
+	if f.Error == "" {
+		return nil
+	}
+	code := f.ErrorCode
+	if code == "" {
+		code = CodeOther
+	}
+	return NewError(code, errors.New(f.Error))
+}
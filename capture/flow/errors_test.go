@@ -0,0 +1,74 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+
+func TestClassify(t *testing.T) {
+	dial := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: err}
+	}
+	for want, err := range map[ErrorCode]error{
+		CodeDNSFailure:       dial(&net.DNSError{Err: "no such host", Name: "nx.example", IsNotFound: true}),
+		CodeDialRefused:      dial(os.NewSyscallError("connect", syscall.ECONNREFUSED)),
+		CodeDialFailed:       dial(os.NewSyscallError("connect", syscall.ENETUNREACH)),
+		CodeTLSVerifyFailure: fmt.Errorf("verify: %w", x509.UnknownAuthorityError{}),
+		CodeUpstreamTimeout:  fmt.Errorf("read: %w", context.DeadlineExceeded),
+		CodeCanceled:         context.Canceled,
+		CodeOther:            io.ErrUnexpectedEOF,
+	} {
+		require.Equal(t, want, Classify(err), err.Error())
+	}
+	require.Empty(t, Classify(nil))
+
+	// 显式分类优先
+	err := fmt.Errorf("write: %w", NewError(CodeClientAbort, io.ErrClosedPipe))
+	require.Equal(t, CodeClientAbort, Classify(err))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+	require.Equal(t, "write: io: read/write on closed pipe", err.Error())
+}
+
+func TestAnnotate(t *testing.T) {
+	require.Nil(t, Annotate(nil, CodeProtocolError))
+
+	err := Annotate(errors.New("malformed HTTP response"), CodeProtocolError)
+	require.Equal(t, CodeProtocolError, Classify(err))
+
+	// 已能分类的错误保持原分类
+	timeout := fmt.Errorf("read: %w", context.DeadlineExceeded)
+	require.Same(t, timeout, Annotate(timeout, CodeProtocolError))
+}
+
+func TestFlow_Fail(t *testing.T) {
+	f := &Flow{}
+	require.NoError(t, f.Err())
+
+	f.Fail(NewError(CodeUpstreamReset, io.ErrUnexpectedEOF))
+	require.Equal(t, "unexpected EOF", f.Error)
+	require.Equal(t, CodeUpstreamReset, f.ErrorCode)
+
+	var fe *Error
+	require.ErrorAs(t, f.Err(), &fe)
+	require.Equal(t, CodeUpstreamReset, fe.Code)
+
+	// 导入的流只有错误信息
+	imported := &Flow{Error: "no response"}
+	require.Equal(t, CodeOther, Classify(imported.Err()))
+}
@@ -0,0 +1,273 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType 流生命周期事件类型
+type EventType string
+
+const (
+	// EventRequestStarted 收到请求行和请求头部
+	EventRequestStarted EventType = "request_started"
+
+	// EventResponseHeaders 收到上游或本地规则的响应头部
+	EventResponseHeaders EventType = "response_headers"
+
+	// EventBodyChunk 读取到一段请求体或响应体
+	EventBodyChunk EventType = "body_chunk"
+
+	// EventCompleted 流正常结束
+	EventCompleted EventType = "completed"
+
+	// EventError 流以错误结束
+	EventError EventType = "error"
+)
+
+// Event 流生命周期事件，字段按事件类型选择性填充
+type Event struct {
+	Type   EventType `json:"type"`
+	FlowID string    `json:"flow_id"`
+	Time   time.Time `json:"time"`
+
+	// Method 和 URL 仅 request_started、completed 和 error
+	Method string `json:"method,omitempty"`
+	URL    string `json:"url,omitempty"`
+
+	// StatusCode 仅 response_headers、completed 和 error
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Header 请求头部或响应头部
+	Header http.Header `json:"header,omitempty"`
+
+	// Part 内容所属的部分："request" 或 "response"，仅 body_chunk
+	Part string `json:"part,omitempty"`
+
+	// Offset 和 Size 本段内容在整个内容中的偏移和长度，仅 body_chunk
+	Offset int64 `json:"offset,omitempty"`
+	Size   int   `json:"size,omitempty"`
+
+	// BodySize 响应体的总长度，仅 completed 和 error
+	BodySize int64 `json:"body_size,omitempty"`
+
+	// Duration 流持续的毫秒数，仅 completed 和 error
+	Duration float64 `json:"duration_ms,omitempty"`
+
+	// Error 和 ErrorCode 错误信息和分类，仅 error
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+// Bus 流事件的发布订阅，订阅方消费过慢时丢弃事件而不阻塞代理。
+// nil Bus 上的发布方法均为空操作
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[chan Event]func(*Flow) bool
+	active atomic.Int32
+
+	// open 已开始但还没有结束的流的数量
+	open atomic.Int64
+
+	// finished 流结束时同步调用的回调
+	finished []func(*Flow)
+
+	// redact 发布带有头部的事件前处理敏感内容
+	redact func(*Event)
+}
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return &Bus{subs: make(map[chan Event]func(*Flow) bool)}
+}
+
+// Subscribe 订阅事件，buffer 为通道缓冲大小，match 不为nil时只接收所属流满足条件的事件。
+// match 在发布事件的goroutine中按事件发生时的流状态调用，例如 request_started 时还没有响应。
+// 返回的函数用于取消订阅并关闭通道
+func (b *Bus) Subscribe(buffer int, match func(*Flow) bool) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = match
+	b.active.Add(1)
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.active.Add(-1)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// OnFinished 注册流结束时的回调，回调在代理的goroutine中同步执行，
+// 与 Store.OnAdd 不同，不受捕获过滤器和内存限制的影响
+func (b *Bus) OnFinished(fn func(*Flow)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.finished = append(b.finished, fn)
+}
+
+// SetRedactor 设置发布 request_started 和 response_headers 事件前处理头部和URL中敏感内容的函数。
+// 这两个事件在流保存前发布，不经过保存时的脱敏
+func (b *Bus) SetRedactor(fn func(*Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.redact = fn
+}
+
+// publishRedacted 脱敏后发布事件，e 中的头部必须是副本
+func (b *Bus) publishRedacted(f *Flow, e Event) {
+	b.mu.RLock()
+	redact := b.redact
+	b.mu.RUnlock()
+	if redact != nil {
+		redact(&e)
+	}
+	b.Publish(f, e)
+}
+
+// Active 是否有订阅方，没有订阅方时调用方可以跳过构造事件
+func (b *Bus) Active() bool {
+	return b != nil && b.active.Load() > 0
+}
+
+// InFlight 返回已开始但还没有结束的流的数量，nil Bus 返回0
+func (b *Bus) InFlight() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.open.Load()
+}
+
+// Publish 发布流 f 的事件，未设置 Time 时使用当前时间
+func (b *Bus) Publish(f *Flow, e Event) {
+	if !b.Active() {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch, match := range b.subs {
+		if match != nil && !match(f) {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Started 发布 request_started 事件，并计入进行中的流
+func (b *Bus) Started(f *Flow) {
+	if b == nil {
+		return
+	}
+	b.open.Add(1)
+	if !b.Active() || f.Request == nil {
+		return
+	}
+	b.publishRedacted(f, Event{
+		Type:   EventRequestStarted,
+		FlowID: f.ID,
+		Time:   f.StartTime,
+		Method: f.Request.Method,
+		URL:    f.Request.URL,
+		Header: f.Request.Header.Clone(),
+	})
+}
+
+// ResponseHeaders 发布 response_headers 事件
+func (b *Bus) ResponseHeaders(f *Flow) {
+	if !b.Active() || f.Response == nil {
+		return
+	}
+	b.publishRedacted(f, Event{
+		Type:       EventResponseHeaders,
+		FlowID:     f.ID,
+		StatusCode: f.Response.StatusCode,
+		Header:     f.Response.Header.Clone(),
+	})
+}
+
+// Finished 调用结束回调，并根据 f.Error 发布 completed 或 error 事件。
+// 事件包含请求行和响应状态，订阅方不需要关联之前的事件即可显示整个流
+func (b *Bus) Finished(f *Flow) {
+	if b == nil {
+		return
+	}
+	b.open.Add(-1)
+	b.mu.RLock()
+	finished := b.finished
+	b.mu.RUnlock()
+	for _, fn := range finished {
+		fn(f)
+	}
+	if !b.Active() {
+		return
+	}
+	e := Event{
+		Type:     EventCompleted,
+		FlowID:   f.ID,
+		Duration: float64(f.Duration()) / float64(time.Millisecond),
+	}
+	if f.Request != nil {
+		e.Method, e.URL = f.Request.Method, f.Request.URL
+	}
+	if f.Response != nil {
+		e.StatusCode = f.Response.StatusCode
+		e.BodySize = f.Response.BodyLen()
+	}
+	if f.Error != "" {
+		e.Type = EventError
+		e.Error = f.Error
+		e.ErrorCode = f.ErrorCode
+	}
+	b.Publish(f, e)
+}
+
+// BodyReader 包装 r，每次读取到数据时发布 body_chunk 事件，没有订阅方时原样返回 r
+func (b *Bus) BodyReader(f *Flow, part string, r io.Reader) io.Reader {
+	if !b.Active() {
+		return r
+	}
+	return &chunkReader{bus: b, flow: f, part: part, r: r}
+}
+
+// chunkReader 发布 body_chunk 事件的读取器
+type chunkReader struct {
+	bus    *Bus
+	flow   *Flow
+	part   string
+	r      io.Reader
+	offset int64
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.bus.Publish(c.flow, Event{
+			Type:   EventBodyChunk,
+			FlowID: c.flow.ID,
+			Part:   c.part,
+			Offset: c.offset,
+			Size:   n,
+		})
+		c.offset += int64(n)
+	}
+	return n, err
+}
@@ -0,0 +1,275 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/docker"
+	"github.com/f-dong/sniffy/capture/kube"
+	"github.com/f-dong/sniffy/capture/procinfo"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// ReplayHeader 重放请求携带的内部头部，值为 "<原始流ID> <新流ID>"，代理记录后移除，不会发往上游。
+// 不是重放的新请求（例如由 curl 命令发送）的原始流ID为 "-"
+const ReplayHeader = "X-Sniffy-Replay"
+
+// ClientCertHeader 发送请求时携带的内部头部，值为上游要求双向TLS时出示的客户端证书的登记标识，
+// 代理读取后移除，不会发往上游
+const ClientCertHeader = "X-Sniffy-Client-Cert"
+
+// Flow 一次完整的请求/响应交互记录
+type Flow struct {
+	// ID 流唯一标识
+	ID string `json:"id"`
+
+	// StartTime 请求开始时间
+	StartTime time.Time `json:"start_time"`
+
+	// EndTime 响应结束时间
+	EndTime time.Time `json:"end_time"`
+
+	// ClientAddr 原始客户端地址（经PROXY protocol还原后）
+	ClientAddr string `json:"client_addr"`
+
+	// ProxyUser 通过代理认证的用户名，未启用认证时为空
+	ProxyUser string `json:"proxy_user,omitempty"`
+
+	// Listener 接受连接的命名监听器，主监听器为空
+	Listener string `json:"listener,omitempty"`
+
+	// PeerAddr 直接相连的对端地址，与 ClientAddr 不同时表示经过了负载均衡器
+	PeerAddr string `json:"peer_addr,omitempty"`
+
+	// Process 发起连接的本地进程，仅对本机流量可用
+	Process *procinfo.Process `json:"process,omitempty"`
+
+	// Container 发起连接的Docker容器，仅在启用容器查找时可用
+	Container *docker.Container `json:"container,omitempty"`
+
+	// Pod 作为边车运行时 sniffy 所在的 Kubernetes Pod，边车捕获的都是这个 Pod 的出站流量
+	Pod *kube.Pod `json:"pod,omitempty"`
+
+	// ClientHello 客户端TLS ClientHello，明文流量为nil
+	ClientHello *tlsinfo.ClientHello `json:"client_hello,omitempty"`
+
+	// Fingerprints TLS指纹（JA3/JA4/JA3S）
+	Fingerprints *tlsinfo.Fingerprints `json:"fingerprints,omitempty"`
+
+	// Intercepted TLS流量是否被解密
+	Intercepted bool `json:"intercepted,omitempty"`
+
+	// ServerAddr 上游服务器地址
+	ServerAddr string `json:"server_addr,omitempty"`
+
+	// ConnReused 请求使用了连接池中已有的上游连接
+	ConnReused bool `json:"conn_reused,omitempty"`
+
+	// UpstreamTLS 上游TLS会话信息、证书链和校验结果
+	UpstreamTLS *tlsinfo.UpstreamTLS `json:"upstream_tls,omitempty"`
+
+	// ReplayOf 重放来源流的ID，为空表示不是重放
+	ReplayOf string `json:"replay_of,omitempty"`
+
+	// Responder 生成本地响应的规则，为空表示响应来自上游
+	Responder string `json:"responder,omitempty"`
+
+	// Faults 触发的故障注入规则，为空表示未注入故障
+	Faults []string `json:"faults,omitempty"`
+
+	// Tags 脚本、标签规则或用户为流添加的标签
+	Tags []string `json:"tags,omitempty"`
+
+	// Comment 脚本或用户为流添加的备注
+	Comment string `json:"comment,omitempty"`
+
+	// Starred 流被加上星标，便于在大量流中找到
+	Starred bool `json:"starred,omitempty"`
+
+	// Marker 标记颜色，取值见 Markers，为空表示没有标记
+	Marker string `json:"marker,omitempty"`
+
+	// GraphQL 请求中的GraphQL操作，批量请求包含多个操作，非GraphQL请求为空
+	GraphQL []*GraphQLOperation `json:"graphql,omitempty"`
+
+	// Violations 请求或响应与API规范不符之处，未启用校验或没有问题时为空
+	Violations []*Violation `json:"violations,omitempty"`
+
+	// Credentials 请求或响应中携带的凭据，未启用检测或没有凭据时为空
+	Credentials []*Credential `json:"credentials,omitempty"`
+
+	// TraceID 请求 traceparent 头部中的W3C追踪ID，用于与后端的追踪对照
+	TraceID string `json:"trace_id,omitempty"`
+
+	// CorrelationID 请求的关联ID头部（如 X-Request-ID）的值，用于与后端日志对照
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// Timings 各阶段的时间点
+	Timings *Timings `json:"timings,omitempty"`
+
+	// Request 请求
+	Request *Request `json:"request"`
+
+	// Response 响应，请求失败时为nil
+	Response *Response `json:"response,omitempty"`
+
+	// Error 错误信息
+	Error string `json:"error,omitempty"`
+
+	// ErrorCode 错误分类，为空表示没有错误
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+
+	// TimedOut 超时的阶段，例如 dial、tls_handshake、response_header、flow，为空表示没有超时
+	TimedOut string `json:"timed_out,omitempty"`
+}
+
+// Request 捕获的HTTP请求
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Host   string      `json:"host"`
+	Proto  string      `json:"proto"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body,omitempty"`
+
+	// BodySize 请求体超过捕获限制被截断时的完整长度，未截断时为0
+	BodySize int64 `json:"body_size,omitempty"`
+
+	// BodyFile 保存完整请求体的临时文件，流从存储中移除时删除
+	BodyFile string `json:"body_file,omitempty"`
+
+	// Parsed 按内容类型解析出的结构化请求体，无法解析时为nil
+	Parsed *Parsed `json:"parsed,omitempty"`
+}
+
+// Response 捕获的HTTP响应
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Proto      string      `json:"proto"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body,omitempty"`
+
+	// BodySize 响应体超过捕获限制被截断时的完整长度，未截断时为0
+	BodySize int64 `json:"body_size,omitempty"`
+
+	// BodyFile 保存完整响应体的临时文件，流从存储中移除时删除
+	BodyFile string `json:"body_file,omitempty"`
+
+	// Parsed 按内容类型解析出的结构化响应体，无法解析时为nil
+	Parsed *Parsed `json:"parsed,omitempty"`
+}
+
+// GraphQLOperation 从请求中提取的GraphQL操作
+type GraphQLOperation struct {
+	// Name 操作名，匿名操作为空
+	Name string `json:"name,omitempty"`
+
+	// Type 操作类型：query、mutation 或 subscription
+	Type string `json:"type,omitempty"`
+
+	// Query 查询文档，持久化查询只发送哈希时为空
+	Query string `json:"query,omitempty"`
+
+	// Variables 查询变量
+	Variables map[string]any `json:"variables,omitempty"`
+
+	// PersistedHash 自动持久化查询（APQ）的sha256哈希
+	PersistedHash string `json:"persisted_hash,omitempty"`
+}
+
+// Violation 请求或响应与API规范不符之处
+type Violation struct {
+	// Kind 问题类型，例如 undocumented-status、unknown-field、type-mismatch
+	Kind string `json:"kind"`
+
+	// Location 问题所在的位置，例如 request.query.page 或 response.body.items[0].id
+	Location string `json:"location,omitempty"`
+
+	// Message 问题说明，不包含请求或响应中的值
+	Message string `json:"message"`
+}
+
+// Credential 流中检测到的凭据，不保存凭据本身
+type Credential struct {
+	// Kind 凭据类型，例如 bearer-token、basic-auth、api-key、aws-sigv4
+	Kind string `json:"kind"`
+
+	// Location 凭据所在的位置，例如 request.header.Authorization 或 request.query.api_key
+	Location string `json:"location"`
+
+	// Fingerprint 凭据的 "sha256:" 哈希前缀，与 redact 的 hash 处理结果相同，便于关联同一凭据
+	Fingerprint string `json:"fingerprint"`
+
+	// Hint 不泄露凭据的说明，例如 Basic 认证的用户名或 AWS 的访问密钥ID和凭据范围
+	Hint string `json:"hint,omitempty"`
+}
+
+// New 创建新的流
+func New() *Flow {
+	return &Flow{
+		ID:        NewID(),
+		StartTime: time.Now(),
+	}
+}
+
+// NewID 生成随机流ID
+func NewID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Duration 返回流的持续时间
+func (f *Flow) Duration() time.Duration {
+	if f.EndTime.IsZero() {
+		return 0
+	}
+	return f.EndTime.Sub(f.StartTime)
+}
+
+// Tag 为流添加标签，已有的标签不会重复添加
+func (f *Flow) Tag(tag string) {
+	if tag == "" || slices.Contains(f.Tags, tag) {
+		return
+	}
+	f.Tags = append(f.Tags, tag)
+}
+
+// Untag 删除流的标签
+func (f *Flow) Untag(tag string) {
+	f.Tags = slices.DeleteFunc(f.Tags, func(t string) bool { return t == tag })
+	if len(f.Tags) == 0 {
+		f.Tags = nil
+	}
+}
+
+// Markers 可用的标记颜色
+var Markers = []string{"red", "orange", "yellow", "green", "blue", "purple", "gray"}
+
+// CheckMarker 检查标记颜色是否可用，空字符串表示清除标记
+func CheckMarker(color string) error {
+	if color != "" && !slices.Contains(Markers, color) {
+		return fmt.Errorf("invalid marker %q (expected one of %s)", color, strings.Join(Markers, ", "))
+	}
+	return nil
+}
+
+// Mark 设置流的标记颜色，color 为空时清除标记
+func (f *Flow) Mark(color string) error {
+	if err := CheckMarker(color); err != nil {
+		return err
+	}
+	f.Marker = color
+	return nil
+}
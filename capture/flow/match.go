@@ -0,0 +1,86 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// Matcher 按方法、主机和路径前缀匹配流，空字段匹配任意值
+type Matcher struct {
+	// Method 请求方法，不区分大小写
+	Method string `json:"method,omitempty"`
+
+	// Host 主机模式，支持 "*.example.com"，"*" 匹配任意主机
+	Host string `json:"host,omitempty"`
+
+	// Path 请求路径前缀
+	Path string `json:"path,omitempty"`
+}
+
+// ParseMatcher 解析 "[METHOD ]host[/path]" 格式的匹配规则，例如 "POST api.example.com/v1"
+func ParseMatcher(s string) Matcher {
+	var m Matcher
+	s = strings.TrimSpace(s)
+	if method, rest, ok := strings.Cut(s, " "); ok {
+		m.Method = strings.ToUpper(method)
+		s = strings.TrimSpace(rest)
+	}
+	if host, path, ok := strings.Cut(s, "/"); ok {
+		m.Host = host
+		m.Path = "/" + path
+	} else {
+		m.Host = s
+	}
+	if m.Host == "*" {
+		m.Host = ""
+	}
+	return m
+}
+
+// Match 判断流的请求是否匹配
+func (m Matcher) Match(f *Flow) bool {
+	if f == nil || f.Request == nil {
+		return false
+	}
+	if m.Method != "" && !strings.EqualFold(m.Method, f.Request.Method) {
+		return false
+	}
+	if m.Host == "" && m.Path == "" {
+		return true
+	}
+
+	u, err := url.Parse(f.Request.URL)
+	if err != nil {
+		return false
+	}
+	if m.Host != "" {
+		host := u.Hostname()
+		if host == "" {
+			host = f.Request.Host
+		}
+		if !tlsinfo.MatchHost(m.Host, host) {
+			return false
+		}
+	}
+	return strings.HasPrefix(u.Path, m.Path)
+}
+
+// String 返回 ParseMatcher 可解析的格式
+func (m Matcher) String() string {
+	s := m.Host
+	if s == "" {
+		s = "*"
+	}
+	s += m.Path
+	if m.Method != "" {
+		s = m.Method + " " + s
+	}
+	return s
+}
@@ -0,0 +1,50 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Parsed 结构化的消息体，Value 由 map[string]any、[]any 和标量组成，可直接编码为JSON
+type Parsed struct {
+	// Format 解析器名称，例如 json、xml、form、protobuf
+	Format string `json:"format"`
+
+	// Value 解析结果
+	Value any `json:"value"`
+}
+
+// Field 按点分路径查找字段，例如 "user.emails.0"，数字段同时用作数组下标
+func (p *Parsed) Field(path string) (any, bool) {
+	if p == nil {
+		return nil, false
+	}
+	v := p.Value
+	if path == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
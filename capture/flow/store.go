@@ -0,0 +1,341 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// DefaultMemoryLimit 默认的流占用内存上限
+const DefaultMemoryLimit = 1 << 30
+
+// Store 内存流存储，按加入顺序保存
+type Store struct {
+	mu        sync.RWMutex
+	flows     []*Flow
+	index     map[string]*Flow
+	listeners []func(*Flow)
+	updaters  []func(*Flow)
+	flushers  []func(context.Context) error
+
+	// limit 内存中保留的最大流数量，0 表示不限制
+	limit int
+
+	// memoryLimit 流占用内存的上限（估算值），0 表示不限制
+	memoryLimit int64
+
+	// bytes 当前流占用的内存（估算值）
+	bytes int64
+
+	// stripped flows 中前 stripped 个流的内容已被丢弃
+	stripped int
+
+	// evicted 因超出限制丢弃的流数量
+	evicted int64
+
+	// droppedBodies 因超出内存上限丢弃内容的流数量
+	droppedBodies int64
+
+	// filter 捕获过滤器，为nil时记录所有流
+	filter func(*Flow) bool
+}
+
+// NewStore 创建新的内存流存储
+func NewStore() *Store {
+	return &Store{
+		index: make(map[string]*Flow),
+	}
+}
+
+// SetLimit 设置内存中保留的最大流数量，超出时丢弃最早的流，0 表示不限制。
+// 通常在流已写入持久化存储时使用
+func (s *Store) SetLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = n
+	s.trim()
+}
+
+// SetMemoryLimit 设置流占用内存的上限，0 表示不限制。超出时先从最早的流开始丢弃请求体和响应体，
+// 仍然超出时再丢弃最早的流。内容写入了临时文件的流仍然可以读取完整内容
+func (s *Store) SetMemoryLimit(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.memoryLimit = n
+	s.trim()
+}
+
+// SetFilter 设置捕获过滤器，不满足过滤器的流不会被记录，也不会通知回调
+func (s *Store) SetFilter(fn func(*Flow) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filter = fn
+}
+
+// OnAdd 注册流加入存储后的回调，回调在添加流的goroutine中执行
+func (s *Store) OnAdd(fn func(*Flow)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// OnUpdate 注册流的元数据被 Update 修改后的回调，参数为修改后的流
+func (s *Store) OnUpdate(fn func(*Flow)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updaters = append(s.updaters, fn)
+}
+
+// OnFlush 注册刷新回调，Flush 时调用，用于把缓冲的流写入持久化存储或导出
+func (s *Store) OnFlush(fn func(context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushers = append(s.flushers, fn)
+}
+
+// Flush 依次调用所有刷新回调，返回所有回调的错误
+func (s *Store) Flush(ctx context.Context) error {
+	s.mu.RLock()
+	flushers := s.flushers
+	s.mu.RUnlock()
+
+	var errs []error
+	for _, fn := range flushers {
+		if err := fn(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Add 添加流
+func (s *Store) Add(f *Flow) {
+	s.mu.Lock()
+	if s.filter != nil && !s.filter(f) {
+		s.mu.Unlock()
+		f.RemoveBodyFiles()
+		return
+	}
+	if _, exists := s.index[f.ID]; exists {
+		s.mu.Unlock()
+		return
+	}
+	s.flows = append(s.flows, f)
+	s.index[f.ID] = f
+	s.bytes += memSize(f)
+	s.trim()
+	listeners := s.listeners
+	s.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(f)
+	}
+}
+
+// Update 修改流的标签、备注等元数据。fn 修改的是流的副本，副本替换存储中的流，
+// 已经取得旧流的读者不受影响；副本与旧流共享请求和响应，fn 不能修改它们。
+// 返回修改后的流，流不存在时返回false
+func (s *Store) Update(id string, fn func(*Flow)) (*Flow, bool) {
+	s.mu.Lock()
+	old, ok := s.index[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, false
+	}
+	f := *old
+	f.Tags = slices.Clone(old.Tags)
+	fn(&f)
+	s.index[id] = &f
+	if i := slices.Index(s.flows, old); i >= 0 {
+		s.flows[i] = &f
+	}
+	s.bytes += memSize(&f) - memSize(old)
+	updaters := s.updaters
+	s.mu.Unlock()
+
+	for _, fn := range updaters {
+		fn(&f)
+	}
+	return &f, true
+}
+
+// Get 根据ID获取流
+func (s *Store) Get(id string) (*Flow, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.index[id]
+	return f, ok
+}
+
+// List 返回所有流的快照
+func (s *Store) List() []*Flow {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Flow(nil), s.flows...)
+}
+
+// Len 返回流数量
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.flows)
+}
+
+// Clear 清空存储，并删除流的临时文件
+func (s *Store) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.flows {
+		f.RemoveBodyFiles()
+	}
+	s.flows = nil
+	s.index = make(map[string]*Flow)
+	s.bytes = 0
+	s.stripped = 0
+}
+
+// StoreStats 内存流存储的统计
+type StoreStats struct {
+	// Flows 内存中的流数量
+	Flows int `json:"flows"`
+
+	// Bytes 流占用的内存（估算值）
+	Bytes int64 `json:"bytes"`
+
+	// MaxFlows 最大流数量，0 表示不限制
+	MaxFlows int `json:"max_flows"`
+
+	// MemoryLimit 内存上限，0 表示不限制
+	MemoryLimit int64 `json:"memory_limit"`
+
+	// Evicted 因超出限制丢弃的流数量
+	Evicted int64 `json:"evicted"`
+
+	// DroppedBodies 因超出内存上限丢弃内容的流数量
+	DroppedBodies int64 `json:"dropped_bodies"`
+}
+
+// Stats 返回存储的统计
+func (s *Store) Stats() StoreStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return StoreStats{
+		Flows:         len(s.flows),
+		Bytes:         s.bytes,
+		MaxFlows:      s.limit,
+		MemoryLimit:   s.memoryLimit,
+		Evicted:       s.evicted,
+		DroppedBodies: s.droppedBodies,
+	}
+}
+
+// trim 丢弃超出数量限制的最早的流并删除其临时文件。超出内存上限时先从最早的流开始丢弃内容，
+// 仍然超出时再丢弃最早的流。调用方需持有写锁
+func (s *Store) trim() {
+	drop := 0
+	if s.limit > 0 && len(s.flows) > s.limit {
+		drop = len(s.flows) - s.limit
+	}
+	if s.memoryLimit > 0 {
+		var freed int64
+		for _, f := range s.flows[:drop] {
+			freed += memSize(f)
+		}
+		s.stripped = max(s.stripped, drop)
+		for ; s.bytes-freed > s.memoryLimit && s.stripped < len(s.flows); s.stripped++ {
+			s.strip(s.stripped)
+		}
+		for ; s.bytes-freed > s.memoryLimit && drop < len(s.flows); drop++ {
+			freed += memSize(s.flows[drop])
+		}
+	}
+	if drop == 0 {
+		return
+	}
+	for i, f := range s.flows[:drop] {
+		s.bytes -= memSize(f)
+		f.RemoveBodyFiles()
+		delete(s.index, f.ID)
+		s.flows[i] = nil
+	}
+	s.evicted += int64(drop)
+	s.stripped = max(s.stripped-drop, 0)
+	s.flows = s.flows[drop:]
+}
+
+// strip 用不带内容的副本替换第 i 个流，调用方需持有写锁。
+// 已取得原始流的调用方不受影响，流的临时文件保留
+func (s *Store) strip(i int) {
+	f := s.flows[i]
+	c := stripBodies(f)
+	if c == nil {
+		return
+	}
+	s.bytes += memSize(c) - memSize(f)
+	s.flows[i] = c
+	s.index[f.ID] = c
+	s.droppedBodies++
+}
+
+// stripBodies 返回去掉请求体、响应体和解析结果的副本，没有可丢弃的内容时返回nil。
+// 副本保留完整长度，Truncated 返回true
+func stripBodies(f *Flow) *Flow {
+	hasBody := func(body []byte, parsed *Parsed) bool { return len(body) > 0 || parsed != nil }
+	if (f.Request == nil || !hasBody(f.Request.Body, f.Request.Parsed)) &&
+		(f.Response == nil || !hasBody(f.Response.Body, f.Response.Parsed)) {
+		return nil
+	}
+	c := *f
+	if f.Request != nil {
+		r := *f.Request
+		r.BodySize, r.Body, r.Parsed = r.BodyLen(), nil, nil
+		c.Request = &r
+	}
+	if f.Response != nil {
+		r := *f.Response
+		r.BodySize, r.Body, r.Parsed = r.BodyLen(), nil, nil
+		c.Response = &r
+	}
+	return &c
+}
+
+// flowOverhead 每个流除头部和内容外的估算内存开销
+const flowOverhead = 1 << 10
+
+// memSize 估算流占用的内存。解析结果按与原始内容相同的大小估算
+func memSize(f *Flow) int64 {
+	n := int64(flowOverhead + len(f.Error) + len(f.Comment))
+	if r := f.Request; r != nil {
+		n += int64(len(r.URL)+len(r.Body)) + headerSize(r.Header)
+		if r.Parsed != nil {
+			n += int64(len(r.Body))
+		}
+	}
+	if r := f.Response; r != nil {
+		n += int64(len(r.Body)) + headerSize(r.Header)
+		if r.Parsed != nil {
+			n += int64(len(r.Body))
+		}
+	}
+	for _, op := range f.GraphQL {
+		n += int64(len(op.Query))
+	}
+	return n
+}
+
+func headerSize(h http.Header) int64 {
+	var n int
+	for k, vs := range h {
+		for _, v := range vs {
+			n += len(k) + len(v) + 4
+		}
+	}
+	return int64(n)
+}
@@ -0,0 +1,36 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flow
+
+import "time"
+
+// Timings 流各阶段的时间点，未经历的阶段为零值，例如复用连接或本地响应时没有拨号阶段
+type Timings struct {
+	// ClientTLSStart 和 ClientTLSDone 解密时与客户端的TLS握手，只记录在连接上的第一个流
+	ClientTLSStart time.Time `json:"client_tls_start,omitzero"`
+	ClientTLSDone  time.Time `json:"client_tls_done,omitzero"`
+
+	// DNSStart 和 DNSDone 解析上游主机名，上游地址为IP时两者相同
+	DNSStart time.Time `json:"dns_start,omitzero"`
+	DNSDone  time.Time `json:"dns_done,omitzero"`
+
+	// ConnectStart 和 ConnectDone 建立上游TCP连接
+	ConnectStart time.Time `json:"connect_start,omitzero"`
+	ConnectDone  time.Time `json:"connect_done,omitzero"`
+
+	// TLSStart 和 TLSDone 与上游的TLS握手
+	TLSStart time.Time `json:"tls_start,omitzero"`
+	TLSDone  time.Time `json:"tls_done,omitzero"`
+
+	// RequestSent 请求完整写入上游
+	RequestSent time.Time `json:"request_sent,omitzero"`
+
+	// FirstByte 收到上游响应的第一个字节
+	FirstByte time.Time `json:"first_byte,omitzero"`
+
+	// ResponseDone 读取完上游响应体
+	ResponseDone time.Time `json:"response_done,omitzero"`
+}
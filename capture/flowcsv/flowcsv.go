@@ -0,0 +1,197 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flowcsv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// TimeFormat 时间列的格式，电子表格可以直接识别
+const TimeFormat = "2006-01-02 15:04:05.000"
+
+// column 一列的名称和取值
+type column struct {
+	name  string
+	value func(f *flow.Flow) string
+
+	// numeric 数值列不做公式转义
+	numeric bool
+}
+
+var columns = []column{
+	{name: "time", value: func(f *flow.Flow) string { return f.StartTime.Local().Format(TimeFormat) }},
+	{name: "id", value: func(f *flow.Flow) string { return f.ID }},
+	{name: "method", value: func(f *flow.Flow) string { return request(f).Method }},
+	{name: "scheme", value: func(f *flow.Flow) string { return parseURL(f).Scheme }},
+	{name: "host", value: host},
+	{name: "path", value: func(f *flow.Flow) string { return parseURL(f).Path }},
+	{name: "query", value: func(f *flow.Flow) string { return parseURL(f).RawQuery }},
+	{name: "url", value: func(f *flow.Flow) string { return request(f).URL }},
+	{name: "status", value: status, numeric: true},
+	{name: "duration_ms", value: duration, numeric: true},
+	{name: "request_size", value: func(f *flow.Flow) string { return strconv.FormatInt(request(f).BodyLen(), 10) }, numeric: true},
+	{name: "response_size", value: responseSize, numeric: true},
+	{name: "content_type", value: contentType},
+	{name: "client", value: func(f *flow.Flow) string { return f.ClientAddr }},
+	{name: "server", value: func(f *flow.Flow) string { return f.ServerAddr }},
+	{name: "tags", value: func(f *flow.Flow) string { return strings.Join(f.Tags, " ") }},
+	{name: "trace_id", value: func(f *flow.Flow) string { return f.TraceID }},
+	{name: "error", value: func(f *flow.Flow) string { return f.Error }},
+}
+
+// Columns 可选择的列
+var Columns = columnNames()
+
+// DefaultColumns 未指定列时输出的列
+var DefaultColumns = []string{"time", "method", "host", "path", "status", "duration_ms", "request_size", "response_size"}
+
+func columnNames() []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// Writer 将流的摘要写为CSV，第一行为列名
+type Writer struct {
+	w       *csv.Writer
+	columns []column
+	header  bool
+}
+
+// NewWriter 创建写入器，names 为列名及顺序，为空时使用 DefaultColumns，有未知列时返回错误
+func NewWriter(w io.Writer, names []string) (*Writer, error) {
+	if len(names) == 0 {
+		names = DefaultColumns
+	}
+	cw := &Writer{w: csv.NewWriter(w)}
+	for _, name := range names {
+		i := slices.IndexFunc(columns, func(c column) bool { return c.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown column %q (available: %s)", name, strings.Join(Columns, ", "))
+		}
+		cw.columns = append(cw.columns, columns[i])
+	}
+	return cw, nil
+}
+
+// WriteFlow 写入一个流的摘要，第一次写入前先写入列名
+func (cw *Writer) WriteFlow(f *flow.Flow) error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	record := make([]string, len(cw.columns))
+	for i, c := range cw.columns {
+		record[i] = c.value(f)
+		if !c.numeric {
+			record[i] = escapeFormula(record[i])
+		}
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *Writer) writeHeader() error {
+	if cw.header {
+		return nil
+	}
+	cw.header = true
+	names := make([]string, len(cw.columns))
+	for i, c := range cw.columns {
+		names[i] = c.name
+	}
+	return cw.w.Write(names)
+}
+
+// Flush 写入缓冲的数据，没有流时也写入列名
+func (cw *Writer) Flush() error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// Write 将流的摘要写为CSV
+func Write(w io.Writer, flows []*flow.Flow, names []string) error {
+	cw, err := NewWriter(w, names)
+	if err != nil {
+		return err
+	}
+	for _, f := range flows {
+		if err := cw.WriteFlow(f); err != nil {
+			return err
+		}
+	}
+	return cw.Flush()
+}
+
+// escapeFormula 在以公式字符开头的值前加单引号，避免捕获的内容在电子表格中作为公式执行
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func request(f *flow.Flow) *flow.Request {
+	if f.Request == nil {
+		return &flow.Request{}
+	}
+	return f.Request
+}
+
+func parseURL(f *flow.Flow) *url.URL {
+	u, err := url.Parse(request(f).URL)
+	if err != nil {
+		return &url.URL{}
+	}
+	return u
+}
+
+func host(f *flow.Flow) string {
+	if h := request(f).Host; h != "" {
+		return h
+	}
+	return parseURL(f).Host
+}
+
+func status(f *flow.Flow) string {
+	if f.Response == nil {
+		return ""
+	}
+	return strconv.Itoa(f.Response.StatusCode)
+}
+
+func duration(f *flow.Flow) string {
+	if f.EndTime.IsZero() {
+		return ""
+	}
+	return strconv.FormatFloat(float64(f.Duration())/float64(time.Millisecond), 'f', 3, 64)
+}
+
+func responseSize(f *flow.Flow) string {
+	if f.Response == nil {
+		return ""
+	}
+	return strconv.FormatInt(f.Response.BodyLen(), 10)
+}
+
+func contentType(f *flow.Flow) string {
+	if f.Response == nil {
+		return ""
+	}
+	return f.Response.Header.Get("Content-Type")
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flowcsv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+var start = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newFlow(id, url string, status int, body string) *flow.Flow {
+	return &flow.Flow{
+		ID:        id,
+		StartTime: start,
+		EndTime:   start.Add(1500 * time.Microsecond),
+		Request:   &flow.Request{Method: "GET", URL: url, Header: http.Header{}},
+		Response: &flow.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+			Body:       []byte(body),
+		},
+	}
+}
+
+func readCSV(t *testing.T, buf *bytes.Buffer) [][]string {
+	records, err := csv.NewReader(buf).ReadAll()
+	require.NoError(t, err)
+	return records
+}
+
+// --- 测试代码 ---
+
+func TestWrite_DefaultColumns(t *testing.T) {
+	var buf bytes.Buffer
+	flows := []*flow.Flow{
+		newFlow("a", "https://example.com/items?page=2", 200, "hello"),
+		{ID: "b", StartTime: start, Request: &flow.Request{Method: "POST", URL: "https://example.com/fail"}, Error: "refused"},
+	}
+	require.NoError(t, Write(&buf, flows, nil))
+
+	records := readCSV(t, &buf)
+	require.Equal(t, DefaultColumns, records[0])
+	require.Equal(t, []string{start.Local().Format(TimeFormat), "GET", "example.com", "/items", "200", "1.500", "0", "5"}, records[1])
+	require.Equal(t, []string{start.Local().Format(TimeFormat), "POST", "example.com", "/fail", "", "", "0", ""}, records[2])
+}
+
+func TestWrite_SelectedColumns(t *testing.T) {
+	var buf bytes.Buffer
+	f := newFlow("a", "https://example.com/x?q=1", 404, "")
+	f.Tags = []string{"api", "slow"}
+	require.NoError(t, Write(&buf, []*flow.Flow{f}, []string{"status", "id", "query", "tags", "content_type"}))
+	require.Equal(t, [][]string{
+		{"status", "id", "query", "tags", "content_type"},
+		{"404", "a", "q=1", "api slow", "text/plain"},
+	}, readCSV(t, &buf))
+}
+
+func TestWrite_EscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	f := newFlow("=cmd|' /C calc'!A0", "https://example.com/", 200, "")
+	require.NoError(t, Write(&buf, []*flow.Flow{f}, []string{"id", "status"}))
+	require.Equal(t, []string{"'=cmd|' /C calc'!A0", "200"}, readCSV(t, &buf)[1])
+}
+
+func TestWrite_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, nil, []string{"id", "url"}))
+	require.Equal(t, "id,url\n", buf.String())
+}
+
+func TestNewWriter_UnknownColumn(t *testing.T) {
+	_, err := NewWriter(&bytes.Buffer{}, []string{"status", "nope"})
+	require.ErrorContains(t, err, `unknown column "nope"`)
+}
@@ -0,0 +1,153 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flowdb
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/seal"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	bucketMeta = []byte("meta")
+	keyDataKey = []byte("data_key")
+)
+
+// blindSize 加密数据库中索引键的长度
+const blindSize = 16
+
+// cipherState 加密数据库的密钥。流用随机生成的数据密钥加密，数据密钥用配置的接收者加密后保存在数据库中，
+// 更换口令或接收者不需要重新加密所有流。主机和全文索引的键是数据密钥派生的HMAC，
+// 路径前缀无法用HMAC匹配，不建立路径索引；时间和状态码索引不加密
+type cipherState struct {
+	aead     cipher.AEAD
+	indexKey []byte
+}
+
+// OpenEncrypted 打开或创建加密的数据库文件。新建的数据库用 keys 的接收者加密数据密钥，
+// 已有的加密数据库用 keys 的身份解密数据密钥。keys 为nil时与 Open 相同，已有的数据库必须未加密
+func OpenEncrypted(path string, keys *seal.Keys) (*DB, error) {
+	d, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.initCipher(keys); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// initCipher 读取或生成数据密钥
+func (d *DB) initCipher(keys *seal.Keys) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		var dataKey []byte
+		if sealed := meta.Get(keyDataKey); sealed != nil {
+			if keys == nil || len(keys.Identities) == 0 {
+				return errors.New("flow database is encrypted, a passphrase or identity is required")
+			}
+			if dataKey, err = keys.Unseal(sealed); err != nil {
+				return fmt.Errorf("decrypt flow database key: %w", err)
+			}
+		} else {
+			if !keys.Enabled() {
+				return nil
+			}
+			if tx.Bucket(bucketFlows).Stats().KeyN > 0 {
+				return errors.New("flow database contains unencrypted flows")
+			}
+			dataKey = make([]byte, chacha20poly1305.KeySize)
+			if _, err := rand.Read(dataKey); err != nil {
+				return err
+			}
+			sealed, err := keys.Seal(dataKey)
+			if err != nil {
+				return fmt.Errorf("encrypt flow database key: %w", err)
+			}
+			if err := meta.Put(keyDataKey, sealed); err != nil {
+				return err
+			}
+		}
+		d.cipher, err = newCipherState(dataKey)
+		return err
+	})
+}
+
+func newCipherState(dataKey []byte) (*cipherState, error) {
+	if len(dataKey) != chacha20poly1305.KeySize {
+		return nil, errors.New("invalid flow database key")
+	}
+	aead, err := chacha20poly1305.NewX(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	indexKey := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, dataKey, nil, []byte("sniffy flowdb index")), indexKey); err != nil {
+		return nil, err
+	}
+	return &cipherState{aead: aead, indexKey: indexKey}, nil
+}
+
+// Encrypted 判断数据库是否加密
+func (d *DB) Encrypted() bool {
+	return d.cipher != nil
+}
+
+// encode 编码流，加密的数据库中为 "<nonce><密文>"，流ID作为附加数据防止记录被调换
+func (d *DB) encode(f *flow.Flow) ([]byte, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, fmt.Errorf("encode flow: %w", err)
+	}
+	if d.cipher == nil {
+		return data, nil
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSizeX, chacha20poly1305.NonceSizeX+len(data)+chacha20poly1305.Overhead)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return d.cipher.aead.Seal(nonce, nonce, data, []byte(f.ID)), nil
+}
+
+// decode 解码 encode 编码的流
+func (d *DB) decode(id, data []byte, f *flow.Flow) error {
+	if d.cipher != nil {
+		if len(data) < chacha20poly1305.NonceSizeX {
+			return errors.New("encrypted flow too short")
+		}
+		plain, err := d.cipher.aead.Open(nil, data[:chacha20poly1305.NonceSizeX], data[chacha20poly1305.NonceSizeX:], id)
+		if err != nil {
+			return errors.New("failed to decrypt flow")
+		}
+		data = plain
+	}
+	return json.Unmarshal(data, f)
+}
+
+// blind 返回加密数据库中索引键使用的形式，未加密时原样返回
+func (d *DB) blind(s string) []byte {
+	if d.cipher == nil {
+		return []byte(s)
+	}
+	mac := hmac.New(sha256.New, d.cipher.indexKey)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)[:blindSize]
+}
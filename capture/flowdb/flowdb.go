@@ -0,0 +1,349 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flowdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNotFound 流不存在
+var ErrNotFound = errors.New("flow not found")
+
+var (
+	bucketFlows  = []byte("flows")
+	bucketTime   = []byte("by_time")
+	bucketHost   = []byte("by_host")
+	bucketPath   = []byte("by_path")
+	bucketStatus = []byte("by_status")
+)
+
+// DB 基于bbolt的持久化流存储，流以JSON保存，并按时间、主机、路径和状态码建立索引，
+// 解码后的文本内容建立全文索引
+type DB struct {
+	db     *bolt.DB
+	cipher *cipherState
+}
+
+// Query 查询条件，零值字段不参与过滤，结果按开始时间升序排列
+type Query struct {
+	// Host 主机名（不含端口，大小写不敏感）
+	Host string `json:"host,omitempty"`
+
+	// PathPrefix 路径前缀
+	PathPrefix string `json:"path_prefix,omitempty"`
+
+	// Status 响应状态码，-1 表示没有响应的流
+	Status int `json:"status,omitempty"`
+
+	// Since 开始时间下限（包含）
+	Since time.Time `json:"since,omitempty"`
+
+	// Until 开始时间上限（不包含）
+	Until time.Time `json:"until,omitempty"`
+
+	// Filter 过滤表达式，在索引扫描后应用
+	Filter *filter.Filter `json:"-"`
+
+	// Limit 最多返回的流数量，0 表示不限制
+	Limit int `json:"limit,omitempty"`
+}
+
+// Open 打开或创建未加密的数据库文件
+func Open(path string) (*DB, error) {
+	return OpenEncrypted(path, nil)
+}
+
+// open 打开数据库文件并创建所有的桶
+func open(path string) (*DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open flow database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketFlows, bucketTime, bucketHost, bucketPath, bucketStatus, bucketTerms} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init flow database: %w", err)
+	}
+	return &DB{db: db}, nil
+}
+
+// Close 关闭数据库
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Add 保存流，签名与 flow.Store.OnAdd 的回调一致，错误只记录日志
+func (d *DB) Add(f *flow.Flow) {
+	if err := d.Put(f); err != nil {
+		log.Printf("Failed to store flow %s: %v", f.ID, err)
+	}
+}
+
+// Put 保存流，已存在的同ID流会被替换
+func (d *DB) Put(f *flow.Flow) error {
+	data, err := d.encode(f)
+	if err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		flows := tx.Bucket(bucketFlows)
+		if old := flows.Get([]byte(f.ID)); old != nil {
+			var prev flow.Flow
+			if err := d.decode([]byte(f.ID), old, &prev); err == nil {
+				if err := d.deleteIndexes(tx, &prev); err != nil {
+					return err
+				}
+			}
+		}
+		if err := flows.Put([]byte(f.ID), data); err != nil {
+			return err
+		}
+		value := timeKey(f)
+		for bucket, key := range d.indexKeys(f) {
+			if err := tx.Bucket([]byte(bucket)).Put(key, value); err != nil {
+				return err
+			}
+		}
+		terms := tx.Bucket(bucketTerms)
+		for _, key := range d.termKeys(f) {
+			if err := terms.Put(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get 根据ID读取流
+func (d *DB) Get(id string) (*flow.Flow, error) {
+	var f *flow.Flow
+	err := d.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketFlows).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		f = &flow.Flow{}
+		return d.decode([]byte(id), data, f)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Delete 删除流
+func (d *DB) Delete(id string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		flows := tx.Bucket(bucketFlows)
+		data := flows.Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		var f flow.Flow
+		if err := d.decode([]byte(id), data, &f); err != nil {
+			return err
+		}
+		if err := d.deleteIndexes(tx, &f); err != nil {
+			return err
+		}
+		return flows.Delete([]byte(id))
+	})
+}
+
+// Len 返回流数量
+func (d *DB) Len() int {
+	n := 0
+	_ = d.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(bucketFlows).Stats().KeyN
+		return nil
+	})
+	return n
+}
+
+// Query 使用最合适的索引查询流
+func (d *DB) Query(q Query) ([]*flow.Flow, error) {
+	var result []*flow.Flow
+	err := d.db.View(func(tx *bolt.Tx) error {
+		bucket, prefix, ordered := d.plan(q)
+		c := tx.Bucket(bucket).Cursor()
+
+		// 按时间排序的索引直接定位到时间下限
+		seek := prefix
+		if ordered && !q.Since.IsZero() {
+			seek = binary.BigEndian.AppendUint64(append([]byte(nil), prefix...), uint64(q.Since.UnixNano()))
+		}
+
+		flows := tx.Bucket(bucketFlows)
+		for k, v := c.Seek(seek); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			start, id := splitKey(v)
+			if !q.Since.IsZero() && start.Before(q.Since) {
+				continue
+			}
+			if !q.Until.IsZero() && !start.Before(q.Until) {
+				if ordered {
+					break
+				}
+				continue
+			}
+			data := flows.Get(id)
+			if data == nil {
+				continue
+			}
+			f := &flow.Flow{}
+			if err := d.decode(id, data, f); err != nil {
+				return fmt.Errorf("decode flow %s: %w", id, err)
+			}
+			if !q.match(f) {
+				continue
+			}
+			result = append(result, f)
+			if ordered && q.Limit > 0 && len(result) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[:q.Limit]
+	}
+	return result, nil
+}
+
+// plan 选择扫描的索引和键前缀，ordered 表示扫描结果已按时间排序。加密的数据库没有路径索引
+func (d *DB) plan(q Query) (bucket, prefix []byte, ordered bool) {
+	switch {
+	case q.Status != 0:
+		return bucketStatus, statusPrefix(q.Status), true
+	case q.Host != "":
+		return bucketHost, append(d.blind(strings.ToLower(q.Host)), 0), true
+	case q.PathPrefix != "" && d.cipher == nil:
+		return bucketPath, []byte(q.PathPrefix), false
+	default:
+		return bucketTime, nil, true
+	}
+}
+
+// match 检查流是否满足所有条件，用于索引扫描后的过滤
+func (q *Query) match(f *flow.Flow) bool {
+	host, path := hostPath(f)
+	if q.Host != "" && !strings.EqualFold(q.Host, host) {
+		return false
+	}
+	if q.PathPrefix != "" && !strings.HasPrefix(path, q.PathPrefix) {
+		return false
+	}
+	if q.Status != 0 && q.Status != status(f) {
+		return false
+	}
+	return q.Filter.Match(f)
+}
+
+// indexKeys 返回流在各索引中的键，每个键以 "<开始时间><ID>" 结尾以保证唯一和按时间排序，
+// 索引的值同样为 "<开始时间><ID>"
+func (d *DB) indexKeys(f *flow.Flow) map[string][]byte {
+	suffix := timeKey(f)
+	host, path := hostPath(f)
+	keys := map[string][]byte{
+		string(bucketTime):   suffix,
+		string(bucketHost):   concat(d.blind(host), []byte{0}, suffix),
+		string(bucketStatus): concat(statusPrefix(status(f)), suffix),
+	}
+	if d.cipher == nil {
+		keys[string(bucketPath)] = concat([]byte(path), []byte{0}, suffix)
+	}
+	return keys
+}
+
+func (d *DB) deleteIndexes(tx *bolt.Tx, f *flow.Flow) error {
+	for bucket, key := range d.indexKeys(f) {
+		if err := tx.Bucket([]byte(bucket)).Delete(key); err != nil {
+			return err
+		}
+	}
+	terms := tx.Bucket(bucketTerms)
+	for _, key := range d.termKeys(f) {
+		if err := terms.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeKey 生成 "<大端纳秒时间戳><ID>" 形式的键后缀
+func timeKey(f *flow.Flow) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(f.StartTime.UnixNano()))
+	return append(key, f.ID...)
+}
+
+// splitKey 解析索引值中的开始时间和ID
+func splitKey(v []byte) (time.Time, []byte) {
+	if len(v) < 8 {
+		return time.Time{}, v
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(v))), v[8:]
+}
+
+func statusPrefix(code int) []byte {
+	return binary.BigEndian.AppendUint16(nil, uint16(code))
+}
+
+// status 返回流的响应状态码，没有响应时为 -1
+func status(f *flow.Flow) int {
+	if f.Response == nil {
+		return -1
+	}
+	return f.Response.StatusCode
+}
+
+// hostPath 返回流的主机名（小写、不含端口）和路径
+func hostPath(f *flow.Flow) (host, path string) {
+	if f.Request == nil {
+		return "", ""
+	}
+	u, err := url.Parse(f.Request.URL)
+	if err != nil {
+		return "", ""
+	}
+	host = f.Request.Host
+	if host == "" {
+		host = u.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host), u.Path
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
@@ -0,0 +1,181 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flowdb
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/seal"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+var base = time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+
+func openDB(t *testing.T) (*DB, string) {
+	path := filepath.Join(t.TempDir(), "flows.db")
+	db, err := Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
+
+func newFlow(id string, minute int, rawURL string, status int) *flow.Flow {
+	f := &flow.Flow{
+		ID:        id,
+		StartTime: base.Add(time.Duration(minute) * time.Minute),
+		Request:   &flow.Request{Method: "GET", URL: rawURL},
+	}
+	if status > 0 {
+		f.Response = &flow.Response{StatusCode: status, Header: http.Header{}}
+	}
+	return f
+}
+
+func ids(flows []*flow.Flow) []string {
+	var out []string
+	for _, f := range flows {
+		out = append(out, f.ID)
+	}
+	return out
+}
+
+// --- 测试代码 ---
+func TestDB_Query(t *testing.T) {
+	db, _ := openDB(t)
+	for _, f := range []*flow.Flow{
+		newFlow("d", 3, "https://api.example.com/v1/users", 500),
+		newFlow("a", 0, "https://api.example.com/v1/users/1", 200),
+		newFlow("b", 1, "https://cdn.example.com/v1/logo.png", 200),
+		newFlow("c", 2, "http://API.example.com:8080/v2/items", 404),
+		newFlow("e", 4, "https://cdn.example.com/v1/users", 0),
+	} {
+		require.NoError(t, db.Put(f))
+	}
+	require.Equal(t, 5, db.Len())
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"all", Query{}, []string{"a", "b", "c", "d", "e"}},
+		{"limit", Query{Limit: 2}, []string{"a", "b"}},
+		{"host", Query{Host: "api.example.com"}, []string{"a", "c", "d"}},
+		{"host and status", Query{Host: "API.example.com", Status: 200}, []string{"a"}},
+		{"status", Query{Status: 200}, []string{"a", "b"}},
+		{"no response", Query{Status: -1}, []string{"e"}},
+		{"path prefix", Query{PathPrefix: "/v1/users"}, []string{"a", "d", "e"}},
+		{"path prefix limit", Query{PathPrefix: "/v1/", Limit: 3}, []string{"a", "b", "d"}},
+		{"time range", Query{Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)}, []string{"b", "c"}},
+		{"host and time", Query{Host: "cdn.example.com", Since: base.Add(2 * time.Minute)}, []string{"e"}},
+		{"filter", Query{Filter: filter.MustCompile(`status >= 400 || path == "/v1/users"`)}, []string{"c", "d", "e"}},
+		{"filter with index", Query{Host: "cdn.example.com", Filter: filter.MustCompile("status == 200")}, []string{"b"}},
+		{"no match", Query{Host: "other.example.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.Query(tt.query)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, ids(got))
+		})
+	}
+}
+
+func TestDB_PutReplaceAndDelete(t *testing.T) {
+	db, path := openDB(t)
+	f := newFlow("a", 0, "https://api.example.com/x", 200)
+	db.Add(f)
+
+	// 替换后旧索引不再命中
+	f.Response.StatusCode = 304
+	require.NoError(t, db.Put(f))
+	got, err := db.Query(Query{Status: 200})
+	require.NoError(t, err)
+	require.Empty(t, got)
+	got, err = db.Query(Query{Status: 304})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, ids(got))
+
+	// 重新打开后数据仍然存在
+	require.NoError(t, db.Close())
+	db, err = Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+	stored, err := db.Get("a")
+	require.NoError(t, err)
+	require.Equal(t, "https://api.example.com/x", stored.Request.URL)
+
+	require.NoError(t, db.Delete("a"))
+	require.ErrorIs(t, db.Delete("a"), ErrNotFound)
+	_, err = db.Get("a")
+	require.ErrorIs(t, err, ErrNotFound)
+	got, err = db.Query(Query{Host: "api.example.com"})
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+func TestDB_Encrypted(t *testing.T) {
+	passphrase := func(pw string) *seal.Keys {
+		p, err := seal.NewPassphrase(pw)
+		require.NoError(t, err)
+		p.WorkFactor = 10
+		return &seal.Keys{Recipients: []seal.Recipient{p}, Identities: []seal.Identity{p}}
+	}
+	path := filepath.Join(t.TempDir(), "flows.db")
+	db, err := OpenEncrypted(path, passphrase("pw"))
+	require.NoError(t, err)
+	require.True(t, db.Encrypted())
+	f := newFlow("a", 0, "https://secret-host.example.com/private/users", 200)
+	f.Response.Body = []byte("confidential payload")
+	db.Add(f)
+	db.Add(newFlow("b", 1, "https://other.example.com/", 404))
+
+	// 索引查询和全文搜索照常工作，路径前缀在时间索引上过滤
+	got, err := db.Query(Query{Host: "secret-host.example.com"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, ids(got))
+	got, err = db.Query(Query{PathPrefix: "/private"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, ids(got))
+	got, err = db.Search("confidential", Query{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, ids(got))
+	require.NoError(t, db.Close())
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	for _, s := range []string{"secret-host", "private", "confidential"} {
+		require.NotContains(t, string(raw), s)
+	}
+
+	// 重新打开需要正确的口令
+	_, err = Open(path)
+	require.ErrorContains(t, err, "encrypted")
+	_, err = OpenEncrypted(path, passphrase("wrong"))
+	require.Error(t, err)
+	db, err = OpenEncrypted(path, passphrase("pw"))
+	require.NoError(t, err)
+	stored, err := db.Get("a")
+	require.NoError(t, err)
+	require.Equal(t, "confidential payload", string(stored.Response.Body))
+	require.NoError(t, db.Delete("a"))
+	require.Equal(t, 1, db.Len())
+	require.NoError(t, db.Close())
+
+	// 已有未加密流的数据库不能启用加密
+	plain, plainPath := openDB(t)
+	plain.Add(newFlow("c", 0, "https://api.example.com/", 200))
+	require.NoError(t, plain.Close())
+	_, err = OpenEncrypted(plainPath, passphrase("pw"))
+	require.ErrorContains(t, err, "unencrypted")
+}
@@ -0,0 +1,197 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flowdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// maxIndexedBody 每个请求体或响应体参与索引的最大字节数
+	maxIndexedBody = 1 << 20
+
+	// minTermLen 和 maxTermLen 限制索引词的长度，过短的词命中过多，过长的词通常是编码数据
+	minTermLen = 2
+	maxTermLen = 64
+)
+
+// ErrEmptySearch 搜索文本中没有可用于查询的词
+var ErrEmptySearch = errors.New("search text has no indexable terms")
+
+var bucketTerms = []byte("by_term")
+
+// Search 搜索解码后的请求体或响应体中包含 text（大小写不敏感）的流，
+// q 的其他条件同样生效。先用词索引选出候选流，再逐一校验完整文本
+func (d *DB) Search(text string, q Query) ([]*flow.Flow, error) {
+	terms := tokenize([]byte(text))
+	if len(terms) == 0 {
+		return nil, ErrEmptySearch
+	}
+	needle := []byte(strings.ToLower(text))
+
+	var result []*flow.Flow
+	err := d.db.View(func(tx *bolt.Tx) error {
+		candidates, err := d.intersect(tx.Bucket(bucketTerms), terms)
+		if err != nil {
+			return err
+		}
+
+		flows := tx.Bucket(bucketFlows)
+		for _, v := range candidates {
+			start, id := splitKey(v)
+			if !q.Since.IsZero() && start.Before(q.Since) {
+				continue
+			}
+			if !q.Until.IsZero() && !start.Before(q.Until) {
+				continue
+			}
+			data := flows.Get(id)
+			if data == nil {
+				continue
+			}
+			f := &flow.Flow{}
+			if err := d.decode(id, data, f); err != nil {
+				return fmt.Errorf("decode flow %s: %w", id, err)
+			}
+			if !q.match(f) || !contains(f, needle) {
+				continue
+			}
+			result = append(result, f)
+			if q.Limit > 0 && len(result) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// intersect 返回包含所有词的流的 "<开始时间><ID>"，按时间排序
+func (d *DB) intersect(b *bolt.Bucket, terms []string) ([][]byte, error) {
+	var result map[string]bool
+	for _, term := range terms {
+		prefix := append(d.blind(term), 0)
+		matched := make(map[string]bool)
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if result == nil || result[string(v)] {
+				matched[string(v)] = true
+			}
+		}
+		result = matched
+		if len(result) == 0 {
+			return nil, nil
+		}
+	}
+
+	keys := make([][]byte, 0, len(result))
+	for k := range result {
+		keys = append(keys, []byte(k))
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys, nil
+}
+
+// termKeys 返回流的全文索引键 "<词>\x00<开始时间><ID>"，加密的数据库中词为HMAC
+func (d *DB) termKeys(f *flow.Flow) [][]byte {
+	suffix := timeKey(f)
+	seen := make(map[string]bool)
+	var keys [][]byte
+	for _, body := range bodies(f) {
+		for _, term := range tokenize(body) {
+			if seen[term] {
+				continue
+			}
+			seen[term] = true
+			keys = append(keys, concat(d.blind(term), []byte{0}, suffix))
+		}
+	}
+	return keys
+}
+
+// bodies 返回流中解码后的文本内容，二进制内容不参与索引
+func bodies(f *flow.Flow) [][]byte {
+	var out [][]byte
+	add := func(header http.Header, body []byte) {
+		if len(body) == 0 {
+			return
+		}
+		if decoded, _, err := flow.DecodeBody(header, body); err == nil {
+			body = decoded
+		}
+		if len(body) > maxIndexedBody {
+			body = body[:maxIndexedBody]
+		}
+		if !isText(body) {
+			return
+		}
+		out = append(out, body)
+	}
+	if f.Request != nil {
+		add(f.Request.Header, f.Request.Body)
+	}
+	if f.Response != nil {
+		add(f.Response.Header, f.Response.Body)
+	}
+	return out
+}
+
+// isText 根据开头的内容判断是否为文本，包含NUL或无效UTF-8的内容视为二进制
+func isText(body []byte) bool {
+	sample := body[:min(len(body), 512)]
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return false
+	}
+	// 采样可能切开末尾的多字节字符
+	if len(sample) < len(body) {
+		for i := 0; i < utf8.UTFMax-1 && !utf8.Valid(sample); i++ {
+			sample = sample[:len(sample)-1]
+		}
+	}
+	return utf8.Valid(sample)
+}
+
+// contains 判断解码后的内容中是否包含小写的 needle
+func contains(f *flow.Flow, needle []byte) bool {
+	for _, body := range bodies(f) {
+		if bytes.Contains(bytes.ToLower(body), needle) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize 将文本拆分为小写的字母数字词，去重并保持出现顺序
+func tokenize(text []byte) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, field := range bytes.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if n := utf8.RuneCount(field); n < minTermLen || n > maxTermLen {
+			continue
+		}
+		term := strings.ToLower(string(field))
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package flowdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func withBodies(f *flow.Flow, reqBody, respBody string) *flow.Flow {
+	f.Request.Body = []byte(reqBody)
+	if f.Response != nil {
+		f.Response.Body = []byte(respBody)
+	}
+	return f
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// --- 测试代码 ---
+func TestDB_Search(t *testing.T) {
+	db, _ := openDB(t)
+	const uuid = "123e4567-e89b-12d3-a456-426614174000"
+
+	compressed := newFlow("c", 2, "https://api.example.com/c", 200)
+	compressed.Response.Header.Set("Content-Encoding", "gzip")
+	compressed.Response.Body = gzipped(t, `{"id": "`+uuid+`"}`)
+
+	binary := newFlow("d", 3, "https://cdn.example.com/d", 200)
+	binary.Response.Body = append([]byte{0x89, 'P', 'N', 'G', 0}, uuid...)
+
+	for _, f := range []*flow.Flow{
+		withBodies(newFlow("a", 0, "https://api.example.com/a", 200), `{"user": "`+uuid+`"}`, "ok"),
+		withBodies(newFlow("b", 1, "https://api.example.com/b", 500), "", "Upstream Timeout while calling users"),
+		compressed,
+		binary,
+		// 包含UUID的所有词但顺序不同，校验阶段会排除
+		withBodies(newFlow("e", 4, "https://api.example.com/e", 200), "", "426614174000 a456 12d3 e89b 123e4567"),
+	} {
+		require.NoError(t, db.Put(f))
+	}
+
+	tests := []struct {
+		name  string
+		text  string
+		query Query
+		want  []string
+	}{
+		{"uuid", uuid, Query{}, []string{"a", "c"}},
+		{"uuid with limit", uuid, Query{Limit: 1}, []string{"a"}},
+		{"case insensitive", "upstream timeout", Query{}, []string{"b"}},
+		{"with filter", uuid, Query{Status: 200, Host: "api.example.com", PathPrefix: "/c"}, []string{"c"}},
+		{"no match", "nothing here", Query{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.Search(tt.text, tt.query)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, ids(got))
+		})
+	}
+
+	_, err := db.Search("- !", Query{})
+	require.ErrorIs(t, err, ErrEmptySearch)
+
+	// 删除后不再命中
+	require.NoError(t, db.Delete("a"))
+	got, err := db.Search(uuid, Query{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, ids(got))
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello, hello WORLD", []string{"hello", "world"}},
+		{"a b=1&id=42", []string{"id", "42"}},
+		{"用户 名称", []string{"用户", "名称"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, tokenize([]byte(tt.text)), tt.text)
+	}
+}
+
+func TestIsText(t *testing.T) {
+	require.True(t, isText([]byte("plain text")))
+	require.False(t, isText([]byte{'a', 0, 'b'}))
+	require.False(t, isText([]byte{0xff, 0xfe, 'a'}))
+
+	// 采样截断在多字节字符中间时仍视为文本
+	long := append(bytes.Repeat([]byte("a"), 511), []byte("中文")...)
+	require.True(t, isText(long))
+}
@@ -0,0 +1,283 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Attach 识别流中的GraphQL请求并保存到 Flow.GraphQL
+func Attach(f *flow.Flow) {
+	if f.GraphQL == nil {
+		f.GraphQL = Detect(f.Request)
+	}
+}
+
+// Detect 从请求中提取GraphQL操作，支持：
+//   - POST application/json，单个操作或批量数组
+//   - POST application/graphql，请求体为查询文档
+//   - GET 请求的 query、operationName、variables、extensions 参数
+//
+// 不是GraphQL请求时返回nil
+func Detect(r *flow.Request) []*flow.GraphQLOperation {
+	if r == nil {
+		return nil
+	}
+	if r.Method == http.MethodGet {
+		return detectQuery(r.URL)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	body := r.Body
+	if decoded, _, err := flow.DecodeBody(r.Header, body); err == nil {
+		body = decoded
+	}
+	switch {
+	case mediaType == "application/graphql":
+		return fromDocument(string(body))
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return detectJSON(body)
+	}
+	return nil
+}
+
+// request GraphQL over HTTP 的请求对象
+type request struct {
+	Query         *string        `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	Extensions    struct {
+		PersistedQuery struct {
+			Hash string `json:"sha256Hash"`
+		} `json:"persistedQuery"`
+	} `json:"extensions"`
+}
+
+// operation 转换请求对象，既没有查询也没有持久化哈希时返回nil。
+// 查询中没有选择集的请求（例如普通搜索接口的 {"query": "foo"}）不视为GraphQL
+func (req *request) operation() *flow.GraphQLOperation {
+	hash := req.Extensions.PersistedQuery.Hash
+	if hash == "" && (req.Query == nil || !strings.Contains(*req.Query, "{")) {
+		return nil
+	}
+	op := &flow.GraphQLOperation{
+		Name:          req.OperationName,
+		Variables:     req.Variables,
+		PersistedHash: hash,
+	}
+	if req.Query != nil {
+		op.Query = *req.Query
+		op.Type, op.Name = operationInfo(op.Query, op.Name)
+	}
+	return op
+}
+
+func detectJSON(body []byte) []*flow.GraphQLOperation {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil
+	}
+	var reqs []*request
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			return nil
+		}
+	} else {
+		req := &request{}
+		if err := json.Unmarshal(body, req); err != nil {
+			return nil
+		}
+		reqs = []*request{req}
+	}
+
+	var ops []*flow.GraphQLOperation
+	for _, req := range reqs {
+		if req == nil {
+			return nil
+		}
+		op := req.operation()
+		if op == nil {
+			return nil
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+func detectQuery(rawURL string) []*flow.GraphQLOperation {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	q := u.Query()
+	req := &request{OperationName: q.Get("operationName")}
+	if q.Has("query") {
+		query := q.Get("query")
+		req.Query = &query
+	}
+	if v := q.Get("variables"); v != "" {
+		_ = json.Unmarshal([]byte(v), &req.Variables)
+	}
+	if ext := q.Get("extensions"); ext != "" {
+		_ = json.Unmarshal([]byte(ext), &req.Extensions)
+	}
+	if op := req.operation(); op != nil {
+		return []*flow.GraphQLOperation{op}
+	}
+	return nil
+}
+
+func fromDocument(query string) []*flow.GraphQLOperation {
+	req := &request{Query: &query}
+	if op := req.operation(); op != nil {
+		return []*flow.GraphQLOperation{op}
+	}
+	return nil
+}
+
+// operationInfo 在查询文档中找到要执行的操作，返回其类型和名称。
+// name 为空且文档只有一个操作时使用该操作的名称；简写形式 "{ ... }" 为匿名query
+func operationInfo(doc, name string) (opType, opName string) {
+	type definition struct{ typ, name string }
+	var defs []definition
+
+	l := &lexer{src: doc}
+	depth := 0
+	for tok := l.next(); tok != ""; tok = l.next() {
+		switch tok {
+		case "{":
+			// 操作和片段的左括号已在下面消耗，顶层出现的左括号是简写查询
+			if depth == 0 {
+				defs = append(defs, definition{typ: "query"})
+			}
+			depth++
+		case "}":
+			depth--
+		case "query", "mutation", "subscription":
+			if depth != 0 {
+				continue
+			}
+			def := definition{typ: tok}
+			if next := l.peek(); next != "" && isName(next) {
+				def.name = l.next()
+			}
+			defs = append(defs, def)
+			// 跳过变量定义和指令，直到选择集开始
+			for t := l.peek(); t != "" && t != "{"; t = l.peek() {
+				l.next()
+			}
+			if l.peek() == "{" {
+				l.next()
+				depth++
+			}
+		case "fragment":
+			if depth == 0 {
+				defs = append(defs, definition{typ: "fragment"})
+				for t := l.peek(); t != "" && t != "{"; t = l.peek() {
+					l.next()
+				}
+				if l.peek() == "{" {
+					l.next()
+					depth++
+				}
+			}
+		}
+	}
+
+	var ops []definition
+	for _, d := range defs {
+		if d.typ != "fragment" {
+			ops = append(ops, d)
+		}
+	}
+	for _, op := range ops {
+		if name != "" && op.name == name {
+			return op.typ, name
+		}
+	}
+	if name == "" && len(ops) == 1 {
+		return ops[0].typ, ops[0].name
+	}
+	return "", name
+}
+
+// lexer 只识别GraphQL中与定位操作有关的词法单元：名称和标点，跳过字符串和注释
+type lexer struct {
+	src    string
+	pos    int
+	peeked string
+	ok     bool
+}
+
+func (l *lexer) peek() string {
+	if !l.ok {
+		l.peeked, l.ok = l.scan(), true
+	}
+	return l.peeked
+}
+
+func (l *lexer) next() string {
+	t := l.peek()
+	l.ok = false
+	return t
+}
+
+func (l *lexer) scan() string {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], `"""`):
+			end := strings.Index(l.src[l.pos+3:], `"""`)
+			if end < 0 {
+				l.pos = len(l.src)
+			} else {
+				l.pos += end + 6
+			}
+			return `""`
+		case c == '"':
+			l.pos++
+			for l.pos < len(l.src) && l.src[l.pos] != '"' && l.src[l.pos] != '\n' {
+				if l.src[l.pos] == '\\' {
+					l.pos++
+				}
+				l.pos++
+			}
+			l.pos++
+			return `""`
+		case isNameByte(c):
+			start := l.pos
+			for l.pos < len(l.src) && (isNameByte(l.src[l.pos]) || (l.src[l.pos] >= '0' && l.src[l.pos] <= '9')) {
+				l.pos++
+			}
+			return l.src[start:l.pos]
+		default:
+			l.pos++
+			return string(c)
+		}
+	}
+	return ""
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isName(s string) bool {
+	return s != "" && isNameByte(s[0])
+}
@@ -0,0 +1,99 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package graphql
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func post(contentType, body string) *flow.Request {
+	return &flow.Request{
+		Method: http.MethodPost,
+		URL:    "https://api.example.com/graphql",
+		Header: http.Header{"Content-Type": {contentType}},
+		Body:   []byte(body),
+	}
+}
+
+// --- 测试代码 ---
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *flow.Request
+		want []*flow.GraphQLOperation
+	}{
+		{
+			name: "named query",
+			req:  post("application/json", `{"query": "query GetUser($id: ID!) { user(id: $id) { name } }", "variables": {"id": "1"}}`),
+			want: []*flow.GraphQLOperation{{
+				Name:      "GetUser",
+				Type:      "query",
+				Query:     "query GetUser($id: ID!) { user(id: $id) { name } }",
+				Variables: map[string]any{"id": "1"},
+			}},
+		},
+		{
+			name: "operation name selects from document",
+			req: post("application/json; charset=utf-8", `{"operationName": "Save",
+				"query": "# comment with mutation\nquery Load { a } mutation Save @live { save(s: \"{ query }\") { id } } fragment F on T { f }"}`),
+			want: []*flow.GraphQLOperation{{
+				Name:  "Save",
+				Type:  "mutation",
+				Query: "# comment with mutation\nquery Load { a } mutation Save @live { save(s: \"{ query }\") { id } } fragment F on T { f }",
+			}},
+		},
+		{
+			name: "shorthand",
+			req:  post("application/graphql", `{ viewer { login } }`),
+			want: []*flow.GraphQLOperation{{Type: "query", Query: `{ viewer { login } }`}},
+		},
+		{
+			name: "batch",
+			req:  post("application/json", `[{"query": "subscription OnEvent { e }"}, {"query": "{ a }", "operationName": "X"}]`),
+			want: []*flow.GraphQLOperation{
+				{Name: "OnEvent", Type: "subscription", Query: "subscription OnEvent { e }"},
+				{Name: "X", Query: "{ a }"},
+			},
+		},
+		{
+			name: "persisted query",
+			req: &flow.Request{
+				Method: http.MethodGet,
+				URL:    `https://api.example.com/graphql?operationName=Feed&variables=%7B%22n%22%3A10%7D&extensions=%7B%22persistedQuery%22%3A%7B%22version%22%3A1%2C%22sha256Hash%22%3A%22abc%22%7D%7D`,
+			},
+			want: []*flow.GraphQLOperation{{Name: "Feed", Variables: map[string]any{"n": float64(10)}, PersistedHash: "abc"}},
+		},
+		{
+			name: "get query",
+			req:  &flow.Request{Method: http.MethodGet, URL: "https://api.example.com/graphql?query=%7Bme%7Bid%7D%7D"},
+			want: []*flow.GraphQLOperation{{Type: "query", Query: "{me{id}}"}},
+		},
+		{name: "search api", req: post("application/json", `{"query": "shoes"}`)},
+		{name: "other json", req: post("application/json", `{"id": 1}`)},
+		{name: "invalid json", req: post("application/json", `{"query": `)},
+		{name: "form", req: post("application/x-www-form-urlencoded", `query={a}`)},
+		{name: "plain get", req: &flow.Request{Method: http.MethodGet, URL: "https://example.com/"}},
+		{name: "nil", req: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, Detect(tt.req))
+		})
+	}
+}
+
+func TestAttach(t *testing.T) {
+	f := flow.New()
+	f.Request = post("application/json", `{"query": "mutation Login { login }"}`)
+	Attach(f)
+	require.Len(t, f.GraphQL, 1)
+	require.Equal(t, "Login", f.GraphQL[0].Name)
+}
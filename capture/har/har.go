@@ -0,0 +1,448 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Version 导出的HAR格式版本
+const Version = "1.2"
+
+// HAR HTTP Archive 文件的根对象
+type HAR struct {
+	Log *Log `json:"log"`
+}
+
+// Log HAR日志
+type Log struct {
+	Version string   `json:"version"`
+	Creator *Creator `json:"creator"`
+	Entries []*Entry `json:"entries"`
+	Comment string   `json:"comment,omitempty"`
+}
+
+// Creator 生成HAR的应用
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry 一次请求/响应
+type Entry struct {
+	StartedDateTime string    `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         *Request  `json:"request"`
+	Response        *Response `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         *Timings  `json:"timings"`
+	ServerIPAddress string    `json:"serverIPAddress,omitempty"`
+	Connection      string    `json:"connection,omitempty"`
+	Comment         string    `json:"comment,omitempty"`
+
+	// Violations 流不符合 OpenAPI 规范的问题，HAR 没有对应字段，使用自定义字段保存
+	Violations []*flow.Violation `json:"_violations,omitempty"`
+
+	// Credentials 流中检测到的凭据，只包含指纹和说明
+	Credentials []*flow.Credential `json:"_credentials,omitempty"`
+
+	// TraceID、CorrelationID 请求的W3C追踪ID和关联ID
+	TraceID       string `json:"_trace_id,omitempty"`
+	CorrelationID string `json:"_correlation_id,omitempty"`
+
+	// Tags、Note、Starred 和 Marker 为流添加的标签、备注、星标和标记，同样使用自定义字段保存
+	Tags    []string `json:"_tags,omitempty"`
+	Note    string   `json:"_note,omitempty"`
+	Starred bool     `json:"_starred,omitempty"`
+	Marker  string   `json:"_marker,omitempty"`
+}
+
+// Request HAR请求
+type Request struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []*Cookie    `json:"cookies"`
+	Headers     []*NameValue `json:"headers"`
+	QueryString []*NameValue `json:"queryString"`
+	PostData    *PostData    `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+// Response HAR响应
+type Response struct {
+	Status      int          `json:"status"`
+	StatusText  string       `json:"statusText"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []*Cookie    `json:"cookies"`
+	Headers     []*NameValue `json:"headers"`
+	Content     *Content     `json:"content"`
+	RedirectURL string       `json:"redirectURL"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+	Comment     string       `json:"comment,omitempty"`
+}
+
+// NameValue 头部或查询参数
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Cookie HAR Cookie
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// PostData 请求体
+type PostData struct {
+	MimeType string       `json:"mimeType"`
+	Params   []*NameValue `json:"params,omitempty"`
+	Text     string       `json:"text"`
+}
+
+// Content 响应体，非UTF-8内容使用base64编码
+type Content struct {
+	Size        int    `json:"size"`
+	Compression int    `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+}
+
+// Timings 各阶段耗时（毫秒），-1 表示不可用，connect 包含 ssl
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+
+	// ClientSSL 解密时代理与客户端TLS握手的耗时，发生在请求开始之前，不计入 time
+	ClientSSL float64 `json:"_client_ssl,omitempty"`
+}
+
+// Build 将流转换为HAR，非HTTP流（例如未解密的TCP隧道）会被跳过
+func Build(flows []*flow.Flow) *HAR {
+	log := &Log{
+		Version: Version,
+		Creator: &Creator{Name: "sniffy", Version: "dev"},
+		Entries: make([]*Entry, 0, len(flows)),
+	}
+	for _, f := range flows {
+		if e := NewEntry(f); e != nil {
+			log.Entries = append(log.Entries, e)
+		}
+	}
+	sort.SliceStable(log.Entries, func(i, j int) bool {
+		return log.Entries[i].StartedDateTime < log.Entries[j].StartedDateTime
+	})
+	return &HAR{Log: log}
+}
+
+// Write 将流以HAR格式写入 w
+func Write(w io.Writer, flows []*flow.Flow) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(Build(flows)); err != nil {
+		return fmt.Errorf("encode har: %w", err)
+	}
+	return nil
+}
+
+// WriteFile 将流以HAR格式写入文件
+func WriteFile(path string, flows []*flow.Flow) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create har file: %w", err)
+	}
+	if err := Write(file, flows); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// NewEntry 将单个流转换为HAR条目，不是HTTP请求时返回nil
+func NewEntry(f *flow.Flow) *Entry {
+	if f == nil || f.Request == nil {
+		return nil
+	}
+	u, err := url.Parse(f.Request.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+
+	total := -1.0
+	if d := f.Duration(); d > 0 {
+		total = millis(d)
+	}
+	e := &Entry{
+		// 毫秒精度、UTC的 ISO 8601 时间，便于按字符串排序
+		StartedDateTime: f.StartTime.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		Time:            max(total, 0),
+		Request:         newRequest(f.Request, u),
+		Response:        newResponse(f),
+		Timings:         newTimings(f, total),
+		Connection:      f.ClientAddr,
+		Comment:         comment(f),
+		Violations:      f.Violations,
+		Credentials:     f.Credentials,
+		TraceID:         f.TraceID,
+		CorrelationID:   f.CorrelationID,
+		Tags:            f.Tags,
+		Note:            f.Comment,
+		Starred:         f.Starred,
+		Marker:          f.Marker,
+	}
+	if host, _, err := net.SplitHostPort(f.ServerAddr); err == nil {
+		e.ServerIPAddress = host
+	}
+	return e
+}
+
+// newRequest 转换请求
+func newRequest(r *flow.Request, u *url.URL) *Request {
+	req := &Request{
+		Method:      r.Method,
+		URL:         u.String(),
+		HTTPVersion: httpVersion(r.Proto),
+		Cookies:     []*Cookie{},
+		Headers:     headers(r.Header),
+		QueryString: []*NameValue{},
+		HeadersSize: -1,
+		BodySize:    len(r.Body),
+	}
+	for _, c := range (&http.Request{Header: r.Header}).Cookies() {
+		req.Cookies = append(req.Cookies, &Cookie{Name: c.Name, Value: c.Value})
+	}
+	for _, kv := range strings.Split(u.RawQuery, "&") {
+		if kv == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(kv, "=")
+		name, _ = url.QueryUnescape(name)
+		value, _ = url.QueryUnescape(value)
+		req.QueryString = append(req.QueryString, &NameValue{Name: name, Value: value})
+	}
+
+	if len(r.Body) > 0 {
+		body := r.Body
+		if decoded, _, err := flow.DecodeBody(r.Header, r.Body); err == nil {
+			body = decoded
+		}
+		req.PostData = &PostData{
+			MimeType: r.Header.Get("Content-Type"),
+			Text:     string(body),
+		}
+		if mediaType, _, _ := mime.ParseMediaType(req.PostData.MimeType); mediaType == "application/x-www-form-urlencoded" {
+			if values, err := url.ParseQuery(string(body)); err == nil {
+				for _, name := range sortedKeys(values) {
+					for _, v := range values[name] {
+						req.PostData.Params = append(req.PostData.Params, &NameValue{Name: name, Value: v})
+					}
+				}
+			}
+		}
+	}
+	return req
+}
+
+// newResponse 转换响应，请求失败时生成状态码为0的响应并在注释中记录错误
+func newResponse(f *flow.Flow) *Response {
+	r := f.Response
+	if r == nil {
+		return &Response{
+			Cookies:     []*Cookie{},
+			Headers:     []*NameValue{},
+			Content:     &Content{MimeType: "x-unknown"},
+			HeadersSize: -1,
+			BodySize:    -1,
+			Comment:     f.Error,
+		}
+	}
+
+	resp := &Response{
+		Status:      r.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(r.Status, fmt.Sprint(r.StatusCode))),
+		HTTPVersion: httpVersion(r.Proto),
+		Cookies:     []*Cookie{},
+		Headers:     headers(r.Header),
+		RedirectURL: r.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(r.Body),
+	}
+	if resp.StatusText == "" {
+		resp.StatusText = http.StatusText(r.StatusCode)
+	}
+	for _, c := range (&http.Response{Header: r.Header}).Cookies() {
+		cookie := &Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			cookie.Expires = c.Expires.UTC().Format(time.RFC3339)
+		}
+		resp.Cookies = append(resp.Cookies, cookie)
+	}
+
+	// content 记录解码后的内容，compression 为压缩节省的字节数
+	body := r.Body
+	decoded, encoded, err := flow.DecodeBody(r.Header, r.Body)
+	if err == nil {
+		body = decoded
+	}
+	resp.Content = &Content{
+		Size:     len(body),
+		MimeType: r.Header.Get("Content-Type"),
+	}
+	if encoded {
+		resp.Content.Compression = len(body) - len(r.Body)
+	}
+	if resp.Content.MimeType == "" {
+		resp.Content.MimeType = "x-unknown"
+	}
+	if utf8.Valid(body) {
+		resp.Content.Text = string(body)
+	} else {
+		resp.Content.Text = base64.StdEncoding.EncodeToString(body)
+		resp.Content.Encoding = "base64"
+	}
+	return resp
+}
+
+// headers 按名称排序转换头部
+func headers(h http.Header) []*NameValue {
+	list := make([]*NameValue, 0, len(h))
+	for _, name := range sortedKeys(h) {
+		for _, v := range h[name] {
+			list = append(list, &NameValue{Name: name, Value: v})
+		}
+	}
+	return list
+}
+
+// httpVersion 规范化协议版本，缺失时默认为 HTTP/1.1
+func httpVersion(proto string) string {
+	if proto == "" {
+		return "HTTP/1.1"
+	}
+	return proto
+}
+
+// comment 记录HAR中没有对应字段的流信息
+func comment(f *flow.Flow) string {
+	var parts []string
+	if f.Comment != "" {
+		parts = append(parts, f.Comment)
+	}
+	if f.ReplayOf != "" {
+		parts = append(parts, "replay of "+f.ReplayOf)
+	}
+	if f.Responder != "" {
+		parts = append(parts, "response from "+f.Responder)
+	}
+	if f.Error != "" && f.Response != nil {
+		parts = append(parts, "error: "+f.Error)
+	}
+	if n := len(f.Violations); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d openapi violations", n))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// newTimings 由流的时间点计算各阶段耗时。blocked 为请求开始到拨号的时间，包括读取请求体和执行钩子，
+// 复用连接时请求开始到写完请求都计入 send。缺少上游的时间点时全部计入 wait
+func newTimings(f *flow.Flow, total float64) *Timings {
+	t := &Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: max(total, 0)}
+	ft := f.Timings
+	if ft == nil {
+		return t
+	}
+	if !ft.ClientTLSDone.IsZero() {
+		t.ClientSSL = between(ft.ClientTLSStart, ft.ClientTLSDone)
+	}
+	if ft.RequestSent.IsZero() || ft.FirstByte.IsZero() {
+		return t
+	}
+	// ready 可以开始发送请求的时间
+	ready := f.StartTime
+	var dial time.Time
+	if !ft.DNSDone.IsZero() {
+		t.DNS = between(ft.DNSStart, ft.DNSDone)
+		dial, ready = ft.DNSStart, ft.DNSDone
+	}
+	if !ft.ConnectDone.IsZero() {
+		end := ft.ConnectDone
+		if !ft.TLSDone.IsZero() {
+			t.SSL = between(ft.TLSStart, ft.TLSDone)
+			end = ft.TLSDone
+		}
+		t.Connect = between(ft.ConnectStart, end)
+		if dial.IsZero() {
+			dial = ft.ConnectStart
+		}
+		ready = end
+	}
+	if !dial.IsZero() {
+		t.Blocked = between(f.StartTime, dial)
+	}
+	t.Send = between(ready, ft.RequestSent)
+	t.Wait = between(ft.RequestSent, ft.FirstByte)
+	t.Receive = 0
+	if !ft.ResponseDone.IsZero() {
+		t.Receive = between(ft.FirstByte, ft.ResponseDone)
+	}
+	return t
+}
+
+// between 返回两个时间点之间的毫秒数，时间点缺失或顺序颠倒时为0
+func between(start, end time.Time) float64 {
+	if start.IsZero() || end.Before(start) {
+		return 0
+	}
+	return millis(end.Sub(start))
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,199 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package har
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func capturedFlow(t *testing.T) *flow.Flow {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 6_000_000, time.UTC)
+	return &flow.Flow{
+		ID:         "abc",
+		StartTime:  start,
+		EndTime:    start.Add(1500 * time.Microsecond),
+		ClientAddr: "127.0.0.1:50000",
+		ServerAddr: "93.184.216.34:443",
+		Request: &flow.Request{
+			Method: "POST",
+			URL:    "https://example.com/login?next=%2Fhome&x=1",
+			Proto:  "HTTP/2.0",
+			Header: http.Header{
+				"Content-Type": {"application/x-www-form-urlencoded"},
+				"Cookie":       {"sid=1; theme=dark"},
+			},
+			Body: []byte("user=bob&pass=x"),
+		},
+		Response: &flow.Response{
+			StatusCode: http.StatusFound,
+			Status:     "302 Found",
+			Proto:      "HTTP/2.0",
+			Header: http.Header{
+				"Content-Encoding": {"gzip"},
+				"Content-Type":     {"text/html"},
+				"Location":         {"/home"},
+				"Set-Cookie":       {"sid=2; Path=/; HttpOnly; Secure"},
+			},
+			Body: gzipped(t, "<p>moved</p>"),
+		},
+	}
+}
+
+// --- 测试代码 ---
+func TestNewEntry(t *testing.T) {
+	e := NewEntry(capturedFlow(t))
+	require.NotNil(t, e)
+	require.Equal(t, "2025-01-02T03:04:05.006Z", e.StartedDateTime)
+	require.Equal(t, 1.5, e.Time)
+	require.Equal(t, "93.184.216.34", e.ServerIPAddress)
+	require.Equal(t, &Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: 1.5}, e.Timings)
+
+	req := e.Request
+	require.Equal(t, "HTTP/2.0", req.HTTPVersion)
+	require.Equal(t, []*NameValue{{"next", "/home"}, {"x", "1"}}, req.QueryString)
+	require.Len(t, req.Cookies, 2)
+	require.Equal(t, "theme", req.Cookies[1].Name)
+	require.Equal(t, "user=bob&pass=x", req.PostData.Text)
+	require.Equal(t, []*NameValue{{"pass", "x"}, {"user", "bob"}}, req.PostData.Params)
+
+	resp := e.Response
+	require.Equal(t, 302, resp.Status)
+	require.Equal(t, "Found", resp.StatusText)
+	require.Equal(t, "/home", resp.RedirectURL)
+	require.Equal(t, "<p>moved</p>", resp.Content.Text)
+	require.Equal(t, len("<p>moved</p>"), resp.Content.Size)
+	require.Equal(t, resp.Content.Size-resp.BodySize, resp.Content.Compression)
+	require.Len(t, resp.Cookies, 1)
+	require.True(t, resp.Cookies[0].HTTPOnly)
+	require.True(t, resp.Cookies[0].Secure)
+}
+
+func TestNewEntry_Variants(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(f *flow.Flow)
+		check func(t *testing.T, e *Entry)
+	}{
+		{
+			name:  "tcp tunnel skipped",
+			setup: func(f *flow.Flow) { f.Request.URL = "tcp://example.com:443" },
+			check: func(t *testing.T, e *Entry) { require.Nil(t, e) },
+		},
+		{
+			name: "binary body base64",
+			setup: func(f *flow.Flow) {
+				f.Response.Header = http.Header{"Content-Type": {"image/png"}}
+				f.Response.Body = []byte{0x89, 'P', 'N', 'G', 0xff}
+			},
+			check: func(t *testing.T, e *Entry) {
+				require.Equal(t, "base64", e.Response.Content.Encoding)
+				require.Equal(t, "iVBOR/8=", e.Response.Content.Text)
+			},
+		},
+		{
+			name: "failed request",
+			setup: func(f *flow.Flow) {
+				f.Response = nil
+				f.Error = "dial upstream: connection refused"
+			},
+			check: func(t *testing.T, e *Entry) {
+				require.Equal(t, 0, e.Response.Status)
+				require.Equal(t, "dial upstream: connection refused", e.Response.Comment)
+			},
+		},
+		{
+			name: "local response",
+			setup: func(f *flow.Flow) {
+				f.Responder = "map-local /tmp"
+				f.ReplayOf = "xyz"
+			},
+			check: func(t *testing.T, e *Entry) {
+				require.Equal(t, "replay of xyz; response from map-local /tmp", e.Comment)
+			},
+		},
+		{
+			name: "timings",
+			setup: func(f *flow.Flow) {
+				ms := func(n int) time.Time { return f.StartTime.Add(time.Duration(n) * time.Millisecond) }
+				f.EndTime = ms(60)
+				f.Timings = &flow.Timings{
+					ClientTLSStart: ms(-8), ClientTLSDone: ms(-3),
+					DNSStart: ms(2), DNSDone: ms(5),
+					ConnectStart: ms(5), ConnectDone: ms(15),
+					TLSStart: ms(15), TLSDone: ms(35),
+					RequestSent: ms(36), FirstByte: ms(50), ResponseDone: ms(58),
+				}
+			},
+			check: func(t *testing.T, e *Entry) {
+				require.Equal(t, &Timings{Blocked: 2, DNS: 3, Connect: 30, SSL: 20, Send: 1, Wait: 14, Receive: 8, ClientSSL: 5}, e.Timings)
+			},
+		},
+		{
+			name: "reused connection",
+			setup: func(f *flow.Flow) {
+				f.Timings = &flow.Timings{RequestSent: f.StartTime.Add(time.Millisecond), FirstByte: f.StartTime.Add(4 * time.Millisecond)}
+			},
+			check: func(t *testing.T, e *Entry) {
+				require.Equal(t, &Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Send: 1, Wait: 3}, e.Timings)
+			},
+		},
+		{
+			name: "openapi violations",
+			setup: func(f *flow.Flow) {
+				f.Violations = []*flow.Violation{{Kind: "undocumented-status", Location: "response.status", Message: "status 302 is not documented"}}
+			},
+			check: func(t *testing.T, e *Entry) {
+				require.Equal(t, "1 openapi violations", e.Comment)
+				require.Len(t, e.Violations, 1)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := capturedFlow(t)
+			tt.setup(f)
+			tt.check(t, NewEntry(f))
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	later := capturedFlow(t)
+	later.StartTime = later.StartTime.Add(time.Second)
+	tunnel := capturedFlow(t)
+	tunnel.Request.URL = "tcp://example.com:443"
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, []*flow.Flow{later, tunnel, capturedFlow(t)}))
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	log := doc["log"].(map[string]any)
+	require.Equal(t, "1.2", log["version"])
+	entries := log["entries"].([]any)
+	require.Len(t, entries, 2)
+	require.Equal(t, "2025-01-02T03:04:05.006Z", entries[0].(map[string]any)["startedDateTime"])
+	require.Contains(t, entries[0].(map[string]any), "cache")
+}
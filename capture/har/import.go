@@ -0,0 +1,213 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// hopHeaders 导入时丢弃的头部，内容已解码或由传输层重新生成。
+// HTTP/2 伪头部（:authority 等）同样被丢弃
+var hopHeaders = map[string]bool{
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Keep-Alive":        true,
+}
+
+// Load 读取HAR文件并转换为流
+func Load(path string) ([]*flow.Flow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open har file: %w", err)
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// Read 解析HAR并将每个条目转换为流，响应体以解码后的形式保存
+func Read(r io.Reader) ([]*flow.Flow, error) {
+	var doc HAR
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode har: %w", err)
+	}
+	if doc.Log == nil {
+		return nil, fmt.Errorf("decode har: missing log")
+	}
+
+	flows := make([]*flow.Flow, 0, len(doc.Log.Entries))
+	for i, e := range doc.Log.Entries {
+		f, err := e.Flow()
+		if err != nil {
+			return nil, fmt.Errorf("har entry %d: %w", i, err)
+		}
+		flows = append(flows, f)
+	}
+	return flows, nil
+}
+
+// Flow 将HAR条目转换为流，状态码为0的响应（请求失败）转换为 Error
+func (e *Entry) Flow() (*flow.Flow, error) {
+	if e.Request == nil || e.Request.URL == "" {
+		return nil, fmt.Errorf("missing request")
+	}
+
+	f := flow.New()
+	if e.StartedDateTime != "" {
+		start, err := time.Parse(time.RFC3339Nano, e.StartedDateTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid startedDateTime %q: %w", e.StartedDateTime, err)
+		}
+		f.StartTime = start
+	}
+	if e.Time > 0 {
+		f.EndTime = f.StartTime.Add(duration(e.Time))
+	}
+	if e.ServerIPAddress != "" {
+		f.ServerAddr = e.ServerIPAddress
+	}
+	f.Timings = e.Timings.points(f.StartTime)
+	f.Violations = e.Violations
+	f.Credentials = e.Credentials
+	f.TraceID = e.TraceID
+	f.CorrelationID = e.CorrelationID
+	f.Tags, f.Comment, f.Starred, f.Marker = e.Tags, e.Note, e.Starred, e.Marker
+
+	f.Request = &flow.Request{
+		Method: e.Request.Method,
+		URL:    e.Request.URL,
+		Proto:  e.Request.HTTPVersion,
+		Header: importHeaders(e.Request.Headers),
+	}
+	if f.Request.Method == "" {
+		f.Request.Method = http.MethodGet
+	}
+	f.Request.Host = f.Request.Header.Get("Host")
+	if f.Request.Host == "" {
+		f.Request.Host = pseudoHeader(e.Request.Headers, ":authority")
+	}
+	f.Request.Header.Del("Host")
+	if pd := e.Request.PostData; pd != nil {
+		f.Request.Body = []byte(pd.Text)
+		if f.Request.Header.Get("Content-Type") == "" && pd.MimeType != "" {
+			f.Request.Header.Set("Content-Type", pd.MimeType)
+		}
+	}
+
+	if resp := e.Response; resp != nil && resp.Status > 0 {
+		body, err := resp.Content.body()
+		if err != nil {
+			return nil, err
+		}
+		f.Response = &flow.Response{
+			StatusCode: resp.Status,
+			Status:     strconv.Itoa(resp.Status) + " " + resp.StatusText,
+			Proto:      resp.HTTPVersion,
+			Header:     importHeaders(resp.Headers),
+			Body:       body,
+		}
+		if resp.StatusText == "" {
+			f.Response.Status = strconv.Itoa(resp.Status) + " " + http.StatusText(resp.Status)
+		}
+		if f.Response.Header.Get("Content-Type") == "" && resp.Content != nil && resp.Content.MimeType != "x-unknown" {
+			f.Response.Header.Set("Content-Type", resp.Content.MimeType)
+		}
+	} else {
+		f.Error = "no response"
+		if resp != nil && resp.Comment != "" {
+			f.Error = resp.Comment
+		}
+	}
+	return f, nil
+}
+
+// points 按HAR的阶段顺序从请求开始累加耗时，还原各阶段的时间点，耗时不可用时返回nil
+func (t *Timings) points(start time.Time) *flow.Timings {
+	if t == nil || t.Wait < 0 {
+		return nil
+	}
+	ft := &flow.Timings{}
+	if t.ClientSSL > 0 {
+		ft.ClientTLSStart, ft.ClientTLSDone = start.Add(-duration(t.ClientSSL)), start
+	}
+	// phase 返回从上一阶段结束开始、持续 ms 毫秒的阶段
+	at := start
+	phase := func(ms float64) (time.Time, time.Time) {
+		begin := at
+		at = at.Add(duration(max(ms, 0)))
+		return begin, at
+	}
+	phase(t.Blocked)
+	if t.DNS >= 0 {
+		ft.DNSStart, ft.DNSDone = phase(t.DNS)
+	}
+	if t.Connect >= 0 {
+		ft.ConnectStart, ft.ConnectDone = phase(t.Connect - max(t.SSL, 0))
+		if t.SSL >= 0 {
+			ft.TLSStart, ft.TLSDone = phase(t.SSL)
+		}
+	}
+	_, ft.RequestSent = phase(t.Send)
+	_, ft.FirstByte = phase(t.Wait)
+	_, ft.ResponseDone = phase(t.Receive)
+	return ft
+}
+
+// duration 将HAR中的毫秒数转换为时长
+func duration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// body 返回解码后的响应体
+func (c *Content) body() ([]byte, error) {
+	if c == nil || c.Text == "" {
+		return nil, nil
+	}
+	if c.Encoding == "base64" {
+		body, err := base64.StdEncoding.DecodeString(c.Text)
+		if err != nil {
+			return nil, fmt.Errorf("decode base64 content: %w", err)
+		}
+		return body, nil
+	}
+	return []byte(c.Text), nil
+}
+
+// importHeaders 转换头部，丢弃伪头部和与原始编码相关的头部
+func importHeaders(list []*NameValue) http.Header {
+	h := make(http.Header, len(list))
+	for _, nv := range list {
+		if nv.Name == "" || nv.Name[0] == ':' {
+			continue
+		}
+		name := http.CanonicalHeaderKey(nv.Name)
+		if hopHeaders[name] {
+			continue
+		}
+		h.Add(name, nv.Value)
+	}
+	return h
+}
+
+// pseudoHeader 查找HTTP/2伪头部的值
+func pseudoHeader(list []*NameValue, name string) string {
+	for _, nv := range list {
+		if nv.Name == name {
+			return nv.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package har
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// browserHAR 浏览器导出的HAR片段，包含HTTP/2伪头部和base64内容
+const browserHAR = `{
+  "log": {
+    "version": "1.2",
+    "creator": {"name": "WebInspector", "version": "537.36"},
+    "entries": [
+      {
+        "startedDateTime": "2025-01-02T03:04:05.006Z",
+        "time": 12.5,
+        "request": {
+          "method": "GET",
+          "url": "https://example.com/logo.png",
+          "httpVersion": "h2",
+          "headers": [
+            {"name": ":authority", "value": "example.com"},
+            {"name": "accept", "value": "image/*"}
+          ],
+          "queryString": [], "cookies": [], "headersSize": -1, "bodySize": 0
+        },
+        "response": {
+          "status": 200, "statusText": "", "httpVersion": "h2",
+          "headers": [
+            {"name": "content-encoding", "value": "br"},
+            {"name": "content-length", "value": "3"}
+          ],
+          "cookies": [],
+          "content": {"size": 4, "mimeType": "image/png", "text": "iVBORw==", "encoding": "base64"},
+          "redirectURL": "", "headersSize": -1, "bodySize": 3,
+          "_transferSize": 100
+        },
+        "cache": {}, "timings": {"send": 1, "wait": 10, "receive": 1.5},
+        "serverIPAddress": "[2606:2800::1]"
+      },
+      {
+        "startedDateTime": "2025-01-02T03:04:06.000+01:00",
+        "time": 0,
+        "request": {"method": "POST", "url": "https://example.com/api", "httpVersion": "HTTP/1.1",
+          "headers": [], "postData": {"mimeType": "application/json", "text": "{}"}},
+        "response": {"status": 0, "statusText": "", "headers": [], "content": {"size": 0, "mimeType": "x-unknown"}},
+        "timings": {}
+      }
+    ]
+  }
+}`
+
+// --- 测试代码 ---
+func TestRead_Browser(t *testing.T) {
+	flows, err := Read(strings.NewReader(browserHAR))
+	require.NoError(t, err)
+	require.Len(t, flows, 2)
+
+	f := flows[0]
+	require.Equal(t, 12500*time.Microsecond, f.Duration())
+	require.Equal(t, "example.com", f.Request.Host)
+	require.Equal(t, "image/*", f.Request.Header.Get("Accept"))
+	require.NotContains(t, f.Request.Header, ":authority")
+	require.Equal(t, "200 OK", f.Response.Status)
+	require.Equal(t, []byte{0x89, 'P', 'N', 'G'}, f.Response.Body)
+	require.Empty(t, f.Response.Header.Get("Content-Encoding"))
+	require.Equal(t, "image/png", f.Response.Header.Get("Content-Type"))
+
+	failed := flows[1]
+	require.Nil(t, failed.Response)
+	require.Equal(t, "no response", failed.Error)
+	require.Equal(t, "{}", string(failed.Request.Body))
+	require.Equal(t, "application/json", failed.Request.Header.Get("Content-Type"))
+}
+
+func TestRead_RoundTrip(t *testing.T) {
+	orig := capturedFlow(t)
+	orig.Violations = []*flow.Violation{{Kind: "unknown-field", Location: "response.body.extra", Message: "field is not documented"}}
+	orig.Credentials = []*flow.Credential{{Kind: "basic-auth", Location: "request.header.Authorization", Fingerprint: "sha256:0011223344556677", Hint: "user alice"}}
+	orig.TraceID, orig.CorrelationID = "4bf92f3577b34da6a3ce929d0e0e4736", "req-42"
+	orig.Tags = []string{"login"}
+	orig.Comment = "redirect loop"
+	orig.Starred = true
+	orig.Marker = "yellow"
+	ms := func(n int) time.Time { return orig.StartTime.Add(time.Duration(n) * time.Millisecond) }
+	orig.Timings = &flow.Timings{
+		ClientTLSStart: ms(-5), ClientTLSDone: ms(0),
+		DNSStart: ms(1), DNSDone: ms(2),
+		ConnectStart: ms(2), ConnectDone: ms(4),
+		TLSStart: ms(4), TLSDone: ms(7),
+		RequestSent: ms(8), FirstByte: ms(10), ResponseDone: ms(12),
+	}
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, []*flow.Flow{orig}))
+
+	flows, err := Read(&buf)
+	require.NoError(t, err)
+	require.Len(t, flows, 1)
+
+	f := flows[0]
+	require.True(t, orig.StartTime.Equal(f.StartTime))
+	require.Equal(t, orig.Request.URL, f.Request.URL)
+	require.Equal(t, orig.Request.Body, f.Request.Body)
+	require.Equal(t, "sid=1; theme=dark", f.Request.Header.Get("Cookie"))
+	require.Equal(t, http.StatusFound, f.Response.StatusCode)
+	require.Equal(t, "<p>moved</p>", string(f.Response.Body))
+	require.Equal(t, "/home", f.Response.Header.Get("Location"))
+	require.Equal(t, orig.Violations, f.Violations)
+	require.Equal(t, orig.Credentials, f.Credentials)
+	require.Equal(t, orig.TraceID, f.TraceID)
+	require.Equal(t, orig.CorrelationID, f.CorrelationID)
+	require.Equal(t, orig.Tags, f.Tags)
+	require.Equal(t, orig.Comment, f.Comment)
+	require.True(t, f.Starred)
+	require.Equal(t, orig.Marker, f.Marker)
+	require.Equal(t, orig.Timings, f.Timings)
+}
+
+func TestRead_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"not json", "nope"},
+		{"missing log", `{}`},
+		{"missing request", `{"log": {"entries": [{}]}}`},
+		{"bad time", `{"log": {"entries": [{"startedDateTime": "yesterday", "request": {"url": "http://a/"}}]}}`},
+		{"bad base64", `{"log": {"entries": [{"request": {"url": "http://a/"},
+			"response": {"status": 200, "content": {"text": "!!", "encoding": "base64"}}}]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tt.doc))
+			require.Error(t, err)
+		})
+	}
+}
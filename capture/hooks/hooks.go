@@ -0,0 +1,172 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package hooks
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// ClientConn 新接入的客户端连接
+type ClientConn struct {
+	// Conn 原始客户端连接，钩子不应读写其中的数据
+	Conn net.Conn
+
+	// RemoteAddr 客户端地址，启用PROXY protocol时为真实客户端地址
+	RemoteAddr net.Addr
+
+	// LocalAddr 代理监听地址
+	LocalAddr net.Addr
+}
+
+// Hook 流生命周期钩子，嵌入 Base 后只需实现关心的方法。
+//
+// OnClientConnect 返回的上下文会传给该连接上所有流的钩子，
+// OnRequest 返回的上下文会传给同一条流的 OnResponse 和 OnError，
+// 钩子可以借此在各阶段之间传递数据。
+type Hook interface {
+	// OnClientConnect 在协议检测之前调用，返回错误时关闭连接
+	OnClientConnect(ctx context.Context, conn *ClientConn) (context.Context, error)
+
+	// OnRequest 在请求发往上游之前调用，可以修改 f.Request；
+	// 设置 f.Response 时直接用该响应回复客户端，不再访问上游；
+	// 返回错误时中止流并向客户端返回502
+	OnRequest(ctx context.Context, f *flow.Flow) (context.Context, error)
+
+	// OnResponse 在响应返回客户端之前调用，可以修改 f.Response；
+	// 返回错误时中止流并向客户端返回502
+	OnResponse(ctx context.Context, f *flow.Flow) error
+
+	// OnError 在流以错误结束时调用，此时流已结束，修改不会生效
+	OnError(ctx context.Context, f *flow.Flow, err error)
+}
+
+// Base 所有方法都不做任何处理的钩子，供嵌入使用
+type Base struct{}
+
+// OnClientConnect 实现 Hook 接口
+func (Base) OnClientConnect(ctx context.Context, _ *ClientConn) (context.Context, error) {
+	return ctx, nil
+}
+
+// OnRequest 实现 Hook 接口
+func (Base) OnRequest(ctx context.Context, _ *flow.Flow) (context.Context, error) {
+	return ctx, nil
+}
+
+// OnResponse 实现 Hook 接口
+func (Base) OnResponse(context.Context, *flow.Flow) error {
+	return nil
+}
+
+// OnError 实现 Hook 接口
+func (Base) OnError(context.Context, *flow.Flow, error) {}
+
+// Chain 按注册顺序组织的钩子链，nil 链不调用任何钩子，可以并发使用。
+//
+// OnClientConnect、OnRequest 和 OnError 按注册顺序调用，OnResponse 按注册的逆序调用，
+// 先注册的钩子包裹后注册的钩子，与中间件的习惯一致。
+// OnClientConnect、OnRequest 或 OnResponse 返回错误时，后续钩子不再调用；
+// OnRequest 设置了响应时同样停止，之后的钩子看不到这个请求。
+type Chain struct {
+	mu    sync.RWMutex
+	hooks []Hook
+}
+
+// NewChain 创建钩子链
+func NewChain(hooks ...Hook) *Chain {
+	return &Chain{hooks: append([]Hook(nil), hooks...)}
+}
+
+// Register 在链尾追加钩子，对之后开始的连接和流生效
+func (c *Chain) Register(h Hook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, h)
+}
+
+// Replace 用另一个链的钩子原子地替换当前钩子，返回被替换的钩子。
+// 正在执行的调用继续使用旧钩子，之后的调用使用新钩子
+func (c *Chain) Replace(other *Chain) []Hook {
+	hooks := other.snapshot()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.hooks
+	c.hooks = hooks
+	return old
+}
+
+// Len 返回已注册的钩子数量
+func (c *Chain) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.hooks)
+}
+
+// snapshot 返回当前钩子列表的副本，调用钩子时不持有锁
+func (c *Chain) snapshot() []Hook {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Hook(nil), c.hooks...)
+}
+
+// ClientConnect 依次调用 OnClientConnect
+func (c *Chain) ClientConnect(ctx context.Context, conn *ClientConn) (context.Context, error) {
+	for _, h := range c.snapshot() {
+		next, err := h.OnClientConnect(ctx, conn)
+		if err != nil {
+			return ctx, err
+		}
+		if next != nil {
+			ctx = next
+		}
+	}
+	return ctx, nil
+}
+
+// Request 依次调用 OnRequest，某个钩子设置了响应时停止
+func (c *Chain) Request(ctx context.Context, f *flow.Flow) (context.Context, error) {
+	for _, h := range c.snapshot() {
+		next, err := h.OnRequest(ctx, f)
+		if err != nil {
+			return ctx, err
+		}
+		if next != nil {
+			ctx = next
+		}
+		if f.Response != nil {
+			break
+		}
+	}
+	return ctx, nil
+}
+
+// Response 按注册的逆序调用 OnResponse
+func (c *Chain) Response(ctx context.Context, f *flow.Flow) error {
+	hooks := c.snapshot()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].OnResponse(ctx, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Error 依次调用 OnError
+func (c *Chain) Error(ctx context.Context, f *flow.Flow, err error) {
+	for _, h := range c.snapshot() {
+		h.OnError(ctx, f, err)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package hooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+type ctxKey string
+
+// recorder 记录调用顺序的钩子
+type recorder struct {
+	Base
+	name    string
+	calls   *[]string
+	respond bool
+	fail    error
+}
+
+func (r *recorder) OnClientConnect(ctx context.Context, _ *ClientConn) (context.Context, error) {
+	*r.calls = append(*r.calls, r.name+":connect")
+	return context.WithValue(ctx, ctxKey(r.name), true), r.fail
+}
+
+func (r *recorder) OnRequest(ctx context.Context, f *flow.Flow) (context.Context, error) {
+	*r.calls = append(*r.calls, r.name+":request")
+	if r.respond {
+		f.Response = &flow.Response{StatusCode: 204}
+	}
+	return context.WithValue(ctx, ctxKey(r.name+".req"), true), r.fail
+}
+
+func (r *recorder) OnResponse(ctx context.Context, _ *flow.Flow) error {
+	*r.calls = append(*r.calls, r.name+":response")
+	if ctx.Value(ctxKey(r.name+".req")) == nil {
+		return errors.New("request context lost")
+	}
+	return r.fail
+}
+
+func (r *recorder) OnError(_ context.Context, _ *flow.Flow, err error) {
+	*r.calls = append(*r.calls, r.name+":error:"+err.Error())
+}
+
+// --- 测试代码 ---
+func TestChain_Order(t *testing.T) {
+	var calls []string
+	c := NewChain(&recorder{name: "a", calls: &calls})
+	c.Register(&recorder{name: "b", calls: &calls})
+	require.Equal(t, 2, c.Len())
+
+	ctx, err := c.ClientConnect(context.Background(), &ClientConn{})
+	require.NoError(t, err)
+	require.Equal(t, true, ctx.Value(ctxKey("a")))
+	require.Equal(t, true, ctx.Value(ctxKey("b")))
+
+	f := flow.New()
+	ctx, err = c.Request(ctx, f)
+	require.NoError(t, err)
+	require.NoError(t, c.Response(ctx, f))
+	c.Error(ctx, f, errors.New("boom"))
+
+	require.Equal(t, []string{
+		"a:connect", "b:connect",
+		"a:request", "b:request",
+		"b:response", "a:response",
+		"a:error:boom", "b:error:boom",
+	}, calls)
+}
+
+func TestChain_ShortCircuit(t *testing.T) {
+	var calls []string
+	fail := errors.New("denied")
+	c := NewChain(
+		&recorder{name: "a", calls: &calls, respond: true},
+		&recorder{name: "b", calls: &calls},
+	)
+
+	// 设置了响应后不再调用后续钩子
+	f := flow.New()
+	_, err := c.Request(context.Background(), f)
+	require.NoError(t, err)
+	require.Equal(t, 204, f.Response.StatusCode)
+	require.Equal(t, []string{"a:request"}, calls)
+
+	// 返回错误时停止
+	calls = nil
+	c = NewChain(&recorder{name: "a", calls: &calls, fail: fail}, &recorder{name: "b", calls: &calls})
+	_, err = c.ClientConnect(context.Background(), &ClientConn{})
+	require.ErrorIs(t, err, fail)
+	_, err = c.Request(context.Background(), flow.New())
+	require.ErrorIs(t, err, fail)
+	require.Equal(t, []string{"a:connect", "a:request"}, calls)
+}
+
+func TestChain_Nil(t *testing.T) {
+	var c *Chain
+	ctx := context.WithValue(context.Background(), ctxKey("k"), 1)
+	got, err := c.ClientConnect(ctx, &ClientConn{})
+	require.NoError(t, err)
+	require.Equal(t, ctx, got)
+	got, err = c.Request(ctx, flow.New())
+	require.NoError(t, err)
+	require.Equal(t, ctx, got)
+	require.NoError(t, c.Response(ctx, flow.New()))
+	c.Error(ctx, flow.New(), errors.New("x"))
+	require.Zero(t, c.Len())
+}
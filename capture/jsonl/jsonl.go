@@ -0,0 +1,128 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/sink"
+)
+
+// bodyFields 消息体字段，默认不输出
+var bodyFields = []string{"request_body", "response_body"}
+
+// Fields 可选择的字段，与 sink.Record 的JSON字段相同并按其顺序排列
+var Fields = recordFields()
+
+// recordFields 返回 sink.Record 的JSON字段名
+func recordFields() []string {
+	t := reflect.TypeFor[sink.Record]()
+	fields := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// Options 输出配置
+type Options struct {
+	// Fields 输出的字段及顺序，为空时输出全部字段，消息体字段只在 IncludeBodies 时输出
+	Fields []string
+
+	// IncludeBodies 输出捕获的消息体（base64编码），Fields 中指定了消息体字段时总是输出
+	IncludeBodies bool
+}
+
+// Writer 以JSON Lines格式逐个写入流，每行一个 sink.Record 格式的JSON对象
+type Writer struct {
+	w      *bufio.Writer
+	fields []string
+	bodies bool
+}
+
+// NewWriter 创建写入器，Fields 中有未知字段时返回错误
+func NewWriter(w io.Writer, opts Options) (*Writer, error) {
+	for _, name := range opts.Fields {
+		if !slices.Contains(Fields, name) {
+			return nil, fmt.Errorf("unknown field %q (available: %s)", name, strings.Join(Fields, ", "))
+		}
+	}
+	jw := &Writer{w: bufio.NewWriter(w), fields: opts.Fields, bodies: opts.IncludeBodies}
+	for _, name := range bodyFields {
+		if slices.Contains(opts.Fields, name) {
+			jw.bodies = true
+		}
+	}
+	return jw, nil
+}
+
+// WriteFlow 写入一个流，选择字段时省略流上没有值的字段
+func (jw *Writer) WriteFlow(f *flow.Flow) error {
+	data, err := json.Marshal(sink.NewRecord(f, jw.bodies))
+	if err != nil {
+		return fmt.Errorf("encode flow %s: %w", f.ID, err)
+	}
+	if len(jw.fields) > 0 {
+		if data, err = selectFields(data, jw.fields); err != nil {
+			return fmt.Errorf("encode flow %s: %w", f.ID, err)
+		}
+	}
+	jw.w.Write(data)
+	return jw.w.WriteByte('\n')
+}
+
+// selectFields 按 fields 的顺序重新组织JSON对象
+func selectFields(data []byte, fields []string) ([]byte, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, name := range fields {
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Flush 将缓冲的数据写入底层的 io.Writer
+func (jw *Writer) Flush() error {
+	return jw.w.Flush()
+}
+
+// Write 以JSON Lines格式写入流
+func Write(w io.Writer, flows []*flow.Flow, opts Options) error {
+	jw, err := NewWriter(w, opts)
+	if err != nil {
+		return err
+	}
+	for _, f := range flows {
+		if err := jw.WriteFlow(f); err != nil {
+			return err
+		}
+	}
+	return jw.Flush()
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package jsonl
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+func newFlow(id string, status int) *flow.Flow {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &flow.Flow{
+		ID:        id,
+		StartTime: start,
+		EndTime:   start.Add(40 * time.Millisecond),
+		Request: &flow.Request{
+			Method: "GET",
+			URL:    "https://example.com/items?page=2",
+			Header: http.Header{"Accept": {"application/json"}},
+		},
+		Response: &flow.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       []byte(`{"items":[]}`),
+		},
+	}
+}
+
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var v map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &v))
+		out = append(out, v)
+	}
+	return out
+}
+
+// --- 测试代码 ---
+
+func TestWrite_AllFields(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, []*flow.Flow{newFlow("a", 200), newFlow("b", 404)}, Options{}))
+
+	got := lines(t, &buf)
+	require.Len(t, got, 2)
+	require.Equal(t, "sniffy.flow.v1", got[0]["schema"])
+	require.Equal(t, "a", got[0]["id"])
+	require.Equal(t, "/items", got[0]["path"])
+	require.Equal(t, 404.0, got[1]["status"])
+	require.Equal(t, 40.0, got[1]["duration_ms"])
+	require.NotContains(t, got[0], "response_body")
+}
+
+func TestWrite_SelectedFields(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, []*flow.Flow{newFlow("a", 200)}, Options{Fields: []string{"status", "id", "error"}})
+	require.NoError(t, err)
+	require.Equal(t, `{"status":200,"id":"a"}`+"\n", buf.String())
+}
+
+func TestWrite_Bodies(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, []*flow.Flow{newFlow("a", 200)}, Options{IncludeBodies: true}))
+	require.Equal(t, "eyJpdGVtcyI6W119", lines(t, &buf)[0]["response_body"])
+
+	// 选择消息体字段时总是包含消息体
+	buf.Reset()
+	require.NoError(t, Write(&buf, []*flow.Flow{newFlow("a", 200)}, Options{Fields: []string{"id", "response_body"}}))
+	require.Equal(t, `{"id":"a","response_body":"eyJpdGVtcyI6W119"}`+"\n", buf.String())
+}
+
+func TestNewWriter_UnknownField(t *testing.T) {
+	_, err := NewWriter(&bytes.Buffer{}, Options{Fields: []string{"id", "nope"}})
+	require.ErrorContains(t, err, `unknown field "nope"`)
+}
+
+func TestFields(t *testing.T) {
+	require.Equal(t, "schema", Fields[0])
+	require.Contains(t, Fields, "trace_id")
+	require.Contains(t, Fields, "response_body")
+}
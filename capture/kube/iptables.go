@@ -0,0 +1,80 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Chain 安装的 nat 表自定义链，Pod 内发出的TCP连接都经过这条链
+const Chain = "SNIFFY_OUTPUT"
+
+// DefaultUID 边车运行使用的用户ID，与 Istio 的 proxy 用户相同，这个用户发起的连接不重定向
+const DefaultUID = 1337
+
+// Egress 重定向 Pod 出站连接的设置
+type Egress struct {
+	// Port 透明代理监听器的端口
+	Port int
+
+	// UID 边车进程的用户ID，代理自己连接上游时不会被重定向回代理
+	UID int
+
+	// ExcludePorts 不重定向的目标端口
+	ExcludePorts []int
+
+	// ExcludeCIDRs 不重定向的目标网段，例如 Kubernetes API 服务器所在的网段
+	ExcludeCIDRs []*net.IPNet
+}
+
+// Step 安装规则的一条命令，MayFail 为true时命令失败不影响后续步骤（例如链已经存在）
+type Step struct {
+	Args    []string
+	MayFail bool
+}
+
+func (s Step) String() string {
+	return strings.Join(s.Args, " ")
+}
+
+// Steps 返回在 Pod 的网络命名空间中安装出站重定向的 iptables 命令，ipv6 为true时返回 ip6tables 命令。
+// 重复执行得到相同的规则：先创建并清空 Chain，再把 OUTPUT 链中的跳转替换为一条
+func (e Egress) Steps(ipv6 bool) ([]Step, error) {
+	if e.Port < 1 || e.Port > 65535 {
+		return nil, fmt.Errorf("invalid redirect port %d", e.Port)
+	}
+	command := "iptables"
+	if ipv6 {
+		command = "ip6tables"
+	}
+	nat := func(mayFail bool, args ...string) Step {
+		return Step{Args: append([]string{command, "-t", "nat"}, args...), MayFail: mayFail}
+	}
+
+	steps := []Step{
+		nat(true, "-N", Chain),
+		nat(false, "-F", Chain),
+		nat(true, "-D", "OUTPUT", "-p", "tcp", "-j", Chain),
+		nat(false, "-A", "OUTPUT", "-p", "tcp", "-j", Chain),
+		// 代理自己的连接和 Pod 内部经回环接口的连接不重定向
+		nat(false, "-A", Chain, "-m", "owner", "--uid-owner", strconv.Itoa(e.UID), "-j", "RETURN"),
+		nat(false, "-A", Chain, "-o", "lo", "-j", "RETURN"),
+	}
+	for _, p := range e.ExcludePorts {
+		steps = append(steps, nat(false, "-A", Chain, "-p", "tcp", "--dport", strconv.Itoa(p), "-j", "RETURN"))
+	}
+	for _, cidr := range e.ExcludeCIDRs {
+		if (cidr.IP.To4() == nil) != ipv6 {
+			continue
+		}
+		steps = append(steps, nat(false, "-A", Chain, "-d", cidr.String(), "-j", "RETURN"))
+	}
+	steps = append(steps, nat(false, "-A", Chain, "-p", "tcp", "-j", "REDIRECT", "--to-ports", strconv.Itoa(e.Port)))
+	return steps, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// writeLabels 写入 downward API 格式的标签文件
+func writeLabels(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "labels")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+// commands 返回步骤的命令行
+func commands(steps []Step) []string {
+	out := make([]string, len(steps))
+	for i, s := range steps {
+		out[i] = s.String()
+	}
+	return out
+}
+
+// --- 测试代码 ---
+
+func TestLoadLabels(t *testing.T) {
+	labels, err := LoadLabels(writeLabels(t, "app=\"demo\"\npod-template-hash=\"5d9c\"\nnote=\"a \\\"quoted\\\" value\"\n"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"app":               "demo",
+		"pod-template-hash": "5d9c",
+		"note":              `a "quoted" value`,
+	}, labels)
+
+	_, err = LoadLabels(writeLabels(t, "app=demo\n"))
+	require.ErrorContains(t, err, ":1: invalid value for label app")
+	_, err = LoadLabels(writeLabels(t, "app=\"demo\"\nbroken\n"))
+	require.ErrorContains(t, err, `:2: expected key="value"`)
+}
+
+func TestEgressSteps(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("10.96.0.0/12")
+	_, v6, _ := net.ParseCIDR("fd00::/108")
+	e := Egress{Port: 15001, UID: 1337, ExcludePorts: []int{3306}, ExcludeCIDRs: []*net.IPNet{v4, v6}}
+
+	steps, err := e.Steps(false)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"iptables -t nat -N SNIFFY_OUTPUT",
+		"iptables -t nat -F SNIFFY_OUTPUT",
+		"iptables -t nat -D OUTPUT -p tcp -j SNIFFY_OUTPUT",
+		"iptables -t nat -A OUTPUT -p tcp -j SNIFFY_OUTPUT",
+		"iptables -t nat -A SNIFFY_OUTPUT -m owner --uid-owner 1337 -j RETURN",
+		"iptables -t nat -A SNIFFY_OUTPUT -o lo -j RETURN",
+		"iptables -t nat -A SNIFFY_OUTPUT -p tcp --dport 3306 -j RETURN",
+		"iptables -t nat -A SNIFFY_OUTPUT -d 10.96.0.0/12 -j RETURN",
+		"iptables -t nat -A SNIFFY_OUTPUT -p tcp -j REDIRECT --to-ports 15001",
+	}, commands(steps))
+	// 创建已存在的链和删除不存在的跳转可以失败
+	require.True(t, steps[0].MayFail)
+	require.True(t, steps[2].MayFail)
+	require.False(t, steps[3].MayFail)
+
+	steps, err = e.Steps(true)
+	require.NoError(t, err)
+	require.Contains(t, commands(steps), "ip6tables -t nat -A SNIFFY_OUTPUT -d fd00::/108 -j RETURN")
+	require.NotContains(t, commands(steps), "ip6tables -t nat -A SNIFFY_OUTPUT -d 10.96.0.0/12 -j RETURN")
+
+	_, err = Egress{UID: 1337}.Steps(false)
+	require.EqualError(t, err, "invalid redirect port 0")
+}
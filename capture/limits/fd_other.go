@@ -0,0 +1,12 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+
+package limits
+
+func fdLimit() uint64 {
+	return 0
+}
@@ -0,0 +1,23 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package limits
+
+import "syscall"
+
+// fdLimit 返回 RLIMIT_NOFILE 的软限制，不限制时返回0。Go 运行时启动时已把软限制提高到硬限制
+func fdLimit() uint64 {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0
+	}
+	// RLIM_INFINITY 在不同系统上的取值不同，过大的值视为不限制
+	if n := uint64(rl.Cur); n < 1<<32 {
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,160 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// FDReserve 估算连接数时为监听器、日志、存储和控制接口保留的文件描述符数量
+const FDReserve = 64
+
+// fdsPerConn 每个代理连接占用的文件描述符：客户端连接和上游连接各一个
+const fdsPerConn = 2
+
+// ErrTooManyConnections 并发客户端连接数达到上限
+var ErrTooManyConnections = errors.New("too many concurrent connections")
+
+// OriginError 发往源站的进行中请求数达到上限
+type OriginError struct {
+	// Origin 源站的 host:port
+	Origin string
+
+	// Limit 每个源站的进行中请求上限
+	Limit int
+}
+
+func (e *OriginError) Error() string {
+	return fmt.Sprintf("too many in-flight requests to %s (limit %d)", e.Origin, e.Limit)
+}
+
+// Limiter 并发限制：客户端连接总数和每个源站的进行中请求数，超出时立即拒绝而不是排队，
+// 流量突增时代理降级为拒绝部分请求，而不是耗尽文件描述符。为nil时不限制
+type Limiter struct {
+	maxConns  int
+	perOrigin int
+
+	conns atomic.Int64
+
+	mu       sync.Mutex
+	inFlight map[string]int
+
+	rejectedConns    atomic.Int64
+	rejectedRequests atomic.Int64
+}
+
+// New 创建并发限制，maxConns 为客户端连接上限，perOrigin 为每个源站的进行中请求上限，0 表示不限制
+func New(maxConns, perOrigin int) *Limiter {
+	return &Limiter{
+		maxConns:  maxConns,
+		perOrigin: perOrigin,
+		inFlight:  make(map[string]int),
+	}
+}
+
+// MaxConns 返回客户端连接上限，0 表示不限制
+func (l *Limiter) MaxConns() int {
+	if l == nil {
+		return 0
+	}
+	return l.maxConns
+}
+
+// AcquireConn 占用一个客户端连接名额，达到上限时返回 ErrTooManyConnections。
+// 成功时连接关闭后需要调用 release
+func (l *Limiter) AcquireConn() (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if n := l.conns.Add(1); l.maxConns > 0 && n > int64(l.maxConns) {
+		l.conns.Add(-1)
+		l.rejectedConns.Add(1)
+		return nil, ErrTooManyConnections
+	}
+	var once sync.Once
+	return func() { once.Do(func() { l.conns.Add(-1) }) }, nil
+}
+
+// AcquireOrigin 占用一个发往 origin 的请求名额，达到上限时返回 *OriginError。
+// 成功时请求完成后需要调用 release
+func (l *Limiter) AcquireOrigin(origin string) (release func(), err error) {
+	if l == nil || l.perOrigin <= 0 {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[origin] >= l.perOrigin {
+		l.rejectedRequests.Add(1)
+		return nil, &OriginError{Origin: origin, Limit: l.perOrigin}
+	}
+	l.inFlight[origin]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.inFlight[origin]--; l.inFlight[origin] <= 0 {
+				delete(l.inFlight, origin)
+			}
+		})
+	}, nil
+}
+
+// Stats 并发限制的统计
+type Stats struct {
+	// Conns 当前的客户端连接数
+	Conns int64 `json:"conns"`
+
+	// MaxConns 客户端连接上限，0 表示不限制
+	MaxConns int `json:"max_conns"`
+
+	// MaxOriginRequests 每个源站的进行中请求上限，0 表示不限制
+	MaxOriginRequests int `json:"max_origin_requests"`
+
+	// InFlight 有进行中请求的源站及请求数
+	InFlight map[string]int `json:"in_flight,omitempty"`
+
+	// RejectedConns 因连接数达到上限被拒绝的连接数
+	RejectedConns int64 `json:"rejected_conns"`
+
+	// RejectedRequests 因源站请求数达到上限被拒绝的请求数
+	RejectedRequests int64 `json:"rejected_requests"`
+}
+
+// Stats 返回当前的统计
+func (l *Limiter) Stats() Stats {
+	if l == nil {
+		return Stats{}
+	}
+	l.mu.Lock()
+	inFlight := make(map[string]int, len(l.inFlight))
+	for origin, n := range l.inFlight {
+		inFlight[origin] = n
+	}
+	l.mu.Unlock()
+	return Stats{
+		Conns:             l.conns.Load(),
+		MaxConns:          l.maxConns,
+		MaxOriginRequests: l.perOrigin,
+		InFlight:          inFlight,
+		RejectedConns:     l.rejectedConns.Load(),
+		RejectedRequests:  l.rejectedRequests.Load(),
+	}
+}
+
+// ConnsForFDs 按进程的文件描述符限制估算可以同时处理的客户端连接数，
+// 每个连接占用客户端和上游两个描述符并保留 FDReserve 个。无法获取限制时返回0
+func ConnsForFDs() int {
+	n := fdLimit()
+	if n <= FDReserve {
+		return 0
+	}
+	return int((n - FDReserve) / fdsPerConn)
+}
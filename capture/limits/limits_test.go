@@ -0,0 +1,108 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package limits
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+
+func TestLimiter_Conns(t *testing.T) {
+	l := New(2, 0)
+	r1, err := l.AcquireConn()
+	require.NoError(t, err)
+	r2, err := l.AcquireConn()
+	require.NoError(t, err)
+	_, err = l.AcquireConn()
+	require.ErrorIs(t, err, ErrTooManyConnections)
+
+	// 重复释放只归还一次
+	r1()
+	r1()
+	require.Equal(t, int64(1), l.Stats().Conns)
+	r3, err := l.AcquireConn()
+	require.NoError(t, err)
+	r2()
+	r3()
+
+	st := l.Stats()
+	require.Zero(t, st.Conns)
+	require.Equal(t, int64(1), st.RejectedConns)
+	require.Equal(t, 2, st.MaxConns)
+}
+
+func TestLimiter_Origin(t *testing.T) {
+	l := New(0, 2)
+	var releases []func()
+	for range 2 {
+		release, err := l.AcquireOrigin("a.example:443")
+		require.NoError(t, err)
+		releases = append(releases, release)
+	}
+	_, err := l.AcquireOrigin("a.example:443")
+	var oe *OriginError
+	require.ErrorAs(t, err, &oe)
+	require.Equal(t, "a.example:443", oe.Origin)
+
+	// 其他源站不受影响
+	other, err := l.AcquireOrigin("b.example:443")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"a.example:443": 2, "b.example:443": 1}, l.Stats().InFlight)
+
+	for _, release := range releases {
+		release()
+	}
+	other()
+	st := l.Stats()
+	require.Empty(t, st.InFlight)
+	require.Equal(t, int64(1), st.RejectedRequests)
+}
+
+func TestLimiter_Concurrent(t *testing.T) {
+	l := New(10, 3)
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if release, err := l.AcquireConn(); err == nil {
+				defer release()
+			}
+			if release, err := l.AcquireOrigin("origin"); err == nil {
+				defer release()
+			}
+		}()
+	}
+	wg.Wait()
+	st := l.Stats()
+	require.Zero(t, st.Conns)
+	require.Empty(t, st.InFlight)
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	var l *Limiter
+	release, err := l.AcquireConn()
+	require.NoError(t, err)
+	release()
+	release, err = l.AcquireOrigin("origin")
+	require.NoError(t, err)
+	release()
+	require.Zero(t, l.MaxConns())
+	require.Equal(t, Stats{}, l.Stats())
+}
+
+func TestConnsForFDs(t *testing.T) {
+	n := fdLimit()
+	if n == 0 {
+		require.Zero(t, ConnsForFDs())
+		return
+	}
+	require.Equal(t, int((n-FDReserve)/fdsPerConn), ConnsForFDs())
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// UnixPrefix 监听 unix 套接字的地址前缀，例如 unix:/run/sniffy.sock。
+// Windows 10 1803 及以后的版本同样支持 unix 套接字，例如 unix:C:\ProgramData\sniffy\sniffy.sock；
+// 不支持 Windows 命名管道
+const UnixPrefix = "unix:"
+
+// pipePrefixes Windows 命名管道地址的常见写法，用于给出明确的错误
+var pipePrefixes = []string{"npipe:", `\\.\pipe\`, "//./pipe/"}
+
+// SocketPath 返回 unix 套接字地址的路径，address 不是 unix 套接字地址时返回false
+func SocketPath(address string) (string, bool) {
+	return strings.CutPrefix(address, UnixPrefix)
+}
+
+// Listen 监听 address：带 unix: 前缀时监听 unix 套接字，否则监听TCP地址 host:port。
+// 没有进程监听的旧套接字文件会被删除，关闭时删除套接字文件。
+// 在 Unix 系统上新套接字的权限为 0600，只允许当前用户访问；Windows 上 os.Chmod 只能修改只读属性，
+// 访问权限由套接字所在目录的ACL决定，应把套接字放在只有当前用户可以访问的目录中
+func Listen(address string) (net.Listener, error) {
+	for _, prefix := range pipePrefixes {
+		if strings.HasPrefix(strings.ToLower(address), prefix) {
+			return nil, fmt.Errorf("windows named pipes are not supported: %q (use unix:path on Windows 10 1803 or later)", address)
+		}
+	}
+	path, ok := SocketPath(address)
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("invalid unix socket address %q", address)
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("restrict unix socket %s: %w", path, err)
+	}
+	return ln, nil
+}
+
+// removeStaleSocket 删除上次运行遗留、已经没有进程监听的套接字文件，其他文件保持不变
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a unix socket", path)
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is already in use", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,225 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 常用的子系统名称
+const (
+	SubsystemMain    = "main"
+	SubsystemProxy   = "proxy"
+	SubsystemTLS     = "tls"
+	SubsystemCA      = "ca"
+	SubsystemStorage = "storage"
+)
+
+// Options 日志配置
+type Options struct {
+	// Format 输出格式："text"（默认）或 "json"
+	Format string
+
+	// Level 默认日志级别
+	Level slog.Level
+
+	// Levels 按子系统覆盖的日志级别
+	Levels map[string]slog.Level
+
+	// File 日志文件路径，为空时写入 Output
+	File string
+
+	// MaxSize 日志文件轮转大小（字节），0 表示不轮转
+	MaxSize int64
+
+	// MaxBackups 轮转时保留的旧文件数量
+	MaxBackups int
+
+	// Output 未配置日志文件时的输出，为nil时使用标准错误
+	Output io.Writer
+
+	// AddSource 是否记录调用位置
+	AddSource bool
+}
+
+// Logging 基于 log/slog 的日志，所有子系统共用一个输出，每个子系统有独立的级别
+type Logging struct {
+	handler slog.Handler
+	out     *switchWriter
+	file    io.Closer
+	level   slog.Level
+
+	mu     sync.Mutex
+	levels map[string]*slog.LevelVar
+}
+
+// New 根据配置创建日志
+func New(opts Options) (*Logging, error) {
+	l := &Logging{
+		out:    &switchWriter{w: opts.Output},
+		level:  opts.Level,
+		levels: make(map[string]*slog.LevelVar),
+	}
+	if l.out.w == nil {
+		l.out.w = os.Stderr
+	}
+	if opts.File != "" {
+		f, err := OpenRotatingFile(opts.File, opts.MaxSize, opts.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		l.out.w, l.file = f, f
+	}
+
+	// 级别由每个子系统的 levelHandler 过滤
+	ho := &slog.HandlerOptions{Level: slog.Level(-8), AddSource: opts.AddSource}
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		l.handler = slog.NewTextHandler(l.out, ho)
+	case "json":
+		l.handler = slog.NewJSONHandler(l.out, ho)
+	default:
+		return nil, fmt.Errorf("unknown log format %q (supported: text, json)", opts.Format)
+	}
+	for name, level := range opts.Levels {
+		l.SetLevel(name, level)
+	}
+	return l, nil
+}
+
+// Subsystem 返回子系统的日志器，每条记录带有 subsystem 属性
+func (l *Logging) Subsystem(name string) *slog.Logger {
+	h := l.handler.WithAttrs([]slog.Attr{slog.String("subsystem", name)})
+	return slog.New(&levelHandler{inner: h, level: l.levelVar(name)})
+}
+
+// SetLevel 设置子系统的日志级别，运行时修改立即生效
+func (l *Logging) SetLevel(name string, level slog.Level) {
+	l.levelVar(name).Set(level)
+}
+
+// SetLevels 替换默认级别和按子系统覆盖的级别，不在 levels 中的子系统使用新的默认级别
+func (l *Logging) SetLevels(level slog.Level, levels map[string]slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+	for name, v := range l.levels {
+		if lv, ok := levels[name]; ok {
+			v.Set(lv)
+		} else {
+			v.Set(level)
+		}
+	}
+	for name, lv := range levels {
+		if _, ok := l.levels[name]; !ok {
+			v := &slog.LevelVar{}
+			v.Set(lv)
+			l.levels[name] = v
+		}
+	}
+}
+
+// levelVar 返回子系统的级别变量，未配置的子系统使用默认级别
+func (l *Logging) levelVar(name string) *slog.LevelVar {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	v, ok := l.levels[name]
+	if !ok {
+		v = &slog.LevelVar{}
+		v.Set(l.level)
+		l.levels[name] = v
+	}
+	return v
+}
+
+// SetOutput 替换输出，例如终端界面运行时写入界面的事件日志。配置了日志文件时不生效
+func (l *Logging) SetOutput(w io.Writer) {
+	if l.file != nil {
+		return
+	}
+	l.out.set(w)
+}
+
+// Close 关闭日志文件
+func (l *Logging) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// ParseLevel 解析日志级别：debug、info、warn、error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q (supported: debug, info, warn, error)", s)
+	}
+	return level, nil
+}
+
+// ParseSubsystemLevel 解析 subsystem=level 形式的子系统级别
+func ParseSubsystemLevel(s string) (string, slog.Level, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", 0, fmt.Errorf("invalid subsystem log level %q (expected subsystem=level)", s)
+	}
+	level, err := ParseLevel(strings.TrimSpace(value))
+	if err != nil {
+		return "", 0, err
+	}
+	return name, level, nil
+}
+
+// levelHandler 按子系统级别过滤记录的 slog.Handler
+type levelHandler struct {
+	inner slog.Handler
+	level *slog.LevelVar
+}
+
+// Enabled 实现 slog.Handler 接口
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle 实现 slog.Handler 接口
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+// WithAttrs 实现 slog.Handler 接口
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{inner: h.inner.WithAttrs(attrs), level: h.level}
+}
+
+// WithGroup 实现 slog.Handler 接口
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{inner: h.inner.WithGroup(name), level: h.level}
+}
+
+// switchWriter 可以在运行时替换目标的输出
+type switchWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+func (s *switchWriter) set(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w = w
+}
@@ -0,0 +1,125 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+func TestLogging_Levels(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(Options{
+		Format: "json",
+		Level:  slog.LevelInfo,
+		Levels: map[string]slog.Level{SubsystemTLS: slog.LevelDebug, SubsystemStorage: slog.LevelError},
+		Output: &buf,
+	})
+	require.NoError(t, err)
+
+	l.Subsystem(SubsystemProxy).Debug("hidden")
+	l.Subsystem(SubsystemProxy).Info("proxy started", "port", 8080)
+	l.Subsystem(SubsystemTLS).Debug("handshake")
+	l.Subsystem(SubsystemStorage).Warn("hidden")
+
+	// 运行时修改级别
+	l.SetLevel(SubsystemProxy, slog.LevelDebug)
+	l.Subsystem(SubsystemProxy).Debug("now visible")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &rec))
+	require.Equal(t, "proxy started", rec["msg"])
+	require.Equal(t, "proxy", rec["subsystem"])
+	require.Equal(t, float64(8080), rec["port"])
+	require.Contains(t, lines[1], `"subsystem":"tls"`)
+	require.Contains(t, lines[2], "now visible")
+
+	// 重新加载配置时替换所有级别
+	buf.Reset()
+	l.SetLevels(slog.LevelWarn, map[string]slog.Level{SubsystemStorage: slog.LevelDebug})
+	l.Subsystem(SubsystemProxy).Info("hidden")
+	l.Subsystem(SubsystemTLS).Debug("hidden")
+	l.Subsystem(SubsystemCA).Info("hidden")
+	l.Subsystem(SubsystemStorage).Debug("storage debug")
+	require.Equal(t, 1, strings.Count(buf.String(), "\n"))
+	require.Contains(t, buf.String(), "storage debug")
+}
+
+func TestLogging_Printf(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(Options{Output: &buf, AddSource: true})
+	require.NoError(t, err)
+
+	p := NewPrintf(l.Subsystem(SubsystemProxy))
+	p.Debug("hidden %d", 1)
+	p.Warn("upstream %s slow", "api.example.com")
+	require.Contains(t, buf.String(), `msg="upstream api.example.com slow" subsystem=proxy`)
+	require.Contains(t, buf.String(), "testing.go")
+
+	// 替换输出
+	var other bytes.Buffer
+	l.SetOutput(&other)
+	p.Error("failed")
+	require.Contains(t, other.String(), "msg=failed")
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("warn")
+	require.NoError(t, err)
+	require.Equal(t, slog.LevelWarn, level)
+	_, err = ParseLevel("loud")
+	require.Error(t, err)
+
+	name, level, err := ParseSubsystemLevel("tls=DEBUG")
+	require.NoError(t, err)
+	require.Equal(t, "tls", name)
+	require.Equal(t, slog.LevelDebug, level)
+	_, _, err = ParseSubsystemLevel("debug")
+	require.Error(t, err)
+
+	_, err = New(Options{Format: "xml"})
+	require.Error(t, err)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sniffy.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+
+	read := func(name string) string {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		return string(data)
+	}
+	require.Equal(t, "fourth\n", read(path))
+	require.Equal(t, "third\n", read(path+".1"))
+	require.Equal(t, "second\n", read(path+".2"))
+	require.NoFileExists(t, path+".3")
+
+	// 重新打开时追加并延续已有大小
+	f, err = OpenRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	f.Write([]byte("fifth\n"))
+	require.NoError(t, f.Close())
+	require.Equal(t, "fifth\n", read(path))
+	require.Equal(t, "fourth\n", read(path+".1"))
+}
@@ -0,0 +1,56 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// Printf 将 printf 风格的 types.Logger 调用转发到 slog.Logger
+type Printf struct {
+	logger *slog.Logger
+}
+
+// NewPrintf 创建转发到 logger 的 printf 风格日志器
+func NewPrintf(logger *slog.Logger) *Printf {
+	return &Printf{logger: logger}
+}
+
+// Info 实现 types.Logger 接口
+func (p *Printf) Info(msg string, args ...interface{}) {
+	p.log(slog.LevelInfo, msg, args)
+}
+
+// Error 实现 types.Logger 接口
+func (p *Printf) Error(msg string, args ...interface{}) {
+	p.log(slog.LevelError, msg, args)
+}
+
+// Debug 实现 types.Logger 接口
+func (p *Printf) Debug(msg string, args ...interface{}) {
+	p.log(slog.LevelDebug, msg, args)
+}
+
+// Warn 实现 types.Logger 接口
+func (p *Printf) Warn(msg string, args ...interface{}) {
+	p.log(slog.LevelWarn, msg, args)
+}
+
+// log 级别未启用时不格式化消息，调用位置跳过转发层
+func (p *Printf) log(level slog.Level, msg string, args []interface{}) {
+	ctx := context.Background()
+	if !p.logger.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(4, pcs[:])
+	r := slog.NewRecord(time.Now(), level, fmt.Sprintf(msg, args...), pcs[0])
+	_ = p.logger.Handler().Handle(ctx, r)
+}
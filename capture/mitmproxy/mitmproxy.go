@@ -0,0 +1,249 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package mitmproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Load 读取 mitmproxy 保存的流文件（mitmdump -w 或界面中的 Save）
+func Load(path string) ([]*flow.Flow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open mitmproxy flows: %w", err)
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// Read 解析 mitmproxy 流文件。文件由连续的 tnetstring 字典组成，每个字典是一条流，
+// 只转换HTTP流，TCP、UDP和DNS流被忽略。内容保持文件中的编码，与代理捕获的流一致
+func Read(r io.Reader) ([]*flow.Flow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read mitmproxy flows: %w", err)
+	}
+	var flows []*flow.Flow
+	for i := 0; len(data) > 0; i++ {
+		v, rest, err := parseTNetString(data)
+		if err != nil {
+			return nil, fmt.Errorf("mitmproxy flow %d: %w", i, err)
+		}
+		data = rest
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("mitmproxy flow %d: not a dict", i)
+		}
+		if typ, _ := asString(m["type"]); typ != "" && typ != "http" {
+			continue
+		}
+		f, err := convert(m)
+		if err != nil {
+			return nil, fmt.Errorf("mitmproxy flow %d: %w", i, err)
+		}
+		flows = append(flows, f)
+	}
+	return flows, nil
+}
+
+// convert 将 mitmproxy 的HTTP流转换为流，兼容 mitmproxy 4 以来的格式
+func convert(m map[string]any) (*flow.Flow, error) {
+	req := dict(m["request"])
+	if req == nil {
+		return nil, errors.New("missing request")
+	}
+
+	f := flow.New()
+	if id := str(m["id"]); id != "" {
+		f.ID = id
+	}
+	if start := timestamp(req["timestamp_start"]); !start.IsZero() {
+		f.StartTime = start
+	}
+	f.Request = &flow.Request{
+		Method: str(req["method"]),
+		Proto:  str(req["http_version"]),
+		Header: headers(req["headers"]),
+		Body:   content(req["content"]),
+	}
+	if f.Request.Method == "" {
+		f.Request.Method = http.MethodGet
+	}
+	f.Request.Host, f.Request.URL = requestURL(req, f.Request.Header)
+	f.Request.Header.Del("Host")
+	f.EndTime = timestamp(req["timestamp_end"])
+
+	if resp := dict(m["response"]); resp != nil {
+		code := num(resp["status_code"])
+		reason := str(resp["reason"])
+		if reason == "" {
+			reason = http.StatusText(code)
+		}
+		f.Response = &flow.Response{
+			StatusCode: code,
+			Status:     strconv.Itoa(code) + " " + reason,
+			Proto:      str(resp["http_version"]),
+			Header:     headers(resp["headers"]),
+			Body:       content(resp["content"]),
+		}
+		if end := timestamp(resp["timestamp_end"]); !end.IsZero() {
+			f.EndTime = end
+		}
+	}
+	if e := dict(m["error"]); e != nil {
+		f.Error = str(e["msg"])
+	}
+
+	if client := dict(m["client_conn"]); client != nil {
+		f.ClientAddr = address(client)
+		f.Intercepted = truthy(client["tls_established"])
+	}
+	if server := dict(m["server_conn"]); server != nil {
+		f.ServerAddr = address(server)
+		f.Timings = timings(server, req, dict(m["response"]))
+	}
+	return f, nil
+}
+
+// requestURL 返回请求的 Host 和完整URL。新格式有 authority，旧格式只有 host 和 port
+func requestURL(req map[string]any, header http.Header) (string, string) {
+	scheme := str(req["scheme"])
+	if scheme == "" {
+		scheme = "http"
+	}
+	host := str(req["authority"])
+	if host == "" {
+		host = header.Get("Host")
+	}
+	if host == "" {
+		host = str(req["host"])
+		if port := num(req["port"]); port > 0 && !(scheme == "http" && port == 80) && !(scheme == "https" && port == 443) {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+	}
+	path := str(req["path"])
+	if !strings.HasPrefix(path, "/") {
+		// 绝对形式的请求目标，例如 http://example.com/，或 CONNECT 的 host:port
+		if strings.Contains(path, "://") {
+			return host, path
+		}
+		path = "/" + path
+	}
+	return host, scheme + "://" + host + path
+}
+
+// timings 用服务器连接和请求、响应的时间戳填写各阶段的时间点
+func timings(server, req, resp map[string]any) *flow.Timings {
+	t := &flow.Timings{
+		ConnectStart: timestamp(server["timestamp_start"]),
+		ConnectDone:  timestamp(server["timestamp_tcp_setup"]),
+		TLSDone:      timestamp(server["timestamp_tls_setup"]),
+		RequestSent:  timestamp(req["timestamp_end"]),
+	}
+	if !t.TLSDone.IsZero() {
+		t.TLSStart = t.ConnectDone
+	}
+	if resp != nil {
+		t.FirstByte = timestamp(resp["timestamp_start"])
+		t.ResponseDone = timestamp(resp["timestamp_end"])
+	}
+	if *t == (flow.Timings{}) {
+		return nil
+	}
+	return t
+}
+
+// address 返回连接的对端地址，新格式为 peername，旧格式为 address 或 {"address": ...}
+func address(conn map[string]any) string {
+	v := conn["peername"]
+	if v == nil {
+		v = conn["address"]
+	}
+	if d := dict(v); d != nil {
+		v = d["address"]
+	}
+	list, ok := v.([]any)
+	if !ok || len(list) < 2 {
+		return ""
+	}
+	return net.JoinHostPort(str(list[0]), strconv.Itoa(num(list[1])))
+}
+
+// headers 转换 [[name, value], ...] 形式的头部
+func headers(v any) http.Header {
+	h := http.Header{}
+	list, _ := v.([]any)
+	for _, item := range list {
+		pair, ok := item.([]any)
+		if !ok || len(pair) != 2 {
+			continue
+		}
+		h.Add(str(pair[0]), str(pair[1]))
+	}
+	return h
+}
+
+func content(v any) []byte {
+	b, _ := v.([]byte)
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
+
+func dict(v any) map[string]any {
+	d, _ := v.(map[string]any)
+	return d
+}
+
+func str(v any) string {
+	s, _ := asString(v)
+	return s
+}
+
+func num(v any) int {
+	switch v := v.(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+func truthy(v any) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+// timestamp 转换以秒为单位的浮点时间戳，缺失时返回零值
+func timestamp(v any) time.Time {
+	var sec float64
+	switch v := v.(type) {
+	case float64:
+		sec = v
+	case int64:
+		sec = float64(v)
+	default:
+		return time.Time{}
+	}
+	if sec <= 0 {
+		return time.Time{}
+	}
+	whole, frac := math.Modf(sec)
+	return time.Unix(int64(whole), int64(frac*1e9))
+}
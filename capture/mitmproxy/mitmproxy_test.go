@@ -0,0 +1,186 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package mitmproxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// blob 编码为字节串，普通字符串编码为 unicode 字符串
+type blob string
+
+// tnet 将值编码为 tnetstring
+func tnet(v any) string {
+	var payload string
+	var tag byte
+	switch v := v.(type) {
+	case blob:
+		payload, tag = string(v), ','
+	case string:
+		payload, tag = v, ';'
+	case int:
+		payload, tag = strconv.Itoa(v), '#'
+	case float64:
+		payload, tag = strconv.FormatFloat(v, 'f', -1, 64), '^'
+	case bool:
+		payload, tag = strconv.FormatBool(v), '!'
+	case nil:
+		tag = '~'
+	case []any:
+		var b strings.Builder
+		for _, item := range v {
+			b.WriteString(tnet(item))
+		}
+		payload, tag = b.String(), ']'
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var b strings.Builder
+		for _, k := range keys {
+			b.WriteString(tnet(k) + tnet(v[k]))
+		}
+		payload, tag = b.String(), '}'
+	default:
+		panic(fmt.Sprintf("unsupported type %T", v))
+	}
+	return strconv.Itoa(len(payload)) + ":" + payload + string(tag)
+}
+
+func pair(k, v string) []any {
+	return []any{blob(k), blob(v)}
+}
+
+// modernFlow mitmproxy 10 保存的HTTPS流
+func modernFlow() map[string]any {
+	return map[string]any{
+		"version": 20,
+		"type":    "http",
+		"id":      "4f9ecb8c-0e5b-4b5a-9e8f-7b2b4f8a1c11",
+		"client_conn": map[string]any{
+			"peername":        []any{"127.0.0.1", 53412},
+			"tls_established": true,
+			"sni":             "api.example.com",
+		},
+		"server_conn": map[string]any{
+			"peername":            []any{"93.184.216.34", 443},
+			"timestamp_start":     1700000000.1,
+			"timestamp_tcp_setup": 1700000000.15,
+			"timestamp_tls_setup": 1700000000.2,
+		},
+		"request": map[string]any{
+			"host": "api.example.com", "port": 443, "method": blob("POST"), "scheme": blob("https"),
+			"authority": blob(""), "path": blob("/v1/users?page=2"), "http_version": blob("HTTP/1.1"),
+			"headers":         []any{pair("Host", "api.example.com"), pair("Content-Type", "application/json")},
+			"content":         blob(`{"name":"a"}`),
+			"timestamp_start": 1700000000.0, "timestamp_end": 1700000000.25,
+		},
+		"response": map[string]any{
+			"http_version": blob("HTTP/1.1"), "status_code": 201, "reason": blob("Created"),
+			"headers":         []any{pair("Content-Type", "application/json"), pair("Set-Cookie", "a=1"), pair("Set-Cookie", "b=2")},
+			"content":         blob(`{"id":1}`),
+			"timestamp_start": 1700000000.5, "timestamp_end": 1700000000.75,
+		},
+	}
+}
+
+// --- 测试代码 ---
+func TestParseTNetString(t *testing.T) {
+	v, rest, err := parseTNetString([]byte(tnet(map[string]any{
+		"list": []any{1, 2.5, true, nil, blob("raw"), "text"},
+	}) + "tail"))
+	require.NoError(t, err)
+	require.Equal(t, "tail", string(rest))
+	require.Equal(t, map[string]any{"list": []any{int64(1), 2.5, true, nil, []byte("raw"), "text"}}, v)
+
+	for _, bad := range []string{"", "x:abc,", "5:abc,", "3:abc?", "3:abc#", "4:true~", "5:3:abc}", "-1:,", "99999999999999:x,"} {
+		_, _, err := parseTNetString([]byte(bad))
+		require.Error(t, err, bad)
+	}
+	deep := "0:]"
+	for range maxDepth + 2 {
+		deep = strconv.Itoa(len(deep)) + ":" + deep + "]"
+	}
+	_, _, err = parseTNetString([]byte(deep))
+	require.ErrorContains(t, err, "nested too deeply")
+}
+
+func TestRead_Modern(t *testing.T) {
+	tcp := map[string]any{"type": "tcp", "id": "x", "messages": []any{}}
+	flows, err := Read(strings.NewReader(tnet(modernFlow()) + tnet(tcp)))
+	require.NoError(t, err)
+	require.Len(t, flows, 1)
+
+	f := flows[0]
+	require.Equal(t, "4f9ecb8c-0e5b-4b5a-9e8f-7b2b4f8a1c11", f.ID)
+	require.Equal(t, "POST", f.Request.Method)
+	require.Equal(t, "https://api.example.com/v1/users?page=2", f.Request.URL)
+	require.Equal(t, "api.example.com", f.Request.Host)
+	require.Empty(t, f.Request.Header.Get("Host"))
+	require.Equal(t, `{"name":"a"}`, string(f.Request.Body))
+	require.Equal(t, 201, f.Response.StatusCode)
+	require.Equal(t, "201 Created", f.Response.Status)
+	require.Equal(t, []string{"a=1", "b=2"}, f.Response.Header.Values("Set-Cookie"))
+	require.Equal(t, `{"id":1}`, string(f.Response.Body))
+	require.Equal(t, "127.0.0.1:53412", f.ClientAddr)
+	require.Equal(t, "93.184.216.34:443", f.ServerAddr)
+	require.True(t, f.Intercepted)
+	require.Equal(t, time.Unix(1700000000, 0), f.StartTime)
+	require.Equal(t, 750*time.Millisecond, f.Duration().Round(time.Millisecond))
+	require.Equal(t, 500*time.Millisecond, f.Timings.FirstByte.Sub(f.StartTime).Round(time.Millisecond))
+	require.Equal(t, f.Timings.ConnectDone, f.Timings.TLSStart)
+}
+
+func TestRead_Legacy(t *testing.T) {
+	// mitmproxy 4 的格式：host 为字节串，地址嵌套在 address 中，请求失败时只有 error
+	legacy := map[string]any{
+		"version":     []any{4, 0, 4},
+		"client_conn": map[string]any{"address": map[string]any{"address": []any{"::1", 60000}}},
+		"request": map[string]any{
+			"host": blob("example.com"), "port": 8080, "method": blob("GET"), "scheme": blob("http"),
+			"path": blob("/"), "http_version": blob("HTTP/1.1"), "headers": []any{}, "content": nil,
+			"timestamp_start": 1600000000.0,
+		},
+		"error": map[string]any{"msg": "connection refused"},
+	}
+	flows, err := Read(strings.NewReader(tnet(legacy)))
+	require.NoError(t, err)
+	require.Len(t, flows, 1)
+	f := flows[0]
+	require.NotEmpty(t, f.ID)
+	require.Equal(t, "http://example.com:8080/", f.Request.URL)
+	require.Equal(t, "example.com:8080", f.Request.Host)
+	require.Nil(t, f.Response)
+	require.Equal(t, "connection refused", f.Error)
+	require.Equal(t, "[::1]:60000", f.ClientAddr)
+	require.Nil(t, f.Timings)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flows.mitm")
+	data := tnet(modernFlow())
+	require.NoError(t, os.WriteFile(path, []byte(data+data[:len(data)/2]), 0o600))
+	_, err := Load(path)
+	require.ErrorContains(t, err, "mitmproxy flow 1")
+
+	_, err = Read(strings.NewReader(tnet([]any{1})))
+	require.ErrorContains(t, err, "not a dict")
+	_, err = Read(strings.NewReader(tnet(map[string]any{"type": "http"})))
+	require.ErrorContains(t, err, "missing request")
+}
@@ -0,0 +1,112 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package mitmproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// maxDepth tnetstring 允许的最大嵌套深度
+const maxDepth = 64
+
+// parseTNetString 解析开头的一个 tnetstring 值，返回值和剩余的数据。
+// 值的类型为 []byte (,)、string (;)、int64 (#)、float64 (^)、bool (!)、nil (~)、
+// []any (]) 和 map[string]any (})
+func parseTNetString(data []byte) (any, []byte, error) {
+	return parseValue(data, 0)
+}
+
+func parseValue(data []byte, depth int) (any, []byte, error) {
+	if depth > maxDepth {
+		return nil, nil, errors.New("tnetstring nested too deeply")
+	}
+	colon := bytes.IndexByte(data, ':')
+	if colon <= 0 || colon > 12 {
+		return nil, nil, errors.New("invalid tnetstring length")
+	}
+	n, err := strconv.Atoi(string(data[:colon]))
+	if err != nil || n < 0 || n > len(data)-colon-2 {
+		return nil, nil, fmt.Errorf("invalid tnetstring length %q", data[:colon])
+	}
+	payload, tag, rest := data[colon+1:colon+1+n], data[colon+1+n], data[colon+2+n:]
+
+	switch tag {
+	case ',':
+		return payload, rest, nil
+	case ';':
+		return string(payload), rest, nil
+	case '#':
+		v, err := strconv.ParseInt(string(payload), 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid tnetstring integer %q", payload)
+		}
+		return v, rest, nil
+	case '^':
+		v, err := strconv.ParseFloat(string(payload), 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid tnetstring float %q", payload)
+		}
+		return v, rest, nil
+	case '!':
+		switch string(payload) {
+		case "true":
+			return true, rest, nil
+		case "false":
+			return false, rest, nil
+		}
+		return nil, nil, fmt.Errorf("invalid tnetstring boolean %q", payload)
+	case '~':
+		if n != 0 {
+			return nil, nil, errors.New("invalid tnetstring null")
+		}
+		return nil, rest, nil
+	case ']':
+		var list []any
+		for len(payload) > 0 {
+			var v any
+			if v, payload, err = parseValue(payload, depth+1); err != nil {
+				return nil, nil, err
+			}
+			list = append(list, v)
+		}
+		return list, rest, nil
+	case '}':
+		dict := map[string]any{}
+		for len(payload) > 0 {
+			var k, v any
+			if k, payload, err = parseValue(payload, depth+1); err != nil {
+				return nil, nil, err
+			}
+			if len(payload) == 0 {
+				return nil, nil, errors.New("tnetstring dict key without value")
+			}
+			if v, payload, err = parseValue(payload, depth+1); err != nil {
+				return nil, nil, err
+			}
+			key, ok := asString(k)
+			if !ok {
+				return nil, nil, errors.New("tnetstring dict key is not a string")
+			}
+			dict[key] = v
+		}
+		return dict, rest, nil
+	}
+	return nil, nil, fmt.Errorf("unknown tnetstring type %q", tag)
+}
+
+// asString 将字节串或字符串值转换为字符串
+func asString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,351 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package openapi
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Options 生成文档的选项
+type Options struct {
+	// Title 文档标题，默认使用唯一的主机名或 "Captured API"
+	Title string
+
+	// Version API版本，默认为 "1.0.0"
+	Version string
+}
+
+var (
+	hexPattern    = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	digitsPattern = regexp.MustCompile(`^\d+$`)
+	tokenPattern  = regexp.MustCompile(`^[A-Za-z0-9_-]{20,}$`)
+)
+
+// operation 汇总同一方法和路径模板的流
+type operation struct {
+	method string
+	path   string
+	params []*Parameter
+	count  int
+	query  map[string]*queryParam
+	body   map[string]*Schema
+	bodies int
+	status map[int]map[string]*Schema
+}
+
+type queryParam struct {
+	schema *Schema
+	count  int
+}
+
+// Generate 按主机和路径汇总流，推断路径参数、查询参数以及JSON请求体和响应体的 Schema，
+// 生成 OpenAPI 3 文档。数字、UUID、长十六进制串和长令牌的路径段被视为路径参数，
+// OpenAPI 不支持的方法被忽略
+func Generate(flows []*flow.Flow, opts Options) *Document {
+	ops := map[string]*operation{}
+	var count int
+	servers := map[string]bool{}
+	hosts := map[string]bool{}
+	for _, f := range flows {
+		req := f.Request
+		if req == nil || req.Method == http.MethodConnect {
+			continue
+		}
+		u, err := url.Parse(req.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		count++
+		servers[u.Scheme+"://"+u.Host] = true
+		hosts[u.Hostname()] = true
+
+		path, names, values := template(u.EscapedPath())
+		key := req.Method + " " + path
+		op := ops[key]
+		if op == nil {
+			op = &operation{
+				method: req.Method,
+				path:   path,
+				query:  map[string]*queryParam{},
+				body:   map[string]*Schema{},
+				status: map[int]map[string]*Schema{},
+			}
+			for _, name := range names {
+				op.params = append(op.params, &Parameter{Name: name, In: "path", Required: true})
+			}
+			ops[key] = op
+		}
+		for i, v := range values {
+			op.params[i].Schema = Merge(op.params[i].Schema, InferString(v))
+		}
+		op.add(f, u)
+	}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       opts.Title,
+			Description: fmt.Sprintf("Generated by sniffy from %d captured flows.", count),
+			Version:     cmp.Or(opts.Version, "1.0.0"),
+		},
+		Paths: map[string]*PathItem{},
+	}
+	if doc.Info.Title == "" {
+		doc.Info.Title = "Captured API"
+		if len(hosts) == 1 {
+			doc.Info.Title = slices.Collect(maps.Keys(hosts))[0]
+		}
+	}
+	for _, s := range slices.Sorted(maps.Keys(servers)) {
+		doc.Servers = append(doc.Servers, Server{URL: s})
+	}
+	for _, key := range slices.Sorted(maps.Keys(ops)) {
+		op := ops[key]
+		item := doc.Paths[op.path]
+		if item == nil {
+			item = &PathItem{}
+			doc.Paths[op.path] = item
+		}
+		item.SetOperation(op.method, op.build())
+	}
+	return doc
+}
+
+// add 汇总一个流的请求和响应
+func (op *operation) add(f *flow.Flow, u *url.URL) {
+	op.count++
+	// 同一个流中重复的查询参数只计一次
+	for name, values := range u.Query() {
+		p := op.query[name]
+		if p == nil {
+			p = &queryParam{}
+			op.query[name] = p
+		}
+		p.count++
+		for _, v := range values {
+			p.schema = Merge(p.schema, InferString(v))
+		}
+	}
+
+	req := f.Request
+	if len(req.Body) > 0 || req.BodyFile != "" {
+		op.bodies++
+		mediaType := contentType(req.Header)
+		op.body[mediaType] = Merge(op.body[mediaType], bodySchema(mediaType, req.Header, req.Body, req.Truncated()))
+	}
+
+	resp := f.Response
+	if resp == nil {
+		return
+	}
+	content := op.status[resp.StatusCode]
+	if content == nil {
+		content = map[string]*Schema{}
+		op.status[resp.StatusCode] = content
+	}
+	if len(resp.Body) > 0 || resp.BodyFile != "" {
+		mediaType := contentType(resp.Header)
+		content[mediaType] = Merge(content[mediaType], bodySchema(mediaType, resp.Header, resp.Body, resp.Truncated()))
+	}
+}
+
+// build 生成操作，所有样本中都出现的查询参数是必需的
+func (op *operation) build() *Operation {
+	out := &Operation{
+		OperationID: operationID(op.method, op.path),
+		Parameters:  op.params,
+		Responses:   map[string]*Response{},
+	}
+	for _, name := range slices.Sorted(maps.Keys(op.query)) {
+		p := op.query[name]
+		out.Parameters = append(out.Parameters, &Parameter{Name: name, In: "query", Required: p.count == op.count, Schema: p.schema})
+	}
+	if len(op.body) > 0 {
+		out.RequestBody = &RequestBody{Required: op.bodies == op.count, Content: media(op.body)}
+	}
+	for code, content := range op.status {
+		out.Responses[strconv.Itoa(code)] = &Response{
+			Description: cmp.Or(http.StatusText(code), "Response"),
+			Content:     media(content),
+		}
+	}
+	if len(out.Responses) == 0 {
+		out.Responses["default"] = &Response{Description: "No response captured"}
+	}
+	return out
+}
+
+func media(content map[string]*Schema) map[string]*MediaType {
+	if len(content) == 0 {
+		return nil
+	}
+	out := map[string]*MediaType{}
+	for mediaType, schema := range content {
+		out[mediaType] = &MediaType{Schema: complete(schema)}
+	}
+	return out
+}
+
+// PathTemplate 将路径中像ID的段替换为参数，例如 /users/42/orders 转换为 /users/{userId}/orders
+func PathTemplate(path string) string {
+	t, _, _ := template(path)
+	return t
+}
+
+// template 将路径中像ID的段替换为参数，返回路径模板、参数名和参数值
+func template(path string) (string, []string, []string) {
+	segments := strings.Split(path, "/")
+	var params, values []string
+	for i, seg := range segments {
+		if !isIdentifier(seg) {
+			continue
+		}
+		name := "id"
+		if i > 0 && segments[i-1] != "" && !strings.HasPrefix(segments[i-1], "{") {
+			name = singular(segments[i-1]) + "Id"
+		}
+		for n := 2; slices.Contains(params, name); n++ {
+			name = strings.TrimRight(name, "0123456789") + strconv.Itoa(n)
+		}
+		params = append(params, name)
+		values = append(values, seg)
+		segments[i] = "{" + name + "}"
+	}
+	return strings.Join(segments, "/"), params, values
+}
+
+// isIdentifier 判断路径段是否像资源ID
+func isIdentifier(seg string) bool {
+	switch {
+	case seg == "":
+		return false
+	case digitsPattern.MatchString(seg), uuidPattern.MatchString(seg), hexPattern.MatchString(seg):
+		return true
+	case tokenPattern.MatchString(seg):
+		// 长令牌需要同时包含字母和数字，避免把长单词当作参数
+		return strings.ContainsAny(seg, "0123456789") && strings.IndexFunc(seg, unicode.IsLetter) >= 0
+	}
+	return false
+}
+
+// singular 将集合名转换为参数名前缀，例如 users 转换为 user，categories 转换为 category
+func singular(seg string) string {
+	seg = camel(seg)
+	switch {
+	case strings.HasSuffix(seg, "ies") && len(seg) > 3:
+		return seg[:len(seg)-3] + "y"
+	case strings.HasSuffix(seg, "ss"):
+		return seg
+	case strings.HasSuffix(seg, "s") && len(seg) > 1:
+		return seg[:len(seg)-1]
+	}
+	return seg
+}
+
+// camel 将 user-profiles、user_profiles 转换为 userProfiles，忽略其他符号
+func camel(s string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range s {
+		switch {
+		case r == '-' || r == '_' || r == '.':
+			upper = b.Len() > 0
+		case unicode.IsLetter(r) || unicode.IsDigit(r) && b.Len() > 0:
+			if upper {
+				r = unicode.ToUpper(r)
+			}
+			b.WriteRune(r)
+			upper = false
+		}
+	}
+	if b.Len() == 0 {
+		return "resource"
+	}
+	return b.String()
+}
+
+// operationID 由方法和路径生成操作ID，例如 GET /users/{userId} 生成 getUsersUserId
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, seg := range strings.Split(path, "/") {
+		seg = camel(strings.Trim(seg, "{}"))
+		if seg == "resource" {
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(seg)
+		id += string(unicode.ToUpper(r)) + seg[size:]
+	}
+	return id
+}
+
+// contentType 返回不带参数的媒体类型
+func contentType(header http.Header) string {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// isJSON 判断媒体类型是否为JSON，包括 application/problem+json 等结构化后缀
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// bodySchema 推断内容的 Schema，JSON以外的内容和被截断的JSON只记录类型
+func bodySchema(mediaType string, header http.Header, body []byte, truncated bool) *Schema {
+	switch {
+	case isJSON(mediaType) && !truncated:
+		decoded, _, err := flow.DecodeBody(header, body)
+		if err != nil {
+			return &Schema{}
+		}
+		dec := json.NewDecoder(bytes.NewReader(decoded))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return &Schema{}
+		}
+		return Infer(v)
+	case isJSON(mediaType):
+		return &Schema{}
+	case mediaType == "application/x-www-form-urlencoded" && !truncated:
+		decoded, _, err := flow.DecodeBody(header, body)
+		if err != nil {
+			return &Schema{Type: "object"}
+		}
+		values, err := url.ParseQuery(string(decoded))
+		if err != nil {
+			return &Schema{Type: "object"}
+		}
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for name, vs := range values {
+			for _, v := range vs {
+				s.Properties[name] = Merge(s.Properties[name], InferString(v))
+			}
+		}
+		s.Required = slices.Sorted(maps.Keys(values))
+		return s
+	case strings.HasPrefix(mediaType, "text/"):
+		return &Schema{Type: "string"}
+	}
+	return &Schema{Type: "string", Format: "binary"}
+}
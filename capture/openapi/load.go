@@ -0,0 +1,86 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load 读取JSON或YAML格式的 OpenAPI 3 文档
+func Load(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("open openapi spec: %w", err)
+	}
+	return parse(data)
+}
+
+// Read 解析JSON或YAML格式的 OpenAPI 3 文档，不支持 Swagger 2.0
+func Read(r io.Reader) (*Document, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read openapi spec: %w", err)
+	}
+	return parse(data)
+}
+
+func parse(data []byte) (*Document, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		// YAML先解码为通用的值再转换为JSON，与JSON文档使用同样的解析
+		var v any
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("parse openapi spec: %w", err)
+		}
+		var err error
+		if data, err = json.Marshal(stringKeys(v)); err != nil {
+			return nil, fmt.Errorf("parse openapi spec: %w", err)
+		}
+	}
+	var doc struct {
+		Document
+		Swagger string `json:"swagger"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse openapi spec: %w", err)
+	}
+	switch {
+	case doc.Swagger != "":
+		return nil, errors.New("swagger 2.0 specs are not supported, convert the spec to OpenAPI 3")
+	case !strings.HasPrefix(doc.OpenAPI, "3."):
+		return nil, fmt.Errorf("unsupported openapi version %q", doc.OpenAPI)
+	}
+	return &doc.Document, nil
+}
+
+// stringKeys 将YAML中的非字符串键（例如没有引号的状态码 200）转换为字符串
+func stringKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = stringKeys(item)
+		}
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = stringKeys(item)
+		}
+		return m
+	case []any:
+		for i, item := range v {
+			v[i] = stringKeys(item)
+		}
+	}
+	return v
+}
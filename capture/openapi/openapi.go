@@ -0,0 +1,210 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Version 生成的文档使用的 OpenAPI 版本
+const Version = "3.0.3"
+
+// Document OpenAPI 3 文档中 sniffy 使用的部分
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+}
+
+// Components 可以通过 $ref 引用的定义
+type Components struct {
+	Schemas       map[string]*Schema      `json:"schemas,omitempty"`
+	Parameters    map[string]*Parameter   `json:"parameters,omitempty"`
+	RequestBodies map[string]*RequestBody `json:"requestBodies,omitempty"`
+	Responses     map[string]*Response    `json:"responses,omitempty"`
+}
+
+// Info 文档的标题和版本
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server API的基础URL
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem 一个路径模板上的操作
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters,omitempty"`
+	Get        *Operation   `json:"get,omitempty"`
+	Put        *Operation   `json:"put,omitempty"`
+	Post       *Operation   `json:"post,omitempty"`
+	Delete     *Operation   `json:"delete,omitempty"`
+	Options    *Operation   `json:"options,omitempty"`
+	Head       *Operation   `json:"head,omitempty"`
+	Patch      *Operation   `json:"patch,omitempty"`
+	Trace      *Operation   `json:"trace,omitempty"`
+}
+
+// Operation 返回方法对应的操作，不支持的方法返回nil
+func (p *PathItem) Operation(method string) *Operation {
+	if op := p.slot(method); op != nil {
+		return *op
+	}
+	return nil
+}
+
+// SetOperation 设置方法对应的操作，不支持的方法被忽略
+func (p *PathItem) SetOperation(method string, op *Operation) {
+	if slot := p.slot(method); slot != nil {
+		*slot = op
+	}
+}
+
+func (p *PathItem) slot(method string) **Operation {
+	switch strings.ToUpper(method) {
+	case "GET":
+		return &p.Get
+	case "PUT":
+		return &p.Put
+	case "POST":
+		return &p.Post
+	case "DELETE":
+		return &p.Delete
+	case "OPTIONS":
+		return &p.Options
+	case "HEAD":
+		return &p.Head
+	case "PATCH":
+		return &p.Patch
+	case "TRACE":
+		return &p.Trace
+	}
+	return nil
+}
+
+// Operation 一个方法和路径上的请求和响应
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter 路径、查询、头部或Cookie参数
+type Parameter struct {
+	Ref      string  `json:"$ref,omitempty"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody 请求体，按媒体类型区分内容
+type RequestBody struct {
+	Ref      string                `json:"$ref,omitempty"`
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response 一个状态码的响应
+type Response struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType 一种媒体类型的内容
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Schema JSON Schema 中 OpenAPI 3.0 使用的子集，空的 Schema 接受任何值。
+// 读取 OpenAPI 3.1 文档时，类型数组中的 "null" 转换为 Nullable
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Additional        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+}
+
+// UnmarshalJSON 解析 Schema，兼容 OpenAPI 3.1 的类型数组
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type plain Schema
+	var raw struct {
+		*plain
+		Type json.RawMessage `json:"type"`
+	}
+	raw.plain = (*plain)(s)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw.Type) == 0 || bytes.Equal(raw.Type, []byte("null")) {
+		return nil
+	}
+	if raw.Type[0] == '"' {
+		return json.Unmarshal(raw.Type, &s.Type)
+	}
+	var types []string
+	if err := json.Unmarshal(raw.Type, &types); err != nil {
+		return err
+	}
+	// 多个非 null 类型无法用单个类型表示，视为任意类型
+	var other []string
+	for _, t := range types {
+		if t == "null" {
+			s.Nullable = true
+		} else {
+			other = append(other, t)
+		}
+	}
+	if len(other) == 1 {
+		s.Type = other[0]
+	}
+	return nil
+}
+
+// Additional additionalProperties，可以是布尔值或 Schema
+type Additional struct {
+	// Allowed 是否允许未声明的属性，Schema 不为nil时总是允许
+	Allowed bool
+
+	// Schema 未声明的属性需要满足的 Schema
+	Schema *Schema
+}
+
+// UnmarshalJSON 解析布尔值或 Schema
+func (a *Additional) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+// MarshalJSON 输出布尔值或 Schema
+func (a Additional) MarshalJSON() ([]byte, error) {
+	if a.Schema != nil {
+		return json.Marshal(a.Schema)
+	}
+	return json.Marshal(a.Allowed)
+}
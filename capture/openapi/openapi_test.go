@@ -0,0 +1,292 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func newFlow(method, rawURL, reqBody string, status int, respBody string) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{Method: method, URL: rawURL, Header: http.Header{}}
+	if reqBody != "" {
+		f.Request.Header.Set("Content-Type", "application/json; charset=utf-8")
+		f.Request.Body = []byte(reqBody)
+	}
+	f.Response = &flow.Response{StatusCode: status, Header: http.Header{}}
+	if respBody != "" {
+		f.Response.Header.Set("Content-Type", "application/json")
+		f.Response.Body = []byte(respBody)
+	}
+	return f
+}
+
+func schemaJSON(t *testing.T, s *Schema) string {
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// --- 测试代码 ---
+func TestInferMerge(t *testing.T) {
+	a := Infer(map[string]any{"id": json.Number("1"), "name": "a", "tags": []any{"x"}, "at": "2025-01-02T03:04:05Z"})
+	b := Infer(map[string]any{"id": json.Number("1.5"), "tags": []any{}, "deleted": nil, "at": "2025-01-02T03:04:05Z"})
+	require.Equal(t, `{"type":"object","properties":{"at":{"type":"string","format":"date-time"},"deleted":{"nullable":true},`+
+		`"id":{"type":"number"},"name":{"type":"string"},"tags":{"type":"array","items":{"type":"string"}}},"required":["at","id","tags"]}`,
+		schemaJSON(t, Merge(a, b)))
+
+	// null 只影响 nullable，不同的类型合并为任意值
+	require.Equal(t, `{"type":"string","nullable":true}`, schemaJSON(t, Merge(Infer(nil), Infer("x"))))
+	require.Equal(t, `{}`, schemaJSON(t, Merge(Infer(true), Infer("x"))))
+	require.Equal(t, `{"type":"array","items":{}}`, schemaJSON(t, complete(Infer([]any{}))))
+
+	require.Equal(t, "integer", InferString("42").Type)
+	require.Equal(t, "number", InferString("4.2").Type)
+	require.Equal(t, "boolean", InferString("true").Type)
+	require.Equal(t, "string", InferString("NaN").Type)
+	require.Equal(t, "uuid", InferString("123e4567-e89b-12d3-a456-426614174000").Format)
+}
+
+func TestTemplate(t *testing.T) {
+	for path, want := range map[string]string{
+		"/users/42":         "/users/{userId}",
+		"/users/42/posts/7": "/users/{userId}/posts/{postId}",
+		"/categories/123e4567-e89b-12d3-a456-426614174000": "/categories/{categoryId}",
+		"/a/1/2":                      "/a/{aId}/{id}",
+		"/blobs/0123456789abcdef0123": "/blobs/{blobId}",
+		"/static/application.js":      "/static/application.js",
+		"/docs/internationalization":  "/docs/internationalization",
+		"/":                           "/",
+	} {
+		got, _, _ := template(path)
+		require.Equal(t, want, got, path)
+	}
+	_, names, values := template("/x/1/2")
+	require.Equal(t, []string{"xId", "id"}, names)
+	require.Equal(t, []string{"1", "2"}, values)
+	require.Equal(t, "getUsersUserIdPostsPostId", operationID("GET", "/users/{userId}/posts/{postId}"))
+}
+
+func TestGenerate(t *testing.T) {
+	flows := []*flow.Flow{
+		newFlow("GET", "https://api.example.com/users/1?verbose=true&page=1", "", 200, `{"id":1,"name":"a","email":"a@example.com"}`),
+		newFlow("GET", "https://api.example.com/users/2?verbose=false", "", 200, `{"id":2,"name":"b"}`),
+		newFlow("GET", "https://api.example.com/users/3", "", 404, `{"error":"not found"}`),
+		newFlow("POST", "https://api.example.com/users", `{"name":"c"}`, 201, `{"id":3,"name":"c"}`),
+		newFlow("CONNECT", "api.example.com:443", "", 200, ""),
+	}
+	doc := Generate(flows, Options{})
+	require.Equal(t, Version, doc.OpenAPI)
+	require.Equal(t, "api.example.com", doc.Info.Title)
+	require.Equal(t, "1.0.0", doc.Info.Version)
+	require.Equal(t, []Server{{URL: "https://api.example.com"}}, doc.Servers)
+	require.Len(t, doc.Paths, 2)
+
+	get := doc.Paths["/users/{userId}"].Get
+	require.NotNil(t, get)
+	require.Equal(t, "getUsersUserId", get.OperationID)
+	require.Len(t, get.Parameters, 3)
+	require.Equal(t, &Parameter{Name: "userId", In: "path", Required: true, Schema: &Schema{Type: "integer"}}, get.Parameters[0])
+	require.Equal(t, &Parameter{Name: "page", In: "query", Schema: &Schema{Type: "integer"}}, get.Parameters[1])
+	require.Equal(t, "verbose", get.Parameters[2].Name)
+	require.False(t, get.Parameters[2].Required)
+	require.Nil(t, get.RequestBody)
+
+	ok := get.Responses["200"].Content["application/json"].Schema
+	require.Equal(t, []string{"id", "name"}, ok.Required)
+	require.Contains(t, ok.Properties, "email")
+	require.Equal(t, "Not Found", get.Responses["404"].Description)
+
+	post := doc.Paths["/users"].Post
+	require.True(t, post.RequestBody.Required)
+	require.Equal(t, `{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}`,
+		schemaJSON(t, post.RequestBody.Content["application/json"].Schema))
+	require.Contains(t, post.Responses, "201")
+
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(data), `{"openapi":"3.0.3","info":{"title":"api.example.com","description":"Generated by sniffy from 4 captured flows."`))
+
+	// 多个主机时使用默认标题，截断的JSON和非JSON内容只记录类型
+	f := newFlow("PUT", "http://other.example.com/upload", "", 204, "")
+	f.Request.Header.Set("Content-Type", "image/png")
+	f.Request.Body = []byte{0x89, 'P'}
+	g := newFlow("GET", "http://other.example.com/feed", "", 200, `{"items":[`)
+	g.Response.BodySize = 1000
+	doc = Generate(append(flows, f, g), Options{Title: "Mixed", Version: "2"})
+	require.Equal(t, "Mixed", doc.Info.Title)
+	require.Len(t, doc.Servers, 2)
+	require.Equal(t, &Schema{Type: "string", Format: "binary"}, doc.Paths["/upload"].Put.RequestBody.Content["image/png"].Schema)
+	require.Nil(t, doc.Paths["/upload"].Put.Responses["204"].Content)
+	require.Equal(t, &Schema{}, doc.Paths["/feed"].Get.Responses["200"].Content["application/json"].Schema)
+}
+
+const petSpec = `
+openapi: 3.0.3
+info: {title: Pets, version: "1"}
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /pets:
+    get:
+      parameters:
+        - {name: limit, in: query, schema: {type: integer}}
+        - $ref: '#/components/parameters/Trace'
+      responses:
+        200:
+          description: OK
+          content:
+            application/json:
+              schema:
+                type: array
+                items: {$ref: '#/components/schemas/Pet'}
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/NewPet'}
+      responses:
+        201: {description: Created}
+        4XX: {$ref: '#/components/responses/Error'}
+  /pets/{petId}:
+    parameters:
+      - {name: petId, in: path, required: true, schema: {type: integer}}
+    get:
+      responses:
+        200:
+          description: OK
+          content:
+            application/json:
+              schema: {$ref: '#/components/schemas/Pet'}
+  /pets/mine:
+    get:
+      responses:
+        default: {description: Any}
+components:
+  parameters:
+    Trace: {name: X-Trace, in: header, required: true, schema: {type: string}}
+  responses:
+    Error:
+      description: Error
+      content:
+        application/json:
+          schema:
+            type: object
+            properties: {message: {type: string}}
+            additionalProperties: true
+  schemas:
+    NewPet:
+      type: object
+      required: [name]
+      properties:
+        name: {type: string}
+        tag: {type: [string, "null"]}
+        kind: {type: string, enum: [cat, dog]}
+    Pet:
+      allOf:
+        - $ref: '#/components/schemas/NewPet'
+        - type: object
+          required: [id]
+          properties:
+            id: {type: integer}
+            born: {type: string, format: date}
+`
+
+func kinds(vs []*flow.Violation) []string {
+	var out []string
+	for _, v := range vs {
+		out = append(out, v.Kind+" "+v.Location)
+	}
+	return out
+}
+
+func TestLoad(t *testing.T) {
+	doc, err := Read(strings.NewReader(petSpec))
+	require.NoError(t, err)
+	require.Equal(t, "Pets", doc.Info.Title)
+	require.Contains(t, doc.Paths["/pets"].Post.Responses, "201")
+	tag := doc.Components.Schemas["NewPet"].Properties["tag"]
+	require.Equal(t, "string", tag.Type)
+	require.True(t, tag.Nullable)
+	require.True(t, doc.Components.Responses["Error"].Content["application/json"].Schema.AdditionalProperties.Allowed)
+
+	// 生成的文档可以重新读取
+	data, err := json.Marshal(Generate([]*flow.Flow{newFlow("GET", "https://x/a", "", 200, `{"a":1}`)}, Options{}))
+	require.NoError(t, err)
+	_, err = Read(strings.NewReader(string(data)))
+	require.NoError(t, err)
+
+	_, err = Read(strings.NewReader(`{"swagger":"2.0"}`))
+	require.ErrorContains(t, err, "swagger 2.0")
+	_, err = Read(strings.NewReader(`openapi: 4.0.0`))
+	require.ErrorContains(t, err, "unsupported openapi version")
+	_, err = Load("/nonexistent.yaml")
+	require.Error(t, err)
+}
+
+func TestValidator(t *testing.T) {
+	doc, err := Read(strings.NewReader(petSpec))
+	require.NoError(t, err)
+	v, err := NewValidator(doc)
+	require.NoError(t, err)
+
+	check := func(f *flow.Flow) []string {
+		return kinds(v.Validate(f))
+	}
+	list := newFlow("GET", "https://api.example.com/v1/pets?limit=10", "", 200,
+		`[{"id":1,"name":"a","tag":null,"born":"2020-01-02"},{"id":2,"name":"b","kind":"dog"}]`)
+	list.Request.Header.Set("X-Trace", "t")
+	require.Empty(t, check(list))
+
+	bad := newFlow("GET", "https://api.example.com/v1/pets?limit=ten&debug=1", "", 200,
+		`[{"id":"1","name":"a","color":"red","kind":"cow","born":"yesterday"},{"name":null}]`)
+	require.Equal(t, []string{
+		"missing-parameter request.header.X-Trace",
+		"type-mismatch request.query.limit",
+		"unknown-parameter request.query.debug",
+		"invalid-value response.body[0].kind",
+		"invalid-value response.body[0].born",
+		"type-mismatch response.body[0].id",
+		"unknown-field response.body[0].color",
+		"type-mismatch response.body[1].name",
+		"missing-field response.body[1].id",
+	}, check(bad))
+
+	require.Empty(t, check(newFlow("GET", "https://api.example.com/v1/pets/7", "", 200, `{"id":7,"name":"x"}`)))
+	// 具体路径优先于模板
+	require.Empty(t, check(newFlow("GET", "https://api.example.com/v1/pets/mine", "", 500, "")))
+	require.Equal(t, []string{"type-mismatch request.path.petId"}, check(newFlow("GET", "https://api.example.com/v1/pets/abc", "", 200, "")))
+
+	require.Equal(t, []string{"missing-body request.body"}, check(newFlow("POST", "https://api.example.com/v1/pets", "", 201, "")))
+	require.Empty(t, check(newFlow("POST", "https://api.example.com/v1/pets", `{"name":"x"}`, 400, `{"message":"bad","code":1}`)))
+	require.Equal(t, []string{"undocumented-status response.status"}, check(newFlow("POST", "https://api.example.com/v1/pets", `{"name":"x"}`, 500, "")))
+	form := newFlow("POST", "https://api.example.com/v1/pets", "", 201, "")
+	form.Request.Header.Set("Content-Type", "text/plain")
+	form.Request.Body = []byte("x")
+	require.Equal(t, []string{"undocumented-content-type request.content_type"}, check(form))
+	require.Equal(t, []string{"invalid-body request.body"}, check(newFlow("POST", "https://api.example.com/v1/pets", `{`, 201, "")))
+
+	require.Equal(t, []string{"undocumented-method request.method"}, check(newFlow("DELETE", "https://api.example.com/v1/pets", "", 204, "")))
+	require.Equal(t, []string{"undocumented-path request.path"}, check(newFlow("GET", "https://api.example.com/v1/owners", "", 200, "")))
+	// 文档范围以外的主机不检查
+	require.Nil(t, check(newFlow("GET", "https://cdn.example.com/x", "", 200, "")))
+
+	bad.Tags = nil
+	v.Apply(bad)
+	require.Len(t, bad.Violations, 9)
+	require.Equal(t, []string{ViolationTag}, bad.Tags)
+	var nilValidator *Validator
+	nilValidator.Apply(list)
+	require.Empty(t, list.Violations)
+}
@@ -0,0 +1,175 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package openapi
+
+import (
+	"encoding/json"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDepth 推断 Schema 时的最大嵌套深度，更深的值使用空的 Schema
+const maxDepth = 32
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Infer 推断JSON值的 Schema，对象的所有属性都是必需的，值为 json.Decoder.UseNumber 的解码结果
+func Infer(v any) *Schema {
+	return infer(v, 0)
+}
+
+func infer(v any, depth int) *Schema {
+	if depth > maxDepth {
+		return &Schema{}
+	}
+	switch v := v.(type) {
+	case nil:
+		return &Schema{Nullable: true}
+	case bool:
+		return &Schema{Type: "boolean"}
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return &Schema{Type: "integer"}
+		}
+		return &Schema{Type: "number"}
+	case float64:
+		if v == float64(int64(v)) {
+			return &Schema{Type: "integer"}
+		}
+		return &Schema{Type: "number"}
+	case string:
+		return &Schema{Type: "string", Format: stringFormat(v)}
+	case []any:
+		// 空数组的元素类型未知，由其他样本决定
+		var items *Schema
+		for _, item := range v {
+			items = Merge(items, infer(item, depth+1))
+		}
+		return &Schema{Type: "array", Items: items}
+	case map[string]any:
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for k, item := range v {
+			s.Properties[k] = infer(item, depth+1)
+		}
+		s.Required = slices.Sorted(maps.Keys(v))
+		return s
+	}
+	return &Schema{}
+}
+
+// InferString 推断查询参数等文本值的 Schema
+func InferString(v string) *Schema {
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return &Schema{Type: "integer"}
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil && !strings.ContainsAny(v, "xXnN") {
+		return &Schema{Type: "number"}
+	}
+	if v == "true" || v == "false" {
+		return &Schema{Type: "boolean"}
+	}
+	return &Schema{Type: "string", Format: stringFormat(v)}
+}
+
+func stringFormat(v string) string {
+	switch {
+	case uuidPattern.MatchString(v):
+		return "uuid"
+	case len(v) >= 20 && isTime(v):
+		return "date-time"
+	case len(v) == 10 && isDate(v):
+		return "date"
+	}
+	return ""
+}
+
+func isTime(v string) bool {
+	_, err := time.Parse(time.RFC3339Nano, v)
+	return err == nil
+}
+
+func isDate(v string) bool {
+	_, err := time.Parse(time.DateOnly, v)
+	return err == nil
+}
+
+// Merge 合并两个样本的 Schema，结果接受两者都接受的值。
+// 只在部分样本中出现的属性不再是必需的，整数和小数合并为 number，其他不同的类型合并为空的 Schema
+func Merge(a, b *Schema) *Schema {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	out := &Schema{Nullable: a.Nullable || b.Nullable}
+	switch {
+	case a.Type == "" && a.Nullable && isEmpty(a):
+		// null 样本只影响 nullable
+		t := *b
+		t.Nullable = true
+		return &t
+	case b.Type == "" && b.Nullable && isEmpty(b):
+		t := *a
+		t.Nullable = true
+		return &t
+	case a.Type == b.Type:
+		out.Type = a.Type
+	case isNumeric(a.Type) && isNumeric(b.Type):
+		out.Type = "number"
+		return out
+	default:
+		return out
+	}
+	if a.Format == b.Format {
+		out.Format = a.Format
+	}
+	switch out.Type {
+	case "array":
+		out.Items = Merge(a.Items, b.Items)
+	case "object":
+		out.Properties = maps.Clone(a.Properties)
+		if out.Properties == nil {
+			out.Properties = map[string]*Schema{}
+		}
+		for k, s := range b.Properties {
+			out.Properties[k] = Merge(out.Properties[k], s)
+		}
+		for _, k := range a.Required {
+			if slices.Contains(b.Required, k) {
+				out.Required = append(out.Required, k)
+			}
+		}
+	}
+	return out
+}
+
+// complete 为元素类型未知的数组补充空的 Schema，OpenAPI 要求数组声明 items
+func complete(s *Schema) *Schema {
+	if s == nil {
+		return nil
+	}
+	if s.Type == "array" && s.Items == nil {
+		s.Items = &Schema{}
+	}
+	complete(s.Items)
+	for _, p := range s.Properties {
+		complete(p)
+	}
+	return s
+}
+
+func isNumeric(t string) bool {
+	return t == "integer" || t == "number"
+}
+
+func isEmpty(s *Schema) bool {
+	return s.Format == "" && s.Properties == nil && s.Items == nil && s.Required == nil
+}
@@ -0,0 +1,579 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package openapi
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// 问题类型
+const (
+	KindUndocumentedPath        = "undocumented-path"
+	KindUndocumentedMethod      = "undocumented-method"
+	KindUndocumentedStatus      = "undocumented-status"
+	KindUndocumentedContentType = "undocumented-content-type"
+	KindMissingParameter        = "missing-parameter"
+	KindUnknownParameter        = "unknown-parameter"
+	KindMissingBody             = "missing-body"
+	KindInvalidBody             = "invalid-body"
+	KindMissingField            = "missing-field"
+	KindUnknownField            = "unknown-field"
+	KindTypeMismatch            = "type-mismatch"
+	KindInvalidValue            = "invalid-value"
+	KindUnresolvedRef           = "unresolved-ref"
+)
+
+// ViolationTag 存在问题的流添加的标签
+const ViolationTag = "openapi-violation"
+
+// maxViolations 每个流最多记录的问题数量
+const maxViolations = 50
+
+var paramPattern = regexp.MustCompile(`\{[^{}/]+\}`)
+
+// Validator 检查流是否符合 OpenAPI 文档。
+// 文档的 servers 声明了主机时只检查这些主机的流，路径去掉 servers 中的基础路径后与路径模板匹配
+type Validator struct {
+	doc    *Document
+	hosts  map[string]bool
+	bases  []string
+	routes []*route
+}
+
+type route struct {
+	template string
+	pattern  *regexp.Regexp
+	params   []string
+	literal  int
+	item     *PathItem
+}
+
+// NewValidator 创建检查流的校验器
+func NewValidator(doc *Document) (*Validator, error) {
+	v := &Validator{doc: doc, hosts: map[string]bool{}}
+	anyHost := false
+	for _, s := range doc.Servers {
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server url %q: %w", s.URL, err)
+		}
+		// 相对URL和含变量的主机无法确定主机，不限制主机
+		if u.Host == "" || strings.Contains(u.Host, "{") {
+			anyHost = true
+		} else {
+			v.hosts[strings.ToLower(u.Hostname())] = true
+		}
+		if base := strings.TrimRight(u.Path, "/"); base != "" && !strings.Contains(base, "{") && !slices.Contains(v.bases, base) {
+			v.bases = append(v.bases, base)
+		}
+	}
+	if anyHost {
+		v.hosts = nil
+	}
+	// 更长的基础路径优先
+	slices.SortFunc(v.bases, func(a, b string) int { return len(b) - len(a) })
+
+	for template, item := range doc.Paths {
+		if item == nil {
+			continue
+		}
+		r := &route{template: template, item: item}
+		var expr strings.Builder
+		expr.WriteString("^")
+		last := 0
+		for _, loc := range paramPattern.FindAllStringIndex(template, -1) {
+			expr.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+			expr.WriteString("([^/]+)")
+			r.params = append(r.params, template[loc[0]+1:loc[1]-1])
+			r.literal += loc[0] - last
+			last = loc[1]
+		}
+		expr.WriteString(regexp.QuoteMeta(template[last:]))
+		expr.WriteString("/?$")
+		r.literal += len(template) - last
+		pattern, err := regexp.Compile(expr.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid path template %q: %w", template, err)
+		}
+		r.pattern = pattern
+		v.routes = append(v.routes, r)
+	}
+	// 具体的路径优先于模板，例如 /users/me 优先于 /users/{id}
+	slices.SortFunc(v.routes, func(a, b *route) int {
+		if len(a.params) != len(b.params) {
+			return len(a.params) - len(b.params)
+		}
+		if a.literal != b.literal {
+			return b.literal - a.literal
+		}
+		return strings.Compare(a.template, b.template)
+	})
+	return v, nil
+}
+
+// LoadValidator 读取 OpenAPI 文档并创建校验器
+func LoadValidator(path string) (*Validator, error) {
+	doc, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewValidator(doc)
+}
+
+// Apply 检查流并将问题保存到 Flow.Violations，存在问题时添加 ViolationTag 标签。
+// 校验器为nil时不做任何处理
+func (v *Validator) Apply(f *flow.Flow) {
+	if v == nil {
+		return
+	}
+	if f.Violations = v.Validate(f); len(f.Violations) > 0 {
+		f.Tag(ViolationTag)
+	}
+}
+
+// Validate 返回流与文档不符之处，不在文档范围内的主机返回nil
+func (v *Validator) Validate(f *flow.Flow) []*flow.Violation {
+	req := f.Request
+	if req == nil || req.Method == http.MethodConnect {
+		return nil
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil
+	}
+	if len(v.hosts) > 0 && !v.hosts[strings.ToLower(u.Hostname())] {
+		return nil
+	}
+	c := &checker{doc: v.doc}
+	path := u.EscapedPath()
+	for _, base := range v.bases {
+		if rest, ok := strings.CutPrefix(path, base); ok && (rest == "" || rest[0] == '/') {
+			path = cmp.Or(rest, "/")
+			break
+		}
+	}
+
+	r, values := v.match(path)
+	if r == nil {
+		c.add(KindUndocumentedPath, "request.path", "path %s is not documented", path)
+		return c.out
+	}
+	op := r.item.Operation(req.Method)
+	if op == nil {
+		c.add(KindUndocumentedMethod, "request.method", "method %s is not documented for %s", req.Method, r.template)
+		return c.out
+	}
+	c.parameters(r, op, values, req, u.Query())
+	c.requestBody(op, req)
+	if f.Response != nil {
+		c.response(op, f.Response)
+	}
+	return c.out
+}
+
+// match 返回与路径匹配的路由和路径参数的值
+func (v *Validator) match(path string) (*route, map[string]string) {
+	for _, r := range v.routes {
+		m := r.pattern.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		values := map[string]string{}
+		for i, name := range r.params {
+			values[name], _ = url.PathUnescape(m[i+1])
+		}
+		return r, values
+	}
+	return nil, nil
+}
+
+// checker 收集一个流的问题
+type checker struct {
+	doc *Document
+	out []*flow.Violation
+}
+
+func (c *checker) add(kind, location, format string, args ...any) {
+	if len(c.out) < maxViolations {
+		c.out = append(c.out, &flow.Violation{Kind: kind, Location: location, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// parameters 检查路径参数、查询参数和头部，操作上的参数覆盖路径上同名的参数
+func (c *checker) parameters(r *route, op *Operation, values map[string]string, req *flow.Request, query url.Values) {
+	params := map[string]*Parameter{}
+	for _, list := range [][]*Parameter{r.item.Parameters, op.Parameters} {
+		for _, p := range list {
+			if p = c.parameter(p); p != nil {
+				params[p.In+":"+p.Name] = p
+			}
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		p := params[key]
+		location := "request." + p.In + "." + p.Name
+		var value string
+		var present bool
+		switch p.In {
+		case "path":
+			value, present = values[p.Name]
+		case "query":
+			present = query.Has(p.Name)
+			value = query.Get(p.Name)
+		case "header":
+			present = len(req.Header.Values(p.Name)) > 0
+			value = req.Header.Get(p.Name)
+		default:
+			continue
+		}
+		if !present {
+			if p.Required {
+				c.add(KindMissingParameter, location, "required %s parameter %s is missing", p.In, p.Name)
+			}
+			continue
+		}
+		c.text(value, p.Schema, location)
+	}
+	for _, name := range slices.Sorted(maps.Keys(query)) {
+		if params["query:"+name] == nil {
+			c.add(KindUnknownParameter, "request.query."+name, "query parameter %s is not documented", name)
+		}
+	}
+}
+
+// requestBody 检查请求体
+func (c *checker) requestBody(op *Operation, req *flow.Request) {
+	body := c.requestBodyRef(op.RequestBody)
+	hasBody := len(req.Body) > 0 || req.BodyFile != ""
+	switch {
+	case body == nil:
+		return
+	case !hasBody:
+		if body.Required {
+			c.add(KindMissingBody, "request.body", "required request body is missing")
+		}
+		return
+	}
+	c.content(body.Content, req.Header, req.Body, req.Truncated(), "request")
+}
+
+// response 检查状态码和响应体
+func (c *checker) response(op *Operation, resp *flow.Response) {
+	code := strconv.Itoa(resp.StatusCode)
+	r := op.Responses[code]
+	if r == nil && len(code) == 3 {
+		r = op.Responses[code[:1]+"XX"]
+		if r == nil {
+			r = op.Responses[code[:1]+"xx"]
+		}
+	}
+	if r == nil {
+		r = op.Responses["default"]
+	}
+	if r == nil {
+		c.add(KindUndocumentedStatus, "response.status", "status %d is not documented", resp.StatusCode)
+		return
+	}
+	if r = c.responseRef(r); r == nil || len(r.Content) == 0 {
+		return
+	}
+	if len(resp.Body) == 0 && resp.BodyFile == "" {
+		return
+	}
+	c.content(r.Content, resp.Header, resp.Body, resp.Truncated(), "response")
+}
+
+// content 按媒体类型检查内容，只检查未截断的JSON内容
+func (c *checker) content(content map[string]*MediaType, header http.Header, body []byte, truncated bool, part string) {
+	if len(content) == 0 {
+		return
+	}
+	mediaType := contentType(header)
+	mt, ok := content[mediaType]
+	if !ok {
+		major, _, _ := strings.Cut(mediaType, "/")
+		if mt, ok = content[major+"/*"]; !ok {
+			mt, ok = content["*/*"]
+		}
+	}
+	if !ok {
+		c.add(KindUndocumentedContentType, part+".content_type", "content type %s is not documented", mediaType)
+		return
+	}
+	if mt == nil || mt.Schema == nil || !isJSON(mediaType) || truncated {
+		return
+	}
+	decoded, _, err := flow.DecodeBody(header, body)
+	if err != nil {
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(decoded))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		c.add(KindInvalidBody, part+".body", "body is not valid JSON")
+		return
+	}
+	c.value(v, mt.Schema, part+".body", 0, false)
+}
+
+// text 检查参数等文本值
+func (c *checker) text(value string, s *Schema, location string) {
+	s = c.schema(s, location)
+	if s == nil {
+		return
+	}
+	var v any = value
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			v = json.Number(value)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			v = b
+		}
+	case "array", "object":
+		// 数组和对象参数的序列化方式很多，不检查
+		return
+	}
+	c.value(v, s, location, 0, false)
+}
+
+// value 检查JSON值，loose 为true时不检查未声明的属性，用于 allOf 的各个分支
+func (c *checker) value(v any, s *Schema, location string, depth int, loose bool) {
+	if s = c.schema(s, location); s == nil || depth > maxDepth {
+		return
+	}
+	for _, sub := range s.AllOf {
+		c.value(v, sub, location, depth+1, true)
+	}
+	if len(s.AllOf) > 0 && !loose {
+		c.unknownFields(v, c.allProperties(s, depth), location)
+	}
+	for _, alts := range [][]*Schema{s.OneOf, s.AnyOf} {
+		if len(alts) > 0 && !c.matchesAny(v, alts, depth) {
+			c.add(KindTypeMismatch, location, "value does not match any of the %d alternative schemas", len(alts))
+		}
+	}
+
+	if v == nil {
+		if !s.Nullable && s.Type != "" {
+			c.add(KindTypeMismatch, location, "null is not allowed, want %s", s.Type)
+		}
+		return
+	}
+	if got := jsonType(v); s.Type != "" && got != s.Type && !(s.Type == "number" && got == "integer") {
+		c.add(KindTypeMismatch, location, "got %s, want %s", got, s.Type)
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		c.add(KindInvalidValue, location, "value is not one of the %d allowed values", len(s.Enum))
+	}
+	switch v := v.(type) {
+	case string:
+		if !validFormat(v, s.Format) {
+			c.add(KindInvalidValue, location, "value is not a valid %s", s.Format)
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				c.value(item, s.Items, fmt.Sprintf("%s[%d]", location, i), depth+1, false)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				c.add(KindMissingField, location+"."+name, "required field %s is missing", name)
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(v)) {
+			item := v[name]
+			if prop, ok := s.Properties[name]; ok {
+				c.value(item, prop, location+"."+name, depth+1, false)
+				continue
+			}
+			if extra := s.AdditionalProperties; extra != nil && extra.Schema != nil {
+				c.value(item, extra.Schema, location+"."+name, depth+1, false)
+			}
+		}
+		if !loose && len(s.AllOf) == 0 {
+			c.unknownFields(v, s, location)
+		}
+	}
+}
+
+// unknownFields 报告 Schema 未声明的属性。声明了属性且没有允许 additionalProperties 的对象视为封闭的，
+// 这比 OpenAPI 的默认规则严格，用于发现文档中遗漏的字段
+func (c *checker) unknownFields(v any, s *Schema, location string) {
+	obj, ok := v.(map[string]any)
+	if !ok || len(s.Properties) == 0 || s.AdditionalProperties != nil && s.AdditionalProperties.Allowed {
+		return
+	}
+	for _, name := range slices.Sorted(maps.Keys(obj)) {
+		if _, ok := s.Properties[name]; !ok {
+			c.add(KindUnknownField, location+"."+name, "field %s is not documented", name)
+		}
+	}
+}
+
+// allProperties 合并 allOf 各分支声明的属性
+func (c *checker) allProperties(s *Schema, depth int) *Schema {
+	out := &Schema{Properties: maps.Clone(s.Properties), AdditionalProperties: s.AdditionalProperties}
+	if out.Properties == nil {
+		out.Properties = map[string]*Schema{}
+	}
+	if depth > maxDepth {
+		return out
+	}
+	for _, sub := range s.AllOf {
+		if sub = c.resolve(sub); sub == nil {
+			continue
+		}
+		merged := c.allProperties(sub, depth+1)
+		maps.Copy(out.Properties, merged.Properties)
+		if merged.AdditionalProperties != nil && merged.AdditionalProperties.Allowed {
+			out.AdditionalProperties = merged.AdditionalProperties
+		}
+	}
+	return out
+}
+
+// matchesAny 判断值是否满足任意一个 Schema
+func (c *checker) matchesAny(v any, alts []*Schema, depth int) bool {
+	for _, alt := range alts {
+		trial := &checker{doc: c.doc}
+		trial.value(v, alt, "", depth+1, false)
+		if len(trial.out) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// schema 解析 $ref，无法解析时记录问题并返回nil
+func (c *checker) schema(s *Schema, location string) *Schema {
+	if s == nil {
+		return nil
+	}
+	r := c.resolve(s)
+	if r == nil {
+		c.add(KindUnresolvedRef, location, "cannot resolve %s", s.Ref)
+	}
+	return r
+}
+
+// resolve 解析指向 #/components/schemas 的 $ref，支持多级引用
+func (c *checker) resolve(s *Schema) *Schema {
+	for i := 0; s != nil && s.Ref != ""; i++ {
+		name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok || i > maxDepth || c.doc.Components == nil {
+			return nil
+		}
+		s = c.doc.Components.Schemas[unescapePointer(name)]
+	}
+	return s
+}
+
+func (c *checker) parameter(p *Parameter) *Parameter {
+	if p == nil || p.Ref == "" {
+		return p
+	}
+	name, ok := strings.CutPrefix(p.Ref, "#/components/parameters/")
+	if !ok || c.doc.Components == nil || c.doc.Components.Parameters[unescapePointer(name)] == nil {
+		c.add(KindUnresolvedRef, "request", "cannot resolve %s", p.Ref)
+		return nil
+	}
+	return c.doc.Components.Parameters[unescapePointer(name)]
+}
+
+func (c *checker) requestBodyRef(b *RequestBody) *RequestBody {
+	if b == nil || b.Ref == "" {
+		return b
+	}
+	name, ok := strings.CutPrefix(b.Ref, "#/components/requestBodies/")
+	if !ok || c.doc.Components == nil || c.doc.Components.RequestBodies[unescapePointer(name)] == nil {
+		c.add(KindUnresolvedRef, "request.body", "cannot resolve %s", b.Ref)
+		return nil
+	}
+	return c.doc.Components.RequestBodies[unescapePointer(name)]
+}
+
+func (c *checker) responseRef(r *Response) *Response {
+	if r.Ref == "" {
+		return r
+	}
+	name, ok := strings.CutPrefix(r.Ref, "#/components/responses/")
+	if !ok || c.doc.Components == nil || c.doc.Components.Responses[unescapePointer(name)] == nil {
+		c.add(KindUnresolvedRef, "response", "cannot resolve %s", r.Ref)
+		return nil
+	}
+	return c.doc.Components.Responses[unescapePointer(name)]
+}
+
+// unescapePointer 还原JSON Pointer中转义的 ~1 和 ~0
+func unescapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
+
+// jsonType 返回JSON值的 Schema 类型
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		// 1.0 这样的整数值也满足 integer
+		if f, err := v.Float64(); err == nil && f == float64(int64(f)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return ""
+}
+
+func inEnum(v any, enum []any) bool {
+	got, _ := json.Marshal(v)
+	for _, e := range enum {
+		if want, err := json.Marshal(e); err == nil && bytes.Equal(got, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// validFormat 检查常见的字符串格式，其他格式总是有效
+func validFormat(v, format string) bool {
+	switch format {
+	case "date-time":
+		return isTime(v)
+	case "date":
+		return isDate(v)
+	case "uuid":
+		return uuidPattern.MatchString(v)
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+const (
+	// DefaultServiceName 资源属性 service.name 的默认值
+	DefaultServiceName = "sniffy"
+
+	// DefaultBatchSize 每次导出的最大流数量
+	DefaultBatchSize = 256
+
+	// DefaultFlushInterval 定期导出的间隔
+	DefaultFlushInterval = 5 * time.Second
+
+	// maxQueue 等待导出的最大流数量，收集端不可用时丢弃超出的流
+	maxQueue = 8192
+
+	// tracesPath OTLP/HTTP的追踪接口路径
+	tracesPath = "/v1/traces"
+)
+
+// Options 导出器配置
+type Options struct {
+	// Endpoint OTLP/HTTP收集端地址，例如 http://localhost:4318，路径为空时使用 /v1/traces
+	Endpoint string
+
+	// Headers 导出请求附带的头部，通常用于认证
+	Headers http.Header
+
+	// ServiceName 资源属性 service.name，为空时使用 DefaultServiceName
+	ServiceName string
+
+	// BatchSize 每次导出的最大流数量，0 使用 DefaultBatchSize
+	BatchSize int
+
+	// FlushInterval 定期导出的间隔，0 使用 DefaultFlushInterval
+	FlushInterval time.Duration
+
+	// Client 发送导出请求的HTTP客户端，为nil时使用超时10秒的默认客户端
+	Client *http.Client
+}
+
+// Exporter 将流转换为OpenTelemetry span，批量以OTLP/HTTP JSON格式导出。
+// 每个流生成一个根span，DNS解析、TCP连接、TLS握手、等待首字节和响应体传输为子span。
+// 请求带有 W3C traceparent 头部时，根span加入该追踪
+type Exporter struct {
+	opts     Options
+	endpoint string
+
+	mu       sync.Mutex
+	queue    []*flow.Flow
+	dropped  int
+	flushReq chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New 创建导出器并启动后台导出
+func New(opts Options) (*Exporter, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", opts.Endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = tracesPath
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = DefaultServiceName
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	e := &Exporter{
+		opts:     opts,
+		endpoint: u.String(),
+		flushReq: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.run()
+	return e, nil
+}
+
+// Add 将流加入导出队列，签名与 flow.Store.OnAdd 的回调一致
+func (e *Exporter) Add(f *flow.Flow) {
+	e.mu.Lock()
+	if len(e.queue) >= maxQueue {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.queue = append(e.queue, f)
+	full := len(e.queue) >= e.opts.BatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flushReq <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush 导出队列中的所有流
+func (e *Exporter) Flush(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		n := min(len(e.queue), e.opts.BatchSize)
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		dropped := e.dropped
+		e.dropped = 0
+		e.mu.Unlock()
+
+		if dropped > 0 {
+			log.Printf("OTLP export queue full, dropped %d flows", dropped)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := e.export(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
+
+// Close 停止后台导出并导出剩余的流
+func (e *Exporter) Close() error {
+	close(e.done)
+	e.wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return e.Flush(ctx)
+}
+
+// run 定期或在队列达到批量大小时导出
+func (e *Exporter) run() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		case <-e.flushReq:
+		}
+		if err := e.Flush(context.Background()); err != nil {
+			log.Printf("OTLP export failed: %v", err)
+		}
+	}
+}
+
+// export 发送一批流的span
+func (e *Exporter) export(ctx context.Context, flows []*flow.Flow) error {
+	var spans []*span
+	for _, f := range flows {
+		spans = append(spans, flowSpans(f)...)
+	}
+	body, err := json.Marshal(&exportRequest{ResourceSpans: []resourceSpans{{
+		Resource: resource{Attributes: []attribute{stringAttr("service.name", e.opts.ServiceName)}},
+		ScopeSpans: []scopeSpans{{
+			Scope: scope{Name: scopeName},
+			Spans: spans,
+		}},
+	}}})
+	if err != nil {
+		return fmt.Errorf("encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range e.opts.Headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package otlp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// collector 记录收到的导出请求
+type collector struct {
+	mu       sync.Mutex
+	requests []exportRequest
+	headers  []http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req exportRequest
+	if r.URL.Path != tracesPath || json.NewDecoder(r.Body).Decode(&req) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, r.Header.Clone())
+	c.mu.Unlock()
+}
+
+func (c *collector) spans() []*span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []*span
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				out = append(out, ss.Spans...)
+			}
+		}
+	}
+	return out
+}
+
+func newTimedFlow() *flow.Flow {
+	start := time.Unix(1700000000, 0)
+	f := &flow.Flow{
+		ID:        "f1",
+		StartTime: start,
+		EndTime:   start.Add(100 * time.Millisecond),
+		Request: &flow.Request{
+			Method: "GET",
+			URL:    "https://api.example.com/v1",
+			Host:   "api.example.com",
+			Header: http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+		},
+		Response: &flow.Response{StatusCode: 503},
+		Timings: &flow.Timings{
+			DNSStart:     start.Add(time.Millisecond),
+			DNSDone:      start.Add(5 * time.Millisecond),
+			ConnectStart: start.Add(5 * time.Millisecond),
+			ConnectDone:  start.Add(10 * time.Millisecond),
+			TLSStart:     start.Add(10 * time.Millisecond),
+			TLSDone:      start.Add(30 * time.Millisecond),
+			RequestSent:  start.Add(31 * time.Millisecond),
+			FirstByte:    start.Add(80 * time.Millisecond),
+			ResponseDone: start.Add(99 * time.Millisecond),
+		},
+	}
+	return f
+}
+
+// --- 测试代码 ---
+func TestFlowSpans(t *testing.T) {
+	spans := flowSpans(newTimedFlow())
+	require.Len(t, spans, 6)
+
+	root := spans[0]
+	require.Equal(t, "GET api.example.com", root.Name)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", root.TraceID)
+	require.Equal(t, "00f067aa0ba902b7", root.ParentSpanID)
+	require.Equal(t, "1700000000000000000", root.StartTimeUnixNano)
+	require.Equal(t, "1700000000100000000", root.EndTimeUnixNano)
+	require.Equal(t, &status{Code: statusError}, root.Status)
+
+	names := []string{}
+	for _, s := range spans[1:] {
+		require.Equal(t, root.TraceID, s.TraceID)
+		require.Equal(t, root.SpanID, s.ParentSpanID)
+		names = append(names, s.Name)
+	}
+	require.Equal(t, []string{"dns", "connect", "tls", "ttfb", "body"}, names)
+	require.Equal(t, "1700000000031000000", spans[4].StartTimeUnixNano)
+	require.Equal(t, "1700000000080000000", spans[4].EndTimeUnixNano)
+
+	// 没有计时和无效的 traceparent
+	f := newTimedFlow()
+	f.Timings = nil
+	f.Request.Header.Set("Traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	f.Error = "dial tcp: connection refused"
+	spans = flowSpans(f)
+	require.Len(t, spans, 1)
+	require.Len(t, spans[0].TraceID, 32)
+	require.NotEqual(t, "00000000000000000000000000000000", spans[0].TraceID)
+	require.Empty(t, spans[0].ParentSpanID)
+	require.Equal(t, f.Error, spans[0].Status.Message)
+}
+
+func TestExporter(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	e, err := New(Options{
+		Endpoint:      srv.URL,
+		Headers:       http.Header{"Authorization": {"Bearer token"}},
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	// 达到批量大小时立即导出
+	e.Add(newTimedFlow())
+	e.Add(newTimedFlow())
+	require.Eventually(t, func() bool { return len(c.spans()) == 12 }, time.Second, 10*time.Millisecond)
+
+	// 关闭时导出剩余的流
+	e.Add(newTimedFlow())
+	require.NoError(t, e.Close())
+	require.Len(t, c.spans(), 18)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	require.Equal(t, "Bearer token", c.headers[0].Get("Authorization"))
+	require.Equal(t, "application/json", c.headers[0].Get("Content-Type"))
+	attrs := c.requests[0].ResourceSpans[0].Resource.Attributes
+	require.Equal(t, "service.name", attrs[0].Key)
+	require.Equal(t, DefaultServiceName, *attrs[0].Value.StringValue)
+}
+
+func TestExporter_Errors(t *testing.T) {
+	_, err := New(Options{Endpoint: "localhost:4318"})
+	require.Error(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	e, err := New(Options{Endpoint: srv.URL + "/custom", FlushInterval: time.Hour})
+	require.NoError(t, err)
+	require.Equal(t, srv.URL+"/custom", e.endpoint)
+	e.Add(newTimedFlow())
+	require.ErrorContains(t, e.Close(), "503")
+}
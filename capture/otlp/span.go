@@ -0,0 +1,223 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package otlp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/tracecontext"
+)
+
+// scopeName 导出span的instrumentation scope
+const scopeName = "github.com/f-dong/sniffy"
+
+// span类型和状态码，取值与OTLP协议一致
+const (
+	kindInternal = 1
+	kindServer   = 2
+
+	statusError = 2
+)
+
+// 以下为OTLP/HTTP JSON编码的请求结构，只包含用到的字段
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []attribute `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope   `json:"scope"`
+	Spans []*span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []attribute `json:"attributes,omitempty"`
+	Status            *status     `json:"status,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type attribute struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+// anyValue 属性值，整数按proto3 JSON约定编码为字符串
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func stringAttr(key, value string) attribute {
+	return attribute{Key: key, Value: anyValue{StringValue: &value}}
+}
+
+func intAttr(key string, value int64) attribute {
+	s := strconv.FormatInt(value, 10)
+	return attribute{Key: key, Value: anyValue{IntValue: &s}}
+}
+
+func boolAttr(key string, value bool) attribute {
+	return attribute{Key: key, Value: anyValue{BoolValue: &value}}
+}
+
+// flowSpans 返回流的根span和各阶段的子span
+func flowSpans(f *flow.Flow) []*span {
+	traceID, parentID := parseTraceparent(f)
+	if traceID == "" {
+		traceID = randomID(16)
+	}
+	end := f.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	root := &span{
+		TraceID:           traceID,
+		SpanID:            randomID(8),
+		ParentSpanID:      parentID,
+		Name:              spanName(f),
+		Kind:              kindServer,
+		StartTimeUnixNano: unixNano(f.StartTime),
+		EndTimeUnixNano:   unixNano(end),
+		Attributes:        flowAttributes(f),
+	}
+	if f.Error != "" {
+		root.Status = &status{Code: statusError, Message: f.Error}
+	} else if f.Response != nil && f.Response.StatusCode >= 500 {
+		root.Status = &status{Code: statusError}
+	}
+	spans := []*span{root}
+
+	t := f.Timings
+	if t == nil {
+		return spans
+	}
+	child := func(name string, start, end time.Time) {
+		if start.IsZero() || end.IsZero() {
+			return
+		}
+		spans = append(spans, &span{
+			TraceID:           traceID,
+			SpanID:            randomID(8),
+			ParentSpanID:      root.SpanID,
+			Name:              name,
+			Kind:              kindInternal,
+			StartTimeUnixNano: unixNano(start),
+			EndTimeUnixNano:   unixNano(end),
+		})
+	}
+	child("client_tls", t.ClientTLSStart, t.ClientTLSDone)
+	child("dns", t.DNSStart, t.DNSDone)
+	child("connect", t.ConnectStart, t.ConnectDone)
+	child("tls", t.TLSStart, t.TLSDone)
+	child("ttfb", t.RequestSent, t.FirstByte)
+	child("body", t.FirstByte, t.ResponseDone)
+	return spans
+}
+
+// spanName 返回根span名称，格式为 "METHOD host"
+func spanName(f *flow.Flow) string {
+	if f.Request == nil {
+		return "flow"
+	}
+	host := f.Request.Host
+	if u, err := url.Parse(f.Request.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return f.Request.Method + " " + host
+}
+
+// flowAttributes 返回根span的属性，名称遵循HTTP语义约定
+func flowAttributes(f *flow.Flow) []attribute {
+	attrs := []attribute{stringAttr("sniffy.flow_id", f.ID)}
+	if f.ClientAddr != "" {
+		attrs = append(attrs, stringAttr("client.address", f.ClientAddr))
+	}
+	if f.ServerAddr != "" {
+		attrs = append(attrs, stringAttr("network.peer.address", f.ServerAddr))
+	}
+	if f.Request != nil {
+		attrs = append(attrs,
+			stringAttr("http.request.method", f.Request.Method),
+			stringAttr("url.full", f.Request.URL),
+			stringAttr("server.address", f.Request.Host),
+			intAttr("http.request.body.size", f.Request.BodyLen()),
+		)
+	}
+	if f.Response != nil {
+		attrs = append(attrs,
+			intAttr("http.response.status_code", int64(f.Response.StatusCode)),
+			intAttr("http.response.body.size", f.Response.BodyLen()),
+		)
+	}
+	if f.Intercepted {
+		attrs = append(attrs, boolAttr("sniffy.intercepted", true))
+	}
+	if f.Responder != "" {
+		attrs = append(attrs, stringAttr("sniffy.responder", f.Responder))
+	}
+	if f.ReplayOf != "" {
+		attrs = append(attrs, stringAttr("sniffy.replay_of", f.ReplayOf))
+	}
+	if f.Error != "" {
+		code := string(f.ErrorCode)
+		if code == "" {
+			code = "sniffy.flow_error"
+		}
+		attrs = append(attrs, stringAttr("error.type", code))
+	}
+	return attrs
+}
+
+// parseTraceparent 从请求的 W3C traceparent 头部解析追踪ID和父span ID，格式无效时返回空
+func parseTraceparent(f *flow.Flow) (traceID, spanID string) {
+	if f.Request == nil {
+		return "", ""
+	}
+	traceID, spanID, _ = tracecontext.Parse(f.Request.Header.Get(tracecontext.TraceparentHeader))
+	return traceID, spanID
+}
+
+// randomID 返回 n 字节的随机ID的十六进制编码
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
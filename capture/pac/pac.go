@@ -0,0 +1,104 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package pac
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ContentType PAC文件的MIME类型
+const ContentType = "application/x-ns-proxy-autoconfig"
+
+// File 只让指定主机经过代理的PAC文件，其余主机直接连接。
+// 没有指定主机时所有请求经过代理
+type File struct {
+	host  string
+	port  int
+	hosts []string
+}
+
+// New 返回经由 proxy (host:port) 访问 hosts 的PAC文件，主机支持 "*.example.com" 表示所有子域名。
+// proxy 的主机为空或未指定地址（如 0.0.0.0）时使用客户端请求PAC文件时的主机
+func New(proxy string, hosts []string) (*File, error) {
+	host, port, err := net.SplitHostPort(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy address %q: %w", proxy, err)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 || n > 65535 {
+		return nil, fmt.Errorf("invalid proxy port %q", port)
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = ""
+	}
+	f := &File{host: host, port: n}
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if err := checkHost(h); err != nil {
+			return nil, err
+		}
+		f.hosts = append(f.hosts, h)
+	}
+	return f, nil
+}
+
+// checkHost 检查主机模式只包含主机名中的字符，避免破坏生成的脚本
+func checkHost(pattern string) error {
+	name := strings.TrimPrefix(pattern, "*.")
+	if name == "" {
+		return fmt.Errorf("invalid PAC host %q", pattern)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.' || r == ':' || r == '_') {
+			return fmt.Errorf("invalid PAC host %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Hosts 返回经过代理的主机
+func (f *File) Hosts() []string {
+	return f.hosts
+}
+
+// Script 返回PAC脚本，requestHost 为客户端请求PAC文件时使用的主机，代理地址未指定时使用。
+// 代理不可用时不回退到直接连接，避免请求在用户不知情时绕过代理
+func (f *File) Script(requestHost string) string {
+	host := f.host
+	if host == "" {
+		host = requestHost
+		if h, _, err := net.SplitHostPort(requestHost); err == nil {
+			host = h
+		}
+		if host == "" {
+			host = "127.0.0.1"
+		}
+	}
+	proxy := "PROXY " + net.JoinHostPort(host, strconv.Itoa(f.port))
+
+	var b strings.Builder
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	if len(f.hosts) == 0 {
+		fmt.Fprintf(&b, "  return %q;\n}\n", proxy)
+		return b.String()
+	}
+	b.WriteString("  host = host.toLowerCase();\n  if (")
+	for i, h := range f.hosts {
+		if i > 0 {
+			b.WriteString(" ||\n      ")
+		}
+		if suffix, ok := strings.CutPrefix(h, "*."); ok {
+			fmt.Fprintf(&b, "dnsDomainIs(host, %q)", "."+suffix)
+		} else {
+			fmt.Fprintf(&b, "host == %q", h)
+		}
+	}
+	fmt.Fprintf(&b, ") {\n    return %q;\n  }\n  return \"DIRECT\";\n}\n", proxy)
+	return b.String()
+}
@@ -0,0 +1,62 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package pac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+
+func TestFile_Script(t *testing.T) {
+	f, err := New("10.0.0.5:8080", []string{"API.example.com", "*.corp.example"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"api.example.com", "*.corp.example"}, f.Hosts())
+	require.Equal(t, `function FindProxyForURL(url, host) {
+  host = host.toLowerCase();
+  if (host == "api.example.com" ||
+      dnsDomainIs(host, ".corp.example")) {
+    return "PROXY 10.0.0.5:8080";
+  }
+  return "DIRECT";
+}
+`, f.Script("ignored:8081"))
+
+	// 没有指定主机时所有请求经过代理
+	f, err = New("127.0.0.1:8080", nil)
+	require.NoError(t, err)
+	require.Equal(t, "function FindProxyForURL(url, host) {\n  return \"PROXY 127.0.0.1:8080\";\n}\n", f.Script(""))
+}
+
+func TestFile_UnspecifiedAddress(t *testing.T) {
+	for proxy, want := range map[string]string{
+		"0.0.0.0:8080": `"PROXY 192.168.1.20:8080"`,
+		"[::]:8080":    `"PROXY 192.168.1.20:8080"`,
+		":8080":        `"PROXY 192.168.1.20:8080"`,
+	} {
+		f, err := New(proxy, nil)
+		require.NoError(t, err)
+		require.Contains(t, f.Script("192.168.1.20:8081"), want, proxy)
+	}
+
+	f, err := New("0.0.0.0:8080", nil)
+	require.NoError(t, err)
+	require.Contains(t, f.Script("[fd00::1]:8081"), `"PROXY [fd00::1]:8080"`)
+	require.Contains(t, f.Script("proxy.lan"), `"PROXY proxy.lan:8080"`)
+}
+
+func TestNew_Errors(t *testing.T) {
+	for _, proxy := range []string{"127.0.0.1", "127.0.0.1:0", "127.0.0.1:http"} {
+		_, err := New(proxy, nil)
+		require.Error(t, err, proxy)
+	}
+	for _, host := range []string{"", "*.", `evil"); alert(1); ("`, "a b"} {
+		_, err := New("127.0.0.1:8080", []string{host})
+		require.Error(t, err, host)
+	}
+}
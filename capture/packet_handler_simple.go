@@ -6,12 +6,39 @@
 package capture
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"time"
 
+	"github.com/f-dong/sniffy/ca"
+	"github.com/f-dong/sniffy/capture/auth"
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/chaos"
+	"github.com/f-dong/sniffy/capture/dialer"
+	"github.com/f-dong/sniffy/capture/docker"
+	"github.com/f-dong/sniffy/capture/duplicates"
+	"github.com/f-dong/sniffy/capture/ebpf"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/hooks"
+	"github.com/f-dong/sniffy/capture/kube"
+	"github.com/f-dong/sniffy/capture/limits"
+	"github.com/f-dong/sniffy/capture/openapi"
+	"github.com/f-dong/sniffy/capture/pool"
 	"github.com/f-dong/sniffy/capture/processors"
+	"github.com/f-dong/sniffy/capture/procinfo"
+	"github.com/f-dong/sniffy/capture/ratelimit"
+	"github.com/f-dong/sniffy/capture/redact"
+	"github.com/f-dong/sniffy/capture/rules"
+	"github.com/f-dong/sniffy/capture/secrets"
+	"github.com/f-dong/sniffy/capture/timeouts"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+	"github.com/f-dong/sniffy/capture/tracecontext"
+	"github.com/f-dong/sniffy/capture/transparent"
 	"github.com/f-dong/sniffy/capture/types"
 )
 
@@ -20,6 +47,83 @@ type SimplePacketHandler struct {
 	config   types.Config
 	logger   types.Logger
 	registry *processors.Registry
+	dialer   *dialer.Dialer
+	flows    *flow.Store
+	ca       ca.CA
+	policy   tlsinfo.Policy
+	keyLog   io.Writer
+	breaks   *breakpoint.Manager
+	rules    *rules.Engine
+	hooks    *hooks.Chain
+	events   *flow.Bus
+	auth     *auth.Authenticator
+	limiter  *ratelimit.Limiter
+	chaos    *chaos.Engine
+	timeouts *timeouts.Policy
+	pool     *pool.Pool
+	bodies   *flow.BodyPolicy
+	limits   *limits.Limiter
+	redactor *redact.Redactor
+	spec     *openapi.Validator
+	secrets  *secrets.Detector
+	dupes    *duplicates.Tracker
+	tracing  *tracecontext.Injector
+	pinning  *tlsinfo.Pinning
+	docker   *docker.Resolver
+	pod      *kube.Pod
+	ebpf     *ebpf.Redirector
+
+	// listener 和 protocol 命名监听器的名称和只接受的协议，见 ForListener
+	listener string
+	protocol string
+}
+
+// protocolTransparent transparent 模式的监听器接受的连接，由HTTP处理器按连接原来的目标地址处理
+const protocolTransparent = "TRANSPARENT"
+
+// protocolEBPF ebpf 模式的监听器接受的连接，与 transparent 相同，原目标地址和发起连接的进程由eBPF程序记录
+const protocolEBPF = "EBPF"
+
+// listenerModes 监听器模式对应的协议，auto 按连接的首字节检测
+var listenerModes = map[string]string{
+	"auto":        "",
+	"http":        "HTTP",
+	"socks5":      "SOCKS5",
+	"transparent": protocolTransparent,
+	"ebpf":        protocolEBPF,
+}
+
+// originalDst 返回透明代理连接原来的目标地址，测试时替换
+var originalDst = transparent.OriginalDst
+
+// redirectOrigin 返回eBPF重定向的连接原来的目标地址和进程，测试时替换
+var redirectOrigin = (*ebpf.Redirector).Origin
+
+// ValidListenerMode 判断是否为支持的监听器模式：auto、http、socks5、transparent 或 ebpf，空字符串与 auto 相同
+func ValidListenerMode(mode string) bool {
+	_, ok := listenerModes[cmp.Or(mode, "auto")]
+	return ok
+}
+
+// ForListener 返回命名监听器使用的处理器，与 h 共享CA、流存储、事件和其他组件。
+// mode 为空时与 auto 相同，engine 不为nil时替换 h 的规则。应在 h 的所有组件设置完成后调用
+func (h *SimplePacketHandler) ForListener(name, mode string, engine *rules.Engine) (*SimplePacketHandler, error) {
+	protocol, ok := listenerModes[cmp.Or(mode, "auto")]
+	if !ok {
+		return nil, fmt.Errorf("unknown listener mode %q (expected auto, http, socks5, transparent or ebpf)", mode)
+	}
+	if protocol == protocolTransparent && !transparent.Supported {
+		return nil, fmt.Errorf("listener %q: transparent mode is only supported on Linux", name)
+	}
+	if protocol == protocolEBPF && h.ebpf == nil {
+		return nil, fmt.Errorf("listener %q: ebpf mode requires attached eBPF programs", name)
+	}
+	l := *h
+	l.listener, l.protocol = name, protocol
+	if engine != nil {
+		l.rules = engine
+	}
+	return &l, nil
 }
 
 // NewDefaultPacketHandler 创建新的简化数据包处理器
@@ -27,6 +131,9 @@ func NewDefaultPacketHandler(config types.Config) *SimplePacketHandler {
 	return &SimplePacketHandler{
 		config:   config,
 		registry: processors.NewRegistry(),
+		dialer:   dialer.New(),
+		flows:    flow.NewStore(),
+		events:   flow.NewBus(),
 	}
 }
 
@@ -35,6 +142,133 @@ func (h *SimplePacketHandler) SetLogger(logger types.Logger) {
 	h.logger = logger
 }
 
+// SetDialer 设置上游拨号器
+func (h *SimplePacketHandler) SetDialer(d *dialer.Dialer) {
+	h.dialer = d
+}
+
+// SetFlowStore 设置流存储
+func (h *SimplePacketHandler) SetFlowStore(store *flow.Store) {
+	h.flows = store
+}
+
+// SetCA 设置用于签发MITM证书的CA
+func (h *SimplePacketHandler) SetCA(authority ca.CA) {
+	h.ca = authority
+}
+
+// SetTLSPolicy 设置MITM决策策略
+func (h *SimplePacketHandler) SetTLSPolicy(policy tlsinfo.Policy) {
+	h.policy = policy
+}
+
+// SetKeyLogWriter 设置TLS密钥日志输出，客户端侧和上游侧的会话密钥都会写入
+func (h *SimplePacketHandler) SetKeyLogWriter(w io.Writer) {
+	h.keyLog = w
+}
+
+// SetBreakpoints 设置断点管理器
+func (h *SimplePacketHandler) SetBreakpoints(m *breakpoint.Manager) {
+	h.breaks = m
+}
+
+// SetRules 设置请求/响应改写规则引擎
+func (h *SimplePacketHandler) SetRules(e *rules.Engine) {
+	h.rules = e
+}
+
+// SetHooks 设置流生命周期钩子链
+func (h *SimplePacketHandler) SetHooks(c *hooks.Chain) {
+	h.hooks = c
+}
+
+// SetEvents 设置流生命周期事件总线
+func (h *SimplePacketHandler) SetEvents(b *flow.Bus) {
+	h.events = b
+	b.SetRedactor(h.redactor.ApplyEvent)
+}
+
+// SetAuth 设置代理访问控制
+func (h *SimplePacketHandler) SetAuth(a *auth.Authenticator) {
+	h.auth = a
+}
+
+// SetRateLimiter 设置按客户端和目标主机的限流器
+func (h *SimplePacketHandler) SetRateLimiter(l *ratelimit.Limiter) {
+	h.limiter = l
+}
+
+// SetChaos 设置故障注入规则
+func (h *SimplePacketHandler) SetChaos(e *chaos.Engine) {
+	h.chaos = e
+}
+
+// SetTimeouts 设置各阶段的超时，拨号和TLS握手超时需另外设置到拨号器
+func (h *SimplePacketHandler) SetTimeouts(p *timeouts.Policy) {
+	h.timeouts = p
+}
+
+// SetPool 设置上游连接池
+func (h *SimplePacketHandler) SetPool(p *pool.Pool) {
+	h.pool = p
+}
+
+// SetBodyPolicy 设置内容捕获策略
+func (h *SimplePacketHandler) SetBodyPolicy(p *flow.BodyPolicy) {
+	h.bodies = p
+}
+
+// SetLimiter 设置客户端连接数和源站进行中请求数的限制
+func (h *SimplePacketHandler) SetLimiter(l *limits.Limiter) {
+	h.limits = l
+}
+
+// SetRedactor 设置流保存前的脱敏规则，同样用于流保存前发布的事件
+func (h *SimplePacketHandler) SetRedactor(r *redact.Redactor) {
+	h.redactor = r
+	h.events.SetRedactor(r.ApplyEvent)
+}
+
+// SetValidator 设置检查流是否符合API规范的校验器
+func (h *SimplePacketHandler) SetValidator(v *openapi.Validator) {
+	h.spec = v
+}
+
+// SetPinning 设置疑似证书固定导致的握手失败的记录
+func (h *SimplePacketHandler) SetPinning(p *tlsinfo.Pinning) {
+	h.pinning = p
+}
+
+// SetDetector 设置识别流中凭据的检测器
+func (h *SimplePacketHandler) SetDetector(d *secrets.Detector) {
+	h.secrets = d
+}
+
+// SetDuplicates 设置标记窗口内重复请求的标记器
+func (h *SimplePacketHandler) SetDuplicates(t *duplicates.Tracker) {
+	h.dupes = t
+}
+
+// SetTracing 设置为转发的请求注入追踪头部的注入器
+func (h *SimplePacketHandler) SetTracing(in *tracecontext.Injector) {
+	h.tracing = in
+}
+
+// SetContainers 设置按客户端地址查找Docker容器的查找器
+func (h *SimplePacketHandler) SetContainers(r *docker.Resolver) {
+	h.docker = r
+}
+
+// SetPod 设置作为边车运行时所在的 Pod，记录到每个流
+func (h *SimplePacketHandler) SetPod(pod *kube.Pod) {
+	h.pod = pod
+}
+
+// SetRedirector 设置把连接重定向到 ebpf 模式监听器的eBPF程序
+func (h *SimplePacketHandler) SetRedirector(r *ebpf.Redirector) {
+	h.ebpf = r
+}
+
 // 实现 types.Server 接口
 func (h *SimplePacketHandler) GetConfig() types.Config {
 	return h.config
@@ -64,6 +298,106 @@ func (h *SimplePacketHandler) LogDebug(format string, args ...interface{}) {
 	}
 }
 
+func (h *SimplePacketHandler) GetDialer() *dialer.Dialer {
+	return h.dialer
+}
+
+func (h *SimplePacketHandler) GetFlowStore() *flow.Store {
+	return h.flows
+}
+
+func (h *SimplePacketHandler) GetCA() ca.CA {
+	return h.ca
+}
+
+func (h *SimplePacketHandler) GetTLSPolicy() tlsinfo.Policy {
+	return h.policy
+}
+
+func (h *SimplePacketHandler) GetKeyLogWriter() io.Writer {
+	return h.keyLog
+}
+
+func (h *SimplePacketHandler) GetBreakpoints() *breakpoint.Manager {
+	return h.breaks
+}
+
+func (h *SimplePacketHandler) GetRules() *rules.Engine {
+	return h.rules
+}
+
+func (h *SimplePacketHandler) GetHooks() *hooks.Chain {
+	return h.hooks
+}
+
+func (h *SimplePacketHandler) GetEvents() *flow.Bus {
+	return h.events
+}
+
+func (h *SimplePacketHandler) GetAuth() *auth.Authenticator {
+	return h.auth
+}
+
+func (h *SimplePacketHandler) GetRateLimiter() *ratelimit.Limiter {
+	return h.limiter
+}
+
+func (h *SimplePacketHandler) GetChaos() *chaos.Engine {
+	return h.chaos
+}
+
+func (h *SimplePacketHandler) GetTimeouts() *timeouts.Policy {
+	return h.timeouts
+}
+
+func (h *SimplePacketHandler) GetPool() *pool.Pool {
+	return h.pool
+}
+
+func (h *SimplePacketHandler) GetBodyPolicy() *flow.BodyPolicy {
+	return h.bodies
+}
+
+func (h *SimplePacketHandler) GetLimiter() *limits.Limiter {
+	return h.limits
+}
+
+func (h *SimplePacketHandler) GetRedactor() *redact.Redactor {
+	return h.redactor
+}
+
+func (h *SimplePacketHandler) GetValidator() *openapi.Validator {
+	return h.spec
+}
+
+func (h *SimplePacketHandler) GetDetector() *secrets.Detector {
+	return h.secrets
+}
+
+func (h *SimplePacketHandler) GetDuplicates() *duplicates.Tracker {
+	return h.dupes
+}
+
+func (h *SimplePacketHandler) GetTracing() *tracecontext.Injector {
+	return h.tracing
+}
+
+func (h *SimplePacketHandler) GetPinning() *tlsinfo.Pinning {
+	return h.pinning
+}
+
+func (h *SimplePacketHandler) GetContainers() *docker.Resolver {
+	return h.docker
+}
+
+func (h *SimplePacketHandler) GetPod() *kube.Pod {
+	return h.pod
+}
+
+func (h *SimplePacketHandler) GetListenerName() string {
+	return h.listener
+}
+
 func (h *SimplePacketHandler) FormatDataPreview(data []byte) string {
 	maxLen := 64
 	if len(data) > maxLen {
@@ -76,15 +410,75 @@ func (h *SimplePacketHandler) FormatDataPreview(data []byte) string {
 func (h *SimplePacketHandler) HandleConnection(conn net.Conn, info *types.ConnectionInfo) {
 	defer conn.Close()
 
+	h.LogInfo("处理新连接: %s -> %s", info.RemoteAddr, info.LocalAddr)
+
+	// 超出连接上限时发送RST，客户端的表现与连接被拒绝相同，可以立即重试其他代理
+	releaseConn, err := h.limits.AcquireConn()
+	if err != nil {
+		h.LogInfo("连接数超出上限，拒绝连接: %s", info.RemoteAddr)
+		if tc, ok := types.RawConn(conn).(*net.TCPConn); ok {
+			tc.SetLinger(0)
+		}
+		return
+	}
+	defer releaseConn()
+
+	// 白名单和限流按客户端地址判断。启用PROXY protocol时监听器只接受可信代理发送的头部，
+	// 其他对端的地址就是直接相连的地址，客户端无法通过伪造头部绕过
+	if !h.auth.AllowAddr(info.RemoteAddr) {
+		h.LogInfo("客户端不在白名单中，拒绝连接: %s", info.RemoteAddr)
+		return
+	}
+
+	release, err := h.limiter.AcquireConn(info.RemoteAddr)
+	if err != nil {
+		h.LogInfo("客户端连接数超出限制，拒绝连接: %s: %v", info.RemoteAddr, err)
+		return
+	}
+	defer release()
+
+	ctx, err := h.hooks.ClientConnect(context.Background(), &hooks.ClientConn{
+		Conn:       conn,
+		RemoteAddr: info.RemoteAddr,
+		LocalAddr:  info.LocalAddr,
+	})
+	if err != nil {
+		h.LogInfo("连接被钩子拒绝: %s: %v", info.RemoteAddr, err)
+		return
+	}
+
+	switch h.protocol {
+	case protocolTransparent:
+		target, err := transparentTarget(conn)
+		if err != nil {
+			h.LogInfo("无法取得透明代理连接的原目标地址，拒绝连接: %s: %v", info.RemoteAddr, err)
+			return
+		}
+		ctx = transparent.WithTarget(ctx, target)
+	case protocolEBPF:
+		origin, err := redirectOrigin(h.ebpf, conn)
+		if err != nil {
+			h.LogInfo("无法取得eBPF重定向的连接的原目标地址，拒绝连接: %s: %v", info.RemoteAddr, err)
+			return
+		}
+		ctx = transparent.WithTarget(ctx, origin.Dst.String())
+		ctx = procinfo.WithProcess(ctx, origin.Process)
+	}
+
 	// 创建连接抽象
-	connection := types.NewConnection(conn, h)
+	connection := types.NewConnectionWithContext(ctx, conn, h)
 	defer connection.Close()
 
-	h.LogInfo("处理新连接: %s -> %s", info.RemoteAddr, info.LocalAddr)
-
-	// 尝试检测协议类型
-	protocol := h.registry.DetectProtocol(connection.GetReader(), h)
-	h.LogInfo("检测到协议: %s", protocol)
+	// 透明代理的连接由HTTP处理器识别TLS、HTTP和其他协议，否则检测协议类型
+	protocol := "HTTP"
+	if h.protocol != protocolTransparent && h.protocol != protocolEBPF {
+		protocol = h.registry.DetectProtocol(connection.GetReader(), h)
+		h.LogInfo("检测到协议: %s", protocol)
+		if h.protocol != "" && protocol != h.protocol {
+			h.LogInfo("监听器 %s 只接受 %s 连接，拒绝 %s 连接: %s", h.listener, h.protocol, protocol, info.RemoteAddr)
+			return
+		}
+	}
 
 	// 获取处理器并处理连接
 	processor := h.registry.GetProcessor(protocol, connection)
@@ -99,6 +493,19 @@ func (h *SimplePacketHandler) HandleConnection(conn net.Conn, info *types.Connec
 	}
 }
 
+// transparentTarget 返回透明代理连接原来的目标地址 host:port。
+// 目标就是监听器自己时说明连接没有经过重定向，返回错误以免代理连接自己形成回环
+func transparentTarget(conn net.Conn) (string, error) {
+	dst, err := originalDst(conn)
+	if err != nil {
+		return "", err
+	}
+	if local, ok := conn.LocalAddr().(*net.TCPAddr); ok && local.Port == dst.Port && local.IP.Equal(dst.IP) {
+		return "", errors.New("connection was not redirected to the proxy")
+	}
+	return dst.String(), nil
+}
+
 func (h *SimplePacketHandler) HandleError(err error, context string) {
 	h.LogError("错误 [%s]: %v", context, err)
 }
@@ -0,0 +1,204 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package parsers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CBOR 解析CBOR（RFC 8949），字节串为base64字符串，标签只保留被标记的值，
+// 非字符串的map键转换为文本
+type CBOR struct{}
+
+// Name 实现 Parser 接口
+func (CBOR) Name() string { return "cbor" }
+
+// Parse 实现 Parser 接口
+func (CBOR) Parse(body []byte, _ map[string]string) (any, error) {
+	d := &cborDecoder{msgpackDecoder{data: body}}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, fmt.Errorf("parse cbor: %w", err)
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("parse cbor: %d trailing bytes", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+// errBreak 不定长数据项的结束标记
+var errBreak = errors.New("unexpected break")
+
+// cborDecoder 复用 msgpackDecoder 的读取方法
+type cborDecoder struct {
+	msgpackDecoder
+}
+
+// head 读取数据项头部，返回主类型、附加信息和参数；indefinite 表示不定长
+func (d *cborDecoder) head() (major byte, arg uint64, indefinite bool, err error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), false, nil
+	case info <= 27:
+		arg, err = d.uint(1 << (info - 24))
+		return major, arg, false, err
+	case info == 31:
+		return major, 0, true, nil
+	}
+	return 0, 0, false, fmt.Errorf("invalid additional info %d", info)
+}
+
+func (d *cborDecoder) value(depth int) (any, error) {
+	if depth > maxNestingDepth {
+		return nil, errTooDeep
+	}
+	start := d.pos
+	major, arg, indefinite, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if indefinite && (major == 0 || major == 1 || major == 6) {
+		return nil, fmt.Errorf("invalid indefinite length for major type %d", major)
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return arg, nil
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return -1 - float64(arg), nil
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		var raw []byte
+		if indefinite {
+			// 不定长字符串由多个同类型的定长块组成
+			for {
+				chunk, err := d.value(depth + 1)
+				if err == errBreak {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				s, ok := chunk.(string)
+				if !ok {
+					return nil, errors.New("invalid indefinite string chunk")
+				}
+				if major == 2 {
+					b, _ := base64.StdEncoding.DecodeString(s)
+					raw = append(raw, b...)
+				} else {
+					raw = append(raw, s...)
+				}
+			}
+		} else {
+			if raw, err = d.read(int(min(arg, math.MaxInt32))); err != nil {
+				return nil, err
+			}
+		}
+		if major == 2 {
+			return base64.StdEncoding.EncodeToString(raw), nil
+		}
+		return string(raw), nil
+	case 4:
+		var list []any
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if !indefinite && arg > uint64(len(d.data)-d.pos) {
+				return nil, errTruncated
+			}
+			v, err := d.value(depth + 1)
+			if err == errBreak && indefinite {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		if list == nil {
+			list = []any{}
+		}
+		return list, nil
+	case 5:
+		m := make(map[string]any)
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if !indefinite && arg > uint64(len(d.data)-d.pos) {
+				return nil, errTruncated
+			}
+			k, err := d.value(depth + 1)
+			if err == errBreak && indefinite {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[keyString(k)] = v
+		}
+		return m, nil
+	case 6:
+		return d.value(depth + 1)
+	default:
+		return d.simple(d.data[start]&0x1f, arg, indefinite)
+	}
+}
+
+// simple 解析主类型7：简单值和浮点数
+func (d *cborDecoder) simple(info byte, arg uint64, indefinite bool) (any, error) {
+	if indefinite {
+		return nil, errBreak
+	}
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfFloat(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	}
+	return fmt.Sprintf("simple(%d)", arg), nil
+}
+
+// halfFloat 将IEEE 754半精度浮点数转换为float64
+func halfFloat(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 31:
+		if frac == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(frac+1024, exp-25)
+}
@@ -0,0 +1,148 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package parsers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+const (
+	// grpcFlagCompressed 消息帧经过压缩
+	grpcFlagCompressed = 0x01
+
+	// grpcFlagTrailer gRPC-Web 的尾部帧，内容为HTTP/1格式的头部
+	grpcFlagTrailer = 0x80
+)
+
+// GRPCWeb 解析gRPC和gRPC-Web的长度前缀消息帧，结果为
+// {"messages": [...], "trailers": {...}}。消息按无schema的protobuf解码，
+// 压缩帧尝试gzip解压，仍无法解码的消息为base64字符串。
+// Text 为true时先对消息体做base64解码（application/grpc-web-text）
+type GRPCWeb struct {
+	Text bool
+}
+
+// Name 实现 Parser 接口
+func (g GRPCWeb) Name() string {
+	if g.Text {
+		return "grpc-web-text"
+	}
+	return "grpc-web"
+}
+
+// Parse 实现 Parser 接口
+func (g GRPCWeb) Parse(body []byte, _ map[string]string) (any, error) {
+	if g.Text {
+		decoded, err := decodeGRPCText(body)
+		if err != nil {
+			return nil, fmt.Errorf("parse grpc-web-text: %w", err)
+		}
+		body = decoded
+	}
+
+	messages := []any{}
+	var trailers map[string]any
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return nil, fmt.Errorf("parse grpc-web: %w", errTruncated)
+		}
+		flags, length := body[0], binary.BigEndian.Uint32(body[1:5])
+		if uint64(length) > uint64(len(body)-5) {
+			return nil, fmt.Errorf("parse grpc-web: %w", errTruncated)
+		}
+		payload := body[5 : 5+length]
+		body = body[5+length:]
+
+		if flags&grpcFlagCompressed != 0 {
+			if decompressed, err := gunzip(payload); err == nil {
+				payload = decompressed
+			}
+		}
+		if flags&grpcFlagTrailer != 0 {
+			t, err := parseTrailers(payload)
+			if err != nil {
+				return nil, fmt.Errorf("parse grpc-web trailers: %w", err)
+			}
+			trailers = t
+			continue
+		}
+		if msg, err := DecodeProtobuf(payload); err == nil {
+			messages = append(messages, msg)
+		} else {
+			messages = append(messages, base64.StdEncoding.EncodeToString(payload))
+		}
+	}
+
+	result := map[string]any{"messages": messages}
+	if trailers != nil {
+		result["trailers"] = trailers
+	}
+	return result, nil
+}
+
+// decodeGRPCText 解码base64文本，服务器可能逐帧编码，因此内容可以是多段带填充的base64
+func decodeGRPCText(body []byte) ([]byte, error) {
+	text := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+			return -1
+		}
+		return r
+	}, string(body))
+
+	var out []byte
+	for text != "" {
+		// 每段在填充字符之后结束
+		end := strings.IndexByte(text, '=')
+		if end < 0 {
+			end = len(text)
+		} else {
+			for end < len(text) && text[end] == '=' {
+				end++
+			}
+		}
+		chunk, err := base64.StdEncoding.DecodeString(text[:end])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, chunk...)
+		text = text[end:]
+	}
+	return out, nil
+}
+
+// parseTrailers 解析尾部帧中 "name: value\r\n" 格式的头部，名称转换为小写
+func parseTrailers(payload []byte) (map[string]any, error) {
+	// 补全结束头部所需的空行
+	data := append(append([]byte(nil), bytes.TrimRight(payload, "\r\n")...), "\r\n\r\n"...)
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(data)))
+	header, err := r.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	trailers := make(map[string]any, len(header))
+	for name, values := range header {
+		trailers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+	return trailers, nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
@@ -0,0 +1,96 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package parsers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func frame(flags byte, payload []byte) []byte {
+	f := []byte{flags, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(f[1:], uint32(len(payload)))
+	return append(f, payload...)
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// --- 测试代码 ---
+func TestGRPCWeb(t *testing.T) {
+	hello := []byte{0x0a, 0x05, 'h', 'e', 'l', 'l', 'o'}
+	trailers := []byte("grpc-status: 0\r\nGrpc-Message: OK\r\n")
+	body := bytes.Join([][]byte{
+		frame(0, hello),
+		frame(grpcFlagCompressed, gzipBytes(t, []byte{0x08, 0x2a})),
+		frame(0, nil),
+		frame(grpcFlagTrailer, trailers),
+	}, nil)
+
+	want := map[string]any{
+		"messages": []any{
+			map[string]any{"1": "hello"},
+			map[string]any{"1": uint64(42)},
+			map[string]any{},
+		},
+		"trailers": map[string]any{"grpc-status": "0", "grpc-message": "OK"},
+	}
+
+	got, err := GRPCWeb{}.Parse(body, nil)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	// 文本变体：服务器逐帧编码时每段都带填充
+	var text []byte
+	for _, part := range [][]byte{body[:12], body[12:]} {
+		text = append(text, base64.StdEncoding.EncodeToString(part)...)
+	}
+	got, err = GRPCWeb{Text: true}.Parse(text, nil)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+func TestGRPCWeb_Invalid(t *testing.T) {
+	_, err := GRPCWeb{}.Parse([]byte{0, 0, 0, 0, 9, 1}, nil)
+	require.Error(t, err)
+	_, err = GRPCWeb{}.Parse([]byte{0, 0}, nil)
+	require.Error(t, err)
+	_, err = GRPCWeb{Text: true}.Parse([]byte("!!!!"), nil)
+	require.Error(t, err)
+
+	// 无法按protobuf解码的消息保留为base64
+	got, err := GRPCWeb{}.Parse(frame(0, []byte{0xff}), nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"messages": []any{"/w=="}}, got)
+}
+
+func TestGRPCWeb_Registry(t *testing.T) {
+	body := frame(0, []byte{0x08, 0x01})
+	for _, ct := range []string{"application/grpc-web+proto", "application/grpc", "application/grpc-web-text"} {
+		data := body
+		if ct == "application/grpc-web-text" {
+			data = []byte(base64.StdEncoding.EncodeToString(body))
+		}
+		parsed, err := Default.Parse(http.Header{"Content-Type": {ct}}, data)
+		require.NoError(t, err, ct)
+		v, ok := parsed.Field("messages.0.1")
+		require.True(t, ok, ct)
+		require.Equal(t, uint64(1), v)
+	}
+}
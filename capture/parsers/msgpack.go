@@ -0,0 +1,226 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package parsers
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxNestingDepth MessagePack 和 CBOR 的最大嵌套深度
+const maxNestingDepth = 64
+
+var errTooDeep = errors.New("nesting too deep")
+
+// MsgPack 解析MessagePack，非字符串的map键转换为文本，bin 类型为base64字符串，
+// 扩展类型解析为包含 type 和 data 的map
+type MsgPack struct{}
+
+// Name 实现 Parser 接口
+func (MsgPack) Name() string { return "msgpack" }
+
+// Parse 实现 Parser 接口
+func (MsgPack) Parse(body []byte, _ map[string]string) (any, error) {
+	d := &msgpackDecoder{data: body}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, fmt.Errorf("parse msgpack: %w", err)
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("parse msgpack: %d trailing bytes", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint 读取 n 字节的大端无符号整数
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.read(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (d *msgpackDecoder) value(depth int) (any, error) {
+	if depth > maxNestingDepth {
+		return nil, errTooDeep
+	}
+	b, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.mapValue(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.array(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := d.read(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(raw), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(int(n))
+	case 0xca:
+		v, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.uint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if v > math.MaxInt64 {
+			return v, nil
+		}
+		return int64(v), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		v, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// 按位宽做符号扩展
+		shift := 64 - 8*size
+		return int64(v<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapValue(int(n), depth)
+	}
+	return nil, fmt.Errorf("invalid type byte 0x%02x", c)
+}
+
+func (d *msgpackDecoder) str(n int) (any, error) {
+	b, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) ext(n int) (any, error) {
+	typ, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+	// 时间戳扩展（type -1）的32位形式为秒数
+	if int8(typ[0]) == -1 && n == 4 {
+		return int64(binary.BigEndian.Uint32(raw)), nil
+	}
+	return map[string]any{"type": int64(int8(typ[0])), "data": base64.StdEncoding.EncodeToString(raw)}, nil
+}
+
+func (d *msgpackDecoder) array(n int, depth int) (any, error) {
+	// 每个元素至少占1字节，避免伪造的长度导致过量分配
+	if n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	list := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func (d *msgpackDecoder) mapValue(n int, depth int) (any, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	m := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[keyString(k)] = v
+	}
+	return m, nil
+}
+
+// keyString 将任意类型的map键转换为字符串
+func keyString(k any) string {
+	if s, ok := k.(string); ok {
+		return s
+	}
+	return fmt.Sprint(k)
+}
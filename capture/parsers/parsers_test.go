@@ -0,0 +1,245 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package parsers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func multipartBody(t *testing.T) ([]byte, string) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	require.NoError(t, w.WriteField("title", "hello"))
+	require.NoError(t, w.WriteField("tag", "a"))
+	require.NoError(t, w.WriteField("tag", "b"))
+	fw, err := w.CreateFormFile("upload", "logo.png")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte{0x89, 'P', 'N', 'G'})
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes(), w.Boundary()
+}
+
+// --- 测试代码 ---
+func TestParsers(t *testing.T) {
+	body, boundary := multipartBody(t)
+
+	tests := []struct {
+		name   string
+		parser Parser
+		body   []byte
+		params map[string]string
+		want   any
+	}{
+		{
+			name:   "json",
+			parser: JSON{},
+			body:   []byte(`{"id": 12345678901234567890, "tags": ["a"]}`),
+			want:   map[string]any{"id": json.Number("12345678901234567890"), "tags": []any{"a"}},
+		},
+		{
+			name:   "ndjson",
+			parser: JSON{},
+			body:   []byte("{\"a\": 1}\n{\"a\": 2}\n"),
+			want:   []any{map[string]any{"a": json.Number("1")}, map[string]any{"a": json.Number("2")}},
+		},
+		{
+			name:   "xml",
+			parser: XML{},
+			body:   []byte(`<?xml version="1.0"?><root id="1"><item>a</item><item>b</item><name lang="en">x</name>text</root>`),
+			want: map[string]any{"root": map[string]any{
+				"@id":   "1",
+				"item":  []any{"a", "b"},
+				"name":  map[string]any{"@lang": "en", "#text": "x"},
+				"#text": "text",
+			}},
+		},
+		{
+			name:   "form",
+			parser: Form{},
+			body:   []byte("q=go+lang&tag=a&tag=b"),
+			want:   map[string]any{"q": "go lang", "tag": []any{"a", "b"}},
+		},
+		{
+			name:   "multipart",
+			parser: Multipart{},
+			body:   body,
+			params: map[string]string{"boundary": boundary},
+			want: map[string]any{
+				"title":  "hello",
+				"tag":    []any{"a", "b"},
+				"upload": map[string]any{"filename": "logo.png", "content_type": "application/octet-stream", "size": 4},
+			},
+		},
+		{
+			name:   "protobuf",
+			parser: Protobuf{},
+			body: []byte{
+				0x08, 0x96, 0x01, // 1: 150
+				0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g', // 2: "testing"
+				0x1a, 0x02, 0x08, 0x01, // 3: {1: 1}
+				0x20, 0x01, 0x20, 0x02, // 4: [1, 2]
+				0x2d, 0x01, 0x00, 0x00, 0x00, // 5: fixed32 1
+				0x32, 0x02, 0xff, 0xfe, // 6: 非UTF-8字节
+			},
+			want: map[string]any{
+				"1": uint64(150),
+				"2": "testing",
+				"3": map[string]any{"1": uint64(1)},
+				"4": []any{uint64(1), uint64(2)},
+				"5": uint32(1),
+				"6": "//4=",
+			},
+		},
+		{
+			name:   "msgpack",
+			parser: MsgPack{},
+			body: []byte{
+				0x86,
+				0xa1, 'a', 0x01,
+				0xa1, 'b', 0x93, 0xc3, 0xc0, 0xa1, 'x',
+				0xa1, 'c', 0xfd,
+				0xa1, 'd', 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+				0xa1, 'e', 0xd1, 0xff, 0x00,
+				0xa1, 'f', 0x81, 0xcd, 0x01, 0x00, 0xc4, 0x02, 0x01, 0x02,
+			},
+			want: map[string]any{
+				"a": int64(1),
+				"b": []any{true, nil, "x"},
+				"c": int64(-3),
+				"d": 1.5,
+				"e": int64(-256),
+				"f": map[string]any{"256": "AQI="},
+			},
+		},
+		{
+			name:   "cbor",
+			parser: CBOR{},
+			body: []byte{
+				0xa7,
+				0x61, 'a', 0x01,
+				0x61, 'b', 0x9f, 0x02, 0x03, 0xff,
+				0x61, 'c', 0x38, 0x63,
+				0x61, 'd', 0xf9, 0xc4, 0x00,
+				0x61, 'e', 0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0,
+				0x61, 'f', 0x7f, 0x65, 's', 't', 'r', 'e', 'a', 0x64, 'm', 'i', 'n', 'g', 0xff,
+				0x61, 'g', 0x83, 0xf5, 0xf6, 0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			},
+			want: map[string]any{
+				"a": int64(1),
+				"b": []any{int64(2), int64(3)},
+				"c": int64(-100),
+				"d": -4.0,
+				"e": int64(1363896240),
+				"f": "streaming",
+				"g": []any{true, nil, uint64(math.MaxUint64)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parser.Parse(tt.body, tt.params)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParsers_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		parser Parser
+		body   []byte
+	}{
+		{"json", JSON{}, []byte(`{"a":`)},
+		{"xml truncated", XML{}, []byte(`<a><b>`)},
+		{"multipart without boundary", Multipart{}, []byte("x")},
+		{"protobuf truncated", Protobuf{}, []byte{0x12, 0x05, 'a'}},
+		{"protobuf wire type", Protobuf{}, []byte{0x0b}},
+		{"msgpack truncated", MsgPack{}, []byte{0x92, 0x01}},
+		{"msgpack trailing", MsgPack{}, []byte{0x01, 0x02}},
+		{"msgpack huge array", MsgPack{}, []byte{0xdd, 0xff, 0xff, 0xff, 0xff}},
+		{"cbor truncated", CBOR{}, []byte{0x82, 0x01}},
+		{"cbor stray break", CBOR{}, []byte{0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parser.Parse(tt.body, nil)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestHalfFloat(t *testing.T) {
+	require.Equal(t, 1.0, halfFloat(0x3c00))
+	require.Equal(t, 65504.0, halfFloat(0x7bff))
+	require.Equal(t, 5.960464477539063e-8, halfFloat(0x0001))
+	require.True(t, math.IsInf(halfFloat(0xfc00), -1))
+	require.True(t, math.IsNaN(halfFloat(0x7e00)))
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Register(JSON{}, "application/json", "+json")
+
+	p, ok := r.Lookup("Application/Problem+JSON")
+	require.True(t, ok)
+	require.Equal(t, "json", p.Name())
+	_, ok = r.Lookup("text/html")
+	require.False(t, ok)
+
+	parsed, err := r.Parse(http.Header{
+		"Content-Type":     {"application/json; charset=utf-8"},
+		"Content-Encoding": {"gzip"},
+	}, gzipped(t, `{"ok": true}`))
+	require.NoError(t, err)
+	require.Equal(t, &flow.Parsed{Format: "json", Value: map[string]any{"ok": true}}, parsed)
+
+	parsed, err = r.Parse(http.Header{"Content-Type": {"text/html"}}, []byte("<p>"))
+	require.NoError(t, err)
+	require.Nil(t, parsed)
+
+	_, err = r.Parse(http.Header{"Content-Type": {"application/json"}}, []byte("{"))
+	require.Error(t, err)
+}
+
+func TestAttach(t *testing.T) {
+	f := flow.New()
+	f.Request = &flow.Request{
+		Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+		Body:   []byte("a=1"),
+	}
+	f.Response = &flow.Response{
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Body:   []byte("not json"),
+	}
+	Attach(f)
+	require.Equal(t, "form", f.Request.Parsed.Format)
+	v, ok := f.Request.Parsed.Field("a")
+	require.True(t, ok)
+	require.Equal(t, "1", v)
+	require.Nil(t, f.Response.Parsed)
+}
@@ -0,0 +1,126 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package parsers
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// maxProtobufDepth 嵌套消息的最大递归深度
+const maxProtobufDepth = 32
+
+var errTruncated = errors.New("truncated message")
+
+// Protobuf 在没有schema的情况下按wire format解析protobuf消息，键为字段编号。
+// varint 解析为整数，fixed32/fixed64 解析为无符号整数，长度分隔字段依次尝试
+// 嵌套消息、UTF-8字符串，否则为base64；重复字段合并为数组
+type Protobuf struct{}
+
+// Name 实现 Parser 接口
+func (Protobuf) Name() string { return "protobuf" }
+
+// Parse 实现 Parser 接口
+func (Protobuf) Parse(body []byte, _ map[string]string) (any, error) {
+	v, err := DecodeProtobuf(body)
+	if err != nil {
+		return nil, fmt.Errorf("parse protobuf: %w", err)
+	}
+	return v, nil
+}
+
+// DecodeProtobuf 无schema解码protobuf消息，供其他基于protobuf的格式（例如gRPC）复用
+func DecodeProtobuf(data []byte) (map[string]any, error) {
+	return decodeMessage(data, 0)
+}
+
+func decodeMessage(data []byte, depth int) (map[string]any, error) {
+	msg := make(map[string]any)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		data = data[n:]
+		num, wireType := key>>3, key&7
+		if num == 0 {
+			return nil, errors.New("invalid field number 0")
+		}
+
+		var value any
+		switch wireType {
+		case 0:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errTruncated
+			}
+			data = data[n:]
+			value = v
+		case 1:
+			if len(data) < 8 {
+				return nil, errTruncated
+			}
+			value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return nil, errTruncated
+			}
+			value = decodeBytes(data[n:n+int(length)], depth)
+			data = data[n+int(length):]
+		case 5:
+			if len(data) < 4 {
+				return nil, errTruncated
+			}
+			value = binary.LittleEndian.Uint32(data)
+			data = data[4:]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", wireType)
+		}
+
+		name := strconv.FormatUint(num, 10)
+		switch existing := msg[name].(type) {
+		case nil:
+			msg[name] = value
+		case []any:
+			msg[name] = append(existing, value)
+		default:
+			msg[name] = []any{existing, value}
+		}
+	}
+	return msg, nil
+}
+
+// decodeBytes 猜测长度分隔字段的类型
+func decodeBytes(b []byte, depth int) any {
+	if len(b) > 0 && depth < maxProtobufDepth {
+		if nested, err := decodeMessage(b, depth+1); err == nil && !printable(b) {
+			return nested
+		}
+	}
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// printable 判断内容是否为可打印文本，可打印内容即使能按消息解析也优先视为字符串
+func printable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
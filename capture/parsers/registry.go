@@ -0,0 +1,136 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package parsers
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// MaxBodySize 参与解析的最大消息体（解码后），超出时不解析
+const MaxBodySize = 4 << 20
+
+// Parser 消息体解析器，返回由 map[string]any、[]any 和标量组成的结构化值
+type Parser interface {
+	// Name 解析器名称，记录在 flow.Parsed.Format 中
+	Name() string
+
+	// Parse 解析消息体，params 为 Content-Type 的参数（例如 multipart 的 boundary）
+	Parse(body []byte, params map[string]string) (any, error)
+}
+
+// Registry 按媒体类型查找解析器，可安全地并发使用
+type Registry struct {
+	mu     sync.RWMutex
+	exact  map[string]Parser
+	suffix map[string]Parser
+}
+
+// NewRegistry 创建空的解析器注册表
+func NewRegistry() *Registry {
+	return &Registry{
+		exact:  make(map[string]Parser),
+		suffix: make(map[string]Parser),
+	}
+}
+
+// Register 为媒体类型注册解析器，以 "+" 开头的类型匹配结构化语法后缀（例如 "+json"
+// 匹配 application/problem+json）。后注册的解析器覆盖先注册的
+func (r *Registry) Register(p Parser, mediaTypes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, mt := range mediaTypes {
+		mt = strings.ToLower(mt)
+		if strings.HasPrefix(mt, "+") {
+			r.suffix[mt] = p
+		} else {
+			r.exact[mt] = p
+		}
+	}
+}
+
+// Lookup 查找媒体类型对应的解析器
+func (r *Registry) Lookup(mediaType string) (Parser, bool) {
+	mediaType = strings.ToLower(mediaType)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if p, ok := r.exact[mediaType]; ok {
+		return p, true
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		if p, ok := r.suffix[mediaType[i:]]; ok {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Parse 按 Content-Type 解析消息体，先按 Content-Encoding 解码。
+// 没有对应的解析器时返回 nil, nil
+func (r *Registry) Parse(header http.Header, body []byte) (*flow.Parsed, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil
+	}
+	p, ok := r.Lookup(mediaType)
+	if !ok {
+		return nil, nil
+	}
+	decoded, _, err := flow.DecodeBody(header, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > MaxBodySize {
+		return nil, nil
+	}
+	value, err := p.Parse(decoded, params)
+	if err != nil {
+		return nil, err
+	}
+	return &flow.Parsed{Format: p.Name(), Value: value}, nil
+}
+
+// Attach 解析流的请求体和响应体并保存到 Parsed 字段，解析失败的消息体保持为nil
+func (r *Registry) Attach(f *flow.Flow) {
+	if f.Request != nil && f.Request.Parsed == nil {
+		f.Request.Parsed, _ = r.Parse(f.Request.Header, f.Request.Body)
+	}
+	if f.Response != nil && f.Response.Parsed == nil {
+		f.Response.Parsed, _ = r.Parse(f.Response.Header, f.Response.Body)
+	}
+}
+
+// Default 默认注册表，包含所有内置解析器
+var Default = NewRegistry()
+
+func init() {
+	Default.Register(JSON{}, "application/json", "text/json", "application/x-ndjson", "+json")
+	Default.Register(XML{}, "application/xml", "text/xml", "+xml")
+	Default.Register(Form{}, "application/x-www-form-urlencoded")
+	Default.Register(Multipart{}, "multipart/form-data", "multipart/mixed")
+	Default.Register(GRPCWeb{}, "application/grpc", "application/grpc+proto", "application/grpc-web", "application/grpc-web+proto")
+	Default.Register(GRPCWeb{Text: true}, "application/grpc-web-text", "application/grpc-web-text+proto")
+	Default.Register(Protobuf{}, "application/protobuf", "application/x-protobuf", "application/vnd.google.protobuf", "+proto")
+	Default.Register(MsgPack{}, "application/msgpack", "application/x-msgpack", "application/vnd.msgpack")
+	Default.Register(CBOR{}, "application/cbor", "+cbor")
+}
+
+// Register 向默认注册表注册解析器
+func Register(p Parser, mediaTypes ...string) {
+	Default.Register(p, mediaTypes...)
+}
+
+// Attach 使用默认注册表解析流
+func Attach(f *flow.Flow) {
+	Default.Attach(f)
+}
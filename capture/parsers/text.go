@@ -0,0 +1,209 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package parsers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxPartValue 多部分表单中以文本形式保存的最大字段值
+const maxPartValue = 64 << 10
+
+// JSON 解析JSON，数字保留原始文本（json.Number）以免丢失精度。
+// 换行分隔的多个JSON值（NDJSON）解析为数组
+type JSON struct{}
+
+// Name 实现 Parser 接口
+func (JSON) Name() string { return "json" }
+
+// Parse 实现 Parser 接口
+func (JSON) Parse(body []byte, _ map[string]string) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var values []any
+	for {
+		var v any
+		if err := dec.Decode(&v); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parse json: %w", err)
+		}
+		values = append(values, v)
+	}
+	switch len(values) {
+	case 0:
+		return nil, errors.New("parse json: empty body")
+	case 1:
+		return values[0], nil
+	default:
+		return values, nil
+	}
+}
+
+// XML 将XML文档转换为嵌套的map：属性以 "@" 为前缀，文本内容保存在 "#text"，
+// 重复的子元素合并为数组，只有文本的元素直接转换为字符串
+type XML struct{}
+
+// Name 实现 Parser 接口
+func (XML) Name() string { return "xml" }
+
+// Parse 实现 Parser 接口
+func (XML) Parse(body []byte, _ map[string]string) (any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("parse xml: %w", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			v, err := parseElement(dec, start)
+			if err != nil {
+				return nil, fmt.Errorf("parse xml: %w", err)
+			}
+			return map[string]any{start.Name.Local: v}, nil
+		}
+	}
+}
+
+// parseElement 解析元素直到对应的结束标签
+func parseElement(dec *xml.Decoder, start xml.StartElement) (any, error) {
+	node := make(map[string]any)
+	for _, attr := range start.Attr {
+		node["@"+attr.Name.Local] = attr.Value
+	}
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := parseElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			name := t.Name.Local
+			switch existing := node[name].(type) {
+			case nil:
+				node[name] = child
+			case []any:
+				node[name] = append(existing, child)
+			default:
+				node[name] = []any{existing, child}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			if len(node) == 0 {
+				return s, nil
+			}
+			if s != "" {
+				node["#text"] = s
+			}
+			return node, nil
+		}
+	}
+}
+
+// Form 解析 application/x-www-form-urlencoded，单值字段为字符串，多值字段为数组
+type Form struct{}
+
+// Name 实现 Parser 接口
+func (Form) Name() string { return "form" }
+
+// Parse 实现 Parser 接口
+func (Form) Parse(body []byte, _ map[string]string) (any, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("parse form: %w", err)
+	}
+	return valuesMap(values), nil
+}
+
+// Multipart 解析多部分表单：文本字段为字符串，文件字段为包含
+// filename、content_type、size 的map，同名字段合并为数组
+type Multipart struct{}
+
+// Name 实现 Parser 接口
+func (Multipart) Name() string { return "multipart" }
+
+// Parse 实现 Parser 接口
+func (Multipart) Parse(body []byte, params map[string]string) (any, error) {
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, errors.New("parse multipart: missing boundary")
+	}
+	out := make(map[string][]any)
+	r := multipart.NewReader(bytes.NewReader(body), boundary)
+	for i := 0; ; i++ {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse multipart: %w", err)
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("parse multipart: %w", err)
+		}
+
+		name := part.FormName()
+		if name == "" {
+			name = fmt.Sprintf("part%d", i)
+		}
+		var value any
+		if filename := part.FileName(); filename != "" || len(data) > maxPartValue || !utf8.Valid(data) {
+			value = map[string]any{
+				"filename":     filename,
+				"content_type": part.Header.Get("Content-Type"),
+				"size":         len(data),
+			}
+		} else {
+			value = string(data)
+		}
+		out[name] = append(out[name], value)
+	}
+
+	result := make(map[string]any, len(out))
+	for name, vs := range out {
+		if len(vs) == 1 {
+			result[name] = vs[0]
+		} else {
+			result[name] = vs
+		}
+	}
+	return result, nil
+}
+
+// valuesMap 将多值表单转换为map，单值字段为字符串
+func valuesMap(values url.Values) map[string]any {
+	m := make(map[string]any, len(values))
+	for k, vs := range values {
+		if len(vs) == 1 {
+			m[k] = vs[0]
+			continue
+		}
+		list := make([]any, len(vs))
+		for i, v := range vs {
+			list[i] = v
+		}
+		m[k] = list
+	}
+	return m
+}
@@ -0,0 +1,403 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package pcapng
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+const (
+	blockSectionHeader   = 0x0A0D0D0A
+	blockInterface       = 0x00000001
+	blockEnhancedPacket  = 0x00000006
+	byteOrderMagic       = 0x1A2B3C4D
+	optEnd               = 0
+	optComment           = 1
+	optShbUserAppl       = 4
+	optIfName            = 2
+	linkTypeRaw          = 101
+	tcpFlagFIN           = 0x01
+	tcpFlagSYN           = 0x02
+	tcpFlagPSH           = 0x08
+	tcpFlagACK           = 0x10
+	maxSegmentSize       = 1460
+	firstEphemeralPort   = 49152
+	clientISN, serverISN = 1000, 5000
+)
+
+var (
+	// fallbackClient 和 fallbackServer 在流中没有可用地址时使用（TEST-NET-1）
+	fallbackClient = net.IPv4(192, 0, 2, 100)
+	fallbackServer = net.IPv4(192, 0, 2, 1)
+)
+
+// Writer 将流写为合成的pcapng数据包：每个流对应一条独立的伪造TCP连接，
+// 其中承载HTTP/1.1格式的明文请求和响应，便于使用Wireshark的解析器分析。
+// 解密的HTTPS流同样以明文写入，HTTP/2流被转换为HTTP/1.1报文
+type Writer struct {
+	mu       sync.Mutex
+	w        *bufio.Writer
+	nextPort uint16
+}
+
+// NewWriter 创建写入器并写入节头和接口描述块
+func NewWriter(w io.Writer) (*Writer, error) {
+	pw := &Writer{w: bufio.NewWriter(w), nextPort: firstEphemeralPort}
+
+	var shb bytes.Buffer
+	le(&shb, uint32(byteOrderMagic))
+	le(&shb, uint16(1))
+	le(&shb, uint16(0))
+	le(&shb, int64(-1))
+	writeOption(&shb, optShbUserAppl, []byte("sniffy"))
+	writeOption(&shb, optEnd, nil)
+	if err := pw.block(blockSectionHeader, shb.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var idb bytes.Buffer
+	le(&idb, uint16(linkTypeRaw))
+	le(&idb, uint16(0))
+	le(&idb, uint32(0))
+	writeOption(&idb, optIfName, []byte("sniffy"))
+	writeOption(&idb, optEnd, nil)
+	if err := pw.block(blockInterface, idb.Bytes()); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// WriteFlow 将一个流写为一条TCP连接，非HTTP流（例如未解密的隧道）会被跳过
+func (pw *Writer) WriteFlow(f *flow.Flow) error {
+	if f == nil || f.Request == nil {
+		return nil
+	}
+	u, err := url.Parse(f.Request.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	c := &conn{w: pw}
+	c.client, c.server = endpoints(f, u)
+	c.clientPort = pw.nextPort
+	c.serverPort = 80
+	if pw.nextPort++; pw.nextPort == 0 {
+		pw.nextPort = firstEphemeralPort
+	}
+
+	start, end := f.StartTime, f.EndTime
+	if end.Before(start) {
+		end = start
+	}
+	c.clientSeq, c.serverSeq = clientISN, serverISN
+
+	// 三次握手，连接的注释记录流ID便于对照
+	c.comment = "sniffy flow " + f.ID
+	c.send(start, true, tcpFlagSYN, nil)
+	c.clientSeq++
+	c.send(start, false, tcpFlagSYN|tcpFlagACK, nil)
+	c.serverSeq++
+	c.send(start, true, tcpFlagACK, nil)
+
+	c.stream(start, true, requestBytes(f.Request, u))
+	if f.Response != nil {
+		c.stream(end, false, responseBytes(f.Response))
+	}
+
+	c.send(end, true, tcpFlagFIN|tcpFlagACK, nil)
+	c.clientSeq++
+	c.send(end, false, tcpFlagFIN|tcpFlagACK, nil)
+	c.serverSeq++
+	c.send(end, true, tcpFlagACK, nil)
+	return c.err
+}
+
+// Flush 将缓冲的数据写入底层写入器
+func (pw *Writer) Flush() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.w.Flush()
+}
+
+// Write 将所有流以pcapng格式写入 w
+func Write(w io.Writer, flows []*flow.Flow) error {
+	pw, err := NewWriter(w)
+	if err != nil {
+		return err
+	}
+	for _, f := range flows {
+		if err := pw.WriteFlow(f); err != nil {
+			return err
+		}
+	}
+	return pw.Flush()
+}
+
+// WriteFile 将所有流以pcapng格式写入文件
+func WriteFile(path string, flows []*flow.Flow) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create pcapng file: %w", err)
+	}
+	if err := Write(file, flows); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// block 写入一个pcapng块，body 的长度必须是4的倍数
+func (pw *Writer) block(blockType uint32, body []byte) error {
+	total := uint32(12 + len(body))
+	var buf bytes.Buffer
+	le(&buf, blockType)
+	le(&buf, total)
+	buf.Write(body)
+	le(&buf, total)
+	if _, err := pw.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write pcapng block: %w", err)
+	}
+	return nil
+}
+
+// packet 写入增强数据包块
+func (pw *Writer) packet(ts time.Time, data []byte, comment string) error {
+	micros := uint64(ts.UnixMicro())
+	var body bytes.Buffer
+	le(&body, uint32(0))
+	le(&body, uint32(micros>>32))
+	le(&body, uint32(micros))
+	le(&body, uint32(len(data)))
+	le(&body, uint32(len(data)))
+	body.Write(data)
+	body.Write(make([]byte, pad(len(data))))
+	if comment != "" {
+		writeOption(&body, optComment, []byte(comment))
+		writeOption(&body, optEnd, nil)
+	}
+	return pw.block(blockEnhancedPacket, body.Bytes())
+}
+
+// conn 一条合成的TCP连接
+type conn struct {
+	w *Writer
+
+	client, server         net.IP
+	clientPort, serverPort uint16
+	clientSeq, serverSeq   uint32
+
+	// comment 写入下一个数据包的注释
+	comment string
+	err     error
+}
+
+// stream 按MSS分段发送数据
+func (c *conn) stream(ts time.Time, fromClient bool, data []byte) {
+	for len(data) > 0 {
+		n := min(len(data), maxSegmentSize)
+		c.send(ts, fromClient, tcpFlagPSH|tcpFlagACK, data[:n])
+		if fromClient {
+			c.clientSeq += uint32(n)
+		} else {
+			c.serverSeq += uint32(n)
+		}
+		data = data[n:]
+	}
+}
+
+// send 构造并写入一个TCP数据包
+func (c *conn) send(ts time.Time, fromClient bool, flags byte, payload []byte) {
+	if c.err != nil {
+		return
+	}
+	src, dst := c.client, c.server
+	sport, dport := c.clientPort, c.serverPort
+	seq, ack := c.clientSeq, c.serverSeq
+	if !fromClient {
+		src, dst = dst, src
+		sport, dport = dport, sport
+		seq, ack = ack, seq
+	}
+	if flags&tcpFlagACK == 0 {
+		ack = 0
+	}
+
+	tcp := make([]byte, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[0:], sport)
+	binary.BigEndian.PutUint16(tcp[2:], dport)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	binary.BigEndian.PutUint32(tcp[8:], ack)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	copy(tcp[20:], payload)
+	binary.BigEndian.PutUint16(tcp[16:], tcpChecksum(src, dst, tcp))
+
+	c.err = c.w.packet(ts, ipPacket(src, dst, tcp), c.comment)
+	c.comment = ""
+}
+
+// endpoints 返回连接两端的地址，地址族不一致时IPv4地址映射为IPv6
+func endpoints(f *flow.Flow, u *url.URL) (client, server net.IP) {
+	client = hostIP(f.ClientAddr)
+	server = hostIP(f.ServerAddr)
+	if server == nil {
+		server = net.ParseIP(u.Hostname())
+	}
+	if client == nil {
+		client = fallbackClient
+	}
+	if server == nil {
+		server = fallbackServer
+	}
+	if (client.To4() == nil) != (server.To4() == nil) {
+		return client.To16(), server.To16()
+	}
+	return client, server
+}
+
+// hostIP 解析 host:port 或IP地址中的IP
+func hostIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(addr)
+}
+
+// requestBytes 将请求序列化为HTTP/1.1报文，内容长度按捕获的请求体重新计算
+func requestBytes(r *flow.Request, u *url.URL) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", r.Method, u.RequestURI())
+	host := r.Host
+	if host == "" {
+		host = u.Host
+	}
+	fmt.Fprintf(&buf, "Host: %s\r\n", host)
+	writeHeader(&buf, r.Header, r.Body, len(r.Body) > 0)
+	buf.Write(r.Body)
+	return buf.Bytes()
+}
+
+// responseBytes 将响应序列化为HTTP/1.1报文
+func responseBytes(r *flow.Response) []byte {
+	var buf bytes.Buffer
+	status := r.Status
+	if status == "" || !strings.HasPrefix(status, strconv.Itoa(r.StatusCode)) {
+		status = strconv.Itoa(r.StatusCode) + " " + http.StatusText(r.StatusCode)
+	}
+	fmt.Fprintf(&buf, "HTTP/1.1 %s\r\n", status)
+	bodyAllowed := r.StatusCode >= 200 && r.StatusCode != http.StatusNoContent && r.StatusCode != http.StatusNotModified
+	writeHeader(&buf, r.Header, r.Body, bodyAllowed)
+	buf.Write(r.Body)
+	return buf.Bytes()
+}
+
+// writeHeader 写入头部，移除分块编码并按内容重写 Content-Length
+func writeHeader(buf *bytes.Buffer, h http.Header, body []byte, withLength bool) {
+	h = h.Clone()
+	h.Del("Host")
+	h.Del("Transfer-Encoding")
+	h.Del("Content-Length")
+	if withLength {
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	_ = h.Write(buf)
+	buf.WriteString("\r\n")
+}
+
+// ipPacket 构造IPv4或IPv6数据包
+func ipPacket(src, dst net.IP, payload []byte) []byte {
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		pkt := make([]byte, 20+len(payload))
+		pkt[0] = 0x45
+		binary.BigEndian.PutUint16(pkt[2:], uint16(len(pkt)))
+		binary.BigEndian.PutUint16(pkt[6:], 0x4000)
+		pkt[8] = 64
+		pkt[9] = 6
+		copy(pkt[12:], src4)
+		copy(pkt[16:], dst4)
+		binary.BigEndian.PutUint16(pkt[10:], checksum(pkt[:20], 0))
+		copy(pkt[20:], payload)
+		return pkt
+	}
+
+	pkt := make([]byte, 40+len(payload))
+	pkt[0] = 0x60
+	binary.BigEndian.PutUint16(pkt[4:], uint16(len(payload)))
+	pkt[6] = 6
+	pkt[7] = 64
+	copy(pkt[8:], src.To16())
+	copy(pkt[24:], dst.To16())
+	copy(pkt[40:], payload)
+	return pkt
+}
+
+// tcpChecksum 计算包含伪头部的TCP校验和
+func tcpChecksum(src, dst net.IP, segment []byte) uint16 {
+	var pseudo []byte
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		pseudo = append(append(pseudo, src4...), dst4...)
+		pseudo = append(pseudo, 0, 6, byte(len(segment)>>8), byte(len(segment)))
+	} else {
+		pseudo = append(append(pseudo, src.To16()...), dst.To16()...)
+		pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(segment)))
+		pseudo = append(pseudo, 0, 0, 0, 6)
+	}
+	return checksum(segment, sum(pseudo))
+}
+
+// checksum 计算互联网校验和，initial 为已累加的部分和
+func checksum(data []byte, initial uint32) uint16 {
+	s := initial + sum(data)
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+	return ^uint16(s)
+}
+
+func sum(data []byte) uint32 {
+	var s uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		s += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		s += uint32(data[len(data)-1]) << 8
+	}
+	return s
+}
+
+// writeOption 写入一个块选项，值按4字节对齐
+func writeOption(buf *bytes.Buffer, code uint16, value []byte) {
+	le(buf, code)
+	le(buf, uint16(len(value)))
+	buf.Write(value)
+	buf.Write(make([]byte, pad(len(value))))
+}
+
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
+
+func le(buf *bytes.Buffer, v any) {
+	_ = binary.Write(buf, binary.LittleEndian, v)
+}
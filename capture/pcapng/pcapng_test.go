@@ -0,0 +1,187 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// block 解析出的pcapng块
+type block struct {
+	typ  uint32
+	body []byte
+}
+
+// packetData 增强数据包块中的数据和注释
+type packetData struct {
+	data    []byte
+	comment string
+	ts      time.Time
+}
+
+func parseBlocks(t *testing.T, raw []byte) []block {
+	var blocks []block
+	for len(raw) > 0 {
+		require.GreaterOrEqual(t, len(raw), 12)
+		typ := binary.LittleEndian.Uint32(raw)
+		total := binary.LittleEndian.Uint32(raw[4:])
+		require.Zero(t, total%4, "block length must be aligned")
+		require.Equal(t, total, binary.LittleEndian.Uint32(raw[total-4:]))
+		blocks = append(blocks, block{typ, raw[8 : total-4]})
+		raw = raw[total:]
+	}
+	return blocks
+}
+
+func parsePacket(b block) packetData {
+	ts := uint64(binary.LittleEndian.Uint32(b.body[4:]))<<32 | uint64(binary.LittleEndian.Uint32(b.body[8:]))
+	n := int(binary.LittleEndian.Uint32(b.body[12:]))
+	p := packetData{data: b.body[20 : 20+n], ts: time.UnixMicro(int64(ts))}
+	opts := b.body[20+n+pad(n):]
+	for len(opts) >= 4 {
+		code := binary.LittleEndian.Uint16(opts)
+		length := int(binary.LittleEndian.Uint16(opts[2:]))
+		if code == optComment {
+			p.comment = string(opts[4 : 4+length])
+		}
+		opts = opts[4+length+pad(length):]
+	}
+	return p
+}
+
+// tcpPayloads 按方向拼接TCP负载，并校验IP和TCP校验和
+func tcpPayloads(t *testing.T, packets []packetData) (client, server string) {
+	for _, p := range packets {
+		src, dst, segment := addresses(p.data)
+		if p.data[0]>>4 == 4 {
+			require.Equal(t, uint16(0), checksum(p.data[:20], 0))
+		}
+		require.Equal(t, binary.BigEndian.Uint16(segment[16:]), tcpChecksum(src, dst, zeroChecksum(segment)))
+		if binary.BigEndian.Uint16(segment[2:]) == 80 {
+			client += string(segment[20:])
+		} else {
+			server += string(segment[20:])
+		}
+	}
+	return client, server
+}
+
+// addresses 返回数据包的源地址、目的地址和TCP段
+func addresses(pkt []byte) (src, dst net.IP, segment []byte) {
+	if pkt[0]>>4 == 4 {
+		return pkt[12:16], pkt[16:20], pkt[20:]
+	}
+	return pkt[8:24], pkt[24:40], pkt[40:]
+}
+
+func zeroChecksum(segment []byte) []byte {
+	s := append([]byte(nil), segment...)
+	s[16], s[17] = 0, 0
+	return s
+}
+
+func capturedFlow() *flow.Flow {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &flow.Flow{
+		ID:         "abc",
+		StartTime:  start,
+		EndTime:    start.Add(20 * time.Millisecond),
+		ClientAddr: "10.1.1.1:51000",
+		ServerAddr: "93.184.216.34:443",
+		Request: &flow.Request{
+			Method: "POST",
+			URL:    "https://example.com/upload?x=1",
+			Host:   "example.com",
+			Proto:  "HTTP/2.0",
+			Header: http.Header{"Content-Type": {"text/plain"}, "Transfer-Encoding": {"chunked"}},
+			Body:   []byte(strings.Repeat("a", 3000)),
+		},
+		Response: &flow.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Proto:      "HTTP/2.0",
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+			Body:       []byte("done"),
+		},
+	}
+}
+
+// --- 测试代码 ---
+func TestWrite(t *testing.T) {
+	tunnel := capturedFlow()
+	tunnel.Request.URL = "tcp://example.com:443"
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, []*flow.Flow{capturedFlow(), tunnel}))
+
+	blocks := parseBlocks(t, buf.Bytes())
+	require.Equal(t, uint32(blockSectionHeader), blocks[0].typ)
+	require.Equal(t, uint32(byteOrderMagic), binary.LittleEndian.Uint32(blocks[0].body))
+	require.Equal(t, uint32(blockInterface), blocks[1].typ)
+	require.Equal(t, uint16(linkTypeRaw), binary.LittleEndian.Uint16(blocks[1].body))
+
+	var packets []packetData
+	for _, b := range blocks[2:] {
+		require.Equal(t, uint32(blockEnhancedPacket), b.typ)
+		packets = append(packets, parsePacket(b))
+	}
+	// 握手3个 + 请求3段 + 响应1段 + 挥手3个，隧道流被跳过
+	require.Len(t, packets, 10)
+	require.Equal(t, "sniffy flow abc", packets[0].comment)
+	require.Empty(t, packets[1].comment)
+	require.True(t, packets[0].ts.Equal(capturedFlow().StartTime))
+	require.True(t, packets[9].ts.Equal(capturedFlow().EndTime))
+
+	client, server := tcpPayloads(t, packets)
+	require.True(t, strings.HasPrefix(client, "POST /upload?x=1 HTTP/1.1\r\nHost: example.com\r\n"))
+	require.Contains(t, client, "Content-Length: 3000\r\n")
+	require.NotContains(t, client, "Transfer-Encoding")
+	require.True(t, strings.HasSuffix(client, "\r\n\r\n"+strings.Repeat("a", 3000)))
+	require.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 4\r\nContent-Type: text/plain\r\n\r\ndone", server)
+}
+
+func TestEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		client     string
+		server     string
+		url        string
+		wantClient string
+		wantServer string
+		wantIPv6   bool
+	}{
+		{"addresses", "10.1.1.1:5000", "93.184.216.34:443", "https://example.com/", "10.1.1.1", "93.184.216.34", false},
+		{"ip host", "", "", "http://127.0.0.1:8000/", "192.0.2.100", "127.0.0.1", false},
+		{"fallback", "", "", "http://example.com/", "192.0.2.100", "192.0.2.1", false},
+		{"ipv6", "[2001:db8::2]:5000", "[2001:db8::1]:443", "https://example.com/", "2001:db8::2", "2001:db8::1", true},
+		{"mixed families", "10.1.1.1:5000", "[2001:db8::1]:443", "https://example.com/", "::ffff:10.1.1.1", "2001:db8::1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := capturedFlow()
+			f.ClientAddr, f.ServerAddr, f.Request.URL = tt.client, tt.server, tt.url
+			var buf bytes.Buffer
+			require.NoError(t, Write(&buf, []*flow.Flow{f}))
+
+			syn := parsePacket(parseBlocks(t, buf.Bytes())[2])
+			src, dst, _ := addresses(syn.data)
+			require.Equal(t, tt.wantIPv6, syn.data[0]>>4 == 6)
+			require.True(t, net.ParseIP(tt.wantClient).Equal(src))
+			require.True(t, net.ParseIP(tt.wantServer).Equal(dst))
+		})
+	}
+}
@@ -0,0 +1,491 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// DefaultMaxIdle 每个源站默认保留的空闲HTTP/1.1连接数
+const DefaultMaxIdle = 8
+
+// DefaultIdleTimeout 空闲连接默认的保留时间
+const DefaultIdleTimeout = 90 * time.Second
+
+// Key 连接池的键，键相同的请求可以复用连接
+type Key struct {
+	// Scheme 上游协议：http 或 https
+	Scheme string
+
+	// Addr 上游的 host:port
+	Addr string
+
+	// ServerName TLS握手使用的SNI，仅 https
+	ServerName string
+
+	// Source 连接只能用于该客户端，例如向上游发送了携带客户端地址的PROXY protocol头部，为空表示可以共享
+	Source string
+
+	// ClientCert 连接出示的请求指定的客户端证书标识，为空表示使用按主机配置的证书
+	ClientCert string
+}
+
+// String 返回键的文本形式
+func (k Key) String() string {
+	s := k.Scheme + "://" + k.Addr
+	if host, _, _ := net.SplitHostPort(k.Addr); k.ServerName != "" && k.ServerName != host {
+		s += " (sni " + k.ServerName + ")"
+	}
+	if k.Source != "" {
+		s += " for " + k.Source
+	}
+	if k.ClientCert != "" {
+		s += " with client certificate " + k.ClientCert[:min(len(k.ClientCert), 12)]
+	}
+	return s
+}
+
+// DialFunc 建立到上游的新连接，https 连接需要完成TLS握手
+type DialFunc func(ctx context.Context) (net.Conn, error)
+
+// Pool 按源站复用的上游连接池：HTTP/1.1连接用完后放回空闲列表，
+// 协商出h2的连接在多个请求间并发复用，并可合并证书覆盖且解析到相同IP的其他源站。
+// 并发安全，nil Pool 每次都建立新连接
+type Pool struct {
+	mu          sync.Mutex
+	maxIdle     int
+	idleTimeout time.Duration
+	idle        map[Key][]*Conn
+	inUse       map[Key]int
+	h2          map[Key][]*h2Conn
+	closed      bool
+
+	// transport 创建h2连接，为nil时不使用h2
+	transport *http2.Transport
+
+	// resolve 解析主机名，用于判断h2连接能否合并
+	resolve func(ctx context.Context, host string) ([]string, error)
+
+	dials     atomic.Int64
+	reused    atomic.Int64
+	coalesced atomic.Int64
+	expired   atomic.Int64
+}
+
+// h2Conn 池中的h2连接
+type h2Conn struct {
+	cc   *http2.ClientConn
+	conn net.Conn
+}
+
+// New 创建连接池，maxIdle 为每个源站保留的空闲HTTP/1.1连接数，idleTimeout 为空闲连接的保留时间
+func New(maxIdle int, idleTimeout time.Duration) *Pool {
+	return &Pool{
+		maxIdle:     maxIdle,
+		idleTimeout: idleTimeout,
+		idle:        make(map[Key][]*Conn),
+		inUse:       make(map[Key]int),
+		h2:          make(map[Key][]*h2Conn),
+	}
+}
+
+// EnableHTTP2 允许与上游协商h2，resolve 用于连接合并时解析主机名，为nil时不合并连接
+func (p *Pool) EnableHTTP2(resolve func(ctx context.Context, host string) ([]string, error)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.transport = &http2.Transport{IdleConnTimeout: p.idleTimeout}
+	p.resolve = resolve
+}
+
+// HTTP2 返回是否应与上游协商h2
+func (p *Pool) HTTP2() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.transport != nil
+}
+
+// Get 返回键对应的连接，依次尝试已有的h2连接、空闲的HTTP/1.1连接和可合并的h2连接，都没有时调用 dial 建立新连接
+func (p *Pool) Get(ctx context.Context, key Key, dial DialFunc) (*Conn, error) {
+	if p == nil {
+		return p.Dial(ctx, key, dial)
+	}
+	p.mu.Lock()
+	if c := p.takeLocked(key); c != nil {
+		p.mu.Unlock()
+		p.reused.Add(1)
+		return c, nil
+	}
+	canCoalesce := key.Scheme == "https" && p.resolve != nil && len(p.h2) > 0
+	resolve := p.resolve
+	p.mu.Unlock()
+
+	if canCoalesce {
+		if c := p.coalesce(ctx, key, resolve); c != nil {
+			p.coalesced.Add(1)
+			return c, nil
+		}
+	}
+	return p.Dial(ctx, key, dial)
+}
+
+// takeLocked 取出键对应的h2连接或空闲的HTTP/1.1连接
+func (p *Pool) takeLocked(key Key) *Conn {
+	if h := p.usableH2Locked(key); h != nil {
+		return &Conn{Conn: h.conn, key: key, h2: h, reused: true}
+	}
+	conns := p.idle[key]
+	for len(conns) > 0 {
+		c := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		// 停止失败表示连接已过期，正在被关闭
+		if c.timer.Stop() {
+			p.setIdleLocked(key, conns)
+			p.inUse[key]++
+			c.reused = true
+			return c
+		}
+	}
+	p.setIdleLocked(key, conns)
+	return nil
+}
+
+// usableH2Locked 返回键对应的可以处理新请求的h2连接，同时移除已关闭的连接
+func (p *Pool) usableH2Locked(key Key) *h2Conn {
+	conns := slices.DeleteFunc(p.h2[key], func(h *h2Conn) bool {
+		return h.cc.State().Closed
+	})
+	if len(conns) == 0 {
+		delete(p.h2, key)
+		return nil
+	}
+	p.h2[key] = conns
+	for _, h := range conns {
+		if h.cc.CanTakeNewRequest() {
+			return h
+		}
+	}
+	return nil
+}
+
+// coalesce 查找可以合并的h2连接：证书覆盖 key.ServerName，且对端IP是 key.Addr 解析结果之一
+func (p *Pool) coalesce(ctx context.Context, key Key, resolve func(context.Context, string) ([]string, error)) *Conn {
+	host, _, err := net.SplitHostPort(key.Addr)
+	if err != nil {
+		return nil
+	}
+	addrs, err := resolve(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for other := range p.h2 {
+		if other.Scheme != key.Scheme || other.Source != key.Source || other.ClientCert != key.ClientCert {
+			continue
+		}
+		h := p.usableH2Locked(other)
+		if h == nil || !h.covers(key.ServerName, addrs) {
+			continue
+		}
+		// 之后相同源站的请求直接使用该连接
+		p.h2[key] = append(p.h2[key], h)
+		return &Conn{Conn: h.conn, key: key, h2: h, reused: true}
+	}
+	return nil
+}
+
+// covers 判断连接的证书是否覆盖 serverName，且对端IP属于 addrs
+func (h *h2Conn) covers(serverName string, addrs []string) bool {
+	tc, ok := h.conn.(interface{ ConnectionState() tls.ConnectionState })
+	if !ok {
+		return false
+	}
+	certs := tc.ConnectionState().PeerCertificates
+	if len(certs) == 0 || certs[0].VerifyHostname(serverName) != nil {
+		return false
+	}
+	ip, _, err := net.SplitHostPort(h.conn.RemoteAddr().String())
+	if err != nil {
+		return false
+	}
+	peer := net.ParseIP(ip)
+	for _, addr := range addrs {
+		if peer.Equal(net.ParseIP(addr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dial 调用 dial 建立新连接，连接协商出h2且启用了h2时加入池中供其他请求并发使用
+func (p *Pool) Dial(ctx context.Context, key Key, dial DialFunc) (*Conn, error) {
+	conn, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return &Conn{Conn: conn, Reader: bufio.NewReader(conn), key: key}, nil
+	}
+	p.dials.Add(1)
+
+	p.mu.Lock()
+	transport := p.transport
+	p.mu.Unlock()
+	if tc, ok := conn.(interface{ ConnectionState() tls.ConnectionState }); ok && transport != nil &&
+		tc.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+		cc, err := transport.NewClientConn(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		h := &h2Conn{cc: cc, conn: conn}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.closed {
+			cc.SetDoNotReuse()
+		} else {
+			p.h2[key] = append(p.h2[key], h)
+		}
+		return &Conn{Conn: conn, key: key, h2: h}, nil
+	}
+
+	p.mu.Lock()
+	p.inUse[key]++
+	p.mu.Unlock()
+	return &Conn{Conn: conn, Reader: bufio.NewReader(conn), key: key, pool: p}, nil
+}
+
+// put 放回用完的HTTP/1.1连接，超出空闲数量限制时关闭
+func (p *Pool) put(c *Conn, reusable bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inUse[c.key]--; p.inUse[c.key] <= 0 {
+		delete(p.inUse, c.key)
+	}
+	if !reusable || p.closed || len(p.idle[c.key]) >= p.maxIdle {
+		c.Conn.Close()
+		return
+	}
+	c.timer = time.AfterFunc(p.idleTimeout, func() { p.expire(c) })
+	p.idle[c.key] = append(p.idle[c.key], c)
+}
+
+// expire 关闭超过保留时间的空闲连接
+func (p *Pool) expire(c *Conn) {
+	p.mu.Lock()
+	p.setIdleLocked(c.key, slices.DeleteFunc(p.idle[c.key], func(i *Conn) bool { return i == c }))
+	p.mu.Unlock()
+	p.expired.Add(1)
+	c.Conn.Close()
+}
+
+func (p *Pool) setIdleLocked(key Key, conns []*Conn) {
+	if len(conns) == 0 {
+		delete(p.idle, key)
+	} else {
+		p.idle[key] = conns
+	}
+}
+
+// Close 关闭所有空闲连接，h2连接在正在处理的请求完成后关闭。之后放回的连接会被直接关闭
+func (p *Pool) Close() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for key, conns := range p.idle {
+		for _, c := range conns {
+			if c.timer.Stop() {
+				c.Conn.Close()
+			}
+		}
+		delete(p.idle, key)
+	}
+	for key, conns := range p.h2 {
+		for _, h := range conns {
+			h.cc.SetDoNotReuse()
+			go h.cc.Shutdown(context.Background())
+		}
+		delete(p.h2, key)
+	}
+	return nil
+}
+
+// Stats 连接池的统计
+type Stats struct {
+	// Dials 建立的新连接数
+	Dials int64 `json:"dials"`
+
+	// Reused 复用已有连接的请求数
+	Reused int64 `json:"reused"`
+
+	// Coalesced 合并到其他源站h2连接的请求数
+	Coalesced int64 `json:"coalesced"`
+
+	// Expired 因空闲超时关闭的连接数
+	Expired int64 `json:"expired"`
+
+	// Origins 各源站当前的连接
+	Origins []OriginStats `json:"origins"`
+}
+
+// OriginStats 一个源站当前的连接
+type OriginStats struct {
+	Origin string `json:"origin"`
+
+	// Idle 和 InUse 空闲和使用中的HTTP/1.1连接数
+	Idle  int `json:"idle"`
+	InUse int `json:"in_use"`
+
+	// HTTP2 可用的h2连接数，合并的连接同时计入各个源站
+	HTTP2 int `json:"http2"`
+
+	// Streams h2连接上正在处理的请求数
+	Streams int `json:"streams"`
+}
+
+// Stats 返回连接池的统计，nil Pool 返回零值
+func (p *Pool) Stats() Stats {
+	if p == nil {
+		return Stats{Origins: []OriginStats{}}
+	}
+	s := Stats{
+		Dials:     p.dials.Load(),
+		Reused:    p.reused.Load(),
+		Coalesced: p.coalesced.Load(),
+		Expired:   p.expired.Load(),
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	origins := make(map[Key]*OriginStats)
+	origin := func(key Key) *OriginStats {
+		if o, ok := origins[key]; ok {
+			return o
+		}
+		o := &OriginStats{Origin: key.String()}
+		origins[key] = o
+		return o
+	}
+	for key, conns := range p.idle {
+		origin(key).Idle = len(conns)
+	}
+	for key, n := range p.inUse {
+		origin(key).InUse = n
+	}
+	for key, conns := range p.h2 {
+		for _, h := range conns {
+			if st := h.cc.State(); !st.Closed {
+				o := origin(key)
+				o.HTTP2++
+				o.Streams += st.StreamsActive
+			}
+		}
+	}
+	s.Origins = make([]OriginStats, 0, len(origins))
+	for _, o := range origins {
+		s.Origins = append(s.Origins, *o)
+	}
+	sort.Slice(s.Origins, func(i, j int) bool { return s.Origins[i].Origin < s.Origins[j].Origin })
+	return s
+}
+
+// Conn 从池中取出的上游连接。HTTP/1.1连接通过 Reader 读取响应，用完后调用 Release；
+// h2连接通过 RoundTrip 发送请求
+type Conn struct {
+	net.Conn
+
+	// Reader 读取HTTP/1.1响应的缓冲读取器，在连接复用期间保持不变，h2连接为nil
+	Reader *bufio.Reader
+
+	key    Key
+	pool   *Pool
+	h2     *h2Conn
+	reused bool
+	timer  *time.Timer
+}
+
+// Key 返回连接所属的键
+func (c *Conn) Key() Key {
+	return c.key
+}
+
+// Reused 返回连接是否之前已处理过请求
+func (c *Conn) Reused() bool {
+	return c.reused
+}
+
+// HTTP2 返回连接是否为h2连接
+func (c *Conn) HTTP2() bool {
+	return c.h2 != nil
+}
+
+// RoundTrip 在h2连接上发送请求，req.URL 需要包含协议和主机
+func (c *Conn) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c.h2 == nil {
+		return nil, errors.New("round trip on HTTP/1.1 connection")
+	}
+	return c.h2.cc.RoundTrip(req)
+}
+
+// Release 归还连接，reusable 为true时HTTP/1.1连接放回空闲列表，调用前需要读完响应体。
+// h2连接由所有请求共享，不可复用时不再分配给新请求
+func (c *Conn) Release(reusable bool) {
+	if c.h2 != nil {
+		if !reusable {
+			c.h2.cc.SetDoNotReuse()
+		}
+		return
+	}
+	c.Conn.SetDeadline(time.Time{})
+	if c.Reader.Buffered() > 0 {
+		// 上游发送了响应之外的数据
+		reusable = false
+	}
+	if c.pool == nil {
+		c.Conn.Close()
+		return
+	}
+	c.pool.put(c, reusable)
+}
+
+// Retryable 判断复用的连接在收到响应前失败后，能否在新连接上重试请求：
+// HTTP/1.1连接是上游关闭了空闲连接，h2连接是上游拒绝了新请求
+func (c *Conn) Retryable(err error) bool {
+	if !c.reused || err == nil {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return false
+	}
+	if c.h2 != nil {
+		var se http2.StreamError
+		var goAway http2.GoAwayError
+		return (errors.As(err, &se) && se.Code == http2.ErrCodeRefusedStream) ||
+			errors.As(err, &goAway) || !c.h2.cc.CanTakeNewRequest()
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, net.ErrClosed)
+}
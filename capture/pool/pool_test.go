@@ -0,0 +1,230 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package pool
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// countingServer 启动记录新建连接数的HTTP服务器
+func countingServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	conns := &atomic.Int32{}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	t.Cleanup(srv.Close)
+	return srv, conns
+}
+
+// tcpDial 返回连接 addr 的拨号函数
+func tcpDial(addr string) DialFunc {
+	return func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
+	}
+}
+
+// tlsDial 返回以 serverName 连接 addr 并声明h2的拨号函数
+func tlsDial(srv *httptest.Server, addr, serverName string) DialFunc {
+	return func(ctx context.Context) (net.Conn, error) {
+		d := &tls.Dialer{Config: &tls.Config{
+			ServerName: serverName,
+			RootCAs:    srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+			NextProtos: []string{"h2", "http/1.1"},
+		}}
+		return d.DialContext(ctx, "tcp", addr)
+	}
+}
+
+// get 通过HTTP/1.1连接发送请求并读完响应
+func get(t *testing.T, c *Conn, host string) string {
+	t.Helper()
+	_, err := fmt.Fprintf(c, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", host)
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(c.Reader, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	c.Release(!resp.Close)
+	return string(body)
+}
+
+// --- 测试代码 ---
+
+func TestPool_ReuseHTTP1(t *testing.T) {
+	srv, conns := countingServer(t)
+	srv.Start()
+	addr := srv.Listener.Addr().String()
+	p := New(1, time.Minute)
+	defer p.Close()
+	key := Key{Scheme: "http", Addr: addr}
+
+	for i := range 3 {
+		c, err := p.Get(context.Background(), key, tcpDial(addr))
+		require.NoError(t, err)
+		require.Equal(t, i > 0, c.Reused())
+		require.False(t, c.HTTP2())
+		require.Equal(t, "HTTP/1.1", get(t, c, addr))
+	}
+	require.Equal(t, int32(1), conns.Load())
+
+	// 同时使用两个连接时，超出空闲数量限制的连接被关闭
+	c1, err := p.Get(context.Background(), key, tcpDial(addr))
+	require.NoError(t, err)
+	c2, err := p.Get(context.Background(), key, tcpDial(addr))
+	require.NoError(t, err)
+	require.Equal(t, []OriginStats{{Origin: "http://" + addr, InUse: 2}}, p.Stats().Origins)
+	get(t, c1, addr)
+	get(t, c2, addr)
+
+	st := p.Stats()
+	require.Equal(t, int64(2), st.Dials)
+	require.Equal(t, int64(3), st.Reused)
+	require.Equal(t, []OriginStats{{Origin: "http://" + addr, Idle: 1}}, st.Origins)
+
+	// 不可复用的连接直接关闭
+	c, err := p.Get(context.Background(), key, tcpDial(addr))
+	require.NoError(t, err)
+	c.Release(false)
+	require.Empty(t, p.Stats().Origins)
+}
+
+func TestPool_IdleTimeout(t *testing.T) {
+	srv, conns := countingServer(t)
+	srv.Start()
+	addr := srv.Listener.Addr().String()
+	p := New(4, 50*time.Millisecond)
+	key := Key{Scheme: "http", Addr: addr}
+
+	c, err := p.Get(context.Background(), key, tcpDial(addr))
+	require.NoError(t, err)
+	get(t, c, addr)
+	require.Eventually(t, func() bool { return p.Stats().Expired == 1 }, time.Second, 10*time.Millisecond)
+	require.Empty(t, p.Stats().Origins)
+
+	c, err = p.Get(context.Background(), key, tcpDial(addr))
+	require.NoError(t, err)
+	require.False(t, c.Reused())
+	get(t, c, addr)
+	require.Equal(t, int32(2), conns.Load())
+
+	// 关闭后放回的连接不再保留
+	c, err = p.Get(context.Background(), key, tcpDial(addr))
+	require.NoError(t, err)
+	require.NoError(t, p.Close())
+	get(t, c, addr)
+	require.Empty(t, p.Stats().Origins)
+}
+
+func TestPool_Retryable(t *testing.T) {
+	srv, _ := countingServer(t)
+	srv.Start()
+	addr := srv.Listener.Addr().String()
+	p := New(1, time.Minute)
+	defer p.Close()
+	key := Key{Scheme: "http", Addr: addr}
+
+	c, err := p.Get(context.Background(), key, tcpDial(addr))
+	require.NoError(t, err)
+	require.False(t, c.Retryable(io.EOF))
+	get(t, c, addr)
+
+	// 服务器关闭空闲连接后，复用的连接读取失败可以重试
+	srv.CloseClientConnections()
+	c, err = p.Get(context.Background(), key, tcpDial(addr))
+	require.NoError(t, err)
+	require.True(t, c.Reused())
+	fmt.Fprintf(c, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", addr)
+	_, err = http.ReadResponse(c.Reader, nil)
+	require.Error(t, err)
+	require.True(t, c.Retryable(err))
+	require.False(t, c.Retryable(context.DeadlineExceeded))
+	c.Release(false)
+}
+
+func TestPool_HTTP2Coalescing(t *testing.T) {
+	srv, conns := countingServer(t)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	p := New(4, time.Minute)
+	defer p.Close()
+	p.EnableHTTP2(func(_ context.Context, host string) ([]string, error) {
+		require.Equal(t, "other.test", host)
+		return []string{"127.0.0.1"}, nil
+	})
+	require.True(t, p.HTTP2())
+
+	roundTrip := func(key Key) *Conn {
+		c, err := p.Get(context.Background(), key, tlsDial(srv, "127.0.0.1:"+port, key.ServerName))
+		require.NoError(t, err)
+		require.True(t, c.HTTP2())
+		req, _ := http.NewRequest(http.MethodGet, "https://"+key.Addr+"/", nil)
+		resp, err := c.RoundTrip(req)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Equal(t, "HTTP/2.0", string(body))
+		c.Release(true)
+		return c
+	}
+
+	// httptest 的证书覆盖 example.com，解析到相同IP的源站合并到同一条连接
+	first := Key{Scheme: "https", Addr: "127.0.0.1:" + port, ServerName: "example.com"}
+	require.False(t, roundTrip(first).Reused())
+	require.True(t, roundTrip(first).Reused())
+	require.True(t, roundTrip(Key{Scheme: "https", Addr: "other.test:" + port, ServerName: "example.com"}).Reused())
+	require.Equal(t, int32(1), conns.Load())
+
+	st := p.Stats()
+	require.Equal(t, int64(1), st.Dials)
+	require.Equal(t, int64(1), st.Coalesced)
+	require.Len(t, st.Origins, 2)
+	require.True(t, strings.HasPrefix(st.Origins[0].Origin, "https://127.0.0.1:"))
+	require.Equal(t, 1, st.Origins[0].HTTP2)
+
+	// 证书不覆盖的主机名不合并
+	_, err := p.Get(context.Background(), Key{Scheme: "https", Addr: "other.test:" + port, ServerName: "other.test"},
+		tlsDial(srv, "127.0.0.1:"+port, "other.test"))
+	require.Error(t, err)
+}
+
+func TestPool_Nil(t *testing.T) {
+	srv, conns := countingServer(t)
+	srv.Start()
+	addr := srv.Listener.Addr().String()
+	var p *Pool
+	for range 2 {
+		c, err := p.Get(context.Background(), Key{Scheme: "http", Addr: addr}, tcpDial(addr))
+		require.NoError(t, err)
+		get(t, c, addr)
+	}
+	require.Equal(t, int32(2), conns.Load())
+	require.False(t, p.HTTP2())
+	require.Empty(t, p.Stats().Origins)
+	require.NoError(t, p.Close())
+}
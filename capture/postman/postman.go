@@ -0,0 +1,434 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package postman
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Schema Postman Collection v2.1 格式的标识
+const Schema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// Collection Postman 集合，按主机和路径的第一段分组的请求
+type Collection struct {
+	Info     Info        `json:"info"`
+	Item     []*Item     `json:"item"`
+	Variable []*Variable `json:"variable,omitempty"`
+}
+
+// Info 集合的名称和格式
+type Info struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Schema      string `json:"schema"`
+}
+
+// Item 请求或文件夹，文件夹只有 Name 和 Item
+type Item struct {
+	Name     string      `json:"name"`
+	Item     []*Item     `json:"item,omitempty"`
+	Request  *Request    `json:"request,omitempty"`
+	Response []*Response `json:"response,omitempty"`
+}
+
+// Request 一个请求，URL和头部中的主机地址和令牌替换为变量
+type Request struct {
+	Method      string    `json:"method"`
+	Header      []*Header `json:"header"`
+	Body        *Body     `json:"body,omitempty"`
+	URL         *URL      `json:"url"`
+	Description string    `json:"description,omitempty"`
+}
+
+// Header 请求或响应头部
+type Header struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// URL 拆分后的请求地址，Host 为主机变量
+type URL struct {
+	Raw   string   `json:"raw"`
+	Host  []string `json:"host"`
+	Path  []string `json:"path,omitempty"`
+	Query []*Pair  `json:"query,omitempty"`
+}
+
+// Pair 查询参数或表单字段
+type Pair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Body 请求体，Mode 为 raw、urlencoded 或 file
+type Body struct {
+	Mode       string       `json:"mode"`
+	Raw        string       `json:"raw,omitempty"`
+	URLEncoded []*Pair      `json:"urlencoded,omitempty"`
+	File       *File        `json:"file,omitempty"`
+	Options    *BodyOptions `json:"options,omitempty"`
+}
+
+// File 保存在文件中的请求体
+type File struct {
+	Src string `json:"src"`
+}
+
+// BodyOptions raw 内容的语言，用于 Postman 的语法高亮
+type BodyOptions struct {
+	Raw struct {
+		Language string `json:"language"`
+	} `json:"raw"`
+}
+
+// Response 请求的示例响应
+type Response struct {
+	Name            string    `json:"name"`
+	OriginalRequest *Request  `json:"originalRequest"`
+	Status          string    `json:"status"`
+	Code            int       `json:"code"`
+	PreviewLanguage string    `json:"_postman_previewlanguage,omitempty"`
+	Header          []*Header `json:"header"`
+	Body            string    `json:"body,omitempty"`
+}
+
+// Variable 集合或环境变量，令牌的 Type 为 secret
+type Variable struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled,omitempty"`
+}
+
+// Environment Postman 环境文件
+type Environment struct {
+	Name   string      `json:"name"`
+	Values []*Variable `json:"values"`
+	Scope  string      `json:"_postman_variable_scope"`
+}
+
+// Options 导出集合的选项
+type Options struct {
+	// Name 集合名称，默认使用唯一的主机名
+	Name string
+}
+
+// skipHeaders Postman 自动生成的头部
+var skipHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	flow.ReplayHeader:   true,
+}
+
+// tokenHeaders 值替换为变量的凭据头部和对应的变量名，Authorization 只替换认证方案之后的部分
+var tokenHeaders = map[string]string{
+	"Authorization":  "token",
+	"X-Api-Key":      "apiKey",
+	"Api-Key":        "apiKey",
+	"X-Auth-Token":   "authToken",
+	"X-Access-Token": "accessToken",
+}
+
+// Export 将流转换为 Postman 集合，没有HTTP请求的流被跳过。
+// 每个主机地址和每个不同的令牌对应一个集合变量，导入后只需要修改变量即可切换环境
+func Export(flows []*flow.Flow, opts Options) *Collection {
+	e := &exporter{hostVars: map[string]string{}, tokenVars: map[string]string{}, names: map[string]bool{}}
+	var origins []string
+	for _, f := range flows {
+		if u := requestURL(f); u != nil && !slices.Contains(origins, origin(u)) {
+			origins = append(origins, origin(u))
+		}
+	}
+	for _, o := range origins {
+		name := "baseUrl"
+		if len(origins) > 1 {
+			u, _ := url.Parse(o)
+			name = identifier(u.Host) + "Url"
+		}
+		e.hostVars[o] = e.variable(name, o, "default")
+	}
+
+	c := &Collection{Info: Info{Name: opts.Name, Schema: Schema}}
+	folders := map[string]*Item{}
+	count := 0
+	for _, f := range flows {
+		u := requestURL(f)
+		if u == nil {
+			continue
+		}
+		count++
+		host := folder(&c.Item, folders, u.Host, u.Host)
+		parent := host
+		if segment, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/"); segment != "" {
+			parent = folder(&host.Item, folders, u.Host+"/"+segment, segment)
+		}
+		parent.Item = append(parent.Item, e.item(f, u))
+	}
+	if c.Info.Name == "" {
+		c.Info.Name = "Captured requests"
+		if len(c.Item) == 1 {
+			c.Info.Name = c.Item[0].Name
+		}
+	}
+	c.Info.Description = fmt.Sprintf("Exported by sniffy from %d captured flows.", count)
+	c.Variable = e.vars
+	return c
+}
+
+// SplitEnvironment 将变量的值移到环境中，集合只保留变量名，便于分享集合而不泄露令牌
+func (c *Collection) SplitEnvironment() *Environment {
+	env := &Environment{Name: c.Info.Name, Values: []*Variable{}, Scope: "environment"}
+	for _, v := range c.Variable {
+		env.Values = append(env.Values, &Variable{Key: v.Key, Value: v.Value, Type: v.Type, Enabled: true})
+		v.Value = ""
+	}
+	return env
+}
+
+// exporter 记录已分配的变量
+type exporter struct {
+	hostVars  map[string]string
+	tokenVars map[string]string
+	names     map[string]bool
+	vars      []*Variable
+}
+
+// variable 添加变量并返回变量名，名称已被使用时添加数字后缀
+func (e *exporter) variable(name, value, typ string) string {
+	key := name
+	for i := 2; e.names[key]; i++ {
+		key = name + strconv.Itoa(i)
+	}
+	e.names[key] = true
+	e.vars = append(e.vars, &Variable{Key: key, Value: value, Type: typ})
+	return key
+}
+
+// token 返回令牌对应的变量引用，相同的令牌使用同一个变量
+func (e *exporter) token(name, value string) string {
+	key, ok := e.tokenVars[value]
+	if !ok {
+		key = e.variable(name, value, "secret")
+		e.tokenVars[value] = key
+	}
+	return "{{" + key + "}}"
+}
+
+// item 将流转换为集合中的请求，响应作为示例保存
+func (e *exporter) item(f *flow.Flow, u *url.URL) *Item {
+	req := e.request(f.Request, u)
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	it := &Item{Name: f.Request.Method + " " + path, Request: req}
+	if resp := f.Response; resp != nil {
+		it.Response = []*Response{response(resp, req)}
+	}
+	return it
+}
+
+func (e *exporter) request(r *flow.Request, u *url.URL) *Request {
+	base := "{{" + e.hostVars[origin(u)] + "}}"
+	pu := &URL{Host: []string{base}}
+	pu.Raw = base + u.EscapedPath()
+	for _, segment := range strings.Split(strings.TrimPrefix(u.EscapedPath(), "/"), "/") {
+		if segment != "" {
+			pu.Path = append(pu.Path, segment)
+		}
+	}
+	if u.RawQuery != "" {
+		pu.Raw += "?" + u.RawQuery
+		// Postman 保存与 raw 一致的未解码参数
+		for _, part := range strings.Split(u.RawQuery, "&") {
+			k, v, _ := strings.Cut(part, "=")
+			pu.Query = append(pu.Query, &Pair{Key: k, Value: v})
+		}
+	}
+
+	req := &Request{Method: r.Method, Header: []*Header{}, URL: pu}
+	if r.Host != "" && !strings.EqualFold(r.Host, u.Host) {
+		req.Header = append(req.Header, &Header{Key: "Host", Value: r.Host})
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.Header)) {
+		key := http.CanonicalHeaderKey(name)
+		if skipHeaders[key] {
+			continue
+		}
+		for _, value := range r.Header[name] {
+			if v, ok := tokenHeaders[key]; ok && value != "" {
+				value = e.credential(v, value, key == "Authorization")
+			}
+			req.Header = append(req.Header, &Header{Key: name, Value: value})
+		}
+	}
+	req.Body, req.Description = requestBody(r)
+	return req
+}
+
+// credential 将凭据替换为变量，scheme 为true时保留认证方案，例如 Bearer {{token}}
+func (e *exporter) credential(name, value string, scheme bool) string {
+	if scheme {
+		if s, cred, ok := strings.Cut(value, " "); ok && strings.TrimSpace(cred) != "" {
+			return s + " " + e.token(name, strings.TrimSpace(cred))
+		}
+	}
+	return e.token(name, value)
+}
+
+// requestBody 转换请求体，无法表示的内容返回说明
+func requestBody(r *flow.Request) (*Body, string) {
+	if r.BodyFile != "" {
+		return &Body{Mode: "file", File: &File{Src: r.BodyFile}}, ""
+	}
+	if len(r.Body) == 0 {
+		return nil, ""
+	}
+	var note string
+	if r.Truncated() {
+		note = fmt.Sprintf("Request body truncated to %d of %d bytes.", len(r.Body), r.BodySize)
+	}
+	if !utf8.Valid(r.Body) || r.Header.Get("Content-Encoding") != "" {
+		return nil, fmt.Sprintf("Binary request body of %d bytes is not included.", r.BodyLen())
+	}
+	mediaType := contentType(r.Header)
+	if mediaType == "application/x-www-form-urlencoded" && note == "" {
+		if values, err := url.ParseQuery(string(r.Body)); err == nil {
+			b := &Body{Mode: "urlencoded", URLEncoded: []*Pair{}}
+			for _, k := range slices.Sorted(maps.Keys(values)) {
+				for _, v := range values[k] {
+					b.URLEncoded = append(b.URLEncoded, &Pair{Key: k, Value: v})
+				}
+			}
+			return b, ""
+		}
+	}
+	b := &Body{Mode: "raw", Raw: string(r.Body)}
+	if lang := language(mediaType); lang != "" {
+		b.Options = &BodyOptions{}
+		b.Options.Raw.Language = lang
+	}
+	return b, note
+}
+
+// response 将响应转换为示例，解码后不是文本的内容不保存
+func response(r *flow.Response, req *Request) *Response {
+	out := &Response{
+		OriginalRequest: req,
+		Code:            r.StatusCode,
+		Status:          http.StatusText(r.StatusCode),
+		Header:          []*Header{},
+	}
+	if _, text, ok := strings.Cut(r.Status, " "); ok && text != "" {
+		out.Status = text
+	}
+	out.Name = strings.TrimSpace(strconv.Itoa(r.StatusCode) + " " + out.Status)
+
+	decoded, encoded, err := flow.DecodeBody(r.Header, r.Body)
+	if err != nil {
+		decoded, encoded = r.Body, false
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.Header)) {
+		key := http.CanonicalHeaderKey(name)
+		if encoded && (key == "Content-Encoding" || key == "Content-Length") {
+			continue
+		}
+		for _, value := range r.Header[name] {
+			out.Header = append(out.Header, &Header{Key: name, Value: value})
+		}
+	}
+	if len(decoded) > 0 && utf8.Valid(decoded) {
+		out.Body = string(decoded)
+		out.PreviewLanguage = cmp.Or(language(contentType(r.Header)), "text")
+	}
+	return out
+}
+
+// folder 返回名称对应的文件夹，不存在时添加到 items 末尾
+func folder(items *[]*Item, folders map[string]*Item, key, name string) *Item {
+	if f, ok := folders[key]; ok {
+		return f
+	}
+	f := &Item{Name: name}
+	folders[key] = f
+	*items = append(*items, f)
+	return f
+}
+
+// requestURL 返回HTTP请求的地址，不是HTTP请求时返回nil
+func requestURL(f *flow.Flow) *url.URL {
+	if f.Request == nil || f.Request.Method == http.MethodConnect {
+		return nil
+	}
+	u, err := url.Parse(f.Request.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil
+	}
+	return u
+}
+
+func origin(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// identifier 将主机名转换为驼峰形式的变量名，例如 api.example.com:8443 转换为 apiExampleCom8443
+func identifier(host string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range host {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if upper && b.Len() > 0 {
+				r = unicode.ToUpper(r)
+			}
+			b.WriteRune(r)
+			upper = false
+		default:
+			upper = true
+		}
+	}
+	return b.String()
+}
+
+// contentType 返回不带参数的媒体类型
+func contentType(header http.Header) string {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// language 返回媒体类型对应的 Postman 语言，未知类型返回空字符串
+func language(mediaType string) string {
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return "json"
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return "xml"
+	case mediaType == "text/html":
+		return "html"
+	case mediaType == "application/javascript" || mediaType == "text/javascript":
+		return "javascript"
+	case strings.HasPrefix(mediaType, "text/"):
+		return "text"
+	}
+	return ""
+}
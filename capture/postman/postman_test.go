@@ -0,0 +1,151 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package postman
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func newFlow(method, rawURL, contentType, reqBody string) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{Method: method, URL: rawURL, Header: http.Header{}}
+	if reqBody != "" {
+		f.Request.Header.Set("Content-Type", contentType)
+		f.Request.Body = []byte(reqBody)
+	}
+	f.Response = &flow.Response{StatusCode: 200, Status: "200 OK", Header: http.Header{}}
+	return f
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// --- 测试代码 ---
+func TestExport(t *testing.T) {
+	login := newFlow("POST", "https://api.example.com/v1/login", "application/x-www-form-urlencoded", "user=bob&pass=x%20y")
+	list := newFlow("GET", "https://api.example.com/v1/users?page=2&q=a%20b", "", "")
+	list.Request.Header.Set("Authorization", "Bearer abc")
+	list.Request.Header.Set("Content-Length", "0")
+	list.Response.Header.Set("Content-Type", "application/json")
+	list.Response.Header.Set("Content-Encoding", "gzip")
+	list.Response.Body = gzipped(t, `[{"id":1}]`)
+	again := newFlow("PUT", "https://api.example.com/v1/users/1", "application/json", `{"name":"bob"}`)
+	again.Request.Header.Set("Authorization", "Bearer abc")
+	other := newFlow("GET", "http://localhost:8080/", "", "")
+	other.Request.Header.Set("X-Api-Key", "k1")
+	tunnel := newFlow("CONNECT", "api.example.com:443", "", "")
+
+	c := Export([]*flow.Flow{login, list, again, other, tunnel}, Options{})
+	require.Equal(t, Schema, c.Info.Schema)
+	require.Equal(t, "Captured requests", c.Info.Name)
+	require.Equal(t, "Exported by sniffy from 4 captured flows.", c.Info.Description)
+	require.Equal(t, []*Variable{
+		{Key: "apiExampleComUrl", Value: "https://api.example.com", Type: "default"},
+		{Key: "localhost8080Url", Value: "http://localhost:8080", Type: "default"},
+		{Key: "token", Value: "abc", Type: "secret"},
+		{Key: "apiKey", Value: "k1", Type: "secret"},
+	}, c.Variable)
+
+	// 文件夹按主机和路径的第一段分组
+	require.Len(t, c.Item, 2)
+	api := c.Item[0]
+	require.Equal(t, "api.example.com", api.Name)
+	require.Len(t, api.Item, 1)
+	require.Equal(t, "v1", api.Item[0].Name)
+	items := api.Item[0].Item
+	require.Len(t, items, 3)
+	require.Equal(t, "POST /v1/login", items[0].Name)
+	require.Equal(t, "localhost:8080", c.Item[1].Name)
+	require.Equal(t, "GET /", c.Item[1].Item[0].Name)
+	require.Equal(t, []*Header{{Key: "X-Api-Key", Value: "{{apiKey}}"}}, c.Item[1].Item[0].Request.Header)
+
+	form := items[0].Request.Body
+	require.Equal(t, "urlencoded", form.Mode)
+	require.Equal(t, []*Pair{{Key: "pass", Value: "x y"}, {Key: "user", Value: "bob"}}, form.URLEncoded)
+
+	req := items[1].Request
+	require.Equal(t, &URL{
+		Raw:   "{{apiExampleComUrl}}/v1/users?page=2&q=a%20b",
+		Host:  []string{"{{apiExampleComUrl}}"},
+		Path:  []string{"v1", "users"},
+		Query: []*Pair{{Key: "page", Value: "2"}, {Key: "q", Value: "a%20b"}},
+	}, req.URL)
+	require.Equal(t, []*Header{{Key: "Authorization", Value: "Bearer {{token}}"}}, req.Header)
+
+	// 响应作为示例保存，消息体已解码
+	resp := items[1].Response[0]
+	require.Equal(t, "200 OK", resp.Name)
+	require.Equal(t, 200, resp.Code)
+	require.Equal(t, `[{"id":1}]`, resp.Body)
+	require.Equal(t, "json", resp.PreviewLanguage)
+	require.Equal(t, []*Header{{Key: "Content-Type", Value: "application/json"}}, resp.Header)
+	require.Same(t, req, resp.OriginalRequest)
+
+	body := items[2].Request.Body
+	require.Equal(t, "raw", body.Mode)
+	require.Equal(t, `{"name":"bob"}`, body.Raw)
+	require.Equal(t, "json", body.Options.Raw.Language)
+
+	_, err := json.Marshal(c)
+	require.NoError(t, err)
+}
+
+func TestExport_Bodies(t *testing.T) {
+	binary := newFlow("POST", "https://example.com/upload", "application/octet-stream", "\xff\xfe")
+	file := newFlow("POST", "https://example.com/upload", "application/octet-stream", "")
+	file.Request.BodyFile = "/tmp/body.bin"
+	truncated := newFlow("POST", "https://example.com/text", "text/plain", "abc")
+	truncated.Request.BodySize = 10
+
+	c := Export([]*flow.Flow{binary, file, truncated}, Options{Name: "Uploads"})
+	require.Equal(t, "Uploads", c.Info.Name)
+	require.Equal(t, []*Variable{{Key: "baseUrl", Value: "https://example.com", Type: "default"}}, c.Variable)
+	items := c.Item[0].Item
+	require.Len(t, items, 2)
+
+	uploads := items[0].Item
+	require.Nil(t, uploads[0].Request.Body)
+	require.Equal(t, "Binary request body of 2 bytes is not included.", uploads[0].Request.Description)
+	require.Equal(t, &Body{Mode: "file", File: &File{Src: "/tmp/body.bin"}}, uploads[1].Request.Body)
+
+	text := items[1].Item[0].Request
+	require.Equal(t, "abc", text.Body.Raw)
+	require.Equal(t, "text", text.Body.Options.Raw.Language)
+	require.Equal(t, "Request body truncated to 3 of 10 bytes.", text.Description)
+}
+
+func TestSplitEnvironment(t *testing.T) {
+	f := newFlow("GET", "https://api.example.com/me", "", "")
+	f.Request.Header.Set("Authorization", "token-without-scheme")
+	c := Export([]*flow.Flow{f}, Options{})
+	require.Equal(t, "api.example.com", c.Info.Name)
+	require.Equal(t, "{{token}}", c.Item[0].Item[0].Item[0].Request.Header[0].Value)
+
+	env := c.SplitEnvironment()
+	require.Equal(t, "api.example.com", env.Name)
+	require.Equal(t, "environment", env.Scope)
+	require.Equal(t, []*Variable{
+		{Key: "baseUrl", Value: "https://api.example.com", Type: "default", Enabled: true},
+		{Key: "token", Value: "token-without-scheme", Type: "secret", Enabled: true},
+	}, env.Values)
+	for _, v := range c.Variable {
+		require.Empty(t, v.Value, v.Key)
+	}
+}
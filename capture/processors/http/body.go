@@ -0,0 +1,88 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/pool"
+	"github.com/f-dong/sniffy/capture/types"
+)
+
+// maxPrealloc 按头部声明的长度预先分配的最大缓冲区，声明的长度不可信
+const maxPrealloc = 4 << 20
+
+// readBody 读取内容的开头，内容不超过 limit 字节时读完并返回 complete，
+// 否则返回 limit+1 字节，其余部分留在 r 中。limit 为0时读取全部内容。
+// size 为头部声明的长度，已知时一次分配足够的缓冲区，避免逐步扩容
+func readBody(r io.Reader, size, limit int64) (head []byte, complete bool, err error) {
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+		size = min(size, limit+1)
+	}
+	var buf bytes.Buffer
+	if size > 0 {
+		buf.Grow(int(min(size, maxPrealloc)) + bytes.MinRead)
+	}
+	_, err = buf.ReadFrom(r)
+	head = buf.Bytes()
+	return head, err == nil && (limit <= 0 || int64(len(head)) <= limit), err
+}
+
+// streamBody 返回依次读出 head 和 rest 的内容，读出的全部内容同时写入 c
+func streamBody(head []byte, rest io.Reader, c *flow.Capture) io.Reader {
+	c.Write(head)
+	return io.MultiReader(bytes.NewReader(head), io.TeeReader(rest, c))
+}
+
+// sourceReader 记录读取错误，流式转发出错时据此区分是读取来源还是写入目标的错误
+type sourceReader struct {
+	io.Reader
+	err error
+}
+
+func (r *sourceReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// streamResponse 边读边转发超过捕获限制的响应体，按策略只记录开头部分或写入临时文件。
+// 这样的响应不经过响应阶段的钩子、断点和改写规则；头部发出后出错只能关闭客户端连接
+func (p *Processor) streamResponse(server types.Server, s *session, f *flow.Flow, req *http.Request, resp *http.Response, upstream *pool.Conn, timer *flowTimer, head []byte, src *sourceReader) error {
+	server.LogDebug("response body of %s exceeds capture limit, streaming", f.Request.URL)
+	capture := server.GetBodyPolicy().NewCapture()
+	reusable := !resp.Close
+	resp.Close = req.Close
+	resp.Body = io.NopCloser(streamBody(head, src, capture))
+	if resp.ContentLength < 0 {
+		resp.TransferEncoding = []string{"chunked"}
+	}
+
+	err := resp.Write(s.writer)
+	if err == nil {
+		err = s.writer.Flush()
+	}
+	f.Timings.ResponseDone = time.Now()
+	if cerr := f.Response.SetBody(capture); cerr != nil {
+		server.LogDebug("capture response body of %s: %v", f.Request.URL, cerr)
+	}
+	if err != nil {
+		upstream.Release(false)
+		if src.err != nil {
+			return timer.fail(f, upstreamError(src.err))
+		}
+		return timer.fail(f, clientError(err))
+	}
+	upstream.Release(reusable)
+	return nil
+}
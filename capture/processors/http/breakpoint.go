@@ -0,0 +1,79 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/types"
+)
+
+// errAborted 流在断点处被用户中止
+var errAborted = errors.New("aborted at breakpoint")
+
+// pause 在断点处暂停匹配的流，paused 表示流曾被暂停，用户可能修改了流，
+// 返回 errAborted 表示用户中止
+func pause(ctx context.Context, server types.Server, phase breakpoint.Phase, f *flow.Flow) (paused bool, err error) {
+	bp := server.GetBreakpoints()
+	if bp == nil || bp.Match(phase, f) == nil {
+		return false, nil
+	}
+	server.LogInfo("flow %s paused at %s breakpoint", f.ID, phase)
+	decision, err := bp.Pause(ctx, phase, f)
+	if err != nil {
+		return true, err
+	}
+	if decision == breakpoint.DecisionAbort {
+		server.LogInfo("flow %s aborted at %s breakpoint", f.ID, phase)
+		return true, errAborted
+	}
+	return true, nil
+}
+
+// applyRequest 将断点或改写规则修改后的流请求写回待转发的请求
+func applyRequest(req *http.Request, r *flow.Request) error {
+	if r.URL != req.URL.String() {
+		u, err := url.Parse(r.URL)
+		if err != nil {
+			return fmt.Errorf("invalid edited URL %q: %w", r.URL, err)
+		}
+		// 上游地址由 upstreamTarget 决定，请求行只使用路径
+		u.Scheme, u.Host = "", ""
+		req.URL = u
+	}
+	req.Method = r.Method
+	req.Host = r.Host
+	req.Header = r.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(r.Body))
+	req.ContentLength = int64(len(r.Body))
+	return nil
+}
+
+// applyResponse 将断点处修改后的流响应写回待返回的响应
+func applyResponse(resp *http.Response, r *flow.Response) {
+	resp.StatusCode = r.StatusCode
+	resp.Status = r.Status
+	if resp.Status == "" {
+		resp.Status = fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode))
+	}
+	resp.Header = r.Header.Clone()
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(r.Body))
+	resp.ContentLength = int64(len(r.Body))
+}
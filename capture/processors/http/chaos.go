@@ -0,0 +1,79 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/chaos"
+)
+
+// sleepContext 等待 d，上下文取消时提前返回错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dnsError 返回模拟的主机名解析失败错误
+func dnsError(host string) error {
+	name, _, err := net.SplitHostPort(host)
+	if err != nil {
+		name = host
+	}
+	return &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}}
+}
+
+// writeBroken 按 reset 或 truncate 规则只发送部分响应体，头部仍声明完整长度，然后关闭客户端连接。
+// reset 关闭前设置 SO_LINGER 为0，使客户端收到TCP RST
+func (p *Processor) writeBroken(s *session, resp *http.Response, fault *chaos.Rule) error {
+	var buf bytes.Buffer
+	if err := resp.Write(&buf); err != nil {
+		return err
+	}
+	raw := buf.Bytes()
+	head := bytes.Index(raw, []byte("\r\n\r\n")) + 4
+	raw = raw[:head+fault.Cutoff(len(raw)-head)]
+	if _, err := s.writer.Write(raw); err != nil {
+		return err
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+
+	conn := p.conn.GetConn()
+	if fault.Action == chaos.ActionReset {
+		setLinger0(conn)
+	}
+	return conn.Close()
+}
+
+// setLinger0 在包装的连接中找到TCP连接并把 SO_LINGER 设置为0，关闭时发送RST
+func setLinger0(conn net.Conn) {
+	for conn != nil {
+		if l, ok := conn.(interface{ SetLinger(sec int) error }); ok {
+			l.SetLinger(0)
+			return
+		}
+		u, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return
+		}
+		conn = u.NetConn()
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/bufpool"
+	"github.com/f-dong/sniffy/capture/chaos"
+	"github.com/f-dong/sniffy/capture/dialer"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/timeouts"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+	"github.com/f-dong/sniffy/capture/types"
+)
+
+// handleConnect 处理CONNECT请求，根据ClientHello决定解密还是透传
+func (p *Processor) handleConnect(server types.Server, req *http.Request, s *session) error {
+	// 没有端口时使用443，IPv6地址可以带方括号，例如 [2001:db8::1]
+	target := req.Host
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(target, "["), "]"), "443")
+	}
+
+	if _, err := s.writer.WriteString("HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return err
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+
+	// 非TLS流量或无法解析的ClientHello直接透传
+	hello, err := tlsinfo.PeekClientHello(s.reader)
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			server.LogDebug("no ClientHello on CONNECT %s: %v", target, err)
+		}
+		return p.passthrough(server, s, req, target, nil)
+	}
+
+	if p.decide(server, target, hello) != tlsinfo.ActionIntercept {
+		return p.passthrough(server, s, req, target, hello)
+	}
+
+	return p.intercept(server, s, req, target, hello)
+}
+
+// decide 执行MITM决策策略，默认在CA可用时解密
+func (p *Processor) decide(server types.Server, target string, hello *tlsinfo.ClientHello) tlsinfo.Action {
+	if server.GetCA() == nil {
+		return tlsinfo.ActionPassthrough
+	}
+	if policy := server.GetTLSPolicy(); policy != nil {
+		if action := policy(target, hello); action != tlsinfo.ActionDefault {
+			server.LogDebug("TLS policy for %s (SNI %q): %s", target, hello.ServerName, action)
+			return action
+		}
+	}
+	return tlsinfo.ActionIntercept
+}
+
+// intercept 使用CA签发的证书与客户端完成TLS握手，并处理解密后的请求
+func (p *Processor) intercept(server types.Server, s *session, req *http.Request, target string, hello *tlsinfo.ClientHello) error {
+	name := hello.ServerName
+	if name == "" {
+		name, _, _ = net.SplitHostPort(target)
+	}
+
+	cert, err := server.GetCA().IssueCert(name)
+	if err != nil {
+		return fmt.Errorf("issue certificate for %s: %w", name, err)
+	}
+
+	tlsConn := tls.Server(&bufferedConn{Conn: p.conn.GetConn(), reader: s.reader}, &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		NextProtos:   []string{"http/1.1"},
+		KeyLogWriter: server.GetKeyLogWriter(),
+	})
+	start := time.Now()
+	if err := tlsConn.Handshake(); err != nil {
+		err = fmt.Errorf("client TLS handshake for %s failed: %w", name, err)
+		if reason, ok := tlsinfo.PinningFailure(err); ok {
+			p.pinningFailure(server, s, req, hello, target, name, reason, err)
+		}
+		return err
+	}
+	done := time.Now()
+	defer tlsConn.Close()
+
+	reader, writer := bufpool.NewReader(tlsConn), bufpool.NewWriter(tlsConn)
+	defer bufpool.PutReader(reader)
+	defer bufpool.PutWriter(writer)
+	return p.serve(server, &session{
+		reader:   reader,
+		writer:   writer,
+		scheme:   "https",
+		target:   target,
+		hello:    hello,
+		user:     s.user,
+		tlsStart: start,
+		tlsDone:  done,
+	})
+}
+
+// pinningFailure 记录客户端疑似因证书固定拒绝握手的主机，并保存一条带 tlsinfo.PinningTag 标签的失败流
+func (p *Processor) pinningFailure(server types.Server, s *session, req *http.Request, hello *tlsinfo.ClientHello, target, name, reason string, err error) {
+	host := server.GetPinning().Record(name, reason)
+	server.LogInfo("client rejected the certificate for %s (%s), possibly pinned", name, reason)
+	if host.Passthrough && host.Failures == 1 {
+		server.LogInfo("added %s to the passthrough rules", name)
+	}
+
+	f := p.newFlow(&session{scheme: "tcp", hello: hello, user: s.user}, req)
+	f.Request.URL = "tcp://" + target
+	f.Intercepted = false
+	f.Tag(tlsinfo.PinningTag)
+	server.GetEvents().Started(f)
+	f.Fail(flow.NewError(flow.CodeClientTLSFailure, err))
+	p.finishFlow(p.conn.GetContext(), server, f)
+}
+
+// passthrough 不解密，直接在客户端与上游之间转发数据，并记录一条隧道流
+func (p *Processor) passthrough(server types.Server, s *session, req *http.Request, target string, hello *tlsinfo.ClientHello) error {
+	f := p.newFlow(&session{scheme: "tcp", hello: hello, user: s.user}, req)
+	f.Request.URL = "tcp://" + target
+	f.Intercepted = false
+	defer p.finishFlow(p.conn.GetContext(), server, f)
+	server.GetEvents().Started(f)
+
+	// 隧道建立前已向客户端返回200，超出限制时只能关闭连接
+	release, err := server.GetRateLimiter().Acquire(p.conn.GetConn().RemoteAddr(), target)
+	if err != nil {
+		f.Fail(flow.NewError(flow.CodeRateLimited, err))
+		return err
+	}
+	defer release()
+	releaseOrigin, err := server.GetLimiter().AcquireOrigin(target)
+	if err != nil {
+		f.Fail(flow.NewError(flow.CodeOverloaded, err))
+		return err
+	}
+	defer releaseOrigin()
+
+	// 隧道内的数据不可见，只能注入延迟和解析失败
+	d := server.GetChaos().Decide(f)
+	f.Faults = d.Faults()
+	if err := sleepContext(p.conn.GetContext(), d.Delay); err != nil {
+		f.Fail(err)
+		return err
+	}
+	if d.Fault != nil && d.Fault.Action == chaos.ActionDNS {
+		err := dnsError(target)
+		f.Fail(err)
+		return fmt.Errorf("dial %s failed: %w", target, err)
+	}
+
+	f.Timings = &flow.Timings{}
+	ctx := dialer.WithSourceAddr(p.conn.GetContext(), p.conn.GetConn().RemoteAddr())
+	ctx = dialer.WithTimings(ctx, f.Timings)
+	// 与 curl 等工具一样，CONNECT隧道使用 HTTPS_PROXY
+	ctx = dialer.WithScheme(ctx, "https")
+	upstream, err := server.GetDialer().DialContext(ctx, "tcp", target)
+	if err != nil {
+		f.Fail(flow.Annotate(err, flow.CodeDialFailed))
+		f.TimedOut = string(timeouts.PhaseOf(err))
+		return fmt.Errorf("dial %s failed: %w", target, err)
+	}
+	defer upstream.Close()
+	f.ServerAddr = upstream.RemoteAddr().String()
+
+	if err := tunnel(p.conn.GetConn(), s.reader, upstream); err != nil {
+		f.Fail(err)
+		return err
+	}
+	return nil
+}
+
+// bufferedConn 先从缓冲读取器读取已预读数据的连接
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// tunnel 在客户端与上游之间双向转发数据。先转发已预读的数据，之后绕过不改变数据的连接包装，
+// 两端都是TCP连接时在 Linux 上使用 splice，数据不经过用户空间，否则使用池中的缓冲区
+func tunnel(client net.Conn, clientReader *bufio.Reader, upstream net.Conn) error {
+	if n := clientReader.Buffered(); n > 0 {
+		buffered, _ := clientReader.Peek(n)
+		if _, err := upstream.Write(buffered); err != nil {
+			return err
+		}
+		clientReader.Discard(n)
+	}
+	client, upstream = types.RawConn(client), types.RawConn(upstream)
+
+	errc := make(chan error, 2)
+	go func() {
+		_, err := bufpool.Copy(upstream, client)
+		closeWrite(upstream)
+		errc <- err
+	}()
+	go func() {
+		_, err := bufpool.Copy(client, upstream)
+		closeWrite(client)
+		errc <- err
+	}()
+
+	var firstErr error
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil && firstErr == nil && !errors.Is(err, net.ErrClosed) {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// closeWrite 半关闭连接的写方向
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+}
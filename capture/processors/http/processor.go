@@ -7,13 +7,91 @@ package http
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/chaos"
+	"github.com/f-dong/sniffy/capture/dialer"
+	"github.com/f-dong/sniffy/capture/docker"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/graphql"
+	"github.com/f-dong/sniffy/capture/parsers"
+	"github.com/f-dong/sniffy/capture/procinfo"
+	"github.com/f-dong/sniffy/capture/ratelimit"
+	"github.com/f-dong/sniffy/capture/timeouts"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+	"github.com/f-dong/sniffy/capture/transparent"
 	"github.com/f-dong/sniffy/capture/types"
 )
 
+// maxDiscardBody 返回407时最多丢弃的请求体长度，超出时关闭连接
+const maxDiscardBody = 1 << 20
+
+// hopHeaders 逐跳头部，转发时需要移除
+var hopHeaders = []string{
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Keep-Alive",
+	"Te",
+	"Trailer",
+	"Upgrade",
+}
+
 // Processor HTTP协议处理器
 type Processor struct {
 	conn types.Connection
+
+	// process 发起连接的本地进程，每个连接只查询一次
+	process       *procinfo.Process
+	processLooked bool
+
+	// container 发起连接的Docker容器，每个连接只查询一次
+	container       *docker.Container
+	containerLooked bool
+}
+
+// session 客户端连接上的请求上下文，明文代理或MITM解密后的TLS连接
+type session struct {
+	reader *bufio.Reader
+	writer *bufio.Writer
+
+	// scheme 请求的协议，"http" 或 "https"
+	scheme string
+
+	// target CONNECT目标 host:port，明文代理时为空
+	target string
+
+	// hello 客户端ClientHello，明文代理时为nil
+	hello *tlsinfo.ClientHello
+
+	// user 通过代理认证的用户名，MITM会话继承CONNECT请求的用户
+	user string
+
+	// tlsStart 和 tlsDone 与客户端的TLS握手，记录到连接上的第一个流后清空
+	tlsStart, tlsDone time.Time
+}
+
+// timings 创建流的时间点，尚未记录的客户端TLS握手归入这个流
+func (s *session) timings() *flow.Timings {
+	if s.tlsDone.IsZero() {
+		return nil
+	}
+	t := &flow.Timings{ClientTLSStart: s.tlsStart, ClientTLSDone: s.tlsDone}
+	s.tlsStart, s.tlsDone = time.Time{}, time.Time{}
+	return t
 }
 
 // New 创建新的HTTP处理器
@@ -36,31 +114,587 @@ func (p *Processor) Process() error {
 
 	server.LogInfo("开始处理HTTP连接")
 
+	if target, ok := transparent.Target(p.conn.GetContext()); ok {
+		return p.handleTransparent(server, target)
+	}
+
 	// 执行具体的HTTP协议处理逻辑
 	return p.handleHttpProtocol(server, reader, writer)
 }
 
 // handleHttpProtocol 处理HTTP协议的具体逻辑
 func (p *Processor) handleHttpProtocol(server types.Server, reader *bufio.Reader, writer *bufio.Writer) error {
-	// HTTP协议处理逻辑
-	server.LogInfo("处理HTTP协议...")
+	return p.serve(server, &session{
+		reader: reader,
+		writer: writer,
+		scheme: "http",
+	})
+}
 
+// serve 循环读取并转发会话上的请求
+func (p *Processor) serve(server types.Server, s *session) error {
+	conn := p.conn.GetConn()
+	limits := server.GetTimeouts().Global()
 	for {
-		line, err := reader.ReadString('\n')
+		// 代理正在关闭时不再等待keep-alive连接上的下一个请求，收到请求的第一个字节后连接不再空闲
+		if !types.SetIdle(conn, true) {
+			return nil
+		}
+		if limits.Idle > 0 {
+			conn.SetReadDeadline(time.Now().Add(limits.Idle))
+		}
+		if _, err := s.reader.Peek(1); err != nil && limits.Idle > 0 && timeouts.IsTimeout(err) {
+			server.LogDebug("closing connection from %s idle for %s", conn.RemoteAddr(), limits.Idle)
+			return nil
+		}
+		draining := !types.SetIdle(conn, false)
+
+		var headerDeadline time.Time
+		if limits.RequestHeader > 0 {
+			headerDeadline = time.Now().Add(limits.RequestHeader)
+			conn.SetReadDeadline(headerDeadline)
+		} else if limits.Idle > 0 {
+			conn.SetReadDeadline(time.Time{})
+		}
+		req, err := http.ReadRequest(s.reader)
+		if limits.RequestHeader > 0 {
+			conn.SetReadDeadline(time.Time{})
+		}
 		if err != nil {
+			if errors.Is(err, io.EOF) || draining {
+				return nil
+			}
+			// 超时时已读取的不完整请求行可能被报告为格式错误
+			if !headerDeadline.IsZero() && !time.Now().Before(headerDeadline) {
+				err = &timeouts.Error{Phase: timeouts.PhaseRequestHeader, Limit: limits.RequestHeader, Err: err}
+				writeError(s.writer, http.StatusRequestTimeout, err)
+			}
 			return err
 		}
+		if draining {
+			req.Close = true
+		}
 
 		if server.GetConfig().IsLoggingEnabled() {
-			server.LogInfo("HTTP line: %q", line)
+			server.LogInfo("HTTP request: %s %s", req.Method, req.RequestURI)
 		}
 
-		// 简单回复
-		response := "HTTP/1.1 200 OK\r\nContent-Length: 13\r\n\r\nHello, World!"
-		_, err = writer.WriteString(response)
-		if err != nil {
+		// 解密后的请求已在CONNECT时认证
+		if s.target == "" {
+			authenticator := server.GetAuth()
+			user, ok := authenticator.Check(req.Header)
+			if !ok {
+				if err := challenge(server, s, req); err != nil {
+					return err
+				}
+				if req.Close {
+					return nil
+				}
+				continue
+			}
+			if authenticator.RequiresCredentials() {
+				s.user = user
+				req.Header.Del("Proxy-Authorization")
+			}
+		}
+
+		if req.Method == http.MethodConnect && s.target == "" {
+			return p.handleConnect(server, req, s)
+		}
+
+		if err := p.forward(server, s, req); err != nil {
 			return err
 		}
-		return writer.Flush()
+
+		if req.Close {
+			return nil
+		}
+	}
+}
+
+// forward 将请求转发到上游
+func (p *Processor) forward(server types.Server, s *session, req *http.Request) error {
+	certID := req.Header.Get(flow.ClientCertHeader)
+	req.Header.Del(flow.ClientCertHeader)
+	f := p.newFlow(s, req)
+	// 在钩子和改写规则之前注入，脚本可以看到并修改追踪头部
+	server.GetTracing().Apply(req.Header, f)
+	ctx := p.conn.GetContext()
+	defer func() { p.finishFlow(ctx, server, f) }()
+	events := server.GetEvents()
+	events.Started(f)
+	if certID != "" {
+		if server.GetDialer().RegisteredCertificate(certID) == nil {
+			err := flow.NewError(flow.CodeProtocolError, errors.New("unknown client certificate"))
+			f.Fail(err)
+			writeError(s.writer, http.StatusBadRequest, err)
+			return nil
+		}
+		ctx = dialer.WithClientCertificate(ctx, certID)
+	}
+
+	// 总超时覆盖读取请求体、连接上游到写完响应的全过程
+	_, target := upstreamTarget(s, req, "", "")
+	timer := newFlowTimer(server.GetTimeouts().For(target), f.StartTime, p.conn.GetConn())
+	defer timer.stop()
+
+	bodies := server.GetBodyPolicy()
+	reqBody := &sourceReader{Reader: events.BodyReader(f, "request", req.Body)}
+	body, complete, err := readBody(reqBody, req.ContentLength, bodies.MemoryLimit())
+	if err != nil {
+		return timer.fail(f, clientError(err))
+	}
+	// 超过捕获限制的请求体边读边转发，不能重试，也不经过请求阶段的钩子、断点和改写规则
+	intercept := complete
+	if complete {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.TransferEncoding = nil
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(f.Request.Body)), nil
+		}
+		f.Request.Body = body
+	} else {
+		server.LogDebug("request body of %s exceeds capture limit, streaming", f.Request.URL)
+		capture := bodies.NewCapture()
+		req.Body = io.NopCloser(streamBody(body, reqBody, capture))
+		req.GetBody = nil
+		// 本地响应或转发失败时请求体没有读完，响应后关闭客户端连接
+		req.Close = true
+		defer func() {
+			if err := f.Request.SetBody(capture); err != nil {
+				server.LogDebug("capture request body of %s: %v", f.Request.URL, err)
+			}
+		}()
+	}
+
+	origURL := f.Request.URL
+	chain := server.GetHooks()
+	if intercept && chain.Len() > 0 {
+		if ctx, err = chain.Request(ctx, f); err != nil {
+			err = flow.Annotate(err, flow.CodeHookFailure)
+			f.Fail(err)
+			writeError(s.writer, http.StatusBadGateway, err)
+			return nil
+		}
+		if f.Response != nil {
+			responder := f.Responder
+			if responder == "" {
+				responder = "hook"
+			}
+			return p.respondLocal(ctx, server, s, req, f, f.Response, responder, 0)
+		}
+	}
+
+	modified := false
+	if intercept {
+		if modified, err = pause(ctx, server, breakpoint.PhaseRequest, f); err != nil {
+			err = flow.Annotate(err, flow.CodeHookFailure)
+			f.Fail(err)
+			writeError(s.writer, http.StatusBadGateway, err)
+			return nil
+		}
+	}
+
+	if engine := server.GetRules(); engine != nil && intercept {
+		if resp, rule, ok := engine.Respond(f); ok {
+			return p.respondLocal(ctx, server, s, req, f, resp, rule.String(), rule.Delay())
+		}
+		if engine.RewriteRequest(f) {
+			modified = true
+		}
+	}
+
+	if modified || (intercept && chain.Len() > 0) {
+		if err := applyRequest(req, f.Request); err != nil {
+			err = flow.Annotate(err, flow.CodeProtocolError)
+			f.Fail(err)
+			writeError(s.writer, http.StatusBadRequest, err)
+			return nil
+		}
+	}
+
+	scheme, host := upstreamTarget(s, req, origURL, f.Request.URL)
+	if host == "" {
+		err := flow.NewError(flow.CodeProtocolError, errors.New("missing host"))
+		f.Fail(err)
+		writeError(s.writer, http.StatusBadRequest, err)
+		return errors.New("request without host")
+	}
+
+	release, err := server.GetRateLimiter().Acquire(p.conn.GetConn().RemoteAddr(), host)
+	if err != nil {
+		return p.respondLocal(ctx, server, s, req, f, limitResponse(err), "ratelimit", 0)
+	}
+	defer release()
+	releaseOrigin, err := server.GetLimiter().AcquireOrigin(host)
+	if err != nil {
+		return p.respondLocal(ctx, server, s, req, f, overloadResponse(err), "limits", 0)
+	}
+	defer releaseOrigin()
+
+	d := server.GetChaos().Decide(f)
+	f.Faults = d.Faults()
+	if err := sleepContext(ctx, d.Delay); err != nil {
+		f.Fail(err)
+		return err
+	}
+	switch fault := d.Fault; {
+	case fault == nil:
+	case fault.Action == chaos.ActionStatus:
+		return p.respondLocal(ctx, server, s, req, f, fault.Response(), "chaos", 0)
+	case fault.Action == chaos.ActionDNS:
+		err := dnsError(host)
+		f.Fail(err)
+		writeError(s.writer, http.StatusBadGateway, err)
+		return nil
+	}
+
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	req.RequestURI = ""
+
+	if f.Timings == nil {
+		f.Timings = &flow.Timings{}
+	}
+	resp, upstream, err := p.roundTrip(ctx, server, s, f, timer, req, scheme, host)
+	if err != nil {
+		if reqBody.err != nil {
+			err = clientError(reqBody.err)
+		}
+		err = timer.fail(f, err)
+		writeError(s.writer, upstreamStatus(err), err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	f.Response = &flow.Response{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Proto:      resp.Proto,
+		Header:     resp.Header.Clone(),
+	}
+	events.ResponseHeaders(f)
+
+	// 截断和重置故障需要完整的响应体
+	limit := bodies.MemoryLimit()
+	if d.Fault != nil {
+		limit = 0
+	}
+	src := &sourceReader{Reader: events.BodyReader(f, "response", resp.Body)}
+	respBody, complete, err := readBody(src, resp.ContentLength, limit)
+	if err != nil {
+		f.Timings.ResponseDone = time.Now()
+		upstream.Release(false)
+		err = timer.fail(f, upstreamError(err))
+		writeError(s.writer, upstreamStatus(err), err)
+		return nil
+	}
+	// 客户端连接始终使用HTTP/1.1
+	resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+	if !complete {
+		return p.streamResponse(server, s, f, req, resp, upstream, timer, respBody, src)
+	}
+	f.Timings.ResponseDone = time.Now()
+	upstream.Release(!resp.Close)
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	resp.ContentLength = int64(len(respBody))
+	resp.TransferEncoding = nil
+	resp.Close = req.Close
+	f.Response.Body = respBody
+
+	rewritten := false
+	if engine := server.GetRules(); engine != nil {
+		rewritten = engine.RewriteResponse(f)
+	}
+	paused, err := pause(ctx, server, breakpoint.PhaseResponse, f)
+	if err != nil {
+		err = flow.Annotate(err, flow.CodeHookFailure)
+		f.Fail(err)
+		writeError(s.writer, http.StatusBadGateway, err)
+		return nil
 	}
+	if err := chain.Response(ctx, f); err != nil {
+		err = flow.Annotate(err, flow.CodeHookFailure)
+		f.Fail(err)
+		writeError(s.writer, http.StatusBadGateway, err)
+		return nil
+	}
+	if rewritten || paused || chain.Len() > 0 {
+		applyResponse(resp, f.Response)
+	}
+
+	if fault := d.Fault; fault != nil {
+		req.Close = true
+		return p.writeBroken(s, resp, fault)
+	}
+	if err := resp.Write(s.writer); err != nil {
+		return timer.fail(f, clientError(err))
+	}
+	if err := s.writer.Flush(); err != nil {
+		return timer.fail(f, clientError(err))
+	}
+	return nil
+}
+
+// upstreamTarget 返回上游的协议和 host:port，断点或改写规则修改了URL的协议或主机时使用新的目标
+func upstreamTarget(s *session, req *http.Request, origURL, newURL string) (scheme, host string) {
+	scheme, host = s.scheme, req.URL.Host
+	if host == "" {
+		host = req.Host
+	}
+	if s.target != "" {
+		host = s.target
+	}
+	if newURL != origURL {
+		orig, err1 := url.Parse(origURL)
+		u, err2 := url.Parse(newURL)
+		if err1 == nil && err2 == nil && u.Host != "" && (u.Host != orig.Host || u.Scheme != orig.Scheme) {
+			scheme, host = u.Scheme, u.Host
+		}
+	}
+	if host == "" {
+		return scheme, ""
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		port := "80"
+		if scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	return scheme, host
+}
+
+// respondLocal 使用本地规则或钩子生成的响应回复客户端，不连接上游
+func (p *Processor) respondLocal(ctx context.Context, server types.Server, s *session, req *http.Request, f *flow.Flow, resp *flow.Response, responder string, delay time.Duration) error {
+	f.Responder = responder
+	f.Response = resp
+	server.LogDebug("%s answered by %s", f.Request.URL, f.Responder)
+	server.GetEvents().ResponseHeaders(f)
+
+	if err := sleepContext(ctx, delay); err != nil {
+		f.Fail(err)
+		return err
+	}
+	if engine := server.GetRules(); engine != nil {
+		engine.RewriteResponse(f)
+	}
+	if _, err := pause(ctx, server, breakpoint.PhaseResponse, f); err != nil {
+		err = flow.Annotate(err, flow.CodeHookFailure)
+		f.Fail(err)
+		writeError(s.writer, http.StatusBadGateway, err)
+		return nil
+	}
+	if err := server.GetHooks().Response(ctx, f); err != nil {
+		err = flow.Annotate(err, flow.CodeHookFailure)
+		f.Fail(err)
+		writeError(s.writer, http.StatusBadGateway, err)
+		return nil
+	}
+
+	out := &http.Response{
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Request:    req,
+		Close:      req.Close,
+	}
+	applyResponse(out, f.Response)
+	if err := out.Write(s.writer); err != nil {
+		return err
+	}
+	return s.writer.Flush()
+}
+
+// newFlow 根据请求创建新的流
+func (p *Processor) newFlow(s *session, req *http.Request) *flow.Flow {
+	f := flow.New()
+	if v := req.Header.Get(flow.ReplayHeader); v != "" {
+		orig, id, _ := strings.Cut(v, " ")
+		if orig != "-" {
+			f.ReplayOf = orig
+		}
+		if id != "" {
+			f.ID = id
+		}
+		req.Header.Del(flow.ReplayHeader)
+	}
+	conn := p.conn.GetConn()
+	f.ClientAddr = conn.RemoteAddr().String()
+	f.Listener = p.conn.GetServer().GetListenerName()
+	if pc, ok := conn.(interface{ PeerAddr() net.Addr }); ok {
+		if peer := pc.PeerAddr().String(); peer != f.ClientAddr {
+			f.PeerAddr = peer
+		}
+	}
+	f.Process = p.lookupProcess()
+	f.Container = p.lookupContainer()
+	f.Pod = p.conn.GetServer().GetPod()
+	f.ProxyUser = s.user
+	f.ClientHello = s.hello
+	if s.hello != nil {
+		f.Fingerprints = &tlsinfo.Fingerprints{
+			JA3: s.hello.JA3(),
+			JA4: s.hello.JA4(),
+		}
+	}
+	f.Intercepted = s.scheme == "https"
+	f.Timings = s.timings()
+
+	url := req.URL.String()
+	if req.URL.Host == "" {
+		url = s.scheme + "://" + req.Host + req.URL.RequestURI()
+	}
+	f.Request = &flow.Request{
+		Method: req.Method,
+		URL:    url,
+		Host:   req.Host,
+		Proto:  req.Proto,
+		Header: req.Header.Clone(),
+	}
+	return f
+}
+
+// lookupProcess 查找发起连接的本地进程，eBPF重定向的连接使用程序记录的进程
+func (p *Processor) lookupProcess() *procinfo.Process {
+	if proc, ok := procinfo.FromContext(p.conn.GetContext()); ok {
+		return proc
+	}
+	if p.processLooked || !p.conn.GetServer().GetConfig().IsProcessLookupEnabled() {
+		return p.process
+	}
+	p.processLooked = true
+
+	conn := p.conn.GetConn()
+	proc, err := procinfo.Lookup(conn.RemoteAddr(), conn.LocalAddr())
+	if err != nil {
+		p.conn.GetServer().LogDebug("process lookup for %s failed: %v", conn.RemoteAddr(), err)
+		return nil
+	}
+	p.process = proc
+	return proc
+}
+
+// lookupContainer 按客户端地址查找发起连接的Docker容器
+func (p *Processor) lookupContainer() *docker.Container {
+	resolver := p.conn.GetServer().GetContainers()
+	if p.containerLooked || resolver == nil {
+		return p.container
+	}
+	p.containerLooked = true
+
+	conn := p.conn.GetConn()
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return nil
+	}
+	container, err := resolver.Lookup(p.conn.GetContext(), addr.IP)
+	if err != nil {
+		p.conn.GetServer().LogDebug("container lookup for %s failed: %v", conn.RemoteAddr(), err)
+		return nil
+	}
+	p.container = container
+	return container
+}
+
+// finishFlow 结束流并在脱敏后保存到流存储，流以错误结束时调用 OnError 钩子，最后发布结束事件。
+// 凭据检测、重复请求、标签规则和API规范的检查在脱敏之前进行，避免被移除或替换的字段造成误匹配和误报
+func (p *Processor) finishFlow(ctx context.Context, server types.Server, f *flow.Flow) {
+	f.EndTime = time.Now()
+	server.GetDetector().Apply(f)
+	server.GetDuplicates().Apply(f)
+	if engine := server.GetRules(); engine != nil {
+		engine.Tag(f)
+	}
+	server.GetValidator().Apply(f)
+	server.GetRedactor().Apply(f)
+	parsers.Attach(f)
+	graphql.Attach(f)
+	if err := f.Err(); err != nil {
+		server.GetHooks().Error(ctx, f, err)
+	}
+	if store := server.GetFlowStore(); store != nil {
+		store.Add(f)
+	}
+	server.GetEvents().Finished(f)
+}
+
+// challenge 返回407要求客户端提供代理认证，丢弃请求体以便客户端在同一连接上重试，
+// 请求体过大时关闭连接
+func challenge(server types.Server, s *session, req *http.Request) error {
+	server.LogInfo("proxy authentication required for %s %s", req.Method, req.RequestURI)
+	if n, _ := io.Copy(io.Discard, io.LimitReader(req.Body, maxDiscardBody+1)); n > maxDiscardBody {
+		req.Close = true
+	}
+	conn := ""
+	if req.Close {
+		conn = "Connection: close\r\n"
+	}
+	msg := "proxy authentication required"
+	_, err := fmt.Fprintf(s.writer, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: %s\r\n%sContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\n\r\n%s",
+		server.GetAuth().Challenge(), conn, len(msg), msg)
+	if err != nil {
+		return err
+	}
+	return s.writer.Flush()
+}
+
+// limitResponse 返回超出限流规则时的429响应，按速率限流时带 Retry-After 头部
+func limitResponse(err error) *flow.Response {
+	header := http.Header{"Content-Type": {"text/plain; charset=utf-8"}}
+	var limitErr *ratelimit.LimitError
+	if errors.As(err, &limitErr) && limitErr.RetryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+	}
+	return &flow.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Status:     "429 Too Many Requests",
+		Proto:      "HTTP/1.1",
+		Header:     header,
+		Body:       []byte(err.Error()),
+	}
+}
+
+// overloadResponse 返回源站进行中请求数达到上限时的503响应，客户端稍后重试
+func overloadResponse(err error) *flow.Response {
+	return &flow.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Status:     "503 Service Unavailable",
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}, "Retry-After": {"1"}},
+		Body:       []byte(err.Error()),
+	}
+}
+
+// upstreamStatus 返回连接或读取上游失败时的状态码，超时返回504
+func upstreamStatus(err error) int {
+	if timeouts.PhaseOf(err) != "" {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// clientError 标记客户端连接上的读写错误
+func clientError(err error) error {
+	if timeouts.IsTimeout(err) {
+		return flow.NewError(flow.CodeClientTimeout, err)
+	}
+	return flow.NewError(flow.CodeClientAbort, err)
+}
+
+// upstreamError 标记读取上游响应的错误，连接中断为 upstream_reset，其他无法分类的错误为 protocol_error
+func upstreamError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, net.ErrClosed) {
+		return flow.Annotate(err, flow.CodeUpstreamReset)
+	}
+	return flow.Annotate(err, flow.CodeProtocolError)
+}
+
+// writeError 向客户端返回错误响应
+func writeError(writer *bufio.Writer, status int, err error) {
+	msg := err.Error()
+	fmt.Fprintf(writer, "HTTP/1.1 %d %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\n\r\n%s",
+		status, http.StatusText(status), len(msg), msg)
+	writer.Flush()
 }
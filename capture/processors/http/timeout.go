@@ -0,0 +1,76 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/timeouts"
+)
+
+// errorWriteTimeout 总超时到期后向客户端写入错误响应的时间
+const errorWriteTimeout = 5 * time.Second
+
+// flowTimer 一个流适用的超时和总超时的截止时间
+type flowTimer struct {
+	limits timeouts.Timeouts
+	client net.Conn
+
+	// deadline 总超时的截止时间，零值表示不限制
+	deadline time.Time
+}
+
+// newFlowTimer 创建从 start 开始计时的流超时，总超时同时作为客户端连接的读写截止时间
+func newFlowTimer(limits timeouts.Timeouts, start time.Time, client net.Conn) *flowTimer {
+	t := &flowTimer{limits: limits, client: client}
+	if limits.Flow > 0 {
+		t.deadline = start.Add(limits.Flow)
+		client.SetDeadline(t.deadline)
+	}
+	return t
+}
+
+// stop 清除客户端连接的截止时间
+func (t *flowTimer) stop() {
+	if !t.deadline.IsZero() {
+		t.client.SetDeadline(time.Time{})
+	}
+}
+
+// context 返回在总超时到期时取消的context
+func (t *flowTimer) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t.deadline.IsZero() {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, t.deadline)
+}
+
+// responseHeaderDeadline 返回等待上游响应头部的截止时间，取响应头部超时和总超时中较早的一个
+func (t *flowTimer) responseHeaderDeadline() time.Time {
+	if t.limits.ResponseHeader <= 0 {
+		return t.deadline
+	}
+	d := time.Now().Add(t.limits.ResponseHeader)
+	if !t.deadline.IsZero() && t.deadline.Before(d) {
+		return t.deadline
+	}
+	return d
+}
+
+// fail 记录流的错误并返回，总超时到期后的超时错误标记为 flow 阶段，超时的阶段记录在流的 TimedOut 字段
+func (t *flowTimer) fail(f *flow.Flow, err error) error {
+	if !t.deadline.IsZero() && !time.Now().Before(t.deadline) {
+		err = timeouts.Wrap(err, timeouts.PhaseFlow, t.limits.Flow)
+		// 留出时间向客户端返回504
+		t.client.SetWriteDeadline(time.Now().Add(errorWriteTimeout))
+	}
+	f.Fail(err)
+	f.TimedOut = string(timeouts.PhaseOf(err))
+	return err
+}
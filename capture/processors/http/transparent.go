@@ -0,0 +1,89 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/timeouts"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+	"github.com/f-dong/sniffy/capture/types"
+)
+
+// firstByteTimeout 透明代理等待客户端发送第一个字节的时间，超时后按服务器先发送数据的协议直接透传
+const firstByteTimeout = 2 * time.Second
+
+// handleTransparent 处理被重定向到透明代理的连接，target 为连接原来的目标地址。
+// TLS连接与CONNECT隧道一样解密或透传，HTTP请求直接转发到 target，其他协议透传。
+// 客户端不知道代理的存在，不进行代理认证
+func (p *Processor) handleTransparent(server types.Server, target string) error {
+	s := &session{
+		reader: p.conn.GetReader(),
+		writer: p.conn.GetWriter(),
+		scheme: "http",
+		target: target,
+	}
+	// 隧道流沿用CONNECT请求的记录方式
+	req := &http.Request{
+		Method:     http.MethodConnect,
+		URL:        &url.URL{Host: target},
+		Host:       target,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+	}
+
+	conn := p.conn.GetConn()
+	conn.SetReadDeadline(time.Now().Add(firstByteTimeout))
+	_, err := s.reader.Peek(1)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		if timeouts.IsTimeout(err) {
+			return p.passthrough(server, s, req, target, nil)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+
+	if hello, err := tlsinfo.PeekClientHello(s.reader); err == nil {
+		if p.decide(server, target, hello) != tlsinfo.ActionIntercept {
+			return p.passthrough(server, s, req, target, hello)
+		}
+		return p.intercept(server, s, req, target, hello)
+	}
+	if isHTTPRequest(s.reader) {
+		return p.serve(server, s)
+	}
+	return p.passthrough(server, s, req, target, nil)
+}
+
+// httpMethods 透明代理识别为HTTP请求的方法
+var httpMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// isHTTPRequest 判断已读取的数据是否以HTTP请求行开头
+func isHTTPRequest(reader *bufio.Reader) bool {
+	buf, _ := reader.Peek(reader.Buffered())
+	method, _, ok := bytes.Cut(buf, []byte(" "))
+	return ok && httpMethods[string(method)]
+}
@@ -0,0 +1,216 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/bufpool"
+	"github.com/f-dong/sniffy/capture/dialer"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/pool"
+	"github.com/f-dong/sniffy/capture/timeouts"
+	"github.com/f-dong/sniffy/capture/types"
+)
+
+// roundTrip 从连接池取得上游连接，发送请求并读取响应头部。
+// 复用的连接在收到响应前被上游关闭且请求体可以重新读取时，在新连接上重试一次。读完响应体后需要调用返回连接的 Release
+func (p *Processor) roundTrip(ctx context.Context, server types.Server, s *session, f *flow.Flow, timer *flowTimer, req *http.Request, scheme, host string) (*http.Response, *pool.Conn, error) {
+	key := pool.Key{Scheme: scheme, Addr: host}
+	if scheme == "https" {
+		key.ServerName = upstreamServerName(s, host)
+		// 出示了请求指定证书的连接不能用于其他请求
+		key.ClientCert = dialer.ClientCertificateID(ctx)
+	}
+	if server.GetDialer().ProxyProtocol() != 0 {
+		// PROXY protocol 头部携带客户端地址，连接不能在客户端之间共享
+		key.Source = p.conn.GetConn().RemoteAddr().String()
+	}
+	dial := func(ctx context.Context) (net.Conn, error) {
+		return p.dialUpstream(server, f, ctx, key)
+	}
+
+	connPool := server.GetPool()
+	get := connPool.Get
+	for {
+		dialCtx, cancel := timer.context(ctx)
+		conn, err := get(dialCtx, key, dial)
+		cancel()
+		if err != nil {
+			return nil, nil, flow.Annotate(err, flow.CodeDialFailed)
+		}
+		recordConn(f, conn)
+
+		var resp *http.Response
+		if conn.HTTP2() {
+			resp, err = exchangeH2(ctx, conn, req, f, timer)
+		} else {
+			resp, err = exchange(conn, req, f, timer)
+		}
+		if err == nil {
+			return resp, conn, nil
+		}
+		conn.Release(false)
+		if !conn.Retryable(err) || !f.Timings.FirstByte.IsZero() || req.GetBody == nil {
+			return nil, nil, err
+		}
+		server.LogDebug("reused connection to %s failed before response, retrying: %v", key, err)
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, nil, err
+		}
+		get = connPool.Dial
+	}
+}
+
+// dialUpstream 建立新的上游连接，https 会在TCP连接上完成TLS握手，启用h2时同时声明h2
+func (p *Processor) dialUpstream(server types.Server, f *flow.Flow, ctx context.Context, key pool.Key) (net.Conn, error) {
+	ctx = dialer.WithSourceAddr(ctx, p.conn.GetConn().RemoteAddr())
+	ctx = dialer.WithTimings(ctx, f.Timings)
+	if key.Scheme != "https" {
+		ctx = dialer.WithScheme(ctx, key.Scheme)
+		return server.GetDialer().DialContext(ctx, "tcp", key.Addr)
+	}
+
+	protos := []string{"http/1.1"}
+	if server.GetPool().HTTP2() {
+		protos = []string{"h2", "http/1.1"}
+	}
+	tlsConn, err := server.GetDialer().DialTLSContext(ctx, "tcp", key.Addr, &tls.Config{
+		ServerName:   key.ServerName,
+		NextProtos:   protos,
+		KeyLogWriter: server.GetKeyLogWriter(),
+	})
+	if err != nil {
+		var verifyErr *dialer.VerifyError
+		if errors.As(err, &verifyErr) {
+			f.UpstreamTLS = verifyErr.Info
+		}
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// upstreamServerName 返回连接上游使用的SNI，目标与CONNECT的目标相同时沿用客户端的SNI
+func upstreamServerName(s *session, host string) string {
+	if s.hello != nil && s.hello.ServerName != "" && host == s.target {
+		return s.hello.ServerName
+	}
+	name, _, _ := net.SplitHostPort(host)
+	return name
+}
+
+// recordConn 在流中记录上游地址、TLS会话信息和JA3S指纹，复用的连接沿用建立时的信息
+func recordConn(f *flow.Flow, conn *pool.Conn) {
+	f.ServerAddr = conn.RemoteAddr().String()
+	f.ConnReused = conn.Reused()
+	tlsConn, ok := conn.Conn.(*dialer.TLSConn)
+	if !ok {
+		return
+	}
+	f.UpstreamTLS = tlsConn.Info
+	if tlsConn.ServerHello != nil && f.Fingerprints != nil {
+		f.Fingerprints.JA3S = tlsConn.ServerHello.JA3S()
+	}
+}
+
+// exchange 在HTTP/1.1连接上写入请求并读取响应头部
+func exchange(conn *pool.Conn, req *http.Request, f *flow.Flow, timer *flowTimer) (*http.Response, error) {
+	conn.SetDeadline(timer.deadline)
+	// 客户端要求关闭连接不影响上游连接的复用
+	out := *req
+	out.Close = false
+	// Request.Write 遇到不带缓冲的连接时每次分配新的 bufio.Writer
+	bw := bufpool.NewWriter(conn)
+	err := out.Write(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	bufpool.PutWriter(bw)
+	if err != nil {
+		return nil, flow.Annotate(err, flow.CodeUpstreamReset)
+	}
+	f.Timings.RequestSent = time.Now()
+
+	headerDeadline := timer.responseHeaderDeadline()
+	conn.SetReadDeadline(headerDeadline)
+	_, err = conn.Reader.Peek(1)
+	var resp *http.Response
+	if err == nil {
+		f.Timings.FirstByte = time.Now()
+		resp, err = http.ReadResponse(conn.Reader, req)
+	}
+	if err != nil {
+		if !headerDeadline.Equal(timer.deadline) {
+			err = timeouts.Wrap(err, timeouts.PhaseResponseHeader, timer.limits.ResponseHeader)
+		}
+		return nil, upstreamError(err)
+	}
+	conn.SetReadDeadline(timer.deadline)
+	return resp, nil
+}
+
+// exchangeH2 在h2连接上发送请求并等待响应头部。连接由多个请求共享，
+// 总超时和等待响应头部的超时通过请求的context实现，读完响应体前context保持有效
+func exchangeH2(ctx context.Context, conn *pool.Conn, req *http.Request, f *flow.Flow, timer *flowTimer) (*http.Response, error) {
+	rctx, cancelCause := context.WithCancelCause(ctx)
+	cancel := func() { cancelCause(nil) }
+	if !timer.deadline.IsZero() {
+		var cancelDeadline context.CancelFunc
+		rctx, cancelDeadline = context.WithDeadline(rctx, timer.deadline)
+		cancel = func() {
+			cancelDeadline()
+			cancelCause(nil)
+		}
+	}
+	if limit, deadline := timer.limits.ResponseHeader, timer.responseHeaderDeadline(); limit > 0 && !deadline.Equal(timer.deadline) {
+		headerTimer := time.AfterFunc(time.Until(deadline), func() {
+			cancelCause(&timeouts.Error{Phase: timeouts.PhaseResponseHeader, Limit: limit, Err: context.DeadlineExceeded})
+		})
+		defer headerTimer.Stop()
+	}
+	rctx = httptrace.WithClientTrace(rctx, &httptrace.ClientTrace{
+		WroteRequest:         func(httptrace.WroteRequestInfo) { f.Timings.RequestSent = time.Now() },
+		GotFirstResponseByte: func() { f.Timings.FirstByte = time.Now() },
+	})
+
+	out := req.Clone(rctx)
+	out.URL.Scheme = "https"
+	out.URL.Host = conn.Key().Addr
+	if out.Host == "" {
+		out.Host = conn.Key().Addr
+	}
+	out.Close = false
+	resp, err := conn.RoundTrip(out)
+	if err != nil {
+		var te *timeouts.Error
+		if cause := context.Cause(rctx); errors.As(cause, &te) {
+			err = te
+		}
+		cancel()
+		return nil, upstreamError(err)
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody 关闭时取消请求context的响应体
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
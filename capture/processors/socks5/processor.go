@@ -7,10 +7,40 @@ package socks5
 
 import (
 	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
 
+	httpproc "github.com/f-dong/sniffy/capture/processors/http"
+	"github.com/f-dong/sniffy/capture/transparent"
 	"github.com/f-dong/sniffy/capture/types"
 )
 
+// 协议常量，见 RFC 1928 和 RFC 1929
+const (
+	version     = 0x05
+	authVersion = 0x01
+
+	methodNoAuth   = 0x00
+	methodPassword = 0x02
+	methodNone     = 0xFF
+
+	cmdConnect = 0x01
+
+	atypIPv4   = 0x01
+	atypDomain = 0x03
+	atypIPv6   = 0x04
+
+	replySucceeded           = 0x00
+	replyCommandNotSupported = 0x07
+	replyAddressNotSupported = 0x08
+)
+
 // Processor SOCKS5协议处理器
 type Processor struct {
 	conn types.Connection
@@ -40,13 +70,173 @@ func (p *Processor) Process() error {
 	return p.handleSocks5Protocol(server, reader, writer)
 }
 
-// handleSocks5Protocol 处理SOCKS5协议的具体逻辑
+// handleSocks5Protocol 完成握手和认证，读取 CONNECT 请求的目标地址后，
+// 把连接交给HTTP处理器按透明代理处理：TLS连接解密或透传，HTTP请求记录为流，其他协议透传。
+// 只支持 CONNECT 命令；上游连接在处理第一个请求时建立，因此总是先回复成功
 func (p *Processor) handleSocks5Protocol(server types.Server, reader *bufio.Reader, writer *bufio.Writer) error {
-	// SOCKS5协议处理逻辑
-	server.LogInfo("处理SOCKS5协议...")
+	if err := negotiate(server, reader, writer); err != nil {
+		return err
+	}
+	target, err := readRequest(reader, writer)
+	if err != nil {
+		return err
+	}
+	if err := reply(writer, replySucceeded); err != nil {
+		return err
+	}
+	server.LogInfo("SOCKS5 CONNECT %s", target)
+
+	ctx := transparent.WithTarget(p.conn.GetContext(), target)
+	return httpproc.New(&tunnel{Connection: p.conn, ctx: ctx}).Process()
+}
+
+// tunnel 带有 CONNECT 目标地址的连接，读取器中已缓冲的数据保持不变
+type tunnel struct {
+	types.Connection
+	ctx context.Context
+}
 
-	// 这里应该实现实际的SOCKS5协议处理逻辑
-	// 例如：SOCKS5握手、身份验证、连接建立等
+// GetContext 返回带有目标地址的上下文
+func (t *tunnel) GetContext() context.Context {
+	return t.ctx
+}
 
+// negotiate 选择认证方法，配置了代理用户时要求用户名和密码认证
+func negotiate(server types.Server, reader *bufio.Reader, writer *bufio.Writer) error {
+	var head [2]byte
+	if _, err := io.ReadFull(reader, head[:]); err != nil {
+		return fmt.Errorf("socks5: read greeting: %w", err)
+	}
+	if head[0] != version {
+		return fmt.Errorf("socks5: unsupported version %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(reader, methods); err != nil {
+		return fmt.Errorf("socks5: read greeting: %w", err)
+	}
+
+	authenticator := server.GetAuth()
+	want := byte(methodNoAuth)
+	if authenticator.RequiresCredentials() {
+		want = methodPassword
+	}
+	if !slices.Contains(methods, want) {
+		writer.Write([]byte{version, methodNone})
+		writer.Flush()
+		return fmt.Errorf("socks5: client does not offer authentication method %d", want)
+	}
+	if _, err := writer.Write([]byte{version, want}); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if want == methodNoAuth {
+		return nil
+	}
+
+	user, password, err := readCredentials(reader)
+	if err != nil {
+		return err
+	}
+	status := byte(0x00)
+	if !authenticator.CheckUser(user, password) {
+		status = 0x01
+	}
+	if _, err := writer.Write([]byte{authVersion, status}); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if status != 0x00 {
+		return fmt.Errorf("socks5: authentication failed for user %q", user)
+	}
 	return nil
 }
+
+// readCredentials 读取用户名和密码认证的请求
+func readCredentials(reader *bufio.Reader) (user, password string, err error) {
+	ver, err := reader.ReadByte()
+	if err != nil {
+		return "", "", fmt.Errorf("socks5: read credentials: %w", err)
+	}
+	if ver != authVersion {
+		return "", "", fmt.Errorf("socks5: unsupported authentication version %d", ver)
+	}
+	if user, err = readString(reader); err != nil {
+		return "", "", fmt.Errorf("socks5: read credentials: %w", err)
+	}
+	if password, err = readString(reader); err != nil {
+		return "", "", fmt.Errorf("socks5: read credentials: %w", err)
+	}
+	return user, password, nil
+}
+
+// readRequest 读取请求，返回 CONNECT 的目标地址 host:port，不支持的命令和地址类型回复错误
+func readRequest(reader *bufio.Reader, writer *bufio.Writer) (string, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(reader, head[:]); err != nil {
+		return "", fmt.Errorf("socks5: read request: %w", err)
+	}
+	if head[0] != version {
+		return "", fmt.Errorf("socks5: unsupported version %d", head[0])
+	}
+
+	var host string
+	switch head[3] {
+	case atypIPv4, atypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if head[3] == atypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(reader, ip); err != nil {
+			return "", fmt.Errorf("socks5: read request: %w", err)
+		}
+		host = ip.String()
+	case atypDomain:
+		domain, err := readString(reader)
+		if err != nil {
+			return "", fmt.Errorf("socks5: read request: %w", err)
+		}
+		host = domain
+	default:
+		reply(writer, replyAddressNotSupported)
+		return "", fmt.Errorf("socks5: unsupported address type %d", head[3])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(reader, port[:]); err != nil {
+		return "", fmt.Errorf("socks5: read request: %w", err)
+	}
+
+	if head[1] != cmdConnect {
+		reply(writer, replyCommandNotSupported)
+		return "", fmt.Errorf("socks5: unsupported command %d", head[1])
+	}
+	if host == "" {
+		reply(writer, replyAddressNotSupported)
+		return "", errors.New("socks5: empty destination host")
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// reply 发送回复，绑定地址总是 0.0.0.0:0
+func reply(writer *bufio.Writer, code byte) error {
+	if _, err := writer.Write([]byte{version, code, 0x00, atypIPv4, 0, 0, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// readString 读取以一个字节长度开头的字符串
+func readString(reader *bufio.Reader) (string, error) {
+	n, err := reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
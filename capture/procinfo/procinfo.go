@@ -0,0 +1,78 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package procinfo
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// ErrNotFound 未找到拥有该套接字的进程
+var ErrNotFound = errors.New("procinfo: owning process not found")
+
+// ErrUnsupported 当前平台不支持进程查询
+var ErrUnsupported = errors.New("procinfo: process lookup not supported on this platform")
+
+// Process 拥有客户端套接字的本地进程信息
+type Process struct {
+	// PID 进程ID
+	PID int `json:"pid"`
+
+	// Name 进程名
+	Name string `json:"name"`
+
+	// Path 可执行文件路径，可能为空
+	Path string `json:"path,omitempty"`
+
+	// Cgroup 进程所在的 cgroup v2 路径，仅由eBPF重定向的连接可用
+	Cgroup string `json:"cgroup,omitempty"`
+}
+
+// Lookup 查找发起连接的本地进程。client 为客户端套接字地址（即代理看到的远端地址），
+// server 为代理监听的本地地址。非本机连接返回 ErrNotFound
+func Lookup(client, server net.Addr) (*Process, error) {
+	c, ok1 := client.(*net.TCPAddr)
+	s, ok2 := server.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		return nil, ErrNotFound
+	}
+	if !IsLocal(c.IP) {
+		return nil, ErrNotFound
+	}
+	return lookup(c, s)
+}
+
+// IsLocal 判断IP是否属于本机
+func IsLocal(ip net.IP) bool {
+	if ip.IsLoopback() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// processKey 上下文中进程信息的键
+type processKey struct{}
+
+// WithProcess 返回带有发起连接的进程的上下文，已经知道进程时（例如eBPF重定向的连接）不再查找
+func WithProcess(ctx context.Context, p *Process) context.Context {
+	return context.WithValue(ctx, processKey{}, p)
+}
+
+// FromContext 返回 WithProcess 附加的进程
+func FromContext(ctx context.Context) (*Process, bool) {
+	p, ok := ctx.Value(processKey{}).(*Process)
+	return p, ok && p != nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build darwin
+
+package procinfo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// lookup 使用 lsof 查找持有客户端套接字的进程
+func lookup(client, server *net.TCPAddr) (*Process, error) {
+	out, err := exec.Command("lsof", "-nP", "-Fpcn",
+		fmt.Sprintf("-iTCP@%s", net.JoinHostPort(client.IP.String(), strconv.Itoa(client.Port))),
+		"-sTCP:ESTABLISHED").Output()
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	// lsof -F 输出以字段标识字符开头，p=PID c=命令名 n=连接描述
+	want := "->" + net.JoinHostPort(server.IP.String(), strconv.Itoa(server.Port))
+	var cur *Process
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		switch line[0] {
+		case 'p':
+			pid, _ := strconv.Atoi(line[1:])
+			cur = &Process{PID: pid}
+		case 'c':
+			if cur != nil {
+				cur.Name = line[1:]
+			}
+		case 'n':
+			if cur != nil && (server.IP.IsUnspecified() || strings.HasSuffix(line, want)) {
+				cur.Path = executablePath(cur.PID)
+				return cur, nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func executablePath(pid int) string {
+	out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
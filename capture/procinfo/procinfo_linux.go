@@ -0,0 +1,150 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package procinfo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lookup 通过 /proc/net/tcp{,6} 找到套接字inode，再扫描 /proc/*/fd 找到持有者
+func lookup(client, server *net.TCPAddr) (*Process, error) {
+	inode, err := findInode(client, server)
+	if err != nil {
+		return nil, err
+	}
+
+	pid, err := findPID(inode)
+	if err != nil {
+		return nil, err
+	}
+
+	return processInfo(pid), nil
+}
+
+// findInode 在内核TCP表中查找本地地址为 client、远端地址为 server 的套接字
+func findInode(client, server *net.TCPAddr) (string, error) {
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		inode, err := scanTable(table, client, server)
+		if err == nil {
+			return inode, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func scanTable(path string, client, server *net.TCPAddr) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // 跳过表头
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, err := parseHexAddr(fields[1])
+		if err != nil || !addrEqual(local, client) {
+			continue
+		}
+		remote, err := parseHexAddr(fields[2])
+		if err != nil || !addrEqual(remote, server) {
+			continue
+		}
+		return fields[9], nil
+	}
+	return "", ErrNotFound
+}
+
+// parseHexAddr 解析 /proc/net/tcp 中 "0100007F:1F90" 形式的地址。
+// 内核按主机字节序输出每个32位分组，这里假设主机是小端（x86、arm64 等）
+func parseHexAddr(s string) (*net.TCPAddr, error) {
+	ipHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+	raw, err := hex.DecodeString(ipHex)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个32位分组按小端读出后还原为网络字节序
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.LittleEndian.Uint32(raw[i:]))
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func addrEqual(a, b *net.TCPAddr) bool {
+	if a.Port != b.Port {
+		return false
+	}
+	if b.IP.IsUnspecified() {
+		return true
+	}
+	return a.IP.Equal(b.IP)
+}
+
+// findPID 扫描所有进程的文件描述符，找到持有指定套接字inode的进程
+func findPID(inode string) (int, error) {
+	target := "socket:[" + inode + "]"
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", p.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err == nil && link == target {
+				return pid, nil
+			}
+		}
+	}
+	return 0, ErrNotFound
+}
+
+// ForPID 返回进程 pid 的进程名和可执行文件路径，进程已经退出时只有PID
+func ForPID(pid int) *Process {
+	return processInfo(pid)
+}
+
+func processInfo(pid int) *Process {
+	p := &Process{PID: pid}
+	if comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid)); err == nil {
+		p.Name = strings.TrimSpace(string(comm))
+	}
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		p.Path = exe
+	}
+	return p
+}
@@ -0,0 +1,14 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !windows
+
+package procinfo
+
+import "net"
+
+func lookup(client, server *net.TCPAddr) (*Process, error) {
+	return nil, ErrUnsupported
+}
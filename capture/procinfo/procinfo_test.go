@@ -0,0 +1,125 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package procinfo
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// tcpTable /proc/net/tcp 中的表头和行：监听 127.0.0.1:8080 的套接字和 127.0.0.1:54321 到它的连接
+const tcpTable = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 36845 1 00000000162b1d70 100 0 0 10 0
+   1: 0100007F:D431 0100007F:1F90 01 00000000:00000000 00:00000000 00000000  1000        0 40012 1 00000000adcb0181 20 4 30 10 -1
+`
+
+// tcp6Table /proc/net/tcp6 中的表头和行：监听 [::]:443 的套接字，IPv4映射地址 ::ffff:192.0.2.7:40000
+// 和 [2001:db8::1]:40001 到它的连接
+const tcp6Table = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:01BB 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 949562 1 000000002eaf8764 100 0 0 10 0
+   1: 0000000000000000FFFF0000070200C0:9C40 0000000000000000FFFF00000100007F:01BB 01 00000000:00000000 00:00000000 00000000  1000        0 949600 1 0000000011111111 20 4 30 10 -1
+   2: B80D0120000000000000000001000000:9C41 00000000000000000000000001000000:01BB 01 00000000:00000000 00:00000000 00000000  1000        0 949601 1 0000000022222222 20 4 30 10 -1
+`
+
+// tcpAddr 解析 host:port 形式的地址
+func tcpAddr(t *testing.T, s string) *net.TCPAddr {
+	t.Helper()
+	addr, err := net.ResolveTCPAddr("tcp", s)
+	require.NoError(t, err)
+	return addr
+}
+
+// writeTable 把内核TCP表写入临时文件
+func writeTable(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tcp")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+// --- 测试代码 ---
+
+func TestParseHexAddr(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"0100007F:1F90", "127.0.0.1:8080"},
+		{"00000000:0000", "0.0.0.0:0"},
+		{"0202000A:D431", "10.0.2.2:54321"},
+		{"00000000000000000000000001000000:46AB", "[::1]:18091"},
+		{"00000000000000000000000000000000:01BB", "[::]:443"},
+		{"B80D0120000000000000000001000000:9C41", "[2001:db8::1]:40001"},
+		{"0000000000000000FFFF0000070200C0:9C40", "192.0.2.7:40000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			addr, err := parseHexAddr(tt.in)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, addr.String())
+		})
+	}
+
+	for _, in := range []string{"0100007F", "0100007G:1F90", "01007F:1F90", "0100007F:10000", "0100007F:"} {
+		_, err := parseHexAddr(in)
+		require.Error(t, err, in)
+	}
+}
+
+func TestAddrEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"same IPv4", "127.0.0.1:8080", "127.0.0.1:8080", true},
+		{"different port", "127.0.0.1:8080", "127.0.0.1:8081", false},
+		{"different IPv4", "127.0.0.1:8080", "127.0.0.2:8080", false},
+		{"same IPv6", "[2001:db8::1]:443", "[2001:db8::1]:443", true},
+		{"different IPv6", "[2001:db8::1]:443", "[2001:db8::2]:443", false},
+		{"v4-mapped and IPv4", "[::ffff:192.0.2.7]:40000", "192.0.2.7:40000", true},
+		{"unspecified IPv4 matches any address", "192.0.2.7:443", "0.0.0.0:443", true},
+		{"unspecified IPv6 matches any address", "[2001:db8::1]:443", "[::]:443", true},
+		{"unspecified still compares ports", "192.0.2.7:443", "0.0.0.0:80", false},
+		{"unspecified only on the right", "0.0.0.0:443", "192.0.2.7:443", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, addrEqual(tcpAddr(t, tt.a), tcpAddr(t, tt.b)))
+		})
+	}
+}
+
+func TestScanTable(t *testing.T) {
+	tcp := writeTable(t, tcpTable)
+	tcp6 := writeTable(t, tcp6Table)
+	tests := []struct {
+		table          string
+		client, server string
+		inode          string
+	}{
+		{tcp, "127.0.0.1:54321", "127.0.0.1:8080", "40012"},
+		{tcp6, "192.0.2.7:40000", "127.0.0.1:443", "949600"},
+		{tcp6, "[2001:db8::1]:40001", "[::1]:443", "949601"},
+		{tcp6, "[2001:db8::1]:40001", "[::]:443", "949601"},
+	}
+	for _, tt := range tests {
+		inode, err := scanTable(tt.table, tcpAddr(t, tt.client), tcpAddr(t, tt.server))
+		require.NoError(t, err, "%s -> %s", tt.client, tt.server)
+		require.Equal(t, tt.inode, inode)
+	}
+
+	_, err := scanTable(tcp, tcpAddr(t, "127.0.0.1:54322"), tcpAddr(t, "127.0.0.1:8080"))
+	require.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,99 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build windows
+
+package procinfo
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	iphlpapi                       = syscall.NewLazyDLL("iphlpapi.dll")
+	kernel32                       = syscall.NewLazyDLL("kernel32.dll")
+	procGetExtendedTcpTable        = iphlpapi.NewProc("GetExtendedTcpTable")
+	procQueryFullProcessImageNameW = kernel32.NewProc("QueryFullProcessImageNameW")
+)
+
+const (
+	afInet                         = 2
+	afInet6                        = 23
+	tcpTableOwnerPidConnections    = 4
+	processQueryLimitedInformation = 0x1000
+	errInsufficientBuffer          = 122
+)
+
+// lookup 通过 GetExtendedTcpTable 查找持有客户端套接字的进程
+func lookup(client, server *net.TCPAddr) (*Process, error) {
+	family, rowSize := uint32(afInet), 24
+	if client.IP.To4() == nil {
+		family, rowSize = afInet6, 56
+	}
+
+	var size uint32
+	procGetExtendedTcpTable.Call(0, uintptr(unsafe.Pointer(&size)), 0, uintptr(family), tcpTableOwnerPidConnections, 0)
+	if size == 0 {
+		return nil, ErrNotFound
+	}
+	buf := make([]byte, size)
+	ret, _, _ := procGetExtendedTcpTable.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0,
+		uintptr(family), tcpTableOwnerPidConnections, 0)
+	if ret != 0 {
+		return nil, ErrNotFound
+	}
+
+	count := int(binary.LittleEndian.Uint32(buf[0:4]))
+	for i := 0; i < count; i++ {
+		row := buf[4+i*rowSize : 4+(i+1)*rowSize]
+		local, remote, pid := parseRow(row, family)
+		if addrEqual(local, client) && addrEqual(remote, server) {
+			return processInfo(pid), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// parseRow 解析 MIB_TCPROW_OWNER_PID / MIB_TCP6ROW_OWNER_PID
+func parseRow(row []byte, family uint32) (*net.TCPAddr, *net.TCPAddr, int) {
+	port := func(b []byte) int { return int(b[0])<<8 | int(b[1]) }
+	if family == afInet {
+		local := &net.TCPAddr{IP: net.IP(append([]byte(nil), row[4:8]...)), Port: port(row[8:10])}
+		remote := &net.TCPAddr{IP: net.IP(append([]byte(nil), row[12:16]...)), Port: port(row[16:18])}
+		return local, remote, int(binary.LittleEndian.Uint32(row[20:24]))
+	}
+	local := &net.TCPAddr{IP: net.IP(append([]byte(nil), row[0:16]...)), Port: port(row[20:22])}
+	remote := &net.TCPAddr{IP: net.IP(append([]byte(nil), row[24:40]...)), Port: port(row[44:46])}
+	return local, remote, int(binary.LittleEndian.Uint32(row[52:56]))
+}
+
+func addrEqual(a, b *net.TCPAddr) bool {
+	if a.Port != b.Port {
+		return false
+	}
+	return b.IP.IsUnspecified() || a.IP.Equal(b.IP)
+}
+
+func processInfo(pid int) *Process {
+	p := &Process{PID: pid}
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return p
+	}
+	defer syscall.CloseHandle(h)
+
+	buf := make([]uint16, syscall.MAX_PATH)
+	size := uint32(len(buf))
+	ret, _, _ := procQueryFullProcessImageNameW.Call(uintptr(h), 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if ret != 0 {
+		p.Path = syscall.UTF16ToString(buf[:size])
+		p.Name = filepath.Base(p.Path)
+	}
+	return p
+}
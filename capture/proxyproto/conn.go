@@ -0,0 +1,96 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package proxyproto
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"time"
+)
+
+// Conn 解析过PROXY protocol头部的连接，RemoteAddr/LocalAddr 返回头部中的原始地址
+type Conn struct {
+	net.Conn
+	reader *bufio.Reader
+	header *Header
+}
+
+// NewConn 读取连接开头的PROXY protocol头部；required 为false时允许不带头部的连接，
+// timeout 限制读取头部的时间
+func NewConn(conn net.Conn, required bool, timeout time.Duration) (*Conn, error) {
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	reader := bufio.NewReader(conn)
+	header, err := ReadHeader(reader)
+	if errors.Is(err, ErrNoHeader) && !required {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		Conn:   conn,
+		reader: reader,
+		header: header,
+	}, nil
+}
+
+// Read 先读取头部之后已缓冲的数据
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// Header 返回解析出的头部，未携带头部时返回nil
+func (c *Conn) Header() *Header {
+	return c.header
+}
+
+// PeerAddr 返回直接相连的对端地址（通常是负载均衡器）
+func (c *Conn) PeerAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
+
+// NetConn 返回底层连接
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// RawConn 返回底层连接，头部之后读入缓冲的数据还没有读完时返回nil
+func (c *Conn) RawConn() net.Conn {
+	if c.reader.Buffered() > 0 {
+		return nil
+	}
+	return c.Conn
+}
+
+// RemoteAddr 返回原始客户端地址
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.header != nil && !c.header.Local && c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr 返回原始目标地址
+func (c *Conn) LocalAddr() net.Addr {
+	if c.header != nil && !c.header.Local && c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// CloseWrite 半关闭底层连接的写方向
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
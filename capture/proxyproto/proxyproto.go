@@ -0,0 +1,268 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// v2Signature PROXY protocol v2 固定签名
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1Prefix PROXY protocol v1 前缀
+var v1Prefix = []byte("PROXY ")
+
+// v1MaxLength v1 头部最大长度（含CRLF）
+const v1MaxLength = 107
+
+// ErrNoHeader 连接数据不以PROXY protocol头部开始
+var ErrNoHeader = errors.New("proxyproto: no PROXY protocol header")
+
+// Header PROXY protocol头部信息
+type Header struct {
+	// Version 协议版本，1或2
+	Version int
+
+	// Local 是否为LOCAL命令（健康检查等，不携带地址）
+	Local bool
+
+	// Source 原始客户端地址
+	Source net.Addr
+
+	// Destination 原始目标地址
+	Destination net.Addr
+}
+
+// HasHeader 检查缓冲读取器中的数据是否以PROXY protocol头部开始
+func HasHeader(reader *bufio.Reader) bool {
+	if b, err := reader.Peek(len(v1Prefix)); err == nil && bytes.Equal(b, v1Prefix) {
+		return true
+	}
+	if b, err := reader.Peek(len(v2Signature)); err == nil && bytes.Equal(b, v2Signature) {
+		return true
+	}
+	return false
+}
+
+// ReadHeader 从缓冲读取器读取并解析PROXY protocol头部，
+// 如果数据不以头部开始则返回 ErrNoHeader 且不消耗任何数据
+func ReadHeader(reader *bufio.Reader) (*Header, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case v1Prefix[0]:
+		if b, err := reader.Peek(len(v1Prefix)); err != nil || !bytes.Equal(b, v1Prefix) {
+			return nil, ErrNoHeader
+		}
+		return readV1(reader)
+	case v2Signature[0]:
+		if b, err := reader.Peek(len(v2Signature)); err != nil || !bytes.Equal(b, v2Signature) {
+			return nil, ErrNoHeader
+		}
+		return readV2(reader)
+	default:
+		return nil, ErrNoHeader
+	}
+}
+
+// readV1 解析文本格式的v1头部
+func readV1(reader *bufio.Reader) (*Header, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("proxyproto: v1 header too long or not terminated by CRLF")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) < 2 {
+		return nil, errors.New("proxyproto: malformed v1 header")
+	}
+
+	h := &Header{Version: 1}
+	switch fields[1] {
+	case "UNKNOWN":
+		h.Local = true
+		return h, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, fmt.Errorf("proxyproto: unsupported v1 protocol %q", fields[1])
+	}
+
+	if len(fields) != 6 {
+		return nil, errors.New("proxyproto: malformed v1 header")
+	}
+
+	src, err := parseV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseV1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+	h.Source, h.Destination = src, dst
+	return h, nil
+}
+
+// parseV1Addr 解析v1头部中的地址和端口
+func parseV1Addr(ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("proxyproto: invalid address %q", ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("proxyproto: invalid port %q", port)
+	}
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+// readV2 解析二进制格式的v2头部
+func readV2(reader *bufio.Reader) (*Header, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(reader, fixed[:]); err != nil {
+		return nil, err
+	}
+
+	if fixed[12]>>4 != 2 {
+		return nil, fmt.Errorf("proxyproto: unsupported v2 version %d", fixed[12]>>4)
+	}
+
+	length := int(binary.BigEndian.Uint16(fixed[14:16]))
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+
+	h := &Header{Version: 2}
+	switch fixed[12] & 0x0f {
+	case 0x00:
+		h.Local = true
+		return h, nil
+	case 0x01:
+	default:
+		return nil, fmt.Errorf("proxyproto: unsupported v2 command %d", fixed[12]&0x0f)
+	}
+
+	switch fixed[13] >> 4 {
+	case 0x1:
+		if len(payload) < 12 {
+			return nil, errors.New("proxyproto: short v2 IPv4 address block")
+		}
+		h.Source = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+	case 0x2:
+		if len(payload) < 36 {
+			return nil, errors.New("proxyproto: short v2 IPv6 address block")
+		}
+		h.Source = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+	default:
+		// UNSPEC 或 UNIX 地址族：保留连接的真实地址
+		h.Local = true
+	}
+
+	return h, nil
+}
+
+// Format 将头部按指定版本序列化
+func (h *Header) Format() ([]byte, error) {
+	switch h.Version {
+	case 1:
+		return h.formatV1()
+	case 2:
+		return h.formatV2()
+	default:
+		return nil, fmt.Errorf("proxyproto: unsupported version %d", h.Version)
+	}
+}
+
+// WriteTo 将头部写入w
+func (h *Header) WriteTo(w io.Writer) (int64, error) {
+	b, err := h.Format()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+func (h *Header) formatV1() ([]byte, error) {
+	src, dst, ok := h.tcpAddrs()
+	if h.Local || !ok {
+		return []byte("PROXY UNKNOWN\r\n"), nil
+	}
+
+	proto := "TCP4"
+	if src.IP.To4() == nil || dst.IP.To4() == nil {
+		proto = "TCP6"
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, src.IP, dst.IP, src.Port, dst.Port)), nil
+}
+
+func (h *Header) formatV2() ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, 16+36))
+	buf.Write(v2Signature)
+
+	src, dst, ok := h.tcpAddrs()
+	if h.Local || !ok {
+		buf.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return buf.Bytes(), nil
+	}
+
+	var port [2]byte
+	if src4, dst4 := src.IP.To4(), dst.IP.To4(); src4 != nil && dst4 != nil {
+		buf.Write([]byte{0x21, 0x11, 0x00, 12})
+		buf.Write(src4)
+		buf.Write(dst4)
+	} else {
+		buf.Write([]byte{0x21, 0x21, 0x00, 36})
+		buf.Write(src.IP.To16())
+		buf.Write(dst.IP.To16())
+	}
+	binary.BigEndian.PutUint16(port[:], uint16(src.Port))
+	buf.Write(port[:])
+	binary.BigEndian.PutUint16(port[:], uint16(dst.Port))
+	buf.Write(port[:])
+
+	return buf.Bytes(), nil
+}
+
+// tcpAddrs 返回TCP形式的源地址和目标地址
+func (h *Header) tcpAddrs() (*net.TCPAddr, *net.TCPAddr, bool) {
+	src, ok1 := h.Source.(*net.TCPAddr)
+	dst, ok2 := h.Destination.(*net.TCPAddr)
+	return src, dst, ok1 && ok2
+}
+
+// NewHeader 根据连接的源地址和目标地址创建头部
+func NewHeader(version int, source, destination net.Addr) *Header {
+	return &Header{
+		Version:     version,
+		Source:      source,
+		Destination: destination,
+	}
+}
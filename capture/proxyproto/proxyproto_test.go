@@ -0,0 +1,131 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func tcpAddr(t *testing.T, s string) *net.TCPAddr {
+	addr, err := net.ResolveTCPAddr("tcp", s)
+	require.NoError(t, err)
+	return addr
+}
+
+// --- 测试代码 ---
+func TestReadHeader_V1(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		wantSrc string
+		wantDst string
+		local   bool
+		wantErr bool
+	}{
+		{"tcp4", "PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\nGET /", "192.168.0.1:56324", "10.0.0.1:443", false, false},
+		{"tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 1000 80\r\nGET /", "[2001:db8::1]:1000", "[2001:db8::2]:80", false, false},
+		{"unknown", "PROXY UNKNOWN\r\nGET /", "", "", true, false},
+		{"bad port", "PROXY TCP4 1.2.3.4 5.6.7.8 99999 80\r\n", "", "", false, true},
+		{"no crlf", "PROXY TCP4 1.2.3.4 5.6.7.8 1 80\n", "", "", false, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tc.input))
+			h, err := ReadHeader(reader)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, 1, h.Version)
+			require.Equal(t, tc.local, h.Local)
+			if !tc.local {
+				require.Equal(t, tc.wantSrc, h.Source.String())
+				require.Equal(t, tc.wantDst, h.Destination.String())
+			}
+			rest, _ := reader.ReadString('/')
+			require.Equal(t, "GET /", rest)
+		})
+	}
+}
+
+func TestReadHeader_NoHeader(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n"))
+	_, err := ReadHeader(reader)
+	require.ErrorIs(t, err, ErrNoHeader)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "GET / HTTP/1.1\r\n", line)
+}
+
+func TestHeader_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  string
+		dst  string
+	}{
+		{"ipv4", "203.0.113.7:51000", "198.51.100.1:8443"},
+		{"ipv6", "[2001:db8::7]:51000", "[2001:db8::1]:443"},
+	}
+	for _, version := range []int{1, 2} {
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				h := NewHeader(version, tcpAddr(t, tc.src), tcpAddr(t, tc.dst))
+				var buf bytes.Buffer
+				_, err := h.WriteTo(&buf)
+				require.NoError(t, err)
+				buf.WriteString("payload")
+
+				reader := bufio.NewReader(&buf)
+				require.True(t, HasHeader(reader))
+				parsed, err := ReadHeader(reader)
+				require.NoError(t, err)
+				require.Equal(t, version, parsed.Version)
+				require.Equal(t, tc.src, parsed.Source.String())
+				require.Equal(t, tc.dst, parsed.Destination.String())
+				rest, _ := reader.ReadString(0)
+				require.Equal(t, "payload", rest)
+			})
+		}
+	}
+}
+
+func TestHeader_V2Local(t *testing.T) {
+	h := &Header{Version: 2, Local: true}
+	b, err := h.Format()
+	require.NoError(t, err)
+	parsed, err := ReadHeader(bufio.NewReader(bytes.NewReader(b)))
+	require.NoError(t, err)
+	require.True(t, parsed.Local)
+	require.Nil(t, parsed.Source)
+}
+
+func TestConn_RawConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go client.Write([]byte("PROXY TCP4 1.2.3.4 5.6.7.8 1111 2222\r\nab"))
+
+	conn, err := NewConn(server, true, 0)
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3.4:1111", conn.RemoteAddr().String())
+
+	// 头部之后还有缓冲数据时不能绕过包装
+	require.Nil(t, conn.RawConn())
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "ab", string(buf))
+	require.Same(t, server, conn.RawConn())
+}
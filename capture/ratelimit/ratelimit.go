@@ -0,0 +1,387 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/auth"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// Scope 限流规则的作用范围
+type Scope string
+
+const (
+	// ScopeClient 按客户端IP限流，每个客户端IP使用独立的令牌桶和连接计数
+	ScopeClient Scope = "client"
+
+	// ScopeHost 按目标主机限流，每个主机使用独立的令牌桶和并发计数
+	ScopeHost Scope = "host"
+)
+
+// idleTimeout 令牌桶空闲超过该时间且没有占用的并发时被清理
+const idleTimeout = time.Minute
+
+// Rule 限流规则
+type Rule struct {
+	// Scope 作用范围
+	Scope Scope
+
+	// Pattern 匹配模式：client 规则为 "*"、IP地址或CIDR，host 规则为 "*"、主机名或 "*.example.com"
+	Pattern string
+
+	// Rate 每秒允许的请求数，0 表示不限制
+	Rate float64
+
+	// Burst 令牌桶容量，即允许的突发请求数，0 时取 Rate 向上取整且至少为1
+	Burst int
+
+	// Conns 最大并发数，0 表示不限制。client 规则限制客户端的并发连接，
+	// host 规则限制发往该主机的并发请求和隧道
+	Conns int
+
+	prefix netip.Prefix
+}
+
+// ParseRule 解析限流规则，格式为 scope=pattern 后跟逗号分隔的选项，例如：
+//
+//	client=*,rps=10,burst=20,conns=4
+//	client=10.0.0.0/8,rps=2
+//	host=*.example.com,rps=5,conns=2
+func ParseRule(s string) (Rule, error) {
+	parts := strings.Split(s, ",")
+	scope, pattern, ok := strings.Cut(strings.TrimSpace(parts[0]), "=")
+	pattern = strings.TrimSpace(pattern)
+	if !ok || pattern == "" {
+		return Rule{}, fmt.Errorf("invalid rate limit %q (expected client=pattern,... or host=pattern,...)", s)
+	}
+	r := Rule{Scope: Scope(strings.ToLower(strings.TrimSpace(scope))), Pattern: pattern}
+
+	for _, opt := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(opt), "=")
+		if !ok {
+			return Rule{}, fmt.Errorf("invalid rate limit option %q in %q", opt, s)
+		}
+		var err error
+		switch strings.ToLower(key) {
+		case "rps":
+			r.Rate, err = strconv.ParseFloat(value, 64)
+			if err == nil && (r.Rate < 0 || math.IsInf(r.Rate, 0) || math.IsNaN(r.Rate)) {
+				err = fmt.Errorf("must be a non-negative number")
+			}
+		case "burst":
+			r.Burst, err = strconv.Atoi(value)
+			if err == nil && r.Burst < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case "conns":
+			r.Conns, err = strconv.Atoi(value)
+			if err == nil && r.Conns < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		default:
+			return Rule{}, fmt.Errorf("unknown rate limit option %q in %q (supported: rps, burst, conns)", key, s)
+		}
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid rate limit option %q in %q: %v", opt, s, err)
+		}
+	}
+	if r.Rate == 0 && r.Conns == 0 {
+		return Rule{}, fmt.Errorf("rate limit %q sets neither rps nor conns", s)
+	}
+	if err := r.compile(); err != nil {
+		return Rule{}, err
+	}
+	return r, nil
+}
+
+// compile 校验作用范围并解析客户端网段
+func (r *Rule) compile() error {
+	switch r.Scope {
+	case ScopeClient:
+		if r.Pattern == "*" {
+			return nil
+		}
+		prefix, err := auth.ParseClient(r.Pattern)
+		if err != nil {
+			return err
+		}
+		r.prefix = prefix
+	case ScopeHost:
+		r.Pattern = strings.ToLower(r.Pattern)
+	default:
+		return fmt.Errorf("unknown rate limit scope %q (supported: client, host)", r.Scope)
+	}
+	return nil
+}
+
+// String 返回规则的文本形式，与 ParseRule 的格式一致
+func (r Rule) String() string {
+	s := string(r.Scope) + "=" + r.Pattern
+	if r.Rate > 0 {
+		s += ",rps=" + strconv.FormatFloat(r.Rate, 'f', -1, 64)
+	}
+	if r.Burst > 0 {
+		s += ",burst=" + strconv.Itoa(r.Burst)
+	}
+	if r.Conns > 0 {
+		s += ",conns=" + strconv.Itoa(r.Conns)
+	}
+	return s
+}
+
+// burst 返回令牌桶容量
+func (r *Rule) burst() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return math.Max(1, math.Ceil(r.Rate))
+}
+
+// match 判断规则是否适用于客户端IP或主机
+func (r *Rule) match(ip netip.Addr, host string) bool {
+	if r.Pattern == "*" {
+		return true
+	}
+	if r.Scope == ScopeClient {
+		return ip.IsValid() && r.prefix.Contains(ip)
+	}
+	return tlsinfo.MatchHost(r.Pattern, host)
+}
+
+// LimitError 请求或连接超出限流规则
+type LimitError struct {
+	// Rule 触发的规则
+	Rule Rule
+
+	// Key 被限流的客户端IP或主机
+	Key string
+
+	// RetryAfter 建议客户端重试前等待的时间，超出并发限制时为0
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limit exceeded for %s %s (%s), retry after %s", e.Rule.Scope, e.Key, e.Rule, e.RetryAfter.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("concurrency limit exceeded for %s %s (%s)", e.Rule.Scope, e.Key, e.Rule)
+}
+
+// bucket 一个客户端IP或主机在一条规则下的令牌桶和并发计数
+type bucket struct {
+	tokens float64
+	last   time.Time
+	active int
+}
+
+// refill 按经过的时间补充令牌
+func (b *bucket) refill(r *Rule, now time.Time) {
+	if r.Rate > 0 {
+		b.tokens = math.Min(r.burst(), b.tokens+now.Sub(b.last).Seconds()*r.Rate)
+	}
+	b.last = now
+}
+
+type bucketKey struct {
+	rule int
+	key  string
+}
+
+// Limiter 按客户端IP和目标主机的令牌桶限流器，每个作用范围使用第一条匹配的规则。
+// nil Limiter 不限制任何请求和连接
+type Limiter struct {
+	mu      sync.Mutex
+	rules   []*Rule
+	buckets map[bucketKey]*bucket
+	swept   time.Time
+
+	// now 返回当前时间，测试时替换
+	now func() time.Time
+}
+
+// New 创建没有规则的限流器
+func New() *Limiter {
+	return &Limiter{buckets: make(map[bucketKey]*bucket), now: time.Now}
+}
+
+// Add 添加规则，同一作用范围内先添加的规则优先
+func (l *Limiter) Add(r Rule) error {
+	if err := r.compile(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules = append(l.rules, &r)
+	return nil
+}
+
+// Rules 返回所有规则
+func (l *Limiter) Rules() []Rule {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rules := make([]Rule, len(l.rules))
+	for i, r := range l.rules {
+		rules[i] = *r
+	}
+	return rules
+}
+
+// AcquireConn 为客户端的新连接占用并发计数，超出 client 规则的 conns 时返回 *LimitError。
+// 成功时返回的函数用于在连接关闭时释放计数
+func (l *Limiter) AcquireConn(client net.Addr) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	ip, _ := addrIP(client)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	i, r := l.find(ScopeClient, ip, "")
+	if r == nil || r.Conns == 0 {
+		return func() {}, nil
+	}
+	key := bucketKey{i, ip.String()}
+	b := l.bucket(key, r, now)
+	if b.active >= r.Conns {
+		return nil, &LimitError{Rule: *r, Key: key.key}
+	}
+	b.active++
+	return l.releaser(key), nil
+}
+
+// Acquire 检查客户端和目标主机的请求速率以及主机的并发限制，host 为请求的主机名或 host:port。
+// 任一规则不满足时不消耗令牌并返回 *LimitError，成功时返回的函数用于在请求结束时释放主机并发计数
+func (l *Limiter) Acquire(client net.Addr, host string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	ip, _ := addrIP(client)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	type hit struct {
+		key    bucketKey
+		rule   *Rule
+		bucket *bucket
+	}
+	var hits []hit
+	if i, r := l.find(ScopeClient, ip, ""); r != nil {
+		key := bucketKey{i, ip.String()}
+		hits = append(hits, hit{key, r, l.bucket(key, r, now)})
+	}
+	if i, r := l.find(ScopeHost, ip, host); r != nil {
+		key := bucketKey{i, host}
+		hits = append(hits, hit{key, r, l.bucket(key, r, now)})
+	}
+
+	// 先检查所有规则，全部满足后再消耗令牌
+	for _, h := range hits {
+		if h.rule.Rate > 0 && h.bucket.tokens < 1 {
+			wait := time.Duration((1 - h.bucket.tokens) / h.rule.Rate * float64(time.Second))
+			return nil, &LimitError{Rule: *h.rule, Key: h.key.key, RetryAfter: wait}
+		}
+		if h.rule.Scope == ScopeHost && h.rule.Conns > 0 && h.bucket.active >= h.rule.Conns {
+			return nil, &LimitError{Rule: *h.rule, Key: h.key.key}
+		}
+	}
+
+	release := func() {}
+	for _, h := range hits {
+		if h.rule.Rate > 0 {
+			h.bucket.tokens--
+		}
+		if h.rule.Scope == ScopeHost && h.rule.Conns > 0 {
+			h.bucket.active++
+			release = l.releaser(h.key)
+		}
+	}
+	return release, nil
+}
+
+// find 返回作用范围内第一条匹配的规则及其下标
+func (l *Limiter) find(scope Scope, ip netip.Addr, host string) (int, *Rule) {
+	for i, r := range l.rules {
+		if r.Scope == scope && r.match(ip, host) {
+			return i, r
+		}
+	}
+	return -1, nil
+}
+
+// bucket 返回补充令牌后的令牌桶，不存在时创建满的令牌桶
+func (l *Limiter) bucket(key bucketKey, r *Rule, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: r.burst(), last: now}
+		l.buckets[key] = b
+	}
+	b.refill(r, now)
+	return b
+}
+
+// releaser 返回只生效一次的释放并发计数的函数
+func (l *Limiter) releaser(key bucketKey) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if b, ok := l.buckets[key]; ok && b.active > 0 {
+				b.active--
+			}
+		})
+	}
+}
+
+// sweep 每隔 idleTimeout 清理空闲的令牌桶，空闲超过该时间的令牌桶已经补满
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < idleTimeout {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if b.active == 0 && now.Sub(b.last) >= idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// addrIP 返回网络地址中的IP，IPv4映射的IPv6地址转换为IPv4
+func addrIP(addr net.Addr) (netip.Addr, bool) {
+	if addr == nil {
+		return netip.Addr{}, false
+	}
+	if ap, err := netip.ParseAddrPort(addr.String()); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	ip, err := netip.ParseAddr(addr.String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
@@ -0,0 +1,217 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newLimiter(t *testing.T, rules ...string) (*Limiter, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	l := New()
+	l.now = clock.now
+	for _, s := range rules {
+		r, err := ParseRule(s)
+		require.NoError(t, err)
+		require.NoError(t, l.Add(r))
+	}
+	return l, clock
+}
+
+func addr(s string) net.Addr {
+	ap, err := net.ResolveTCPAddr("tcp", s)
+	if err != nil {
+		panic(err)
+	}
+	return ap
+}
+
+// --- 测试代码 ---
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("client=10.0.0.0/8, rps=2.5, burst=5, conns=3")
+	require.NoError(t, err)
+	require.Equal(t, ScopeClient, r.Scope)
+	require.Equal(t, 2.5, r.Rate)
+	require.Equal(t, 5, r.Burst)
+	require.Equal(t, 3, r.Conns)
+	require.Equal(t, "client=10.0.0.0/8,rps=2.5,burst=5,conns=3", r.String())
+
+	r, err = ParseRule("HOST=API.Example.com,conns=1")
+	require.NoError(t, err)
+	require.Equal(t, "host=api.example.com,conns=1", r.String())
+
+	for _, s := range []string{
+		"",
+		"client",
+		"client=*",
+		"user=*,rps=1",
+		"client=10.0.0.0/33,rps=1",
+		"client=localhost,rps=1",
+		"host=*,rps=-1",
+		"host=*,rps=fast",
+		"host=*,conns=-2",
+		"host=*,rps",
+		"host=*,delay=1s",
+	} {
+		_, err := ParseRule(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	var l *Limiter
+	release, err := l.Acquire(addr("192.0.2.1:1234"), "example.com:443")
+	require.NoError(t, err)
+	release()
+	release, err = l.AcquireConn(addr("192.0.2.1:1234"))
+	require.NoError(t, err)
+	release()
+	require.Nil(t, l.Rules())
+}
+
+func TestLimiter_ClientRate(t *testing.T) {
+	l, clock := newLimiter(t, "client=*,rps=2,burst=3")
+	alice, bob := addr("192.0.2.1:1000"), addr("192.0.2.2:1000")
+
+	for range 3 {
+		_, err := l.Acquire(alice, "example.com")
+		require.NoError(t, err)
+	}
+	_, err := l.Acquire(alice, "example.com")
+	var limitErr *LimitError
+	require.ErrorAs(t, err, &limitErr)
+	require.Equal(t, "192.0.2.1", limitErr.Key)
+	require.Equal(t, 500*time.Millisecond, limitErr.RetryAfter)
+
+	// 每个客户端使用独立的令牌桶
+	_, err = l.Acquire(bob, "example.com")
+	require.NoError(t, err)
+
+	clock.advance(500 * time.Millisecond)
+	_, err = l.Acquire(alice, "example.com")
+	require.NoError(t, err)
+	_, err = l.Acquire(alice, "example.com")
+	require.Error(t, err)
+}
+
+func TestLimiter_FirstMatchingRule(t *testing.T) {
+	l, _ := newLimiter(t, "client=127.0.0.1,rps=100", "client=*,rps=1")
+
+	for range 10 {
+		_, err := l.Acquire(addr("127.0.0.1:1"), "example.com")
+		require.NoError(t, err)
+	}
+	_, err := l.Acquire(addr("[::ffff:192.0.2.1]:1"), "example.com")
+	require.NoError(t, err)
+	_, err = l.Acquire(addr("192.0.2.1:2"), "example.com")
+	require.Error(t, err)
+}
+
+func TestLimiter_HostRateAndConns(t *testing.T) {
+	l, clock := newLimiter(t, "host=*.example.com,rps=1,burst=2,conns=1", "client=*,rps=10")
+	client := addr("192.0.2.1:1000")
+
+	release, err := l.Acquire(client, "api.example.com:443")
+	require.NoError(t, err)
+
+	// 并发已满
+	_, err = l.Acquire(client, "API.example.com")
+	var limitErr *LimitError
+	require.ErrorAs(t, err, &limitErr)
+	require.Zero(t, limitErr.RetryAfter)
+	require.Equal(t, "api.example.com", limitErr.Key)
+
+	// 其他主机不受该规则限制
+	_, err = l.Acquire(client, "example.org")
+	require.NoError(t, err)
+
+	release()
+	release()
+	release, err = l.Acquire(client, "api.example.com")
+	require.NoError(t, err)
+	release()
+
+	// 令牌已用完
+	_, err = l.Acquire(client, "api.example.com")
+	require.ErrorAs(t, err, &limitErr)
+	require.Equal(t, time.Second, limitErr.RetryAfter)
+
+	// 被主机规则拒绝的请求不消耗客户端的令牌
+	for range 20 {
+		_, err = l.Acquire(client, "api.example.com")
+		require.Error(t, err)
+	}
+	for range 7 {
+		_, err = l.Acquire(client, "example.org")
+		require.NoError(t, err)
+	}
+
+	clock.advance(time.Second)
+	_, err = l.Acquire(client, "api.example.com")
+	require.NoError(t, err)
+}
+
+func TestLimiter_ClientConns(t *testing.T) {
+	l, clock := newLimiter(t, "client=192.0.2.0/24,conns=2")
+	client := addr("192.0.2.1:1000")
+
+	r1, err := l.AcquireConn(client)
+	require.NoError(t, err)
+	_, err = l.AcquireConn(addr("192.0.2.1:1001"))
+	require.NoError(t, err)
+	_, err = l.AcquireConn(addr("192.0.2.1:1002"))
+	require.Error(t, err)
+
+	// 不匹配的客户端不受限制
+	for range 5 {
+		_, err = l.AcquireConn(addr("198.51.100.1:1000"))
+		require.NoError(t, err)
+	}
+
+	// 占用并发的令牌桶不会被清理
+	clock.advance(2 * idleTimeout)
+	_, err = l.AcquireConn(client)
+	require.Error(t, err)
+
+	r1()
+	_, err = l.AcquireConn(client)
+	require.NoError(t, err)
+}
+
+func TestLimiter_SweepIdle(t *testing.T) {
+	l, clock := newLimiter(t, "client=*,rps=1")
+	for i := range 100 {
+		_, err := l.Acquire(&net.TCPAddr{IP: net.IPv4(10, 0, 0, byte(i)), Port: 1}, "example.com")
+		require.NoError(t, err)
+	}
+	require.Len(t, l.buckets, 100)
+
+	clock.advance(idleTimeout)
+	_, err := l.Acquire(addr("192.0.2.1:1"), "example.com")
+	require.NoError(t, err)
+	require.Len(t, l.buckets, 1)
+}
@@ -0,0 +1,382 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package redact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Mask 替换敏感内容的文本
+const Mask = "[REDACTED]"
+
+// Kind 规则类型
+type Kind string
+
+const (
+	// KindHeader 按名称处理请求和响应头部，不区分大小写
+	KindHeader Kind = "header"
+
+	// KindField 按点分路径处理JSON内容中的字段，"*" 匹配任意键或数组元素
+	KindField Kind = "field"
+
+	// KindPattern 处理URL、头部值和内容中匹配内置模式的文本，见 Patterns
+	KindPattern Kind = "pattern"
+
+	// KindRegex 处理URL、头部值和内容中匹配正则表达式的文本
+	KindRegex Kind = "regex"
+)
+
+// Action 敏感内容的处理方式
+type Action string
+
+const (
+	// ActionMask 替换为 Mask
+	ActionMask Action = "mask"
+
+	// ActionRemove 删除头部或JSON字段，文本模式按 ActionMask 处理
+	ActionRemove Action = "remove"
+
+	// ActionHash 替换为 "sha256:" 加内容哈希的前16个十六进制字符，相同的值得到相同的结果，便于关联
+	ActionHash Action = "hash"
+)
+
+// Patterns 内置的文本模式
+var Patterns = map[string]*regexp.Regexp{
+	"credit-card": regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+	"email":       regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+}
+
+// DefaultRules 常见的认证头部
+var DefaultRules = []string{
+	"header:Authorization",
+	"header:Proxy-Authorization",
+	"header:Cookie",
+	"header:Set-Cookie",
+}
+
+// Rule 脱敏规则
+type Rule struct {
+	// Kind 规则类型
+	Kind Kind `json:"kind"`
+
+	// Target 头部名称、字段路径、内置模式名称或正则表达式
+	Target string `json:"target"`
+
+	// Action 处理方式
+	Action Action `json:"action"`
+
+	path []string
+	re   *regexp.Regexp
+	luhn bool
+}
+
+// ParseRule 解析命令行格式 kind[/action]:target，action 默认为 mask，例如：
+//
+//	header:Authorization
+//	header/hash:Cookie
+//	field/remove:user.password
+//	field:items.*.token
+//	pattern:credit-card
+//	regex/hash:\d{3}-\d{2}-\d{4}
+func ParseRule(s string) (*Rule, error) {
+	spec, target, ok := strings.Cut(s, ":")
+	if !ok || target == "" {
+		return nil, fmt.Errorf("invalid redaction rule %q (expected kind[/action]:target)", s)
+	}
+	kind, action, _ := strings.Cut(spec, "/")
+	r := &Rule{Kind: Kind(strings.ToLower(kind)), Target: target, Action: Action(strings.ToLower(action))}
+	if r.Action == "" {
+		r.Action = ActionMask
+	}
+	switch r.Action {
+	case ActionMask, ActionRemove, ActionHash:
+	default:
+		return nil, fmt.Errorf("unknown redaction action %q in %q (supported: mask, remove, hash)", action, s)
+	}
+
+	switch r.Kind {
+	case KindHeader:
+		r.Target = http.CanonicalHeaderKey(target)
+	case KindField:
+		r.path = strings.Split(target, ".")
+	case KindPattern:
+		if r.re = Patterns[target]; r.re == nil {
+			return nil, fmt.Errorf("unknown redaction pattern %q in %q (supported: credit-card, email)", target, s)
+		}
+		r.luhn = target == "credit-card"
+	case KindRegex:
+		re, err := regexp.Compile(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction rule %q: %w", s, err)
+		}
+		r.re = re
+	default:
+		return nil, fmt.Errorf("unknown redaction kind %q in %q (supported: header, field, pattern, regex)", kind, s)
+	}
+	return r, nil
+}
+
+// String 返回 ParseRule 可解析的格式
+func (r *Rule) String() string {
+	return string(r.Kind) + "/" + string(r.Action) + ":" + r.Target
+}
+
+// replace 返回替换 value 的文本
+func (r *Rule) replace(value string) string {
+	if r.Action == ActionHash {
+		return Hash(value)
+	}
+	return Mask
+}
+
+// Hash 返回 hash 处理方式替换 value 的文本
+func Hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// replaceAll 替换 s 中匹配模式的文本，escape 不为nil时对替换文本转义
+func (r *Rule) replaceAll(s string, escape func(string) string) string {
+	return r.re.ReplaceAllStringFunc(s, func(m string) string {
+		if r.luhn && !validLuhn(m) {
+			return m
+		}
+		out := r.replace(m)
+		if escape != nil {
+			out = escape(out)
+		}
+		return out
+	})
+}
+
+// Redactor 在流保存和导出前按规则处理敏感内容，可安全地并发使用。
+// 内容规则要求解码内容，处理后的内容以解码后的形式保存并移除 Content-Encoding；
+// 无法解码的内容被丢弃。超过捕获限制的内容只处理内存中的部分，完整内容的临时文件被删除
+type Redactor struct {
+	headers []*Rule
+	fields  []*Rule
+	texts   []*Rule
+}
+
+// New 创建使用 rules 的脱敏器
+func New(rules ...*Rule) *Redactor {
+	r := &Redactor{}
+	for _, rule := range rules {
+		switch rule.Kind {
+		case KindHeader:
+			r.headers = append(r.headers, rule)
+		case KindField:
+			r.fields = append(r.fields, rule)
+		default:
+			r.texts = append(r.texts, rule)
+		}
+	}
+	return r
+}
+
+// Apply 处理流中的敏感内容。为nil时不做任何处理
+func (r *Redactor) Apply(f *flow.Flow) {
+	if r == nil {
+		return
+	}
+	if req := f.Request; req != nil {
+		r.redactHeader(req.Header)
+		for _, rule := range r.texts {
+			req.URL = rule.replaceAll(req.URL, url.QueryEscape)
+		}
+		req.Body, req.BodySize = r.redactBody(req.Header, req.Body, req.BodySize, &req.BodyFile)
+	}
+	if resp := f.Response; resp != nil {
+		r.redactHeader(resp.Header)
+		resp.Body, resp.BodySize = r.redactBody(resp.Header, resp.Body, resp.BodySize, &resp.BodyFile)
+	}
+}
+
+// ApplyEvent 处理流保存前发布的事件中的头部和URL，与 Apply 对流的处理相同。为nil时不做任何处理
+func (r *Redactor) ApplyEvent(e *flow.Event) {
+	if r == nil {
+		return
+	}
+	if e.Header != nil {
+		r.redactHeader(e.Header)
+	}
+	for _, rule := range r.texts {
+		e.URL = rule.replaceAll(e.URL, url.QueryEscape)
+	}
+}
+
+// redactHeader 处理头部规则指定的头部，以及所有头部值中匹配文本规则的内容
+func (r *Redactor) redactHeader(h http.Header) {
+	for _, rule := range r.headers {
+		values, ok := h[rule.Target]
+		if !ok {
+			continue
+		}
+		if rule.Action == ActionRemove {
+			delete(h, rule.Target)
+			continue
+		}
+		for i, v := range values {
+			values[i] = rule.replace(v)
+		}
+	}
+	for _, rule := range r.texts {
+		for _, values := range h {
+			for i, v := range values {
+				values[i] = rule.replaceAll(v, nil)
+			}
+		}
+	}
+}
+
+// redactBody 处理内容，返回新的内容和截断时的完整长度
+func (r *Redactor) redactBody(h http.Header, body []byte, size int64, file *string) ([]byte, int64) {
+	if len(r.fields) == 0 && len(r.texts) == 0 {
+		return body, size
+	}
+	if *file != "" {
+		os.Remove(*file)
+		*file = ""
+	}
+	if len(body) == 0 {
+		return body, size
+	}
+	full := max(size, int64(len(body)))
+	decoded, encoded, err := flow.DecodeBody(h, body)
+	if err != nil {
+		return nil, full
+	}
+	if encoded {
+		h.Del("Content-Encoding")
+		body = decoded
+	} else {
+		body = bytes.Clone(body)
+	}
+
+	if len(r.fields) > 0 {
+		body = r.redactFields(body)
+	}
+	for _, rule := range r.texts {
+		body = []byte(rule.replaceAll(string(body), nil))
+	}
+	if size == 0 && h.Get("Content-Length") != "" {
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	if size > 0 {
+		// 截断的内容保留原始的完整长度
+		return body, max(size, int64(len(body))+1)
+	}
+	return body, 0
+}
+
+// redactFields 处理JSON内容中的字段，不是JSON的内容保持不变
+func (r *Redactor) redactFields(body []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return body
+	}
+	changed := false
+	for _, rule := range r.fields {
+		var hit bool
+		v, hit = redactPath(v, rule.path, rule)
+		changed = changed || hit
+	}
+	if !changed {
+		return body
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// redactPath 处理 v 中 path 指向的值，返回处理后的值以及是否有字段被处理
+func redactPath(v any, path []string, rule *Rule) (any, bool) {
+	if len(path) == 0 {
+		return rule.replace(scalarString(v)), true
+	}
+	key, rest := path[0], path[1:]
+	hit := false
+	switch node := v.(type) {
+	case map[string]any:
+		for k, child := range node {
+			if key != "*" && key != k {
+				continue
+			}
+			if len(rest) == 0 && rule.Action == ActionRemove {
+				delete(node, k)
+				hit = true
+				continue
+			}
+			var h bool
+			node[k], h = redactPath(child, rest, rule)
+			hit = hit || h
+		}
+	case []any:
+		for i, child := range node {
+			if key != "*" && key != strconv.Itoa(i) {
+				continue
+			}
+			if len(rest) == 0 && rule.Action == ActionRemove {
+				node[i] = nil
+				hit = true
+				continue
+			}
+			var h bool
+			node[i], h = redactPath(child, rest, rule)
+			hit = hit || h
+		}
+	}
+	return v, hit
+}
+
+// scalarString 返回用于计算哈希的值的文本形式
+func scalarString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// validLuhn 判断数字串是否通过Luhn校验，用于减少卡号模式的误报
+func validLuhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
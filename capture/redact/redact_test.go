@@ -0,0 +1,155 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package redact
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+func newRedactor(t *testing.T, specs ...string) *Redactor {
+	t.Helper()
+	var rules []*Rule
+	for _, s := range specs {
+		r, err := ParseRule(s)
+		require.NoError(t, err)
+		rules = append(rules, r)
+	}
+	return New(rules...)
+}
+
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.Bytes()
+}
+
+// --- 测试代码 ---
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("header/hash:set-cookie")
+	require.NoError(t, err)
+	require.Equal(t, &Rule{Kind: KindHeader, Target: "Set-Cookie", Action: ActionHash}, r)
+	require.Equal(t, "header/hash:Set-Cookie", r.String())
+
+	r, err = ParseRule(`regex:\d+:\d+`)
+	require.NoError(t, err)
+	require.Equal(t, `\d+:\d+`, r.Target)
+	require.Equal(t, ActionMask, r.Action)
+
+	for _, s := range []string{"header", "header:", "cookie:a", "header/drop:a", "pattern:ssn", "regex:("} {
+		_, err := ParseRule(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestRedactor_Headers(t *testing.T) {
+	r := newRedactor(t, "header:Authorization", "header/remove:Cookie", "header/hash:Set-Cookie", "pattern:email")
+	f := &flow.Flow{
+		Request: &flow.Request{URL: "https://a.test/?to=bob@example.com", Header: http.Header{
+			"Authorization": {"Bearer secret"},
+			"Cookie":        {"sid=1"},
+			"From":          {"alice@example.com"},
+		}},
+		Response: &flow.Response{Header: http.Header{"Set-Cookie": {"sid=1", "sid=1"}}},
+	}
+	r.Apply(f)
+
+	require.Equal(t, http.Header{"Authorization": {Mask}, "From": {Mask}}, f.Request.Header)
+	require.Equal(t, "https://a.test/?to=%5BREDACTED%5D", f.Request.URL)
+	hash := f.Response.Header["Set-Cookie"]
+	require.Regexp(t, `^sha256:[0-9a-f]{16}$`, hash[0])
+	require.Equal(t, hash[0], hash[1])
+}
+
+func TestRedactor_ApplyEvent(t *testing.T) {
+	r := newRedactor(t, "header:Authorization", "header/remove:Cookie", "header/remove:Set-Cookie", "pattern:email")
+	bus := flow.NewBus()
+	bus.SetRedactor(r.ApplyEvent)
+	events, cancel := bus.Subscribe(4, nil)
+	defer cancel()
+
+	f := flow.New()
+	f.Request = &flow.Request{Method: "GET", URL: "https://a.test/?to=bob@example.com", Header: http.Header{
+		"Authorization": {"Bearer secret"},
+		"Cookie":        {"sid=1"},
+	}}
+	bus.Started(f)
+	f.Response = &flow.Response{StatusCode: 200, Header: http.Header{"Set-Cookie": {"sid=2"}, "X-Id": {"1"}}}
+	bus.ResponseHeaders(f)
+
+	// 流保存前发布的事件中的头部和URL已经脱敏
+	e := <-events
+	require.Equal(t, flow.EventRequestStarted, e.Type)
+	require.Equal(t, http.Header{"Authorization": {Mask}}, e.Header)
+	require.Equal(t, "https://a.test/?to=%5BREDACTED%5D", e.URL)
+	e = <-events
+	require.Equal(t, flow.EventResponseHeaders, e.Type)
+	require.Equal(t, http.Header{"X-Id": {"1"}}, e.Header)
+
+	// 流本身在保存时才脱敏
+	require.Equal(t, "Bearer secret", f.Request.Header.Get("Authorization"))
+	require.Equal(t, "sid=2", f.Response.Header.Get("Set-Cookie"))
+}
+
+func TestRedactor_Body(t *testing.T) {
+	r := newRedactor(t, "field/remove:password", "field/hash:cards.*.number", "field:missing.path", "pattern:credit-card")
+	body := `{"user":"a","password":"p","cards":[{"number":"4111 1111 1111 1111"}],"note":"card 4111-1111-1111-1111, order 1234567890123"}`
+	f := &flow.Flow{
+		Request: &flow.Request{Header: http.Header{
+			"Content-Encoding": {"gzip"},
+			"Content-Length":   {"999"},
+		}, Body: gzipped(body)},
+	}
+	r.Apply(f)
+
+	// 解码后处理，非卡号的数字串保持不变
+	require.Empty(t, f.Request.Header.Get("Content-Encoding"))
+	hash := (&Rule{Action: ActionHash}).replace("4111 1111 1111 1111")
+	require.JSONEq(t, `{"user":"a","cards":[{"number":"`+hash+`"}],"note":"card [REDACTED], order 1234567890123"}`,
+		string(f.Request.Body))
+	require.Equal(t, strconv.Itoa(len(f.Request.Body)), f.Request.Header.Get("Content-Length"))
+}
+
+func TestRedactor_TruncatedBody(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "body")
+	require.NoError(t, os.WriteFile(file, []byte("mail bob@example.com and more"), 0o600))
+	f := &flow.Flow{
+		Request:  &flow.Request{Header: http.Header{}, Body: []byte("mail bob@example.com"), BodySize: 29, BodyFile: file},
+		Response: &flow.Response{Header: http.Header{"Content-Encoding": {"br"}}, Body: []byte("??")},
+	}
+	newRedactor(t, "pattern:email").Apply(f)
+
+	// 完整内容的临时文件被删除，无法解码的内容被丢弃
+	require.Equal(t, "mail [REDACTED]", string(f.Request.Body))
+	require.True(t, f.Request.Truncated())
+	require.Empty(t, f.Request.BodyFile)
+	require.NoFileExists(t, file)
+	require.Nil(t, f.Response.Body)
+	require.Equal(t, int64(2), f.Response.BodyLen())
+}
+
+func TestRedactor_Nil(t *testing.T) {
+	var r *Redactor
+	f := &flow.Flow{Request: &flow.Request{Header: http.Header{"Authorization": {"x"}}}}
+	r.Apply(f)
+	require.Equal(t, "x", f.Request.Header.Get("Authorization"))
+	newRedactor(t, DefaultRules...).Apply(f)
+	require.Equal(t, Mask, f.Request.Header.Get("Authorization"))
+}
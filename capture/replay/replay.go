@@ -0,0 +1,207 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// skipHeaders 重放时不复制的请求头部，由传输层重新生成
+var skipHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Content-Length",
+	"Transfer-Encoding",
+	"Te",
+	"Trailer",
+	"Upgrade",
+}
+
+// Options 重放时对原始请求的修改，零值表示原样重放
+type Options struct {
+	// Method 替换请求方法
+	Method string `json:"method,omitempty"`
+
+	// URL 替换请求URL（完整URL），用于把请求发往其他目标
+	URL string `json:"url,omitempty"`
+
+	// Header 设置的请求头部，覆盖同名的原始头部
+	Header http.Header `json:"header,omitempty"`
+
+	// RemoveHeaders 删除的请求头部
+	RemoveHeaders []string `json:"remove_headers,omitempty"`
+
+	// Body 替换请求体，为nil时使用原始请求体
+	Body []byte `json:"body,omitempty"`
+
+	// ClientCert 上游要求双向TLS时出示的客户端证书，为 dialer.RegisterCertificate 返回的标识，
+	// 为空时使用按主机配置的证书
+	ClientCert string `json:"client_cert,omitempty"`
+}
+
+// Result 重放结果
+type Result struct {
+	// FlowID 代理为重放请求记录的新流ID
+	FlowID string `json:"flow_id"`
+
+	// Response 重放得到的响应
+	Response *flow.Response `json:"response"`
+}
+
+// Replayer 将捕获的流经由代理重新发送，新请求会经过规则、断点等完整处理流程，
+// 并记录为关联到原始流的新流
+type Replayer struct {
+	client   *http.Client
+	proxyURL *url.URL
+}
+
+// New 创建重放器，proxyAddr 为代理监听地址，roots 为信任的CA（通常是MITM CA），
+// 为nil时使用系统根证书
+func New(proxyAddr string, roots *x509.CertPool) (*Replayer, error) {
+	proxyURL, err := url.Parse("http://" + proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy address %q: %w", proxyAddr, err)
+	}
+	r := &Replayer{proxyURL: proxyURL}
+	r.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy: func(*http.Request) (*url.URL, error) {
+				return r.proxyURL, nil
+			},
+			TLSClientConfig:    &tls.Config{RootCAs: roots},
+			DisableCompression: true,
+			IdleConnTimeout:    30 * time.Second,
+		},
+		// 不跟随重定向，每次重放只对应一个流
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return r, nil
+}
+
+// SetProxyAuth 设置连接代理时使用的Basic认证，代理要求认证时在重放前调用
+func (r *Replayer) SetProxyAuth(user, password string) {
+	r.proxyURL.User = url.UserPassword(user, password)
+}
+
+// Replay 重放流的请求，opts 为nil时原样重放
+func (r *Replayer) Replay(ctx context.Context, f *flow.Flow, opts *Options) (*Result, error) {
+	if f == nil || f.Request == nil {
+		return nil, errors.New("flow has no request")
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	req, err := newRequest(ctx, f, opts)
+	if err != nil {
+		return nil, err
+	}
+	id := flow.NewID()
+	req.Header.Set(flow.ReplayHeader, cmp.Or(f.ID, "-")+" "+id)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		if f.ID == "" {
+			return nil, fmt.Errorf("send request: %w", err)
+		}
+		return nil, fmt.Errorf("replay flow %s: %w", f.ID, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read replay response: %w", err)
+	}
+	return &Result{
+		FlowID: id,
+		Response: &flow.Response{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Proto:      resp.Proto,
+			Header:     resp.Header,
+			Body:       body,
+		},
+	}, nil
+}
+
+// Send 经由代理发送新的请求，例如由 curl 命令解析的请求，记录的流不关联任何原始流
+func (r *Replayer) Send(ctx context.Context, req *flow.Request) (*Result, error) {
+	return r.Replay(ctx, &flow.Flow{Request: req}, nil)
+}
+
+// newRequest 根据原始流和修改选项构造请求
+func newRequest(ctx context.Context, f *flow.Flow, opts *Options) (*http.Request, error) {
+	method := f.Request.Method
+	if opts.Method != "" {
+		method = opts.Method
+	}
+	target := f.Request.URL
+	if opts.URL != "" {
+		target = opts.URL
+	}
+	body := f.Request.Body
+	if opts.Body != nil {
+		body = opts.Body
+	} else if f.Request.Truncated() && f.Request.BodyFile == "" {
+		return nil, errors.New("request body exceeded the capture limit, cannot replay")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build replay request: %w", err)
+	}
+	if u := req.URL; u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("cannot replay %s request %s", u.Scheme, target)
+	}
+	if opts.Body == nil && f.Request.BodyFile != "" {
+		// 超过捕获限制的请求体从临时文件读取
+		file, err := f.Request.OpenBody()
+		if err != nil {
+			return nil, fmt.Errorf("open request body: %w", err)
+		}
+		req.Body, req.ContentLength, req.GetBody = file, f.Request.BodyLen(), nil
+	}
+
+	req.Header = f.Request.Header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	for _, h := range skipHeaders {
+		req.Header.Del(h)
+	}
+	req.Header.Del(flow.ReplayHeader)
+	req.Header.Del(flow.ClientCertHeader)
+	if opts.ClientCert != "" {
+		req.Header.Set(flow.ClientCertHeader, opts.ClientCert)
+	}
+	for name, values := range opts.Header {
+		req.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+	}
+	for _, name := range opts.RemoveHeaders {
+		req.Header.Del(name)
+	}
+
+	// 未修改目标时保留原始Host头部，例如经过 map-remote 的请求
+	if opts.URL == "" && f.Request.Host != "" {
+		req.Host = f.Request.Host
+	}
+	return req, nil
+}
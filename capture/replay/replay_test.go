@@ -0,0 +1,133 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// received 代理收到的请求
+type received struct {
+	method string
+	url    string
+	host   string
+	header http.Header
+	body   string
+}
+
+// newProxy 创建记录请求的假代理，直接返回固定响应
+func newProxy(t *testing.T) (*httptest.Server, chan received) {
+	ch := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ch <- received{r.Method, r.URL.String(), r.Host, r.Header.Clone(), string(body)}
+		w.Header().Set("X-Replayed", "1")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func capturedFlow() *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{
+		Method: "POST",
+		URL:    "http://api.example.com/users?x=1",
+		Host:   "api.example.com",
+		Header: http.Header{
+			"Content-Type":     {"application/json"},
+			"Content-Length":   {"10"},
+			"Proxy-Connection": {"keep-alive"},
+			"Authorization":    {"Bearer old"},
+		},
+		Body: []byte(`{"id": 1}`),
+	}
+	return f
+}
+
+// --- 测试代码 ---
+func TestReplay_Unchanged(t *testing.T) {
+	proxy, ch := newProxy(t)
+	r, err := New(strings.TrimPrefix(proxy.URL, "http://"), nil)
+	require.NoError(t, err)
+
+	f := capturedFlow()
+	result, err := r.Replay(context.Background(), f, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, result.Response.StatusCode)
+	require.Equal(t, "ok", string(result.Response.Body))
+	require.NotEmpty(t, result.FlowID)
+
+	got := <-ch
+	require.Equal(t, "POST", got.method)
+	require.Equal(t, "http://api.example.com/users?x=1", got.url)
+	require.Equal(t, "api.example.com", got.host)
+	require.Equal(t, `{"id": 1}`, got.body)
+	require.Equal(t, "Bearer old", got.header.Get("Authorization"))
+	require.Empty(t, got.header.Get("Proxy-Connection"))
+	require.Equal(t, f.ID+" "+result.FlowID, got.header.Get(flow.ReplayHeader))
+}
+
+func TestReplay_WithOptions(t *testing.T) {
+	proxy, ch := newProxy(t)
+	r, err := New(strings.TrimPrefix(proxy.URL, "http://"), nil)
+	require.NoError(t, err)
+
+	_, err = r.Replay(context.Background(), capturedFlow(), &Options{
+		Method:        "PUT",
+		URL:           "http://staging.example.com/users",
+		Header:        http.Header{"authorization": {"Bearer new"}},
+		RemoveHeaders: []string{"Content-Type"},
+		Body:          []byte("changed"),
+	})
+	require.NoError(t, err)
+
+	got := <-ch
+	require.Equal(t, "PUT", got.method)
+	require.Equal(t, "http://staging.example.com/users", got.url)
+	require.Equal(t, "staging.example.com", got.host)
+	require.Equal(t, "changed", got.body)
+	require.Equal(t, "Bearer new", got.header.Get("Authorization"))
+	require.Empty(t, got.header.Get("Content-Type"))
+}
+
+func TestSend(t *testing.T) {
+	proxy, ch := newProxy(t)
+	r, err := New(strings.TrimPrefix(proxy.URL, "http://"), nil)
+	require.NoError(t, err)
+
+	result, err := r.Send(context.Background(), capturedFlow().Request)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, result.Response.StatusCode)
+
+	// 新请求不关联原始流
+	got := <-ch
+	require.Equal(t, "- "+result.FlowID, got.header.Get(flow.ReplayHeader))
+}
+
+func TestReplay_Invalid(t *testing.T) {
+	r, err := New("127.0.0.1:1", nil)
+	require.NoError(t, err)
+
+	_, err = r.Replay(context.Background(), flow.New(), nil)
+	require.Error(t, err)
+
+	f := capturedFlow()
+	f.Request.URL = "tcp://api.example.com:443"
+	_, err = r.Replay(context.Background(), f, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,200 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package rules
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// BodyRule 对请求/响应体做正则或字面量替换，替换文本可以是Go模板
+type BodyRule struct {
+	// Phase 改写请求还是响应
+	Phase breakpoint.Phase `json:"phase"`
+
+	// Match 请求匹配规则
+	Match flow.Matcher `json:"match"`
+
+	// Find 查找的正则表达式，Literal 为true时按字面量查找
+	Find string `json:"find"`
+
+	// Replace 替换文本，正则模式下支持 $1，包含 "{{" 时按Go模板展开
+	Replace string `json:"replace"`
+
+	// Literal 是否按字面量查找和替换
+	Literal bool `json:"literal,omitempty"`
+
+	pattern  *regexp.Regexp
+	template *template.Template
+}
+
+// NewBodyRule 创建内容改写规则
+func NewBodyRule(phase breakpoint.Phase, match flow.Matcher, find, replace string, literal, ignoreCase bool) (*BodyRule, error) {
+	r := &BodyRule{Phase: phase, Match: match, Find: find, Replace: replace, Literal: literal}
+
+	expr := find
+	if literal {
+		expr = regexp.QuoteMeta(find)
+	}
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	var err error
+	if r.pattern, err = regexp.Compile(expr); err != nil {
+		return nil, fmt.Errorf("invalid body rule pattern %q: %w", find, err)
+	}
+	if isTemplate(replace) {
+		if r.template, err = parseTemplate("body", replace); err != nil {
+			return nil, fmt.Errorf("invalid body rule template %q: %w", replace, err)
+		}
+	}
+	return r, nil
+}
+
+// ParseBodyRule 解析命令行格式 "phase match s/find/replace/[flags]"，
+// 分隔符为 s 之后的字符，flags 中 l 表示字面量替换，i 表示忽略大小写，例如
+// "response api.example.com s|\"debug\":false|\"debug\":true|l"
+func ParseBodyRule(s string) (*BodyRule, error) {
+	fields := strings.SplitN(strings.TrimSpace(s), " ", 3)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("invalid body rule %q (expected phase match s/find/replace/[flags])", s)
+	}
+	phase, err := breakpoint.ParsePhase(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	find, replace, flags, err := parseSubstitution(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid body rule %q: %w", s, err)
+	}
+	var literal, ignoreCase bool
+	for _, c := range flags {
+		switch c {
+		case 'l':
+			literal = true
+		case 'i':
+			ignoreCase = true
+		default:
+			return nil, fmt.Errorf("invalid body rule %q: unknown flag %q", s, c)
+		}
+	}
+	return NewBodyRule(phase, flow.ParseMatcher(fields[1]), find, replace, literal, ignoreCase)
+}
+
+// parseSubstitution 解析 sed 风格的 s/find/replace/flags，分隔符可用反斜杠转义
+func parseSubstitution(s string) (find, replace, flags string, err error) {
+	if len(s) < 2 || s[0] != 's' {
+		return "", "", "", fmt.Errorf("substitution must start with s and a delimiter")
+	}
+	delim := s[1]
+	var parts []string
+	var cur strings.Builder
+	for i := 2; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == delim:
+			cur.WriteByte(delim)
+			i++
+		case s[i] == delim && len(parts) < 2:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	if len(parts) != 2 {
+		return "", "", "", fmt.Errorf("substitution must have the form s%cfind%creplace%c", delim, delim, delim)
+	}
+	if parts[0] == "" {
+		return "", "", "", fmt.Errorf("empty search pattern")
+	}
+	return parts[0], parts[1], cur.String(), nil
+}
+
+// RewriteRequest 实现 RequestRewriter 接口
+func (r *BodyRule) RewriteRequest(f *flow.Flow) bool {
+	if r.Phase != breakpoint.PhaseRequest || !r.Match.Match(f) {
+		return false
+	}
+	return r.rewrite(f, &f.Request.Header, &f.Request.Body)
+}
+
+// RewriteResponse 实现 ResponseRewriter 接口
+func (r *BodyRule) RewriteResponse(f *flow.Flow) bool {
+	if r.Phase != breakpoint.PhaseResponse || f.Response == nil || !r.Match.Match(f) {
+		return false
+	}
+	return r.rewrite(f, &f.Response.Header, &f.Response.Body)
+}
+
+// rewrite 解码内容编码后替换内容，改写后的内容以未压缩形式发送
+func (r *BodyRule) rewrite(f *flow.Flow, header *http.Header, body *[]byte) bool {
+	// 不支持的编码保持原样
+	decoded, encoded, err := flow.DecodeBody(*header, *body)
+	if err != nil {
+		return false
+	}
+	out, changed := r.replace(f, decoded)
+	if !changed {
+		return false
+	}
+
+	if *header == nil {
+		*header = http.Header{}
+	}
+	if encoded {
+		header.Del("Content-Encoding")
+	}
+	if header.Get("Content-Length") != "" {
+		header.Set("Content-Length", strconv.Itoa(len(out)))
+	}
+	*body = out
+	return true
+}
+
+// replace 替换所有匹配，返回是否有匹配
+func (r *BodyRule) replace(f *flow.Flow, body []byte) ([]byte, bool) {
+	matches := r.pattern.FindAllSubmatchIndex(body, -1)
+	if len(matches) == 0 {
+		return body, false
+	}
+
+	var out bytes.Buffer
+	last := 0
+	for _, m := range matches {
+		out.Write(body[last:m[0]])
+		switch {
+		case r.template != nil:
+			groups := make([]string, len(m)/2)
+			for i := range groups {
+				if m[2*i] >= 0 {
+					groups[i] = string(body[m[2*i]:m[2*i+1]])
+				}
+			}
+			out.Write(execTemplate(r.template, TemplateData{Flow: f, Groups: groups}))
+		case r.Literal:
+			out.WriteString(r.Replace)
+		default:
+			out.Write(r.pattern.Expand(nil, []byte(r.Replace), body, m))
+		}
+		last = m[1]
+	}
+	out.Write(body[last:])
+	return out.Bytes(), true
+}
+
+// String 返回规则描述
+func (r *BodyRule) String() string {
+	return fmt.Sprintf("body %s %s s/%s/%s/", r.Phase, r.Match.String(), r.Find, r.Replace)
+}
@@ -0,0 +1,146 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package rules
+
+import (
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Responder 本地响应规则，匹配的请求不会发往上游
+type Responder interface {
+	// Respond 为请求生成响应，ok 为false表示不处理该请求
+	Respond(f *flow.Flow) (resp *flow.Response, ok bool)
+
+	// Delay 返回响应前的延迟
+	Delay() time.Duration
+
+	// String 规则描述，记录在流的 Responder 字段
+	String() string
+}
+
+// RequestRewriter 请求改写规则
+type RequestRewriter interface {
+	// RewriteRequest 改写流的请求，返回是否做了修改
+	RewriteRequest(f *flow.Flow) bool
+}
+
+// ResponseRewriter 响应改写规则
+type ResponseRewriter interface {
+	// RewriteResponse 改写流的响应，返回是否做了修改
+	RewriteResponse(f *flow.Flow) bool
+}
+
+// Engine 规则引擎，按添加顺序执行规则，并发安全
+type Engine struct {
+	mu         sync.RWMutex
+	responders []Responder
+	requests   []RequestRewriter
+	responses  []ResponseRewriter
+	tags       []*TagRule
+}
+
+// NewEngine 创建规则引擎
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+// AddResponder 添加本地响应规则
+func (e *Engine) AddResponder(r Responder) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.responders = append(e.responders, r)
+}
+
+// Respond 使用第一条匹配的本地响应规则生成响应
+func (e *Engine) Respond(f *flow.Flow) (*flow.Response, Responder, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, r := range e.responders {
+		if resp, ok := r.Respond(f); ok {
+			return resp, r, true
+		}
+	}
+	return nil, nil, false
+}
+
+// AddRequestRewriter 添加请求改写规则
+func (e *Engine) AddRequestRewriter(r RequestRewriter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests = append(e.requests, r)
+}
+
+// RewriteRequest 依次执行所有请求改写规则，返回是否做了修改
+func (e *Engine) RewriteRequest(f *flow.Flow) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	modified := false
+	for _, r := range e.requests {
+		if r.RewriteRequest(f) {
+			modified = true
+		}
+	}
+	return modified
+}
+
+// AddResponseRewriter 添加响应改写规则
+func (e *Engine) AddResponseRewriter(r ResponseRewriter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.responses = append(e.responses, r)
+}
+
+// RewriteResponse 依次执行所有响应改写规则，返回是否做了修改
+func (e *Engine) RewriteResponse(f *flow.Flow) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	modified := false
+	for _, r := range e.responses {
+		if r.RewriteResponse(f) {
+			modified = true
+		}
+	}
+	return modified
+}
+
+// AddTagRule 添加标签规则
+func (e *Engine) AddTagRule(r *TagRule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tags = append(e.tags, r)
+}
+
+// Tag 为流添加所有匹配的标签规则的标签，在流结束时调用
+func (e *Engine) Tag(f *flow.Flow) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, r := range e.tags {
+		r.Apply(f)
+	}
+}
+
+// Replace 用另一个引擎的规则原子地替换当前规则，正在执行的规则不受影响。other 为nil时清空所有规则
+func (e *Engine) Replace(other *Engine) {
+	var responders []Responder
+	var requests []RequestRewriter
+	var responses []ResponseRewriter
+	var tags []*TagRule
+	if other != nil {
+		other.mu.RLock()
+		responders = append(responders, other.responders...)
+		requests = append(requests, other.requests...)
+		responses = append(responses, other.responses...)
+		tags = append(tags, other.tags...)
+		other.mu.RUnlock()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.responders, e.requests, e.responses, e.tags = responders, requests, responses, tags
+}
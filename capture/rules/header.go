@@ -0,0 +1,157 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// HeaderAction 头部改写动作
+type HeaderAction string
+
+const (
+	// HeaderAdd 追加头部值
+	HeaderAdd HeaderAction = "add"
+	// HeaderSet 设置头部，替换已有的值
+	HeaderSet HeaderAction = "set"
+	// HeaderRemove 删除头部
+	HeaderRemove HeaderAction = "remove"
+)
+
+// HeaderRule 添加、替换或删除请求/响应头部
+type HeaderRule struct {
+	// Phase 改写请求还是响应
+	Phase breakpoint.Phase `json:"phase"`
+
+	// Action 改写动作
+	Action HeaderAction `json:"action"`
+
+	// Match 请求匹配规则，URL 不为nil时忽略
+	Match flow.Matcher `json:"match"`
+
+	// URL 匹配请求URL的正则表达式，Value 中可以用 $1、${name} 引用捕获组
+	URL *regexp.Regexp `json:"-"`
+
+	// Name 头部名称
+	Name string `json:"name"`
+
+	// Value 头部值，删除时忽略
+	Value string `json:"value,omitempty"`
+}
+
+// ParseHeaderRule 解析命令行格式 "phase action match Name[: value]"，
+// match 为 [host][/path] 或以 "~" 开头的URL正则表达式，例如
+// "request set ~^https://api\.example\.com/users/(\d+) X-User-Id: $1"
+func ParseHeaderRule(s string) (*HeaderRule, error) {
+	fields := strings.SplitN(strings.TrimSpace(s), " ", 4)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("invalid header rule %q (expected phase action match Name[: value])", s)
+	}
+
+	phase, err := breakpoint.ParsePhase(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	r := &HeaderRule{Phase: phase}
+
+	switch action := HeaderAction(strings.ToLower(fields[1])); action {
+	case HeaderAdd, HeaderSet, HeaderRemove:
+		r.Action = action
+	case "replace":
+		r.Action = HeaderSet
+	default:
+		return nil, fmt.Errorf("invalid header action %q (expected add, set or remove)", fields[1])
+	}
+
+	if pattern, ok := strings.CutPrefix(fields[2], "~"); ok {
+		if r.URL, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid header rule URL pattern %q: %w", pattern, err)
+		}
+	} else {
+		r.Match = flow.ParseMatcher(fields[2])
+	}
+
+	name, value, _ := strings.Cut(fields[3], ":")
+	r.Name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	r.Value = strings.TrimSpace(value)
+	if r.Name == "" {
+		return nil, fmt.Errorf("invalid header rule %q: missing header name", s)
+	}
+	if r.Action != HeaderRemove && r.Value == "" {
+		return nil, fmt.Errorf("invalid header rule %q: missing header value", s)
+	}
+	return r, nil
+}
+
+// RewriteRequest 实现 RequestRewriter 接口
+func (r *HeaderRule) RewriteRequest(f *flow.Flow) bool {
+	if r.Phase != breakpoint.PhaseRequest {
+		return false
+	}
+	return r.apply(f, f.Request.Header, func(h http.Header) { f.Request.Header = h })
+}
+
+// RewriteResponse 实现 ResponseRewriter 接口
+func (r *HeaderRule) RewriteResponse(f *flow.Flow) bool {
+	if r.Phase != breakpoint.PhaseResponse || f.Response == nil {
+		return false
+	}
+	return r.apply(f, f.Response.Header, func(h http.Header) { f.Response.Header = h })
+}
+
+func (r *HeaderRule) apply(f *flow.Flow, header http.Header, set func(http.Header)) bool {
+	value, ok := r.expand(f)
+	if !ok {
+		return false
+	}
+	if header == nil {
+		header = http.Header{}
+		set(header)
+	}
+
+	switch r.Action {
+	case HeaderAdd:
+		header.Add(r.Name, value)
+	case HeaderSet:
+		header.Set(r.Name, value)
+	case HeaderRemove:
+		if header.Values(r.Name) == nil {
+			return false
+		}
+		header.Del(r.Name)
+	}
+	return true
+}
+
+// expand 判断规则是否匹配并展开头部值中的捕获组引用
+func (r *HeaderRule) expand(f *flow.Flow) (string, bool) {
+	if r.URL == nil {
+		return r.Value, r.Match.Match(f)
+	}
+	if f.Request == nil {
+		return "", false
+	}
+	m := r.URL.FindStringSubmatchIndex(f.Request.URL)
+	if m == nil {
+		return "", false
+	}
+	return string(r.URL.ExpandString(nil, r.Value, f.Request.URL, m)), true
+}
+
+// String 返回规则描述
+func (r *HeaderRule) String() string {
+	match := r.Match.String()
+	if r.URL != nil {
+		match = "~" + r.URL.String()
+	}
+	return fmt.Sprintf("header %s %s %s %s", r.Phase, r.Action, match, r.Name)
+}
@@ -0,0 +1,149 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// MapLocal 使用本地文件或目录响应匹配的请求
+type MapLocal struct {
+	// Match 请求匹配规则
+	Match flow.Matcher `json:"match"`
+
+	// Path 本地文件或目录，目录时按去除 Match.Path 前缀后的请求路径查找文件
+	Path string `json:"path"`
+
+	// Latency 响应前的延迟，模拟网络耗时
+	Latency time.Duration `json:"latency,omitempty"`
+}
+
+// ParseMapLocal 解析命令行格式 pattern=path[,latency]，例如 "example.com/static=./dist,200ms"
+func ParseMapLocal(s string) (*MapLocal, error) {
+	pattern, target, ok := strings.Cut(s, "=")
+	if !ok || pattern == "" || target == "" {
+		return nil, fmt.Errorf("invalid map-local rule %q (expected [METHOD ]host[/path]=path[,latency])", s)
+	}
+	m := &MapLocal{Match: flow.ParseMatcher(pattern), Path: target}
+	if p, latency, ok := strings.Cut(target, ","); ok {
+		d, err := time.ParseDuration(latency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid map-local latency %q: %w", latency, err)
+		}
+		m.Path, m.Latency = p, d
+	}
+	return m, nil
+}
+
+// Respond 实现 Responder 接口
+func (m *MapLocal) Respond(f *flow.Flow) (*flow.Response, bool) {
+	if !m.Match.Match(f) {
+		return nil, false
+	}
+	u, err := url.Parse(f.Request.URL)
+	if err != nil {
+		return nil, false
+	}
+
+	name, err := m.resolve(u.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return textResponse(http.StatusNotFound, u.Path+" not found"), true
+		}
+		return textResponse(http.StatusInternalServerError, err.Error()), true
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return textResponse(http.StatusInternalServerError, err.Error()), true
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	if f.Request.Method == http.MethodHead {
+		data = nil
+	}
+	return &flow.Response{
+		StatusCode: http.StatusOK,
+		Status:     statusText(http.StatusOK),
+		Proto:      "HTTP/1.1",
+		Header:     header,
+		Body:       data,
+	}, true
+}
+
+// Delay 实现 Responder 接口
+func (m *MapLocal) Delay() time.Duration {
+	return m.Latency
+}
+
+// String 实现 Responder 接口
+func (m *MapLocal) String() string {
+	return "map-local " + m.Match.String() + " -> " + m.Path
+}
+
+// resolve 将请求路径映射到本地文件，目录请求返回其中的 index.html
+func (m *MapLocal) resolve(requestPath string) (string, error) {
+	info, err := os.Stat(m.Path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return m.Path, nil
+	}
+
+	// 先按 "/" 清理路径，防止 ".." 跳出根目录
+	rel := path.Clean("/" + strings.TrimPrefix(requestPath, m.Match.Path))
+	name := filepath.Join(m.Path, filepath.FromSlash(rel))
+	info, err = os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		name = filepath.Join(name, "index.html")
+		if _, err := os.Stat(name); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+// textResponse 生成纯文本响应
+func textResponse(status int, msg string) *flow.Response {
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(msg)))
+	return &flow.Response{
+		StatusCode: status,
+		Status:     statusText(status),
+		Proto:      "HTTP/1.1",
+		Header:     header,
+		Body:       []byte(msg),
+	}
+}
+
+// statusText 返回 "200 OK" 形式的状态行
+func statusText(status int) string {
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package rules
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// MapRemote 将匹配请求的协议、主机、端口和路径前缀改写到另一个上游
+type MapRemote struct {
+	// Match 请求匹配规则
+	Match flow.Matcher `json:"match"`
+
+	// To 目标URL前缀，例如 "https://staging.example.com:8443/v2"
+	To string `json:"to"`
+
+	// PreserveHost 是否保留原始Host头部，默认改为目标主机
+	PreserveHost bool `json:"preserve_host,omitempty"`
+
+	to *url.URL
+}
+
+// NewMapRemote 创建主机改写规则
+func NewMapRemote(match flow.Matcher, to string, preserveHost bool) (*MapRemote, error) {
+	u, err := url.Parse(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid map-remote target %q: %w", to, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid map-remote target %q: scheme must be http or https", to)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid map-remote target %q: missing host", to)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return &MapRemote{Match: match, To: to, PreserveHost: preserveHost, to: u}, nil
+}
+
+// ParseMapRemote 解析命令行格式 pattern=url[,preserve-host]，例如 "api.example.com=https://staging.example.com"
+func ParseMapRemote(s string) (*MapRemote, error) {
+	pattern, target, ok := strings.Cut(s, "=")
+	if !ok || pattern == "" || target == "" {
+		return nil, fmt.Errorf("invalid map-remote rule %q (expected [METHOD ]host[/path]=url[,preserve-host])", s)
+	}
+	to, option, _ := strings.Cut(target, ",")
+	if option != "" && option != "preserve-host" {
+		return nil, fmt.Errorf("invalid map-remote option %q (expected preserve-host)", option)
+	}
+	return NewMapRemote(flow.ParseMatcher(pattern), to, option == "preserve-host")
+}
+
+// RewriteRequest 实现 RequestRewriter 接口
+func (m *MapRemote) RewriteRequest(f *flow.Flow) bool {
+	if !m.Match.Match(f) {
+		return false
+	}
+	u, err := url.Parse(f.Request.URL)
+	if err != nil {
+		return false
+	}
+
+	u.Scheme = m.to.Scheme
+	u.Host = m.to.Host
+	rest := strings.TrimPrefix(u.Path, m.Match.Path)
+	if strings.HasSuffix(m.Match.Path, "/") {
+		rest = "/" + rest
+	}
+	u.Path = m.to.Path + rest
+	u.RawPath = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	f.Request.URL = u.String()
+	if !m.PreserveHost {
+		f.Request.Host = m.to.Host
+	}
+	return true
+}
+
+// String 返回规则描述
+func (m *MapRemote) String() string {
+	return "map-remote " + m.Match.String() + " -> " + m.To
+}
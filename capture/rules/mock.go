@@ -0,0 +1,182 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Mock 模拟响应定义，匹配的请求直接由定义生成响应，不连接上游
+type Mock struct {
+	// Name 定义名称，用于日志和流记录
+	Name string `json:"name,omitempty"`
+
+	// Match 请求匹配规则，格式同 flow.ParseMatcher
+	Match string `json:"match,omitempty"`
+
+	// URL 匹配请求URL的正则表达式，捕获组可在模板中通过 .Groups 引用
+	URL string `json:"url,omitempty"`
+
+	// Status 响应状态码，默认为200
+	Status int `json:"status,omitempty"`
+
+	// Headers 响应头部，值可以是Go模板
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Body 响应体，可以是Go模板
+	Body string `json:"body,omitempty"`
+
+	// BodyFile 从文件读取响应体模板，相对路径相对于定义文件所在目录
+	BodyFile string `json:"body_file,omitempty"`
+
+	// Latency 响应前的延迟，例如 "300ms"
+	Latency string `json:"latency,omitempty"`
+
+	matcher flow.Matcher
+	url     *regexp.Regexp
+	headers map[string]*template.Template
+	body    *template.Template
+	latency time.Duration
+}
+
+// LoadMocks 从JSON文件加载模拟响应定义，文件内容为 Mock 数组
+func LoadMocks(path string) ([]*Mock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read mock file: %w", err)
+	}
+	var mocks []*Mock
+	if err := json.Unmarshal(data, &mocks); err != nil {
+		return nil, fmt.Errorf("parse mock file %s: %w", path, err)
+	}
+	for i, m := range mocks {
+		if m.BodyFile != "" && !filepath.IsAbs(m.BodyFile) {
+			m.BodyFile = filepath.Join(filepath.Dir(path), m.BodyFile)
+		}
+		if err := m.Compile(); err != nil {
+			return nil, fmt.Errorf("mock %d in %s: %w", i, path, err)
+		}
+	}
+	return mocks, nil
+}
+
+// Compile 校验定义并预编译匹配规则和模板，添加到引擎前必须调用
+func (m *Mock) Compile() error {
+	if m.Match == "" && m.URL == "" {
+		return fmt.Errorf("mock needs match or url")
+	}
+	m.matcher = flow.ParseMatcher(m.Match)
+	if m.URL != "" {
+		var err error
+		if m.url, err = regexp.Compile(m.URL); err != nil {
+			return fmt.Errorf("invalid mock url pattern %q: %w", m.URL, err)
+		}
+	}
+	if m.Status == 0 {
+		m.Status = http.StatusOK
+	}
+	if m.Status < 100 || m.Status > 999 {
+		return fmt.Errorf("invalid mock status %d", m.Status)
+	}
+	if m.Latency != "" {
+		d, err := time.ParseDuration(m.Latency)
+		if err != nil {
+			return fmt.Errorf("invalid mock latency %q: %w", m.Latency, err)
+		}
+		m.latency = d
+	}
+
+	body := m.Body
+	if m.BodyFile != "" {
+		data, err := os.ReadFile(m.BodyFile)
+		if err != nil {
+			return fmt.Errorf("read mock body: %w", err)
+		}
+		body = string(data)
+	}
+	var err error
+	if m.body, err = parseTemplate("body", body); err != nil {
+		return fmt.Errorf("invalid mock body template: %w", err)
+	}
+	m.headers = make(map[string]*template.Template, len(m.Headers))
+	for name, value := range m.Headers {
+		t, err := parseTemplate(name, value)
+		if err != nil {
+			return fmt.Errorf("invalid mock header %s template: %w", name, err)
+		}
+		m.headers[http.CanonicalHeaderKey(name)] = t
+	}
+	return nil
+}
+
+// Respond 实现 Responder 接口
+func (m *Mock) Respond(f *flow.Flow) (*flow.Response, bool) {
+	if f.Request == nil || (m.Match != "" && !m.matcher.Match(f)) {
+		return nil, false
+	}
+	data := TemplateData{Flow: f}
+	if m.url != nil {
+		data.Groups = m.url.FindStringSubmatch(f.Request.URL)
+		if data.Groups == nil {
+			return nil, false
+		}
+	}
+
+	body := execTemplate(m.body, data)
+	header := http.Header{}
+	for name, t := range m.headers {
+		header.Set(name, string(execTemplate(t, data)))
+	}
+	if header.Get("Content-Type") == "" && len(body) > 0 {
+		header.Set("Content-Type", detectContentType(body))
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	if f.Request.Method == http.MethodHead {
+		body = nil
+	}
+
+	return &flow.Response{
+		StatusCode: m.Status,
+		Status:     statusText(m.Status),
+		Proto:      "HTTP/1.1",
+		Header:     header,
+		Body:       body,
+	}, true
+}
+
+// Delay 实现 Responder 接口
+func (m *Mock) Delay() time.Duration {
+	return m.latency
+}
+
+// String 实现 Responder 接口
+func (m *Mock) String() string {
+	if m.Name != "" {
+		return "mock " + m.Name
+	}
+	if m.URL != "" {
+		return "mock ~" + m.URL
+	}
+	return "mock " + m.matcher.String()
+}
+
+// detectContentType 推断响应体类型，JSON 优先于 http.DetectContentType
+func detectContentType(body []byte) string {
+	if json.Valid(body) {
+		return "application/json"
+	}
+	return http.DetectContentType(body)
+}
@@ -0,0 +1,353 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package rules
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func newFlow(method, url string) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{Method: method, URL: url, Header: http.Header{}}
+	return f
+}
+
+func writeFile(t *testing.T, name, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+	require.NoError(t, os.WriteFile(name, []byte(content), 0o644))
+}
+
+// --- 测试代码 ---
+func TestParseMapLocal(t *testing.T) {
+	m, err := ParseMapLocal("GET example.com/static=./dist,150ms")
+	require.NoError(t, err)
+	require.Equal(t, flow.Matcher{Method: "GET", Host: "example.com", Path: "/static"}, m.Match)
+	require.Equal(t, "./dist", m.Path)
+	require.Equal(t, 150*time.Millisecond, m.Latency)
+
+	_, err = ParseMapLocal("example.com")
+	require.Error(t, err)
+	_, err = ParseMapLocal("example.com=./dist,soon")
+	require.Error(t, err)
+}
+
+func TestMapLocal_Respond(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "index.html"), "<h1>home</h1>")
+	writeFile(t, filepath.Join(root, "js", "app.js"), "console.log(1)")
+	writeFile(t, filepath.Join(filepath.Dir(root), "secret.txt"), "secret")
+
+	m := &MapLocal{Match: flow.ParseMatcher("example.com/static"), Path: root}
+
+	testCases := []struct {
+		name        string
+		url         string
+		wantOK      bool
+		status      int
+		contentType string
+		body        string
+	}{
+		{"file", "https://example.com/static/js/app.js", true, http.StatusOK, "javascript", "console.log(1)"},
+		{"index", "https://example.com/static/", true, http.StatusOK, "text/html", "<h1>home</h1>"},
+		{"missing", "https://example.com/static/nope.css", true, http.StatusNotFound, "text/plain; charset=utf-8", "/static/nope.css not found"},
+		{"traversal", "https://example.com/static/../../secret.txt", true, http.StatusNotFound, "text/plain; charset=utf-8", "/static/../../secret.txt not found"},
+		{"other host", "https://other.org/static/js/app.js", false, 0, "", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, ok := m.Respond(newFlow("GET", tc.url))
+			require.Equal(t, tc.wantOK, ok)
+			if !ok {
+				return
+			}
+			require.Equal(t, tc.status, resp.StatusCode)
+			require.Contains(t, resp.Header.Get("Content-Type"), tc.contentType)
+			require.Equal(t, tc.body, string(resp.Body))
+		})
+	}
+}
+
+func TestEngine_Respond(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "user.json")
+	writeFile(t, name, `{"id":1}`)
+
+	e := NewEngine()
+	e.AddResponder(&MapLocal{Match: flow.ParseMatcher("api.example.com/user"), Path: name})
+
+	resp, rule, ok := e.Respond(newFlow("GET", "https://api.example.com/user/1"))
+	require.True(t, ok)
+	require.Contains(t, resp.Header.Get("Content-Type"), "json")
+	require.Equal(t, `{"id":1}`, string(resp.Body))
+	require.Contains(t, rule.String(), "map-local")
+
+	_, _, ok = e.Respond(newFlow("GET", "https://api.example.com/other"))
+	require.False(t, ok)
+}
+
+func TestMapRemote_RewriteRequest(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rule     string
+		url      string
+		wantOK   bool
+		wantURL  string
+		wantHost string
+	}{
+		{"host", "api.example.com=https://staging.example.com", "http://api.example.com/users?id=1", true, "https://staging.example.com/users?id=1", "staging.example.com"},
+		{"path prefix", "api.example.com/v1=http://localhost:8080/v2", "https://api.example.com/v1/users", true, "http://localhost:8080/v2/users", "localhost:8080"},
+		{"trailing slash", "api.example.com/v1/=http://localhost:8080", "https://api.example.com/v1/users", true, "http://localhost:8080/users", "localhost:8080"},
+		{"preserve host", "api.example.com=http://10.0.0.1,preserve-host", "https://api.example.com/", true, "http://10.0.0.1/", "api.example.com"},
+		{"no match", "api.example.com=https://staging.example.com", "https://www.example.com/", false, "https://www.example.com/", "api.example.com"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := ParseMapRemote(tc.rule)
+			require.NoError(t, err)
+			f := newFlow("GET", tc.url)
+			f.Request.Host = "api.example.com"
+			require.Equal(t, tc.wantOK, m.RewriteRequest(f))
+			require.Equal(t, tc.wantURL, f.Request.URL)
+			require.Equal(t, tc.wantHost, f.Request.Host)
+		})
+	}
+}
+
+func TestParseMapRemote_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"api.example.com",
+		"api.example.com=ftp://example.com",
+		"api.example.com=https://",
+		"api.example.com=https://example.com,keep",
+	} {
+		_, err := ParseMapRemote(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestHeaderRule(t *testing.T) {
+	testCases := []struct {
+		name   string
+		rule   string
+		url    string
+		header http.Header
+		wantOK bool
+		want   http.Header
+	}{
+		{"set", "request set api.example.com Authorization: Bearer token", "https://api.example.com/", http.Header{"Authorization": {"old"}}, true, http.Header{"Authorization": {"Bearer token"}}},
+		{"add", "request add *.example.com x-debug: 1", "https://api.example.com/", http.Header{"X-Debug": {"0"}}, true, http.Header{"X-Debug": {"0", "1"}}},
+		{"remove", "request remove * Cookie", "https://api.example.com/", http.Header{"Cookie": {"a=b"}, "Accept": {"*/*"}}, true, http.Header{"Accept": {"*/*"}}},
+		{"remove missing", "request remove * Cookie", "https://api.example.com/", http.Header{}, false, http.Header{}},
+		{"capture group", `request set ~^https://api\.example\.com/users/(\d+) X-User-Id: $1`, "https://api.example.com/users/42/posts", http.Header{}, true, http.Header{"X-User-Id": {"42"}}},
+		{"regex no match", `request set ~^https://api\.example\.com/users/(\d+) X-User-Id: $1`, "https://api.example.com/teams/1", http.Header{}, false, http.Header{}},
+		{"host no match", "request set api.example.com X-A: 1", "https://other.org/", http.Header{}, false, http.Header{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ParseHeaderRule(tc.rule)
+			require.NoError(t, err)
+			f := newFlow("GET", tc.url)
+			f.Request.Header = tc.header
+			require.Equal(t, tc.wantOK, r.RewriteRequest(f))
+			require.Equal(t, tc.want, f.Request.Header)
+			require.False(t, r.RewriteResponse(f))
+		})
+	}
+}
+
+func TestHeaderRule_Response(t *testing.T) {
+	e := NewEngine()
+	r, err := ParseHeaderRule("response set * Access-Control-Allow-Origin: *")
+	require.NoError(t, err)
+	e.AddResponseRewriter(r)
+
+	f := newFlow("GET", "https://api.example.com/")
+	require.False(t, e.RewriteResponse(f))
+	f.Response = &flow.Response{StatusCode: http.StatusOK}
+	require.True(t, e.RewriteResponse(f))
+	require.Equal(t, "*", f.Response.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestParseHeaderRule_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"request set example.com",
+		"upstream set example.com X-A: 1",
+		"request rename example.com X-A: 1",
+		"request set example.com X-A",
+		"request set ~[ X-A: 1",
+	} {
+		_, err := ParseHeaderRule(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestBodyRule(t *testing.T) {
+	testCases := []struct {
+		name   string
+		rule   string
+		body   string
+		wantOK bool
+		want   string
+	}{
+		{"regex", `response * s/"debug":\s*false/"debug":true/`, `{"debug": false}`, true, `{"debug":true}`},
+		{"groups", `response * s/(\w+)@example\.com/$1@test.local/`, "a@example.com, b@example.com", true, "a@test.local, b@test.local"},
+		{"literal", `response * s|a.b|$1|l`, "a.b axb", true, "$1 axb"},
+		{"ignore case", `response * s/hello/bye/i`, "Hello HELLO", true, "bye bye"},
+		{"template", `response * s/NAME/{{.Flow.Request.Method | lower}}-{{index .Groups 0}}/`, "hi NAME", true, "hi get-NAME"},
+		{"escaped delimiter", `response * s/a\/b/c/`, "a/b", true, "c"},
+		{"no match", `response * s/missing/x/`, "body", false, "body"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ParseBodyRule(tc.rule)
+			require.NoError(t, err)
+			f := newFlow("GET", "https://api.example.com/")
+			f.Response = &flow.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(tc.body)}
+			require.Equal(t, tc.wantOK, r.RewriteResponse(f))
+			require.Equal(t, tc.want, string(f.Response.Body))
+			require.False(t, r.RewriteRequest(f))
+		})
+	}
+}
+
+func TestBodyRule_Gzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	r, err := ParseBodyRule("response api.example.com s/world/sniffy/")
+	require.NoError(t, err)
+	f := newFlow("GET", "https://api.example.com/")
+	f.Response = &flow.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Encoding": {"gzip"}, "Content-Length": {strconv.Itoa(buf.Len())}},
+		Body:       buf.Bytes(),
+	}
+	require.True(t, r.RewriteResponse(f))
+	require.Equal(t, "hello sniffy", string(f.Response.Body))
+	require.Empty(t, f.Response.Header.Get("Content-Encoding"))
+	require.Equal(t, "12", f.Response.Header.Get("Content-Length"))
+
+	// 不支持的编码保持原样
+	f.Response.Header.Set("Content-Encoding", "br")
+	require.False(t, r.RewriteResponse(f))
+}
+
+func TestParseBodyRule_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"response *",
+		"response * x/a/b/",
+		"response * s/a/b",
+		"response * s//b/",
+		"response * s/a/b/z",
+		"response * s/[/b/",
+		"response * s/a/{{.Nope/",
+	} {
+		_, err := ParseBodyRule(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestTagRule(t *testing.T) {
+	e := NewEngine()
+	for _, s := range []string{"server-error=status >= 500", "slow = duration > 1s", "api=host == api.example.com"} {
+		r, err := ParseTagRule(s)
+		require.NoError(t, err, s)
+		e.AddTagRule(r)
+	}
+
+	f := newFlow("GET", "https://api.example.com/orders")
+	f.Request.Host = "api.example.com"
+	f.Response = &flow.Response{StatusCode: 503}
+	f.StartTime = time.Now()
+	f.EndTime = f.StartTime.Add(10 * time.Millisecond)
+	f.Tag("api")
+	e.Tag(f)
+	require.Equal(t, []string{"api", "server-error"}, f.Tags)
+
+	other := NewEngine()
+	other.Replace(e)
+	f.EndTime = f.StartTime.Add(2 * time.Second)
+	other.Tag(f)
+	require.Equal(t, []string{"api", "server-error", "slow"}, f.Tags)
+
+	other.Replace(nil)
+	f.Tags = nil
+	other.Tag(f)
+	require.Empty(t, f.Tags)
+
+	for _, s := range []string{"", "slow", "=status >= 500", "slow=", "bad=status ~~ 1"} {
+		_, err := ParseTagRule(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestLoadMocks(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "user.tmpl"), `{"id":{{index .Groups 1}},"q":"{{query .Flow "q"}}"}`)
+	writeFile(t, filepath.Join(dir, "mocks.json"), `[
+		{"name": "user", "url": "^https://api\\.example\\.com/users/(\\d+)", "body_file": "user.tmpl", "latency": "20ms"},
+		{"match": "DELETE api.example.com/users", "status": 403, "headers": {"x-reason": "{{.Flow.Request.Method}} denied"}, "body": "forbidden"}
+	]`)
+
+	mocks, err := LoadMocks(filepath.Join(dir, "mocks.json"))
+	require.NoError(t, err)
+	require.Len(t, mocks, 2)
+
+	e := NewEngine()
+	for _, m := range mocks {
+		e.AddResponder(m)
+	}
+
+	resp, rule, ok := e.Respond(newFlow("GET", "https://api.example.com/users/7?q=abc"))
+	require.True(t, ok)
+	require.Equal(t, "mock user", rule.String())
+	require.Equal(t, 20*time.Millisecond, rule.Delay())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.Equal(t, `{"id":7,"q":"abc"}`, string(resp.Body))
+
+	resp, _, ok = e.Respond(newFlow("DELETE", "https://api.example.com/users"))
+	require.True(t, ok)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Equal(t, "DELETE denied", resp.Header.Get("X-Reason"))
+	require.Equal(t, "forbidden", string(resp.Body))
+
+	_, _, ok = e.Respond(newFlow("GET", "https://api.example.com/teams"))
+	require.False(t, ok)
+}
+
+func TestMock_CompileErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock Mock
+	}{
+		{"no match", Mock{Body: "x"}},
+		{"bad url", Mock{URL: "("}},
+		{"bad status", Mock{Match: "*", Status: 42}},
+		{"bad latency", Mock{Match: "*", Latency: "later"}},
+		{"bad template", Mock{Match: "*", Body: "{{.Flow"}},
+		{"missing body file", Mock{Match: "*", BodyFile: "/nonexistent/body"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Error(t, tc.mock.Compile())
+		})
+	}
+}
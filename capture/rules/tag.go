@@ -0,0 +1,51 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// TagRule 为满足过滤表达式的流添加标签，在流结束时求值，表达式可以使用响应和耗时等字段
+type TagRule struct {
+	// Tag 添加的标签
+	Tag string `json:"tag"`
+
+	// Filter 流过滤表达式
+	Filter *filter.Filter `json:"-"`
+}
+
+// ParseTagRule 解析命令行格式 "tag=表达式"，例如 "slow=duration > 1s" 或 "server-error=status >= 500"
+func ParseTagRule(s string) (*TagRule, error) {
+	tag, expr, ok := strings.Cut(s, "=")
+	tag, expr = strings.TrimSpace(tag), strings.TrimSpace(expr)
+	if !ok || tag == "" || expr == "" {
+		return nil, fmt.Errorf("invalid tag rule %q (expected tag=filter)", s)
+	}
+	fl, err := filter.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag rule %q: %w", s, err)
+	}
+	return &TagRule{Tag: tag, Filter: fl}, nil
+}
+
+// Apply 流满足表达式时添加标签，返回是否匹配
+func (r *TagRule) Apply(f *flow.Flow) bool {
+	if !r.Filter.Match(f) {
+		return false
+	}
+	f.Tag(r.Tag)
+	return true
+}
+
+// String 返回规则描述
+func (r *TagRule) String() string {
+	return fmt.Sprintf("tag %s %s", r.Tag, r.Filter)
+}
@@ -0,0 +1,67 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package rules
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// TemplateData 模板可以访问的数据
+type TemplateData struct {
+	// Flow 当前流
+	Flow *flow.Flow
+
+	// Groups 正则捕获组，Groups[0] 为完整匹配
+	Groups []string
+}
+
+// templateFuncs 模板可用的函数
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"now": func() string {
+		return time.Now().UTC().Format(time.RFC3339)
+	},
+	"unix": func() int64 {
+		return time.Now().Unix()
+	},
+	"query": func(f *flow.Flow, key string) string {
+		if f == nil || f.Request == nil {
+			return ""
+		}
+		u, err := url.Parse(f.Request.URL)
+		if err != nil {
+			return ""
+		}
+		return u.Query().Get(key)
+	},
+}
+
+// isTemplate 判断文本是否包含模板动作
+func isTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// parseTemplate 解析规则中使用的Go模板
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// execTemplate 执行模板，失败时返回错误信息文本，避免中断转发
+func execTemplate(t *template.Template, data TemplateData) []byte {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return []byte(err.Error())
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,127 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sample
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Rule 采样规则，满足过滤表达式的流按 Rate 采样
+type Rule struct {
+	// Filter 匹配流的过滤表达式
+	Filter *filter.Filter
+
+	// Rate 采样率，取值 [0, 1]
+	Rate float64
+}
+
+// ParseRule 解析命令行格式 rate:expression，rate 为 0.05 或 5% 形式，例如：
+//
+//	100%:status >= 500
+//	1:host == "api.example.com"
+//	0:path =~ "^/health"
+func ParseRule(s string) (Rule, error) {
+	rate, expr, ok := strings.Cut(s, ":")
+	if !ok || strings.TrimSpace(expr) == "" {
+		return Rule{}, fmt.Errorf("invalid sample rule %q (expected rate:expression)", s)
+	}
+	r, err := ParseRate(rate)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid sample rule %q: %w", s, err)
+	}
+	f, err := filter.Compile(expr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid sample rule %q: %w", s, err)
+	}
+	return Rule{Filter: f, Rate: r}, nil
+}
+
+// ParseRate 解析 0.05 或 5% 形式的采样率
+func ParseRate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	scale := 1.0
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		s, scale = pct, 100
+	}
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sample rate %q", s)
+	}
+	r /= scale
+	if r < 0 || r > 1 {
+		return 0, fmt.Errorf("sample rate %v out of range [0, 1]", r)
+	}
+	return r, nil
+}
+
+// Sampler 流采样器，按顺序使用第一条匹配的规则的采样率，没有规则匹配时使用默认采样率。
+// 流在结束后采样，规则可以按状态码、错误等结果决定是否保留
+type Sampler struct {
+	rate  float64
+	rules []Rule
+
+	kept    atomic.Int64
+	dropped atomic.Int64
+}
+
+// New 创建默认采样率为 rate 的采样器
+func New(rate float64) *Sampler {
+	return &Sampler{rate: rate}
+}
+
+// Add 添加规则，需在开始采样前调用
+func (s *Sampler) Add(r Rule) {
+	s.rules = append(s.rules, r)
+}
+
+// Rate 返回流适用的采样率
+func (s *Sampler) Rate(f *flow.Flow) float64 {
+	for _, r := range s.rules {
+		if r.Filter.Match(f) {
+			return r.Rate
+		}
+	}
+	return s.rate
+}
+
+// Sample 判断是否保留流。为nil时保留所有流
+func (s *Sampler) Sample(f *flow.Flow) bool {
+	if s == nil {
+		return true
+	}
+	rate := s.Rate(f)
+	keep := rate >= 1 || (rate > 0 && rand.Float64() < rate)
+	if keep {
+		s.kept.Add(1)
+	} else {
+		s.dropped.Add(1)
+	}
+	return keep
+}
+
+// Stats 采样统计
+type Stats struct {
+	// Kept 保留的流数量
+	Kept int64 `json:"kept"`
+
+	// Dropped 丢弃的流数量
+	Dropped int64 `json:"dropped"`
+}
+
+// Stats 返回采样统计
+func (s *Sampler) Stats() Stats {
+	if s == nil {
+		return Stats{}
+	}
+	return Stats{Kept: s.kept.Load(), Dropped: s.dropped.Load()}
+}
@@ -0,0 +1,74 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sample
+
+import (
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+func newFlow(host string, status int) *flow.Flow {
+	return &flow.Flow{
+		Request:  &flow.Request{Method: "GET", URL: "https://" + host + "/", Host: host},
+		Response: &flow.Response{StatusCode: status},
+	}
+}
+
+func mustRule(t *testing.T, s string) Rule {
+	t.Helper()
+	r, err := ParseRule(s)
+	require.NoError(t, err)
+	return r
+}
+
+// --- 测试代码 ---
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("100%:status >= 500")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, r.Rate)
+	require.True(t, r.Filter.Match(newFlow("a.test", 502)))
+
+	r, err = ParseRule(`0.25:host == "a.test"`)
+	require.NoError(t, err)
+	require.Equal(t, 0.25, r.Rate)
+
+	for _, s := range []string{"status >= 500", "1:", "2:status == 200", "x:status == 200", "1:nope == 1"} {
+		_, err := ParseRule(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestSampler_Sample(t *testing.T) {
+	s := New(0)
+	s.Add(mustRule(t, "1:status >= 500"))
+	s.Add(mustRule(t, `1:host == "keep.test"`))
+	s.Add(mustRule(t, `50%:host == "half.test"`))
+
+	require.True(t, s.Sample(newFlow("other.test", 503)))
+	require.True(t, s.Sample(newFlow("keep.test", 200)))
+	require.False(t, s.Sample(newFlow("other.test", 200)))
+	require.Equal(t, Stats{Kept: 2, Dropped: 1}, s.Stats())
+
+	// 按比例采样
+	kept := 0
+	for range 10000 {
+		if s.Sample(newFlow("half.test", 200)) {
+			kept++
+		}
+	}
+	require.InDelta(t, 5000, kept, 500)
+}
+
+func TestSampler_Nil(t *testing.T) {
+	var s *Sampler
+	require.True(t, s.Sample(newFlow("a.test", 200)))
+	require.Equal(t, Stats{}, s.Stats())
+}
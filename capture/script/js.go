@@ -0,0 +1,269 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package script
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/hooks"
+)
+
+// JS 基于goja的JavaScript脚本，实现 hooks.Hook。
+//
+// 脚本可以定义全局函数 onRequest(flow) 和 onResponse(flow)：
+//
+//	function onRequest(flow) {
+//	  flow.request.headers["X-Debug"] = "1";
+//	  if (flow.request.url.endsWith("/health")) flow.respond(200, "ok");
+//	}
+//	function onResponse(flow) {
+//	  if (flow.response.status >= 500) flow.tag("server-error");
+//	}
+//
+// flow.request 包含 method、url、host、headers 和 body，flow.response 包含 status、headers 和 body，
+// headers 的值为字符串或字符串数组，body 为解码后的文本。修改这些字段会写回流；
+// flow.respond(status, body, headers) 直接回复客户端，flow.tag(name) 为流添加标签，
+// flow.comment(text)、flow.star() 和 flow.mark(color) 设置备注、星标和标记颜色（见 flow.Markers）。
+// 脚本抛出异常时流被中止。同一脚本的调用串行执行。
+type JS struct {
+	hooks.Base
+
+	name string
+
+	mu         sync.Mutex
+	vm         *goja.Runtime
+	onRequest  goja.Callable
+	onResponse goja.Callable
+}
+
+// NewJS 编译并执行脚本，name 用于日志、错误信息和流的 Responder
+func NewJS(name, source string) (*JS, error) {
+	s := &JS{name: name, vm: goja.New()}
+	console := s.vm.NewObject()
+	_ = console.Set("log", s.log)
+	_ = s.vm.Set("console", console)
+
+	if err := s.run(func() error {
+		_, err := s.vm.RunScript(name, source)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("load script %s: %w", name, err)
+	}
+
+	s.onRequest, _ = goja.AssertFunction(s.vm.Get("onRequest"))
+	s.onResponse, _ = goja.AssertFunction(s.vm.Get("onResponse"))
+	if s.onRequest == nil && s.onResponse == nil {
+		return nil, fmt.Errorf("load script %s: neither onRequest nor onResponse is defined", name)
+	}
+	return s, nil
+}
+
+// String 返回脚本描述
+func (s *JS) String() string {
+	return "script " + s.name
+}
+
+// OnRequest 实现 hooks.Hook 接口
+func (s *JS) OnRequest(ctx context.Context, f *flow.Flow) (context.Context, error) {
+	if s.onRequest == nil || f.Request == nil {
+		return ctx, nil
+	}
+	return ctx, s.call(s.onRequest, "onRequest", f)
+}
+
+// OnResponse 实现 hooks.Hook 接口
+func (s *JS) OnResponse(_ context.Context, f *flow.Flow) error {
+	if s.onResponse == nil || f.Request == nil || f.Response == nil {
+		return nil
+	}
+	return s.call(s.onResponse, "onResponse", f)
+}
+
+// call 调用脚本函数并把修改写回流
+func (s *JS) call(fn goja.Callable, name string, f *flow.Flow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj := s.vm.NewObject()
+	_ = obj.Set("id", f.ID)
+	_ = obj.Set("clientAddr", f.ClientAddr)
+	_ = obj.Set("serverAddr", f.ServerAddr)
+	tags := make([]any, len(f.Tags))
+	for i, tag := range f.Tags {
+		tags[i] = tag
+	}
+	_ = obj.Set("tags", s.vm.NewArray(tags...))
+	_ = obj.Set("tag", func(tag string) { f.Tag(tag) })
+	_ = obj.Set("comment", func(text string) { f.Comment = text })
+	_ = obj.Set("star", func() { f.Starred = true })
+	_ = obj.Set("mark", func(color string) {
+		if err := f.Mark(color); err != nil {
+			panic(s.vm.NewGoError(err))
+		}
+	})
+	_ = obj.Set("respond", func(call goja.FunctionCall) goja.Value {
+		resp := s.vm.NewObject()
+		_ = resp.Set("status", call.Argument(0).ToInteger())
+		_ = resp.Set("body", "")
+		if body := call.Argument(1); !goja.IsUndefined(body) && !goja.IsNull(body) {
+			_ = resp.Set("body", body)
+		}
+		headers := call.Argument(2)
+		if goja.IsUndefined(headers) || goja.IsNull(headers) {
+			headers = s.vm.NewObject()
+		}
+		_ = resp.Set("headers", headers)
+		_ = obj.Set("response", resp)
+		return goja.Undefined()
+	})
+
+	reqBody := s.vm.ToValue(string(visibleBody(f.Request.Header, f.Request.Body)))
+	req := s.vm.NewObject()
+	_ = req.Set("method", f.Request.Method)
+	_ = req.Set("url", f.Request.URL)
+	_ = req.Set("host", f.Request.Host)
+	_ = req.Set("headers", s.headers(f.Request.Header))
+	_ = req.Set("body", reqBody)
+	_ = obj.Set("request", req)
+
+	var respBody goja.Value
+	var respObj *goja.Object
+	if f.Response != nil {
+		respBody = s.vm.ToValue(string(visibleBody(f.Response.Header, f.Response.Body)))
+		respObj = s.vm.NewObject()
+		_ = respObj.Set("status", f.Response.StatusCode)
+		_ = respObj.Set("headers", s.headers(f.Response.Header))
+		_ = respObj.Set("body", respBody)
+		_ = obj.Set("response", respObj)
+	} else {
+		_ = obj.Set("response", goja.Null())
+	}
+
+	if err := s.run(func() error {
+		_, err := fn(goja.Undefined(), obj)
+		return err
+	}); err != nil {
+		return fmt.Errorf("%s %s: %w", s, name, err)
+	}
+
+	// 写回请求
+	r := f.Request
+	r.Method = req.Get("method").String()
+	if host := req.Get("host").String(); host != r.Host {
+		r.Host = host
+	}
+	setURL(r, req.Get("url").String())
+	r.Header = s.header(req.Get("headers"))
+	if v := req.Get("body"); !v.StrictEquals(reqBody) {
+		setBody(&r.Header, &r.Body, s.bytes(v))
+	}
+
+	// 写回响应，onRequest 中设置的响应直接回复客户端
+	v := obj.Get("response")
+	if v == nil || goja.IsNull(v) || goja.IsUndefined(v) {
+		return nil
+	}
+	out := v.ToObject(s.vm)
+	if out != respObj || f.Response == nil {
+		f.Response = newResponse(int(out.Get("status").ToInteger()), s.header(out.Get("headers")), s.bytes(out.Get("body")))
+		f.Responder = s.String()
+		return nil
+	}
+	if status := int(out.Get("status").ToInteger()); status != f.Response.StatusCode {
+		f.Response.StatusCode = status
+		f.Response.Status = fmt.Sprintf("%d %s", status, http.StatusText(status))
+	}
+	f.Response.Header = s.header(out.Get("headers"))
+	if body := out.Get("body"); !body.StrictEquals(respBody) {
+		setBody(&f.Response.Header, &f.Response.Body, s.bytes(body))
+	}
+	return nil
+}
+
+// run 执行脚本代码，超过 callTimeout 时中断
+func (s *JS) run(fn func() error) error {
+	timer := time.AfterFunc(callTimeout, func() {
+		s.vm.Interrupt("script timed out")
+	})
+	defer func() {
+		timer.Stop()
+		s.vm.ClearInterrupt()
+	}()
+	return fn()
+}
+
+// headers 将头部转换为脚本对象，单值头部为字符串，多值头部为数组
+func (s *JS) headers(h http.Header) *goja.Object {
+	obj := s.vm.NewObject()
+	for name, values := range h {
+		if len(values) == 1 {
+			_ = obj.Set(name, values[0])
+		} else {
+			items := make([]any, len(values))
+			for i, v := range values {
+				items[i] = v
+			}
+			_ = obj.Set(name, s.vm.NewArray(items...))
+		}
+	}
+	return obj
+}
+
+// header 将脚本对象转换回头部
+func (s *JS) header(v goja.Value) http.Header {
+	h := http.Header{}
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return h
+	}
+	obj := v.ToObject(s.vm)
+	for _, name := range obj.Keys() {
+		value := obj.Get(name)
+		if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+			continue
+		}
+		if values, ok := value.Export().([]any); ok {
+			for _, item := range values {
+				h.Add(name, fmt.Sprint(item))
+			}
+			continue
+		}
+		h.Add(name, value.String())
+	}
+	return h
+}
+
+// bytes 将脚本中的内容转换为字节，支持字符串和 ArrayBuffer
+func (s *JS) bytes(v goja.Value) []byte {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	switch b := v.Export().(type) {
+	case goja.ArrayBuffer:
+		return append([]byte(nil), b.Bytes()...)
+	case []byte:
+		return append([]byte(nil), b...)
+	}
+	return []byte(v.String())
+}
+
+// log 实现 console.log
+func (s *JS) log(call goja.FunctionCall) goja.Value {
+	parts := make([]string, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		parts[i] = arg.String()
+	}
+	log.Printf("[%s] %s", s, strings.Join(parts, " "))
+	return goja.Undefined()
+}
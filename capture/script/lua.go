@@ -0,0 +1,276 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package script
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/hooks"
+)
+
+// Lua 基于gopher-lua的Lua脚本，实现 hooks.Hook，与 JS 提供相同的接口。
+//
+// 脚本可以定义全局函数 onRequest(flow) 和 onResponse(flow)（也可以写作 on_request 和 on_response）：
+//
+//	function onRequest(flow)
+//	  flow.request.headers["X-Debug"] = "1"
+//	  if flow.request.url:find("/health$") then flow.respond(200, "ok") end
+//	end
+//	function onResponse(flow)
+//	  if flow.response.status >= 500 then flow.tag("server-error") end
+//	end
+//
+// headers 的值为字符串或字符串数组，body 为解码后的内容，Lua 字符串可以保存二进制数据。
+// respond、tag、comment、star 和 mark 既可以用 "." 也可以用 ":" 调用。脚本出错时流被中止。同一脚本的调用串行执行。
+type Lua struct {
+	hooks.Base
+
+	name string
+
+	mu         sync.Mutex
+	state      *lua.LState
+	onRequest  *lua.LFunction
+	onResponse *lua.LFunction
+}
+
+// NewLua 编译并执行脚本，name 用于日志、错误信息和流的 Responder
+func NewLua(name, source string) (*Lua, error) {
+	s := &Lua{name: name, state: lua.NewState()}
+	s.state.SetGlobal("print", s.state.NewFunction(s.print))
+
+	if err := s.run(func() error {
+		return s.state.DoString(source)
+	}); err != nil {
+		s.state.Close()
+		return nil, fmt.Errorf("load script %s: %w", name, err)
+	}
+
+	s.onRequest = s.function("onRequest", "on_request")
+	s.onResponse = s.function("onResponse", "on_response")
+	if s.onRequest == nil && s.onResponse == nil {
+		s.state.Close()
+		return nil, fmt.Errorf("load script %s: neither onRequest nor onResponse is defined", name)
+	}
+	return s, nil
+}
+
+// String 返回脚本描述
+func (s *Lua) String() string {
+	return "script " + s.name
+}
+
+// Close 释放Lua虚拟机，之后的调用不做任何处理
+func (s *Lua) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Close()
+	return nil
+}
+
+// OnRequest 实现 hooks.Hook 接口
+func (s *Lua) OnRequest(ctx context.Context, f *flow.Flow) (context.Context, error) {
+	if s.onRequest == nil || f.Request == nil {
+		return ctx, nil
+	}
+	return ctx, s.call(s.onRequest, "onRequest", f)
+}
+
+// OnResponse 实现 hooks.Hook 接口
+func (s *Lua) OnResponse(_ context.Context, f *flow.Flow) error {
+	if s.onResponse == nil || f.Request == nil || f.Response == nil {
+		return nil
+	}
+	return s.call(s.onResponse, "onResponse", f)
+}
+
+// function 返回第一个已定义的全局函数
+func (s *Lua) function(names ...string) *lua.LFunction {
+	for _, name := range names {
+		if fn, ok := s.state.GetGlobal(name).(*lua.LFunction); ok {
+			return fn
+		}
+	}
+	return nil
+}
+
+// call 调用脚本函数并把修改写回流
+func (s *Lua) call(fn *lua.LFunction, name string, f *flow.Flow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state.IsClosed() {
+		return nil
+	}
+	L := s.state
+
+	obj := L.NewTable()
+	obj.RawSetString("id", lua.LString(f.ID))
+	obj.RawSetString("clientAddr", lua.LString(f.ClientAddr))
+	obj.RawSetString("serverAddr", lua.LString(f.ServerAddr))
+	tags := L.NewTable()
+	for _, tag := range f.Tags {
+		tags.Append(lua.LString(tag))
+	}
+	obj.RawSetString("tags", tags)
+
+	// args 返回函数参数的起始位置，兼容 flow:tag() 形式的调用
+	args := func(L *lua.LState) int {
+		if L.Get(1) == obj {
+			return 2
+		}
+		return 1
+	}
+	obj.RawSetString("tag", L.NewFunction(func(L *lua.LState) int {
+		f.Tag(L.CheckString(args(L)))
+		return 0
+	}))
+	obj.RawSetString("comment", L.NewFunction(func(L *lua.LState) int {
+		f.Comment = L.CheckString(args(L))
+		return 0
+	}))
+	obj.RawSetString("star", L.NewFunction(func(L *lua.LState) int {
+		f.Starred = true
+		return 0
+	}))
+	obj.RawSetString("mark", L.NewFunction(func(L *lua.LState) int {
+		i := args(L)
+		if err := f.Mark(L.CheckString(i)); err != nil {
+			L.ArgError(i, err.Error())
+		}
+		return 0
+	}))
+	obj.RawSetString("respond", L.NewFunction(func(L *lua.LState) int {
+		i := args(L)
+		resp := L.NewTable()
+		resp.RawSetString("status", lua.LNumber(L.OptInt(i, http.StatusOK)))
+		resp.RawSetString("body", lua.LString(L.OptString(i+1, "")))
+		resp.RawSetString("headers", L.OptTable(i+2, L.NewTable()))
+		obj.RawSetString("response", resp)
+		return 0
+	}))
+
+	req := L.NewTable()
+	req.RawSetString("method", lua.LString(f.Request.Method))
+	req.RawSetString("url", lua.LString(f.Request.URL))
+	req.RawSetString("host", lua.LString(f.Request.Host))
+	req.RawSetString("headers", s.headers(f.Request.Header))
+	reqBody := string(visibleBody(f.Request.Header, f.Request.Body))
+	req.RawSetString("body", lua.LString(reqBody))
+	obj.RawSetString("request", req)
+
+	var respBody string
+	var respObj *lua.LTable
+	if f.Response != nil {
+		respBody = string(visibleBody(f.Response.Header, f.Response.Body))
+		respObj = L.NewTable()
+		respObj.RawSetString("status", lua.LNumber(f.Response.StatusCode))
+		respObj.RawSetString("headers", s.headers(f.Response.Header))
+		respObj.RawSetString("body", lua.LString(respBody))
+		obj.RawSetString("response", respObj)
+	}
+
+	if err := s.run(func() error {
+		return L.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, obj)
+	}); err != nil {
+		return fmt.Errorf("%s %s: %w", s, name, err)
+	}
+
+	// 写回请求
+	r := f.Request
+	r.Method = lua.LVAsString(req.RawGetString("method"))
+	if host := lua.LVAsString(req.RawGetString("host")); host != r.Host {
+		r.Host = host
+	}
+	setURL(r, lua.LVAsString(req.RawGetString("url")))
+	r.Header = s.header(req.RawGetString("headers"))
+	if body := lua.LVAsString(req.RawGetString("body")); body != reqBody {
+		setBody(&r.Header, &r.Body, []byte(body))
+	}
+
+	// 写回响应，onRequest 中设置的响应直接回复客户端
+	out, ok := obj.RawGetString("response").(*lua.LTable)
+	if !ok {
+		return nil
+	}
+	status := int(lua.LVAsNumber(out.RawGetString("status")))
+	if out != respObj || f.Response == nil {
+		f.Response = newResponse(status, s.header(out.RawGetString("headers")), []byte(lua.LVAsString(out.RawGetString("body"))))
+		f.Responder = s.String()
+		return nil
+	}
+	if status != f.Response.StatusCode {
+		f.Response.StatusCode = status
+		f.Response.Status = fmt.Sprintf("%d %s", status, http.StatusText(status))
+	}
+	f.Response.Header = s.header(out.RawGetString("headers"))
+	if body := lua.LVAsString(out.RawGetString("body")); body != respBody {
+		setBody(&f.Response.Header, &f.Response.Body, []byte(body))
+	}
+	return nil
+}
+
+// run 执行脚本代码，超过 callTimeout 时中断
+func (s *Lua) run(fn func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	s.state.SetContext(ctx)
+	defer s.state.RemoveContext()
+	return fn()
+}
+
+// headers 将头部转换为Lua表，单值头部为字符串，多值头部为数组
+func (s *Lua) headers(h http.Header) *lua.LTable {
+	t := s.state.NewTable()
+	for name, values := range h {
+		if len(values) == 1 {
+			t.RawSetString(name, lua.LString(values[0]))
+			continue
+		}
+		list := s.state.NewTable()
+		for _, v := range values {
+			list.Append(lua.LString(v))
+		}
+		t.RawSetString(name, list)
+	}
+	return t
+}
+
+// header 将Lua表转换回头部
+func (s *Lua) header(v lua.LValue) http.Header {
+	h := http.Header{}
+	t, ok := v.(*lua.LTable)
+	if !ok {
+		return h
+	}
+	t.ForEach(func(key, value lua.LValue) {
+		name := lua.LVAsString(key)
+		if list, ok := value.(*lua.LTable); ok {
+			for i := 1; i <= list.Len(); i++ {
+				h.Add(name, lua.LVAsString(list.RawGetInt(i)))
+			}
+			return
+		}
+		h.Add(name, lua.LVAsString(value))
+	})
+	return h
+}
+
+// print 将 print 的输出写入日志
+func (s *Lua) print(L *lua.LState) int {
+	parts := make([]string, L.GetTop())
+	for i := range parts {
+		parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+	}
+	log.Printf("[%s] %s", s, strings.Join(parts, "\t"))
+	return 0
+}
@@ -0,0 +1,97 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package script
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/hooks"
+)
+
+// callTimeout 单次脚本调用的最长执行时间，超时后中断脚本并中止流
+const callTimeout = 5 * time.Second
+
+// ErrUnsupportedScript 无法识别的脚本类型
+var ErrUnsupportedScript = errors.New("unsupported script type")
+
+// Load 按扩展名加载脚本文件，.js 使用JavaScript引擎，.lua 使用Lua引擎，.wasm 作为WebAssembly插件加载
+func Load(path string) (hooks.Hook, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read script: %w", err)
+	}
+	name := filepath.Base(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".js", ".mjs":
+		return NewJS(name, string(src))
+	case ".lua":
+		return NewLua(name, string(src))
+	case ".wasm":
+		return NewWASM(name, src)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedScript, path)
+	}
+}
+
+// visibleBody 返回脚本看到的内容：按 Content-Encoding 解码，无法解码时为原始内容
+func visibleBody(header http.Header, body []byte) []byte {
+	decoded, _, err := flow.DecodeBody(header, body)
+	if err != nil {
+		return body
+	}
+	return decoded
+}
+
+// setBody 写回脚本修改后的内容，内容已解码因此移除 Content-Encoding
+func setBody(header *http.Header, body *[]byte, out []byte) {
+	if *header == nil {
+		*header = http.Header{}
+	}
+	header.Del("Content-Encoding")
+	if header.Get("Content-Length") != "" {
+		header.Set("Content-Length", strconv.Itoa(len(out)))
+	}
+	*body = out
+}
+
+// setURL 写回脚本修改后的URL，主机变化时同步 Host
+func setURL(r *flow.Request, rawURL string) {
+	if rawURL == r.URL {
+		return
+	}
+	if old, err := url.Parse(r.URL); err == nil {
+		if u, err := url.Parse(rawURL); err == nil && u.Host != "" && u.Host != old.Host {
+			r.Host = u.Host
+		}
+	}
+	r.URL = rawURL
+}
+
+// newResponse 创建脚本生成的本地响应
+func newResponse(status int, header http.Header, body []byte) *flow.Response {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	return &flow.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:      "HTTP/1.1",
+		Header:     header,
+		Body:       body,
+	}
+}
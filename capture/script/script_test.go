@@ -0,0 +1,228 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package script
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/hooks"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func testFlow(url string) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{
+		Method: "GET",
+		URL:    url,
+		Host:   "api.example.com",
+		Header: http.Header{"Accept": {"*/*"}, "Cookie": {"a=1", "b=2"}},
+	}
+	return f
+}
+
+func upstreamResponse(f *flow.Flow, status int, body string) {
+	f.Response = newResponse(status, http.Header{"Content-Type": {"application/json"}}, []byte(body))
+}
+
+// --- 测试代码 ---
+func TestJS_Request(t *testing.T) {
+	s, err := NewJS("test.js", `
+		function onRequest(flow) {
+			var req = flow.request;
+			req.headers["X-Debug"] = "1";
+			delete req.headers["Accept"];
+			if (req.headers["Cookie"].length !== 2) throw new Error("cookies");
+			if (req.url.indexOf("/v1/") >= 0) req.url = req.url.replace("/v1/", "/v2/");
+			if (req.url.endsWith("/health")) flow.respond(204, "", {"X-Mock": "yes"});
+			flow.tag("seen");
+		}`)
+	require.NoError(t, err)
+
+	f := testFlow("https://api.example.com/v1/items")
+	_, err = s.OnRequest(context.Background(), f)
+	require.NoError(t, err)
+	require.Equal(t, "https://api.example.com/v2/items", f.Request.URL)
+	require.Equal(t, "1", f.Request.Header.Get("X-Debug"))
+	require.Empty(t, f.Request.Header.Get("Accept"))
+	require.Equal(t, []string{"a=1", "b=2"}, f.Request.Header.Values("Cookie"))
+	require.Equal(t, []string{"seen"}, f.Tags)
+	require.Nil(t, f.Response)
+
+	f = testFlow("https://api.example.com/health")
+	_, err = s.OnRequest(context.Background(), f)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, f.Response.StatusCode)
+	require.Equal(t, "yes", f.Response.Header.Get("X-Mock"))
+	require.Equal(t, "script test.js", f.Responder)
+}
+
+func TestJS_Response(t *testing.T) {
+	s, err := NewJS("test.js", `
+		function onResponse(flow) {
+			if (flow.response.status >= 500) {
+				flow.tag("server-error");
+				flow.response.status = 503;
+			}
+			var data = JSON.parse(flow.response.body);
+			if (data.secret) {
+				data.secret = "***";
+				flow.response.body = JSON.stringify(data);
+			}
+		}`)
+	require.NoError(t, err)
+
+	// 未修改的内容保持原样
+	f := testFlow("https://api.example.com/")
+	upstreamResponse(f, http.StatusOK, `{"a": 1}`)
+	require.NoError(t, s.OnResponse(context.Background(), f))
+	require.Equal(t, `{"a": 1}`, string(f.Response.Body))
+	require.Empty(t, f.Tags)
+
+	// 压缩内容以解码后的文本呈现，修改后写回明文
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, _ = w.Write([]byte(`{"secret":"hunter2"}`))
+	require.NoError(t, w.Close())
+	f = testFlow("https://api.example.com/")
+	upstreamResponse(f, http.StatusInternalServerError, "")
+	f.Response.Header.Set("Content-Encoding", "gzip")
+	f.Response.Header.Set("Content-Length", "99")
+	f.Response.Body = gz.Bytes()
+	require.NoError(t, s.OnResponse(context.Background(), f))
+	require.Equal(t, `{"secret":"***"}`, string(f.Response.Body))
+	require.Empty(t, f.Response.Header.Get("Content-Encoding"))
+	require.Equal(t, "16", f.Response.Header.Get("Content-Length"))
+	require.Equal(t, "503 Service Unavailable", f.Response.Status)
+	require.Equal(t, []string{"server-error"}, f.Tags)
+}
+
+func TestJS_Errors(t *testing.T) {
+	_, err := NewJS("empty.js", `var x = 1;`)
+	require.Error(t, err)
+
+	_, err = NewJS("syntax.js", `function onRequest(flow) {`)
+	require.Error(t, err)
+
+	s, err := NewJS("throw.js", `function onRequest(flow) { throw new Error("denied"); }`)
+	require.NoError(t, err)
+	_, err = s.OnRequest(context.Background(), testFlow("http://example.com/"))
+	require.ErrorContains(t, err, "denied")
+
+	// 没有定义的阶段不做任何处理
+	require.NoError(t, s.OnResponse(context.Background(), testFlow("http://example.com/")))
+}
+
+func TestJS_Annotations(t *testing.T) {
+	s, err := NewJS("annotate.js", `
+		function onResponse(flow) {
+			if (flow.response.status >= 500) {
+				flow.star();
+				flow.mark("red");
+				flow.comment("upstream failed");
+			}
+			if (flow.response.status === 418) flow.mark("pink");
+		}`)
+	require.NoError(t, err)
+
+	f := testFlow("https://api.example.com/")
+	upstreamResponse(f, http.StatusBadGateway, "")
+	require.NoError(t, s.OnResponse(context.Background(), f))
+	require.True(t, f.Starred)
+	require.Equal(t, "red", f.Marker)
+	require.Equal(t, "upstream failed", f.Comment)
+
+	upstreamResponse(f, http.StatusTeapot, "")
+	require.ErrorContains(t, s.OnResponse(context.Background(), f), "invalid marker")
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tag.js")
+	require.NoError(t, os.WriteFile(path, []byte(`function onRequest(flow) { flow.tag(flow.request.method); }`), 0o600))
+
+	h, err := Load(path)
+	require.NoError(t, err)
+	chain := hooks.NewChain(h)
+	f := testFlow("http://example.com/")
+	_, err = chain.Request(context.Background(), f)
+	require.NoError(t, err)
+	require.Equal(t, []string{"GET"}, f.Tags)
+
+	_, err = Load(filepath.Join(dir, "x.txt"))
+	require.Error(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "x.txt"), nil, 0o600))
+	_, err = Load(filepath.Join(dir, "x.txt"))
+	require.ErrorIs(t, err, ErrUnsupportedScript)
+}
+
+func TestLua(t *testing.T) {
+	s, err := NewLua("test.lua", `
+		function on_request(flow)
+			local req = flow.request
+			req.headers["X-Debug"] = "1"
+			req.headers["Accept"] = nil
+			if #req.headers["Cookie"] ~= 2 then error("cookies") end
+			req.url = req.url:gsub("/v1/", "/v2/")
+			if req.url:find("/health$") then flow:respond(204, "", {["X-Mock"] = "yes"}) end
+			flow.tag("seen")
+		end
+		function onResponse(flow)
+			if flow.response.status >= 500 then
+				flow:tag("server-error")
+				flow:star()
+				flow.mark("orange")
+				flow:comment("retry later")
+				flow.response.status = 503
+				flow.response.body = "unavailable"
+			end
+		end`)
+	require.NoError(t, err)
+
+	f := testFlow("https://api.example.com/v1/items")
+	_, err = s.OnRequest(context.Background(), f)
+	require.NoError(t, err)
+	require.Equal(t, "https://api.example.com/v2/items", f.Request.URL)
+	require.Equal(t, "1", f.Request.Header.Get("X-Debug"))
+	require.Empty(t, f.Request.Header.Get("Accept"))
+	require.Equal(t, []string{"a=1", "b=2"}, f.Request.Header.Values("Cookie"))
+	require.Equal(t, []string{"seen"}, f.Tags)
+	require.Nil(t, f.Response)
+
+	upstreamResponse(f, http.StatusOK, "\x00\xff")
+	require.NoError(t, s.OnResponse(context.Background(), f))
+	require.Equal(t, "\x00\xff", string(f.Response.Body))
+
+	upstreamResponse(f, http.StatusBadGateway, "")
+	require.NoError(t, s.OnResponse(context.Background(), f))
+	require.Equal(t, "503 Service Unavailable", f.Response.Status)
+	require.Equal(t, "unavailable", string(f.Response.Body))
+	require.Equal(t, []string{"seen", "server-error"}, f.Tags)
+	require.True(t, f.Starred)
+	require.Equal(t, "orange", f.Marker)
+	require.Equal(t, "retry later", f.Comment)
+
+	f = testFlow("https://api.example.com/health")
+	_, err = s.OnRequest(context.Background(), f)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, f.Response.StatusCode)
+	require.Equal(t, "yes", f.Response.Header.Get("X-Mock"))
+	require.Equal(t, "script test.lua", f.Responder)
+
+	_, err = NewLua("empty.lua", `x = 1`)
+	require.Error(t, err)
+	s, err = NewLua("throw.lua", `function onRequest(flow) error("denied") end`)
+	require.NoError(t, err)
+	_, err = s.OnRequest(context.Background(), testFlow("http://example.com/"))
+	require.ErrorContains(t, err, "denied")
+}
@@ -0,0 +1,345 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/hooks"
+)
+
+// WASM 在沙箱中运行的WebAssembly插件，实现 hooks.Hook。
+//
+// 插件使用sniffy自定义的ABI，数据以JSON交换：
+//
+//   - 导出 memory 和 sniffy_alloc(size i32) i32，宿主通过后者申请内存写入输入；
+//     可选导出 sniffy_free(ptr i32, size i32)，输入使用完后由宿主调用
+//   - 导出 on_request(ptr i32, len i32) i64 和/或 on_response(ptr i32, len i32) i64，
+//     输入为 wasmFlow 的JSON，返回值高32位为输出地址、低32位为输出长度，0 表示不修改
+//   - 输出为 wasmPatch 的JSON，只有出现的字段会写回流；on_request 返回 response 时直接回复客户端
+//   - 可以导入 sniffy.log(ptr i32, len i32) 输出日志
+//
+// 插件实例化时调用 _initialize（WASI reactor），可以使用WASI但无法访问文件系统和网络。
+// 单次调用超时后插件实例被关闭，下一条流会重新实例化。同一插件的调用串行执行。
+type WASM struct {
+	hooks.Base
+
+	name string
+
+	mu       sync.Mutex
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	module   api.Module
+}
+
+// wasmFlow 传给插件的流
+type wasmFlow struct {
+	ID         string       `json:"id"`
+	ClientAddr string       `json:"client_addr"`
+	ServerAddr string       `json:"server_addr,omitempty"`
+	Tags       []string     `json:"tags,omitempty"`
+	Comment    string       `json:"comment,omitempty"`
+	Starred    bool         `json:"starred,omitempty"`
+	Marker     string       `json:"marker,omitempty"`
+	Request    *wasmMessage `json:"request"`
+	Response   *wasmMessage `json:"response,omitempty"`
+}
+
+// wasmMessage 传给插件的请求或响应，body 为解码后的内容（JSON中为base64）
+type wasmMessage struct {
+	Method  string      `json:"method,omitempty"`
+	URL     string      `json:"url,omitempty"`
+	Host    string      `json:"host,omitempty"`
+	Status  int         `json:"status,omitempty"`
+	Headers http.Header `json:"headers"`
+	Body    []byte      `json:"body"`
+}
+
+// wasmPatch 插件返回的修改，nil 字段保持不变
+type wasmPatch struct {
+	Request  *wasmMessagePatch `json:"request"`
+	Response *wasmMessagePatch `json:"response"`
+	Tags     []string          `json:"tags"`
+	Comment  *string           `json:"comment"`
+	Starred  *bool             `json:"starred"`
+	Marker   *string           `json:"marker"`
+}
+
+// wasmMessagePatch 对请求或响应的修改，Headers 给出时整体替换
+type wasmMessagePatch struct {
+	Method  *string     `json:"method"`
+	URL     *string     `json:"url"`
+	Host    *string     `json:"host"`
+	Status  *int        `json:"status"`
+	Headers http.Header `json:"headers"`
+	Body    *[]byte     `json:"body"`
+}
+
+// NewWASM 编译并实例化插件，name 用于日志、错误信息和流的 Responder
+func NewWASM(name string, code []byte) (*WASM, error) {
+	ctx := context.Background()
+	s := &WASM{
+		name:    name,
+		runtime: wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true)),
+	}
+	if err := s.init(ctx, code); err != nil {
+		s.runtime.Close(ctx)
+		return nil, fmt.Errorf("load script %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// init 注册宿主函数、编译并实例化插件
+func (s *WASM) init(ctx context.Context, code []byte) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, s.runtime); err != nil {
+		return err
+	}
+	_, err := s.runtime.NewHostModuleBuilder("sniffy").
+		NewFunctionBuilder().WithFunc(s.log).Export("log").
+		Instantiate(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.compiled, err = s.runtime.CompileModule(ctx, code)
+	if err != nil {
+		return err
+	}
+	exports := s.compiled.ExportedFunctions()
+	if exports["sniffy_alloc"] == nil {
+		return errors.New("sniffy_alloc is not exported")
+	}
+	if exports["on_request"] == nil && exports["on_response"] == nil {
+		return errors.New("neither on_request nor on_response is exported")
+	}
+	_, err = s.instance(ctx)
+	return err
+}
+
+// String 返回插件描述
+func (s *WASM) String() string {
+	return "script " + s.name
+}
+
+// Close 释放插件运行时，之后的调用返回错误
+func (s *WASM) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runtime.Close(context.Background())
+}
+
+// OnRequest 实现 hooks.Hook 接口
+func (s *WASM) OnRequest(ctx context.Context, f *flow.Flow) (context.Context, error) {
+	if f.Request == nil {
+		return ctx, nil
+	}
+	return ctx, s.call("on_request", f)
+}
+
+// OnResponse 实现 hooks.Hook 接口
+func (s *WASM) OnResponse(_ context.Context, f *flow.Flow) error {
+	if f.Request == nil || f.Response == nil {
+		return nil
+	}
+	return s.call("on_response", f)
+}
+
+// instance 返回插件实例，超时关闭后重新实例化
+func (s *WASM) instance(ctx context.Context) (api.Module, error) {
+	if s.module != nil && !s.module.IsClosed() {
+		return s.module, nil
+	}
+	mod, err := s.runtime.InstantiateModule(ctx, s.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, err
+	}
+	if mod.Memory() == nil {
+		mod.Close(ctx)
+		return nil, errors.New("memory is not exported")
+	}
+	s.module = mod
+	return mod, nil
+}
+
+// call 调用插件函数并把返回的修改写回流
+func (s *WASM) call(name string, f *flow.Flow) error {
+	if s.compiled.ExportedFunctions()[name] == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	input, err := json.Marshal(wasmFlowOf(f))
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", s, name, err)
+	}
+	output, err := s.invoke(name, input)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", s, name, err)
+	}
+	if len(output) == 0 {
+		return nil
+	}
+	var patch wasmPatch
+	if err := json.Unmarshal(output, &patch); err != nil {
+		return fmt.Errorf("%s %s: invalid output: %w", s, name, err)
+	}
+	if err := s.apply(f, &patch); err != nil {
+		return fmt.Errorf("%s %s: %w", s, name, err)
+	}
+	return nil
+}
+
+// invoke 将输入写入插件内存并调用函数，返回插件输出的副本
+func (s *WASM) invoke(name string, input []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	mod, err := s.instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := mod.ExportedFunction("sniffy_alloc").Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if !mod.Memory().Write(ptr, input) {
+		return nil, fmt.Errorf("sniffy_alloc returned out of range pointer %d", ptr)
+	}
+	res, err = mod.ExportedFunction(name).Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	if free := mod.ExportedFunction("sniffy_free"); free != nil {
+		if _, err := free.Call(ctx, uint64(ptr), uint64(len(input))); err != nil {
+			return nil, err
+		}
+	}
+
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	if outLen == 0 {
+		return nil, nil
+	}
+	out, ok := mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("output out of range (%d+%d)", outPtr, outLen)
+	}
+	return append([]byte(nil), out...), nil
+}
+
+// apply 将插件返回的修改写回流
+func (s *WASM) apply(f *flow.Flow, patch *wasmPatch) error {
+	for _, tag := range patch.Tags {
+		f.Tag(tag)
+	}
+	if patch.Comment != nil {
+		f.Comment = *patch.Comment
+	}
+	if patch.Starred != nil {
+		f.Starred = *patch.Starred
+	}
+	if patch.Marker != nil {
+		if err := f.Mark(*patch.Marker); err != nil {
+			return err
+		}
+	}
+	if p := patch.Request; p != nil {
+		r := f.Request
+		if p.Method != nil {
+			r.Method = *p.Method
+		}
+		if p.Host != nil {
+			r.Host = *p.Host
+		}
+		if p.URL != nil {
+			setURL(r, *p.URL)
+		}
+		if p.Headers != nil {
+			r.Header = p.Headers
+		}
+		if p.Body != nil {
+			setBody(&r.Header, &r.Body, *p.Body)
+		}
+	}
+
+	p := patch.Response
+	if p == nil {
+		return nil
+	}
+	if f.Response == nil {
+		status := 0
+		if p.Status != nil {
+			status = *p.Status
+		}
+		var body []byte
+		if p.Body != nil {
+			body = *p.Body
+		}
+		f.Response = newResponse(status, p.Headers, body)
+		f.Responder = s.String()
+		return nil
+	}
+	if p.Status != nil && *p.Status != f.Response.StatusCode {
+		f.Response.StatusCode = *p.Status
+		f.Response.Status = fmt.Sprintf("%d %s", *p.Status, http.StatusText(*p.Status))
+	}
+	if p.Headers != nil {
+		f.Response.Header = p.Headers
+	}
+	if p.Body != nil {
+		setBody(&f.Response.Header, &f.Response.Body, *p.Body)
+	}
+	return nil
+}
+
+// log 实现 sniffy.log 宿主函数
+func (s *WASM) log(_ context.Context, mod api.Module, ptr, size uint32) {
+	if msg, ok := mod.Memory().Read(ptr, size); ok {
+		log.Printf("[%s] %s", s, msg)
+	}
+}
+
+// wasmFlowOf 返回传给插件的流
+func wasmFlowOf(f *flow.Flow) *wasmFlow {
+	out := &wasmFlow{
+		ID:         f.ID,
+		ClientAddr: f.ClientAddr,
+		ServerAddr: f.ServerAddr,
+		Tags:       f.Tags,
+		Comment:    f.Comment,
+		Starred:    f.Starred,
+		Marker:     f.Marker,
+		Request: &wasmMessage{
+			Method:  f.Request.Method,
+			URL:     f.Request.URL,
+			Host:    f.Request.Host,
+			Headers: f.Request.Header,
+			Body:    visibleBody(f.Request.Header, f.Request.Body),
+		},
+	}
+	if f.Response != nil {
+		out.Response = &wasmMessage{
+			Status:  f.Response.StatusCode,
+			Headers: f.Response.Header,
+			Body:    visibleBody(f.Response.Header, f.Response.Body),
+		}
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package script
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func uleb(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if v == 0 {
+			return out
+		}
+	}
+}
+
+func sleb(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func vec(items ...[]byte) []byte {
+	out := uleb(uint64(len(items)))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func name(s string) []byte {
+	return append(uleb(uint64(len(s))), s...)
+}
+
+func section(id byte, content []byte) []byte {
+	return append(append([]byte{id}, uleb(uint64(len(content)))...), content...)
+}
+
+func body(code ...byte) []byte {
+	fn := append([]byte{0x00}, code...)
+	return append(uleb(uint64(len(fn))), fn...)
+}
+
+func packed(ptr, size int) []byte {
+	return append([]byte{0x42}, sleb(int64(ptr)<<32|int64(size))...)
+}
+
+// testModule 构造一个返回固定修改的插件：on_request 返回 reqPatch 并调用 sniffy.log，
+// on_response 返回 respPatch
+func testModule(reqPatch, respPatch string) []byte {
+	const reqAt, respAt = 1024, 8192
+	i32, i64 := byte(0x7f), byte(0x7e)
+
+	logCall := append(append([]byte{0x41}, sleb(reqAt)...), 0x41)
+	logCall = append(append(logCall, sleb(int64(len(reqPatch)))...), 0x10, 0x00)
+
+	m := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	m = append(m, section(1, vec(
+		[]byte{0x60, 1, i32, 1, i32},
+		[]byte{0x60, 2, i32, i32, 1, i64},
+		[]byte{0x60, 2, i32, i32, 0},
+	))...)
+	m = append(m, section(2, vec(append(append(name("sniffy"), name("log")...), 0x00, 2)))...)
+	m = append(m, section(3, vec([]byte{0}, []byte{1}, []byte{1}))...)
+	m = append(m, section(5, vec([]byte{0x00, 1}))...)
+	m = append(m, section(7, vec(
+		append(name("memory"), 2, 0),
+		append(name("sniffy_alloc"), 0, 1),
+		append(name("on_request"), 0, 2),
+		append(name("on_response"), 0, 3),
+	))...)
+	m = append(m, section(10, vec(
+		body(append(append([]byte{0x41}, sleb(16384)...), 0x0b)...),
+		body(append(append(logCall, packed(reqAt, len(reqPatch))...), 0x0b)...),
+		body(append(packed(respAt, len(respPatch)), 0x0b)...),
+	))...)
+	m = append(m, section(11, vec(
+		append(append(append([]byte{0x00, 0x41}, sleb(reqAt)...), 0x0b), name(reqPatch)...),
+		append(append(append([]byte{0x00, 0x41}, sleb(respAt)...), 0x0b), name(respPatch)...),
+	))...)
+	return m
+}
+
+// --- 测试代码 ---
+func TestWASM(t *testing.T) {
+	s, err := NewWASM("test.wasm", testModule(
+		`{"request":{"url":"https://api.example.com/v2/items","headers":{"X-Wasm":["1"]}},"tags":["wasm"]}`,
+		`{"response":{"status":503,"body":"dW5hdmFpbGFibGU="},"starred":true,"marker":"red","comment":"outage"}`,
+	))
+	require.NoError(t, err)
+
+	f := testFlow("https://api.example.com/v1/items")
+	_, err = s.OnRequest(context.Background(), f)
+	require.NoError(t, err)
+	require.Equal(t, "https://api.example.com/v2/items", f.Request.URL)
+	require.Equal(t, http.Header{"X-Wasm": {"1"}}, f.Request.Header)
+	require.Equal(t, []string{"wasm"}, f.Tags)
+	require.Nil(t, f.Response)
+
+	upstreamResponse(f, http.StatusOK, "ok")
+	require.NoError(t, s.OnResponse(context.Background(), f))
+	require.Equal(t, "503 Service Unavailable", f.Response.Status)
+	require.Equal(t, "unavailable", string(f.Response.Body))
+	require.Equal(t, "application/json", f.Response.Header.Get("Content-Type"))
+	require.True(t, f.Starred)
+	require.Equal(t, "red", f.Marker)
+	require.Equal(t, "outage", f.Comment)
+
+	// 实例被关闭后重新实例化
+	require.NoError(t, s.module.Close(context.Background()))
+	f = testFlow("https://api.example.com/v1/items")
+	_, err = s.OnRequest(context.Background(), f)
+	require.NoError(t, err)
+	require.Equal(t, []string{"wasm"}, f.Tags)
+}
+
+func TestWASM_Respond(t *testing.T) {
+	s, err := NewWASM("mock.wasm", testModule(`{"response":{"status":204,"headers":{"X-Mock":["yes"]}}}`, ``))
+	require.NoError(t, err)
+
+	f := testFlow("https://api.example.com/health")
+	_, err = s.OnRequest(context.Background(), f)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, f.Response.StatusCode)
+	require.Equal(t, "yes", f.Response.Header.Get("X-Mock"))
+	require.Equal(t, "script mock.wasm", f.Responder)
+
+	// 返回长度为0表示不修改
+	require.NoError(t, s.OnResponse(context.Background(), f))
+	require.Equal(t, http.StatusNoContent, f.Response.StatusCode)
+}
+
+func TestWASM_Invalid(t *testing.T) {
+	_, err := NewWASM("garbage.wasm", []byte("not wasm"))
+	require.Error(t, err)
+
+	s, err := NewWASM("bad.wasm", testModule(`{not json`, ``))
+	require.NoError(t, err)
+	_, err = s.OnRequest(context.Background(), testFlow("http://example.com/"))
+	require.ErrorContains(t, err, "invalid output")
+}
@@ -0,0 +1,138 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Keys 加密捕获文件使用的接收者和读取时使用的身份。为nil时文件不加密
+type Keys struct {
+	// Recipients 加密时的接收者
+	Recipients []Recipient
+
+	// Identities 解密时尝试的身份
+	Identities []Identity
+}
+
+// ParseIdentities 解析 age 身份文件，每行一个 "AGE-SECRET-KEY-1..." 私钥，忽略空行和 # 开头的注释
+func ParseIdentities(data []byte) ([]Identity, error) {
+	var ids []Identity
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		id, err := ParseX25519Identity(s)
+		if err != nil {
+			return nil, fmt.Errorf("identity file line %d: %w", line, err)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("no identities found")
+	}
+	return ids, scanner.Err()
+}
+
+// Enabled 判断是否加密写入的文件
+func (k *Keys) Enabled() bool {
+	return k != nil && len(k.Recipients) > 0
+}
+
+// Seal 加密 data
+func (k *Keys) Seal(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, k.Recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unseal 解密 Seal 加密的内容
+func (k *Keys) Unseal(data []byte) ([]byte, error) {
+	if k == nil {
+		return nil, errors.New("no identities specified")
+	}
+	r, err := Decrypt(bytes.NewReader(data), k.Identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// Create 创建或截断文件，启用加密时写入的内容被加密，Close 同时关闭文件
+func (k *Keys) Create(path string) (io.WriteCloser, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if !k.Enabled() {
+		return file, nil
+	}
+	w, err := Encrypt(file, k.Recipients...)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &sealedFile{WriteCloser: w, file: file}, nil
+}
+
+// Open 打开文件，加密的文件用 Identities 解密，未加密的文件原样读取
+func (k *Keys) Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(file)
+	if !IsEncrypted(br) {
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, file}, nil
+	}
+	if k == nil || len(k.Identities) == 0 {
+		file.Close()
+		return nil, fmt.Errorf("%s is encrypted, a passphrase or identity is required", path)
+	}
+	r, err := Decrypt(br, k.Identities...)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("decrypt %s: %w", path, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, file}, nil
+}
+
+// sealedFile 关闭时先写入最后一个数据块再关闭文件
+type sealedFile struct {
+	io.WriteCloser
+	file *os.File
+}
+
+func (f *sealedFile) Close() error {
+	err := f.WriteCloser.Close()
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
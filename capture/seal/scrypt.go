@@ -0,0 +1,101 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package seal
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	scryptType  = "scrypt"
+	scryptLabel = "age-encryption.org/v1/scrypt"
+	saltSize    = 16
+
+	// DefaultWorkFactor 默认的scrypt参数 log2(N)，与 age 一致，派生密钥约需1秒和256MB内存
+	DefaultWorkFactor = 18
+
+	// maxWorkFactor 解密时接受的最大 log2(N)，防止恶意文件耗尽资源
+	maxWorkFactor = 22
+)
+
+// Passphrase 口令，既是接收者也是身份。口令加密的文件不能再有其他接收者
+type Passphrase struct {
+	password []byte
+
+	// WorkFactor 加密时使用的 log2(N)，0 表示 DefaultWorkFactor
+	WorkFactor int
+}
+
+// NewPassphrase 创建口令接收者
+func NewPassphrase(password string) (*Passphrase, error) {
+	if password == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	return &Passphrase{password: []byte(password)}, nil
+}
+
+// Wrap 实现 Recipient 接口
+func (p *Passphrase) Wrap(fileKey []byte) (*Stanza, error) {
+	logN := p.WorkFactor
+	if logN == 0 {
+		logN = DefaultWorkFactor
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := p.derive(salt, logN)
+	if err != nil {
+		return nil, err
+	}
+	body, err := aeadWrap(key, fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Stanza{Type: scryptType, Args: []string{b64.EncodeToString(salt), strconv.Itoa(logN)}, Body: body}, nil
+}
+
+// Unwrap 实现 Identity 接口
+func (p *Passphrase) Unwrap(stanzas []*Stanza) ([]byte, error) {
+	for _, s := range stanzas {
+		if s.Type != scryptType {
+			continue
+		}
+		if len(s.Args) != 2 {
+			return nil, errors.New("invalid scrypt stanza")
+		}
+		salt, err := b64.Strict().DecodeString(s.Args[0])
+		if err != nil || len(salt) != saltSize {
+			return nil, errors.New("invalid scrypt stanza")
+		}
+		logN, err := strconv.Atoi(s.Args[1])
+		if err != nil || logN <= 0 || s.Args[1] != strconv.Itoa(logN) {
+			return nil, errors.New("invalid scrypt work factor")
+		}
+		if logN > maxWorkFactor {
+			return nil, fmt.Errorf("scrypt work factor %d too large", logN)
+		}
+		key, err := p.derive(salt, logN)
+		if err != nil {
+			return nil, err
+		}
+		fileKey, err := aeadUnwrap(key, s.Body)
+		if errors.Is(err, ErrNoIdentity) {
+			return nil, errors.New("incorrect passphrase")
+		}
+		return fileKey, err
+	}
+	return nil, ErrNoIdentity
+}
+
+func (p *Passphrase) derive(salt []byte, logN int) ([]byte, error) {
+	return scrypt.Key(p.password, append([]byte(scryptLabel), salt...), 1<<logN, 8, 1, 32)
+}
@@ -0,0 +1,413 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// 文件格式与 age v1（https://age-encryption.org/v1）兼容，可以用 age 或 rage 命令行工具解密
+
+const (
+	intro      = "age-encryption.org/v1\n"
+	stanzaMark = "-> "
+	footerMark = "---"
+
+	fileKeySize = 16
+	nonceSize   = 16
+	chunkSize   = 64 << 10
+	columns     = 64
+
+	// maxHeaderSize 读取头部的上限，防止不受信任的输入占用过多内存
+	maxHeaderSize = 64 << 10
+)
+
+var b64 = base64.RawStdEncoding
+
+// ErrNoIdentity 没有能解密文件的身份
+var ErrNoIdentity = errors.New("no identity matched any of the file's recipients")
+
+// ErrNotEncrypted 内容不是加密文件
+var ErrNotEncrypted = errors.New("not an encrypted file")
+
+// Stanza 头部中为一个接收者包装的文件密钥
+type Stanza struct {
+	// Type 接收者类型，例如 X25519 或 scrypt
+	Type string
+
+	// Args 类型相关的参数
+	Args []string
+
+	// Body 包装后的文件密钥
+	Body []byte
+}
+
+// Recipient 加密文件的接收者，为每个文件随机生成的文件密钥生成 Stanza
+type Recipient interface {
+	Wrap(fileKey []byte) (*Stanza, error)
+}
+
+// Identity 解密文件的身份，不匹配时 Unwrap 返回 ErrNoIdentity
+type Identity interface {
+	Unwrap(stanzas []*Stanza) ([]byte, error)
+}
+
+// Encrypt 返回加密后写入 dst 的 Writer，必须调用 Close 写入最后一个数据块，Close 不关闭 dst
+func Encrypt(dst io.Writer, recipients ...Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients specified")
+	}
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+
+	var stanzas []*Stanza
+	for _, r := range recipients {
+		s, err := r.Wrap(fileKey)
+		if err != nil {
+			return nil, fmt.Errorf("wrap file key: %w", err)
+		}
+		stanzas = append(stanzas, s)
+	}
+	if len(stanzas) > 1 {
+		for _, s := range stanzas {
+			if s.Type == scryptType {
+				return nil, errors.New("a passphrase cannot be combined with other recipients")
+			}
+		}
+	}
+
+	var header bytes.Buffer
+	header.WriteString(intro)
+	for _, s := range stanzas {
+		writeStanza(&header, s)
+	}
+	header.WriteString(footerMark)
+	mac := hmac.New(sha256.New, hkdfKey(fileKey, nil, "header"))
+	mac.Write(header.Bytes())
+	header.WriteString(" " + b64.EncodeToString(mac.Sum(nil)) + "\n")
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header.Write(nonce)
+	if _, err := dst.Write(header.Bytes()); err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(hkdfKey(fileKey, nonce, "payload"))
+	if err != nil {
+		return nil, err
+	}
+	return &writer{dst: dst, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+// Decrypt 返回解密 src 的 Reader，使用第一个匹配的身份。数据块在读出前校验，篡改的内容返回错误
+func Decrypt(src io.Reader, identities ...Identity) (io.Reader, error) {
+	if len(identities) == 0 {
+		return nil, errors.New("no identities specified")
+	}
+	br := bufio.NewReader(src)
+	stanzas, header, mac, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stanzas {
+		if s.Type == scryptType && len(stanzas) != 1 {
+			return nil, errors.New("scrypt stanza must be alone in the header")
+		}
+	}
+
+	var fileKey []byte
+	for _, id := range identities {
+		fileKey, err = id.Unwrap(stanzas)
+		if errors.Is(err, ErrNoIdentity) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if fileKey == nil {
+		return nil, ErrNoIdentity
+	}
+
+	h := hmac.New(sha256.New, hkdfKey(fileKey, nil, "header"))
+	h.Write(header)
+	if !hmac.Equal(h.Sum(nil), mac) {
+		return nil, errors.New("header MAC mismatch")
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(br, nonce); err != nil {
+		return nil, fmt.Errorf("read payload nonce: %w", unexpectedEOF(err))
+	}
+	aead, err := chacha20poly1305.New(hkdfKey(fileKey, nonce, "payload"))
+	if err != nil {
+		return nil, err
+	}
+	return &reader{src: br, aead: aead, buf: make([]byte, chunkSize+chacha20poly1305.Overhead)}, nil
+}
+
+// IsEncrypted 判断内容是否以加密文件的头部开始，不消耗 r 中的数据
+func IsEncrypted(r *bufio.Reader) bool {
+	b, _ := r.Peek(len(intro))
+	return string(b) == intro
+}
+
+// writeStanza 写入一个 Stanza，内容按64列换行，最后一行总是短于64列
+func writeStanza(w *bytes.Buffer, s *Stanza) {
+	w.WriteString(stanzaMark + s.Type)
+	for _, arg := range s.Args {
+		w.WriteString(" " + arg)
+	}
+	w.WriteByte('\n')
+	body := b64.EncodeToString(s.Body)
+	for len(body) >= columns {
+		w.WriteString(body[:columns] + "\n")
+		body = body[columns:]
+	}
+	w.WriteString(body + "\n")
+}
+
+// readHeader 读取头部，返回 Stanza、参与MAC计算的头部内容和MAC
+func readHeader(br *bufio.Reader) (stanzas []*Stanza, header, mac []byte, err error) {
+	var raw bytes.Buffer
+	line, err := readLine(br, &raw)
+	if err != nil || line+"\n" != intro {
+		return nil, nil, nil, ErrNotEncrypted
+	}
+	for {
+		line, err := readLine(br, &raw)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("read header: %w", err)
+		}
+		if rest, ok := strings.CutPrefix(line, footerMark+" "); ok {
+			mac, err := b64.Strict().DecodeString(rest)
+			if err != nil || len(mac) != sha256.Size {
+				return nil, nil, nil, errors.New("malformed header MAC")
+			}
+			header := raw.Bytes()[:raw.Len()-len(line)-1+len(footerMark)]
+			return stanzas, header, mac, nil
+		}
+		spec, ok := strings.CutPrefix(line, stanzaMark)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("malformed header line %q", line)
+		}
+		fields := strings.Split(spec, " ")
+		s := &Stanza{Type: fields[0], Args: fields[1:]}
+		if s.Type == "" {
+			return nil, nil, nil, errors.New("malformed stanza")
+		}
+		for {
+			line, err := readLine(br, &raw)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("read stanza: %w", err)
+			}
+			chunk, err := b64.Strict().DecodeString(line)
+			if err != nil || len(line) > columns {
+				return nil, nil, nil, errors.New("malformed stanza body")
+			}
+			s.Body = append(s.Body, chunk...)
+			if len(line) < columns {
+				break
+			}
+		}
+		stanzas = append(stanzas, s)
+	}
+}
+
+// readLine 读取一行并追加到 raw，返回不含换行符的内容
+func readLine(br *bufio.Reader, raw *bytes.Buffer) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	if raw.Len()+len(line) > maxHeaderSize {
+		return "", errors.New("header too large")
+	}
+	raw.WriteString(line)
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// hkdfKey 用HKDF-SHA256从 secret 派生32字节的密钥
+func hkdfKey(secret, salt []byte, info string) []byte {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		panic("hkdf: " + err.Error())
+	}
+	return key
+}
+
+// aeadWrap 用一次性密钥加密文件密钥，nonce 为全零
+func aeadWrap(key, fileKey []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), fileKey, nil), nil
+}
+
+// aeadUnwrap 解密 aeadWrap 包装的文件密钥，密钥不匹配时返回 ErrNoIdentity
+func aeadUnwrap(key, body []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) != fileKeySize+chacha20poly1305.Overhead {
+		return nil, errors.New("invalid stanza body size")
+	}
+	fileKey, err := aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), body, nil)
+	if err != nil {
+		return nil, ErrNoIdentity
+	}
+	return fileKey, nil
+}
+
+// chunkNonce 返回第 counter 个数据块的nonce，最后一个数据块的末字节为1
+func chunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	for i := 10; i >= 3; i-- {
+		nonce[i] = byte(counter)
+		counter >>= 8
+	}
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// writer 按64KiB分块加密。写满的数据块暂不输出，直到确定后面还有数据或 Close 时作为最后一块输出
+type writer struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+	err     error
+}
+
+// Write 实现 io.Writer 接口
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(w.buf) == chunkSize {
+			if err := w.flush(false); err != nil {
+				return n, err
+			}
+		}
+		k := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+k]
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+// Close 输出最后一个数据块
+func (w *writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	err := w.flush(true)
+	if err == nil {
+		w.err = errors.New("write to closed encrypted writer")
+	}
+	return err
+}
+
+func (w *writer) flush(last bool) error {
+	if w.counter == 1<<64-1 {
+		w.err = errors.New("encrypted stream too long")
+		return w.err
+	}
+	out := w.aead.Seal(nil, chunkNonce(w.counter, last), w.buf, nil)
+	if _, err := w.dst.Write(out); err != nil {
+		w.err = err
+		return err
+	}
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// reader 逐块解密，只有最后一块带有结束标记时才返回 io.EOF，截断的文件返回错误
+type reader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	buf     []byte
+	plain   []byte
+	counter uint64
+	done    bool
+	err     error
+}
+
+// Read 实现 io.Reader 接口
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next 读取并解密下一个数据块
+func (r *reader) next() error {
+	n, err := io.ReadFull(r.src, r.buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return errors.New("encrypted stream truncated")
+		}
+		return err
+	}
+	last := n < len(r.buf)
+	if !last {
+		if _, err := r.src.Peek(1); err == io.EOF {
+			last = true
+		}
+	}
+	if n < r.aead.Overhead() || (n == r.aead.Overhead() && r.counter > 0) {
+		return errors.New("encrypted stream truncated or malformed")
+	}
+	plain, err := r.aead.Open(r.buf[:0], chunkNonce(r.counter, last), r.buf[:n], nil)
+	if err != nil {
+		return errors.New("failed to decrypt and authenticate payload chunk")
+	}
+	r.counter++
+	r.plain = plain
+	r.done = last
+	return nil
+}
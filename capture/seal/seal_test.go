@@ -0,0 +1,212 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// testPassphrase 返回低强度的口令，避免测试耗时
+func testPassphrase(t *testing.T, password string) *Passphrase {
+	t.Helper()
+	p, err := NewPassphrase(password)
+	require.NoError(t, err)
+	p.WorkFactor = 10
+	return p
+}
+
+func sealData(t *testing.T, data []byte, recipients ...Recipient) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, recipients...)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func openData(data []byte, identities ...Identity) ([]byte, error) {
+	r, err := Decrypt(bytes.NewReader(data), identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func bufioReader(data []byte) *bufio.Reader {
+	return bufio.NewReader(bytes.NewReader(data))
+}
+
+// --- 测试代码 ---
+
+func TestX25519_Keys(t *testing.T) {
+	// age 测试向量中的密钥
+	id, err := ParseX25519Identity("AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX")
+	require.NoError(t, err)
+	require.Equal(t, "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj", id.Recipient().String())
+	require.Equal(t, "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX", id.String())
+
+	r, err := ParseX25519Recipient(id.Recipient().String())
+	require.NoError(t, err)
+	require.Equal(t, id.Recipient(), r)
+
+	for _, s := range []string{"", "age1", "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwq", "Age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj"} {
+		_, err := ParseX25519Recipient(s)
+		require.Error(t, err, s)
+	}
+	_, err = ParseX25519Identity(id.Recipient().String())
+	require.Error(t, err)
+}
+
+func TestEncrypt_RoundTrip(t *testing.T) {
+	id, err := GenerateX25519Identity()
+	require.NoError(t, err)
+	other, err := GenerateX25519Identity()
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3 * chunkSize} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		sealed := sealData(t, data, other.Recipient(), id.Recipient())
+		got, err := openData(sealed, id)
+		require.NoError(t, err, size)
+		require.Equal(t, data, got, size)
+
+		pass := testPassphrase(t, "correct horse")
+		got, err = openData(sealData(t, data, pass), pass)
+		require.NoError(t, err, size)
+		require.Equal(t, data, got, size)
+	}
+}
+
+func TestEncrypt_Header(t *testing.T) {
+	id, err := GenerateX25519Identity()
+	require.NoError(t, err)
+	sealed := sealData(t, []byte("hello"), id.Recipient())
+
+	lines := strings.SplitN(string(sealed), "\n", 5)
+	require.Equal(t, "age-encryption.org/v1", lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "-> X25519 "))
+	require.Len(t, lines[2], 43)
+	require.True(t, strings.HasPrefix(lines[3], "--- "))
+
+	br := bufioReader(sealed)
+	require.True(t, IsEncrypted(br))
+	require.False(t, IsEncrypted(bufioReader([]byte("plain"))))
+
+	// 口令不能和其他接收者一起使用
+	_, err = Encrypt(io.Discard, testPassphrase(t, "x"), id.Recipient())
+	require.Error(t, err)
+	_, err = Encrypt(io.Discard)
+	require.Error(t, err)
+}
+
+func TestDecrypt_Errors(t *testing.T) {
+	id, err := GenerateX25519Identity()
+	require.NoError(t, err)
+	other, err := GenerateX25519Identity()
+	require.NoError(t, err)
+	data := bytes.Repeat([]byte("secret "), chunkSize/3)
+	sealed := sealData(t, data, id.Recipient())
+
+	_, err = openData(sealed, other)
+	require.ErrorIs(t, err, ErrNoIdentity)
+
+	_, err = openData([]byte("not encrypted"), id)
+	require.ErrorIs(t, err, ErrNotEncrypted)
+
+	// 篡改头部、内容或截断文件都被发现
+	tampered := bytes.Clone(sealed)
+	tampered[30] ^= 1
+	_, err = openData(tampered, id)
+	require.Error(t, err)
+
+	tampered = bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	_, err = openData(tampered, id)
+	require.Error(t, err)
+
+	_, err = openData(sealed[:len(sealed)-chunkSize/2], id)
+	require.Error(t, err)
+
+	// 截断在数据块边界
+	headerLen := bytes.Index(sealed, []byte("\n---")) + 1
+	headerLen += bytes.IndexByte(sealed[headerLen:], '\n') + 1 + nonceSize
+	_, err = openData(sealed[:headerLen+chunkSize+16], id)
+	require.Error(t, err)
+
+	pass := testPassphrase(t, "right")
+	_, err = openData(sealData(t, data, pass), testPassphrase(t, "wrong"))
+	require.ErrorContains(t, err, "incorrect passphrase")
+}
+
+func TestKeys_Files(t *testing.T) {
+	dir := t.TempDir()
+	pass := testPassphrase(t, "pw")
+	keys := &Keys{Recipients: []Recipient{pass}, Identities: []Identity{pass}}
+
+	path := filepath.Join(dir, "sealed")
+	w, err := keys.Create(path)
+	require.NoError(t, err)
+	io.WriteString(w, "flows")
+	require.NoError(t, w.Close())
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "flows")
+
+	r, err := keys.Open(path)
+	require.NoError(t, err)
+	got, _ := io.ReadAll(r)
+	require.NoError(t, r.Close())
+	require.Equal(t, "flows", string(got))
+
+	// 未启用加密时原样读写，加密的文件需要身份
+	var none *Keys
+	plain := filepath.Join(dir, "plain")
+	w, err = none.Create(plain)
+	require.NoError(t, err)
+	io.WriteString(w, "flows")
+	require.NoError(t, w.Close())
+	r, err = keys.Open(plain)
+	require.NoError(t, err)
+	got, _ = io.ReadAll(r)
+	r.Close()
+	require.Equal(t, "flows", string(got))
+	_, err = none.Open(path)
+	require.ErrorContains(t, err, "is encrypted")
+
+	sealed, err := keys.Seal([]byte("key"))
+	require.NoError(t, err)
+	unsealed, err := keys.Unseal(sealed)
+	require.NoError(t, err)
+	require.Equal(t, "key", string(unsealed))
+}
+
+func TestParseIdentities(t *testing.T) {
+	id, err := GenerateX25519Identity()
+	require.NoError(t, err)
+	ids, err := ParseIdentities([]byte("# created: 2025\n# public key: " + id.Recipient().String() + "\n" + id.String() + "\n\n"))
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+
+	_, err = ParseIdentities([]byte("# empty\n"))
+	require.Error(t, err)
+	_, err = ParseIdentities([]byte("AGE-SECRET-KEY-1XYZ\n"))
+	require.ErrorContains(t, err, "line 1")
+}
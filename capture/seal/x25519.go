@@ -0,0 +1,239 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package seal
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	x25519Type  = "X25519"
+	x25519Label = "age-encryption.org/v1/X25519"
+
+	recipientHRP = "age"
+	identityHRP  = "AGE-SECRET-KEY-"
+)
+
+// X25519Recipient age 公钥接收者，字符串形式为 "age1..."
+type X25519Recipient struct {
+	key []byte
+}
+
+// ParseX25519Recipient 解析 "age1..." 形式的公钥
+func ParseX25519Recipient(s string) (*X25519Recipient, error) {
+	hrp, key, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed recipient %q: %w", s, err)
+	}
+	if hrp != recipientHRP || len(key) != curve25519.PointSize {
+		return nil, fmt.Errorf("malformed recipient %q", s)
+	}
+	return &X25519Recipient{key: key}, nil
+}
+
+// Wrap 实现 Recipient 接口
+func (r *X25519Recipient) Wrap(fileKey []byte) (*Stanza, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(ephemeral); err != nil {
+		return nil, err
+	}
+	share, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := curve25519.X25519(ephemeral, r.key)
+	if err != nil {
+		return nil, err
+	}
+	body, err := aeadWrap(hkdfKey(shared, append(share[:len(share):len(share)], r.key...), x25519Label), fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Stanza{Type: x25519Type, Args: []string{b64.EncodeToString(share)}, Body: body}, nil
+}
+
+// String 返回 "age1..." 形式的公钥
+func (r *X25519Recipient) String() string {
+	return bech32Encode(recipientHRP, r.key)
+}
+
+// X25519Identity age 私钥身份，字符串形式为 "AGE-SECRET-KEY-1..."
+type X25519Identity struct {
+	secret    []byte
+	recipient []byte
+}
+
+// GenerateX25519Identity 生成随机的私钥
+func GenerateX25519Identity() (*X25519Identity, error) {
+	secret := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return newX25519Identity(secret)
+}
+
+// ParseX25519Identity 解析 "AGE-SECRET-KEY-1..." 形式的私钥
+func ParseX25519Identity(s string) (*X25519Identity, error) {
+	hrp, secret, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed secret key: %w", err)
+	}
+	if hrp != identityHRP || len(secret) != curve25519.ScalarSize {
+		return nil, errors.New("malformed secret key")
+	}
+	return newX25519Identity(secret)
+}
+
+func newX25519Identity(secret []byte) (*X25519Identity, error) {
+	recipient, err := curve25519.X25519(secret, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &X25519Identity{secret: secret, recipient: recipient}, nil
+}
+
+// Recipient 返回对应的公钥
+func (i *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{key: i.recipient}
+}
+
+// Unwrap 实现 Identity 接口
+func (i *X25519Identity) Unwrap(stanzas []*Stanza) ([]byte, error) {
+	for _, s := range stanzas {
+		if s.Type != x25519Type {
+			continue
+		}
+		if len(s.Args) != 1 {
+			return nil, errors.New("invalid X25519 stanza")
+		}
+		share, err := b64.Strict().DecodeString(s.Args[0])
+		if err != nil || len(share) != curve25519.PointSize {
+			return nil, errors.New("invalid X25519 stanza")
+		}
+		shared, err := curve25519.X25519(i.secret, share)
+		if err != nil {
+			return nil, fmt.Errorf("invalid X25519 stanza: %w", err)
+		}
+		fileKey, err := aeadUnwrap(hkdfKey(shared, append(share, i.recipient...), x25519Label), s.Body)
+		if errors.Is(err, ErrNoIdentity) {
+			continue
+		}
+		return fileKey, err
+	}
+	return nil, ErrNoIdentity
+}
+
+// String 返回 "AGE-SECRET-KEY-1..." 形式的私钥
+func (i *X25519Identity) String() string {
+	return strings.ToUpper(bech32Encode(identityHRP, i.secret))
+}
+
+// bech32 编码，见 BIP 173
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := range 5 {
+			if (top>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := range len(hrp) {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := range len(hrp) {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// convertBits 在不同位宽之间重新分组
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	var out []byte
+	maxv := uint32(1)<<to - 1
+	for _, v := range data {
+		if uint32(v)>>from != 0 {
+			return nil, errors.New("invalid data range")
+		}
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
+
+// bech32Encode 编码，结果为小写，不限制长度
+func bech32Encode(hrp string, data []byte) string {
+	hrp = strings.ToLower(hrp)
+	values, _ := convertBits(data, 8, 5, true)
+	chk := bech32Polymod(append(append(bech32HRPExpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	var b strings.Builder
+	b.WriteString(hrp + "1")
+	for _, v := range values {
+		b.WriteByte(bech32Charset[v])
+	}
+	for i := range 6 {
+		b.WriteByte(bech32Charset[(chk>>(5*(5-i)))&31])
+	}
+	return b.String()
+}
+
+// bech32Decode 解码，返回的 hrp 保持输入的大小写，不接受大小写混合
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case")
+	}
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("separator '1' at invalid position")
+	}
+	hrp, lower := s[:pos], strings.ToLower(s)
+	var values []byte
+	for i := pos + 1; i < len(lower); i++ {
+		v := strings.IndexByte(bech32Charset, lower[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid character %q", lower[i])
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(strings.ToLower(hrp)), values...)) != 1 {
+		return "", nil, errors.New("invalid checksum")
+	}
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
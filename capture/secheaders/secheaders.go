@@ -0,0 +1,339 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package secheaders
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/cookies"
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// Severity 问题的严重程度
+type Severity string
+
+const (
+	// SeverityHigh 可被直接利用的配置，例如携带凭据时允许任意来源
+	SeverityHigh Severity = "high"
+
+	// SeverityMedium 缺少重要的防护
+	SeverityMedium Severity = "medium"
+
+	// SeverityLow 防护较弱或不完整
+	SeverityLow Severity = "low"
+
+	// SeverityInfo 建议改进的配置
+	SeverityInfo Severity = "info"
+)
+
+// rank 严重程度的排序，数值越小越严重
+func (s Severity) rank() int {
+	switch s {
+	case SeverityHigh:
+		return 0
+	case SeverityMedium:
+		return 1
+	case SeverityLow:
+		return 2
+	}
+	return 3
+}
+
+// 检查项，即 Finding.Check 的取值
+const (
+	CheckTransport   = "transport"
+	CheckHSTS        = "hsts"
+	CheckCSP         = "csp"
+	CheckContentType = "x-content-type-options"
+	CheckCookie      = "cookie"
+	CheckCORS        = "cors"
+)
+
+// minHSTSAge HSTS max-age 的推荐下限（180天）
+const minHSTSAge = 180 * 24 * 60 * 60
+
+// Finding 一个主机上同一问题的汇总
+type Finding struct {
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+
+	// Flows 存在该问题的响应数
+	Flows int `json:"flows"`
+
+	// Example 存在该问题的第一个流的ID
+	Example string `json:"example_flow"`
+}
+
+// Host 一个主机的检查结果
+type Host struct {
+	Host string `json:"host"`
+
+	// Responses 检查的响应数
+	Responses int `json:"responses"`
+
+	// Findings 发现的问题，按严重程度和检查项排序
+	Findings []*Finding `json:"findings"`
+}
+
+// Report 按主机汇总的安全头部检查结果
+type Report struct {
+	Generated time.Time `json:"generated"`
+	Hosts     []*Host   `json:"hosts"`
+}
+
+// Analyze 检查流的响应中的 HSTS、CSP、X-Content-Type-Options、Cookie 属性和 CORS 配置，
+// 没有响应的流被忽略。主机按名称排序
+func Analyze(flows []*flow.Flow) *Report {
+	byHost := map[string]*host{}
+	for _, f := range flows {
+		if f.Request == nil || f.Response == nil {
+			continue
+		}
+		name, secure := target(f.Request)
+		h := byHost[name]
+		if h == nil {
+			h = &host{Host: &Host{Host: name, Findings: []*Finding{}}, index: map[[2]string]*Finding{}, origins: map[string]bool{}}
+			byHost[name] = h
+		}
+		h.Responses++
+		h.check(f, secure)
+	}
+
+	report := &Report{Generated: time.Now().UTC(), Hosts: make([]*Host, 0, len(byHost))}
+	for _, h := range byHost {
+		// 多个来源都被原样返回说明服务器接受任意来源
+		if len(h.origins) > 1 {
+			message := fmt.Sprintf("reflects arbitrary origins (%d seen) with credentials allowed", len(h.origins))
+			for _, f := range h.reflected {
+				h.add(f, CheckCORS, SeverityHigh, message)
+			}
+		}
+		slices.SortFunc(h.Findings, func(a, b *Finding) int {
+			return cmp.Or(cmp.Compare(a.Severity.rank(), b.Severity.rank()), cmp.Compare(a.Check, b.Check), cmp.Compare(a.Message, b.Message))
+		})
+		report.Hosts = append(report.Hosts, h.Host)
+	}
+	slices.SortFunc(report.Hosts, func(a, b *Host) int { return cmp.Compare(a.Host, b.Host) })
+	return report
+}
+
+// host 检查中的主机，index 合并相同的问题，origins 和 reflected 记录允许凭据时原样返回的 Origin 和所在的流
+type host struct {
+	*Host
+	index     map[[2]string]*Finding
+	origins   map[string]bool
+	reflected []*flow.Flow
+}
+
+// add 记录问题
+func (h *host) add(f *flow.Flow, check string, severity Severity, message string) {
+	key := [2]string{check, message}
+	finding := h.index[key]
+	if finding == nil {
+		finding = &Finding{Check: check, Severity: severity, Message: message}
+		h.index[key] = finding
+		h.Findings = append(h.Findings, finding)
+	}
+	finding.Flows++
+	if finding.Example == "" {
+		finding.Example = f.ID
+	}
+}
+
+// check 检查一个响应
+func (h *host) check(f *flow.Flow, secure bool) {
+	header := f.Response.Header
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	html := mediaType == "text/html" || mediaType == "application/xhtml+xml"
+
+	if !secure {
+		h.add(f, CheckTransport, SeverityMedium, "served over plain HTTP")
+	} else {
+		h.hsts(f, header.Get("Strict-Transport-Security"))
+	}
+	if html {
+		h.csp(f, header.Get("Content-Security-Policy"), header.Get("Content-Security-Policy-Report-Only"))
+	}
+	if f.Response.BodyLen() > 0 || header.Get("Content-Type") != "" {
+		switch v := header.Get("X-Content-Type-Options"); {
+		case v == "":
+			h.add(f, CheckContentType, SeverityLow, "missing X-Content-Type-Options: nosniff")
+		case !strings.EqualFold(strings.TrimSpace(v), "nosniff"):
+			h.add(f, CheckContentType, SeverityLow, fmt.Sprintf("invalid X-Content-Type-Options %q", v))
+		}
+	}
+	h.cookies(f, secure)
+	h.cors(f)
+}
+
+// hsts 检查 Strict-Transport-Security
+func (h *host) hsts(f *flow.Flow, v string) {
+	if v == "" {
+		h.add(f, CheckHSTS, SeverityMedium, "missing Strict-Transport-Security")
+		return
+	}
+	age := -1
+	subdomains := false
+	for _, d := range strings.Split(v, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+		switch strings.ToLower(name) {
+		case "max-age":
+			if n, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil {
+				age = n
+			}
+		case "includesubdomains":
+			subdomains = true
+		}
+	}
+	switch {
+	case age < 0:
+		h.add(f, CheckHSTS, SeverityMedium, "Strict-Transport-Security without a valid max-age")
+	case age == 0:
+		h.add(f, CheckHSTS, SeverityMedium, "Strict-Transport-Security max-age=0 disables HSTS")
+	case age < minHSTSAge:
+		h.add(f, CheckHSTS, SeverityLow, fmt.Sprintf("Strict-Transport-Security max-age=%d is shorter than 180 days", age))
+	}
+	if age > 0 && !subdomains {
+		h.add(f, CheckHSTS, SeverityInfo, "Strict-Transport-Security without includeSubDomains")
+	}
+}
+
+// csp 检查HTML响应的 Content-Security-Policy
+func (h *host) csp(f *flow.Flow, policy, reportOnly string) {
+	if policy == "" {
+		if reportOnly != "" {
+			h.add(f, CheckCSP, SeverityLow, "Content-Security-Policy is report-only")
+		} else {
+			h.add(f, CheckCSP, SeverityMedium, "missing Content-Security-Policy")
+		}
+		return
+	}
+	directives := map[string][]string{}
+	for _, d := range strings.Split(policy, ";") {
+		fields := strings.Fields(strings.ToLower(d))
+		if len(fields) > 0 {
+			directives[fields[0]] = fields[1:]
+		}
+	}
+	script, ok := directives["script-src"]
+	name := "script-src"
+	if !ok {
+		script, ok = directives["default-src"]
+		name = "default-src"
+	}
+	if !ok {
+		h.add(f, CheckCSP, SeverityMedium, "Content-Security-Policy does not restrict scripts (no script-src or default-src)")
+	}
+	for _, source := range script {
+		switch source {
+		case "'unsafe-inline'", "'unsafe-eval'":
+			h.add(f, CheckCSP, SeverityLow, fmt.Sprintf("Content-Security-Policy %s allows %s", name, source))
+		case "*", "http:", "https:", "data:":
+			h.add(f, CheckCSP, SeverityLow, fmt.Sprintf("Content-Security-Policy %s allows any source %s", name, source))
+		}
+	}
+	if _, ok := directives["frame-ancestors"]; !ok && f.Response.Header.Get("X-Frame-Options") == "" {
+		h.add(f, CheckCSP, SeverityLow, "neither frame-ancestors nor X-Frame-Options restricts framing")
+	}
+}
+
+// cookies 检查 Set-Cookie 的 Secure、HttpOnly 和 SameSite 属性，删除Cookie的响应不检查
+func (h *host) cookies(f *flow.Flow, secure bool) {
+	for _, c := range cookies.Response(f.Response) {
+		if c.MaxAge < 0 {
+			continue
+		}
+		if secure && !c.Secure {
+			h.add(f, CheckCookie, SeverityMedium, fmt.Sprintf("cookie %s set without Secure", c.Name))
+		}
+		if !c.HttpOnly && cookies.IsSessionName(c.Name) {
+			h.add(f, CheckCookie, SeverityMedium, fmt.Sprintf("session cookie %s set without HttpOnly", c.Name))
+		}
+		switch {
+		case c.SameSite == http.SameSiteNoneMode && !c.Secure:
+			h.add(f, CheckCookie, SeverityMedium, fmt.Sprintf("cookie %s has SameSite=None without Secure", c.Name))
+		case c.SameSite == 0:
+			h.add(f, CheckCookie, SeverityInfo, fmt.Sprintf("cookie %s set without SameSite", c.Name))
+		}
+	}
+}
+
+// cors 检查 Access-Control-Allow-Origin 和 Access-Control-Allow-Credentials
+func (h *host) cors(f *flow.Flow) {
+	allow := strings.TrimSpace(f.Response.Header.Get("Access-Control-Allow-Origin"))
+	if allow == "" {
+		return
+	}
+	credentials := strings.EqualFold(strings.TrimSpace(f.Response.Header.Get("Access-Control-Allow-Credentials")), "true")
+	origin := f.Request.Header.Get("Origin")
+	switch {
+	case allow == "*" && credentials:
+		h.add(f, CheckCORS, SeverityMedium, "Access-Control-Allow-Origin * with credentials allowed")
+	case allow == "*":
+		h.add(f, CheckCORS, SeverityInfo, "Access-Control-Allow-Origin * allows any origin")
+	case allow == "null":
+		h.add(f, CheckCORS, SeverityMedium, "Access-Control-Allow-Origin null can be sent by sandboxed documents")
+	case credentials && allow == origin:
+		h.origins[origin] = true
+		h.reflected = append(h.reflected, f)
+	}
+	// 按请求的 Origin 返回时，缺少 Vary 会让共享缓存把一个来源的响应返回给其他来源
+	if allow == origin && !strings.Contains(strings.ToLower(f.Response.Header.Get("Vary")), "origin") {
+		h.add(f, CheckCORS, SeverityLow, "Access-Control-Allow-Origin echoes Origin without Vary: Origin")
+	}
+}
+
+// target 返回请求的主机名（不含端口）以及是否为HTTPS
+func target(req *flow.Request) (string, bool) {
+	name := req.Host
+	secure := false
+	if u, err := url.Parse(req.URL); err == nil {
+		if u.Host != "" {
+			name = u.Host
+		}
+		secure = u.Scheme == "https" || u.Scheme == "wss"
+	}
+	if h, _, err := net.SplitHostPort(name); err == nil {
+		name = h
+	}
+	return strings.ToLower(name), secure
+}
+
+// htmlReport HTML报告的模板
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Security headers report</title>
+<style>
+body { font: 14px system-ui, sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.high { color: #b00; font-weight: bold; } .medium { color: #c60; } .low { color: #880; } .info { color: #666; }
+</style></head><body>
+<h1>Security headers report</h1>
+<p>Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}</p>
+{{range .Hosts}}<h2>{{.Host}}</h2>
+<p>{{.Responses}} responses, {{len .Findings}} findings</p>
+{{if .Findings}}<table><tr><th>Severity</th><th>Check</th><th>Finding</th><th>Flows</th><th>Example</th></tr>
+{{range .Findings}}<tr><td class="{{.Severity}}">{{.Severity}}</td><td>{{.Check}}</td><td>{{.Message}}</td><td>{{.Flows}}</td><td>{{.Example}}</td></tr>
+{{end}}</table>{{end}}
+{{end}}</body></html>
+`))
+
+// WriteHTML 以HTML页面的形式输出报告
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlReport.Execute(w, r)
+}
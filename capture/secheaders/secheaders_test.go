@@ -0,0 +1,136 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package secheaders
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+func newFlow(rawURL string, reqHeader, respHeader http.Header) *flow.Flow {
+	f := flow.New()
+	if reqHeader == nil {
+		reqHeader = http.Header{}
+	}
+	f.Request = &flow.Request{Method: "GET", URL: rawURL, Header: reqHeader}
+	f.Response = &flow.Response{StatusCode: 200, Header: respHeader, Body: []byte("<html></html>")}
+	return f
+}
+
+// messages 返回主机的问题，键为 "检查项: 说明"，值为严重程度
+func messages(h *Host) map[string]Severity {
+	out := map[string]Severity{}
+	for _, f := range h.Findings {
+		out[f.Check+": "+f.Message] = f.Severity
+	}
+	return out
+}
+
+// finding 返回说明为 message 的问题
+func finding(h *Host, message string) *Finding {
+	for _, f := range h.Findings {
+		if f.Message == message {
+			return f
+		}
+	}
+	return nil
+}
+
+// --- 测试代码 ---
+
+func TestAnalyze_Secure(t *testing.T) {
+	f := newFlow("https://good.example.com/", nil, http.Header{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Strict-Transport-Security": {"max-age=31536000; includeSubDomains"},
+		"Content-Security-Policy":   {"default-src 'self'; frame-ancestors 'none'"},
+		"X-Content-Type-Options":    {"nosniff"},
+		"Set-Cookie":                {"sid=1; Secure; HttpOnly; SameSite=Lax"},
+	})
+	report := Analyze([]*flow.Flow{f, {ID: "pending", Request: f.Request}})
+	require.Len(t, report.Hosts, 1)
+	require.Equal(t, "good.example.com", report.Hosts[0].Host)
+	require.Equal(t, 1, report.Hosts[0].Responses)
+	require.Empty(t, report.Hosts[0].Findings)
+}
+
+func TestAnalyze_Findings(t *testing.T) {
+	weak := newFlow("https://app.example.com:8443/login", nil, http.Header{
+		"Content-Type":              {"text/html"},
+		"Strict-Transport-Security": {"max-age=3600"},
+		"Content-Security-Policy":   {"script-src 'self' 'unsafe-inline'"},
+		"X-Content-Type-Options":    {"sniff"},
+		"Set-Cookie":                {"session_id=abc; Path=/", "pref=dark; SameSite=None; Secure"},
+	})
+	missing := newFlow("https://app.example.com/api", nil, http.Header{"Content-Type": {"application/json"}})
+	plain := newFlow("http://legacy.example.com/", nil, http.Header{"Content-Type": {"text/html"}, "X-Content-Type-Options": {"nosniff"}})
+
+	report := Analyze([]*flow.Flow{weak, missing, plain})
+	require.Len(t, report.Hosts, 2)
+	app := report.Hosts[0]
+	require.Equal(t, "app.example.com", app.Host)
+	require.Equal(t, 2, app.Responses)
+	require.Equal(t, map[string]Severity{
+		"hsts: missing Strict-Transport-Security":                               SeverityMedium,
+		"hsts: Strict-Transport-Security max-age=3600 is shorter than 180 days": SeverityLow,
+		"hsts: Strict-Transport-Security without includeSubDomains":             SeverityInfo,
+		"csp: Content-Security-Policy script-src allows 'unsafe-inline'":        SeverityLow,
+		"csp: neither frame-ancestors nor X-Frame-Options restricts framing":    SeverityLow,
+		`x-content-type-options: invalid X-Content-Type-Options "sniff"`:        SeverityLow,
+		"x-content-type-options: missing X-Content-Type-Options: nosniff":       SeverityLow,
+		"cookie: cookie session_id set without Secure":                          SeverityMedium,
+		"cookie: session cookie session_id set without HttpOnly":                SeverityMedium,
+		"cookie: cookie session_id set without SameSite":                        SeverityInfo,
+	}, messages(app))
+	require.Equal(t, SeverityMedium, app.Findings[0].Severity)
+	require.Equal(t, SeverityInfo, app.Findings[len(app.Findings)-1].Severity)
+	require.Equal(t, missing.ID, finding(app, "missing Strict-Transport-Security").Example)
+
+	legacy := report.Hosts[1]
+	require.Equal(t, map[string]Severity{
+		"transport: served over plain HTTP":    SeverityMedium,
+		"csp: missing Content-Security-Policy": SeverityMedium,
+	}, messages(legacy))
+}
+
+func TestAnalyze_CORS(t *testing.T) {
+	cors := func(origin, allow string, credentials bool) *flow.Flow {
+		resp := http.Header{"X-Content-Type-Options": {"nosniff"}, "Strict-Transport-Security": {"max-age=31536000; includeSubDomains"}, "Access-Control-Allow-Origin": {allow}}
+		if credentials {
+			resp.Set("Access-Control-Allow-Credentials", "true")
+		}
+		return newFlow("https://api.example.com/data", http.Header{"Origin": {origin}}, resp)
+	}
+	report := Analyze([]*flow.Flow{
+		cors("https://a.example.com", "https://a.example.com", true),
+		cors("https://evil.example.net", "https://evil.example.net", true),
+		cors("https://b.example.com", "*", false),
+	})
+	require.Equal(t, map[string]Severity{
+		"cors: reflects arbitrary origins (2 seen) with credentials allowed":   SeverityHigh,
+		"cors: Access-Control-Allow-Origin echoes Origin without Vary: Origin": SeverityLow,
+		"cors: Access-Control-Allow-Origin * allows any origin":                SeverityInfo,
+	}, messages(report.Hosts[0]))
+	high := report.Hosts[0].Findings[0]
+	require.Equal(t, SeverityHigh, high.Severity)
+	require.Equal(t, 2, high.Flows)
+
+	report = Analyze([]*flow.Flow{cors("https://a.example.com", "*", true)})
+	require.Equal(t, SeverityMedium, report.Hosts[0].Findings[0].Severity)
+}
+
+func TestReport_WriteHTML(t *testing.T) {
+	report := Analyze([]*flow.Flow{newFlow("http://x.example.com/<script>", nil, http.Header{"Content-Type": {"text/html"}})})
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteHTML(&buf))
+	require.Contains(t, buf.String(), "<h2>x.example.com</h2>")
+	require.Contains(t, buf.String(), `<td class="medium">medium</td><td>transport</td><td>served over plain HTTP</td>`)
+}
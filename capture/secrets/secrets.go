@@ -0,0 +1,350 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/redact"
+)
+
+// 凭据类型
+const (
+	// KindBearer Bearer 令牌，包括 OAuth 令牌响应中的访问令牌和刷新令牌
+	KindBearer = "bearer-token"
+
+	// KindBasic Basic 认证的用户名和密码
+	KindBasic = "basic-auth"
+
+	// KindAPIKey API密钥头部、查询参数，以及常见服务格式的密钥
+	KindAPIKey = "api-key"
+
+	// KindSigV4 AWS Signature Version 4 签名，包括预签名URL和临时凭据的会话令牌
+	KindSigV4 = "aws-sigv4"
+
+	// KindAWSKey AWS访问密钥ID
+	KindAWSKey = "aws-access-key"
+)
+
+// TagPrefix 检测到凭据的流添加的标签前缀，后接凭据类型，例如 credential:bearer-token
+const TagPrefix = "credential:"
+
+// maxScan 扫描消息体的最大长度
+const maxScan = 1 << 20
+
+// apiKeyHeaders 携带API密钥的常见头部
+var apiKeyHeaders = []string{
+	"X-Api-Key", "Api-Key", "Apikey", "X-Apikey", "X-Auth-Token", "X-Access-Token",
+	"X-Goog-Api-Key", "Ocp-Apim-Subscription-Key",
+}
+
+// tokenParams 携带凭据的查询参数、表单字段和JSON字段，名称不区分大小写
+var tokenParams = map[string]string{
+	"api_key":       KindAPIKey,
+	"apikey":        KindAPIKey,
+	"api-key":       KindAPIKey,
+	"client_secret": KindAPIKey,
+	"access_token":  KindBearer,
+	"refresh_token": KindBearer,
+	"id_token":      KindBearer,
+	"auth_token":    KindBearer,
+}
+
+// patterns 常见服务格式的密钥，在URL、头部和消息体中查找
+var patterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{KindAWSKey, regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{KindAPIKey, regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{82})\b`)},
+	{KindAPIKey, regexp.MustCompile(`\b[sr]k_(?:live|test)_[A-Za-z0-9]{16,}\b`)},
+	{KindAPIKey, regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{KindAPIKey, regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+}
+
+// Detector 识别流中携带的凭据，记录在 Flow.Credentials 中并为流添加标签，可安全地并发使用
+type Detector struct {
+	redact bool
+}
+
+// New 创建凭据检测器，redact 为 true 时将检测到的凭据替换为 redact.Mask 后再保存，
+// 消息体按 redact.Redactor 的方式处理
+func New(redact bool) *Detector {
+	return &Detector{redact: redact}
+}
+
+// Apply 检测并记录流中的凭据。为nil时不做任何处理
+func (d *Detector) Apply(f *flow.Flow) {
+	if d == nil {
+		return
+	}
+	found := detect(f)
+	if len(found) == 0 {
+		return
+	}
+	for _, c := range found {
+		f.Credentials = append(f.Credentials, &c.Credential)
+		f.Tag(TagPrefix + c.Kind)
+	}
+	if d.redact {
+		redactValues(f, found)
+	}
+}
+
+// Detect 返回流中携带的凭据
+func Detect(f *flow.Flow) []*flow.Credential {
+	found := detect(f)
+	out := make([]*flow.Credential, 0, len(found))
+	for _, c := range found {
+		out = append(out, &c.Credential)
+	}
+	return out
+}
+
+// finding 检测到的凭据及其原始值，raw 为值在URL中未解码的形式
+type finding struct {
+	flow.Credential
+	value string
+	raw   string
+}
+
+// collector 收集凭据，同一位置的相同凭据只记录一次
+type collector struct {
+	found []*finding
+	seen  map[string]bool
+}
+
+func (c *collector) add(kind, location, value, hint string) *finding {
+	if value == "" {
+		return nil
+	}
+	key := kind + "\x00" + location + "\x00" + value
+	if c.seen[key] {
+		return nil
+	}
+	if c.seen == nil {
+		c.seen = map[string]bool{}
+	}
+	c.seen[key] = true
+	found := &finding{
+		Credential: flow.Credential{Kind: kind, Location: location, Fingerprint: redact.Hash(value), Hint: hint},
+		value:      value,
+	}
+	c.found = append(c.found, found)
+	return found
+}
+
+// patterns 查找文本中常见服务格式的密钥
+func (c *collector) patterns(location, text string) {
+	for _, p := range patterns {
+		for _, m := range p.re.FindAllString(text, -1) {
+			c.add(p.kind, location, m, "")
+		}
+	}
+}
+
+// detect 检查请求的认证头部、API密钥头部、查询参数和消息体，以及响应的消息体
+func detect(f *flow.Flow) []*finding {
+	c := &collector{}
+	if req := f.Request; req != nil {
+		for _, name := range []string{"Authorization", "Proxy-Authorization"} {
+			for _, v := range req.Header.Values(name) {
+				c.authorization("request.header."+name, v)
+			}
+		}
+		for _, name := range apiKeyHeaders {
+			for _, v := range req.Header.Values(name) {
+				c.add(KindAPIKey, "request.header."+name, strings.TrimSpace(v), "")
+			}
+		}
+		for _, v := range req.Header.Values("X-Amz-Security-Token") {
+			c.add(KindSigV4, "request.header.X-Amz-Security-Token", v, "session token")
+		}
+		for name, values := range req.Header {
+			for _, v := range values {
+				c.patterns("request.header."+name, v)
+			}
+		}
+		if u, err := url.Parse(req.URL); err == nil {
+			c.query(u.RawQuery)
+			if unescaped, err := url.QueryUnescape(u.RawQuery); err == nil {
+				c.patterns("request.url", u.Path+"?"+unescaped)
+			}
+		}
+		c.body("request.body", req.Header, req.Body)
+	}
+	if resp := f.Response; resp != nil {
+		c.body("response.body", resp.Header, resp.Body)
+	}
+	return c.found
+}
+
+// authorization 识别 Authorization 头部的认证方式
+func (c *collector) authorization(location, v string) {
+	scheme, param, _ := strings.Cut(strings.TrimSpace(v), " ")
+	param = strings.TrimSpace(param)
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		c.add(KindBearer, location, param, tokenHint(param))
+	case "basic":
+		hint := ""
+		if raw, err := base64.StdEncoding.DecodeString(param); err == nil {
+			if user, _, ok := strings.Cut(string(raw), ":"); ok {
+				hint = "user " + user
+			}
+		}
+		c.add(KindBasic, location, param, hint)
+	case "aws4-hmac-sha256":
+		var credential, signature string
+		for _, part := range strings.Split(param, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch k {
+			case "Credential":
+				credential = v
+			case "Signature":
+				signature = v
+			}
+		}
+		c.add(KindSigV4, location, signature, scopeHint(credential))
+	default:
+		// 自定义方案（例如 token、ApiKey）或没有方案的令牌
+		if param == "" {
+			c.add(KindAPIKey, location, scheme, "")
+		} else {
+			c.add(KindAPIKey, location, param, "scheme "+scheme)
+		}
+	}
+}
+
+// query 识别查询参数中的令牌和预签名URL，记录参数值未解码的形式以便脱敏
+func (c *collector) query(rawQuery string) {
+	q := url.Values{}
+	for _, pair := range strings.Split(rawQuery, "&") {
+		k, raw, _ := strings.Cut(pair, "=")
+		name, err1 := url.QueryUnescape(k)
+		v, err2 := url.QueryUnescape(raw)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		q.Add(name, v)
+		if kind, ok := tokenParams[strings.ToLower(name)]; ok {
+			if found := c.add(kind, "request.query."+name, v, tokenHint(v)); found != nil {
+				found.raw = raw
+			}
+		}
+	}
+	if sig := q.Get("X-Amz-Signature"); sig != "" {
+		c.add(KindSigV4, "request.query.X-Amz-Signature", sig, scopeHint(q.Get("X-Amz-Credential")))
+	}
+	if token := q.Get("X-Amz-Security-Token"); token != "" {
+		c.add(KindSigV4, "request.query.X-Amz-Security-Token", token, "session token")
+	}
+}
+
+// body 识别JSON和表单消息体中的令牌字段，以及文本中常见服务格式的密钥
+func (c *collector) body(location string, h http.Header, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	decoded, _, err := flow.DecodeBody(h, body)
+	if err != nil {
+		return
+	}
+	if len(decoded) > maxScan {
+		decoded = decoded[:maxScan]
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		if form, err := url.ParseQuery(string(decoded)); err == nil {
+			for name, values := range form {
+				if kind, ok := tokenParams[strings.ToLower(name)]; ok {
+					for _, v := range values {
+						c.add(kind, location+"."+name, v, tokenHint(v))
+					}
+				}
+			}
+		}
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var v any
+		if json.Unmarshal(decoded, &v) == nil {
+			c.json(location, v)
+		}
+	}
+	c.patterns(location, string(decoded))
+}
+
+// json 递归查找JSON中的令牌字段
+func (c *collector) json(location string, v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if s, ok := child.(string); ok {
+				if kind, ok := tokenParams[strings.ToLower(k)]; ok {
+					c.add(kind, location+"."+k, s, tokenHint(s))
+					continue
+				}
+			}
+			c.json(location+"."+k, child)
+		}
+	case []any:
+		for _, child := range v {
+			c.json(location, child)
+		}
+	}
+}
+
+// tokenHint 返回JWT的签名算法，其他令牌没有说明
+func tokenHint(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ""
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if json.Unmarshal(raw, &header) != nil || header.Alg == "" {
+		return ""
+	}
+	return "JWT " + header.Alg
+}
+
+// scopeHint 返回SigV4凭据的访问密钥ID和范围，去掉固定的 aws4_request 后缀
+func scopeHint(credential string) string {
+	return strings.TrimSuffix(credential, "/aws4_request")
+}
+
+// redactValues 将流中所有出现的凭据替换为 redact.Mask，也替换查询参数转义后和URL中原样的形式
+func redactValues(f *flow.Flow, found []*finding) {
+	var rules []*redact.Rule
+	for _, c := range found {
+		forms := []string{c.value}
+		for _, v := range []string{url.QueryEscape(c.value), c.raw} {
+			if v != "" && !slices.Contains(forms, v) {
+				forms = append(forms, v)
+			}
+		}
+		for _, v := range forms {
+			rule, err := redact.ParseRule("regex:" + regexp.QuoteMeta(v))
+			if err == nil {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	redact.New(rules...).Apply(f)
+}
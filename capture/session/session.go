@@ -0,0 +1,233 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package session
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+const (
+	// Format 会话文件头部中的格式标识
+	Format = "sniffy-session"
+
+	// Version 当前的会话格式版本，新增字段不改变版本，不兼容的修改递增版本
+	Version = 1
+
+	// Ext 会话文件的扩展名
+	Ext = ".sniffy"
+
+	// maxLine 单条流编码后的最大长度
+	maxLine = 256 << 20
+)
+
+// ErrNotSession 输入不是会话文件
+var ErrNotSession = errors.New("not a sniffy session file")
+
+// Header 会话文件的第一条记录
+type Header struct {
+	// Format 固定为 Format
+	Format string `json:"format"`
+
+	// Version 写入时的格式版本
+	Version int `json:"version"`
+
+	// Created 会话的创建时间
+	Created time.Time `json:"created"`
+
+	// Meta 描述会话的元数据，例如 description、author
+	Meta map[string]string `json:"meta,omitempty"`
+
+	// Config 捕获时的配置，不包含密码等敏感字段
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// Session 会话，包含头部和所有流
+type Session struct {
+	Header
+	Flows []*flow.Flow
+}
+
+// Writer 以流式方式写入会话文件。文件为gzip压缩的 JSON Lines，
+// 第一行为 Header，之后每行一条流，内容保存在流中，不引用本地临时文件
+type Writer struct {
+	gz  *gzip.Writer
+	enc *json.Encoder
+}
+
+// NewWriter 写入头部，Format、Version 和未设置的 Created 自动填写
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	h.Format, h.Version = Format, Version
+	if h.Created.IsZero() {
+		h.Created = time.Now()
+	}
+	gz := gzip.NewWriter(w)
+	sw := &Writer{gz: gz, enc: json.NewEncoder(gz)}
+	if err := sw.enc.Encode(h); err != nil {
+		return nil, fmt.Errorf("write session header: %w", err)
+	}
+	return sw, nil
+}
+
+// WriteFlow 写入一条流，保存在临时文件中的完整内容被读入
+func (sw *Writer) WriteFlow(f *flow.Flow) error {
+	f = inline(f)
+	if err := sw.enc.Encode(f); err != nil {
+		return fmt.Errorf("write flow %s: %w", f.ID, err)
+	}
+	return nil
+}
+
+// Close 结束压缩流，不关闭底层的 io.Writer
+func (sw *Writer) Close() error {
+	return sw.gz.Close()
+}
+
+// Reader 以流式方式读取会话文件
+type Reader struct {
+	header  Header
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewReader 读取并校验头部，拒绝更高版本的会话
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, ErrNotSession
+	}
+	sr := &Reader{scanner: bufio.NewScanner(gz)}
+	sr.scanner.Buffer(make([]byte, 64*1024), maxLine)
+	if !sr.scanner.Scan() {
+		if err := sr.scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read session header: %w", err)
+		}
+		return nil, ErrNotSession
+	}
+	sr.line++
+	if err := json.Unmarshal(sr.scanner.Bytes(), &sr.header); err != nil || sr.header.Format != Format {
+		return nil, ErrNotSession
+	}
+	if sr.header.Version < 1 || sr.header.Version > Version {
+		return nil, fmt.Errorf("unsupported session version %d", sr.header.Version)
+	}
+	return sr, nil
+}
+
+// Header 返回会话头部
+func (sr *Reader) Header() Header {
+	return sr.header
+}
+
+// Next 读取下一条流，没有更多流时返回 io.EOF
+func (sr *Reader) Next() (*flow.Flow, error) {
+	for sr.scanner.Scan() {
+		sr.line++
+		if len(sr.scanner.Bytes()) == 0 {
+			continue
+		}
+		var f flow.Flow
+		if err := json.Unmarshal(sr.scanner.Bytes(), &f); err != nil {
+			return nil, fmt.Errorf("session line %d: %w", sr.line, err)
+		}
+		// 会话来自其他用户，不能引用本地文件，否则删除流时会删除该文件
+		if f.Request != nil {
+			f.Request.BodyFile = ""
+		}
+		if f.Response != nil {
+			f.Response.BodyFile = ""
+		}
+		return &f, nil
+	}
+	if err := sr.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read session: %w", err)
+	}
+	return nil, io.EOF
+}
+
+// Save 将会话写入 w
+func Save(w io.Writer, s *Session) error {
+	sw, err := NewWriter(w, s.Header)
+	if err != nil {
+		return err
+	}
+	for _, f := range s.Flows {
+		if err := sw.WriteFlow(f); err != nil {
+			return err
+		}
+	}
+	return sw.Close()
+}
+
+// Load 读取完整的会话
+func Load(r io.Reader) (*Session, error) {
+	sr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{Header: sr.Header()}
+	for {
+		f, err := sr.Next()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.Flows = append(s.Flows, f)
+	}
+}
+
+// Read 读取会话中的流，与 har.Read 和 cassette.Read 的形式相同
+func Read(r io.Reader) ([]*flow.Flow, error) {
+	s, err := Load(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.Flows, nil
+}
+
+// inline 返回内容都在内存中的流，需要读取临时文件时复制流，不修改原来的流。
+// 临时文件已被删除时保留截断的内容
+func inline(f *flow.Flow) *flow.Flow {
+	if (f.Request == nil || f.Request.BodyFile == "") && (f.Response == nil || f.Response.BodyFile == "") {
+		return f
+	}
+	cp := *f
+	if f.Request != nil && f.Request.BodyFile != "" {
+		req := *f.Request
+		if body, err := readBody(req.OpenBody); err == nil {
+			req.Body, req.BodySize = body, 0
+		}
+		req.BodyFile = ""
+		cp.Request = &req
+	}
+	if f.Response != nil && f.Response.BodyFile != "" {
+		resp := *f.Response
+		if body, err := readBody(resp.OpenBody); err == nil {
+			resp.Body, resp.BodySize = body, 0
+		}
+		resp.BodyFile = ""
+		cp.Response = &resp
+	}
+	return &cp
+}
+
+func readBody(open func() (io.ReadCloser, error)) ([]byte, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -0,0 +1,135 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package session
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+func testFlow(url, respBody string) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{Method: "GET", URL: url, Header: http.Header{"Accept": {"*/*"}}}
+	f.Response = &flow.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       []byte(respBody),
+	}
+	return f
+}
+
+func gzipLines(t *testing.T, lines ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := io.WriteString(gz, strings.Join(lines, "\n")+"\n")
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// --- 测试代码 ---
+func TestSession_RoundTrip(t *testing.T) {
+	// 保存在临时文件中的完整内容写入会话
+	spill := filepath.Join(t.TempDir(), "body")
+	require.NoError(t, os.WriteFile(spill, []byte("full response body"), 0o600))
+	spilled := testFlow("https://api.example.com/big", "full")
+	spilled.Response.BodySize = 18
+	spilled.Response.BodyFile = spill
+	spilled.Tag("large")
+	spilled.Comment = "check pagination"
+	spilled.Starred = true
+	spilled.Marker = "blue"
+
+	s := &Session{
+		Header: Header{Meta: map[string]string{"description": "login bug"}, Config: json.RawMessage(`{"port":8080}`)},
+		Flows:  []*flow.Flow{testFlow("https://api.example.com/a", "a"), spilled},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, Save(&buf, s))
+	require.Equal(t, spill, spilled.Response.BodyFile)
+
+	got, err := Load(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, Format, got.Format)
+	require.Equal(t, Version, got.Version)
+	require.False(t, got.Created.IsZero())
+	require.Equal(t, "login bug", got.Meta["description"])
+	require.JSONEq(t, `{"port":8080}`, string(got.Config))
+	require.Len(t, got.Flows, 2)
+	require.Equal(t, s.Flows[0].ID, got.Flows[0].ID)
+	require.Equal(t, "a", string(got.Flows[0].Response.Body))
+	require.Equal(t, "full response body", string(got.Flows[1].Response.Body))
+	require.Empty(t, got.Flows[1].Response.BodyFile)
+	require.False(t, got.Flows[1].Response.Truncated())
+
+	// 整理流时添加的元数据保存在会话中
+	require.Equal(t, []string{"large"}, got.Flows[1].Tags)
+	require.Equal(t, "check pagination", got.Flows[1].Comment)
+	require.True(t, got.Flows[1].Starred)
+	require.Equal(t, "blue", got.Flows[1].Marker)
+}
+
+func TestReader_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{})
+	require.NoError(t, err)
+	for _, u := range []string{"https://a.example.com/", "https://b.example.com/"} {
+		require.NoError(t, w.WriteFlow(testFlow(u, "")))
+	}
+	require.NoError(t, w.Close())
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	require.Equal(t, Version, r.Header().Version)
+	var urls []string
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		urls = append(urls, f.Request.URL)
+	}
+	require.Equal(t, []string{"https://a.example.com/", "https://b.example.com/"}, urls)
+}
+
+func TestReader_Errors(t *testing.T) {
+	_, err := NewReader(strings.NewReader("plain text"))
+	require.ErrorIs(t, err, ErrNotSession)
+
+	_, err = NewReader(bytes.NewReader(gzipLines(t, `{"format":"other","version":1}`)))
+	require.ErrorIs(t, err, ErrNotSession)
+
+	_, err = NewReader(bytes.NewReader(gzipLines(t, `{"format":"sniffy-session","version":99}`)))
+	require.ErrorContains(t, err, "unsupported session version 99")
+
+	_, err = Load(bytes.NewReader(gzipLines(t, `{"format":"sniffy-session","version":1}`, `{"id":`)))
+	require.ErrorContains(t, err, "session line 2")
+
+	// 会话中引用的本地文件被忽略
+	flows, err := Read(bytes.NewReader(gzipLines(t,
+		`{"format":"sniffy-session","version":1}`,
+		``,
+		`{"id":"x","request":{"method":"GET","url":"https://a.example.com/","body_file":"/etc/passwd"},"response":{"status_code":200,"body_file":"/etc/passwd"}}`,
+	)))
+	require.NoError(t, err)
+	require.Len(t, flows, 1)
+	require.Empty(t, flows[0].Request.BodyFile)
+	require.Empty(t, flows[0].Response.BodyFile)
+}
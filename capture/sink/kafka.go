@@ -0,0 +1,459 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kafka 协议的API和版本，Produce v3 使用 v2 格式的记录批次，需要 Kafka 0.11 及以上
+const (
+	kafkaProduce         = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadata        = 3
+	kafkaMetadataVersion = 1
+
+	// kafkaMaxResponse 响应的最大长度
+	kafkaMaxResponse = 64 << 20
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaPartition 分区及其leader的地址
+type kafkaPartition struct {
+	id     int32
+	leader string
+}
+
+// kafkaClient 以 acks=1 向主题各分区的leader发布消息，消息按键的哈希分配分区
+type kafkaClient struct {
+	brokers []string
+	topic   string
+	useTLS  bool
+	timeout time.Duration
+
+	mu         sync.Mutex
+	conns      map[string]*kafkaConn
+	partitions []kafkaPartition
+	correlate  int32
+}
+
+// newKafka 创建Kafka客户端，brokers 为引导地址，没有端口时使用9092
+func newKafka(brokers []string, topic string, useTLS bool, timeout time.Duration) *kafkaClient {
+	addrs := make([]string, 0, len(brokers))
+	for _, b := range brokers {
+		if _, _, err := net.SplitHostPort(b); err != nil {
+			b = net.JoinHostPort(b, "9092")
+		}
+		addrs = append(addrs, b)
+	}
+	return &kafkaClient{brokers: addrs, topic: topic, useTLS: useTLS, timeout: timeout, conns: map[string]*kafkaConn{}}
+}
+
+// Publish 发布一批消息，失败时丢弃连接和分区信息，下次发布时重新获取
+func (k *kafkaClient) Publish(ctx context.Context, messages []Message) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.publish(ctx, messages); err != nil {
+		k.reset()
+		return err
+	}
+	return nil
+}
+
+func (k *kafkaClient) publish(ctx context.Context, messages []Message) error {
+	if k.partitions == nil {
+		if err := k.refresh(ctx); err != nil {
+			return err
+		}
+	}
+	// 按leader分组，每个leader发送一个请求
+	byPartition := map[int32][]Message{}
+	for _, m := range messages {
+		h := fnv.New32a()
+		h.Write(m.Key)
+		p := k.partitions[h.Sum32()%uint32(len(k.partitions))]
+		byPartition[p.id] = append(byPartition[p.id], m)
+	}
+	byLeader := map[string][]int32{}
+	for _, p := range k.partitions {
+		if len(byPartition[p.id]) > 0 {
+			byLeader[p.leader] = append(byLeader[p.leader], p.id)
+		}
+	}
+	for leader, ids := range byLeader {
+		conn, err := k.conn(ctx, leader)
+		if err != nil {
+			return err
+		}
+		if err := k.produce(ctx, conn, ids, byPartition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// produce 向leader发送其负责的分区的消息
+func (k *kafkaClient) produce(ctx context.Context, conn *kafkaConn, ids []int32, byPartition map[int32][]Message) error {
+	var e kafkaEncoder
+	e.int16(-1) // transactional_id
+	e.int16(1)  // acks
+	e.int32(int32(k.timeout / time.Millisecond))
+	e.int32(1)
+	e.string(k.topic)
+	e.int32(int32(len(ids)))
+	now := time.Now()
+	for _, id := range ids {
+		e.int32(id)
+		e.bytes(recordBatch(byPartition[id], now))
+	}
+
+	resp, err := conn.roundTrip(ctx, kafkaProduce, kafkaProduceVersion, k.nextCorrelation(), e.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	d := kafkaDecoder{data: resp}
+	for range d.int32() {
+		topic := d.string()
+		for range d.int32() {
+			partition := d.int32()
+			code := d.int16()
+			d.int64() // base_offset
+			d.int64() // log_append_time
+			if d.err == nil && code != 0 {
+				return fmt.Errorf("produce to Kafka %s partition %d: %s", topic, partition, kafkaError(code))
+			}
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("produce to Kafka %s: invalid response: %w", conn.addr, d.err)
+	}
+	return nil
+}
+
+// refresh 从引导地址获取主题的分区和leader
+func (k *kafkaClient) refresh(ctx context.Context) error {
+	var errs []error
+	for _, addr := range k.brokers {
+		conn, err := k.conn(ctx, addr)
+		if err == nil {
+			err = k.metadata(ctx, conn)
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// metadata 发送 Metadata 请求并记录分区的leader
+func (k *kafkaClient) metadata(ctx context.Context, conn *kafkaConn) error {
+	var e kafkaEncoder
+	e.int32(1)
+	e.string(k.topic)
+	resp, err := conn.roundTrip(ctx, kafkaMetadata, kafkaMetadataVersion, k.nextCorrelation(), e.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	d := kafkaDecoder{data: resp}
+	brokers := map[int32]string{}
+	for range d.int32() {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.nullableString() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller_id
+	var partitions []kafkaPartition
+	var topicErr int16
+	for range d.int32() {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is_internal
+		for range d.int32() {
+			d.int16() // 分区的错误，例如副本不可用，只要有leader就可以写入
+			id := d.int32()
+			leader := d.int32()
+			d.int32Array() // replica_nodes
+			d.int32Array() // isr_nodes
+			if addr, ok := brokers[leader]; ok && name == k.topic {
+				partitions = append(partitions, kafkaPartition{id: id, leader: addr})
+			}
+		}
+		if name == k.topic {
+			topicErr = code
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("Kafka metadata from %s: invalid response: %w", conn.addr, d.err)
+	}
+	if topicErr != 0 {
+		return fmt.Errorf("Kafka topic %s: %s", k.topic, kafkaError(topicErr))
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("Kafka topic %s has no available partitions", k.topic)
+	}
+	slices.SortFunc(partitions, func(a, b kafkaPartition) int { return int(a.id - b.id) })
+	k.partitions = partitions
+	return nil
+}
+
+// conn 返回到 addr 的连接，没有时建立
+func (k *kafkaClient) conn(ctx context.Context, addr string) (*kafkaConn, error) {
+	if c := k.conns[addr]; c != nil {
+		return c, nil
+	}
+	d := net.Dialer{Timeout: k.timeout}
+	raw, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect to Kafka %s: %w", addr, err)
+	}
+	if k.useTLS {
+		host, _, _ := net.SplitHostPort(addr)
+		tlsConn := tls.Client(raw, &tls.Config{ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			raw.Close()
+			return nil, fmt.Errorf("connect to Kafka %s: %w", addr, err)
+		}
+		raw = tlsConn
+	}
+	c := &kafkaConn{addr: addr, conn: raw, reader: bufio.NewReader(raw)}
+	k.conns[addr] = c
+	return c, nil
+}
+
+func (k *kafkaClient) nextCorrelation() int32 {
+	k.correlate++
+	return k.correlate
+}
+
+// reset 关闭所有连接并丢弃分区信息
+func (k *kafkaClient) reset() {
+	for addr, c := range k.conns {
+		c.conn.Close()
+		delete(k.conns, addr)
+	}
+	k.partitions = nil
+}
+
+// Close 关闭所有连接
+func (k *kafkaClient) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.reset()
+	return nil
+}
+
+// kafkaConn 到一个broker的连接，请求按顺序发送和接收
+type kafkaConn struct {
+	addr   string
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// roundTrip 发送请求并返回去掉关联ID的响应
+func (c *kafkaConn) roundTrip(ctx context.Context, api, version int16, correlation int32, body []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	}
+	var e kafkaEncoder
+	e.int32(0) // 长度，最后填写
+	e.int16(api)
+	e.int16(version)
+	e.int32(correlation)
+	e.string("sniffy")
+	e.buf.Write(body)
+	req := e.buf.Bytes()
+	binary.BigEndian.PutUint32(req, uint32(len(req)-4))
+	if _, err := c.conn.Write(req); err != nil {
+		return nil, fmt.Errorf("Kafka %s: %w", c.addr, err)
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.reader, size[:]); err != nil {
+		return nil, fmt.Errorf("Kafka %s: %w", c.addr, err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > kafkaMaxResponse {
+		return nil, fmt.Errorf("Kafka %s: invalid response size %d", c.addr, n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c.reader, resp); err != nil {
+		return nil, fmt.Errorf("Kafka %s: %w", c.addr, err)
+	}
+	if got := int32(binary.BigEndian.Uint32(resp)); got != correlation {
+		return nil, fmt.Errorf("Kafka %s: response correlation id %d, want %d", c.addr, got, correlation)
+	}
+	return resp[4:], nil
+}
+
+// recordBatch 编码 v2 格式的记录批次，不压缩
+func recordBatch(messages []Message, now time.Time) []byte {
+	ts := now.UnixMilli()
+	var records kafkaEncoder
+	for i, m := range messages {
+		var r kafkaEncoder
+		r.int8(0) // attributes
+		r.varint(0)
+		r.varint(int64(i))
+		r.varint(int64(len(m.Key)))
+		r.buf.Write(m.Key)
+		r.varint(int64(len(m.Value)))
+		r.buf.Write(m.Value)
+		r.varint(0) // headers
+		records.varint(int64(r.buf.Len()))
+		records.buf.Write(r.buf.Bytes())
+	}
+
+	// CRC覆盖 attributes 到批次末尾
+	var tail kafkaEncoder
+	tail.int16(0) // attributes
+	tail.int32(int32(len(messages) - 1))
+	tail.int64(ts)
+	tail.int64(ts)
+	tail.int64(-1) // producer_id
+	tail.int16(-1) // producer_epoch
+	tail.int32(-1) // base_sequence
+	tail.int32(int32(len(messages)))
+	tail.buf.Write(records.buf.Bytes())
+
+	var batch kafkaEncoder
+	batch.int64(0) // base_offset
+	batch.int32(int32(4 + 1 + 4 + tail.buf.Len()))
+	batch.int32(-1) // partition_leader_epoch
+	batch.int8(2)   // magic
+	batch.int32(int32(crc32.Checksum(tail.buf.Bytes(), castagnoli)))
+	batch.buf.Write(tail.buf.Bytes())
+	return batch.buf.Bytes()
+}
+
+// kafkaError 返回常见错误码的名称
+func kafkaError(code int16) string {
+	switch code {
+	case 2:
+		return "corrupt message"
+	case 3:
+		return "unknown topic or partition"
+	case 5:
+		return "leader not available"
+	case 6:
+		return "not leader for partition"
+	case 7:
+		return "request timed out"
+	case 10:
+		return "message too large"
+	case 29:
+		return "topic authorization failed"
+	}
+	return "error code " + strconv.Itoa(int(code))
+}
+
+// kafkaEncoder 按Kafka协议编码，整数为大端序
+type kafkaEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *kafkaEncoder) int8(v int8) { e.buf.WriteByte(byte(v)) }
+
+func (e *kafkaEncoder) int16(v int16) { e.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(v))) }
+
+func (e *kafkaEncoder) int32(v int32) { e.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(v))) }
+
+func (e *kafkaEncoder) int64(v int64) { e.buf.Write(binary.BigEndian.AppendUint64(nil, uint64(v))) }
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf.Write(b)
+}
+
+// varint 写入zigzag编码的变长整数
+func (e *kafkaEncoder) varint(v int64) { e.buf.Write(binary.AppendVarint(nil, v)) }
+
+// kafkaDecoder 按Kafka协议解码，出错后的读取返回零值
+type kafkaDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *kafkaDecoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.data) < n {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+// int32 读取 int32，解码出错后返回0，用作数组长度时循环不会执行
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) string() string {
+	return string(d.take(int(d.int16())))
+}
+
+func (d *kafkaDecoder) nullableString() {
+	if n := d.int16(); n > 0 {
+		d.take(int(n))
+	}
+}
+
+func (d *kafkaDecoder) int32Array() {
+	for range d.int32() {
+		d.int32()
+	}
+}
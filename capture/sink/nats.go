@@ -0,0 +1,231 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsInfo 服务端连接后发送的 INFO
+type natsInfo struct {
+	TLSRequired bool  `json:"tls_required"`
+	Headers     bool  `json:"headers"`
+	MaxPayload  int64 `json:"max_payload"`
+}
+
+// natsConnect 客户端发送的 CONNECT
+type natsConnect struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	TLSRequired bool   `json:"tls_required"`
+	Name        string `json:"name"`
+	Lang        string `json:"lang"`
+	Version     string `json:"version"`
+	Protocol    int    `json:"protocol"`
+	Headers     bool   `json:"headers"`
+	User        string `json:"user,omitempty"`
+	Pass        string `json:"pass,omitempty"`
+	AuthToken   string `json:"auth_token,omitempty"`
+}
+
+// natsClient 使用NATS核心协议发布消息，每批消息后发送 PING 并等待 PONG 确认服务端已处理
+type natsClient struct {
+	addr    string
+	host    string
+	subject string
+	useTLS  bool
+	timeout time.Duration
+	connect natsConnect
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	info   natsInfo
+}
+
+// newNATS 创建NATS客户端，URL中的用户名和密码用于认证，只有用户名时作为令牌
+func newNATS(u *url.URL, subject string, useTLS bool, timeout time.Duration) (*natsClient, error) {
+	if strings.ContainsAny(subject, " \t\r\n") {
+		return nil, fmt.Errorf("invalid NATS subject %q", subject)
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "4222"
+	}
+	c := &natsClient{
+		addr:    net.JoinHostPort(host, port),
+		host:    host,
+		subject: strings.ReplaceAll(subject, "/", "."),
+		useTLS:  useTLS,
+		timeout: timeout,
+		connect: natsConnect{Name: "sniffy", Lang: "go", Version: "1", Protocol: 1, Headers: true},
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			c.connect.User, c.connect.Pass = u.User.Username(), pass
+		} else {
+			c.connect.AuthToken = u.User.Username()
+		}
+	}
+	return c, nil
+}
+
+// Publish 发布一批消息，超过服务端 max_payload 的消息被丢弃
+func (c *natsClient) Publish(ctx context.Context, messages []Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.dial(ctx); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	}
+	if err := c.publish(messages); err != nil {
+		c.reset()
+		return err
+	}
+	return nil
+}
+
+// publish 写入消息并等待确认
+func (c *natsClient) publish(messages []Message) error {
+	w := bufio.NewWriter(c.conn)
+	for _, m := range messages {
+		if c.info.MaxPayload > 0 && int64(len(m.Value)) > c.info.MaxPayload {
+			log.Printf("Flow sink dropped flow %s: %d bytes exceeds the NATS max payload", m.Key, len(m.Value))
+			continue
+		}
+		if c.info.Headers {
+			header := "NATS/1.0\r\nNats-Msg-Id: " + string(m.Key) + "\r\n\r\n"
+			fmt.Fprintf(w, "HPUB %s %d %d\r\n%s", c.subject, len(header), len(header)+len(m.Value), header)
+		} else {
+			fmt.Fprintf(w, "PUB %s %d\r\n", c.subject, len(m.Value))
+		}
+		w.Write(m.Value)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("PING\r\n")
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("publish to NATS %s: %w", c.addr, err)
+	}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return fmt.Errorf("publish to NATS %s: %w", c.addr, err)
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := c.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS %s: %s", c.addr, strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// dial 未连接时连接服务端并完成握手
+func (c *natsClient) dial(ctx context.Context) error {
+	if c.conn != nil {
+		return nil
+	}
+	d := net.Dialer{Timeout: c.timeout}
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("connect to NATS %s: %w", c.addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	c.conn, c.reader = conn, bufio.NewReader(conn)
+	if err := c.handshake(); err != nil {
+		c.reset()
+		return fmt.Errorf("connect to NATS %s: %w", c.addr, err)
+	}
+	return nil
+}
+
+// handshake 读取 INFO，按需升级到TLS，发送 CONNECT 并等待 PONG 确认认证通过
+func (c *natsClient) handshake() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	payload, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fmt.Errorf("unexpected greeting %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(payload), &info); err != nil {
+		return fmt.Errorf("invalid INFO: %w", err)
+	}
+	c.info = info
+	if c.useTLS || info.TLSRequired {
+		tlsConn := tls.Client(c.conn, &tls.Config{ServerName: c.host})
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		c.conn, c.reader = tlsConn, bufio.NewReader(tlsConn)
+	}
+	connect := c.connect
+	connect.TLSRequired = c.useTLS || info.TLSRequired
+	connect.Headers = info.Headers
+	body, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.conn, "CONNECT %s\r\nPING\r\n", body); err != nil {
+		return err
+	}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// readLine 读取一行协议消息，不含行尾
+func (c *natsClient) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// reset 关闭连接，下次发布时重新连接
+func (c *natsClient) reset() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn, c.reader = nil, nil
+}
+
+// Close 关闭连接
+func (c *natsClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset()
+	return nil
+}
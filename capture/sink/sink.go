@@ -0,0 +1,324 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+const (
+	// Schema 记录的格式标识，字段不兼容地变化时递增版本
+	Schema = "sniffy.flow.v1"
+
+	// DefaultBatchSize 每次发布的最大流数量
+	DefaultBatchSize = 100
+
+	// DefaultFlushInterval 定期发布的间隔
+	DefaultFlushInterval = time.Second
+
+	// maxQueue 等待发布的最大流数量，消息系统不可用时丢弃超出的流
+	maxQueue = 8192
+)
+
+// Record 发布到消息系统的流记录，以JSON编码，每条消息一个流。
+// 消息的键（Kafka 记录的 key、NATS 的 Nats-Msg-Id 头部）为流ID
+type Record struct {
+	// Schema 固定为 Schema，消费者据此识别格式版本
+	Schema string `json:"schema"`
+
+	ID        string    `json:"id"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+
+	// DurationMS 从收到请求到响应结束的毫秒数
+	DurationMS float64 `json:"duration_ms"`
+
+	ClientAddr string `json:"client_addr"`
+	ServerAddr string `json:"server_addr,omitempty"`
+
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Scheme string `json:"scheme"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+
+	// Status 响应状态码，请求失败时为0
+	Status int `json:"status,omitempty"`
+
+	RequestHeaders  http.Header `json:"request_headers,omitempty"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+
+	// RequestSize、ResponseSize 消息体的完整长度
+	RequestSize  int64 `json:"request_size"`
+	ResponseSize int64 `json:"response_size"`
+
+	ContentType string `json:"content_type,omitempty"`
+
+	// RequestBody、ResponseBody 捕获的消息体（JSON中为base64），只在 Options.IncludeBodies 时包含
+	RequestBody  []byte `json:"request_body,omitempty"`
+	ResponseBody []byte `json:"response_body,omitempty"`
+
+	Tags          []string `json:"tags,omitempty"`
+	TraceID       string   `json:"trace_id,omitempty"`
+	CorrelationID string   `json:"correlation_id,omitempty"`
+	Error         string   `json:"error,omitempty"`
+	ErrorCode     string   `json:"error_code,omitempty"`
+}
+
+// NewRecord 由流生成记录，includeBodies 为 true 时包含捕获的消息体
+func NewRecord(f *flow.Flow, includeBodies bool) *Record {
+	r := &Record{
+		Schema:        Schema,
+		ID:            f.ID,
+		StartTime:     f.StartTime,
+		EndTime:       f.EndTime,
+		DurationMS:    float64(f.Duration()) / float64(time.Millisecond),
+		ClientAddr:    f.ClientAddr,
+		ServerAddr:    f.ServerAddr,
+		Tags:          f.Tags,
+		TraceID:       f.TraceID,
+		CorrelationID: f.CorrelationID,
+		Error:         f.Error,
+		ErrorCode:     string(f.ErrorCode),
+	}
+	if req := f.Request; req != nil {
+		r.Method = req.Method
+		r.URL = req.URL
+		r.Host = req.Host
+		if u, err := url.Parse(req.URL); err == nil {
+			r.Scheme = u.Scheme
+			r.Path = u.Path
+			if r.Host == "" {
+				r.Host = u.Host
+			}
+		}
+		r.RequestHeaders = req.Header
+		r.RequestSize = req.BodyLen()
+		if includeBodies {
+			r.RequestBody = req.Body
+		}
+	}
+	if resp := f.Response; resp != nil {
+		r.Status = resp.StatusCode
+		r.ResponseHeaders = resp.Header
+		r.ResponseSize = resp.BodyLen()
+		r.ContentType = resp.Header.Get("Content-Type")
+		if includeBodies {
+			r.ResponseBody = resp.Body
+		}
+	}
+	return r
+}
+
+// Message 一条待发布的消息
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// publisher 消息系统的客户端
+type publisher interface {
+	// Publish 发布一批消息，返回时消息已被消息系统确认
+	Publish(ctx context.Context, messages []Message) error
+
+	// Close 关闭连接
+	Close() error
+}
+
+// Options 发布器配置
+type Options struct {
+	// URL 消息系统地址，kafka://broker1:9092,broker2:9092/topic 或 nats://[user:pass@]host:4222/subject，
+	// 使用 TLS 时为 kafka+tls:// 或 tls://
+	URL string
+
+	// IncludeBodies 记录中包含捕获的消息体
+	IncludeBodies bool
+
+	// BatchSize 每次发布的最大流数量，0 使用 DefaultBatchSize
+	BatchSize int
+
+	// FlushInterval 定期发布的间隔，0 使用 DefaultFlushInterval
+	FlushInterval time.Duration
+
+	// Timeout 连接和等待确认的超时，0表示10秒
+	Timeout time.Duration
+}
+
+// Exporter 将完成的流以 Record 格式批量发布到 Kafka 主题或 NATS 主题
+type Exporter struct {
+	opts Options
+	pub  publisher
+
+	mu       sync.Mutex
+	queue    []*flow.Flow
+	dropped  int
+	flushReq chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New 创建发布器并启动后台发布，连接在第一次发布时建立
+func New(opts Options) (*Exporter, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	pub, err := newPublisher(opts)
+	if err != nil {
+		return nil, err
+	}
+	e := &Exporter{
+		opts:     opts,
+		pub:      pub,
+		flushReq: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.run()
+	return e, nil
+}
+
+// CheckURL 检查消息系统地址是否有效，不建立连接
+func CheckURL(rawURL string) error {
+	_, err := newPublisher(Options{URL: rawURL})
+	return err
+}
+
+// newPublisher 按URL的协议创建客户端
+func newPublisher(opts Options) (publisher, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink URL %q: %w", opts.URL, err)
+	}
+	target := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || target == "" {
+		return nil, fmt.Errorf("invalid sink URL %q: missing host or topic", opts.URL)
+	}
+	switch u.Scheme {
+	case "kafka", "kafka+tls":
+		return newKafka(strings.Split(u.Host, ","), target, u.Scheme == "kafka+tls", opts.Timeout), nil
+	case "nats", "tls":
+		return newNATS(u, target, u.Scheme == "tls", opts.Timeout)
+	}
+	return nil, fmt.Errorf("unsupported sink scheme %q", u.Scheme)
+}
+
+// Add 将流加入发布队列，签名与 flow.Store.OnAdd 的回调一致
+func (e *Exporter) Add(f *flow.Flow) {
+	e.mu.Lock()
+	if len(e.queue) >= maxQueue {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.queue = append(e.queue, f)
+	full := len(e.queue) >= e.opts.BatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flushReq <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush 发布队列中的所有流，发布失败的批次放回队列等待下次重试
+func (e *Exporter) Flush(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		n := min(len(e.queue), e.opts.BatchSize)
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		dropped := e.dropped
+		e.dropped = 0
+		e.mu.Unlock()
+
+		if dropped > 0 {
+			log.Printf("Flow sink queue full, dropped %d flows", dropped)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := e.publish(ctx, batch); err != nil {
+			e.requeue(batch)
+			return err
+		}
+	}
+}
+
+// requeue 把发布失败的流放回队列头部，超出队列上限的部分丢弃
+func (e *Exporter) requeue(batch []*flow.Flow) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	queue := append(batch, e.queue...)
+	if len(queue) > maxQueue {
+		e.dropped += len(queue) - maxQueue
+		queue = queue[:maxQueue]
+	}
+	e.queue = queue
+}
+
+// Close 停止后台发布，发布剩余的流并关闭连接
+func (e *Exporter) Close() error {
+	close(e.done)
+	e.wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), e.opts.Timeout)
+	defer cancel()
+	err := e.Flush(ctx)
+	if cerr := e.pub.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// run 定期或在队列达到批量大小时发布
+func (e *Exporter) run() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		case <-e.flushReq:
+		}
+		if err := e.Flush(context.Background()); err != nil {
+			log.Printf("Flow sink publish failed: %v", err)
+		}
+	}
+}
+
+// publish 编码并发布一批流
+func (e *Exporter) publish(ctx context.Context, flows []*flow.Flow) error {
+	messages := make([]Message, 0, len(flows))
+	for _, f := range flows {
+		value, err := json.Marshal(NewRecord(f, e.opts.IncludeBodies))
+		if err != nil {
+			return fmt.Errorf("encode flow %s: %w", f.ID, err)
+		}
+		messages = append(messages, Message{Key: []byte(f.ID), Value: value})
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.opts.Timeout)
+	defer cancel()
+	return e.pub.Publish(ctx, messages)
+}
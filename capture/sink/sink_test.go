@@ -0,0 +1,378 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+func newFlow(id string) *flow.Flow {
+	start := time.Unix(1700000000, 0).UTC()
+	return &flow.Flow{
+		ID:         id,
+		StartTime:  start,
+		EndTime:    start.Add(250 * time.Millisecond),
+		ClientAddr: "127.0.0.1:50000",
+		Request: &flow.Request{
+			Method: "POST",
+			URL:    "https://api.example.com/v1/orders?x=1",
+			Host:   "api.example.com",
+			Header: http.Header{"Content-Type": {"application/json"}},
+			Body:   []byte(`{"a":1}`),
+		},
+		Response: &flow.Response{
+			StatusCode: 201,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       []byte(`{"id":7}`),
+		},
+		Tags:    []string{"api"},
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+	}
+}
+
+// listen 在本地端口上接受连接并交给 serve 处理
+func listen(t *testing.T, serve func(net.Conn)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// received 模拟服务端收到的消息
+type received struct {
+	mu       sync.Mutex
+	subjects []string
+	keys     []string
+	values   []string
+}
+
+func (r *received) add(subject, key, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subjects = append(r.subjects, subject)
+	r.keys = append(r.keys, key)
+	r.values = append(r.values, value)
+}
+
+func (r *received) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.values)
+}
+
+// natsServer 模拟NATS服务端，headers 为服务端是否支持头部
+func natsServer(got *received, headers bool, connects chan<- string) func(net.Conn) {
+	return func(conn net.Conn) {
+		fmt.Fprintf(conn, "INFO {\"headers\":%t,\"max_payload\":4096}\r\n", headers)
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "CONNECT":
+				connects <- strings.TrimSpace(strings.TrimPrefix(line, "CONNECT"))
+			case "PING":
+				conn.Write([]byte("PONG\r\n"))
+			case "PUB", "HPUB":
+				total, _ := strconv.Atoi(fields[len(fields)-1])
+				data := make([]byte, total+2)
+				if _, err := io.ReadFull(r, data); err != nil {
+					return
+				}
+				key, value := "", string(data[:total])
+				if fields[0] == "HPUB" {
+					n, _ := strconv.Atoi(fields[2])
+					header := value[:n]
+					value = value[n:]
+					for _, h := range strings.Split(header, "\r\n") {
+						if v, ok := strings.CutPrefix(h, "Nats-Msg-Id: "); ok {
+							key = v
+						}
+					}
+				}
+				got.add(fields[1], key, value)
+			}
+		}
+	}
+}
+
+// kafkaBroker 模拟单个分区为 partitions 个的Kafka broker，记录写入的消息
+func kafkaBroker(t *testing.T, topic string, partitions int, got *received) string {
+	var addr string
+	addr = listen(t, func(conn net.Conn) {
+		for {
+			var size [4]byte
+			if _, err := io.ReadFull(conn, size[:]); err != nil {
+				return
+			}
+			req := make([]byte, binary.BigEndian.Uint32(size[:]))
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return
+			}
+			d := kafkaDecoder{data: req}
+			api, _ := d.int16(), d.int16()
+			correlation := d.int32()
+			d.string() // client_id
+
+			var e kafkaEncoder
+			e.int32(correlation)
+			switch api {
+			case kafkaMetadata:
+				host, port, _ := net.SplitHostPort(addr)
+				p, _ := strconv.Atoi(port)
+				e.int32(1)
+				e.int32(1)
+				e.string(host)
+				e.int32(int32(p))
+				e.int16(-1)
+				e.int32(1)
+				e.int32(1)
+				e.int16(0)
+				e.string(topic)
+				e.int8(0)
+				e.int32(int32(partitions))
+				for i := range partitions {
+					e.int16(0)
+					e.int32(int32(i))
+					e.int32(1)
+					e.int32(0)
+					e.int32(0)
+				}
+			case kafkaProduce:
+				d.int16() // transactional_id
+				require.Equal(t, int16(1), d.int16(), "acks")
+				d.int32()
+				d.int32()
+				name := d.string()
+				n := d.int32()
+				e.int32(1)
+				e.string(name)
+				e.int32(n)
+				for range n {
+					partition := d.int32()
+					batch := d.take(int(d.int32()))
+					for _, r := range decodeBatch(t, batch) {
+						got.add(name+"/"+strconv.Itoa(int(partition)), r[0], r[1])
+					}
+					e.int32(partition)
+					e.int16(0)
+					e.int64(0)
+					e.int64(-1)
+				}
+				e.int32(0) // throttle_time_ms
+			}
+			require.NoError(t, d.err)
+			resp := binary.BigEndian.AppendUint32(nil, uint32(e.buf.Len()))
+			conn.Write(append(resp, e.buf.Bytes()...))
+		}
+	})
+	return addr
+}
+
+// decodeBatch 校验记录批次的CRC并返回各条记录的键和值
+func decodeBatch(t *testing.T, batch []byte) [][2]string {
+	d := kafkaDecoder{data: batch}
+	d.int64() // base_offset
+	require.Equal(t, int(d.int32()), len(batch)-12)
+	d.int32() // partition_leader_epoch
+	require.Equal(t, int8(2), d.int8())
+	crc := uint32(d.int32())
+	require.Equal(t, crc32.Checksum(d.data, castagnoli), crc)
+	d.take(2 + 4 + 8 + 8 + 8 + 2 + 4)
+	count := d.int32()
+
+	var out [][2]string
+	for range count {
+		length, n := binary.Varint(d.data)
+		d.take(n)
+		r := d.take(int(length))
+		var fields []string
+		r = r[1:] // attributes
+		for range 2 {
+			_, n := binary.Varint(r) // timestamp_delta, offset_delta
+			r = r[n:]
+		}
+		for range 2 {
+			l, n := binary.Varint(r)
+			r = r[n:]
+			fields = append(fields, string(r[:l]))
+			r = r[l:]
+		}
+		out = append(out, [2]string{fields[0], fields[1]})
+	}
+	require.NoError(t, d.err)
+	return out
+}
+
+// --- 测试代码 ---
+
+func TestNewRecord(t *testing.T) {
+	f := newFlow("f1")
+
+	r := NewRecord(f, false)
+	require.Equal(t, Schema, r.Schema)
+	require.Equal(t, "f1", r.ID)
+	require.Equal(t, 250.0, r.DurationMS)
+	require.Equal(t, "POST", r.Method)
+	require.Equal(t, "https", r.Scheme)
+	require.Equal(t, "api.example.com", r.Host)
+	require.Equal(t, "/v1/orders", r.Path)
+	require.Equal(t, 201, r.Status)
+	require.Equal(t, int64(7), r.RequestSize)
+	require.Equal(t, int64(8), r.ResponseSize)
+	require.Equal(t, "application/json", r.ContentType)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", r.TraceID)
+	require.Nil(t, r.RequestBody)
+
+	data, err := json.Marshal(r)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "request_body")
+	require.Contains(t, string(data), `"schema":"sniffy.flow.v1"`)
+
+	r = NewRecord(f, true)
+	require.Equal(t, `{"a":1}`, string(r.RequestBody))
+	require.Equal(t, `{"id":7}`, string(r.ResponseBody))
+}
+
+func TestNew_InvalidURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://localhost/x", "unsupported sink scheme"},
+		{"kafka://localhost:9092", "missing host or topic"},
+		{"nats:///flows", "missing host or topic"},
+		{"nats://localhost/bad subject", "invalid NATS subject"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := New(Options{URL: tt.url})
+			require.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestExporter_NATS(t *testing.T) {
+	for _, headers := range []bool{true, false} {
+		t.Run("headers="+strconv.FormatBool(headers), func(t *testing.T) {
+			var got received
+			connects := make(chan string, 4)
+			addr := listen(t, natsServer(&got, headers, connects))
+
+			e, err := New(Options{URL: "nats://alice:secret@" + addr + "/sniffy/flows", FlushInterval: time.Hour})
+			require.NoError(t, err)
+			e.Add(newFlow("f1"))
+			e.Add(newFlow("f2"))
+			require.NoError(t, e.Flush(context.Background()))
+			require.NoError(t, e.Close())
+
+			var connect natsConnect
+			require.NoError(t, json.Unmarshal([]byte(<-connects), &connect))
+			require.Equal(t, "alice", connect.User)
+			require.Equal(t, "secret", connect.Pass)
+			require.Equal(t, headers, connect.Headers)
+
+			require.Equal(t, []string{"sniffy.flows", "sniffy.flows"}, got.subjects)
+			if headers {
+				require.Equal(t, []string{"f1", "f2"}, got.keys)
+			}
+			var r Record
+			require.NoError(t, json.Unmarshal([]byte(got.values[1]), &r))
+			require.Equal(t, "f2", r.ID)
+			require.Equal(t, Schema, r.Schema)
+		})
+	}
+}
+
+func TestExporter_NATSDropsOversize(t *testing.T) {
+	var got received
+	addr := listen(t, natsServer(&got, true, make(chan string, 4)))
+
+	e, err := New(Options{URL: "nats://" + addr + "/flows", IncludeBodies: true, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	defer e.Close()
+	big := newFlow("big")
+	big.Response.Body = []byte(strings.Repeat("x", 8192))
+	e.Add(big)
+	e.Add(newFlow("small"))
+	require.NoError(t, e.Flush(context.Background()))
+	require.Equal(t, []string{"small"}, got.keys)
+}
+
+func TestExporter_Kafka(t *testing.T) {
+	var got received
+	addr := kafkaBroker(t, "flows", 3, &got)
+
+	e, err := New(Options{URL: "kafka://" + addr + "/flows", FlushInterval: time.Hour})
+	require.NoError(t, err)
+	for i := range 10 {
+		e.Add(newFlow("f" + strconv.Itoa(i)))
+	}
+	require.NoError(t, e.Flush(context.Background()))
+	require.NoError(t, e.Close())
+
+	require.Equal(t, 10, got.count())
+	partitions := map[string]bool{}
+	for i, key := range got.keys {
+		partitions[got.subjects[i]] = true
+		var r Record
+		require.NoError(t, json.Unmarshal([]byte(got.values[i]), &r))
+		require.Equal(t, key, r.ID)
+	}
+	require.Greater(t, len(partitions), 1, "messages should spread over partitions")
+}
+
+func TestExporter_RequeuesOnFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	e, err := New(Options{URL: "nats://" + addr + "/flows", FlushInterval: time.Hour, Timeout: time.Second})
+	require.NoError(t, err)
+	e.Add(newFlow("f1"))
+	require.Error(t, e.Flush(context.Background()))
+	e.mu.Lock()
+	require.Len(t, e.queue, 1)
+	e.mu.Unlock()
+	require.Error(t, e.Close())
+}
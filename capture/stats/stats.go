@@ -0,0 +1,302 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package stats
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/openapi"
+)
+
+// DefaultWindow 默认的统计窗口
+const DefaultWindow = 15 * time.Minute
+
+const (
+	// slots 统计窗口划分的时间片数量，过期的时间片整体丢弃
+	slots = 60
+
+	// maxSamples 每个时间片中每组保留的延迟样本数，超过后按蓄水池抽样
+	maxSamples = 256
+)
+
+// Key 统计分组，路径中像ID的段替换为参数，例如 /users/42 归入 /users/{userId}
+type Key struct {
+	Host   string
+	Method string
+	Path   string
+}
+
+// Row 一组流的统计，延迟为毫秒，流量为消息体字节数
+type Row struct {
+	Host   string `json:"host,omitempty"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+
+	// Rate 窗口内平均每秒请求数
+	Rate float64 `json:"rate"`
+
+	// P50、P95、P99 延迟分位数，样本较多时为抽样的近似值
+	P50 float64 `json:"p50_ms"`
+	P95 float64 `json:"p95_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+
+	RequestBytes  int64 `json:"request_bytes"`
+	ResponseBytes int64 `json:"response_bytes"`
+}
+
+// Query 统计查询
+type Query struct {
+	// By 分组方式：path（默认）按主机、方法和路径模板，host 只按主机
+	By string
+
+	// Host 只统计该主机，为空时统计所有主机
+	Host string
+
+	// Window 统计最近的时间范围，为0或超过收集器的窗口时使用整个窗口
+	Window time.Duration
+
+	// Limit 最多返回的分组数，按请求数从多到少，0表示不限制
+	Limit int
+}
+
+// Report 统计查询的结果
+type Report struct {
+	// Window 实际统计的时间范围，收集器启动不久时小于查询的窗口
+	Window string `json:"window"`
+
+	// Total 所有分组的合计
+	Total *Row `json:"total"`
+
+	// Rows 各分组的统计，按请求数从多到少
+	Rows []*Row `json:"rows"`
+}
+
+// Collector 按主机和路径滚动统计结束的流，统计窗口划分为固定数量的时间片，
+// 查询时合并窗口内的时间片。请求失败或状态码不小于500的流计为错误
+type Collector struct {
+	window  time.Duration
+	slot    time.Duration
+	started time.Time
+	now     func() time.Time
+
+	mu sync.Mutex
+
+	// slots 时间片环，多保留一个时间片，窗口起点所在的时间片只有部分在窗口内
+	slots [slots + 1]*bucket
+}
+
+// bucket 一个时间片内各组的统计
+type bucket struct {
+	n      int64
+	groups map[Key]*group
+}
+
+// group 一组流的累计值和延迟样本
+type group struct {
+	count     int64
+	errors    int64
+	reqBytes  int64
+	respBytes int64
+	max       float64
+	latencies []float64
+}
+
+// New 创建统计最近 window 时间内流的收集器，window 不大于0时使用 DefaultWindow
+func New(window time.Duration) *Collector {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	c := &Collector{window: window, slot: window / slots, now: time.Now}
+	if c.slot <= 0 {
+		c.slot = 1
+	}
+	c.started = c.now()
+	return c
+}
+
+// Window 返回统计窗口
+func (c *Collector) Window() time.Duration {
+	return c.window
+}
+
+// Add 统计结束的流，签名与 flow.Bus.OnFinished 的回调一致
+func (c *Collector) Add(f *flow.Flow) {
+	if f.Request == nil {
+		return
+	}
+	key := KeyOf(f.Request)
+	latency := float64(f.Duration()) / float64(time.Millisecond)
+	failed := f.Error != "" || f.Response != nil && f.Response.StatusCode >= 500
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.bucket(c.now())
+	g := b.groups[key]
+	if g == nil {
+		g = &group{}
+		b.groups[key] = g
+	}
+	g.count++
+	if failed {
+		g.errors++
+	}
+	g.reqBytes += f.Request.BodyLen()
+	if f.Response != nil {
+		g.respBytes += f.Response.BodyLen()
+	}
+	g.max = max(g.max, latency)
+	if len(g.latencies) < maxSamples {
+		g.latencies = append(g.latencies, latency)
+	} else if i := rand.Int64N(g.count); i < maxSamples {
+		g.latencies[i] = latency
+	}
+}
+
+// bucket 返回时刻 t 所在的时间片，复用的时间片先清空
+func (c *Collector) bucket(t time.Time) *bucket {
+	n := t.Sub(c.started).Nanoseconds() / c.slot.Nanoseconds()
+	i := n % int64(len(c.slots))
+	if b := c.slots[i]; b != nil && b.n == n {
+		return b
+	}
+	b := &bucket{n: n, groups: map[Key]*group{}}
+	c.slots[i] = b
+	return b
+}
+
+// KeyOf 返回请求的统计分组
+func KeyOf(req *flow.Request) Key {
+	key := Key{Host: req.Host, Method: req.Method}
+	if u, err := url.Parse(req.URL); err == nil {
+		if key.Host == "" {
+			key.Host = u.Host
+		}
+		key.Path = openapi.PathTemplate(u.EscapedPath())
+	}
+	key.Host = strings.ToLower(key.Host)
+	return key
+}
+
+// ParseBy 检查分组方式
+func ParseBy(by string) (string, error) {
+	switch by {
+	case "", "path":
+		return "path", nil
+	case "host":
+		return by, nil
+	}
+	return "", fmt.Errorf("invalid grouping %q (expected host or path)", by)
+}
+
+// Query 返回最近的流统计
+func (c *Collector) Query(q Query) (*Report, error) {
+	by, err := ParseBy(q.By)
+	if err != nil {
+		return nil, err
+	}
+	window := q.Window
+	if window <= 0 || window > c.window {
+		window = c.window
+	}
+	now := c.now()
+	window = min(window, now.Sub(c.started))
+
+	merged := map[Key]*group{}
+	total := &group{}
+	c.mu.Lock()
+	elapsed := now.Sub(c.started)
+	first, last := (elapsed-window).Nanoseconds()/c.slot.Nanoseconds(), elapsed.Nanoseconds()/c.slot.Nanoseconds()
+	for _, b := range c.slots {
+		if b == nil || b.n < first || b.n > last {
+			continue
+		}
+		for key, g := range b.groups {
+			if q.Host != "" && !strings.EqualFold(key.Host, q.Host) {
+				continue
+			}
+			if by == "host" {
+				key = Key{Host: key.Host}
+			}
+			m := merged[key]
+			if m == nil {
+				m = &group{}
+				merged[key] = m
+			}
+			m.merge(g)
+			total.merge(g)
+		}
+	}
+	c.mu.Unlock()
+
+	seconds := max(window.Seconds(), 1)
+	report := &Report{Window: window.Round(time.Second).String(), Total: total.row(seconds), Rows: []*Row{}}
+	for key, g := range merged {
+		row := g.row(seconds)
+		row.Host, row.Method, row.Path = key.Host, key.Method, key.Path
+		report.Rows = append(report.Rows, row)
+	}
+	slices.SortFunc(report.Rows, func(a, b *Row) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Host, b.Host),
+			cmp.Compare(a.Path, b.Path), cmp.Compare(a.Method, b.Method))
+	})
+	if q.Limit > 0 && len(report.Rows) > q.Limit {
+		report.Rows = report.Rows[:q.Limit]
+	}
+	return report, nil
+}
+
+// merge 累加另一组的统计和延迟样本
+func (g *group) merge(o *group) {
+	g.count += o.count
+	g.errors += o.errors
+	g.reqBytes += o.reqBytes
+	g.respBytes += o.respBytes
+	g.max = max(g.max, o.max)
+	g.latencies = append(g.latencies, o.latencies...)
+}
+
+// row 计算一组的统计，会对延迟样本排序
+func (g *group) row(seconds float64) *Row {
+	row := &Row{
+		Requests:      g.count,
+		Errors:        g.errors,
+		Rate:          float64(g.count) / seconds,
+		Max:           g.max,
+		RequestBytes:  g.reqBytes,
+		ResponseBytes: g.respBytes,
+	}
+	if g.count > 0 {
+		row.ErrorRate = float64(g.errors) / float64(g.count)
+	}
+	slices.Sort(g.latencies)
+	row.P50 = percentile(g.latencies, 0.50)
+	row.P95 = percentile(g.latencies, 0.95)
+	row.P99 = percentile(g.latencies, 0.99)
+	return row
+}
+
+// percentile 返回有序样本的最近秩分位数
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// newCollector 创建使用可控时钟的收集器
+func newCollector(window time.Duration) (*Collector, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New(window)
+	c.now = func() time.Time { return now }
+	c.started = now
+	return c, &now
+}
+
+func newFlow(method, rawURL string, status int, ms int) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{Method: method, URL: rawURL, Body: []byte("ab")}
+	f.EndTime = f.StartTime.Add(time.Duration(ms) * time.Millisecond)
+	if status > 0 {
+		f.Response = &flow.Response{StatusCode: status, Body: []byte("hello")}
+	} else {
+		f.Error = "connection refused"
+	}
+	return f
+}
+
+// --- 测试代码 ---
+
+func TestCollector(t *testing.T) {
+	c, now := newCollector(time.Minute)
+	for i := 1; i <= 100; i++ {
+		c.Add(newFlow("GET", "https://api.example.com/users/"+string(rune('0'+i%10)), 200, i))
+	}
+	c.Add(newFlow("POST", "https://api.example.com/users", 503, 10))
+	c.Add(newFlow("GET", "https://API.example.com/users/42", 0, 10))
+	c.Add(newFlow("GET", "http://cdn.example.com/a.png", 200, 5))
+	*now = now.Add(30 * time.Second)
+
+	report, err := c.Query(Query{})
+	require.NoError(t, err)
+	require.Equal(t, "30s", report.Window)
+	require.EqualValues(t, 103, report.Total.Requests)
+	require.EqualValues(t, 2, report.Total.Errors)
+	require.Len(t, report.Rows, 3)
+
+	users := report.Rows[0]
+	require.Equal(t, Key{"api.example.com", "GET", "/users/{userId}"}, Key{users.Host, users.Method, users.Path})
+	require.EqualValues(t, 101, users.Requests)
+	require.EqualValues(t, 1, users.Errors)
+	require.InDelta(t, 1.0/101, users.ErrorRate, 1e-9)
+	require.InDelta(t, 101.0/30, users.Rate, 1e-9)
+	require.Equal(t, 50.0, users.P50)
+	require.Equal(t, 95.0, users.P95)
+	require.Equal(t, 99.0, users.P99)
+	require.Equal(t, 100.0, users.Max)
+	require.EqualValues(t, 202, users.RequestBytes)
+	require.EqualValues(t, 500, users.ResponseBytes)
+	require.Equal(t, "POST", report.Rows[1].Method)
+	require.Equal(t, "/a.png", report.Rows[2].Path)
+
+	report, err = c.Query(Query{By: "host", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, report.Rows, 1)
+	require.Equal(t, "api.example.com", report.Rows[0].Host)
+	require.Empty(t, report.Rows[0].Path)
+	require.EqualValues(t, 102, report.Rows[0].Requests)
+
+	report, err = c.Query(Query{Host: "cdn.example.com"})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, report.Total.Requests)
+
+	_, err = c.Query(Query{By: "status"})
+	require.ErrorContains(t, err, "invalid grouping")
+}
+
+func TestCollector_Window(t *testing.T) {
+	c, now := newCollector(time.Minute)
+	c.Add(newFlow("GET", "https://example.com/old", 200, 1))
+	*now = now.Add(40 * time.Second)
+	c.Add(newFlow("GET", "https://example.com/new", 200, 1))
+
+	report, err := c.Query(Query{Window: 10 * time.Second})
+	require.NoError(t, err)
+	require.Len(t, report.Rows, 1)
+	require.Equal(t, "/new", report.Rows[0].Path)
+
+	// 超出窗口的时间片被丢弃，复用时不残留旧的统计
+	*now = now.Add(30 * time.Second)
+	c.Add(newFlow("GET", "https://example.com/latest", 200, 1))
+	report, err = c.Query(Query{})
+	require.NoError(t, err)
+	require.Equal(t, "1m0s", report.Window)
+	require.Len(t, report.Rows, 2)
+	require.EqualValues(t, 2, report.Total.Requests)
+}
+
+func TestCollector_Sampling(t *testing.T) {
+	c, _ := newCollector(time.Minute)
+	for i := range 10 * maxSamples {
+		c.Add(newFlow("GET", "https://example.com/", 200, i%100))
+	}
+	report, err := c.Query(Query{})
+	require.NoError(t, err)
+	row := report.Rows[0]
+	require.EqualValues(t, 10*maxSamples, row.Requests)
+	require.Equal(t, 99.0, row.Max)
+	require.InDelta(t, 50, row.P50, 15)
+}
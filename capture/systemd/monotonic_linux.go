@@ -0,0 +1,19 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package systemd
+
+import "golang.org/x/sys/unix"
+
+// monotonicUsec 返回 CLOCK_MONOTONIC 的当前时间（微秒）
+func monotonicUsec() (int64, bool) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0, false
+	}
+	return ts.Nano() / 1000, true
+}
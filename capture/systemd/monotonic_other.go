@@ -0,0 +1,13 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package systemd
+
+// monotonicUsec systemd只在Linux上运行
+func monotonicUsec() (int64, bool) {
+	return 0, false
+}
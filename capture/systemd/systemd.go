@@ -0,0 +1,138 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listenFdsStart systemd传入的第一个文件描述符，见 sd_listen_fds(3)
+const listenFdsStart = 3
+
+// Socket systemd套接字激活传入的监听套接字
+type Socket struct {
+	// Name 套接字单元中 FileDescriptorName= 指定的名称，未指定时为套接字单元的名称
+	Name string
+
+	Listener net.Listener
+}
+
+// Listeners 返回systemd套接字激活传入的监听套接字，不是由systemd按套接字激活启动时返回nil。
+// 调用后清除 LISTEN_* 环境变量，子进程不会再次继承这些套接字
+func Listeners() ([]Socket, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	sockets := make([]Socket, 0, n)
+	for i := range n {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		fd := listenFdsStart + i
+		// FileListener 复制文件描述符并设置 close-on-exec，原描述符随后关闭
+		f := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, s := range sockets {
+				s.Listener.Close()
+			}
+			return nil, fmt.Errorf("socket %d (%s) is not a listening stream socket: %w", fd, name, err)
+		}
+		sockets = append(sockets, Socket{Name: name, Listener: ln})
+	}
+	return sockets, nil
+}
+
+// Notify 向 NOTIFY_SOCKET 发送状态，例如 "READY=1"，见 sd_notify(3)。
+// 没有在systemd服务中运行时什么也不做
+func Notify(state string) error {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	// 以 @ 开头的路径为抽象命名空间，net 包会自动转换
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("connect to notify socket %s: %w", path, err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("notify systemd: %w", err)
+	}
+	return nil
+}
+
+// Ready 通知systemd服务已启动，status 为 systemctl status 中显示的状态
+func Ready(status string) error {
+	return Notify("READY=1\nSTATUS=" + status)
+}
+
+// Reloading 通知systemd开始重新加载配置，完成后调用 Ready。
+// Type=notify-reload 的服务要求同时报告 CLOCK_MONOTONIC 时间
+func Reloading() error {
+	state := "RELOADING=1"
+	if usec, ok := monotonicUsec(); ok {
+		state += "\nMONOTONIC_USEC=" + strconv.FormatInt(usec, 10)
+	}
+	return Notify(state)
+}
+
+// Stopping 通知systemd服务正在关闭
+func Stopping() error {
+	return Notify("STOPPING=1")
+}
+
+// WatchdogInterval 返回服务单元 WatchdogSec= 指定的间隔，没有为当前进程启用看门狗时返回0
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Watchdog 按看门狗间隔的一半检查 healthy，正常时向systemd发送 WATCHDOG=1，直到 ctx 取消。
+// 没有启用看门狗时立即返回。healthy 返回false时不发送，使systemd在超时后重启服务
+func Watchdog(ctx context.Context, healthy func() bool) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if healthy() {
+				Notify("WATCHDOG=1")
+			}
+		}
+	}
+}
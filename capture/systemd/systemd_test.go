@@ -0,0 +1,83 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// listenNotify 创建接收通知的 unixgram 套接字并设置 NOTIFY_SOCKET
+func listenNotify(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+// receive 读取一条通知
+func receive(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+// --- 测试代码 ---
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	require.NoError(t, Ready("not running under systemd"))
+
+	conn := listenNotify(t)
+	require.NoError(t, Ready("Proxying on 127.0.0.1:8080"))
+	require.Equal(t, "READY=1\nSTATUS=Proxying on 127.0.0.1:8080", receive(t, conn))
+	require.NoError(t, Reloading())
+	require.True(t, strings.HasPrefix(receive(t, conn), "RELOADING=1"))
+	require.NoError(t, Stopping())
+	require.Equal(t, "STOPPING=1", receive(t, conn))
+}
+
+func TestListeners_NotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "2")
+	sockets, err := Listeners()
+	require.NoError(t, err)
+	require.Nil(t, sockets)
+	_, ok := os.LookupEnv("LISTEN_FDS")
+	require.False(t, ok)
+}
+
+func TestWatchdog(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	require.Zero(t, WatchdogInterval())
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	require.Zero(t, WatchdogInterval())
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	require.Equal(t, 20*time.Millisecond, WatchdogInterval())
+
+	conn := listenNotify(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watchdog(ctx, func() bool { return true })
+	require.Equal(t, "WATCHDOG=1", receive(t, conn))
+}
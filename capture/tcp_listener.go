@@ -11,8 +11,14 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/netip"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/proxyproto"
 )
 
 // TCPListener TCP监听器结构体
@@ -26,18 +32,34 @@ type TCPListener struct {
 	isRunning bool
 	handler   PacketHandler
 	logger    Logger
+
+	// inherited 由 UseListener 设置的已打开的监听套接字
+	inherited net.Listener
+
+	// trusted 允许发送PROXY protocol头部的对端地址
+	trusted []netip.Prefix
+
+	// connMu 保护 conns 和 draining
+	connMu   sync.Mutex
+	conns    map[*trackedConn]struct{}
+	draining bool
 }
 
 // NewTCPListener 创建新的TCP监听器
 func NewTCPListener(config Config) *TCPListener {
+	return NewTCPListenerWithHandler(config, NewDefaultPacketHandler(config))
+}
+
+// NewTCPListenerWithHandler 使用指定的数据包处理器创建TCP监听器
+func NewTCPListenerWithHandler(config Config, handler PacketHandler) *TCPListener {
 	ctx, cancel := context.WithCancel(context.Background())
-	handler := NewDefaultPacketHandler(config)
 
 	return &TCPListener{
 		config:  config,
 		handler: handler,
 		ctx:     ctx,
 		cancel:  cancel,
+		conns:   make(map[*trackedConn]struct{}),
 	}
 }
 
@@ -62,6 +84,40 @@ func (tl *TCPListener) GetConfig() Config {
 	return tl.config
 }
 
+// UseListener 使用已打开的监听套接字，例如systemd套接字激活传入的套接字，
+// 下一次 Start 不再监听配置的地址
+func (tl *TCPListener) UseListener(ln net.Listener) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.inherited = ln
+}
+
+// SetTrustedProxies 设置允许发送PROXY protocol头部的对端IP范围，例如负载均衡器的地址。
+// 其他对端发送的头部被拒绝，unix 套接字的对端由文件权限限制，总是可信
+func (tl *TCPListener) SetTrustedProxies(prefixes []netip.Prefix) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.trusted = prefixes
+}
+
+// trustsPeer 检查直接相连的对端是否可以发送PROXY protocol头部
+func (tl *TCPListener) trustsPeer(addr net.Addr) bool {
+	switch a := addr.(type) {
+	case *net.UnixAddr:
+		return true
+	case *net.TCPAddr:
+		ip := a.AddrPort().Addr().Unmap()
+		tl.mu.RLock()
+		defer tl.mu.RUnlock()
+		for _, p := range tl.trusted {
+			if p.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Start 启动TCP监听器
 func (tl *TCPListener) Start() error {
 	tl.mu.Lock()
@@ -71,16 +127,24 @@ func (tl *TCPListener) Start() error {
 		return fmt.Errorf("TCP listener is already running")
 	}
 
-	addr := fmt.Sprintf("%s:%d", tl.config.GetAddress(), tl.config.GetPort())
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		return fmt.Errorf("failed to start TCP listener on %s: %w", addr, err)
+	listener := tl.inherited
+	tl.inherited = nil
+	if listener == nil {
+		// 地址带 unix: 前缀时监听 unix 套接字，忽略端口
+		addr := tl.config.GetAddress()
+		if _, ok := SocketPath(addr); !ok {
+			addr = net.JoinHostPort(addr, strconv.Itoa(tl.config.GetPort()))
+		}
+		var err error
+		if listener, err = Listen(addr); err != nil {
+			return fmt.Errorf("failed to start TCP listener on %s: %w", addr, err)
+		}
 	}
 
 	tl.listener = listener
 	tl.isRunning = true
 
-	tl.logInfo("TCP listener started on %s", addr)
+	tl.logInfo("TCP listener started on %s", tl.GetAddress())
 
 	// 启动接受连接的goroutine
 	tl.wg.Add(tl.config.GetThreads())
@@ -91,32 +155,73 @@ func (tl *TCPListener) Start() error {
 	return nil
 }
 
-// Stop 停止TCP监听器
+// Stop 停止TCP监听器，等待所有正在处理的流完成
 func (tl *TCPListener) Stop() error {
-	tl.mu.Lock()
-	defer tl.mu.Unlock()
+	return tl.Shutdown(context.Background())
+}
 
+// Shutdown 优雅关闭TCP监听器：停止接受新连接，立即关闭空闲的keep-alive连接，
+// 等待正在处理的流完成后刷新流存储。ctx 到期时强制关闭剩余的连接并返回 ctx 的错误
+func (tl *TCPListener) Shutdown(ctx context.Context) error {
+	tl.mu.Lock()
 	if !tl.isRunning {
+		tl.mu.Unlock()
 		return nil
 	}
-
 	tl.logInfo("Stopping TCP listener...")
 
-	// 取消context
+	// 停止接受新连接
 	tl.cancel()
-
-	// 关闭监听器
 	if tl.listener != nil {
 		tl.listener.Close()
 	}
-
 	tl.isRunning = false
+	tl.mu.Unlock()
+
+	// 关闭空闲连接，其余连接处理完当前请求后关闭
+	tl.connMu.Lock()
+	tl.draining = true
+	active := len(tl.conns)
+	for c := range tl.conns {
+		c.drain()
+	}
+	tl.connMu.Unlock()
+	if active > 0 {
+		tl.logInfo("Waiting for %d connections to finish", active)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		tl.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		tl.connMu.Lock()
+		tl.logInfo("Shutdown deadline exceeded, closing %d connections", len(tl.conns))
+		for c := range tl.conns {
+			c.Conn.Close()
+		}
+		tl.connMu.Unlock()
+	}
 
-	// 等待所有goroutine结束
-	tl.wg.Wait()
+	// 刷新流存储，ctx 已到期时仍尽量写出已记录的流
+	if s, ok := tl.handler.(interface{ GetFlowStore() *flow.Store }); ok {
+		flushCtx := ctx
+		if err != nil {
+			flushCtx = context.WithoutCancel(ctx)
+		}
+		if ferr := s.GetFlowStore().Flush(flushCtx); ferr != nil {
+			tl.logError("Failed to flush flow store: %v", ferr)
+		}
+	}
 
 	tl.logInfo("TCP listener stopped")
-	return nil
+	return err
 }
 
 // IsRunning 检查监听器是否正在运行
@@ -126,18 +231,27 @@ func (tl *TCPListener) IsRunning() bool {
 	return tl.isRunning
 }
 
-// GetAddress 获取监听地址
+// GetAddress 获取监听地址，unix 套接字返回 unix:path
 func (tl *TCPListener) GetAddress() string {
 	if tl.listener != nil {
+		if addr, ok := tl.listener.Addr().(*net.UnixAddr); ok {
+			return UnixPrefix + addr.Name
+		}
 		return tl.listener.Addr().String()
 	}
-	return fmt.Sprintf("%s:%d", tl.config.GetAddress(), tl.config.GetPort())
+	if _, ok := SocketPath(tl.config.GetAddress()); ok {
+		return tl.config.GetAddress()
+	}
+	return net.JoinHostPort(tl.config.GetAddress(), strconv.Itoa(tl.config.GetPort()))
 }
 
 // acceptConnections 接受连接的主循环
 func (tl *TCPListener) acceptConnections() {
 	defer tl.wg.Done()
 
+	// delay 文件描述符耗尽后重试接受连接的等待时间
+	var delay time.Duration
+
 	for {
 		select {
 		case <-tl.ctx.Done():
@@ -159,12 +273,25 @@ func (tl *TCPListener) acceptConnections() {
 					return
 				}
 
+				// 文件描述符耗尽时暂停接受新连接，等待已有连接关闭，避免空转
+				if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) {
+					if delay == 0 {
+						delay = 5 * time.Millisecond
+					} else {
+						delay = min(2*delay, time.Second)
+					}
+					tl.handleError(fmt.Errorf("accept connection failed, retrying in %v: %w", delay, err), "acceptConnections")
+					time.Sleep(delay)
+					continue
+				}
+
 				// 处理其他错误
 				tl.handleError(fmt.Errorf("accept connection failed: %w", err), "acceptConnections")
 				continue
 			}
 
 			// 处理新连接
+			delay = 0
 			tl.wg.Add(1)
 			go tl.handleConnection(conn)
 		}
@@ -178,6 +305,30 @@ func (tl *TCPListener) handleConnection(conn net.Conn) {
 
 	startTime := time.Now()
 
+	// 解析PROXY protocol头部，还原真实客户端地址。只有可信代理可以发送头部，
+	// 否则任何客户端都可以伪造来源地址绕过客户端白名单和限流
+	if tl.config.IsProxyProtocolEnabled() {
+		trusted := tl.trustsPeer(conn.RemoteAddr())
+		ppConn, err := proxyproto.NewConn(conn, false, tl.config.GetReadTimeout())
+		if err != nil {
+			tl.handleError(fmt.Errorf("read PROXY protocol header from %s: %w", conn.RemoteAddr(), err), "handleConnection")
+			return
+		}
+		if ppConn.Header() != nil && !trusted {
+			tl.handleError(fmt.Errorf("reject PROXY protocol header from untrusted peer %s", conn.RemoteAddr()), "handleConnection")
+			return
+		}
+		conn = ppConn
+	}
+
+	// 关闭过程中不再处理新连接
+	tracked := tl.track(conn)
+	if tracked == nil {
+		return
+	}
+	defer tl.untrack(tracked)
+	conn = tracked
+
 	// 创建连接信息
 	connInfo := &ConnectionInfo{
 		LocalAddr:    conn.LocalAddr(),
@@ -204,6 +355,25 @@ func (tl *TCPListener) handleConnection(conn net.Conn) {
 	tl.handler.OnConnectionEnd(conn, duration)
 }
 
+// track 开始跟踪连接，监听器正在关闭时返回nil
+func (tl *TCPListener) track(conn net.Conn) *trackedConn {
+	tl.connMu.Lock()
+	defer tl.connMu.Unlock()
+	if tl.draining {
+		return nil
+	}
+	c := &trackedConn{Conn: conn}
+	tl.conns[c] = struct{}{}
+	return c
+}
+
+// untrack 停止跟踪连接
+func (tl *TCPListener) untrack(c *trackedConn) {
+	tl.connMu.Lock()
+	defer tl.connMu.Unlock()
+	delete(tl.conns, c)
+}
+
 // handleError 处理错误
 func (tl *TCPListener) handleError(err error, context string) {
 	if tl.handler != nil {
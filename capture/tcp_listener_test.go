@@ -0,0 +1,727 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/auth"
+	"github.com/f-dong/sniffy/capture/ebpf"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/limits"
+	"github.com/f-dong/sniffy/capture/procinfo"
+	"github.com/f-dong/sniffy/capture/proxyproto"
+	"github.com/f-dong/sniffy/capture/redact"
+	"github.com/f-dong/sniffy/capture/transparent"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/proxy"
+)
+
+// --- 辅助函数 ---
+
+// testConfig 监听本机随机端口的配置
+type testConfig struct{}
+
+func (testConfig) GetAddress() string             { return "127.0.0.1" }
+func (testConfig) GetPort() int                   { return 0 }
+func (testConfig) GetBufferSize() int             { return 4096 }
+func (testConfig) GetReadTimeout() time.Duration  { return 5 * time.Second }
+func (testConfig) GetWriteTimeout() time.Duration { return 5 * time.Second }
+func (testConfig) IsLoggingEnabled() bool         { return false }
+func (testConfig) GetThreads() int                { return 1 }
+func (testConfig) IsProxyProtocolEnabled() bool   { return false }
+func (testConfig) IsProcessLookupEnabled() bool   { return false }
+
+// socketConfig 监听 unix 套接字的配置
+type socketConfig struct {
+	testConfig
+	path string
+}
+
+func (c socketConfig) GetAddress() string { return UnixPrefix + c.path }
+
+// ipv6Config 监听IPv6回环地址的配置
+type ipv6Config struct{ testConfig }
+
+func (ipv6Config) GetAddress() string { return "::1" }
+
+// proxyConfig 解析PROXY protocol头部的配置
+type proxyConfig struct{ testConfig }
+
+func (proxyConfig) IsProxyProtocolEnabled() bool { return true }
+
+// startListener 按 setup 配置处理器后启动代理，返回监听器和记录刷新次数的计数器
+func startListener(t *testing.T, setup ...func(*SimplePacketHandler)) (*TCPListener, *atomic.Int32) {
+	t.Helper()
+	handler := NewDefaultPacketHandler(testConfig{})
+	for _, fn := range setup {
+		fn(handler)
+	}
+	flushed := &atomic.Int32{}
+	handler.GetFlowStore().OnFlush(func(context.Context) error {
+		flushed.Add(1)
+		return nil
+	})
+	tl := NewTCPListenerWithHandler(testConfig{}, handler)
+	require.NoError(t, tl.Start())
+	t.Cleanup(func() { tl.Stop() })
+	return tl, flushed
+}
+
+// sendRequest 通过代理连接发送GET请求
+func sendRequest(t *testing.T, conn net.Conn, rawURL string) {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\n\r\n", rawURL, u.Host)
+	require.NoError(t, err)
+}
+
+// --- 测试代码 ---
+
+func TestTCPListener_ShutdownDrains(t *testing.T) {
+	started := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			time.Sleep(300 * time.Millisecond)
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+	tl, flushed := startListener(t)
+
+	// 完成一个请求后保持空闲的keep-alive连接
+	idle, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer idle.Close()
+	idleReader := bufio.NewReader(idle)
+	sendRequest(t, idle, upstream.URL+"/")
+	resp, err := http.ReadResponse(idleReader, nil)
+	require.NoError(t, err)
+	io.ReadAll(resp.Body)
+	require.False(t, resp.Close)
+
+	// 关闭时正在处理的请求
+	busy, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer busy.Close()
+	sendRequest(t, busy, upstream.URL+"/slow")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- tl.Shutdown(ctx) }()
+
+	// 空闲连接立即关闭
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idleReader.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+
+	// 新连接被拒绝
+	require.Eventually(t, func() bool {
+		c, err := net.Dial("tcp", tl.GetAddress())
+		if err != nil {
+			return true
+		}
+		c.Close()
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	// 正在处理的请求完成后关闭连接
+	busyReader := bufio.NewReader(busy)
+	resp, err = http.ReadResponse(busyReader, nil)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	require.Equal(t, "ok", string(body))
+	_, err = busyReader.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+
+	require.NoError(t, <-shutdown)
+	require.False(t, tl.IsRunning())
+	require.Equal(t, int32(1), flushed.Load())
+	require.Equal(t, 2, tl.GetHandler().(*SimplePacketHandler).GetFlowStore().Len())
+}
+
+func TestTCPListener_ShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+	tl, flushed := startListener(t)
+
+	conn, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	sendRequest(t, conn, upstream.URL+"/hang")
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = tl.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, int32(1), flushed.Load())
+
+	// 剩余连接被强制关闭
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+
+	// 重复关闭不会出错
+	require.NoError(t, tl.Shutdown(context.Background()))
+}
+
+func TestTCPListener_StreamLargeBody(t *testing.T) {
+	big := bytes.Repeat([]byte("0123456789abcdef"), 16<<10)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			n, _ := io.Copy(io.Discard, r.Body)
+			fmt.Fprint(w, n)
+			return
+		}
+		// 先发出一部分，长度未知时以chunked转发
+		w.Write(big[:1024])
+		w.(http.Flusher).Flush()
+		w.Write(big[1024:])
+	}))
+	defer upstream.Close()
+	spillDir := t.TempDir()
+	tl, _ := startListener(t, func(h *SimplePacketHandler) {
+		h.SetBodyPolicy(&flow.BodyPolicy{Limit: 4096, SpillDir: spillDir})
+	})
+	handler := tl.GetHandler().(*SimplePacketHandler)
+	store := handler.GetFlowStore()
+
+	conn, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	sendRequest(t, conn, upstream.URL+"/big")
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, big, body)
+	require.False(t, resp.Close)
+
+	require.Eventually(t, func() bool { return store.Len() == 1 }, time.Second, 10*time.Millisecond)
+	f := store.List()[0]
+	require.Len(t, f.Response.Body, 4096)
+	require.True(t, f.Response.Truncated())
+	require.Equal(t, int64(len(big)), f.Response.BodyLen())
+	spilled, err := os.ReadFile(f.Response.BodyFile)
+	require.NoError(t, err)
+	require.Equal(t, big, spilled)
+
+	// 超过限制的请求体同样流式转发，完成后关闭客户端连接
+	_, err = fmt.Fprintf(conn, "POST %s/upload HTTP/1.1\r\nHost: %s\r\nContent-Length: %d\r\n\r\n",
+		upstream.URL, upstream.Listener.Addr(), len(big))
+	require.NoError(t, err)
+	_, err = conn.Write(big)
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	require.Equal(t, fmt.Sprint(len(big)), string(body))
+	require.True(t, resp.Close)
+
+	require.Eventually(t, func() bool { return store.Len() == 2 }, time.Second, 10*time.Millisecond)
+	f = store.List()[1]
+	require.True(t, f.Request.Truncated())
+	require.Equal(t, int64(len(big)), f.Request.BodyLen())
+	require.False(t, f.Response.Truncated())
+}
+
+func TestTCPListener_ConcurrencyLimits(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+	defer close(release)
+	tl, _ := startListener(t, func(h *SimplePacketHandler) {
+		h.SetLimiter(limits.New(2, 1))
+	})
+
+	busy, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer busy.Close()
+	sendRequest(t, busy, upstream.URL+"/slow")
+	<-started
+
+	// 同一源站的第二个请求返回503
+	second, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer second.Close()
+	sendRequest(t, second, upstream.URL+"/other")
+	resp, err := http.ReadResponse(bufio.NewReader(second), nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	// 超出连接上限的连接被重置
+	third, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer third.Close()
+	third.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = third.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.False(t, errors.Is(err, os.ErrDeadlineExceeded))
+
+	st := tl.GetHandler().(*SimplePacketHandler).GetLimiter().Stats()
+	require.Equal(t, int64(1), st.RejectedConns)
+	require.Equal(t, int64(1), st.RejectedRequests)
+}
+
+func TestTCPListener_NamedListener(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	main := NewDefaultPacketHandler(testConfig{})
+	handler, err := main.ForListener("api", "http", nil)
+	require.NoError(t, err)
+	require.Same(t, main.GetFlowStore(), handler.GetFlowStore())
+	tl := NewTCPListenerWithHandler(testConfig{}, handler)
+	require.NoError(t, tl.Start())
+	defer tl.Stop()
+
+	conn, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	sendRequest(t, conn, upstream.URL+"/")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Eventually(t, func() bool { return main.GetFlowStore().Len() == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, "api", main.GetFlowStore().List()[0].Listener)
+
+	// http 模式的监听器拒绝其他协议
+	conn, err = net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte{0x05, 0x01, 0x00})
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+
+	_, err = main.ForListener("bad", "reverse", nil)
+	require.Error(t, err)
+}
+
+func TestTCPListener_Transparent(t *testing.T) {
+	if !transparent.Supported {
+		t.Skip("transparent mode is only supported on Linux")
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host+r.URL.Path)
+	}))
+	defer upstream.Close()
+	target := upstream.Listener.Addr().(*net.TCPAddr)
+
+	// 测试环境没有 iptables，由测试提供原目标地址
+	var dst atomic.Pointer[net.TCPAddr]
+	dst.Store(target)
+	originalDst = func(net.Conn) (*net.TCPAddr, error) { return dst.Load(), nil }
+	defer func() { originalDst = transparent.OriginalDst }()
+
+	main := NewDefaultPacketHandler(testConfig{})
+	handler, err := main.ForListener("docker", "transparent", nil)
+	require.NoError(t, err)
+	tl := NewTCPListenerWithHandler(testConfig{}, handler)
+	require.NoError(t, tl.Start())
+	defer tl.Stop()
+
+	// 客户端发送 origin-form 请求，代理连接原目标地址而不是 Host 头部指定的主机
+	conn, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET /docker HTTP/1.1\r\nHost: app.internal\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, "app.internal/docker", string(body))
+	require.Eventually(t, func() bool { return main.GetFlowStore().Len() == 1 }, time.Second, 10*time.Millisecond)
+	f := main.GetFlowStore().List()[0]
+	require.Equal(t, "http://app.internal/docker", f.Request.URL)
+	require.Equal(t, "docker", f.Listener)
+
+	// 没有经过重定向、目标为监听器自己的连接被拒绝
+	dst.Store(tl.listener.Addr().(*net.TCPAddr))
+	conn, err = net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestTCPListener_EBPF(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host+r.URL.Path)
+	}))
+	defer upstream.Close()
+	target := upstream.Listener.Addr().(*net.TCPAddr)
+
+	// 由测试提供程序记录的原目标地址和进程
+	redirectOrigin = func(*ebpf.Redirector, net.Conn) (*ebpf.Origin, error) {
+		return &ebpf.Origin{Dst: target, Process: &procinfo.Process{PID: 42, Name: "curl", Cgroup: "/system.slice/app.service"}}, nil
+	}
+	defer func() { redirectOrigin = (*ebpf.Redirector).Origin }()
+
+	main := NewDefaultPacketHandler(testConfig{})
+	_, err := main.ForListener("capture", "ebpf", nil)
+	require.ErrorContains(t, err, "requires attached eBPF programs")
+	main.SetRedirector(&ebpf.Redirector{})
+	handler, err := main.ForListener("capture", "ebpf", nil)
+	require.NoError(t, err)
+	tl := NewTCPListenerWithHandler(testConfig{}, handler)
+	require.NoError(t, tl.Start())
+	defer tl.Stop()
+
+	conn, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET /ebpf HTTP/1.1\r\nHost: app.internal\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, "app.internal/ebpf", string(body))
+	require.Eventually(t, func() bool { return main.GetFlowStore().Len() == 1 }, time.Second, 10*time.Millisecond)
+	f := main.GetFlowStore().List()[0]
+	require.Equal(t, "capture", f.Listener)
+	require.Equal(t, "curl", f.Process.Name)
+	require.Equal(t, "/system.slice/app.service", f.Process.Cgroup)
+}
+
+func TestTCPListener_UnixSocket(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	// 上次运行遗留的套接字文件被删除
+	path := filepath.Join(t.TempDir(), "sniffy.sock")
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	config := socketConfig{path: path}
+	tl := NewTCPListenerWithHandler(config, NewDefaultPacketHandler(config))
+	require.NoError(t, tl.Start())
+	require.Equal(t, "unix:"+path, tl.GetAddress())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// 正在使用的套接字不会被删除
+	_, err = Listen("unix:" + path)
+	require.ErrorContains(t, err, "already in use")
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	sendRequest(t, conn, upstream.URL+"/")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(body))
+	conn.Close()
+
+	require.NoError(t, tl.Stop())
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// 不是套接字的文件保持不变
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	_, err = Listen("unix:" + path)
+	require.ErrorContains(t, err, "not a unix socket")
+
+	// 不支持 Windows 命名管道
+	for _, address := range []string{"npipe:////./pipe/sniffy", `\\.\pipe\sniffy`} {
+		_, err = Listen(address)
+		require.ErrorContains(t, err, "windows named pipes are not supported", address)
+	}
+}
+
+func TestTCPListener_IPv6(t *testing.T) {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback not available")
+	}
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	upstream.Listener.Close()
+	upstream.Listener = ln
+	upstream.Start()
+	defer upstream.Close()
+
+	config := ipv6Config{}
+	tl := NewTCPListenerWithHandler(config, NewDefaultPacketHandler(config))
+	require.NoError(t, tl.Start())
+	defer tl.Stop()
+	require.True(t, strings.HasPrefix(tl.GetAddress(), "[::1]:"), tl.GetAddress())
+
+	// 绝对URL中带方括号的IPv6地址
+	conn, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	sendRequest(t, conn, upstream.URL+"/")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(body))
+
+	// CONNECT 到IPv6地址的隧道
+	conn, err = net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	target := ln.Addr().String()
+	_, err = fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	require.NoError(t, err)
+	br := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", target)
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(body))
+}
+
+func TestTCPListener_UntrustedProxyHeader(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	config := proxyConfig{}
+	handler := NewDefaultPacketHandler(config)
+	tl := NewTCPListenerWithHandler(config, handler)
+	tl.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	require.NoError(t, tl.Start())
+	defer tl.Stop()
+
+	// send 发送声称来自 203.0.113.7 的头部和请求，返回读取响应的结果
+	send := func() (*http.Response, error) {
+		conn, err := net.Dial("tcp", tl.GetAddress())
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40000}
+		_, err = proxyproto.NewHeader(1, src, conn.RemoteAddr()).WriteTo(conn)
+		require.NoError(t, err)
+		sendRequest(t, conn, upstream.URL+"/")
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		return http.ReadResponse(bufio.NewReader(conn), nil)
+	}
+
+	// 不在可信范围内的对端发送的头部被拒绝，连接直接关闭
+	_, err := send()
+	require.Error(t, err)
+	require.False(t, errors.Is(err, os.ErrDeadlineExceeded))
+	require.Zero(t, handler.GetFlowStore().Len())
+
+	// 可信代理发送的头部还原客户端地址
+	tl.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})
+	resp, err := send()
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(body))
+
+	store := handler.GetFlowStore()
+	require.Eventually(t, func() bool { return store.Len() == 1 }, time.Second, 10*time.Millisecond)
+	f := store.List()[0]
+	require.Equal(t, "203.0.113.7:40000", f.ClientAddr)
+	require.True(t, strings.HasPrefix(f.PeerAddr, "127.0.0.1:"), f.PeerAddr)
+}
+
+func TestTCPListener_ProxyHeaderAllowlist(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	config := proxyConfig{}
+	handler := NewDefaultPacketHandler(config)
+	a := auth.New("sniffy")
+	require.NoError(t, a.AllowClient("203.0.113.0/24"))
+	handler.SetAuth(a)
+	tl := NewTCPListenerWithHandler(config, handler)
+	require.NoError(t, tl.Start())
+	defer tl.Stop()
+
+	// send 发送声称来自 src 的头部（为空时不发送）和请求，返回是否收到响应
+	send := func(src string) bool {
+		conn, err := net.Dial("tcp", tl.GetAddress())
+		require.NoError(t, err)
+		defer conn.Close()
+		if src != "" {
+			addr, err := net.ResolveTCPAddr("tcp", src)
+			require.NoError(t, err)
+			_, err = proxyproto.NewHeader(2, addr, conn.RemoteAddr()).WriteTo(conn)
+			require.NoError(t, err)
+		}
+		sendRequest(t, conn, upstream.URL+"/")
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = http.ReadResponse(bufio.NewReader(conn), nil)
+		return err == nil
+	}
+
+	// 未配置可信代理时，伪造白名单内的来源地址不能绕过白名单
+	require.False(t, send(""))
+	require.False(t, send("203.0.113.7:40000"))
+
+	// 可信代理转发的连接按头部中的客户端地址判断
+	tl.SetTrustedProxies([]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")})
+	require.True(t, send("203.0.113.7:40000"))
+	require.False(t, send("198.51.100.7:40000"))
+	require.False(t, send(""))
+}
+
+func TestTCPListener_RedactedEvents(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "sid=secret")
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+	rules := make([]*redact.Rule, 0, 2)
+	for _, s := range []string{"header:Authorization", "header/remove:Set-Cookie"} {
+		rule, err := redact.ParseRule(s)
+		require.NoError(t, err)
+		rules = append(rules, rule)
+	}
+	tl, _ := startListener(t, func(h *SimplePacketHandler) {
+		h.SetRedactor(redact.New(rules...))
+	})
+	events, cancel := tl.GetHandler().(*SimplePacketHandler).GetEvents().Subscribe(16, nil)
+	defer cancel()
+
+	conn, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = fmt.Fprintf(conn, "GET %s/ HTTP/1.1\r\nHost: %s\r\nAuthorization: Bearer secret\r\n\r\n", upstream.URL, upstream.Listener.Addr())
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	io.ReadAll(resp.Body)
+
+	// 订阅方收到的头部与保存的流一样经过脱敏
+	seen := map[flow.EventType]http.Header{}
+	for seen[flow.EventRequestStarted] == nil || seen[flow.EventResponseHeaders] == nil {
+		select {
+		case e := <-events:
+			seen[e.Type] = e.Header
+		case <-time.After(time.Second):
+			t.Fatalf("missing events, got %v", seen)
+		}
+	}
+	require.Equal(t, []string{redact.Mask}, seen[flow.EventRequestStarted]["Authorization"])
+	require.NotContains(t, seen[flow.EventResponseHeaders], "Set-Cookie")
+}
+
+func TestTCPListener_SOCKS5(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok "+r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	main := NewDefaultPacketHandler(testConfig{})
+	a := auth.New("")
+	a.AddUser("alice", "secret")
+	main.SetAuth(a)
+	handler, err := main.ForListener("socks", "socks5", nil)
+	require.NoError(t, err)
+	tl := NewTCPListenerWithHandler(testConfig{}, handler)
+	require.NoError(t, tl.Start())
+	defer tl.Stop()
+
+	// get 通过SOCKS5代理请求 upstream
+	get := func(user *proxy.Auth) (string, error) {
+		dialer, err := proxy.SOCKS5("tcp", tl.GetAddress(), user, proxy.Direct)
+		require.NoError(t, err)
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: dialer.(proxy.ContextDialer).DialContext,
+		}}
+		resp, err := client.Get(upstream.URL + "/socks")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	body, err := get(&proxy.Auth{User: "alice", Password: "secret"})
+	require.NoError(t, err)
+	require.Equal(t, "ok /socks", body)
+	store := main.GetFlowStore()
+	require.Eventually(t, func() bool { return store.Len() == 1 }, time.Second, 10*time.Millisecond)
+	f := store.List()[0]
+	require.Equal(t, "socks", f.Listener)
+	require.Equal(t, upstream.URL+"/socks", f.Request.URL)
+
+	// 错误的密码和不提供认证的客户端被拒绝
+	_, err = get(&proxy.Auth{User: "alice", Password: "wrong"})
+	require.Error(t, err)
+	_, err = get(nil)
+	require.Error(t, err)
+
+	// 不支持的命令
+	conn, err := net.Dial("tcp", tl.GetAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	_, err = conn.Write([]byte{0x05, 0x01, 0x02, 0x01, 5, 'a', 'l', 'i', 'c', 'e', 6, 's', 'e', 'c', 'r', 'e', 't'})
+	require.NoError(t, err)
+	greeting := make([]byte, 4)
+	_, err = io.ReadFull(conn, greeting)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x05, 0x02, 0x01, 0x00}, greeting)
+	// BIND 127.0.0.1:80
+	_, err = conn.Write([]byte{0x05, 0x02, 0x00, 0x01, 127, 0, 0, 1, 0, 80})
+	require.NoError(t, err)
+	reply := make([]byte, 10)
+	_, err = io.ReadFull(conn, reply)
+	require.NoError(t, err)
+	require.Equal(t, byte(0x07), reply[1])
+}
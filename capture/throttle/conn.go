@@ -0,0 +1,117 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package throttle
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pacer 按固定速率放行字节，空闲时间不会累积为突发额度
+type pacer struct {
+	rate  float64
+	chunk int
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newPacer(rate int64) *pacer {
+	if rate <= 0 {
+		return nil
+	}
+	// 每次最多传输约50毫秒的数据，使速率平滑
+	return &pacer{rate: float64(rate), chunk: max(512, int(rate/20))}
+}
+
+// wait 记录传输了 n 字节，并等待到这些字节按速率应当传输完成的时刻
+func (p *pacer) wait(n int) {
+	if n <= 0 {
+		return
+	}
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	p.next = p.next.Add(time.Duration(float64(n) / p.rate * float64(time.Second)))
+	d := p.next.Sub(now)
+	p.mu.Unlock()
+	time.Sleep(d)
+}
+
+// Conn 模拟网络条件的连接：读取按下行带宽、写入按上行带宽限速，
+// 每次写入后的第一次读取额外等待一次往返延迟
+type Conn struct {
+	net.Conn
+	profile Profile
+	down    *pacer
+	up      *pacer
+
+	// wrote 上次写入后是否还没有读取，用于按请求-响应往返增加延迟
+	wrote atomic.Bool
+}
+
+// NewConn 返回按网络条件限速的连接
+func NewConn(conn net.Conn, p Profile) *Conn {
+	return &Conn{
+		Conn:    conn,
+		profile: p,
+		down:    newPacer(p.Down),
+		up:      newPacer(p.Up),
+	}
+}
+
+// Profile 返回连接的网络条件
+func (c *Conn) Profile() Profile {
+	return c.profile
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if c.wrote.Swap(false) {
+		if d := c.profile.delay(); d > 0 {
+			time.Sleep(d)
+		}
+	}
+	if c.down == nil {
+		return c.Conn.Read(b)
+	}
+	if len(b) > c.down.chunk {
+		b = b[:c.down.chunk]
+	}
+	n, err := c.Conn.Read(b)
+	c.down.wait(n)
+	return n, err
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	c.wrote.Store(true)
+	if c.up == nil {
+		return c.Conn.Write(b)
+	}
+	written := 0
+	for len(b) > 0 {
+		chunk := b[:min(len(b), c.up.chunk)]
+		n, err := c.Conn.Write(chunk)
+		written += n
+		c.up.wait(n)
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite 关闭底层TCP连接的写方向，隧道转发时使用
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package throttle
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// Profile 网络条件：上下行带宽、往返延迟和抖动
+type Profile struct {
+	// Name 预设名称，自定义条件为空
+	Name string
+
+	// Down 下行带宽（上游到代理），字节/秒，0 表示不限制
+	Down int64
+
+	// Up 上行带宽（代理到上游），字节/秒，0 表示不限制
+	Up int64
+
+	// Latency 每次请求-响应往返额外增加的延迟
+	Latency time.Duration
+
+	// Jitter 延迟的随机波动范围，实际延迟在 Latency±Jitter 之间
+	Jitter time.Duration
+}
+
+// kbit 每秒1千比特对应的字节数
+const kbit = 1000 / 8
+
+// presets 预设的网络条件，取值与浏览器开发者工具的网络限速预设一致
+var presets = map[string]Profile{
+	"gprs":    {Down: 50 * kbit, Up: 20 * kbit, Latency: 500 * time.Millisecond},
+	"2g":      {Down: 250 * kbit, Up: 50 * kbit, Latency: 300 * time.Millisecond},
+	"edge":    {Down: 450 * kbit, Up: 150 * kbit, Latency: 150 * time.Millisecond},
+	"3g":      {Down: 750 * kbit, Up: 250 * kbit, Latency: 100 * time.Millisecond},
+	"3g-good": {Down: 1500 * kbit, Up: 750 * kbit, Latency: 40 * time.Millisecond},
+	"4g":      {Down: 4000 * kbit, Up: 3000 * kbit, Latency: 20 * time.Millisecond},
+	"dsl":     {Down: 2000 * kbit, Up: 1000 * kbit, Latency: 5 * time.Millisecond},
+	"wifi":    {Down: 30000 * kbit, Up: 15000 * kbit, Latency: 2 * time.Millisecond},
+}
+
+// Presets 返回预设的名称
+func Presets() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Preset 返回预设的网络条件
+func Preset(name string) (Profile, bool) {
+	p, ok := presets[strings.ToLower(name)]
+	if ok {
+		p.Name = strings.ToLower(name)
+	}
+	return p, ok
+}
+
+// ParseProfile 解析网络条件，可以是预设名称，也可以是逗号分隔的选项，例如：
+//
+//	3g
+//	down=1mbit,up=256kbit,latency=80ms,jitter=20ms
+//	3g,jitter=50ms
+//
+// 带宽单位支持 bit、kbit、mbit、gbit（比特/秒）以及 b、kb、mb（字节/秒）
+func ParseProfile(s string) (Profile, error) {
+	var p Profile
+	for i, opt := range strings.Split(s, ",") {
+		opt = strings.TrimSpace(opt)
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok {
+			preset, found := Preset(opt)
+			if i != 0 || !found {
+				return Profile{}, fmt.Errorf("unknown network profile %q (presets: %s)", opt, strings.Join(Presets(), ", "))
+			}
+			p = preset
+			continue
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "down":
+			p.Down, err = ParseBandwidth(value)
+		case "up":
+			p.Up, err = ParseBandwidth(value)
+		case "latency":
+			p.Latency, err = time.ParseDuration(value)
+			if err == nil && p.Latency < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case "jitter":
+			p.Jitter, err = time.ParseDuration(value)
+			if err == nil && p.Jitter < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		default:
+			return Profile{}, fmt.Errorf("unknown network profile option %q (supported: down, up, latency, jitter)", key)
+		}
+		if err != nil {
+			return Profile{}, fmt.Errorf("invalid network profile option %q: %v", opt, err)
+		}
+		p.Name = ""
+	}
+	return p, nil
+}
+
+// bandwidthUnits 带宽单位对应的字节/秒倍数，按后缀长度降序匹配
+var bandwidthUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"gbit", 1e9 / 8},
+	{"mbit", 1e6 / 8},
+	{"kbit", 1e3 / 8},
+	{"bit", 1.0 / 8},
+	{"mb", 1 << 20},
+	{"kb", 1 << 10},
+	{"b", 1},
+}
+
+// ParseBandwidth 解析带有单位的带宽，返回字节/秒
+func ParseBandwidth(s string) (int64, error) {
+	lower := strings.ToLower(strings.TrimSpace(s))
+	for _, u := range bandwidthUnits {
+		num, ok := strings.CutSuffix(lower, u.suffix)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+		if err != nil || v < 0 {
+			break
+		}
+		return int64(v * u.bytes), nil
+	}
+	return 0, fmt.Errorf("invalid bandwidth %q (expected a number with unit bit, kbit, mbit, gbit, b, kb or mb)", s)
+}
+
+// String 返回网络条件的文本形式，预设返回预设名称
+func (p Profile) String() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	var opts []string
+	if p.Down > 0 {
+		opts = append(opts, "down="+formatBandwidth(p.Down))
+	}
+	if p.Up > 0 {
+		opts = append(opts, "up="+formatBandwidth(p.Up))
+	}
+	if p.Latency > 0 {
+		opts = append(opts, "latency="+p.Latency.String())
+	}
+	if p.Jitter > 0 {
+		opts = append(opts, "jitter="+p.Jitter.String())
+	}
+	return strings.Join(opts, ",")
+}
+
+func formatBandwidth(bytes int64) string {
+	return strconv.FormatFloat(float64(bytes)*8/1000, 'f', -1, 64) + "kbit"
+}
+
+// delay 返回一次往返的延迟
+func (p *Profile) delay() time.Duration {
+	d := p.Latency
+	if p.Jitter > 0 {
+		d += time.Duration(rand.Int64N(int64(2*p.Jitter)+1)) - p.Jitter
+	}
+	return max(d, 0)
+}
+
+// Rule 按主机应用的网络条件
+type Rule struct {
+	// Host 主机名模式，支持 "*.example.com"，"*" 匹配所有主机
+	Host string
+
+	// Profile 网络条件
+	Profile Profile
+}
+
+// ParseRule 解析 host=profile 形式的规则，profile 的格式见 ParseProfile
+func ParseRule(s string) (Rule, error) {
+	host, profile, ok := strings.Cut(s, "=")
+	host = strings.TrimSpace(host)
+	if !ok || host == "" {
+		return Rule{}, fmt.Errorf("invalid throttle rule %q (expected host=profile)", s)
+	}
+	p, err := ParseProfile(profile)
+	if err != nil {
+		return Rule{}, err
+	}
+	return Rule{Host: strings.ToLower(host), Profile: p}, nil
+}
+
+// String 返回规则的文本形式
+func (r Rule) String() string {
+	return r.Host + "=" + r.Profile.String()
+}
+
+// Shaper 按主机模拟网络条件，先添加的规则优先。nil Shaper 不限制任何连接
+type Shaper struct {
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// New 创建没有规则的Shaper
+func New() *Shaper {
+	return &Shaper{}
+}
+
+// Add 添加规则
+func (s *Shaper) Add(r Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, r)
+}
+
+// Rules 返回所有规则
+func (s *Shaper) Rules() []Rule {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Rule(nil), s.rules...)
+}
+
+// Match 返回主机适用的网络条件
+func (s *Shaper) Match(host string) (Profile, bool) {
+	if s == nil {
+		return Profile{}, false
+	}
+	host = strings.ToLower(host)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.rules {
+		if r.Host == "*" || tlsinfo.MatchHost(r.Host, host) {
+			return r.Profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// Wrap 返回按主机适用的网络条件限速的连接，没有适用的规则时原样返回
+func (s *Shaper) Wrap(host string, conn net.Conn) net.Conn {
+	p, ok := s.Match(host)
+	if !ok {
+		return conn
+	}
+	return NewConn(conn, p)
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package throttle
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// pipe 返回一对已连接的TCP连接
+func pipe(t *testing.T) (client, server net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	client, err = net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	server = <-accepted
+	require.NotNil(t, server)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+// --- 测试代码 ---
+
+func TestParseBandwidth(t *testing.T) {
+	for s, want := range map[string]int64{
+		"1mbit":   125000,
+		"256kbit": 32000,
+		"1.5Mbit": 187500,
+		"8bit":    1,
+		"64kb":    65536,
+		"2MB":     2 << 20,
+		"100b":    100,
+		"1gbit":   125000000,
+	} {
+		got, err := ParseBandwidth(s)
+		require.NoError(t, err, s)
+		require.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "100", "fast", "-1mbit", "1xbit"} {
+		_, err := ParseBandwidth(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	p, err := ParseProfile("3G")
+	require.NoError(t, err)
+	require.Equal(t, "3g", p.String())
+	require.Equal(t, int64(750*kbit), p.Down)
+	require.Equal(t, 100*time.Millisecond, p.Latency)
+
+	p, err = ParseProfile("3g,jitter=50ms")
+	require.NoError(t, err)
+	require.Equal(t, "down=750kbit,up=250kbit,latency=100ms,jitter=50ms", p.String())
+
+	p, err = ParseProfile("down=1mbit, latency=80ms")
+	require.NoError(t, err)
+	require.Equal(t, Profile{Down: 125000, Latency: 80 * time.Millisecond}, p)
+
+	for _, s := range []string{"", "5g", "latency=80ms,3g", "down=1mbit,loss=1%", "latency=-1s", "jitter=soon"} {
+		_, err := ParseProfile(s)
+		require.Error(t, err, s)
+	}
+	require.Contains(t, Presets(), "gprs")
+	require.Contains(t, Presets(), "dsl")
+}
+
+func TestShaper_Match(t *testing.T) {
+	s := New()
+	for _, r := range []string{"*.cdn.example.com=gprs", "API.example.com=latency=1s", "*=wifi"} {
+		rule, err := ParseRule(r)
+		require.NoError(t, err)
+		s.Add(rule)
+	}
+	require.Len(t, s.Rules(), 3)
+	require.Equal(t, "api.example.com=latency=1s", s.Rules()[1].String())
+
+	p, ok := s.Match("img.cdn.example.com")
+	require.True(t, ok)
+	require.Equal(t, "gprs", p.Name)
+	p, _ = s.Match("api.example.com")
+	require.Equal(t, time.Second, p.Latency)
+	p, _ = s.Match("example.org")
+	require.Equal(t, "wifi", p.Name)
+
+	var nilShaper *Shaper
+	_, ok = nilShaper.Match("example.org")
+	require.False(t, ok)
+	client, _ := pipe(t)
+	require.Same(t, client, nilShaper.Wrap("example.org", client))
+
+	_, err := ParseRule("3g")
+	require.Error(t, err)
+}
+
+func TestConn_Bandwidth(t *testing.T) {
+	client, server := pipe(t)
+	conn := NewConn(client, Profile{Down: 20000, Up: 20000})
+
+	go func() {
+		server.Write(make([]byte, 6000))
+	}()
+	start := time.Now()
+	_, err := io.ReadFull(conn, make([]byte, 6000))
+	require.NoError(t, err)
+	// 6000字节按20000字节/秒约需300毫秒
+	require.InDelta(t, 300, float64(time.Since(start).Milliseconds()), 120)
+
+	go io.Copy(io.Discard, server)
+	start = time.Now()
+	_, err = conn.Write(make([]byte, 4000))
+	require.NoError(t, err)
+	require.InDelta(t, 200, float64(time.Since(start).Milliseconds()), 100)
+}
+
+func TestConn_Latency(t *testing.T) {
+	client, server := pipe(t)
+	conn := NewConn(client, Profile{Latency: 150 * time.Millisecond})
+
+	go func() {
+		buf := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(server, buf); err != nil {
+				return
+			}
+			server.Write(buf)
+		}
+	}()
+
+	buf := make([]byte, 4)
+	for range 2 {
+		start := time.Now()
+		_, err := conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	}
+}
+
+func TestProfile_Jitter(t *testing.T) {
+	p := Profile{Latency: 100 * time.Millisecond, Jitter: 30 * time.Millisecond}
+	for range 100 {
+		d := p.delay()
+		require.GreaterOrEqual(t, d, 70*time.Millisecond)
+		require.LessOrEqual(t, d, 130*time.Millisecond)
+	}
+	p = Profile{Latency: 10 * time.Millisecond, Jitter: time.Second}
+	for range 100 {
+		require.GreaterOrEqual(t, p.delay(), time.Duration(0))
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package timeouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// Phase 超时的阶段
+type Phase string
+
+const (
+	// PhaseDial 连接上游，包括DNS解析和与上游代理的握手
+	PhaseDial Phase = "dial"
+
+	// PhaseTLSHandshake 与上游的TLS握手
+	PhaseTLSHandshake Phase = "tls_handshake"
+
+	// PhaseRequestHeader 读取客户端的请求头部
+	PhaseRequestHeader Phase = "request_header"
+
+	// PhaseResponseHeader 请求发出后等待上游的响应头部
+	PhaseResponseHeader Phase = "response_header"
+
+	// PhaseIdle keep-alive连接上等待下一个请求
+	PhaseIdle Phase = "idle"
+
+	// PhaseFlow 整个流，从读取请求头部到写完响应
+	PhaseFlow Phase = "flow"
+)
+
+// Timeouts 各阶段的超时，0 表示不限制
+type Timeouts struct {
+	Dial           time.Duration `json:"dial,omitempty"`
+	TLSHandshake   time.Duration `json:"tls_handshake,omitempty"`
+	RequestHeader  time.Duration `json:"request_header,omitempty"`
+	ResponseHeader time.Duration `json:"response_header,omitempty"`
+	Idle           time.Duration `json:"idle,omitempty"`
+	Flow           time.Duration `json:"flow,omitempty"`
+}
+
+// options 命令行选项名对应的字段
+var options = []struct {
+	name  string
+	field func(*Timeouts) *time.Duration
+}{
+	{"dial", func(t *Timeouts) *time.Duration { return &t.Dial }},
+	{"tls", func(t *Timeouts) *time.Duration { return &t.TLSHandshake }},
+	{"request-header", func(t *Timeouts) *time.Duration { return &t.RequestHeader }},
+	{"response-header", func(t *Timeouts) *time.Duration { return &t.ResponseHeader }},
+	{"idle", func(t *Timeouts) *time.Duration { return &t.Idle }},
+	{"flow", func(t *Timeouts) *time.Duration { return &t.Flow }},
+}
+
+// Parse 解析逗号分隔的超时选项，例如：
+//
+//	dial=5s,tls=5s,request-header=10s,response-header=30s,idle=90s,flow=2m
+func Parse(s string) (Timeouts, error) {
+	var t Timeouts
+	for _, opt := range strings.Split(s, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(opt, "=")
+		field := lookup(strings.ToLower(strings.TrimSpace(key)))
+		if !ok || field == nil {
+			return Timeouts{}, fmt.Errorf("unknown timeout option %q (supported: dial, tls, request-header, response-header, idle, flow)", opt)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d < 0 {
+			return Timeouts{}, fmt.Errorf("invalid timeout %q", opt)
+		}
+		*field(&t) = d
+	}
+	return t, nil
+}
+
+func lookup(name string) func(*Timeouts) *time.Duration {
+	for _, o := range options {
+		if o.name == name {
+			return o.field
+		}
+	}
+	return nil
+}
+
+// String 返回超时的文本形式，省略为0的阶段
+func (t Timeouts) String() string {
+	var opts []string
+	for _, o := range options {
+		if d := *o.field(&t); d > 0 {
+			opts = append(opts, o.name+"="+d.String())
+		}
+	}
+	return strings.Join(opts, ",")
+}
+
+// Override 返回用 o 中不为0的阶段覆盖后的超时
+func (t Timeouts) Override(o Timeouts) Timeouts {
+	for _, opt := range options {
+		if d := *opt.field(&o); d > 0 {
+			*opt.field(&t) = d
+		}
+	}
+	return t
+}
+
+// Rule 按主机覆盖的超时
+type Rule struct {
+	// Host 主机名模式，支持 "*.example.com"
+	Host string
+
+	// Timeouts 覆盖的超时，为0的阶段使用全局超时
+	Timeouts Timeouts
+}
+
+// ParseRule 解析 host=options 形式的规则，options 的格式见 Parse
+func ParseRule(s string) (Rule, error) {
+	host, opts, ok := strings.Cut(s, "=")
+	host = strings.TrimSpace(host)
+	if !ok || host == "" {
+		return Rule{}, fmt.Errorf("invalid host timeout %q (expected host=option=duration[,...])", s)
+	}
+	t, err := Parse(opts)
+	if err != nil {
+		return Rule{}, err
+	}
+	return Rule{Host: strings.ToLower(host), Timeouts: t}, nil
+}
+
+// String 返回规则的文本形式
+func (r Rule) String() string {
+	return r.Host + "=" + r.Timeouts.String()
+}
+
+// Policy 全局超时和按主机的覆盖规则，先添加的规则优先，并发安全。
+// nil Policy 的所有超时为0
+type Policy struct {
+	mu     sync.RWMutex
+	global Timeouts
+	rules  []Rule
+}
+
+// New 创建使用全局超时的策略
+func New(global Timeouts) *Policy {
+	return &Policy{global: global}
+}
+
+// Add 添加按主机的覆盖规则
+func (p *Policy) Add(r Rule) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = append(p.rules, r)
+}
+
+// Replace 用另一个策略的超时原子地替换当前超时，other 为nil时所有超时为0。
+// 已经开始的阶段继续使用旧的超时
+func (p *Policy) Replace(other *Policy) {
+	global, rules := other.Global(), other.Rules()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.global, p.rules = global, rules
+}
+
+// Global 返回全局超时，用于读取请求头部等主机未知的阶段
+func (p *Policy) Global() Timeouts {
+	if p == nil {
+		return Timeouts{}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.global
+}
+
+// Rules 返回所有覆盖规则
+func (p *Policy) Rules() []Rule {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]Rule(nil), p.rules...)
+}
+
+// For 返回主机适用的超时，host 可以带端口
+func (p *Policy) For(host string) Timeouts {
+	if p == nil {
+		return Timeouts{}
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, r := range p.rules {
+		if r.Host == "*" || tlsinfo.MatchHost(r.Host, host) {
+			return p.global.Override(r.Timeouts)
+		}
+	}
+	return p.global
+}
+
+// Error 某个阶段超时的错误
+type Error struct {
+	// Phase 超时的阶段
+	Phase Phase
+
+	// Limit 该阶段的超时
+	Limit time.Duration
+
+	// Err 底层错误
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s timeout after %s", strings.ReplaceAll(string(e.Phase), "_", " "), e.Limit)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Timeout 实现 net.Error 接口
+func (e *Error) Timeout() bool {
+	return true
+}
+
+// Temporary 实现 net.Error 接口
+func (e *Error) Temporary() bool {
+	return false
+}
+
+// Wrap 如果 err 是超时错误，返回标记为 phase 阶段超时的错误，否则原样返回。
+// 已经标记了阶段的错误不会被重复标记
+func Wrap(err error, phase Phase, timeout time.Duration) error {
+	if err == nil || timeout <= 0 || !IsTimeout(err) {
+		return err
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Phase: phase, Limit: timeout, Err: err}
+}
+
+// IsTimeout 判断错误是否由超时引起
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// PhaseOf 返回错误标记的超时阶段，不是超时错误时返回空
+func PhaseOf(err error) Phase {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Phase
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package timeouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+
+func TestParse(t *testing.T) {
+	tm, err := Parse("dial=5s, TLS=3s,request-header=10s,response-header=30s,idle=90s,flow=2m")
+	require.NoError(t, err)
+	require.Equal(t, Timeouts{
+		Dial:           5 * time.Second,
+		TLSHandshake:   3 * time.Second,
+		RequestHeader:  10 * time.Second,
+		ResponseHeader: 30 * time.Second,
+		Idle:           90 * time.Second,
+		Flow:           2 * time.Minute,
+	}, tm)
+	require.Equal(t, "dial=5s,tls=3s,request-header=10s,response-header=30s,idle=1m30s,flow=2m0s", tm.String())
+
+	tm, err = Parse("")
+	require.NoError(t, err)
+	require.Zero(t, tm)
+
+	for _, s := range []string{"dial", "connect=5s", "dial=soon", "flow=-1s"} {
+		_, err := Parse(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestPolicy_For(t *testing.T) {
+	p := New(Timeouts{Dial: 5 * time.Second, ResponseHeader: 30 * time.Second})
+	for _, s := range []string{"*.slow.example.com=response-header=2m,flow=5m", "API.example.com=dial=1s"} {
+		r, err := ParseRule(s)
+		require.NoError(t, err)
+		p.Add(r)
+	}
+	require.Equal(t, "api.example.com=dial=1s", p.Rules()[1].String())
+
+	require.Equal(t, Timeouts{Dial: 5 * time.Second, ResponseHeader: 2 * time.Minute, Flow: 5 * time.Minute},
+		p.For("reports.slow.example.com:443"))
+	require.Equal(t, Timeouts{Dial: time.Second, ResponseHeader: 30 * time.Second}, p.For("api.example.com"))
+	require.Equal(t, p.Global(), p.For("example.org:80"))
+
+	var nilPolicy *Policy
+	require.Zero(t, nilPolicy.For("example.org"))
+	require.Zero(t, nilPolicy.Global())
+
+	other := New(Timeouts{Idle: time.Minute})
+	other.Replace(p)
+	require.Equal(t, Timeouts{Dial: time.Second, ResponseHeader: 30 * time.Second}, other.For("api.example.com"))
+	other.Replace(nil)
+	require.Zero(t, other.For("api.example.com"))
+
+	for _, s := range []string{"", "=dial=1s", "example.com", "example.com=dial"} {
+		_, err := ParseRule(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	_, err := net.DialTimeout("tcp", "192.0.2.1:80", time.Nanosecond)
+	require.True(t, IsTimeout(err))
+
+	wrapped := Wrap(err, PhaseDial, 5*time.Second)
+	require.Equal(t, PhaseDial, PhaseOf(wrapped))
+	require.ErrorIs(t, wrapped, err)
+	require.Contains(t, wrapped.Error(), "dial timeout after 5s")
+
+	// 已标记阶段的错误保留原阶段
+	require.Equal(t, PhaseDial, PhaseOf(Wrap(fmt.Errorf("read: %w", wrapped), PhaseFlow, time.Minute)))
+
+	ctxErr := Wrap(context.DeadlineExceeded, PhaseResponseHeader, time.Second)
+	require.Equal(t, "response header timeout after 1s: context deadline exceeded", ctxErr.Error())
+
+	// 非超时错误和未设置的超时不标记
+	refused := errors.New("connection refused")
+	require.Same(t, refused, Wrap(refused, PhaseDial, time.Second))
+	require.Equal(t, err, Wrap(err, PhaseDial, 0))
+	require.Empty(t, PhaseOf(refused))
+}
@@ -0,0 +1,295 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tlsinfo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// TLS 扩展类型
+const (
+	ExtServerName          uint16 = 0
+	ExtSupportedGroups     uint16 = 10
+	ExtECPointFormats      uint16 = 11
+	ExtSignatureAlgorithms uint16 = 13
+	ExtALPN                uint16 = 16
+	ExtSupportedVersions   uint16 = 43
+)
+
+const (
+	recordTypeHandshake   = 0x16
+	handshakeClientHello  = 0x01
+	recordHeaderLength    = 5
+	handshakeHeaderLength = 4
+)
+
+// ErrNotClientHello 数据不是TLS ClientHello
+var ErrNotClientHello = errors.New("tlsinfo: not a TLS ClientHello")
+
+// ClientHello 解析后的TLS ClientHello
+type ClientHello struct {
+	// Version 记录层之后握手消息中的客户端版本
+	Version uint16 `json:"version"`
+
+	// ServerName SNI主机名
+	ServerName string `json:"server_name,omitempty"`
+
+	// ALPN 客户端声明的应用层协议
+	ALPN []string `json:"alpn,omitempty"`
+
+	// CipherSuites 密码套件，保持客户端顺序
+	CipherSuites []uint16 `json:"cipher_suites"`
+
+	// CompressionMethods 压缩方法
+	CompressionMethods []uint8 `json:"compression_methods,omitempty"`
+
+	// Extensions 扩展类型，保持客户端顺序
+	Extensions []uint16 `json:"extensions"`
+
+	// SupportedGroups 支持的椭圆曲线/密钥交换组
+	SupportedGroups []uint16 `json:"supported_groups,omitempty"`
+
+	// ECPointFormats 椭圆曲线点格式
+	ECPointFormats []uint8 `json:"ec_point_formats,omitempty"`
+
+	// SignatureAlgorithms 签名算法
+	SignatureAlgorithms []uint16 `json:"signature_algorithms,omitempty"`
+
+	// SupportedVersions supported_versions 扩展中声明的版本
+	SupportedVersions []uint16 `json:"supported_versions,omitempty"`
+
+	// Raw 握手消息原始字节（不含记录层头部）
+	Raw []byte `json:"-"`
+}
+
+// HasALPN 判断客户端是否声明了指定的ALPN协议
+func (h *ClientHello) HasALPN(proto string) bool {
+	for _, p := range h.ALPN {
+		if p == proto {
+			return true
+		}
+	}
+	return false
+}
+
+// PeekClientHello 在不消耗数据的情况下从缓冲读取器中解析ClientHello，
+// 支持跨多个TLS记录的握手消息，要求整个消息能放入读取器缓冲区
+func PeekClientHello(reader *bufio.Reader) (*ClientHello, error) {
+	var handshake []byte
+	offset := 0
+	for {
+		header, err := reader.Peek(offset + recordHeaderLength)
+		if err != nil {
+			return nil, err
+		}
+		header = header[offset:]
+		if header[0] != recordTypeHandshake {
+			return nil, ErrNotClientHello
+		}
+		length := int(binary.BigEndian.Uint16(header[3:5]))
+
+		record, err := reader.Peek(offset + recordHeaderLength + length)
+		if err != nil {
+			return nil, fmt.Errorf("tlsinfo: peek ClientHello record: %w", err)
+		}
+		handshake = append(handshake, record[offset+recordHeaderLength:]...)
+		offset += recordHeaderLength + length
+
+		if len(handshake) >= handshakeHeaderLength {
+			msgLen := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+			if len(handshake) >= handshakeHeaderLength+msgLen {
+				return ParseClientHello(handshake[:handshakeHeaderLength+msgLen])
+			}
+		}
+	}
+}
+
+// ParseClientHello 解析握手消息（不含记录层头部）
+func ParseClientHello(msg []byte) (*ClientHello, error) {
+	if len(msg) < handshakeHeaderLength || msg[0] != handshakeClientHello {
+		return nil, ErrNotClientHello
+	}
+
+	h := &ClientHello{Raw: append([]byte(nil), msg...)}
+	r := reader(msg[handshakeHeaderLength:])
+
+	var ok bool
+	if h.Version, ok = r.uint16(); !ok {
+		return nil, errMalformed("version")
+	}
+	if !r.skip(32) {
+		return nil, errMalformed("random")
+	}
+	if _, ok = r.vector8(); !ok {
+		return nil, errMalformed("session id")
+	}
+
+	suites, ok := r.vector16()
+	if !ok || len(suites)%2 != 0 {
+		return nil, errMalformed("cipher suites")
+	}
+	h.CipherSuites = uint16s(suites)
+
+	compression, ok := r.vector8()
+	if !ok {
+		return nil, errMalformed("compression methods")
+	}
+	h.CompressionMethods = append([]uint8(nil), compression...)
+
+	// 扩展是可选的
+	if r.empty() {
+		return h, nil
+	}
+	exts, ok := r.vector16()
+	if !ok {
+		return nil, errMalformed("extensions")
+	}
+	er := reader(exts)
+	for !er.empty() {
+		typ, ok1 := er.uint16()
+		data, ok2 := er.vector16()
+		if !ok1 || !ok2 {
+			return nil, errMalformed("extension")
+		}
+		h.Extensions = append(h.Extensions, typ)
+		if err := h.parseExtension(typ, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+func (h *ClientHello) parseExtension(typ uint16, data []byte) error {
+	r := reader(data)
+	switch typ {
+	case ExtServerName:
+		list, ok := r.vector16()
+		if !ok {
+			return errMalformed("server_name")
+		}
+		lr := reader(list)
+		for !lr.empty() {
+			nameType, ok1 := lr.uint8()
+			name, ok2 := lr.vector16()
+			if !ok1 || !ok2 {
+				return errMalformed("server_name")
+			}
+			if nameType == 0 {
+				h.ServerName = string(name)
+			}
+		}
+	case ExtALPN:
+		list, ok := r.vector16()
+		if !ok {
+			return errMalformed("alpn")
+		}
+		lr := reader(list)
+		for !lr.empty() {
+			proto, ok := lr.vector8()
+			if !ok {
+				return errMalformed("alpn")
+			}
+			h.ALPN = append(h.ALPN, string(proto))
+		}
+	case ExtSupportedGroups:
+		list, ok := r.vector16()
+		if !ok || len(list)%2 != 0 {
+			return errMalformed("supported_groups")
+		}
+		h.SupportedGroups = uint16s(list)
+	case ExtECPointFormats:
+		list, ok := r.vector8()
+		if !ok {
+			return errMalformed("ec_point_formats")
+		}
+		h.ECPointFormats = append([]uint8(nil), list...)
+	case ExtSignatureAlgorithms:
+		list, ok := r.vector16()
+		if !ok || len(list)%2 != 0 {
+			return errMalformed("signature_algorithms")
+		}
+		h.SignatureAlgorithms = uint16s(list)
+	case ExtSupportedVersions:
+		list, ok := r.vector8()
+		if !ok || len(list)%2 != 0 {
+			return errMalformed("supported_versions")
+		}
+		h.SupportedVersions = uint16s(list)
+	}
+	return nil
+}
+
+func errMalformed(field string) error {
+	return fmt.Errorf("tlsinfo: malformed ClientHello %s", field)
+}
+
+func uint16s(b []byte) []uint16 {
+	out := make([]uint16, len(b)/2)
+	for i := range out {
+		out[i] = binary.BigEndian.Uint16(b[i*2:])
+	}
+	return out
+}
+
+// reader 握手消息的简单字节读取器
+type reader []byte
+
+func (r *reader) empty() bool {
+	return len(*r) == 0
+}
+
+func (r *reader) skip(n int) bool {
+	if len(*r) < n {
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *reader) bytes(n int) ([]byte, bool) {
+	if len(*r) < n {
+		return nil, false
+	}
+	b := (*r)[:n]
+	*r = (*r)[n:]
+	return b, true
+}
+
+func (r *reader) uint8() (uint8, bool) {
+	b, ok := r.bytes(1)
+	if !ok {
+		return 0, false
+	}
+	return b[0], true
+}
+
+func (r *reader) uint16() (uint16, bool) {
+	b, ok := r.bytes(2)
+	if !ok {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(b), true
+}
+
+func (r *reader) vector8() ([]byte, bool) {
+	n, ok := r.uint8()
+	if !ok {
+		return nil, false
+	}
+	return r.bytes(int(n))
+}
+
+func (r *reader) vector16() ([]byte, bool) {
+	n, ok := r.uint16()
+	if !ok {
+		return nil, false
+	}
+	return r.bytes(int(n))
+}
@@ -0,0 +1,202 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tlsinfo
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IsGREASE 判断是否为GREASE值（RFC 8701），计算指纹时需要忽略
+func IsGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// JA3String 返回JA3原始字符串：版本,密码套件,扩展,曲线,点格式
+func (h *ClientHello) JA3String() string {
+	return strings.Join([]string{
+		strconv.Itoa(int(h.Version)),
+		joinUint16(h.CipherSuites, "-"),
+		joinUint16(h.Extensions, "-"),
+		joinUint16(h.SupportedGroups, "-"),
+		joinUint8(h.ECPointFormats, "-"),
+	}, ",")
+}
+
+// JA3 返回JA3指纹（JA3字符串的MD5）
+func (h *ClientHello) JA3() string {
+	sum := md5.Sum([]byte(h.JA3String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// JA4 返回JA4指纹，例如 t13d1516h2_8daaf6152771_b186095e22b6
+func (h *ClientHello) JA4() string {
+	ciphers := filterGREASE(h.CipherSuites)
+	exts := filterGREASE(h.Extensions)
+
+	sni := "i"
+	if h.ServerName != "" {
+		sni = "d"
+	}
+
+	a := fmt.Sprintf("t%s%s%02d%02d%s", ja4Version(h), sni, min(len(ciphers), 99), min(len(exts), 99), ja4ALPN(h.ALPN))
+
+	b := "000000000000"
+	if len(ciphers) > 0 {
+		b = truncatedHash(joinHex(sortedCopy(ciphers)))
+	}
+
+	c := "000000000000"
+	var sorted []uint16
+	for _, e := range exts {
+		if e != ExtServerName && e != ExtALPN {
+			sorted = append(sorted, e)
+		}
+	}
+	if len(sorted) > 0 {
+		raw := joinHex(sortedCopy(sorted))
+		if algs := filterGREASE(h.SignatureAlgorithms); len(algs) > 0 {
+			raw += "_" + joinHex(algs)
+		}
+		c = truncatedHash(raw)
+	}
+
+	return a + "_" + b + "_" + c
+}
+
+// ja4Version 返回JA4使用的最高协议版本标识
+func ja4Version(h *ClientHello) string {
+	version := h.Version
+	for _, v := range h.SupportedVersions {
+		if !IsGREASE(v) && v > version {
+			version = v
+		}
+	}
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	case 0xfeff:
+		return "d1"
+	case 0xfefd:
+		return "d2"
+	case 0xfefc:
+		return "d3"
+	default:
+		return "00"
+	}
+}
+
+// ja4ALPN 返回第一个ALPN值的首尾字符，非字母数字时使用十六进制表示
+func ja4ALPN(alpn []string) string {
+	if len(alpn) == 0 || alpn[0] == "" {
+		return "00"
+	}
+	first := alpn[0]
+	if isAlnum(first[0]) && isAlnum(first[len(first)-1]) {
+		return string([]byte{first[0], first[len(first)-1]})
+	}
+	h := hex.EncodeToString([]byte(first))
+	return string([]byte{h[0], h[len(h)-1]})
+}
+
+func isAlnum(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z')
+}
+
+func truncatedHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func filterGREASE(values []uint16) []uint16 {
+	out := make([]uint16, 0, len(values))
+	for _, v := range values {
+		if !IsGREASE(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func sortedCopy(values []uint16) []uint16 {
+	out := append([]uint16(nil), values...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func joinHex(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func joinUint16(values []uint16, sep string) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if !IsGREASE(v) {
+			parts = append(parts, strconv.Itoa(int(v)))
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+func joinUint8(values []uint8, sep string) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(parts, sep)
+}
+
+// Fingerprints 流上记录的TLS指纹
+type Fingerprints struct {
+	// JA3 客户端JA3指纹
+	JA3 string `json:"ja3,omitempty"`
+
+	// JA4 客户端JA4指纹
+	JA4 string `json:"ja4,omitempty"`
+
+	// JA3S 上游服务器JA3S指纹
+	JA3S string `json:"ja3s,omitempty"`
+}
+
+// Match 判断指纹是否与任一JA3/JA3S/JA4值相等
+func (f *Fingerprints) Match(fingerprint string) bool {
+	if f == nil || fingerprint == "" {
+		return false
+	}
+	return fingerprint == f.JA3 || fingerprint == f.JA4 || fingerprint == f.JA3S
+}
+
+// PassthroughFingerprints 客户端JA3或JA4指纹匹配时透传
+func PassthroughFingerprints(fingerprints ...string) Policy {
+	return func(_ string, hello *ClientHello) Action {
+		ja3, ja4 := hello.JA3(), hello.JA4()
+		for _, fp := range fingerprints {
+			if fp == ja3 || fp == ja4 {
+				return ActionPassthrough
+			}
+		}
+		return ActionDefault
+	}
+}
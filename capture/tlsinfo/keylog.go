@@ -0,0 +1,41 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tlsinfo
+
+import (
+	"os"
+	"sync"
+)
+
+// KeyLogFile NSS格式的TLS密钥日志文件（SSLKEYLOGFILE），可供Wireshark解密抓包，
+// 可以被多个TLS连接并发写入
+type KeyLogFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenKeyLogFile 以追加方式打开密钥日志文件，文件不存在时创建
+func OpenKeyLogFile(path string) (*KeyLogFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyLogFile{file: f}, nil
+}
+
+// Write 写入一行密钥日志，crypto/tls 每次调用写入完整的一行
+func (k *KeyLogFile) Write(p []byte) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.file.Write(p)
+}
+
+// Close 关闭密钥日志文件
+func (k *KeyLogFile) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.file.Close()
+}
@@ -0,0 +1,124 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tlsinfo
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// PinningTag 客户端疑似因证书固定拒绝握手时，为记录的流添加的标签
+const PinningTag = "tls-pinning"
+
+// certificateAlerts 客户端拒绝证书时发送的TLS警报
+var certificateAlerts = []string{
+	"bad certificate",
+	"unsupported certificate",
+	"certificate revoked",
+	"certificate expired",
+	"certificate unknown",
+	"unknown certificate authority",
+	"bad certificate status response",
+}
+
+// PinningFailure 判断与客户端的握手错误是否像证书固定导致的失败：客户端发送证书相关的TLS警报、
+// 无法解密的警报，或者在收到代理的证书后立即关闭连接。返回失败原因
+func PinningFailure(err error) (string, bool) {
+	if err == nil {
+		return "", false
+	}
+	msg := err.Error()
+	if _, alert, ok := strings.Cut(msg, "remote error: tls: "); ok {
+		for _, a := range certificateAlerts {
+			if strings.HasPrefix(alert, a) {
+				return "client sent alert: " + a, true
+			}
+		}
+		return "", false
+	}
+	// TLS 1.3 下部分客户端（如OpenSSL）以服务端尚未启用的密钥加密拒绝证书的警报，服务端只能看到解密失败
+	if strings.Contains(msg, "local error: tls: bad record MAC") {
+		return "client sent an undecryptable alert after receiving the certificate", true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return "client closed the connection after receiving the certificate", true
+	}
+	return "", false
+}
+
+// PinnedHost 客户端疑似固定证书的主机
+type PinnedHost struct {
+	// Host 客户端的SNI，没有SNI时为CONNECT目标主机
+	Host string `json:"host"`
+
+	// Failures 握手失败的次数
+	Failures int `json:"failures"`
+
+	// LastSeen 最后一次失败的时间
+	LastSeen time.Time `json:"last_seen"`
+
+	// Reason 最后一次失败的原因
+	Reason string `json:"reason"`
+
+	// Passthrough 是否已加入透传规则
+	Passthrough bool `json:"passthrough"`
+}
+
+// Pinning 记录疑似证书固定导致的握手失败，可以并发使用。
+// rules 不为nil时把主机加入透传规则，客户端重试时不再解密；每个主机只添加一次，规则被删除后继续解密
+type Pinning struct {
+	rules *HostRules
+	now   func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*PinnedHost
+}
+
+// NewPinning 创建证书固定失败的记录，rules 为nil时只记录不透传
+func NewPinning(rules *HostRules) *Pinning {
+	return &Pinning{rules: rules, now: time.Now, hosts: map[string]*PinnedHost{}}
+}
+
+// Record 记录主机的握手失败，返回主机的记录。为nil时不做任何处理
+func (p *Pinning) Record(host, reason string) PinnedHost {
+	if p == nil {
+		return PinnedHost{Host: host, Failures: 1, Reason: reason}
+	}
+	host = strings.ToLower(host)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := p.hosts[host]
+	if h == nil {
+		h = &PinnedHost{Host: host}
+		p.hosts[host] = h
+	}
+	h.Failures++
+	h.LastSeen = p.now()
+	h.Reason = reason
+	if p.rules != nil && !h.Passthrough {
+		p.rules.Set(host, ActionPassthrough)
+		h.Passthrough = true
+	}
+	return *h
+}
+
+// Hosts 返回按主机名排序的记录
+func (p *Pinning) Hosts() []PinnedHost {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]PinnedHost, 0, len(p.hosts))
+	for _, h := range p.hosts {
+		out = append(out, *h)
+	}
+	slices.SortFunc(out, func(a, b PinnedHost) int { return cmp.Compare(a.Host, b.Host) })
+	return out
+}
@@ -0,0 +1,194 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tlsinfo
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Action MITM决策结果
+type Action int
+
+const (
+	// ActionDefault 不做决定，交给后续策略或默认行为
+	ActionDefault Action = iota
+
+	// ActionIntercept 解密拦截
+	ActionIntercept
+
+	// ActionPassthrough 不解密，直接透传
+	ActionPassthrough
+)
+
+// String 返回决策的字符串表示
+func (a Action) String() string {
+	switch a {
+	case ActionIntercept:
+		return "intercept"
+	case ActionPassthrough:
+		return "passthrough"
+	default:
+		return "default"
+	}
+}
+
+// MarshalText 实现 encoding.TextMarshaler 接口
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler 接口
+func (a *Action) UnmarshalText(text []byte) error {
+	action, err := ParseAction(string(text))
+	if err != nil {
+		return err
+	}
+	*a = action
+	return nil
+}
+
+// ParseAction 解析决策名称
+func ParseAction(s string) (Action, error) {
+	switch strings.ToLower(s) {
+	case "intercept":
+		return ActionIntercept, nil
+	case "passthrough":
+		return ActionPassthrough, nil
+	case "default", "":
+		return ActionDefault, nil
+	default:
+		return ActionDefault, fmt.Errorf("invalid TLS action %q (expected intercept or passthrough)", s)
+	}
+}
+
+// Policy 在MITM决策之前调用的策略，target 为CONNECT目标 host:port
+type Policy func(target string, hello *ClientHello) Action
+
+// Chain 依次执行策略，返回第一个非默认的决策
+func Chain(policies ...Policy) Policy {
+	return func(target string, hello *ClientHello) Action {
+		for _, p := range policies {
+			if a := p(target, hello); a != ActionDefault {
+				return a
+			}
+		}
+		return ActionDefault
+	}
+}
+
+// PassthroughALPN 客户端声明了任一指定ALPN协议时透传
+func PassthroughALPN(protos ...string) Policy {
+	return func(_ string, hello *ClientHello) Action {
+		for _, p := range protos {
+			if hello.HasALPN(p) {
+				return ActionPassthrough
+			}
+		}
+		return ActionDefault
+	}
+}
+
+// PassthroughServerNames SNI匹配任一模式时透传，模式支持 "*.example.com"
+func PassthroughServerNames(patterns ...string) Policy {
+	return func(_ string, hello *ClientHello) Action {
+		for _, p := range patterns {
+			if MatchHost(p, hello.ServerName) {
+				return ActionPassthrough
+			}
+		}
+		return ActionDefault
+	}
+}
+
+// MatchHost 判断主机名是否匹配模式，"*.example.com" 匹配所有子域名
+func MatchHost(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	host = strings.ToLower(host)
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return pattern == host
+}
+
+// HostRule 按主机名指定的MITM决策
+type HostRule struct {
+	// Host 主机模式，支持 "*.example.com"
+	Host string `json:"host"`
+
+	// Action 解密拦截或透传
+	Action Action `json:"action"`
+}
+
+// HostRules 可在运行时修改的按主机名决策的规则，可以并发使用。
+// 规则按添加顺序匹配SNI，客户端未发送SNI时匹配CONNECT目标主机
+type HostRules struct {
+	mu    sync.RWMutex
+	rules []HostRule
+}
+
+// NewHostRules 创建空的主机规则
+func NewHostRules() *HostRules {
+	return &HostRules{}
+}
+
+// Set 设置主机的决策，替换同一模式已有的规则
+func (r *HostRules) Set(host string, action Action) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	host = strings.ToLower(host)
+	for i := range r.rules {
+		if r.rules[i].Host == host {
+			r.rules[i].Action = action
+			return
+		}
+	}
+	r.rules = append(r.rules, HostRule{Host: host, Action: action})
+}
+
+// Remove 删除主机模式的规则，返回规则是否存在
+func (r *HostRules) Remove(host string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	host = strings.ToLower(host)
+	for i := range r.rules {
+		if r.rules[i].Host == host {
+			r.rules = append(r.rules[:i], r.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// List 返回所有规则的快照
+func (r *HostRules) List() []HostRule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]HostRule{}, r.rules...)
+}
+
+// Policy 返回按当前规则决策的策略，之后对规则的修改立即生效
+func (r *HostRules) Policy() Policy {
+	return func(target string, hello *ClientHello) Action {
+		host := hello.ServerName
+		if host == "" {
+			host = target
+			if h, _, err := net.SplitHostPort(target); err == nil {
+				host = h
+			}
+		}
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		for _, rule := range r.rules {
+			if MatchHost(rule.Host, host) {
+				return rule.Action
+			}
+		}
+		return ActionDefault
+	}
+}
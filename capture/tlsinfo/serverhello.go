@@ -0,0 +1,152 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tlsinfo
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const handshakeServerHello = 0x02
+
+// maxRecordedHandshake 记录握手数据的上限，足以容纳ServerHello
+const maxRecordedHandshake = 16 * 1024
+
+// ErrNotServerHello 数据不是TLS ServerHello
+var ErrNotServerHello = errors.New("tlsinfo: not a TLS ServerHello")
+
+// ServerHello 解析后的TLS ServerHello
+type ServerHello struct {
+	// Version 握手消息中的服务器版本
+	Version uint16 `json:"version"`
+
+	// CipherSuite 服务器选择的密码套件
+	CipherSuite uint16 `json:"cipher_suite"`
+
+	// Extensions 扩展类型，保持服务器顺序
+	Extensions []uint16 `json:"extensions"`
+}
+
+// ParseServerHello 从原始TLS记录流中解析第一个ServerHello
+func ParseServerHello(records []byte) (*ServerHello, error) {
+	var handshake []byte
+	for len(records) >= recordHeaderLength {
+		if records[0] != recordTypeHandshake {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(records[3:5]))
+		if len(records) < recordHeaderLength+length {
+			break
+		}
+		handshake = append(handshake, records[recordHeaderLength:recordHeaderLength+length]...)
+		records = records[recordHeaderLength+length:]
+		if len(handshake) >= handshakeHeaderLength {
+			break
+		}
+	}
+
+	if len(handshake) < handshakeHeaderLength || handshake[0] != handshakeServerHello {
+		return nil, ErrNotServerHello
+	}
+
+	r := reader(handshake[handshakeHeaderLength:])
+	h := &ServerHello{}
+	var ok bool
+	if h.Version, ok = r.uint16(); !ok {
+		return nil, errMalformed("server version")
+	}
+	if !r.skip(32) {
+		return nil, errMalformed("server random")
+	}
+	if _, ok = r.vector8(); !ok {
+		return nil, errMalformed("server session id")
+	}
+	if h.CipherSuite, ok = r.uint16(); !ok {
+		return nil, errMalformed("server cipher suite")
+	}
+	if !r.skip(1) {
+		return nil, errMalformed("server compression method")
+	}
+	if r.empty() {
+		return h, nil
+	}
+	exts, ok := r.vector16()
+	if !ok {
+		return nil, errMalformed("server extensions")
+	}
+	er := reader(exts)
+	for !er.empty() {
+		typ, ok1 := er.uint16()
+		_, ok2 := er.vector16()
+		if !ok1 || !ok2 {
+			return nil, errMalformed("server extension")
+		}
+		h.Extensions = append(h.Extensions, typ)
+	}
+	return h, nil
+}
+
+// JA3SString 返回JA3S原始字符串：版本,密码套件,扩展
+func (h *ServerHello) JA3SString() string {
+	return strings.Join([]string{
+		strconv.Itoa(int(h.Version)),
+		strconv.Itoa(int(h.CipherSuite)),
+		joinUint16(h.Extensions, "-"),
+	}, ",")
+}
+
+// JA3S 返回JA3S指纹
+func (h *ServerHello) JA3S() string {
+	sum := md5.Sum([]byte(h.JA3SString()))
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordingConn 记录握手阶段读取到的数据的连接，用于获取上游ServerHello
+type RecordingConn struct {
+	net.Conn
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	stopped bool
+}
+
+// NewRecordingConn 包装连接并记录读取的前若干字节
+func NewRecordingConn(conn net.Conn) *RecordingConn {
+	return &RecordingConn{Conn: conn}
+}
+
+func (c *RecordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.mu.Lock()
+		if remain := maxRecordedHandshake - c.buf.Len(); !c.stopped && remain > 0 {
+			c.buf.Write(b[:min(n, remain)])
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// ServerHello 解析已记录数据中的ServerHello
+func (c *RecordingConn) ServerHello() (*ServerHello, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ParseServerHello(c.buf.Bytes())
+}
+
+// Stop 停止记录并释放已记录的数据
+func (c *RecordingConn) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	c.buf = bytes.Buffer{}
+}
@@ -0,0 +1,256 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tlsinfo
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+// --- 辅助函数 ---
+
+// captureClientHello 使用 crypto/tls 客户端生成一个真实的ClientHello记录
+func captureClientHello(t *testing.T, config *tls.Config) []byte {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	go func() {
+		_ = tls.Client(client, config).Handshake()
+	}()
+
+	header := make([]byte, recordHeaderLength)
+	_, err := io.ReadFull(server, header)
+	require.NoError(t, err)
+	body := make([]byte, int(header[3])<<8|int(header[4]))
+	_, err = io.ReadFull(server, body)
+	require.NoError(t, err)
+	return append(header, body...)
+}
+
+// newCert 签发测试证书，parent 为nil时自签名
+func newCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+// --- 测试代码 ---
+
+func TestNewUpstreamTLS_OCSP(t *testing.T) {
+	ca, caKey := newCert(t, "Test CA", nil, nil)
+	leaf, _ := newCert(t, "example.com", ca, caKey)
+	staple := func(status int) []byte {
+		resp, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status: status, SerialNumber: leaf.SerialNumber, ThisUpdate: time.Now(), NextUpdate: time.Now().Add(time.Hour),
+			RevokedAt: time.Now(),
+		}, caKey)
+		require.NoError(t, err)
+		return resp
+	}
+	state := tls.ConnectionState{Version: tls.VersionTLS13, PeerCertificates: []*x509.Certificate{leaf, ca}}
+
+	info := NewUpstreamTLS("example.com", state)
+	require.Empty(t, info.OCSPStatus)
+	require.Equal(t, "ECDSA", info.Certificates[0].KeyAlgorithm)
+	require.Equal(t, 256, info.Certificates[0].KeyBits)
+	require.Equal(t, "ECDSA-SHA256", info.Certificates[0].SignatureAlgorithm)
+
+	for status, want := range map[int]string{ocsp.Good: OCSPGood, ocsp.Revoked: OCSPRevoked, ocsp.Unknown: OCSPUnknown} {
+		state.OCSPResponse = staple(status)
+		require.Equal(t, want, NewUpstreamTLS("example.com", state).OCSPStatus)
+	}
+	state.OCSPResponse = []byte("garbage")
+	require.Equal(t, OCSPInvalid, NewUpstreamTLS("example.com", state).OCSPStatus)
+}
+func TestPeekClientHello(t *testing.T) {
+	record := captureClientHello(t, &tls.Config{
+		ServerName: "api.example.com",
+		NextProtos: []string{"h2", "http/1.1"},
+	})
+
+	reader := bufio.NewReader(strings.NewReader(string(record) + "rest"))
+	hello, err := PeekClientHello(reader)
+	require.NoError(t, err)
+	require.Equal(t, "api.example.com", hello.ServerName)
+	require.Equal(t, []string{"h2", "http/1.1"}, hello.ALPN)
+	require.True(t, hello.HasALPN("h2"))
+	require.NotEmpty(t, hello.CipherSuites)
+	require.Contains(t, hello.Extensions, ExtServerName)
+	require.Contains(t, hello.SupportedVersions, uint16(tls.VersionTLS13))
+
+	// Peek 不应消耗数据
+	require.Equal(t, len(record)+4, reader.Buffered())
+}
+
+func TestPeekClientHello_NotTLS(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))
+	_, err := PeekClientHello(reader)
+	require.ErrorIs(t, err, ErrNotClientHello)
+}
+
+func TestFingerprints(t *testing.T) {
+	record := captureClientHello(t, &tls.Config{
+		ServerName: "example.com",
+		NextProtos: []string{"h2"},
+	})
+	hello, err := PeekClientHello(bufio.NewReader(strings.NewReader(string(record))))
+	require.NoError(t, err)
+
+	require.Regexp(t, regexp.MustCompile(`^771,[0-9-]+,[0-9-]+,[0-9-]+,[0-9-]*$`), hello.JA3String())
+	require.Len(t, hello.JA3(), 32)
+	require.Regexp(t, regexp.MustCompile(`^t13d\d{4}h2_[0-9a-f]{12}_[0-9a-f]{12}$`), hello.JA4())
+
+	fp := &Fingerprints{JA3: hello.JA3(), JA4: hello.JA4()}
+	require.True(t, fp.Match(hello.JA4()))
+	require.False(t, fp.Match("deadbeef"))
+	require.Equal(t, ActionPassthrough, PassthroughFingerprints(hello.JA3())("example.com:443", hello))
+}
+
+func TestFingerprints_GREASE(t *testing.T) {
+	hello := &ClientHello{
+		Version:         0x0303,
+		CipherSuites:    []uint16{0x0a0a, 0x1301, 0x1302},
+		Extensions:      []uint16{0x1a1a, ExtServerName, ExtALPN, ExtSupportedGroups},
+		SupportedGroups: []uint16{0x2a2a, 29},
+		ECPointFormats:  []uint8{0},
+		ServerName:      "example.com",
+		ALPN:            []string{"http/1.1"},
+	}
+	require.Equal(t, "771,4865-4866,0-16-10,29,0", hello.JA3String())
+	require.True(t, strings.HasPrefix(hello.JA4(), "t12d0203h1_"))
+
+	require.True(t, IsGREASE(0xfafa))
+	require.False(t, IsGREASE(0x0a0b))
+}
+
+func TestJA4ALPN(t *testing.T) {
+	testCases := []struct {
+		alpn []string
+		want string
+	}{
+		{nil, "00"},
+		{[]string{"h2"}, "h2"},
+		{[]string{"http/1.1"}, "h1"},
+		{[]string{"\xab\xcd"}, "ad"},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.want, ja4ALPN(tc.alpn))
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	hello := &ClientHello{ServerName: "cdn.example.com", ALPN: []string{"h2"}}
+	policy := Chain(PassthroughServerNames("*.example.com"), PassthroughALPN("h3"))
+	require.Equal(t, ActionPassthrough, policy("cdn.example.com:443", hello))
+	require.Equal(t, ActionDefault, policy("other.com:443", &ClientHello{ServerName: "other.com"}))
+	require.False(t, MatchHost("*.example.com", "example.com"))
+}
+
+func TestHostRules(t *testing.T) {
+	rules := NewHostRules()
+	policy := Chain(rules.Policy(), PassthroughServerNames("*.example.com"))
+	require.Equal(t, ActionPassthrough, policy("cdn.example.com:443", &ClientHello{ServerName: "cdn.example.com"}))
+
+	// 运行时添加的规则优先，并立即生效
+	rules.Set("CDN.example.com", ActionIntercept)
+	require.Equal(t, ActionIntercept, policy("cdn.example.com:443", &ClientHello{ServerName: "cdn.example.com"}))
+	rules.Set("*.internal", ActionPassthrough)
+	require.Equal(t, ActionPassthrough, policy("db.internal:443", &ClientHello{}))
+	require.Equal(t, []HostRule{{"cdn.example.com", ActionIntercept}, {"*.internal", ActionPassthrough}}, rules.List())
+
+	rules.Set("cdn.example.com", ActionPassthrough)
+	require.Len(t, rules.List(), 2)
+	require.True(t, rules.Remove("cdn.example.com"))
+	require.False(t, rules.Remove("cdn.example.com"))
+	require.Equal(t, ActionDefault, rules.Policy()("cdn.example.com:443", &ClientHello{ServerName: "cdn.example.com"}))
+
+	var a Action
+	require.NoError(t, a.UnmarshalText([]byte("Intercept")))
+	require.Equal(t, ActionIntercept, a)
+	require.Error(t, a.UnmarshalText([]byte("drop")))
+	text, _ := ActionPassthrough.MarshalText()
+	require.Equal(t, "passthrough", string(text))
+}
+
+func TestPinningFailure(t *testing.T) {
+	reason, ok := PinningFailure(fmt.Errorf("client handshake: %w", errors.New("remote error: tls: bad certificate")))
+	require.True(t, ok)
+	require.Equal(t, "client sent alert: bad certificate", reason)
+	_, ok = PinningFailure(errors.New("remote error: tls: unknown certificate authority"))
+	require.True(t, ok)
+	_, ok = PinningFailure(errors.New("local error: tls: bad record MAC"))
+	require.True(t, ok)
+	_, ok = PinningFailure(fmt.Errorf("client handshake: %w", io.EOF))
+	require.True(t, ok)
+
+	_, ok = PinningFailure(errors.New("remote error: tls: protocol version not supported"))
+	require.False(t, ok)
+	_, ok = PinningFailure(errors.New("tls: first record does not look like a TLS handshake"))
+	require.False(t, ok)
+	_, ok = PinningFailure(nil)
+	require.False(t, ok)
+}
+
+func TestPinning(t *testing.T) {
+	rules := NewHostRules()
+	p := NewPinning(rules)
+	first := p.Record("App.example.com", "client sent alert: bad certificate")
+	require.Equal(t, 1, first.Failures)
+	require.True(t, first.Passthrough)
+	require.Equal(t, ActionPassthrough, rules.Policy()("app.example.com:443", &ClientHello{ServerName: "app.example.com"}))
+
+	// 删除规则后不再自动添加，恢复解密
+	require.True(t, rules.Remove("app.example.com"))
+	second := p.Record("app.example.com", "client closed the connection after receiving the certificate")
+	require.Equal(t, 2, second.Failures)
+	require.Empty(t, rules.List())
+
+	p.Record("a.example.com", "client sent alert: certificate unknown")
+	hosts := p.Hosts()
+	require.Len(t, hosts, 2)
+	require.Equal(t, "a.example.com", hosts[0].Host)
+	require.Equal(t, "client closed the connection after receiving the certificate", hosts[1].Reason)
+
+	// 没有透传规则时只记录
+	recorded := NewPinning(nil).Record("b.example.com", "x")
+	require.False(t, recorded.Passthrough)
+	require.Equal(t, 1, (*Pinning)(nil).Record("c.example.com", "x").Failures)
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tlsinfo
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Certificate 上游证书摘要
+type Certificate struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	DNSNames     []string  `json:"dns_names,omitempty"`
+
+	// SHA256 证书DER的SHA-256指纹（十六进制）
+	SHA256 string `json:"sha256"`
+
+	// SPKI 公钥信息的SHA-256（base64），即固定证书使用的 "sha256/..." 值
+	SPKI string `json:"spki"`
+
+	// KeyAlgorithm、KeyBits 公钥算法和长度，例如 RSA 2048、ECDSA 256
+	KeyAlgorithm string `json:"key_algorithm,omitempty"`
+	KeyBits      int    `json:"key_bits,omitempty"`
+
+	// SignatureAlgorithm 证书的签名算法，例如 SHA256-RSA
+	SignatureAlgorithm string `json:"signature_algorithm,omitempty"`
+
+	// Raw 证书DER编码
+	Raw []byte `json:"raw,omitempty"`
+}
+
+// NewCertificate 生成证书摘要
+func NewCertificate(cert *x509.Certificate) Certificate {
+	sum := sha256.Sum256(cert.Raw)
+	c := Certificate{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SerialNumber:       cert.SerialNumber.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		DNSNames:           cert.DNSNames,
+		SHA256:             hex.EncodeToString(sum[:]),
+		SPKI:               SPKIHash(cert),
+		KeyAlgorithm:       cert.PublicKeyAlgorithm.String(),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		Raw:                cert.Raw,
+	}
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		c.KeyBits = key.N.BitLen()
+	case *ecdsa.PublicKey:
+		c.KeyBits = key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		c.KeyBits = 256
+	}
+	return c
+}
+
+// SPKIHash 返回证书公钥信息的SHA-256（base64）
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// UpstreamTLS 与上游建立的TLS会话信息及证书校验结果
+type UpstreamTLS struct {
+	// Version 协商的TLS版本
+	Version uint16 `json:"version"`
+
+	// CipherSuite 协商的密码套件
+	CipherSuite uint16 `json:"cipher_suite"`
+
+	// NegotiatedProtocol 协商的ALPN协议
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty"`
+
+	// ServerName 校验证书使用的主机名
+	ServerName string `json:"server_name"`
+
+	// Certificates 上游提供的证书链，第一个为叶子证书
+	Certificates []Certificate `json:"certificates"`
+
+	// Verified 证书链是否通过校验
+	Verified bool `json:"verified"`
+
+	// VerifyError 校验失败原因
+	VerifyError string `json:"verify_error,omitempty"`
+
+	// SkipVerify 是否按策略跳过了校验（校验失败仍然继续连接）
+	SkipVerify bool `json:"skip_verify,omitempty"`
+
+	// Pinned 是否命中了公钥固定
+	Pinned bool `json:"pinned,omitempty"`
+
+	// ClientCertificate 上游要求双向TLS时出示的客户端证书主题
+	ClientCertificate string `json:"client_certificate,omitempty"`
+
+	// OCSPStatus 上游在握手中装订的OCSP响应的状态，见 OCSPGood 等，没有装订时为空
+	OCSPStatus string `json:"ocsp_status,omitempty"`
+}
+
+// 装订的OCSP响应的状态
+const (
+	OCSPGood    = "good"
+	OCSPRevoked = "revoked"
+	OCSPUnknown = "unknown"
+
+	// OCSPInvalid 响应无法解析或签名无效
+	OCSPInvalid = "invalid"
+)
+
+// NewUpstreamTLS 根据连接状态生成上游TLS会话信息
+func NewUpstreamTLS(serverName string, state tls.ConnectionState) *UpstreamTLS {
+	info := &UpstreamTLS{
+		Version:            state.Version,
+		CipherSuite:        state.CipherSuite,
+		NegotiatedProtocol: state.NegotiatedProtocol,
+		ServerName:         serverName,
+	}
+	for _, cert := range state.PeerCertificates {
+		info.Certificates = append(info.Certificates, NewCertificate(cert))
+	}
+	info.OCSPStatus = ocspStatus(state)
+	return info
+}
+
+// ocspStatus 返回装订的OCSP响应的状态，有签发者证书时校验响应的签名
+func ocspStatus(state tls.ConnectionState) string {
+	if len(state.OCSPResponse) == 0 || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	var issuer *x509.Certificate
+	if len(state.PeerCertificates) > 1 {
+		issuer = state.PeerCertificates[1]
+	}
+	resp, err := ocsp.ParseResponseForCert(state.OCSPResponse, state.PeerCertificates[0], issuer)
+	if err != nil {
+		return OCSPInvalid
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return OCSPGood
+	case ocsp.Revoked:
+		return OCSPRevoked
+	}
+	return OCSPUnknown
+}
+
+// VersionName 返回TLS版本名称
+func (u *UpstreamTLS) VersionName() string {
+	return tls.VersionName(u.Version)
+}
+
+// CipherSuiteName 返回密码套件名称
+func (u *UpstreamTLS) CipherSuiteName() string {
+	return tls.CipherSuiteName(u.CipherSuite)
+}
@@ -0,0 +1,265 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tlsreport
+
+import (
+	"cmp"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+)
+
+// Severity 问题的严重程度
+type Severity string
+
+const (
+	// SeverityHigh 可被攻击者利用或会被客户端拒绝的配置
+	SeverityHigh Severity = "high"
+
+	// SeverityMedium 不推荐的配置，例如即将过期的证书
+	SeverityMedium Severity = "medium"
+
+	// SeverityLow 较弱但仍可接受的配置
+	SeverityLow Severity = "low"
+)
+
+// rank 严重程度的排序，数值越小越严重
+func (s Severity) rank() int {
+	switch s {
+	case SeverityHigh:
+		return 0
+	case SeverityMedium:
+		return 1
+	}
+	return 2
+}
+
+const (
+	// expiringSoon 证书在此时间内过期时报告
+	expiringSoon = 30 * 24 * time.Hour
+
+	// minRSABits RSA公钥的最小长度
+	minRSABits = 2048
+)
+
+// Finding 源站TLS配置的问题
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// Origin 一个源站的TLS会话汇总，多次连接协商的结果不同时列出所有值
+type Origin struct {
+	// Origin 源站的 host:port
+	Origin string `json:"origin"`
+
+	// Flows 与该源站交换的HTTPS流数
+	Flows int `json:"flows"`
+
+	Versions     []string `json:"versions"`
+	CipherSuites []string `json:"cipher_suites"`
+	Protocols    []string `json:"protocols,omitempty"`
+
+	// Chain 最后一次连接的证书链，不含证书DER
+	Chain []tlsinfo.Certificate `json:"chain"`
+
+	// Verified 所有连接的证书链都通过校验
+	Verified bool `json:"verified"`
+
+	// OCSP 装订的OCSP响应状态，见 tlsinfo.OCSPGood 等，没有装订时为空
+	OCSP []string `json:"ocsp,omitempty"`
+
+	// Findings 较弱的配置，按严重程度排序
+	Findings []*Finding `json:"findings"`
+}
+
+// Report 会话中所有源站的TLS配置汇总
+type Report struct {
+	Generated time.Time `json:"generated"`
+
+	// Weak 存在问题的源站数
+	Weak int `json:"weak"`
+
+	// Origins 按源站排序
+	Origins []*Origin `json:"origins"`
+}
+
+// Analyze 汇总流中记录的上游TLS会话，报告 TLS 1.2 以下的版本、不安全（包括没有前向保密）或CBC模式的密码套件、
+// 校验失败、过期或即将过期的证书、较短的RSA密钥、SHA-1或MD5签名以及吊销或无效的OCSP响应
+func Analyze(flows []*flow.Flow) *Report {
+	now := time.Now()
+	byOrigin := map[string]*Origin{}
+	for _, f := range flows {
+		info := f.UpstreamTLS
+		if info == nil || f.Request == nil {
+			continue
+		}
+		name := origin(f.Request)
+		o := byOrigin[name]
+		if o == nil {
+			o = &Origin{Origin: name, Verified: true, Versions: []string{}, CipherSuites: []string{}, Findings: []*Finding{}}
+			byOrigin[name] = o
+		}
+		o.Flows++
+		o.Versions = appendNew(o.Versions, info.VersionName())
+		o.CipherSuites = appendNew(o.CipherSuites, info.CipherSuiteName())
+		if info.NegotiatedProtocol != "" {
+			o.Protocols = appendNew(o.Protocols, info.NegotiatedProtocol)
+		}
+		if info.OCSPStatus != "" {
+			o.OCSP = appendNew(o.OCSP, info.OCSPStatus)
+		}
+		o.Verified = o.Verified && info.Verified
+		o.Chain = o.Chain[:0]
+		for _, c := range info.Certificates {
+			c.Raw = nil
+			o.Chain = append(o.Chain, c)
+		}
+		o.check(info, now)
+	}
+
+	report := &Report{Generated: now.UTC(), Origins: make([]*Origin, 0, len(byOrigin))}
+	for _, o := range byOrigin {
+		slices.SortStableFunc(o.Findings, func(a, b *Finding) int { return cmp.Compare(a.Severity.rank(), b.Severity.rank()) })
+		if len(o.Findings) > 0 {
+			report.Weak++
+		}
+		report.Origins = append(report.Origins, o)
+	}
+	slices.SortFunc(report.Origins, func(a, b *Origin) int { return cmp.Compare(a.Origin, b.Origin) })
+	return report
+}
+
+// add 记录问题，相同的问题只记录一次
+func (o *Origin) add(severity Severity, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	for _, f := range o.Findings {
+		if f.Message == message {
+			return
+		}
+	}
+	o.Findings = append(o.Findings, &Finding{Severity: severity, Message: message})
+}
+
+// check 检查一次TLS会话
+func (o *Origin) check(info *tlsinfo.UpstreamTLS, now time.Time) {
+	if info.Version != 0 && info.Version < tls.VersionTLS12 {
+		o.add(SeverityHigh, "negotiated %s", info.VersionName())
+	}
+	suite := info.CipherSuiteName()
+	switch {
+	case insecureSuite(info.CipherSuite):
+		o.add(SeverityHigh, "insecure cipher suite %s", suite)
+	case strings.Contains(suite, "_CBC_"):
+		o.add(SeverityLow, "CBC cipher suite %s", suite)
+	}
+
+	if !info.Verified {
+		reason := info.VerifyError
+		if reason == "" {
+			reason = "not verified"
+		}
+		o.add(SeverityHigh, "certificate verification failed: %s", reason)
+	}
+	for i, c := range info.Certificates {
+		// 根证书的自签名不参与校验，不检查签名算法
+		if i > 0 && c.Subject == c.Issuer {
+			continue
+		}
+		if alg := strings.ToUpper(c.SignatureAlgorithm); strings.Contains(alg, "SHA1") || strings.Contains(alg, "MD5") {
+			o.add(SeverityHigh, "certificate %s signed with %s", c.Subject, c.SignatureAlgorithm)
+		}
+		if c.KeyAlgorithm == "RSA" && c.KeyBits > 0 && c.KeyBits < minRSABits {
+			o.add(SeverityHigh, "certificate %s has a %d-bit RSA key", c.Subject, c.KeyBits)
+		}
+	}
+	if len(info.Certificates) > 0 {
+		leaf := info.Certificates[0]
+		switch left := leaf.NotAfter.Sub(now); {
+		case left <= 0:
+			o.add(SeverityHigh, "certificate expired on %s", leaf.NotAfter.UTC().Format(time.DateOnly))
+		case left < expiringSoon:
+			o.add(SeverityMedium, "certificate expires on %s", leaf.NotAfter.UTC().Format(time.DateOnly))
+		}
+	}
+
+	switch info.OCSPStatus {
+	case tlsinfo.OCSPRevoked:
+		o.add(SeverityHigh, "stapled OCSP response reports the certificate as revoked")
+	case tlsinfo.OCSPInvalid:
+		o.add(SeverityMedium, "stapled OCSP response is invalid")
+	}
+}
+
+// insecureSuite 判断密码套件是否在 tls.InsecureCipherSuites 中
+func insecureSuite(id uint16) bool {
+	for _, s := range tls.InsecureCipherSuites() {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// origin 返回请求的源站 host:port，没有端口时使用443
+func origin(req *flow.Request) string {
+	host := req.Host
+	if u, err := url.Parse(req.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	host = strings.ToLower(host)
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "443")
+	}
+	return host
+}
+
+// appendNew 追加未出现过的值
+func appendNew(values []string, v string) []string {
+	if slices.Contains(values, v) {
+		return values
+	}
+	return append(values, v)
+}
+
+// WriteText 以文本形式输出报告，weakOnly 为 true 时只输出存在问题的源站
+func (r *Report) WriteText(w io.Writer, weakOnly bool) error {
+	for _, o := range r.Origins {
+		if weakOnly && len(o.Findings) == 0 {
+			continue
+		}
+		line := fmt.Sprintf("%s  %s  %s", o.Origin, strings.Join(o.Versions, ","), strings.Join(o.CipherSuites, ","))
+		if len(o.Protocols) > 0 {
+			line += "  " + strings.Join(o.Protocols, ",")
+		}
+		if len(o.OCSP) > 0 {
+			line += "  ocsp " + strings.Join(o.OCSP, ",")
+		} else {
+			line += "  no ocsp stapling"
+		}
+		if _, err := fmt.Fprintf(w, "%s  (%d flows)\n", line, o.Flows); err != nil {
+			return err
+		}
+		if len(o.Chain) > 0 {
+			leaf := o.Chain[0]
+			fmt.Fprintf(w, "  certificate: %s, issuer %s, %s %d, expires %s\n",
+				leaf.Subject, leaf.Issuer, leaf.KeyAlgorithm, leaf.KeyBits, leaf.NotAfter.UTC().Format(time.DateOnly))
+		}
+		for _, f := range o.Findings {
+			fmt.Fprintf(w, "  [%s] %s\n", f.Severity, f.Message)
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d origins, %d with weak configurations\n", len(r.Origins), r.Weak)
+	return err
+}
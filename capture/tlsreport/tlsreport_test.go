@@ -0,0 +1,137 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tlsreport
+
+import (
+	"bytes"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+func newFlow(rawURL string, info *tlsinfo.UpstreamTLS) *flow.Flow {
+	f := flow.New()
+	f.Request = &flow.Request{Method: "GET", URL: rawURL}
+	f.UpstreamTLS = info
+	return f
+}
+
+// session 返回使用现代配置的TLS会话信息
+func session() *tlsinfo.UpstreamTLS {
+	return &tlsinfo.UpstreamTLS{
+		Version:            tls.VersionTLS13,
+		CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+		NegotiatedProtocol: "h2",
+		Verified:           true,
+		OCSPStatus:         tlsinfo.OCSPGood,
+		Certificates: []tlsinfo.Certificate{
+			{Subject: "CN=example.com", Issuer: "CN=CA", NotAfter: time.Now().AddDate(1, 0, 0), KeyAlgorithm: "ECDSA", KeyBits: 256, SignatureAlgorithm: "ECDSA-SHA256", Raw: []byte{1}},
+			{Subject: "CN=CA", Issuer: "CN=CA", KeyAlgorithm: "RSA", KeyBits: 1024, SignatureAlgorithm: "SHA1-RSA"},
+		},
+	}
+}
+
+// messages 返回 "严重程度: 说明" 形式的问题
+func messages(o *Origin) []string {
+	var out []string
+	for _, f := range o.Findings {
+		out = append(out, string(f.Severity)+": "+f.Message)
+	}
+	return out
+}
+
+// --- 测试代码 ---
+
+func TestAnalyze(t *testing.T) {
+	weak := session()
+	weak.Version = tls.VersionTLS10
+	weak.CipherSuite = tls.TLS_RSA_WITH_AES_128_CBC_SHA
+	weak.NegotiatedProtocol = ""
+	weak.Verified = false
+	weak.VerifyError = "x509: certificate signed by unknown authority"
+	weak.OCSPStatus = ""
+	weak.Certificates[0].NotAfter = time.Now().Add(48 * time.Hour)
+	weak.Certificates[0].KeyAlgorithm, weak.Certificates[0].KeyBits = "RSA", 1024
+
+	legacy := session()
+	legacy.Version = tls.VersionTLS12
+	legacy.CipherSuite = tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA
+
+	report := Analyze([]*flow.Flow{
+		newFlow("https://api.example.com/a", session()),
+		newFlow("https://API.example.com:443/b", session()),
+		newFlow("https://old.example.com:8443/", weak),
+		newFlow("https://legacy.example.com/", legacy),
+		newFlow("http://plain.example.com/", nil),
+	})
+	require.Len(t, report.Origins, 3)
+	require.Equal(t, 2, report.Weak)
+
+	good := report.Origins[0]
+	require.Equal(t, "api.example.com:443", good.Origin)
+	require.Equal(t, 2, good.Flows)
+	require.Equal(t, []string{"TLS 1.3"}, good.Versions)
+	require.Equal(t, []string{"h2"}, good.Protocols)
+	require.Equal(t, []string{tlsinfo.OCSPGood}, good.OCSP)
+	require.True(t, good.Verified)
+	require.Empty(t, good.Findings)
+	require.Len(t, good.Chain, 2)
+	require.Nil(t, good.Chain[0].Raw)
+
+	require.Equal(t, "legacy.example.com:443", report.Origins[1].Origin)
+	require.Equal(t, []string{"low: CBC cipher suite TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA"}, messages(report.Origins[1]))
+
+	old := report.Origins[2]
+	require.Equal(t, "old.example.com:8443", old.Origin)
+	require.False(t, old.Verified)
+	require.Equal(t, []string{
+		"high: negotiated TLS 1.0",
+		"high: insecure cipher suite TLS_RSA_WITH_AES_128_CBC_SHA",
+		"high: certificate verification failed: x509: certificate signed by unknown authority",
+		"high: certificate CN=example.com has a 1024-bit RSA key",
+		"medium: certificate expires on " + weak.Certificates[0].NotAfter.UTC().Format(time.DateOnly),
+	}, messages(old))
+}
+
+func TestAnalyze_Chain(t *testing.T) {
+	info := session()
+	info.OCSPStatus = tlsinfo.OCSPRevoked
+	info.Certificates = append([]tlsinfo.Certificate{}, info.Certificates[0],
+		tlsinfo.Certificate{Subject: "CN=Intermediate", Issuer: "CN=CA", SignatureAlgorithm: "SHA1-RSA"})
+	info.Certificates[0].NotAfter = time.Now().Add(-time.Hour)
+
+	report := Analyze([]*flow.Flow{newFlow("https://example.com/", info)})
+	require.Equal(t, []string{
+		"high: certificate CN=Intermediate signed with SHA1-RSA",
+		"high: certificate expired on " + info.Certificates[0].NotAfter.UTC().Format(time.DateOnly),
+		"high: stapled OCSP response reports the certificate as revoked",
+	}, messages(report.Origins[0]))
+}
+
+func TestReport_WriteText(t *testing.T) {
+	weak := session()
+	weak.Version = tls.VersionTLS11
+	weak.OCSPStatus = ""
+	report := Analyze([]*flow.Flow{newFlow("https://a.example.com/", session()), newFlow("https://b.example.com/", weak)})
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteText(&buf, false))
+	require.Contains(t, buf.String(), "a.example.com:443  TLS 1.3  TLS_AES_128_GCM_SHA256  h2  ocsp good  (1 flows)\n")
+	require.Contains(t, buf.String(), "  certificate: CN=example.com, issuer CN=CA, ECDSA 256, expires ")
+	require.Contains(t, buf.String(), "b.example.com:443  TLS 1.1  TLS_AES_128_GCM_SHA256  h2  no ocsp stapling  (1 flows)\n  certificate:")
+	require.Contains(t, buf.String(), "  [high] negotiated TLS 1.1\n")
+	require.True(t, bytes.HasSuffix(buf.Bytes(), []byte("2 origins, 1 with weak configurations\n")))
+
+	buf.Reset()
+	require.NoError(t, report.WriteText(&buf, true))
+	require.NotContains(t, buf.String(), "a.example.com")
+}
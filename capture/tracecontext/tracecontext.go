@@ -0,0 +1,155 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tracecontext
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// TraceparentHeader W3C Trace Context 的追踪头部
+const TraceparentHeader = "Traceparent"
+
+// DefaultCorrelationHeaders 未指定关联ID头部时识别的常见头部
+var DefaultCorrelationHeaders = []string{"X-Request-ID", "X-Correlation-ID"}
+
+// Parse 解析 W3C traceparent 头部，返回追踪ID和父span ID，格式无效时 ok 为 false
+func Parse(traceparent string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isHexID(parts[1], 32) || !isHexID(parts[2], 16) {
+		return "", "", false
+	}
+	// 版本00只允许4个字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// isHexID 检查 s 是否为 n 位小写十六进制且不全为0
+func isHexID(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// NewTraceparent 生成新的采样的 traceparent 头部
+func NewTraceparent() string {
+	return "00-" + randomID(16) + "-" + randomID(8) + "-01"
+}
+
+// randomID 返回 n 字节的随机ID的十六进制编码
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Options 注入追踪头部的配置
+type Options struct {
+	// Inject 请求没有 traceparent 或关联ID时生成并添加到转发的请求上，已有的值原样传递
+	Inject bool
+
+	// CorrelationHeader 关联ID头部，例如 X-Request-ID，为空时识别 DefaultCorrelationHeaders 但不注入
+	CorrelationHeader string
+}
+
+// Injector 为转发的请求注入或传递追踪头部，并把追踪ID和关联ID记录在流上以便与后端日志对照
+type Injector struct {
+	opts Options
+}
+
+// New 创建追踪头部的注入器
+func New(opts Options) *Injector {
+	opts.CorrelationHeader = http.CanonicalHeaderKey(opts.CorrelationHeader)
+	return &Injector{opts: opts}
+}
+
+// Apply 在转发的请求头部 header 和流的请求上注入缺少的头部，并记录流的 TraceID 和 CorrelationID。
+// 为nil时只从请求中识别已有的值
+func (in *Injector) Apply(header http.Header, f *flow.Flow) {
+	if f.Request == nil {
+		return
+	}
+	if f.Request.Header == nil {
+		f.Request.Header = http.Header{}
+	}
+	var opts Options
+	if in != nil {
+		opts = in.opts
+	}
+
+	traceparent := f.Request.Header.Get(TraceparentHeader)
+	traceID, _, ok := Parse(traceparent)
+	if !ok && opts.Inject {
+		traceparent = NewTraceparent()
+		traceID, _, _ = Parse(traceparent)
+		set(header, f, TraceparentHeader, traceparent)
+		// 无效的 tracestate 不能与新的追踪一起传递
+		del(header, f, "Tracestate")
+	}
+	f.TraceID = traceID
+
+	if opts.CorrelationHeader == "" {
+		for _, name := range DefaultCorrelationHeaders {
+			if v := f.Request.Header.Get(name); v != "" {
+				f.CorrelationID = v
+				return
+			}
+		}
+		return
+	}
+	id := f.Request.Header.Get(opts.CorrelationHeader)
+	if id == "" && opts.Inject {
+		id = newUUID()
+		set(header, f, opts.CorrelationHeader, id)
+	}
+	f.CorrelationID = id
+}
+
+// set 同时设置转发的请求和流的请求的头部
+func set(header http.Header, f *flow.Flow, name, value string) {
+	if header != nil {
+		header.Set(name, value)
+	}
+	f.Request.Header.Set(name, value)
+}
+
+// del 同时删除转发的请求和流的请求的头部
+func del(header http.Header, f *flow.Flow, name string) {
+	if header != nil {
+		header.Del(name)
+	}
+	f.Request.Header.Del(name)
+}
+
+// newUUID 生成随机的 UUID v4
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// Matches 判断流的追踪ID或关联ID是否为 id，追踪ID不区分大小写
+func Matches(f *flow.Flow, id string) bool {
+	if id == "" {
+		return false
+	}
+	return strings.EqualFold(f.TraceID, id) || f.CorrelationID == id
+}
@@ -0,0 +1,99 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package tracecontext
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// newFlow 返回请求头部为 header 的流，以及转发的请求头部
+func newFlow(header http.Header) (*flow.Flow, http.Header) {
+	f := flow.New()
+	f.Request = &flow.Request{Method: "GET", URL: "https://api.example.com/", Header: header.Clone()}
+	return f, header
+}
+
+// --- 测试代码 ---
+
+func TestParse(t *testing.T) {
+	traceID, spanID, ok := Parse(traceparent)
+	require.True(t, ok)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	require.Equal(t, "00f067aa0ba902b7", spanID)
+
+	// 未来的版本可以有更多字段
+	_, _, ok = Parse("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	require.True(t, ok)
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	} {
+		_, _, ok := Parse(v)
+		require.False(t, ok, v)
+	}
+
+	_, _, ok = Parse(NewTraceparent())
+	require.True(t, ok)
+}
+
+func TestInjector_Inject(t *testing.T) {
+	in := New(Options{Inject: true, CorrelationHeader: "x-request-id"})
+	f, header := newFlow(http.Header{"Tracestate": {"vendor=1"}})
+	in.Apply(header, f)
+	require.Len(t, f.TraceID, 32)
+	require.Equal(t, header.Get("Traceparent"), f.Request.Header.Get("Traceparent"))
+	require.Contains(t, header.Get("Traceparent"), f.TraceID)
+	require.Empty(t, header.Get("Tracestate"))
+	require.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), f.CorrelationID)
+	require.Equal(t, f.CorrelationID, header.Get("X-Request-ID"))
+	require.Equal(t, f.CorrelationID, f.Request.Header.Get("X-Request-ID"))
+
+	// 已有的值原样传递
+	f, header = newFlow(http.Header{"Traceparent": {traceparent}, "Tracestate": {"vendor=1"}, "X-Request-Id": {"req-42"}})
+	in.Apply(header, f)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", f.TraceID)
+	require.Equal(t, "req-42", f.CorrelationID)
+	require.Equal(t, traceparent, header.Get("Traceparent"))
+	require.Equal(t, "vendor=1", header.Get("Tracestate"))
+}
+
+func TestInjector_Propagate(t *testing.T) {
+	// 不注入时只记录已有的值
+	in := New(Options{CorrelationHeader: "X-Trace-Token"})
+	f, header := newFlow(http.Header{"X-Request-Id": {"ignored"}})
+	in.Apply(header, f)
+	require.Empty(t, f.TraceID)
+	require.Empty(t, f.CorrelationID)
+	require.Equal(t, http.Header{"X-Request-Id": {"ignored"}}, header)
+
+	var nilInjector *Injector
+	f, header = newFlow(http.Header{"Traceparent": {traceparent}, "X-Correlation-Id": {"corr-1"}})
+	nilInjector.Apply(header, f)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", f.TraceID)
+	require.Equal(t, "corr-1", f.CorrelationID)
+}
+
+func TestMatches(t *testing.T) {
+	f := flow.New()
+	f.TraceID, f.CorrelationID = "4bf92f3577b34da6a3ce929d0e0e4736", "req-42"
+	require.True(t, Matches(f, "4BF92F3577B34DA6A3CE929D0E0E4736"))
+	require.True(t, Matches(f, "req-42"))
+	require.False(t, Matches(f, "REQ-42"))
+	require.False(t, Matches(flow.New(), ""))
+}
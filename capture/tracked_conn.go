@@ -0,0 +1,65 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package capture
+
+import (
+	"net"
+	"sync"
+)
+
+// trackedConn 监听器跟踪的客户端连接，记录连接是否空闲以便优雅关闭
+type trackedConn struct {
+	net.Conn
+
+	mu       sync.Mutex
+	idle     bool
+	draining bool
+}
+
+// SetIdle 实现 types.IdleTracker 接口
+func (c *trackedConn) SetIdle(idle bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.idle = idle
+	return !c.draining
+}
+
+// NetConn 返回底层连接
+func (c *trackedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// RawConn 实现 types.RawConner 接口
+func (c *trackedConn) RawConn() net.Conn {
+	return c.Conn
+}
+
+// PeerAddr 返回直接相连的对端地址，底层连接解析了PROXY protocol时为负载均衡器地址
+func (c *trackedConn) PeerAddr() net.Addr {
+	if pc, ok := c.Conn.(interface{ PeerAddr() net.Addr }); ok {
+		return pc.PeerAddr()
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// CloseWrite 关闭底层TCP连接的写方向，隧道转发时使用
+func (c *trackedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// drain 标记连接正在关闭，空闲连接立即关闭
+func (c *trackedConn) drain() {
+	c.mu.Lock()
+	c.draining = true
+	idle := c.idle
+	c.mu.Unlock()
+	if idle {
+		c.Conn.Close()
+	}
+}
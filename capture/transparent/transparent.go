@@ -0,0 +1,41 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package transparent
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/f-dong/sniffy/capture/types"
+)
+
+// ErrUnsupported 当前平台不支持透明代理
+var ErrUnsupported = errors.New("transparent: original destination lookup not supported on this platform")
+
+// OriginalDst 返回被 iptables REDIRECT 或 DNAT 重定向到代理的连接原来的目标地址。
+// 连接不是重定向来的时返回代理自己的地址，调用方应当拒绝这样的连接以免形成回环
+func OriginalDst(conn net.Conn) (*net.TCPAddr, error) {
+	tc, ok := types.RawConn(conn).(*net.TCPConn)
+	if !ok {
+		return nil, errors.New("transparent: not a TCP connection")
+	}
+	return originalDst(tc)
+}
+
+// targetKey 上下文中原目标地址的键
+type targetKey struct{}
+
+// WithTarget 返回带有连接原目标地址 host:port 的上下文，HTTP处理器据此按透明代理处理连接
+func WithTarget(ctx context.Context, target string) context.Context {
+	return context.WithValue(ctx, targetKey{}, target)
+}
+
+// Target 返回 WithTarget 附加的原目标地址，不是透明代理的连接时返回false
+func Target(ctx context.Context) (string, bool) {
+	target, ok := ctx.Value(targetKey{}).(string)
+	return target, ok && target != ""
+}
@@ -0,0 +1,64 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build linux
+
+package transparent
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Supported 当前平台是否支持透明代理
+const Supported = true
+
+// ip6tSoOriginalDst linux/netfilter_ipv6/ip6_tables.h 中的 IP6T_SO_ORIGINAL_DST，x/sys/unix 没有定义
+const ip6tSoOriginalDst = 80
+
+// originalDst 通过 SO_ORIGINAL_DST 从 conntrack 取得原目标地址，IPv6 连接使用 IP6T_SO_ORIGINAL_DST
+func originalDst(conn *net.TCPConn) (*net.TCPAddr, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	local, _ := conn.LocalAddr().(*net.TCPAddr)
+	ipv6 := local != nil && local.IP.To4() == nil
+
+	var addr *net.TCPAddr
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if ipv6 {
+			info, err := unix.GetsockoptIPv6MTUInfo(int(fd), unix.SOL_IPV6, ip6tSoOriginalDst)
+			if err != nil {
+				sockErr = err
+				return
+			}
+			// 端口为网络字节序
+			port := (*[2]byte)(unsafe.Pointer(&info.Addr.Port))
+			addr = &net.TCPAddr{IP: net.IP(info.Addr.Addr[:]), Port: int(binary.BigEndian.Uint16(port[:]))}
+			return
+		}
+		// 返回 sockaddr_in：地址族、网络字节序的端口和IPv4地址
+		mreq, err := unix.GetsockoptIPv6Mreq(int(fd), unix.SOL_IP, unix.SO_ORIGINAL_DST)
+		if err != nil {
+			sockErr = err
+			return
+		}
+		sa := mreq.Multiaddr
+		addr = &net.TCPAddr{IP: net.IPv4(sa[4], sa[5], sa[6], sa[7]), Port: int(binary.BigEndian.Uint16(sa[2:4]))}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sockErr != nil {
+		return nil, fmt.Errorf("transparent: get original destination: %w", sockErr)
+	}
+	return addr, nil
+}
@@ -0,0 +1,17 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package transparent
+
+import "net"
+
+// Supported 当前平台是否支持透明代理
+const Supported = false
+
+func originalDst(conn *net.TCPConn) (*net.TCPAddr, error) {
+	return nil, ErrUnsupported
+}
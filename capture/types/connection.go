@@ -7,11 +7,15 @@ package types
 
 import (
 	"bufio"
+	"context"
 	"net"
+
+	"github.com/f-dong/sniffy/capture/bufpool"
 )
 
 // DefaultConnection 默认连接实现
 type DefaultConnection struct {
+	ctx    context.Context
 	conn   net.Conn
 	reader *bufio.Reader
 	writer *bufio.Writer
@@ -20,14 +24,25 @@ type DefaultConnection struct {
 
 // NewConnection 创建新的连接实例
 func NewConnection(conn net.Conn, server Server) Connection {
+	return NewConnectionWithContext(context.Background(), conn, server)
+}
+
+// NewConnectionWithContext 创建携带上下文的连接实例，上下文会传给连接上所有流的钩子
+func NewConnectionWithContext(ctx context.Context, conn net.Conn, server Server) Connection {
 	return &DefaultConnection{
+		ctx:    ctx,
 		conn:   conn,
-		reader: bufio.NewReader(conn),
-		writer: bufio.NewWriter(conn),
+		reader: bufpool.NewReader(conn),
+		writer: bufpool.NewWriter(conn),
 		server: server,
 	}
 }
 
+// GetContext 获取连接的上下文
+func (c *DefaultConnection) GetContext() context.Context {
+	return c.ctx
+}
+
 // GetConn 获取原始网络连接
 func (c *DefaultConnection) GetConn() net.Conn {
 	return c.conn
@@ -48,13 +63,57 @@ func (c *DefaultConnection) GetServer() Server {
 	return c.server
 }
 
-// Close 关闭连接
+// Close 关闭连接，缓冲读取器和写入器归还到池中，之后不能再使用
 func (c *DefaultConnection) Close() error {
 	if c.writer != nil {
 		c.writer.Flush()
+		bufpool.PutWriter(c.writer)
+		c.writer = nil
+	}
+	if c.reader != nil {
+		bufpool.PutReader(c.reader)
+		c.reader = nil
 	}
 	if c.conn != nil {
 		return c.conn.Close()
 	}
 	return nil
 }
+
+// IdleTracker 支持优雅关闭的网络连接。协议处理器等待下一个请求前把连接标记为空闲，
+// 开始读取请求后标记为忙碌；代理关闭时空闲连接立即关闭，忙碌的连接处理完当前请求后关闭
+type IdleTracker interface {
+	// SetIdle 标记连接是否空闲，代理正在关闭时返回false
+	SetIdle(idle bool) bool
+}
+
+// SetIdle 标记连接是否空闲，连接不支持 IdleTracker 时忽略。
+// 返回false表示代理正在关闭，处理器不应再在连接上读取新的请求
+func SetIdle(conn net.Conn, idle bool) bool {
+	if t, ok := conn.(IdleTracker); ok {
+		return t.SetIdle(idle)
+	}
+	return true
+}
+
+// RawConner 不改变数据流的连接包装。隧道转发时逐层取得底层连接，
+// 两端都是TCP连接时由内核直接拷贝数据，Linux 上使用 splice
+type RawConner interface {
+	// RawConn 返回被包装的连接，包装中还有未读出的缓冲数据时返回nil
+	RawConn() net.Conn
+}
+
+// RawConn 逐层取得连接的底层连接，遇到不支持 RawConner 或还有缓冲数据的包装时停止
+func RawConn(conn net.Conn) net.Conn {
+	for {
+		rc, ok := conn.(RawConner)
+		if !ok {
+			return conn
+		}
+		inner := rc.RawConn()
+		if inner == nil {
+			return conn
+		}
+		conn = inner
+	}
+}
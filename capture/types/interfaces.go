@@ -7,8 +7,31 @@ package types
 
 import (
 	"bufio"
+	"context"
+	"io"
 	"net"
 	"time"
+
+	"github.com/f-dong/sniffy/ca"
+	"github.com/f-dong/sniffy/capture/auth"
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/chaos"
+	"github.com/f-dong/sniffy/capture/dialer"
+	"github.com/f-dong/sniffy/capture/docker"
+	"github.com/f-dong/sniffy/capture/duplicates"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/hooks"
+	"github.com/f-dong/sniffy/capture/kube"
+	"github.com/f-dong/sniffy/capture/limits"
+	"github.com/f-dong/sniffy/capture/openapi"
+	"github.com/f-dong/sniffy/capture/pool"
+	"github.com/f-dong/sniffy/capture/ratelimit"
+	"github.com/f-dong/sniffy/capture/redact"
+	"github.com/f-dong/sniffy/capture/rules"
+	"github.com/f-dong/sniffy/capture/secrets"
+	"github.com/f-dong/sniffy/capture/timeouts"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+	"github.com/f-dong/sniffy/capture/tracecontext"
 )
 
 // ProtocolProcessor 协议处理器接口
@@ -19,6 +42,9 @@ type ProtocolProcessor interface {
 
 // Connection 连接接口，抽象化连接操作
 type Connection interface {
+	// GetContext 获取连接的上下文，包含 OnClientConnect 钩子附加的数据
+	GetContext() context.Context
+
 	// GetConn 获取原始网络连接
 	GetConn() net.Conn
 
@@ -51,6 +77,81 @@ type Server interface {
 
 	// FormatDataPreview 格式化数据预览
 	FormatDataPreview(data []byte) string
+
+	// GetDialer 获取上游拨号器
+	GetDialer() *dialer.Dialer
+
+	// GetFlowStore 获取流存储
+	GetFlowStore() *flow.Store
+
+	// GetCA 获取用于签发MITM证书的CA，为nil时不解密TLS
+	GetCA() ca.CA
+
+	// GetTLSPolicy 获取MITM决策策略，可能为nil
+	GetTLSPolicy() tlsinfo.Policy
+
+	// GetKeyLogWriter 获取TLS密钥日志输出，为nil时不记录
+	GetKeyLogWriter() io.Writer
+
+	// GetBreakpoints 获取断点管理器，为nil时不暂停任何流
+	GetBreakpoints() *breakpoint.Manager
+
+	// GetRules 获取请求/响应改写规则引擎，为nil时不应用任何规则
+	GetRules() *rules.Engine
+
+	// GetHooks 获取流生命周期钩子链，为nil时不调用任何钩子
+	GetHooks() *hooks.Chain
+
+	// GetEvents 获取流生命周期事件总线，为nil时不发布事件
+	GetEvents() *flow.Bus
+
+	// GetAuth 获取代理访问控制，为nil时允许所有客户端
+	GetAuth() *auth.Authenticator
+
+	// GetRateLimiter 获取按客户端和目标主机的限流器，为nil时不限流
+	GetRateLimiter() *ratelimit.Limiter
+
+	// GetChaos 获取故障注入规则，为nil时不注入故障
+	GetChaos() *chaos.Engine
+
+	// GetTimeouts 获取各阶段的超时，为nil时不限制
+	GetTimeouts() *timeouts.Policy
+
+	// GetPool 获取上游连接池，为nil时每个请求建立新连接
+	GetPool() *pool.Pool
+
+	// GetBodyPolicy 获取内容捕获策略，为nil时完整读入所有请求体和响应体
+	GetBodyPolicy() *flow.BodyPolicy
+
+	// GetLimiter 获取客户端连接数和源站进行中请求数的限制，为nil时不限制
+	GetLimiter() *limits.Limiter
+
+	// GetRedactor 获取流保存前的脱敏规则，为nil时原样保存
+	GetRedactor() *redact.Redactor
+
+	// GetValidator 获取检查流是否符合API规范的校验器，为nil时不检查
+	GetValidator() *openapi.Validator
+
+	// GetDetector 获取识别流中凭据的检测器，为nil时不检测
+	GetDetector() *secrets.Detector
+
+	// GetDuplicates 获取标记窗口内重复请求的标记器，为nil时不标记
+	GetDuplicates() *duplicates.Tracker
+
+	// GetTracing 获取为转发的请求注入追踪头部的注入器，为nil时只识别已有的追踪ID和关联ID
+	GetTracing() *tracecontext.Injector
+
+	// GetPinning 获取疑似证书固定导致的握手失败的记录，为nil时只记录失败流
+	GetPinning() *tlsinfo.Pinning
+
+	// GetListenerName 获取接受连接的命名监听器，主监听器为空
+	GetListenerName() string
+
+	// GetContainers 获取按客户端地址查找Docker容器的查找器，为nil时不查找
+	GetContainers() *docker.Resolver
+
+	// GetPod 获取作为边车运行时所在的 Pod，不是边车时为nil
+	GetPod() *kube.Pod
 }
 
 // Config 配置接口
@@ -75,6 +176,12 @@ type Config interface {
 
 	// GetThreads 获取线程数
 	GetThreads() int
+
+	// IsProxyProtocolEnabled 是否解析入站连接的PROXY protocol头部
+	IsProxyProtocolEnabled() bool
+
+	// IsProcessLookupEnabled 是否查找本机流量的发起进程
+	IsProcessLookupEnabled() bool
 }
 
 // Logger 日志接口
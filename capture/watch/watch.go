@@ -0,0 +1,93 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package watch
+
+import (
+	"context"
+	"os"
+	"slices"
+	"time"
+)
+
+// fileState 文件的修改时间和大小，文件不存在时 exists 为false
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+// Watcher 轮询文件的修改时间和大小，文件变化并稳定后调用回调。
+// 编辑器保存文件时可能先截断再写入，或写入临时文件后重命名，
+// 因此在连续两次轮询结果相同后才认为修改完成。
+type Watcher struct {
+	paths    []string
+	interval time.Duration
+	onChange func(changed []string)
+
+	state   map[string]fileState
+	pending []string
+}
+
+// New 创建文件监视器，interval 为轮询间隔
+func New(paths []string, interval time.Duration, onChange func(changed []string)) *Watcher {
+	w := &Watcher{
+		paths:    append([]string(nil), paths...),
+		interval: interval,
+		onChange: onChange,
+		state:    make(map[string]fileState, len(paths)),
+	}
+	for _, path := range w.paths {
+		w.state[path] = stat(path)
+	}
+	return w
+}
+
+// Run 轮询文件直到 ctx 结束
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if changed := w.poll(); len(changed) > 0 {
+				w.onChange(changed)
+			}
+		}
+	}
+}
+
+// poll 检查一次文件状态，返回已经稳定的变化文件
+func (w *Watcher) poll() []string {
+	settled := true
+	for _, path := range w.paths {
+		st := stat(path)
+		if st == w.state[path] {
+			continue
+		}
+		w.state[path] = st
+		settled = false
+		if !slices.Contains(w.pending, path) {
+			w.pending = append(w.pending, path)
+		}
+	}
+	if !settled || len(w.pending) == 0 {
+		return nil
+	}
+	changed := w.pending
+	w.pending = nil
+	return changed
+}
+
+// stat 返回文件当前状态
+func stat(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size(), exists: true}
+}
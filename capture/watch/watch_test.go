@@ -0,0 +1,58 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+func TestWatcher_Poll(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.js")
+	b := filepath.Join(dir, "b.lua")
+	require.NoError(t, os.WriteFile(a, []byte("1"), 0o600))
+
+	w := New([]string{a, b}, time.Hour, nil)
+	require.Empty(t, w.poll())
+
+	// 变化后等下一次轮询确认稳定
+	require.NoError(t, os.WriteFile(a, []byte("22"), 0o600))
+	require.NoError(t, os.WriteFile(b, []byte("x"), 0o600))
+	require.Empty(t, w.poll())
+	require.Equal(t, []string{a, b}, w.poll())
+	require.Empty(t, w.poll())
+
+	// 删除也是变化
+	require.NoError(t, os.Remove(b))
+	require.Empty(t, w.poll())
+	require.Equal(t, []string{b}, w.poll())
+}
+
+func TestWatcher_Run(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte("[]"), 0o600))
+
+	changed := make(chan []string, 1)
+	w := New([]string{path}, 10*time.Millisecond, func(paths []string) { changed <- paths })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"x": 1}]`), 0o600))
+	select {
+	case paths := <-changed:
+		require.Equal(t, []string{path}, paths)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not detected")
+	}
+}
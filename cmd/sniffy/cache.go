@@ -0,0 +1,58 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/f-dong/sniffy/capture/cachereport"
+)
+
+const cacheUsage = `用法:
+  sniffy cache [选项] -store DB   分析流数据库中重复请求的资源被重新校验、不必要地重新下载和过期的情况
+  sniffy cache [选项] -file FILE  分析会话或其他工具的捕获文件
+`
+
+// runCache 执行 sniffy cache 子命令，返回进程退出码
+func runCache(args []string) int {
+	fs := newFlowFlags("cache")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, cacheUsage)
+		fs.PrintDefaults()
+	}
+	expr := fs.String("filter", "", "只分析满足过滤表达式的流，例如 host == cdn.example.com")
+	output := fs.String("o", "", "报告文件，默认输出到标准输出")
+	asJSON := fs.Bool("json", false, "输出JSON，默认输出文本")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := reportCache(fs, *expr, *output, *asJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy cache: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func reportCache(fs *flowFlags, expr, output string, asJSON bool) error {
+	flows, err := filteredFlows(fs, expr)
+	if err != nil {
+		return err
+	}
+	report := cachereport.Analyze(flows)
+	if asJSON {
+		return writeJSON(output, report)
+	}
+	w, closeOutput, err := openOutput(output)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteText(w); err != nil {
+		closeOutput()
+		return err
+	}
+	return closeOutput()
+}
@@ -0,0 +1,183 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/f-dong/sniffy/ca"
+)
+
+const certUsage = `用法:
+  sniffy cert export [选项]   输出MITM根证书，CA不存在时创建
+  sniffy cert install [选项]  将MITM根证书安装到系统的信任存储，通常需要管理员权限
+`
+
+// runCert 执行 sniffy cert 子命令，返回进程退出码
+func runCert(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, certUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("sniffy cert "+args[0], flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, certUsage)
+		fs.PrintDefaults()
+	}
+	dir := fs.String("ca-dir", "", "CA证书和私钥所在的目录，默认为 ~/.sniffy")
+	var err error
+	switch args[0] {
+	case "export":
+		format := fs.String("format", "pem", "证书格式 (pem, der)")
+		output := fs.String("o", "", "输出文件，默认输出到标准输出")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		err = exportCert(*dir, *format, *output)
+	case "install":
+		dryRun := fs.Bool("dry-run", false, "只输出安装步骤，不执行")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		err = installCert(*dir, *dryRun, os.Stdout)
+	default:
+		fmt.Fprint(os.Stderr, certUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy cert %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// loadCA 加载目录中的CA，不存在时创建，与代理启动时相同
+func loadCA(dir string) (ca.CA, error) {
+	return (&Config{MITM: true, CADir: dir}).NewCA()
+}
+
+// exportCert 以PEM或DER格式输出根证书
+func exportCert(dir, format, output string) error {
+	if format != "pem" && format != "der" {
+		return fmt.Errorf("unsupported certificate format %q (expected pem or der)", format)
+	}
+	authority, err := loadCA(dir)
+	if err != nil {
+		return err
+	}
+	w, closeOutput, err := openOutput(output)
+	if err != nil {
+		return err
+	}
+	der := authority.GetCA().Raw
+	if format == "pem" {
+		err = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	} else {
+		_, err = w.Write(der)
+	}
+	if err != nil {
+		closeOutput()
+		return err
+	}
+	return closeOutput()
+}
+
+// installStep 安装证书的一个步骤，copyTo 不为空时复制证书文件，否则执行命令
+type installStep struct {
+	copyTo string
+	args   []string
+}
+
+func (s installStep) String() string {
+	if s.copyTo != "" {
+		return "copy certificate to " + s.copyTo
+	}
+	return strings.Join(s.args, " ")
+}
+
+// installSteps 返回在 goos 上把 certFile 安装到系统信任存储的步骤，lookPath 用于判断Linux发行版的工具
+func installSteps(goos, certFile string, lookPath func(string) (string, error)) ([]installStep, error) {
+	switch goos {
+	case "darwin":
+		return []installStep{{args: []string{"security", "add-trusted-cert", "-d", "-r", "trustRoot", "-k", "/Library/Keychains/System.keychain", certFile}}}, nil
+	case "windows":
+		return []installStep{{args: []string{"certutil", "-addstore", "-f", "ROOT", certFile}}}, nil
+	case "linux":
+		// Debian、Ubuntu、Alpine
+		if _, err := lookPath("update-ca-certificates"); err == nil {
+			return []installStep{
+				{copyTo: "/usr/local/share/ca-certificates/sniffy-ca.crt"},
+				{args: []string{"update-ca-certificates"}},
+			}, nil
+		}
+		// Fedora、RHEL
+		if _, err := lookPath("update-ca-trust"); err == nil {
+			return []installStep{
+				{copyTo: "/etc/pki/ca-trust/source/anchors/sniffy-ca.crt"},
+				{args: []string{"update-ca-trust", "extract"}},
+			}, nil
+		}
+		// Arch 等使用 p11-kit 的发行版
+		if _, err := lookPath("trust"); err == nil {
+			return []installStep{{args: []string{"trust", "anchor", "--store", certFile}}}, nil
+		}
+		return nil, errors.New("no supported trust store tool found (update-ca-certificates, update-ca-trust or trust)")
+	}
+	return nil, fmt.Errorf("installing certificates is not supported on %s, use sniffy cert export and install it manually", goos)
+}
+
+// installCert 将根证书安装到系统的信任存储，浏览器和使用系统根证书的程序因此信任MITM证书
+func installCert(dir string, dryRun bool, out io.Writer) error {
+	authority, err := loadCA(dir)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: authority.GetCA().Raw})
+	tmp, err := os.MkdirTemp("", "sniffy-cert")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	certFile := filepath.Join(tmp, "sniffy-ca.crt")
+	if err := os.WriteFile(certFile, data, 0o644); err != nil {
+		return err
+	}
+
+	steps, err := installSteps(runtime.GOOS, certFile, exec.LookPath)
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		fmt.Fprintln(out, step)
+		if dryRun {
+			continue
+		}
+		if step.copyTo != "" {
+			if err := os.WriteFile(step.copyTo, data, 0o644); err != nil {
+				return err
+			}
+			continue
+		}
+		cmd := exec.Command(step.args[0], step.args[1:]...)
+		cmd.Stdout, cmd.Stderr = out, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", step.args[0], err)
+		}
+	}
+	if !dryRun {
+		fmt.Fprintf(out, "Installed %s\n", authority.GetCA().Subject.CommonName)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os/exec"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// fakeLookPath 只找到 tools 中的命令
+func fakeLookPath(tools ...string) func(string) (string, error) {
+	return func(name string) (string, error) {
+		if slices.Contains(tools, name) {
+			return "/usr/bin/" + name, nil
+		}
+		return "", exec.ErrNotFound
+	}
+}
+
+// --- 测试代码 ---
+
+func TestInstallSteps(t *testing.T) {
+	const certFile = "/tmp/sniffy-cert/sniffy-ca.crt"
+	tests := []struct {
+		name  string
+		goos  string
+		tools []string
+		want  []string
+		err   string
+	}{
+		{
+			name: "macos",
+			goos: "darwin",
+			want: []string{"security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain " + certFile},
+		},
+		{
+			name: "windows",
+			goos: "windows",
+			want: []string{"certutil -addstore -f ROOT " + certFile},
+		},
+		{
+			name:  "debian",
+			goos:  "linux",
+			tools: []string{"update-ca-certificates", "trust"},
+			want:  []string{"copy certificate to /usr/local/share/ca-certificates/sniffy-ca.crt", "update-ca-certificates"},
+		},
+		{
+			name:  "fedora",
+			goos:  "linux",
+			tools: []string{"update-ca-trust", "trust"},
+			want:  []string{"copy certificate to /etc/pki/ca-trust/source/anchors/sniffy-ca.crt", "update-ca-trust extract"},
+		},
+		{
+			name:  "arch",
+			goos:  "linux",
+			tools: []string{"trust"},
+			want:  []string{"trust anchor --store " + certFile},
+		},
+		{
+			name: "linux without tools",
+			goos: "linux",
+			err:  "no supported trust store tool found",
+		},
+		{
+			name: "unsupported",
+			goos: "plan9",
+			err:  "not supported on plan9",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := installSteps(tt.goos, certFile, fakeLookPath(tt.tools...))
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			lines := make([]string, len(steps))
+			for i, s := range steps {
+				lines[i] = s.String()
+			}
+			require.Equal(t, tt.want, lines)
+		})
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/f-dong/sniffy/ca"
+	"github.com/f-dong/sniffy/capture/accesslog"
+	"github.com/f-dong/sniffy/capture/addon"
+	"github.com/f-dong/sniffy/capture/auth"
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/cassette"
+	"github.com/f-dong/sniffy/capture/chaos"
+	"github.com/f-dong/sniffy/capture/dialer"
+	"github.com/f-dong/sniffy/capture/docker"
+	"github.com/f-dong/sniffy/capture/ebpf"
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/har"
+	"github.com/f-dong/sniffy/capture/kube"
+	"github.com/f-dong/sniffy/capture/logging"
+	"github.com/f-dong/sniffy/capture/openapi"
+	"github.com/f-dong/sniffy/capture/pac"
+	"github.com/f-dong/sniffy/capture/ratelimit"
+	"github.com/f-dong/sniffy/capture/redact"
+	"github.com/f-dong/sniffy/capture/rules"
+	"github.com/f-dong/sniffy/capture/sample"
+	"github.com/f-dong/sniffy/capture/script"
+	"github.com/f-dong/sniffy/capture/seal"
+	"github.com/f-dong/sniffy/capture/sink"
+	"github.com/f-dong/sniffy/capture/throttle"
+	"github.com/f-dong/sniffy/capture/timeouts"
+)
+
+const checkUsage = `用法:
+  sniffy check -config FILE  检查配置文件的语法、规则和过滤表达式以及引用的证书、脚本等文件，不启动代理。
+                             SNIFFY_ 环境变量与启动时一样覆盖配置文件
+`
+
+// itemCheck 检查配置项的一个值，列表按项检查
+type itemCheck func(c *Config, value string) error
+
+// itemChecks 按 yaml 键检查配置项的值，出错时报告值所在的行
+var itemChecks = map[string]itemCheck{
+	"host_mappings": func(_ *Config, s string) error {
+		_, _, err := dialer.ParseHostMapping(s)
+		return err
+	},
+	"throttle":      parsed(throttle.ParseRule),
+	"timeouts":      parsed(timeouts.Parse),
+	"host_timeouts": parsed(timeouts.ParseRule),
+	"upstream_proxy": func(c *Config, _ string) error {
+		_, err := c.NewUpstreamProxy()
+		return err
+	},
+	"upstream_tls_profile": func(_ *Config, s string) error {
+		return dialer.New().SetClientHelloProfile(s)
+	},
+	"upstream_ca_files": func(_ *Config, s string) error {
+		return dialer.NewVerifyPolicy().AddRootsFile(s)
+	},
+	"pins": func(_ *Config, s string) error {
+		_, _, err := dialer.ParsePin(s)
+		return err
+	},
+	"docker_host": func(_ *Config, s string) error {
+		_, err := docker.NewClient(s)
+		return err
+	},
+	"ca_dir": checkCADir,
+	"breakpoints": func(_ *Config, s string) error {
+		_, _, err := breakpoint.ParseRule(s)
+		return err
+	},
+	"map_local":       checkMapLocal,
+	"map_remote":      parsed(rules.ParseMapRemote),
+	"header_rules":    parsed(rules.ParseHeaderRule),
+	"body_rules":      parsed(rules.ParseBodyRule),
+	"tag_rules":       parsed(rules.ParseTagRule),
+	"mock_files":      parsed(rules.LoadMocks),
+	"har_mock_files":  checkFlows(har.Read),
+	"har_replay_file": checkFlows(har.Read),
+	"replay_cassette": checkFlows(cassette.Read),
+	"pod_labels_file": parsed(kube.LoadLabels),
+	"ebpf_ports":      parsed(ebpf.ParsePorts),
+	"load_sessions": func(_ *Config, s string) error {
+		_, err := os.Stat(s)
+		return err
+	},
+	"capture_filter":     parsed(filter.Compile),
+	"sample_rules":       parsed(sample.ParseRule),
+	"redact":             parsed(redact.ParseRule),
+	"openapi_spec":       parsed(openapi.LoadValidator),
+	"encrypt_recipients": parsed(seal.ParseX25519Recipient),
+	"identity_files": func(_ *Config, s string) error {
+		data, err := os.ReadFile(s)
+		if err != nil {
+			return err
+		}
+		_, err = seal.ParseIdentities(data)
+		return err
+	},
+	"encrypt_passphrase_file": func(_ *Config, s string) error {
+		_, err := os.Stat(s)
+		return err
+	},
+	"scripts": func(_ *Config, s string) error {
+		h, err := script.Load(s)
+		if c, ok := h.(io.Closer); ok {
+			c.Close()
+		}
+		return err
+	},
+	"addons": func(_ *Config, s string) error {
+		client, err := addon.NewClient(s)
+		if err != nil {
+			return err
+		}
+		return client.Close()
+	},
+	"proxy_users": func(_ *Config, s string) error {
+		_, _, err := auth.ParseUser(s)
+		return err
+	},
+	"allowed_clients": parsed(auth.ParseClient),
+	"trusted_proxies": parsed(auth.ParseClient),
+	"rate_limits":     parsed(ratelimit.ParseRule),
+	"chaos":           parsed(chaos.ParseRule),
+	"pac_hosts": func(_ *Config, s string) error {
+		_, err := pac.New("127.0.0.1:8080", []string{s})
+		return err
+	},
+	"access_log_format": func(_ *Config, s string) error {
+		_, err := accesslog.New(io.Discard, s)
+		return err
+	},
+	"stream_url": func(_ *Config, s string) error {
+		return sink.CheckURL(s)
+	},
+	"log_level": parsed(logging.ParseLevel),
+	"log_levels": func(_ *Config, s string) error {
+		_, _, err := logging.ParseSubsystemLevel(s)
+		return err
+	},
+	// 输出文件所在的目录需要存在
+	"key_log_file":    checkParentDir,
+	"store_file":      checkParentDir,
+	"record_cassette": checkParentDir,
+	"har_file":        checkParentDir,
+	"pcapng_file":     checkParentDir,
+	"session_file":    checkParentDir,
+	"access_log":      checkParentDir,
+	"log_file":        checkParentDir,
+}
+
+// parsed 将解析函数转换为 itemCheck
+func parsed[T any](parse func(string) (T, error)) itemCheck {
+	return func(_ *Config, s string) error {
+		_, err := parse(s)
+		return err
+	}
+}
+
+// checkMapLocal 检查 map-local 规则和它指向的本地文件或目录
+func checkMapLocal(_ *Config, s string) error {
+	m, err := rules.ParseMapLocal(s)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(m.Path)
+	return err
+}
+
+// checkFlows 检查可能加密的流文件可以读取
+func checkFlows(read func(io.Reader) ([]*flow.Flow, error)) itemCheck {
+	return func(c *Config, s string) error {
+		// 密钥的错误由 identity_files 等配置项报告
+		keys, _ := c.NewKeys()
+		_, err := loadFlows(keys, s, read)
+		return err
+	}
+}
+
+// checkCADir 检查目录中已有的CA可以加载，没有CA时启动时创建
+func checkCADir(c *Config, dir string) error {
+	if !c.MITM {
+		return nil
+	}
+	_, certErr := os.Stat(filepath.Join(dir, "sniffy-ca.crt"))
+	_, keyErr := os.Stat(filepath.Join(dir, "sniffy-ca.key"))
+	if certErr != nil || keyErr != nil {
+		return checkParentDir(c, filepath.Join(dir, "sniffy-ca.crt"))
+	}
+	_, err := ca.NewSelfSignedCA(dir)
+	return err
+}
+
+// checkParentDir 检查输出文件所在的目录存在
+func checkParentDir(_ *Config, path string) error {
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// runCheck 执行 sniffy check 子命令，返回进程退出码
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("sniffy check", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, checkUsage)
+		fs.PrintDefaults()
+	}
+	path := fs.String("config", "", "配置文件路径 (.yaml, .json, .toml)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *path == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	problems := checkConfig(*path, os.Environ())
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "sniffy check: %d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Printf("%s: configuration is valid\n", *path)
+	return 0
+}
+
+// checkConfig 检查配置文件，返回所有发现的问题。
+// 语法错误和未知的键之后不再检查；各配置项的值按项检查，都有效时再检查配置项之间的约束
+func checkConfig(path string, environ []string) []string {
+	root, err := readConfigFile(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	c := DefaultConfig()
+	if root != nil {
+		if err := root.Decode(c); err != nil {
+			return []string{fmt.Sprintf("%s: %v", path, decodeError(err))}
+		}
+	}
+	if err := c.ApplyEnv(environ); err != nil {
+		return []string{err.Error()}
+	}
+
+	// 配置项来自环境变量时报告变量名，来自配置文件时报告行号
+	fromEnv := make(map[string]bool)
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if key, ok := strings.CutPrefix(name, envPrefix); ok {
+			fromEnv[strings.ToLower(key)] = true
+		}
+	}
+	nodes := make(map[string]*yaml.Node)
+	if root != nil {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			nodes[root.Content[i].Value] = root.Content[i+1]
+		}
+	}
+	location := func(key string, item int) string {
+		if fromEnv[key] {
+			return envPrefix + strings.ToUpper(key)
+		}
+		node, ok := nodes[key]
+		if !ok {
+			return key
+		}
+		if node.Kind == yaml.SequenceNode && item < len(node.Content) {
+			node = node.Content[item]
+		}
+		return fmt.Sprintf("%s: line %d: %s", path, node.Line, key)
+	}
+
+	var problems []string
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := range t.NumField() {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		switch value := v.Field(i).Interface().(type) {
+		case string:
+			if check := itemChecks[key]; check != nil && value != "" {
+				if err := check(c, value); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %v", location(key, 0), err))
+				}
+			}
+		case []string:
+			for j, item := range value {
+				if check := itemChecks[key]; check != nil {
+					if err := check(c, item); err != nil {
+						problems = append(problems, fmt.Sprintf("%s[%d]: %v", location(key, j), j, err))
+					}
+				}
+			}
+		case []ListenerConfig:
+			for j, l := range value {
+				if err := l.check(); err != nil {
+					problems = append(problems, fmt.Sprintf("%s[%d]: %v", location(key, j), j, err))
+				}
+			}
+		case []ClientCertConfig:
+			for j, cc := range value {
+				if _, err := cc.Load(); err != nil {
+					problems = append(problems, fmt.Sprintf("%s[%d]: %v", location(key, j), j, err))
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	if err := c.Validate(); err != nil {
+		return []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+	return nil
+}
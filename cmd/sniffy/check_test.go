@@ -0,0 +1,65 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 测试代码 ---
+
+func TestCheckConfig(t *testing.T) {
+	certFile := writeConfig(t, "client.crt", "")
+	keyFile := filepath.Join(filepath.Dir(certFile), "client.key")
+	path := writeConfig(t, "sniffy.yaml", fmt.Sprintf(`port: 8080
+header_rules:
+  - "request set example.com X-Debug: 1"
+  - "bogus"
+capture_filter: "host =="
+client_certs:
+  - host: "*.example.com"
+    cert_file: /nonexistent/client.crt
+    key_file: /nonexistent/client.key
+  - host: "api.example.com"
+    cert_file: %s
+    key_file: %s
+`, certFile, keyFile))
+
+	// 列表中的每一项报告自己所在的行
+	problems := checkConfig(path, nil)
+	require.Len(t, problems, 4)
+	require.Contains(t, problems, path+`: line 4: header_rules[1]: invalid header rule "bogus" (expected phase action match Name[: value])`)
+	require.Contains(t, problems, path+`: line 5: capture_filter: filter "host ==": unexpected end of expression, expected value`)
+	require.Contains(t, problems, path+": line 7: client_certs[0]: load client certificate /nonexistent/client.crt: open /nonexistent/client.crt: no such file or directory")
+	require.Contains(t, problems, path+": line 10: client_certs[1]: load client certificate "+certFile+": open "+keyFile+": no such file or directory")
+}
+
+func TestCheckConfig_Env(t *testing.T) {
+	path := writeConfig(t, "sniffy.yaml", "capture_filter: \"host == example.com\"\n")
+	require.Empty(t, checkConfig(path, nil))
+
+	// 来自环境变量的值报告变量名
+	problems := checkConfig(path, []string{"SNIFFY_CAPTURE_FILTER=host =="})
+	require.Equal(t, []string{`SNIFFY_CAPTURE_FILTER: filter "host ==": unexpected end of expression, expected value`}, problems)
+}
+
+func TestCheckConfig_Errors(t *testing.T) {
+	// 未知的键不再检查各配置项
+	path := writeConfig(t, "sniffy.yaml", "capture_filter: \"host ==\"\nbogus: 1\n")
+	problems := checkConfig(path, nil)
+	require.Len(t, problems, 1)
+	require.Contains(t, problems[0], "bogus")
+
+	// 各配置项有效时检查配置项之间的约束
+	path = writeConfig(t, "sniffy.yaml", "accept_proxy_protocol: true\n")
+	problems = checkConfig(path, nil)
+	require.Len(t, problems, 1)
+	require.Contains(t, problems[0], path+": accept_proxy_protocol requires trusted_proxies")
+}
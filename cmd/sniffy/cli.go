@@ -0,0 +1,79 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// subcommand 命令行的子命令，run 为nil的子命令启动代理，使用代理的命令行参数
+type subcommand struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// subcommands 所有子命令，按帮助中显示的顺序排列
+var subcommands = []subcommand{
+	{"serve", "启动代理，未指定子命令时的默认行为", nil},
+	{"console", "启动代理并以终端界面查看和拦截流量", nil},
+	{"check", "检查配置文件和引用的文件，不启动代理", runCheck},
+	{"cert", "导出MITM根证书或安装到系统的信任存储", runCert},
+	{"replay", "经由运行中的代理重放捕获的请求", runReplay},
+	{"tail", "实时输出运行中的代理结束的每个流", runTail},
+	{"proxy", "把系统代理设置为运行中的代理或恢复原来的设置", runProxy},
+	{"docker", "生成重定向Docker网络流量的规则，在容器中信任MITM根证书", runDocker},
+	{"kube", "在 Kubernetes Pod 中安装把出站流量重定向到边车的规则", runKube},
+	{"export", "以JSON Lines或CSV格式导出流", runExport},
+	{"session", "查看、导出和导入会话文件", runSession},
+	{"curl", "以 curl 命令的形式输出捕获的请求", runCurl},
+	{"code", "以Go或Python代码的形式输出捕获的请求", runCode},
+	{"diff", "比较两个流", runDiff},
+	{"openapi", "由捕获的流生成API文档", runOpenAPI},
+	{"postman", "将捕获的流导出为 Postman 集合", runPostman},
+	{"headers", "按主机检查响应的安全头部", runHeaders},
+	{"tls-report", "汇总上游的TLS配置", runTLSReport},
+	{"cache", "分析HTTP缓存的表现", runCache},
+	{"duplicates", "找出窗口内的重复请求", runDuplicates},
+}
+
+// runSubcommand 执行 args[0] 指定的不启动代理的子命令，不是这样的子命令时返回false
+func runSubcommand(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	if args[0] == "help" {
+		usage()
+		return 0, true
+	}
+	for _, c := range subcommands {
+		if c.name == args[0] && c.run != nil {
+			return c.run(args[1:]), true
+		}
+	}
+	return 0, false
+}
+
+// usage 输出子命令列表和代理的命令行参数
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprint(out, "用法:\n  sniffy [serve|console] [选项]  启动代理\n  sniffy <命令> [选项]           每个命令的选项见 sniffy <命令> -h\n\n命令:\n")
+	for _, c := range subcommands {
+		fmt.Fprintf(out, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprint(out, "\n代理选项:\n")
+	flag.PrintDefaults()
+}
+
+// checkNoArgs 启动代理时不接受选项以外的参数，避免拼错的子命令被忽略
+func checkNoArgs() {
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "sniffy: unknown command %q, run 'sniffy help' for usage\n", flag.Arg(0))
+		os.Exit(2)
+	}
+}
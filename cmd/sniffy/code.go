@@ -0,0 +1,47 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/codegen"
+)
+
+const codeUsage = `用法:
+  sniffy code [选项] -store DB ID      以代码的形式输出流数据库中的请求
+  sniffy code [选项] -file FILE ID|N   从会话或其他工具的捕获文件中查找请求
+`
+
+// runCode 执行 sniffy code 子命令，返回进程退出码
+func runCode(args []string) int {
+	fs := newFlowFlags("code")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, codeUsage)
+		fs.PrintDefaults()
+	}
+	lang := fs.String("lang", "go", "代码的语言 ("+strings.Join(codegen.Languages(), ", ")+")")
+	var opts codegen.Options
+	fs.BoolVar(&opts.Insecure, "k", false, "不校验服务器证书")
+	fs.StringVar(&opts.Proxy, "x", "", "经由该代理发送请求，例如 http://127.0.0.1:8080")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	f, err := fs.findFlow()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy code: %v\n", err)
+		return 1
+	}
+	code, err := codegen.Generate(*lang, f, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy code: %v\n", err)
+		return 1
+	}
+	fmt.Print(code)
+	return 0
+}
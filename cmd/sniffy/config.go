@@ -6,9 +6,66 @@
 package main
 
 import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"log/slog"
 	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/f-dong/sniffy/ca"
+	"github.com/f-dong/sniffy/capture"
+	"github.com/f-dong/sniffy/capture/accesslog"
+	"github.com/f-dong/sniffy/capture/addon"
+	"github.com/f-dong/sniffy/capture/archive"
+	"github.com/f-dong/sniffy/capture/auth"
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/cassette"
+	"github.com/f-dong/sniffy/capture/chaos"
+	"github.com/f-dong/sniffy/capture/dialer"
+	"github.com/f-dong/sniffy/capture/docker"
+	"github.com/f-dong/sniffy/capture/duplicates"
+	"github.com/f-dong/sniffy/capture/ebpf"
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/har"
+	"github.com/f-dong/sniffy/capture/hooks"
+	"github.com/f-dong/sniffy/capture/kube"
+	"github.com/f-dong/sniffy/capture/limits"
+	"github.com/f-dong/sniffy/capture/logging"
+	"github.com/f-dong/sniffy/capture/openapi"
+	"github.com/f-dong/sniffy/capture/otlp"
+	"github.com/f-dong/sniffy/capture/pac"
+	"github.com/f-dong/sniffy/capture/pool"
+	"github.com/f-dong/sniffy/capture/ratelimit"
+	"github.com/f-dong/sniffy/capture/redact"
+	"github.com/f-dong/sniffy/capture/replay"
+	"github.com/f-dong/sniffy/capture/rules"
+	"github.com/f-dong/sniffy/capture/sample"
+	"github.com/f-dong/sniffy/capture/script"
+	"github.com/f-dong/sniffy/capture/seal"
+	"github.com/f-dong/sniffy/capture/secrets"
+	"github.com/f-dong/sniffy/capture/session"
+	"github.com/f-dong/sniffy/capture/sink"
+	"github.com/f-dong/sniffy/capture/stats"
+	"github.com/f-dong/sniffy/capture/throttle"
+	"github.com/f-dong/sniffy/capture/timeouts"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+	"github.com/f-dong/sniffy/capture/tracecontext"
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http/httpproxy"
 )
 
 // Config TCP监听器配置
@@ -19,15 +76,25 @@ type Config struct {
 	// Port 监听端口，默认为 8080
 	Port int `json:"port" yaml:"port"`
 
+	// Listeners 同时运行的其他命名监听器，与主监听器共享CA、存储和控制端口，可以有自己的模式和规则
+	Listeners []ListenerConfig `json:"listeners" yaml:"listeners"`
+
 	// ReadTimeout 读取超时时间
 	ReadTimeout time.Duration `json:"read_timeout" yaml:"read_timeout"`
 
 	// WriteTimeout 写入超时时间
 	WriteTimeout time.Duration `json:"write_timeout" yaml:"write_timeout"`
 
-	// MaxConnections 最大连接数，0表示无限制
+	// ShutdownTimeout 优雅关闭时等待正在处理的流完成的最长时间，超时后强制关闭连接
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+
+	// MaxConnections 最大并发客户端连接数，超出时连接被重置。0表示按文件描述符限制估算，
+	// 大于估算值时也按估算值限制
 	MaxConnections int `json:"max_connections" yaml:"max_connections"`
 
+	// MaxOriginRequests 每个源站的最大进行中请求数，超出时返回503，0表示无限制
+	MaxOriginRequests int `json:"max_origin_requests" yaml:"max_origin_requests"`
+
 	// BufferSize 缓冲区大小
 	BufferSize int `json:"buffer_size" yaml:"buffer_size"`
 
@@ -36,19 +103,552 @@ type Config struct {
 
 	// Threads 线程数
 	Threads int `json:"threads" yaml:"threads"`
+
+	// HostMappings 静态主机映射，格式为 host=target
+	HostMappings []string `json:"host_mappings" yaml:"host_mappings"`
+
+	// DNSServer 上游解析使用的DNS服务器，为空时使用系统解析器
+	DNSServer string `json:"dns_server" yaml:"dns_server"`
+
+	// AcceptProxyProtocol 是否解析入站连接的PROXY protocol头部，需要同时配置 TrustedProxies
+	AcceptProxyProtocol bool `json:"accept_proxy_protocol" yaml:"accept_proxy_protocol"`
+
+	// TrustedProxies 允许发送PROXY protocol头部的对端IP或CIDR，例如负载均衡器的地址。
+	// 其他对端发送头部的连接被拒绝
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies"`
+
+	// UpstreamProxyProtocol 向上游发送的PROXY protocol版本，0表示不发送
+	UpstreamProxyProtocol int `json:"upstream_proxy_protocol" yaml:"upstream_proxy_protocol"`
+
+	// Throttle 按主机模拟的网络条件，格式为 host=profile，profile 为预设名称（gprs、3g、4g、dsl 等）
+	// 或 down=1mbit,up=256kbit,latency=80ms,jitter=20ms，"*" 匹配所有主机
+	Throttle []string `json:"throttle" yaml:"throttle"`
+
+	// Timeouts 各阶段的全局超时，格式见 timeouts.Parse，
+	// 例如 dial=5s,tls=5s,request-header=10s,response-header=30s,idle=90s,flow=2m，未设置的阶段不限制
+	Timeouts string `json:"timeouts" yaml:"timeouts"`
+
+	// HostTimeouts 按主机覆盖的超时，格式为 host=option=duration[,...]，例如 *.example.com=response-header=2m
+	HostTimeouts []string `json:"host_timeouts" yaml:"host_timeouts"`
+
+	// PoolMaxIdle 每个上游源站保留的空闲keep-alive连接数，0 表示每个请求建立新连接
+	PoolMaxIdle int `json:"pool_max_idle" yaml:"pool_max_idle"`
+
+	// PoolIdleTimeout 空闲上游连接的保留时间
+	PoolIdleTimeout time.Duration `json:"pool_idle_timeout" yaml:"pool_idle_timeout"`
+
+	// UpstreamHTTP2 与HTTPS上游协商h2，同一源站的请求并发复用一条连接，
+	// 证书覆盖且解析到相同IP的源站合并到同一条连接，需要启用连接池
+	UpstreamHTTP2 bool `json:"upstream_http2" yaml:"upstream_http2"`
+
+	// BodyLimit 内存中捕获的最大请求体或响应体字节数，更长的内容边读边转发，
+	// 不经过钩子、断点和改写规则，0 表示完整读入所有内容
+	BodyLimit int64 `json:"body_limit" yaml:"body_limit"`
+
+	// BodySpillDir 保存超过 BodyLimit 的完整内容的目录，为空时只保留开头部分
+	BodySpillDir string `json:"body_spill_dir" yaml:"body_spill_dir"`
+
+	// UpstreamProxy 上游HTTP代理地址，所有上游连接通过它的CONNECT隧道建立
+	UpstreamProxy string `json:"upstream_proxy" yaml:"upstream_proxy"`
+
+	// UpstreamProxyAuth 上游代理认证，格式为 basic:user:password、ntlm:DOMAIN\user:password、
+	// negotiate[:spn] 或 negotiate:user@REALM:password
+	UpstreamProxyAuth string `json:"upstream_proxy_auth" yaml:"upstream_proxy_auth"`
+
+	// IgnoreProxyEnv 未配置 UpstreamProxy 时不使用 HTTP_PROXY、HTTPS_PROXY 和 NO_PROXY 环境变量
+	IgnoreProxyEnv bool `json:"ignore_proxy_env" yaml:"ignore_proxy_env"`
+
+	// ProcessLookup 是否查找本机流量的发起进程
+	ProcessLookup bool `json:"process_lookup" yaml:"process_lookup"`
+
+	// Docker 是否通过Docker API按客户端地址查找发起连接的容器
+	Docker bool `json:"docker" yaml:"docker"`
+
+	// DockerHost Docker守护进程的地址 unix:///path 或 tcp://host:port，为空时使用 DOCKER_HOST 环境变量
+	DockerHost string `json:"docker_host" yaml:"docker_host"`
+
+	// PodName 作为 Kubernetes 边车运行时所在的 Pod，不为空时记录到每个流。
+	// 通常由 downward API 通过 SNIFFY_POD_NAME 等环境变量设置
+	PodName string `json:"pod_name" yaml:"pod_name"`
+
+	// PodNamespace 所在 Pod 的命名空间
+	PodNamespace string `json:"pod_namespace" yaml:"pod_namespace"`
+
+	// NodeName 所在 Pod 运行的节点
+	NodeName string `json:"node_name" yaml:"node_name"`
+
+	// PodLabelsFile downward API 卷中 metadata.labels 的文件，Pod 的标签随流记录
+	PodLabelsFile string `json:"pod_labels_file" yaml:"pod_labels_file"`
+
+	// EBPFCgroup ebpf 模式的监听器附加eBPF程序的 cgroup v2 目录，为空时为 /sys/fs/cgroup，
+	// 目录中所有进程发起的TCP连接都被重定向到这个监听器
+	EBPFCgroup string `json:"ebpf_cgroup" yaml:"ebpf_cgroup"`
+
+	// EBPFPorts 重定向的目标端口，逗号分隔，例如 80,443，为空时重定向所有端口
+	EBPFPorts string `json:"ebpf_ports" yaml:"ebpf_ports"`
+
+	// MITM 是否解密TLS流量
+	MITM bool `json:"mitm" yaml:"mitm"`
+
+	// CADir CA证书和私钥的存储目录，为空时使用 ~/.sniffy
+	CADir string `json:"ca_dir" yaml:"ca_dir"`
+
+	// PassthroughHosts 不解密的SNI主机名，支持 "*.example.com"
+	PassthroughHosts []string `json:"passthrough_hosts" yaml:"passthrough_hosts"`
+
+	// PassthroughALPN 客户端声明这些ALPN协议时不解密
+	PassthroughALPN []string `json:"passthrough_alpn" yaml:"passthrough_alpn"`
+
+	// PassthroughFingerprints 客户端JA3/JA4指纹匹配时不解密
+	PassthroughFingerprints []string `json:"passthrough_fingerprints" yaml:"passthrough_fingerprints"`
+
+	// PinningPassthrough 客户端疑似因证书固定拒绝代理的证书时，自动透传该主机，客户端重试时即可恢复
+	PinningPassthrough bool `json:"pinning_passthrough" yaml:"pinning_passthrough"`
+
+	// UpstreamTLSProfile 连接上游TLS时模拟的ClientHello (go, chrome, firefox, safari, ios, edge, randomized)
+	UpstreamTLSProfile string `json:"upstream_tls_profile" yaml:"upstream_tls_profile"`
+
+	// KeyLogFile TLS密钥日志文件路径（NSS格式），为空时不记录
+	KeyLogFile string `json:"key_log_file" yaml:"key_log_file"`
+
+	// UpstreamCAFiles 校验上游证书时额外信任的PEM根证书文件
+	UpstreamCAFiles []string `json:"upstream_ca_files" yaml:"upstream_ca_files"`
+
+	// InsecureHosts 跳过上游证书校验的主机，"*" 表示所有主机
+	InsecureHosts []string `json:"insecure_hosts" yaml:"insecure_hosts"`
+
+	// Pins 上游公钥固定，格式为 host=sha256/<base64>
+	Pins []string `json:"pins" yaml:"pins"`
+
+	// ClientCerts 上游双向TLS使用的客户端证书
+	ClientCerts []ClientCertConfig `json:"client_certs" yaml:"client_certs"`
+
+	// Breakpoints 断点规则，格式为 phase:[METHOD ]host[/path]
+	Breakpoints []string `json:"breakpoints" yaml:"breakpoints"`
+
+	// BreakpointTimeout 断点暂停超时，超时后流自动继续，0表示一直等待
+	BreakpointTimeout time.Duration `json:"breakpoint_timeout" yaml:"breakpoint_timeout"`
+
+	// MapLocal 本地文件响应规则，格式为 pattern=path[,latency]
+	MapLocal []string `json:"map_local" yaml:"map_local"`
+
+	// MapRemote 上游改写规则，格式为 pattern=url[,preserve-host]
+	MapRemote []string `json:"map_remote" yaml:"map_remote"`
+
+	// HeaderRules 头部改写规则，格式为 "phase action match Name[: value]"
+	HeaderRules []string `json:"header_rules" yaml:"header_rules"`
+
+	// BodyRules 内容改写规则，格式为 "phase match s/find/replace/[flags]"
+	BodyRules []string `json:"body_rules" yaml:"body_rules"`
+
+	// TagRules 标签规则，格式为 "tag=过滤表达式"，流结束时为匹配的流添加标签
+	TagRules []string `json:"tag_rules" yaml:"tag_rules"`
+
+	// MockFiles 模拟响应定义文件（JSON数组）
+	MockFiles []string `json:"mock_files" yaml:"mock_files"`
+
+	// RecordCassette 将所有流录制到该磁带文件
+	RecordCassette string `json:"record_cassette" yaml:"record_cassette"`
+
+	// ReplayCassette 使用该磁带文件中录制的响应回答请求
+	ReplayCassette string `json:"replay_cassette" yaml:"replay_cassette"`
+
+	// ReplayPassthrough 回放时未录制的请求转发到上游，默认返回502
+	ReplayPassthrough bool `json:"replay_passthrough" yaml:"replay_passthrough"`
+
+	// CaptureFilter 捕获过滤表达式，只记录满足条件的流，例如 `host == "api.example.com" && status >= 400`
+	CaptureFilter string `json:"capture_filter" yaml:"capture_filter"`
+
+	// SampleRate 没有采样规则匹配时记录流的比例，取值 [0, 1]，1 表示全部记录
+	SampleRate float64 `json:"sample_rate" yaml:"sample_rate"`
+
+	// SampleRules 采样规则，格式见 sample.ParseRule，按顺序使用第一条匹配的规则，
+	// 例如 100%:status >= 500 或 1:host == "api.example.com"
+	SampleRules []string `json:"sample_rules" yaml:"sample_rules"`
+
+	// Redact 流保存和导出前的脱敏规则，格式见 redact.ParseRule，
+	// 例如 header/hash:Cookie、field/remove:user.password 或 pattern:credit-card
+	Redact []string `json:"redact" yaml:"redact"`
+
+	// RedactDefaults 脱敏 Authorization、Proxy-Authorization、Cookie 和 Set-Cookie 头部
+	RedactDefaults bool `json:"redact_defaults" yaml:"redact_defaults"`
+
+	// DetectCredentials 识别流中的 Bearer 令牌、API密钥、AWS SigV4 签名和 Basic 认证，并添加 credential:<类型> 标签
+	DetectCredentials bool `json:"detect_credentials" yaml:"detect_credentials"`
+
+	// RedactCredentials 脱敏检测到的凭据后再保存，启用时同时启用 DetectCredentials
+	RedactCredentials bool `json:"redact_credentials" yaml:"redact_credentials"`
+
+	// TraceInject 为没有 traceparent 的转发请求生成W3C追踪头部，配置了 CorrelationHeader 时同时生成关联ID
+	TraceInject bool `json:"trace_inject" yaml:"trace_inject"`
+
+	// CorrelationHeader 记录在流上的关联ID头部，例如 X-Request-ID，为空时识别 X-Request-ID 和 X-Correlation-ID
+	CorrelationHeader string `json:"correlation_header" yaml:"correlation_header"`
+
+	// DuplicateWindow 方法、URL和请求体都相同的请求在该时间内重复出现时添加 duplicate 标签，0表示不检测
+	DuplicateWindow time.Duration `json:"duplicate_window" yaml:"duplicate_window"`
+
+	// DuplicateIgnoreParams 判断重复请求时忽略的查询参数，例如防缓存的时间戳
+	DuplicateIgnoreParams []string `json:"duplicate_ignore_params" yaml:"duplicate_ignore_params"`
+
+	// OpenAPISpec OpenAPI 3 规范文件（JSON或YAML），不符合规范的流会被标记
+	OpenAPISpec string `json:"openapi_spec" yaml:"openapi_spec"`
+
+	// StoreFile 持久化流数据库文件，流在完成时写入
+	StoreFile string `json:"store_file" yaml:"store_file"`
+
+	// EncryptRecipients 加密流数据库、磁带和导出文件的 age 公钥接收者（age1...）
+	EncryptRecipients []string `json:"encrypt_recipients" yaml:"encrypt_recipients"`
+
+	// EncryptPassphraseFile 保存加密口令的文件，同时用于加密和解密，不能和 EncryptRecipients 一起使用
+	EncryptPassphraseFile string `json:"encrypt_passphrase_file" yaml:"encrypt_passphrase_file"`
+
+	// IdentityFiles 读取加密的流数据库、磁带和HAR文件时使用的 age 身份文件
+	IdentityFiles []string `json:"identity_files" yaml:"identity_files"`
+
+	// MemoryFlows 内存中保留的最大流数量，0 表示不限制
+	MemoryFlows int `json:"memory_flows" yaml:"memory_flows"`
+
+	// MemoryLimit 内存中的流占用的最大字节数（估算值），超出时先丢弃最早的流的内容，再丢弃最早的流，0 表示不限制
+	MemoryLimit int64 `json:"memory_limit" yaml:"memory_limit"`
+
+	// HARFile 退出时将捕获的流导出为HAR 1.2文件
+	HARFile string `json:"har_file" yaml:"har_file"`
+
+	// PcapngFile 退出时将捕获的流导出为pcapng文件（合成的明文TCP连接）
+	PcapngFile string `json:"pcapng_file" yaml:"pcapng_file"`
+
+	// SessionFile 退出时将捕获的流和配置保存为会话文件
+	SessionFile string `json:"session_file" yaml:"session_file"`
+
+	// LoadSessions 启动时将这些会话文件中的流加载到内存，可以在Web界面和API中查看，
+	// 扩展名为 .har、.mitm/.flows、.chlsj 或 .saz 的文件按HAR、mitmproxy、Charles 或 Fiddler 格式导入
+	LoadSessions []string `json:"load_sessions" yaml:"load_sessions"`
+
+	// ArchiveURL 定期将新完成的流轮转为会话文件并上传到的位置，格式为 s3://bucket/prefix，为空时不归档。
+	// 凭证从 AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY 和 AWS_SESSION_TOKEN 环境变量读取
+	ArchiveURL string `json:"archive_url" yaml:"archive_url"`
+
+	// ArchiveEndpoint S3兼容存储的地址，例如 http://minio:9000，为空时使用 AWS S3
+	ArchiveEndpoint string `json:"archive_endpoint" yaml:"archive_endpoint"`
+
+	// ArchiveRegion 存储的区域，为空时使用 AWS_REGION 环境变量或 us-east-1
+	ArchiveRegion string `json:"archive_region" yaml:"archive_region"`
+
+	// ArchiveDir 轮转的会话文件在上传前保存的目录，为空时使用用户缓存目录下的 sniffy/archive
+	ArchiveDir string `json:"archive_dir" yaml:"archive_dir"`
+
+	// ArchiveInterval 轮转和上传的间隔
+	ArchiveInterval time.Duration `json:"archive_interval" yaml:"archive_interval"`
+
+	// ArchiveRetention 存储中的会话文件保留的时间，0表示永久保留
+	ArchiveRetention time.Duration `json:"archive_retention" yaml:"archive_retention"`
+
+	// ArchiveKeepLocal 上传后本地会话文件保留的时间，0表示上传后立即删除
+	ArchiveKeepLocal time.Duration `json:"archive_keep_local" yaml:"archive_keep_local"`
+
+	// HARMockFiles 使用这些HAR文件中的响应回答匹配的请求，未匹配的请求转发到上游
+	HARMockFiles []string `json:"har_mock_files" yaml:"har_mock_files"`
+
+	// HARReplayFile 启动后将该HAR文件中的请求经由代理重放到真实服务器
+	HARReplayFile string `json:"har_replay_file" yaml:"har_replay_file"`
+
+	// Scripts 按顺序加载的用户脚本（.js、.lua）或WebAssembly插件（.wasm），可以修改或直接回复流
+	Scripts []string `json:"scripts" yaml:"scripts"`
+
+	// Addons 进程外插件的gRPC地址，在脚本之后按顺序调用
+	Addons []string `json:"addons" yaml:"addons"`
+
+	// AddonFailOpen 插件不可用时放行流，默认中止流
+	AddonFailOpen bool `json:"addon_fail_open" yaml:"addon_fail_open"`
+
+	// Watch 监视脚本和规则文件，修改后自动重新加载
+	Watch bool `json:"watch" yaml:"watch"`
+
+	// ControlAddress 控制端口监听地址，提供REST API和Web界面，unix:path 监听 unix 套接字，为空时不启用
+	ControlAddress string `json:"control_address" yaml:"control_address"`
+
+	// ControlHosts 除IP地址、localhost 和 ControlAddress 中的主机名外，访问控制端口时允许使用的主机名，
+	// 例如反向代理的域名。其他 Host 的请求被拒绝，防止DNS重绑定
+	ControlHosts []string `json:"control_hosts" yaml:"control_hosts"`
+
+	// StatsWindow 控制端口按主机和路径统计流量的滚动窗口，0表示不统计
+	StatsWindow time.Duration `json:"stats_window" yaml:"stats_window"`
+
+	// PACHosts 控制端口的 /api/v1/proxy.pac 中经过代理的主机，支持 "*.example.com"，为空时所有主机经过代理
+	PACHosts []string `json:"pac_hosts" yaml:"pac_hosts"`
+
+	// Pprof 在控制端口的 /debug/pprof/ 下提供 net/http/pprof 的性能分析接口
+	Pprof bool `json:"pprof" yaml:"pprof"`
+
+	// OTLPEndpoint 导出流追踪的OTLP/HTTP收集端地址，例如 http://localhost:4318，为空时不导出
+	OTLPEndpoint string `json:"otlp_endpoint" yaml:"otlp_endpoint"`
+
+	// OTLPHeaders 导出请求附带的头部，格式为 Name=value
+	OTLPHeaders []string `json:"otlp_headers" yaml:"otlp_headers"`
+
+	// StreamURL 发布完成的流的消息系统地址，例如 kafka://broker:9092/topic 或 nats://host:4222/subject，为空时不发布
+	StreamURL string `json:"stream_url" yaml:"stream_url"`
+
+	// StreamBodies 发布的流记录中包含捕获的消息体
+	StreamBodies bool `json:"stream_bodies" yaml:"stream_bodies"`
+
+	// ProxyUsers 允许使用代理的用户，格式为 user:password，配置后要求 Proxy-Authorization Basic 认证
+	ProxyUsers []string `json:"proxy_users" yaml:"proxy_users"`
+
+	// AllowedClients 允许连接代理的客户端IP或CIDR，为空时允许所有客户端。
+	// 重放经由本机回环地址连接代理，需要包含 127.0.0.1
+	AllowedClients []string `json:"allowed_clients" yaml:"allowed_clients"`
+
+	// RateLimits 按客户端IP或目标主机的限流规则，格式见 ratelimit.ParseRule，
+	// 例如 client=*,rps=10,conns=4 或 host=*.example.com,rps=5
+	RateLimits []string `json:"rate_limits" yaml:"rate_limits"`
+
+	// Chaos 故障注入规则，格式见 chaos.ParseRule，
+	// 例如 api.example.com=delay:100ms-2s 或 POST api.example.com/upload=status:503,20%
+	Chaos []string `json:"chaos" yaml:"chaos"`
+
+	// AccessLog 访问日志文件，每个结束的流一行，"-" 表示标准输出，为空时不记录
+	AccessLog string `json:"access_log" yaml:"access_log"`
+
+	// AccessLogFormat 访问日志格式：common、combined（默认）或 json
+	AccessLogFormat string `json:"access_log_format" yaml:"access_log_format"`
+
+	// Syslog 以 RFC 5424 格式发送访问日志的syslog服务器，例如 udp://host:514、tcp://host:514 或 tls://host:6514，
+	// 消息使用 AccessLogFormat 格式，为空时不发送
+	Syslog string `json:"syslog" yaml:"syslog"`
+
+	// SyslogFacility syslog 设施，默认为 local0
+	SyslogFacility string `json:"syslog_facility" yaml:"syslog_facility"`
+
+	// LogFormat 日志格式：text 或 json
+	LogFormat string `json:"log_format" yaml:"log_format"`
+
+	// LogLevel 默认日志级别：debug、info、warn、error，为空时为 info
+	LogLevel string `json:"log_level" yaml:"log_level"`
+
+	// LogLevels 按子系统（main、proxy、tls、ca、storage）覆盖的日志级别，格式为 subsystem=level
+	LogLevels []string `json:"log_levels" yaml:"log_levels"`
+
+	// LogFile 日志文件路径，为空时写入标准错误
+	LogFile string `json:"log_file" yaml:"log_file"`
+
+	// LogMaxSize 日志文件轮转大小（MB），0表示不轮转
+	LogMaxSize int `json:"log_max_size" yaml:"log_max_size"`
+
+	// LogMaxBackups 轮转时保留的旧日志文件数量
+	LogMaxBackups int `json:"log_max_backups" yaml:"log_max_backups"`
+}
+
+// ClientCertConfig 按主机配置的上游客户端证书，PEM证书/私钥与PKCS#12二选一
+type ClientCertConfig struct {
+	// Host 主机模式，支持 "*.example.com"
+	Host string `json:"host" yaml:"host"`
+
+	// CertFile PEM证书文件
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+
+	// KeyFile PEM私钥文件
+	KeyFile string `json:"key_file" yaml:"key_file"`
+
+	// PKCS12File PKCS#12 (.p12/.pfx) 文件
+	PKCS12File string `json:"pkcs12_file" yaml:"pkcs12_file"`
+
+	// Password PKCS#12文件密码
+	Password string `json:"password" yaml:"password"`
+}
+
+// ParseClientCert 解析命令行格式 host=cert.pem,key.pem 或 host=file.p12[,password]
+func ParseClientCert(s string) (ClientCertConfig, error) {
+	host, files, ok := strings.Cut(s, "=")
+	if !ok || host == "" || files == "" {
+		return ClientCertConfig{}, fmt.Errorf("invalid client certificate %q (expected host=cert.pem,key.pem or host=file.p12[,password])", s)
+	}
+	first, second, _ := strings.Cut(files, ",")
+	ext := strings.ToLower(filepath.Ext(first))
+	if ext == ".p12" || ext == ".pfx" {
+		return ClientCertConfig{Host: host, PKCS12File: first, Password: second}, nil
+	}
+	if second == "" {
+		return ClientCertConfig{}, fmt.Errorf("invalid client certificate %q: missing key file", s)
+	}
+	return ClientCertConfig{Host: host, CertFile: first, KeyFile: second}, nil
+}
+
+// Load 加载客户端证书
+func (c ClientCertConfig) Load() (tls.Certificate, error) {
+	if c.PKCS12File != "" {
+		return dialer.LoadPKCS12(c.PKCS12File, c.Password)
+	}
+	return dialer.LoadX509KeyPair(c.CertFile, c.KeyFile)
+}
+
+// ListenerConfig 命名监听器的配置，规则为空时使用主监听器的规则
+type ListenerConfig struct {
+	// Name 监听器名称，记录在流的 listener 字段中
+	Name string `json:"name" yaml:"name"`
+
+	// Address 监听地址 host:port，或 unix:path 监听 unix 套接字。
+	// 使用systemd套接字激活时可以为空，使用 FileDescriptorName= 与 Name 相同的套接字
+	Address string `json:"address" yaml:"address"`
+
+	// Mode 接受的协议：auto（默认，自动识别）、http、socks5，transparent 接受 iptables 重定向的连接，
+	// 或 ebpf 接受附加到 EBPFCgroup 的eBPF程序重定向的连接（后两者仅 Linux）
+	Mode string `json:"mode" yaml:"mode"`
+
+	// MapLocal 本地文件响应规则，格式与全局配置相同
+	MapLocal []string `json:"map_local" yaml:"map_local"`
+
+	// MapRemote 上游改写规则
+	MapRemote []string `json:"map_remote" yaml:"map_remote"`
+
+	// HeaderRules 头部改写规则
+	HeaderRules []string `json:"header_rules" yaml:"header_rules"`
+
+	// BodyRules 内容改写规则
+	BodyRules []string `json:"body_rules" yaml:"body_rules"`
+
+	// TagRules 标签规则
+	TagRules []string `json:"tag_rules" yaml:"tag_rules"`
+
+	// MockFiles 模拟响应定义文件
+	MockFiles []string `json:"mock_files" yaml:"mock_files"`
+}
+
+// ParseListener 解析命令行格式 name=host:port[,mode] 或 name=unix:path[,mode]
+func ParseListener(s string) (ListenerConfig, error) {
+	name, rest, ok := strings.Cut(s, "=")
+	if !ok || name == "" || rest == "" {
+		return ListenerConfig{}, fmt.Errorf("invalid listener %q (expected name=host:port[,mode])", s)
+	}
+	address, mode, _ := strings.Cut(rest, ",")
+	return ListenerConfig{Name: name, Address: address, Mode: mode}, nil
+}
+
+// hostPort 返回监听地址的主机和端口，unix 套接字返回地址本身和端口0
+func (l ListenerConfig) hostPort() (string, int, error) {
+	if l.Address == "" {
+		return "", 0, fmt.Errorf("listener %q has no address and no socket from systemd", l.Name)
+	}
+	if path, ok := capture.SocketPath(l.Address); ok {
+		if path == "" {
+			return "", 0, fmt.Errorf("invalid address %q for listener %q: missing socket path", l.Address, l.Name)
+		}
+		return l.Address, 0, nil
+	}
+	host, port, err := net.SplitHostPort(l.Address)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid address %q for listener %q: %w", l.Address, l.Name, err)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return "", 0, fmt.Errorf("invalid port %q for listener %q", port, l.Name)
+	}
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	if net.ParseIP(host) == nil {
+		return "", 0, fmt.Errorf("invalid IP address %q for listener %q", host, l.Name)
+	}
+	return host, n, nil
+}
+
+// check 检查监听地址、模式和规则，地址为空时由systemd传入同名的套接字
+func (l ListenerConfig) check() error {
+	if l.Address != "" {
+		if _, _, err := l.hostPort(); err != nil {
+			return err
+		}
+	}
+	if !capture.ValidListenerMode(l.Mode) {
+		return fmt.Errorf("invalid mode %q for listener %q (expected auto, http, socks5, transparent or ebpf)", l.Mode, l.Name)
+	}
+	if _, unix := capture.SocketPath(l.Address); unix && (l.Mode == "transparent" || l.Mode == "ebpf") {
+		return fmt.Errorf("%s listener %q must listen on a TCP address", l.Mode, l.Name)
+	}
+	if l.Mode == "ebpf" && l.Address != "" {
+		// 程序把连接重定向到 127.0.0.1
+		if host, _, _ := l.hostPort(); host != "127.0.0.1" && host != "0.0.0.0" && host != "::" {
+			return fmt.Errorf("ebpf listener %q must listen on 127.0.0.1", l.Name)
+		}
+	}
+	_, err := l.NewRules()
+	return err
+}
+
+// listenerConfig 命名监听器的TCP配置，除地址外与主监听器相同
+type listenerConfig struct {
+	*Config
+	host string
+	port int
+}
+
+func (c listenerConfig) GetAddress() string {
+	return c.host
+}
+
+func (c listenerConfig) GetPort() int {
+	return c.port
+}
+
+// NewListenerConfig 返回命名监听器 l 的TCP配置
+func (c *Config) NewListenerConfig(l ListenerConfig) (capture.Config, error) {
+	host, port, err := l.hostPort()
+	if err != nil {
+		return nil, err
+	}
+	return listenerConfig{Config: c, host: host, port: port}, nil
+}
+
+// NewRules 创建监听器自己的规则引擎，没有规则时返回nil，表示使用主监听器的规则
+func (l ListenerConfig) NewRules() (*rules.Engine, error) {
+	c := &Config{
+		MapLocal:    l.MapLocal,
+		MapRemote:   l.MapRemote,
+		HeaderRules: l.HeaderRules,
+		BodyRules:   l.BodyRules,
+		TagRules:    l.TagRules,
+		MockFiles:   l.MockFiles,
+	}
+	e, err := c.NewRules()
+	if err != nil {
+		return nil, fmt.Errorf("listener %q: %w", l.Name, err)
+	}
+	return e, nil
+}
+
+// clone 返回监听器配置的深拷贝
+func (l ListenerConfig) clone() ListenerConfig {
+	l.MapLocal = append([]string(nil), l.MapLocal...)
+	l.MapRemote = append([]string(nil), l.MapRemote...)
+	l.HeaderRules = append([]string(nil), l.HeaderRules...)
+	l.BodyRules = append([]string(nil), l.BodyRules...)
+	l.TagRules = append([]string(nil), l.TagRules...)
+	l.MockFiles = append([]string(nil), l.MockFiles...)
+	return l
 }
 
 // DefaultConfig 返回默认配置
 func DefaultConfig() *Config {
 	return &Config{
-		Address:        "0.0.0.0",
-		Port:           8080,
-		ReadTimeout:    30 * time.Second,
-		WriteTimeout:   30 * time.Second,
-		MaxConnections: 0, // 无限制
-		BufferSize:     4096,
-		EnableLogging:  true,
-		Threads:        5, // 默认5个线程
+		Address:         "0.0.0.0",
+		Port:            8080,
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		ShutdownTimeout: 30 * time.Second,
+		StatsWindow:     stats.DefaultWindow,
+		ArchiveInterval: archive.DefaultInterval,
+		PoolMaxIdle:     pool.DefaultMaxIdle,
+		PoolIdleTimeout: pool.DefaultIdleTimeout,
+		BodyLimit:       flow.DefaultBodyLimit,
+		MemoryLimit:     flow.DefaultMemoryLimit,
+		SampleRate:      1,
+		MaxConnections:  0, // 无限制
+		BufferSize:      4096,
+		LogMaxBackups:   5,
+		EnableLogging:   true,
+		Threads:         5, // 默认5个线程
+		MITM:            true,
 	}
 }
 
@@ -82,6 +682,14 @@ func (c *Config) GetThreads() int {
 	return c.Threads
 }
 
+func (c *Config) IsProxyProtocolEnabled() bool {
+	return c.AcceptProxyProtocol
+}
+
+func (c *Config) IsProcessLookupEnabled() bool {
+	return c.ProcessLookup
+}
+
 // Validate 验证配置
 func (c *Config) Validate() error {
 	// 验证地址
@@ -99,6 +707,28 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid port number: %d (must be between 1-65535)", c.Port)
 	}
 
+	// 验证命名监听器
+	names := make(map[string]bool)
+	redirected := ""
+	for _, l := range c.Listeners {
+		if l.Mode == "ebpf" {
+			if redirected != "" {
+				return fmt.Errorf("listeners %q and %q both use ebpf mode, only one is supported", redirected, l.Name)
+			}
+			redirected = l.Name
+		}
+		if l.Name == "" {
+			return fmt.Errorf("listener %q has no name", l.Address)
+		}
+		if names[l.Name] {
+			return fmt.Errorf("duplicate listener name %q", l.Name)
+		}
+		names[l.Name] = true
+		if err := l.check(); err != nil {
+			return err
+		}
+	}
+
 	// 验证超时时间
 	if c.ReadTimeout <= 0 {
 		c.ReadTimeout = 30 * time.Second
@@ -108,6 +738,10 @@ func (c *Config) Validate() error {
 		c.WriteTimeout = 30 * time.Second
 	}
 
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = 30 * time.Second
+	}
+
 	// 验证缓冲区大小
 	if c.BufferSize <= 0 {
 		c.BufferSize = 4096
@@ -117,24 +751,1155 @@ func (c *Config) Validate() error {
 	if c.MaxConnections < 0 {
 		c.MaxConnections = 0
 	}
+	if c.MaxOriginRequests < 0 {
+		return fmt.Errorf("invalid max origin requests: %d", c.MaxOriginRequests)
+	}
+
+	// 验证内存流数量
+	if c.MemoryFlows < 0 {
+		c.MemoryFlows = 0
+	}
+	if c.MemoryLimit < 0 {
+		return fmt.Errorf("invalid memory limit: %d", c.MemoryLimit)
+	}
+
+	// 验证PROXY protocol
+	if _, err := c.NewTrustedProxies(); err != nil {
+		return err
+	}
+	if c.AcceptProxyProtocol && len(c.TrustedProxies) == 0 {
+		return errors.New("accept_proxy_protocol requires trusted_proxies, the addresses of the proxies allowed to send PROXY protocol headers")
+	}
+	if c.UpstreamProxyProtocol < 0 || c.UpstreamProxyProtocol > 2 {
+		return fmt.Errorf("invalid upstream PROXY protocol version: %d (must be 0, 1 or 2)", c.UpstreamProxyProtocol)
+	}
+
+	// 验证上游代理
+	if _, err := c.NewUpstreamProxy(); err != nil {
+		return err
+	}
+
+	// 验证网络条件模拟规则
+	if _, err := c.NewShaper(); err != nil {
+		return err
+	}
+
+	// 验证超时
+	if _, err := c.NewTimeouts(); err != nil {
+		return err
+	}
+
+	// 验证上游连接池
+	if c.PoolMaxIdle < 0 {
+		return fmt.Errorf("invalid pool max idle connections: %d", c.PoolMaxIdle)
+	}
+	if c.PoolIdleTimeout <= 0 {
+		c.PoolIdleTimeout = pool.DefaultIdleTimeout
+	}
+	if c.UpstreamHTTP2 && c.PoolMaxIdle == 0 {
+		return errors.New("upstream h2 requires connection pooling (pool max idle > 0)")
+	}
+
+	// 验证内容捕获
+	if c.BodyLimit < 0 {
+		return fmt.Errorf("invalid body limit: %d", c.BodyLimit)
+	}
+	if c.BodySpillDir != "" && c.BodyLimit == 0 {
+		return errors.New("body spill dir requires a body limit")
+	}
+
+	// 验证公钥固定
+	for _, pin := range c.Pins {
+		if _, _, err := dialer.ParsePin(pin); err != nil {
+			return err
+		}
+	}
+
+	// 验证断点规则
+	for _, b := range c.Breakpoints {
+		if _, _, err := breakpoint.ParseRule(b); err != nil {
+			return err
+		}
+	}
+
+	// 验证捕获过滤器
+	if _, err := c.NewCaptureFilter(); err != nil {
+		return err
+	}
+
+	// 验证采样规则
+	if !(c.SampleRate >= 0 && c.SampleRate <= 1) {
+		return fmt.Errorf("invalid sample rate: %v", c.SampleRate)
+	}
+	if _, err := c.NewSampler(); err != nil {
+		return err
+	}
+
+	// 验证脱敏规则
+	if _, err := c.NewRedactor(); err != nil {
+		return err
+	}
+
+	// 验证API规范
+	if _, err := c.NewValidator(); err != nil {
+		return err
+	}
+
+	// 验证加密密钥
+	if _, err := c.NewKeys(); err != nil {
+		return err
+	}
+
+	// 验证改写规则
+	if _, err := c.NewRules(); err != nil {
+		return err
+	}
+
+	// 验证主机映射
+	for _, m := range c.HostMappings {
+		if _, _, err := dialer.ParseHostMapping(m); err != nil {
+			return err
+		}
+	}
+
+	// 验证控制端口地址
+	if path, ok := capture.SocketPath(c.ControlAddress); ok {
+		if path == "" {
+			return fmt.Errorf("invalid control address %q: missing socket path", c.ControlAddress)
+		}
+	} else if c.ControlAddress != "" {
+		if _, _, err := net.SplitHostPort(c.ControlAddress); err != nil {
+			return fmt.Errorf("invalid control address %q: %w", c.ControlAddress, err)
+		}
+	}
+	if c.Pprof && c.ControlAddress == "" {
+		return errors.New("pprof requires a control address")
+	}
+	if len(c.PACHosts) > 0 {
+		if c.ControlAddress == "" {
+			return errors.New("PAC hosts require a control address")
+		}
+		if _, err := c.NewPAC(); err != nil {
+			return err
+		}
+	}
+	if c.StatsWindow < 0 {
+		return fmt.Errorf("invalid stats window %v", c.StatsWindow)
+	}
+	if c.DuplicateWindow < 0 {
+		return fmt.Errorf("invalid duplicate window %v", c.DuplicateWindow)
+	}
+	if c.CorrelationHeader != "" && !httpguts.ValidHeaderFieldName(c.CorrelationHeader) {
+		return fmt.Errorf("invalid correlation header %q", c.CorrelationHeader)
+	}
+
+	// 验证归档配置
+	if c.ArchiveURL != "" {
+		if u, err := url.Parse(c.ArchiveURL); err != nil || u.Scheme != "s3" || u.Host == "" {
+			return fmt.Errorf("invalid archive URL %q (expected s3://bucket/prefix)", c.ArchiveURL)
+		}
+		if c.ArchiveInterval <= 0 {
+			return fmt.Errorf("invalid archive interval %v", c.ArchiveInterval)
+		}
+	}
+	if c.ArchiveRetention < 0 || c.ArchiveKeepLocal < 0 {
+		return errors.New("archive retention must not be negative")
+	}
+
+	// 验证代理访问控制
+	if _, err := c.NewAuth(); err != nil {
+		return err
+	}
+
+	// 验证限流规则
+	if _, err := c.NewRateLimiter(); err != nil {
+		return err
+	}
+
+	// 验证故障注入规则
+	if _, err := c.NewChaos(); err != nil {
+		return err
+	}
+
+	// 验证访问日志格式
+	if _, err := accesslog.New(io.Discard, c.AccessLogFormat); err != nil {
+		return err
+	}
+
+	// 验证日志配置
+	if _, err := c.logOptions(); err != nil {
+		return err
+	}
+	if c.LogMaxSize < 0 {
+		c.LogMaxSize = 0
+	}
+
+	// 验证追踪导出配置
+	if _, err := c.otlpHeaders(); err != nil {
+		return err
+	}
+	if c.StreamURL != "" {
+		if err := sink.CheckURL(c.StreamURL); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
 // GetListenAddress 获取完整的监听地址
 func (c *Config) GetListenAddress() string {
-	return fmt.Sprintf("%s:%d", c.Address, c.Port)
+	return net.JoinHostPort(c.Address, strconv.Itoa(c.Port))
 }
 
 // Clone 克隆配置
 func (c *Config) Clone() *Config {
 	return &Config{
-		Address:        c.Address,
-		Port:           c.Port,
-		ReadTimeout:    c.ReadTimeout,
-		WriteTimeout:   c.WriteTimeout,
-		MaxConnections: c.MaxConnections,
-		BufferSize:     c.BufferSize,
-		EnableLogging:  c.EnableLogging,
+		Address:         c.Address,
+		Port:            c.Port,
+		Listeners:       cloneListeners(c.Listeners),
+		ReadTimeout:     c.ReadTimeout,
+		WriteTimeout:    c.WriteTimeout,
+		ShutdownTimeout: c.ShutdownTimeout,
+		MaxConnections:  c.MaxConnections,
+
+		MaxOriginRequests: c.MaxOriginRequests,
+		BufferSize:        c.BufferSize,
+		EnableLogging:     c.EnableLogging,
+		Threads:           c.Threads,
+		HostMappings:      append([]string(nil), c.HostMappings...),
+		DNSServer:         c.DNSServer,
+
+		AcceptProxyProtocol:   c.AcceptProxyProtocol,
+		TrustedProxies:        append([]string(nil), c.TrustedProxies...),
+		UpstreamProxyProtocol: c.UpstreamProxyProtocol,
+		Throttle:              append([]string(nil), c.Throttle...),
+		Timeouts:              c.Timeouts,
+		HostTimeouts:          append([]string(nil), c.HostTimeouts...),
+		PoolMaxIdle:           c.PoolMaxIdle,
+		PoolIdleTimeout:       c.PoolIdleTimeout,
+		UpstreamHTTP2:         c.UpstreamHTTP2,
+		BodyLimit:             c.BodyLimit,
+		BodySpillDir:          c.BodySpillDir,
+		UpstreamProxy:         c.UpstreamProxy,
+		IgnoreProxyEnv:        c.IgnoreProxyEnv,
+		UpstreamProxyAuth:     c.UpstreamProxyAuth,
+		ProcessLookup:         c.ProcessLookup,
+		Docker:                c.Docker,
+		DockerHost:            c.DockerHost,
+		PodName:               c.PodName,
+		PodNamespace:          c.PodNamespace,
+		NodeName:              c.NodeName,
+		PodLabelsFile:         c.PodLabelsFile,
+		EBPFCgroup:            c.EBPFCgroup,
+		EBPFPorts:             c.EBPFPorts,
+
+		MITM:             c.MITM,
+		CADir:            c.CADir,
+		PassthroughHosts: append([]string(nil), c.PassthroughHosts...),
+		PassthroughALPN:  append([]string(nil), c.PassthroughALPN...),
+
+		PassthroughFingerprints: append([]string(nil), c.PassthroughFingerprints...),
+		PinningPassthrough:      c.PinningPassthrough,
+		UpstreamTLSProfile:      c.UpstreamTLSProfile,
+		KeyLogFile:              c.KeyLogFile,
+		UpstreamCAFiles:         append([]string(nil), c.UpstreamCAFiles...),
+		InsecureHosts:           append([]string(nil), c.InsecureHosts...),
+		Pins:                    append([]string(nil), c.Pins...),
+		ClientCerts:             append([]ClientCertConfig(nil), c.ClientCerts...),
+		Breakpoints:             append([]string(nil), c.Breakpoints...),
+		BreakpointTimeout:       c.BreakpointTimeout,
+		MapLocal:                append([]string(nil), c.MapLocal...),
+		MapRemote:               append([]string(nil), c.MapRemote...),
+		HeaderRules:             append([]string(nil), c.HeaderRules...),
+		BodyRules:               append([]string(nil), c.BodyRules...),
+		TagRules:                append([]string(nil), c.TagRules...),
+		MockFiles:               append([]string(nil), c.MockFiles...),
+		RecordCassette:          c.RecordCassette,
+		ReplayCassette:          c.ReplayCassette,
+		ReplayPassthrough:       c.ReplayPassthrough,
+		CaptureFilter:           c.CaptureFilter,
+		SampleRate:              c.SampleRate,
+		SampleRules:             append([]string(nil), c.SampleRules...),
+		Redact:                  append([]string(nil), c.Redact...),
+		RedactDefaults:          c.RedactDefaults,
+		DetectCredentials:       c.DetectCredentials,
+		RedactCredentials:       c.RedactCredentials,
+		TraceInject:             c.TraceInject,
+		CorrelationHeader:       c.CorrelationHeader,
+		DuplicateWindow:         c.DuplicateWindow,
+		DuplicateIgnoreParams:   append([]string(nil), c.DuplicateIgnoreParams...),
+		OpenAPISpec:             c.OpenAPISpec,
+		StoreFile:               c.StoreFile,
+		EncryptRecipients:       append([]string(nil), c.EncryptRecipients...),
+		EncryptPassphraseFile:   c.EncryptPassphraseFile,
+		IdentityFiles:           append([]string(nil), c.IdentityFiles...),
+		MemoryFlows:             c.MemoryFlows,
+		MemoryLimit:             c.MemoryLimit,
+		HARFile:                 c.HARFile,
+		PcapngFile:              c.PcapngFile,
+		SessionFile:             c.SessionFile,
+		LoadSessions:            append([]string(nil), c.LoadSessions...),
+		ArchiveURL:              c.ArchiveURL,
+		ArchiveEndpoint:         c.ArchiveEndpoint,
+		ArchiveRegion:           c.ArchiveRegion,
+		ArchiveDir:              c.ArchiveDir,
+		ArchiveInterval:         c.ArchiveInterval,
+		ArchiveRetention:        c.ArchiveRetention,
+		ArchiveKeepLocal:        c.ArchiveKeepLocal,
+		HARMockFiles:            append([]string(nil), c.HARMockFiles...),
+		HARReplayFile:           c.HARReplayFile,
+		Scripts:                 append([]string(nil), c.Scripts...),
+		Addons:                  append([]string(nil), c.Addons...),
+		AddonFailOpen:           c.AddonFailOpen,
+		Watch:                   c.Watch,
+		ControlAddress:          c.ControlAddress,
+		ControlHosts:            append([]string(nil), c.ControlHosts...),
+		StatsWindow:             c.StatsWindow,
+		PACHosts:                append([]string(nil), c.PACHosts...),
+		Pprof:                   c.Pprof,
+		OTLPEndpoint:            c.OTLPEndpoint,
+		OTLPHeaders:             append([]string(nil), c.OTLPHeaders...),
+		StreamURL:               c.StreamURL,
+		StreamBodies:            c.StreamBodies,
+		ProxyUsers:              append([]string(nil), c.ProxyUsers...),
+		AllowedClients:          append([]string(nil), c.AllowedClients...),
+		RateLimits:              append([]string(nil), c.RateLimits...),
+		Chaos:                   append([]string(nil), c.Chaos...),
+		AccessLog:               c.AccessLog,
+		AccessLogFormat:         c.AccessLogFormat,
+		Syslog:                  c.Syslog,
+		SyslogFacility:          c.SyslogFacility,
+		LogFormat:               c.LogFormat,
+		LogLevel:                c.LogLevel,
+		LogLevels:               append([]string(nil), c.LogLevels...),
+		LogFile:                 c.LogFile,
+		LogMaxSize:              c.LogMaxSize,
+		LogMaxBackups:           c.LogMaxBackups,
+	}
+}
+
+// NewDialer 根据配置创建上游拨号器
+func (c *Config) NewDialer() (*dialer.Dialer, error) {
+	d := dialer.New()
+	for _, m := range c.HostMappings {
+		host, target, _ := dialer.ParseHostMapping(m)
+		d.MapHost(host, target)
+	}
+	if c.DNSServer != "" {
+		d.SetResolver(dialer.NewDNSResolver(c.DNSServer))
+	}
+	d.SetProxyProtocol(c.UpstreamProxyProtocol)
+	upstream, err := c.NewUpstreamProxy()
+	if err != nil {
+		return nil, err
+	}
+	d.SetUpstreamProxy(upstream)
+	if upstream == nil && !c.IgnoreProxyEnv {
+		env, err := c.NewEnvironmentProxy(httpproxy.FromEnvironment())
+		if err != nil {
+			return nil, err
+		}
+		d.SetEnvironmentProxy(env)
+	}
+	shaper, err := c.NewShaper()
+	if err != nil {
+		return nil, err
+	}
+	d.SetShaper(shaper)
+	limits, err := c.NewTimeouts()
+	if err != nil {
+		return nil, err
+	}
+	d.SetTimeouts(limits)
+	if err := d.SetClientHelloProfile(c.UpstreamTLSProfile); err != nil {
+		return nil, err
+	}
+
+	policy := dialer.NewVerifyPolicy()
+	for _, path := range c.UpstreamCAFiles {
+		if err := policy.AddRootsFile(path); err != nil {
+			return nil, err
+		}
+	}
+	policy.SkipVerify(c.InsecureHosts...)
+	for _, p := range c.Pins {
+		host, pin, _ := dialer.ParsePin(p)
+		policy.Pin(host, pin)
+	}
+	d.SetVerifyPolicy(policy)
+
+	for _, cc := range c.ClientCerts {
+		cert, err := cc.Load()
+		if err != nil {
+			return nil, err
+		}
+		if err := d.AddClientCertificate(cc.Host, cert); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// NewShaper 根据配置创建网络条件模拟，未配置规则时返回nil
+func (c *Config) NewShaper() (*throttle.Shaper, error) {
+	if len(c.Throttle) == 0 {
+		return nil, nil
+	}
+	s := throttle.New()
+	for _, r := range c.Throttle {
+		rule, err := throttle.ParseRule(r)
+		if err != nil {
+			return nil, err
+		}
+		s.Add(rule)
+	}
+	return s, nil
+}
+
+// NewTimeouts 根据配置创建各阶段的超时，未配置时返回nil
+func (c *Config) NewTimeouts() (*timeouts.Policy, error) {
+	if c.Timeouts == "" && len(c.HostTimeouts) == 0 {
+		return nil, nil
+	}
+	global, err := timeouts.Parse(c.Timeouts)
+	if err != nil {
+		return nil, err
+	}
+	p := timeouts.New(global)
+	for _, s := range c.HostTimeouts {
+		rule, err := timeouts.ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		p.Add(rule)
+	}
+	return p, nil
+}
+
+// NewPool 根据配置创建上游连接池，d 用于h2连接合并时解析主机名，未启用时返回nil
+func (c *Config) NewPool(d *dialer.Dialer) *pool.Pool {
+	if c.PoolMaxIdle <= 0 {
+		return nil
+	}
+	p := pool.New(c.PoolMaxIdle, c.PoolIdleTimeout)
+	if c.UpstreamHTTP2 {
+		p.EnableHTTP2(d.LookupHost)
+	}
+	return p
+}
+
+// NewBodyPolicy 根据配置创建内容捕获策略，在 BodySpillDir 中创建本次运行使用的临时目录，
+// 退出时由调用方删除。不限制时返回nil
+func (c *Config) NewBodyPolicy() (*flow.BodyPolicy, error) {
+	if c.BodyLimit <= 0 {
+		return nil, nil
+	}
+	p := &flow.BodyPolicy{Limit: c.BodyLimit}
+	if c.BodySpillDir != "" {
+		if err := os.MkdirAll(c.BodySpillDir, 0o700); err != nil {
+			return nil, fmt.Errorf("create body spill dir: %w", err)
+		}
+		dir, err := os.MkdirTemp(c.BodySpillDir, "sniffy-bodies-")
+		if err != nil {
+			return nil, fmt.Errorf("create body spill dir: %w", err)
+		}
+		p.SpillDir = dir
+	}
+	return p, nil
+}
+
+// NewUpstreamProxy 根据配置创建上游代理，未配置时返回nil
+func (c *Config) NewUpstreamProxy() (*dialer.UpstreamProxy, error) {
+	if c.UpstreamProxy == "" {
+		if c.UpstreamProxyAuth != "" {
+			return nil, errors.New("upstream proxy auth requires an upstream proxy")
+		}
+		return nil, nil
+	}
+	p, err := dialer.ParseUpstreamProxy(c.UpstreamProxy)
+	if err != nil {
+		return nil, err
+	}
+	if c.UpstreamProxyAuth != "" {
+		if p.Auth, err = dialer.ParseProxyAuth(c.UpstreamProxyAuth); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// NewEnvironmentProxy 按代理环境变量创建上游代理。
+// 无效的值和指向本代理监听端口的值被忽略，避免环境变量为客户端设置时请求在代理内循环
+func (c *Config) NewEnvironmentProxy(env *httpproxy.Config) (*dialer.EnvironmentProxy, error) {
+	env = &httpproxy.Config{HTTPProxy: env.HTTPProxy, HTTPSProxy: env.HTTPSProxy, NoProxy: env.NoProxy, CGI: env.CGI}
+	for _, v := range []*string{&env.HTTPProxy, &env.HTTPSProxy} {
+		if *v == "" {
+			continue
+		}
+		p, err := dialer.ParseUpstreamProxy(*v)
+		if err != nil {
+			log.Printf("Ignoring proxy environment variable: %v", err)
+			*v = ""
+			continue
+		}
+		if c.isListener(p.URL.Hostname(), p.URL.Port()) {
+			log.Printf("Ignoring proxy environment variable %s, it points at this proxy", p.URL)
+			*v = ""
+		}
+	}
+	return dialer.NewEnvironmentProxy(env)
+}
+
+// isListener 判断 host:port 是否为本代理的监听地址
+func (c *Config) isListener(host, port string) bool {
+	if port != strconv.Itoa(c.Port) {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	listen := net.ParseIP(c.Address)
+	return ip != nil && (ip.IsLoopback() || ip.Equal(listen) || listen == nil || listen.IsUnspecified())
+}
+
+// AllowedControlHosts 返回访问控制端口时允许使用的主机名，包括 ControlAddress 中的主机名
+func (c *Config) AllowedControlHosts() []string {
+	hosts := append([]string(nil), c.ControlHosts...)
+	if _, ok := capture.SocketPath(c.ControlAddress); ok {
+		return hosts
+	}
+	if host, _, err := net.SplitHostPort(c.ControlAddress); err == nil && host != "" {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// NewPAC 创建经由代理监听地址访问 PACHosts 的PAC文件
+func (c *Config) NewPAC() (*pac.File, error) {
+	return pac.New(net.JoinHostPort(c.Address, strconv.Itoa(c.Port)), c.PACHosts)
+}
+
+// NewCA 根据配置加载或创建MITM使用的CA，未启用MITM时返回nil
+func (c *Config) NewCA() (ca.CA, error) {
+	if !c.MITM {
+		return nil, nil
+	}
+	if c.CADir == "" {
+		return ca.NewSelfSignedCA()
+	}
+	return ca.NewSelfSignedCA(c.CADir)
+}
+
+// NewTLSPolicy 根据配置创建MITM决策策略
+func (c *Config) NewTLSPolicy() tlsinfo.Policy {
+	var policies []tlsinfo.Policy
+	if len(c.PassthroughHosts) > 0 {
+		policies = append(policies, tlsinfo.PassthroughServerNames(c.PassthroughHosts...))
+	}
+	if len(c.PassthroughALPN) > 0 {
+		policies = append(policies, tlsinfo.PassthroughALPN(c.PassthroughALPN...))
+	}
+	if len(c.PassthroughFingerprints) > 0 {
+		policies = append(policies, tlsinfo.PassthroughFingerprints(c.PassthroughFingerprints...))
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+	return tlsinfo.Chain(policies...)
+}
+
+// NewBreakpoints 根据配置创建断点管理器，没有断点规则时返回nil
+func (c *Config) NewBreakpoints() *breakpoint.Manager {
+	if len(c.Breakpoints) == 0 {
+		return nil
+	}
+	m := breakpoint.NewManager()
+	m.SetTimeout(c.BreakpointTimeout)
+	for _, b := range c.Breakpoints {
+		phase, match, _ := breakpoint.ParseRule(b)
+		m.AddRule(phase, match)
+	}
+	return m
+}
+
+// cloneListeners 返回监听器配置的深拷贝
+func cloneListeners(listeners []ListenerConfig) []ListenerConfig {
+	if listeners == nil {
+		return nil
+	}
+	out := make([]ListenerConfig, len(listeners))
+	for i, l := range listeners {
+		out[i] = l.clone()
+	}
+	return out
+}
+
+// NewRules 根据配置创建改写规则引擎，没有规则时返回nil
+func (c *Config) NewRules() (*rules.Engine, error) {
+	if len(c.MapLocal) == 0 && len(c.MapRemote) == 0 && len(c.HeaderRules) == 0 && len(c.BodyRules) == 0 &&
+		len(c.TagRules) == 0 && len(c.MockFiles) == 0 && len(c.HARMockFiles) == 0 && c.ReplayCassette == "" {
+		return nil, nil
+	}
+	e := rules.NewEngine()
+	for _, path := range c.MockFiles {
+		mocks, err := rules.LoadMocks(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range mocks {
+			e.AddResponder(m)
+		}
+	}
+	keys, err := c.NewKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range c.HARMockFiles {
+		flows, err := loadFlows(keys, path, har.Read)
+		if err != nil {
+			return nil, err
+		}
+		e.AddResponder(cassette.NewPlayer(path, flows, false))
+	}
+	for _, m := range c.MapLocal {
+		r, err := rules.ParseMapLocal(m)
+		if err != nil {
+			return nil, err
+		}
+		e.AddResponder(r)
+	}
+	for _, m := range c.MapRemote {
+		r, err := rules.ParseMapRemote(m)
+		if err != nil {
+			return nil, err
+		}
+		e.AddRequestRewriter(r)
+	}
+	for _, h := range c.HeaderRules {
+		r, err := rules.ParseHeaderRule(h)
+		if err != nil {
+			return nil, err
+		}
+		if r.Phase == breakpoint.PhaseRequest {
+			e.AddRequestRewriter(r)
+		} else {
+			e.AddResponseRewriter(r)
+		}
+	}
+	for _, b := range c.BodyRules {
+		r, err := rules.ParseBodyRule(b)
+		if err != nil {
+			return nil, err
+		}
+		if r.Phase == breakpoint.PhaseRequest {
+			e.AddRequestRewriter(r)
+		} else {
+			e.AddResponseRewriter(r)
+		}
+	}
+	for _, t := range c.TagRules {
+		r, err := rules.ParseTagRule(t)
+		if err != nil {
+			return nil, err
+		}
+		e.AddTagRule(r)
+	}
+	// 磁带回放放在最后，本地和模拟规则优先
+	if c.ReplayCassette != "" {
+		flows, err := loadFlows(keys, c.ReplayCassette, cassette.Read)
+		if err != nil {
+			return nil, err
+		}
+		e.AddResponder(cassette.NewPlayer(c.ReplayCassette, flows, !c.ReplayPassthrough))
+	}
+	return e, nil
+}
+
+// NewCaptureFilter 编译捕获过滤表达式，未配置时返回nil
+func (c *Config) NewCaptureFilter() (*filter.Filter, error) {
+	if c.CaptureFilter == "" {
+		return nil, nil
+	}
+	return filter.Compile(c.CaptureFilter)
+}
+
+// NewSampler 创建流采样器，采样率为1且未配置规则时返回nil
+func (c *Config) NewSampler() (*sample.Sampler, error) {
+	if c.SampleRate >= 1 && len(c.SampleRules) == 0 {
+		return nil, nil
+	}
+	s := sample.New(c.SampleRate)
+	for _, rule := range c.SampleRules {
+		r, err := sample.ParseRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		s.Add(r)
+	}
+	return s, nil
+}
+
+// NewRedactor 创建脱敏器，默认规则在配置的规则之前，都未配置时返回nil
+func (c *Config) NewRedactor() (*redact.Redactor, error) {
+	specs := c.Redact
+	if c.RedactDefaults {
+		specs = append(append([]string(nil), redact.DefaultRules...), specs...)
+	}
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	rules := make([]*redact.Rule, 0, len(specs))
+	for _, s := range specs {
+		r, err := redact.ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
 	}
+	return redact.New(rules...), nil
+}
+
+// NewDetector 创建凭据检测器，未启用检测时返回nil
+func (c *Config) NewDetector() *secrets.Detector {
+	if !c.DetectCredentials && !c.RedactCredentials {
+		return nil
+	}
+	return secrets.New(c.RedactCredentials)
+}
+
+// NewTracing 创建追踪头部的注入器，未启用注入也未指定关联ID头部时返回nil
+func (c *Config) NewTracing() *tracecontext.Injector {
+	if !c.TraceInject && c.CorrelationHeader == "" {
+		return nil
+	}
+	return tracecontext.New(tracecontext.Options{Inject: c.TraceInject, CorrelationHeader: c.CorrelationHeader})
+}
+
+// NewDuplicates 创建重复请求的标记器，未启用检测时返回nil
+func (c *Config) NewDuplicates() *duplicates.Tracker {
+	if c.DuplicateWindow <= 0 {
+		return nil
+	}
+	return duplicates.NewTracker(duplicates.Options{Window: c.DuplicateWindow, IgnoreParams: c.DuplicateIgnoreParams})
+}
+
+// NewValidator 加载 OpenAPI 规范并创建校验器，未配置规范时返回nil
+func (c *Config) NewValidator() (*openapi.Validator, error) {
+	if c.OpenAPISpec == "" {
+		return nil, nil
+	}
+	return openapi.LoadValidator(c.OpenAPISpec)
+}
+
+// NewContainers 创建按客户端地址查找Docker容器的查找器，未启用时返回nil
+func (c *Config) NewContainers() (*docker.Resolver, error) {
+	if !c.Docker {
+		return nil, nil
+	}
+	client, err := docker.NewClient(c.DockerHost)
+	if err != nil {
+		return nil, err
+	}
+	return docker.NewResolver(client), nil
+}
+
+// NewPod 返回作为边车运行时所在 Pod 的信息，没有配置 Pod 名称时返回nil
+func (c *Config) NewPod() (*kube.Pod, error) {
+	if c.PodName == "" {
+		return nil, nil
+	}
+	pod := &kube.Pod{Name: c.PodName, Namespace: c.PodNamespace, Node: c.NodeName}
+	if c.PodLabelsFile != "" {
+		labels, err := kube.LoadLabels(c.PodLabelsFile)
+		if err != nil {
+			return nil, err
+		}
+		pod.Labels = labels
+	}
+	return pod, nil
+}
+
+// NewRedirector 加载eBPF程序并附加到 EBPFCgroup，把连接重定向到 ebpf 模式的监听器，没有这样的监听器时返回nil
+func (c *Config) NewRedirector() (*ebpf.Redirector, error) {
+	for _, l := range c.Listeners {
+		if l.Mode != "ebpf" {
+			continue
+		}
+		_, port, err := l.hostPort()
+		if err != nil {
+			return nil, err
+		}
+		ports, err := ebpf.ParsePorts(c.EBPFPorts)
+		if err != nil {
+			return nil, err
+		}
+		return ebpf.Attach(ebpf.Options{Cgroup: c.EBPFCgroup, Port: port, Ports: ports})
+	}
+	return nil, nil
+}
+
+// NewKeys 加载加密接收者、口令和身份，都未配置时返回nil
+func (c *Config) NewKeys() (*seal.Keys, error) {
+	if len(c.EncryptRecipients) == 0 && c.EncryptPassphraseFile == "" && len(c.IdentityFiles) == 0 {
+		return nil, nil
+	}
+	if len(c.EncryptRecipients) > 0 && c.EncryptPassphraseFile != "" {
+		return nil, errors.New("encrypt passphrase cannot be combined with recipients")
+	}
+	keys := &seal.Keys{}
+	for _, s := range c.EncryptRecipients {
+		r, err := seal.ParseX25519Recipient(s)
+		if err != nil {
+			return nil, err
+		}
+		keys.Recipients = append(keys.Recipients, r)
+	}
+	if c.EncryptPassphraseFile != "" {
+		data, err := os.ReadFile(c.EncryptPassphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("read passphrase file: %w", err)
+		}
+		p, err := seal.NewPassphrase(strings.TrimRight(string(data), "\r\n"))
+		if err != nil {
+			return nil, fmt.Errorf("passphrase file %s: %w", c.EncryptPassphraseFile, err)
+		}
+		keys.Recipients = append(keys.Recipients, p)
+		keys.Identities = append(keys.Identities, p)
+	}
+	for _, path := range c.IdentityFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read identity file: %w", err)
+		}
+		ids, err := seal.ParseIdentities(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys.Identities = append(keys.Identities, ids...)
+	}
+	return keys, nil
+}
+
+// loadFlows 读取可能加密的流文件
+func loadFlows(keys *seal.Keys, path string, read func(io.Reader) ([]*flow.Flow, error)) ([]*flow.Flow, error) {
+	file, err := keys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return read(file)
+}
+
+// writeFlows 写入流文件，配置了接收者时加密
+func writeFlows(keys *seal.Keys, path string, flows []*flow.Flow, write func(io.Writer, []*flow.Flow) error) error {
+	file, err := keys.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file, flows); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// saveSession 将流和配置保存为会话文件，配置了接收者时加密
+func saveSession(keys *seal.Keys, path string, config json.RawMessage, flows []*flow.Flow) error {
+	return writeFlows(keys, path, flows, func(w io.Writer, flows []*flow.Flow) error {
+		return session.Save(w, &session.Session{Header: session.Header{Config: config}, Flows: flows})
+	})
+}
+
+// NewArchiver 创建会话归档器，轮转的会话文件按 keys 加密，未配置归档位置时返回nil
+func (c *Config) NewArchiver(keys *seal.Keys) (*archive.Archiver, error) {
+	if c.ArchiveURL == "" {
+		return nil, nil
+	}
+	creds := archive.EnvCredentials()
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, errors.New("archive requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	region := cmp.Or(c.ArchiveRegion, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))
+	dir := c.ArchiveDir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			cache = os.TempDir()
+		}
+		dir = filepath.Join(cache, "sniffy", "archive")
+	}
+	config := c.SessionConfig()
+	return archive.New(archive.Options{
+		URL:         c.ArchiveURL,
+		Endpoint:    c.ArchiveEndpoint,
+		Region:      region,
+		Credentials: creds,
+		Dir:         dir,
+		Interval:    c.ArchiveInterval,
+		Retention:   c.ArchiveRetention,
+		KeepLocal:   c.ArchiveKeepLocal,
+		Save: func(path string, flows []*flow.Flow) error {
+			return saveSession(keys, path, config, flows)
+		},
+	})
+}
+
+// SessionConfig 返回保存到会话文件中的配置，去掉密码、认证头部和密钥文件
+func (c *Config) SessionConfig() json.RawMessage {
+	cc := c.Clone()
+	cc.UpstreamProxyAuth = ""
+	cc.ProxyUsers = nil
+	cc.OTLPHeaders = nil
+	cc.StreamURL = stripUserinfo(cc.StreamURL)
+	cc.EncryptPassphraseFile = ""
+	cc.IdentityFiles = nil
+	for i := range cc.ClientCerts {
+		cc.ClientCerts[i].Password = ""
+	}
+	data, err := json.Marshal(cc)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// NewHooks 按顺序加载用户脚本和进程外插件并组成钩子链，都未配置时返回nil
+func (c *Config) NewHooks() (*hooks.Chain, error) {
+	if len(c.Scripts) == 0 && len(c.Addons) == 0 {
+		return nil, nil
+	}
+	chain := hooks.NewChain()
+	for _, path := range c.Scripts {
+		h, err := script.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		chain.Register(h)
+	}
+	for _, target := range c.Addons {
+		client, err := addon.NewClient(target)
+		if err != nil {
+			return nil, err
+		}
+		client.SetFailOpen(c.AddonFailOpen)
+		chain.Register(client)
+	}
+	return chain, nil
+}
+
+// WatchedFiles 返回修改后需要重新加载的脚本和规则文件
+func (c *Config) WatchedFiles() []string {
+	var files []string
+	files = append(files, c.Scripts...)
+	files = append(files, c.MockFiles...)
+	files = append(files, c.HARMockFiles...)
+	for _, l := range c.Listeners {
+		files = append(files, l.MockFiles...)
+	}
+	if c.ReplayCassette != "" {
+		files = append(files, c.ReplayCassette)
+	}
+	return files
+}
+
+// NewReplayer 创建经由本地监听地址重放请求的重放器，信任MITM CA签发的证书
+func (c *Config) NewReplayer(authority ca.CA) (*replay.Replayer, error) {
+	host := c.Address
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	var roots *x509.CertPool
+	if authority != nil {
+		roots = x509.NewCertPool()
+		roots.AddCert(authority.GetCA())
+	}
+	r, err := replay.New(net.JoinHostPort(host, strconv.Itoa(c.Port)), roots)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.ProxyUsers) > 0 {
+		user, password, _ := auth.ParseUser(c.ProxyUsers[0])
+		r.SetProxyAuth(user, password)
+	}
+	return r, nil
+}
+
+// NewTrustedProxies 解析允许发送PROXY protocol头部的对端地址
+func (c *Config) NewTrustedProxies() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range c.TrustedProxies {
+		prefix, err := auth.ParseClient(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// NewAuth 创建代理访问控制，未配置用户和客户端白名单时返回nil
+func (c *Config) NewAuth() (*auth.Authenticator, error) {
+	if len(c.ProxyUsers) == 0 && len(c.AllowedClients) == 0 {
+		return nil, nil
+	}
+	a := auth.New("")
+	for _, u := range c.ProxyUsers {
+		user, password, err := auth.ParseUser(u)
+		if err != nil {
+			return nil, err
+		}
+		a.AddUser(user, password)
+	}
+	for _, client := range c.AllowedClients {
+		if err := a.AllowClient(client); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// NewLimiter 创建并发限制。连接上限未设置或超过文件描述符允许的连接数时使用后者，
+// capped 表示配置的上限被降低
+func (c *Config) NewLimiter() (l *limits.Limiter, capped bool) {
+	conns := c.MaxConnections
+	if fdConns := limits.ConnsForFDs(); fdConns > 0 && (conns == 0 || conns > fdConns) {
+		capped = conns > 0
+		conns = fdConns
+	}
+	if conns == 0 && c.MaxOriginRequests == 0 {
+		return nil, false
+	}
+	return limits.New(conns, c.MaxOriginRequests), capped
+}
+
+// NewRateLimiter 创建限流器，未配置规则时返回nil
+func (c *Config) NewRateLimiter() (*ratelimit.Limiter, error) {
+	if len(c.RateLimits) == 0 {
+		return nil, nil
+	}
+	l := ratelimit.New()
+	for _, s := range c.RateLimits {
+		rule, err := ratelimit.ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.Add(rule); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// NewChaos 创建故障注入引擎，未配置规则时返回nil
+func (c *Config) NewChaos() (*chaos.Engine, error) {
+	if len(c.Chaos) == 0 {
+		return nil, nil
+	}
+	e := chaos.New()
+	for _, s := range c.Chaos {
+		rule, err := chaos.ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		e.Add(rule)
+	}
+	return e, nil
+}
+
+// NewOTLPExporter 创建流追踪导出器，未配置收集端时返回nil
+func (c *Config) NewOTLPExporter() (*otlp.Exporter, error) {
+	if c.OTLPEndpoint == "" {
+		return nil, nil
+	}
+	headers, err := c.otlpHeaders()
+	if err != nil {
+		return nil, err
+	}
+	return otlp.New(otlp.Options{Endpoint: c.OTLPEndpoint, Headers: headers})
+}
+
+// NewSink 创建发布完成的流的导出器，未配置消息系统时返回nil
+func (c *Config) NewSink() (*sink.Exporter, error) {
+	if c.StreamURL == "" {
+		return nil, nil
+	}
+	return sink.New(sink.Options{URL: c.StreamURL, IncludeBodies: c.StreamBodies})
+}
+
+// stripUserinfo 去掉地址中的用户名和密码
+func stripUserinfo(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = nil
+	return u.String()
+}
+
+// otlpHeaders 解析导出请求附带的头部
+func (c *Config) otlpHeaders() (http.Header, error) {
+	headers := http.Header{}
+	for _, h := range c.OTLPHeaders {
+		name, value, ok := strings.Cut(h, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q (expected Name=value)", h)
+		}
+		headers.Add(name, strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// NewLogging 根据配置创建日志
+func (c *Config) NewLogging() (*logging.Logging, error) {
+	opts, err := c.logOptions()
+	if err != nil {
+		return nil, err
+	}
+	return logging.New(opts)
+}
+
+// logOptions 解析日志级别配置
+func (c *Config) logOptions() (logging.Options, error) {
+	opts := logging.Options{
+		Format:     c.LogFormat,
+		Level:      slog.LevelInfo,
+		Levels:     make(map[string]slog.Level),
+		File:       c.LogFile,
+		MaxSize:    int64(c.LogMaxSize) << 20,
+		MaxBackups: c.LogMaxBackups,
+	}
+	if c.LogFormat != "" && c.LogFormat != "text" && c.LogFormat != "json" {
+		return opts, fmt.Errorf("unknown log format %q (supported: text, json)", c.LogFormat)
+	}
+	if c.LogLevel != "" {
+		level, err := logging.ParseLevel(c.LogLevel)
+		if err != nil {
+			return opts, err
+		}
+		opts.Level = level
+	}
+	for _, s := range c.LogLevels {
+		name, level, err := logging.ParseSubsystemLevel(s)
+		if err != nil {
+			return opts, err
+		}
+		opts.Levels[name] = level
+	}
+	return opts, nil
+}
+
+// stringList 可重复的字符串命令行参数
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
 }
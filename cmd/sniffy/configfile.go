@@ -0,0 +1,173 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix 覆盖配置的环境变量的前缀
+const envPrefix = "SNIFFY_"
+
+// LoadFile 读取配置文件，按扩展名识别 YAML（.yaml、.yml）、JSON（.json）和 TOML（.toml）格式。
+// 键与 Config 的 yaml 标签相同，文件中没有的键保持原值，未知的键和类型错误按行号报告
+func (c *Config) LoadFile(path string) error {
+	root, err := readConfigFile(path)
+	if err != nil || root == nil {
+		return err
+	}
+	if err := root.Decode(c); err != nil {
+		return fmt.Errorf("%s: %w", path, decodeError(err))
+	}
+	return nil
+}
+
+// readConfigFile 解析配置文件并检查键，返回配置项的映射节点，文件为空时返回nil
+func readConfigFile(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var root *yaml.Node
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(doc.Content) == 0 {
+			return nil, nil
+		}
+		root = doc.Content[0]
+	case ".toml":
+		if root, err = parseTOML(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q (expected .yaml, .yml, .json or .toml)", ext)
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: line %d: expected a mapping of configuration keys", path, root.Line)
+	}
+	if err := checkKeys(root, reflect.TypeOf(Config{})); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return root, nil
+}
+
+// ApplyEnv 用 SNIFFY_ 开头的环境变量覆盖配置，变量名为大写的 yaml 键，例如 SNIFFY_CONTROL_ADDRESS=127.0.0.1:8081。
+// 列表以逗号分隔，值以 [ 开头时按YAML的流式序列解析，例如 SNIFFY_HEADER_RULES='["request set * X-A: 1,2"]'。
+// 不对应配置项的变量记录警告后忽略
+func (c *Config) ApplyEnv(environ []string) error {
+	fields := yamlFields(reflect.TypeOf(c).Elem())
+	v := reflect.ValueOf(c).Elem()
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		key, ok := strings.CutPrefix(name, envPrefix)
+		if !ok {
+			continue
+		}
+		field, ok := fields[strings.ToLower(key)]
+		if !ok {
+			// 同前缀的变量可能属于其他程序或更新的版本，不阻止启动
+			log.Printf("Warning: ignoring unknown configuration environment variable %s", name)
+			continue
+		}
+		node, err := envNode(value, field.Type)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := node.Decode(v.FieldByIndex(field.Index).Addr().Interface()); err != nil {
+			// 环境变量没有行号
+			return fmt.Errorf("%s: %s", name, strings.ReplaceAll(decodeError(err).Error(), "line 0: ", ""))
+		}
+	}
+	return nil
+}
+
+// envNode 将环境变量的值转换为YAML节点，列表字段的值按逗号拆分
+func envNode(value string, t reflect.Type) (*yaml.Node, error) {
+	if t.Kind() != reflect.Slice {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: value}, nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(value), "[") {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+			return nil, err
+		}
+		return doc.Content[0], nil
+	}
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+		}
+	}
+	return list, nil
+}
+
+// decodeError 将 yaml.TypeError 的多行错误合并为一行
+func decodeError(err error) error {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		return errors.New(strings.Join(typeErr.Errors, "; "))
+	}
+	return err
+}
+
+// checkKeys 检查映射节点中的键都是 t 中字段的 yaml 标签
+func checkKeys(node *yaml.Node, t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return checkKeys(node, t.Elem())
+	case reflect.Slice:
+		if node.Kind == yaml.SequenceNode {
+			for _, item := range node.Content {
+				if err := checkKeys(item, t.Elem()); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			// 类型不符由 Decode 报告
+			return nil
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			field, ok := fields[key.Value]
+			if !ok {
+				return fmt.Errorf("line %d: unknown key %q", key.Line, key.Value)
+			}
+			if err := checkKeys(node.Content[i+1], field.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// yamlFields 返回结构体按 yaml 标签索引的字段
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name != "" && name != "-" && f.IsExported() {
+			fields[name] = f
+		}
+	}
+	return fields
+}
@@ -0,0 +1,168 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// writeConfig 在临时目录中写入名为 name 的配置文件
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+// captureLog 收集测试期间标准日志的输出
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// --- 测试代码 ---
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"yaml", "sniffy.yaml", "port: 9000\nheader_rules:\n  - \"request set * X-A: 1\"\nlisteners:\n  - name: api\n    address: 127.0.0.1:9001\n"},
+		{"json", "sniffy.json", `{"port": 9000, "header_rules": ["request set * X-A: 1"], "listeners": [{"name": "api", "address": "127.0.0.1:9001"}]}`},
+		{"toml", "sniffy.toml", "port = 9000\nheader_rules = [\"request set * X-A: 1\"]\n\n[[listeners]]\nname = \"api\"\naddress = \"127.0.0.1:9001\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			require.NoError(t, c.LoadFile(writeConfig(t, tt.file, tt.content)))
+			require.Equal(t, 9000, c.Port)
+			require.Equal(t, []string{"request set * X-A: 1"}, c.HeaderRules)
+			require.Len(t, c.Listeners, 1)
+			require.Equal(t, "127.0.0.1:9001", c.Listeners[0].Address)
+		})
+	}
+}
+
+func TestLoadFile_TOMLFloats(t *testing.T) {
+	c := DefaultConfig()
+	require.NoError(t, c.LoadFile(writeConfig(t, "sniffy.toml", "sample_rate = nan\n")))
+	require.True(t, math.IsNaN(c.SampleRate))
+	require.ErrorContains(t, c.Validate(), "invalid sample rate")
+
+	require.NoError(t, c.LoadFile(writeConfig(t, "sniffy.toml", "sample_rate = -inf\n")))
+	require.Equal(t, math.Inf(-1), c.SampleRate)
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		err     string
+	}{
+		{"unknown key", "sniffy.toml", "port = 9000\n\nbogus = 1\n", `line 3: unknown key "bogus"`},
+		{"unknown nested key", "sniffy.yaml", "listeners:\n  - name: api\n    adress: x\n", `line 3: unknown key "adress"`},
+		{"type error", "sniffy.toml", "port = \"high\"\n", "line 1: cannot unmarshal"},
+		{"toml syntax error", "sniffy.toml", "[a]\n[a]\n", `line 2: table "a" is already defined`},
+		{"not a mapping", "sniffy.yaml", "- port\n", "line 1: expected a mapping of configuration keys"},
+		{"unsupported format", "sniffy.ini", "port=1\n", `unsupported config file format ".ini"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.file, tt.content)
+			err := DefaultConfig().LoadFile(path)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	logs := captureLog(t)
+	c := DefaultConfig()
+	require.NoError(t, c.ApplyEnv([]string{
+		"PATH=/usr/bin",
+		"SNIFFY_CONTROL_ADDRESS=127.0.0.1:9002",
+		"SNIFFY_MAX_CONNECTIONS=12",
+		"SNIFFY_ENABLE_LOGGING=true",
+		"SNIFFY_READ_TIMEOUT=5s",
+		"SNIFFY_HEADER_RULES=request del * X-A, response del * X-B ,",
+		"SNIFFY_POD_NAME_TYPO=web-0",
+	}))
+	require.Equal(t, "127.0.0.1:9002", c.ControlAddress)
+	require.Equal(t, 12, c.MaxConnections)
+	require.True(t, c.EnableLogging)
+	require.Equal(t, 5*time.Second, c.ReadTimeout)
+	require.Equal(t, []string{"request del * X-A", "response del * X-B"}, c.HeaderRules)
+
+	// 未知的变量只记录警告
+	require.Contains(t, logs.String(), "ignoring unknown configuration environment variable SNIFFY_POD_NAME_TYPO")
+	require.NotContains(t, logs.String(), "PATH")
+}
+
+func TestApplyEnv_FlowSequence(t *testing.T) {
+	c := DefaultConfig()
+	require.NoError(t, c.ApplyEnv([]string{`SNIFFY_HEADER_RULES=["request set * X-A: 1,2"]`}))
+	require.Equal(t, []string{"request set * X-A: 1,2"}, c.HeaderRules)
+}
+
+func TestApplyEnv_Errors(t *testing.T) {
+	tests := []struct {
+		env string
+		err string
+	}{
+		{"SNIFFY_PORT=high", "SNIFFY_PORT: cannot unmarshal"},
+		{"SNIFFY_READ_TIMEOUT=soon", "SNIFFY_READ_TIMEOUT: cannot unmarshal"},
+		{"SNIFFY_HEADER_RULES=[unclosed", "SNIFFY_HEADER_RULES:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			err := DefaultConfig().ApplyEnv([]string{tt.env})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.err)
+			require.NotContains(t, err.Error(), "line 0")
+		})
+	}
+}
+
+func TestValidate_TrustedProxies(t *testing.T) {
+	c := DefaultConfig()
+	require.NoError(t, c.LoadFile(writeConfig(t, "sniffy.yaml", "accept_proxy_protocol: true\n")))
+	require.ErrorContains(t, c.Validate(), "accept_proxy_protocol requires trusted_proxies")
+
+	c.TrustedProxies = []string{"10.0.0.0/8", "bogus"}
+	require.ErrorContains(t, c.Validate(), "invalid trusted proxy")
+
+	c.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1"}
+	require.NoError(t, c.Validate())
+	prefixes, err := c.NewTrustedProxies()
+	require.NoError(t, err)
+	require.Equal(t, "192.0.2.1/32", prefixes[1].String())
+}
+
+func TestAllowedControlHosts(t *testing.T) {
+	c := DefaultConfig()
+	c.ControlAddress = "sniffy.internal:8081"
+	c.ControlHosts = []string{"sniffy.example.com"}
+	require.Equal(t, []string{"sniffy.example.com", "sniffy.internal"}, c.AllowedControlHosts())
+
+	c.ControlAddress = "unix:/run/sniffy.sock"
+	require.Equal(t, []string{"sniffy.example.com"}, c.AllowedControlHosts())
+}
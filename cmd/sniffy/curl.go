@@ -0,0 +1,160 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/flowdb"
+)
+
+const curlUsage = `用法:
+  sniffy curl [选项] -store DB ID      以 curl 命令的形式输出流数据库中的请求
+  sniffy curl [选项] -file FILE ID|N   从会话或其他工具的捕获文件中查找请求，
+                                      没有流ID的文件（例如HAR）可以用从1开始的序号
+`
+
+// flowFlags 从流数据库或捕获文件中查找单个流的子命令共用的选项
+type flowFlags struct {
+	*flag.FlagSet
+	config *Config
+	store  *string
+	file   *string
+	format *string
+}
+
+func newFlowFlags(name string) *flowFlags {
+	return newInputFlags(name, "format")
+}
+
+// newInputFlags 创建子命令的选项，formatFlag 为 -file 文件格式的选项名，供 -format 另有含义的子命令使用
+func newInputFlags(name, formatFlag string) *flowFlags {
+	fs := &flowFlags{FlagSet: flag.NewFlagSet("sniffy "+name, flag.ContinueOnError), config: DefaultConfig()}
+	fs.store = fs.String("store", "", "流数据库文件")
+	fs.file = fs.String("file", "", "会话、HAR、mitmproxy、Charles 或 Fiddler 文件")
+	fs.format = fs.String(formatFlag, "", "-file 的文件格式，默认按扩展名判断")
+	fs.StringVar(&fs.config.EncryptPassphraseFile, "encrypt-passphrase-file", "", "解密使用的口令文件")
+	fs.Var((*stringList)(&fs.config.IdentityFiles), "identity", "读取加密文件时使用的 age 身份文件，可重复指定")
+	return fs
+}
+
+// findFlow 查找参数指定的流
+func (fs *flowFlags) findFlow() (*flow.Flow, error) {
+	if fs.NArg() != 1 || (*fs.store == "") == (*fs.file == "") {
+		return nil, errors.New("exactly one of -store or -file and a flow id are required")
+	}
+	flows, err := fs.findFlows(fs.Args())
+	if err != nil {
+		return nil, err
+	}
+	return flows[0], nil
+}
+
+// findFlows 查找 ids 指定的多个流
+func (fs *flowFlags) findFlows(ids []string) ([]*flow.Flow, error) {
+	keys, err := fs.config.NewKeys()
+	if err != nil {
+		return nil, err
+	}
+	if *fs.store != "" {
+		db, err := flowdb.OpenEncrypted(*fs.store, keys)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		found := make([]*flow.Flow, len(ids))
+		for i, id := range ids {
+			if found[i], err = db.Get(id); err != nil {
+				return nil, err
+			}
+		}
+		return found, nil
+	}
+	read, err := importFormat(*fs.file, *fs.format)
+	if err != nil {
+		return nil, err
+	}
+	flows, err := loadFlows(keys, *fs.file, read)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]*flow.Flow, len(ids))
+	for i, id := range ids {
+		for _, f := range flows {
+			if f.ID == id {
+				found[i] = f
+				break
+			}
+		}
+		if n, err := strconv.Atoi(id); found[i] == nil && err == nil && n >= 1 && n <= len(flows) {
+			found[i] = flows[n-1]
+		}
+		if found[i] == nil {
+			return nil, fmt.Errorf("flow %s not found in %s", id, *fs.file)
+		}
+	}
+	return found, nil
+}
+
+// flows 读取满足过滤条件的所有流
+func (fs *flowFlags) flows(fl *filter.Filter) ([]*flow.Flow, error) {
+	if (*fs.store == "") == (*fs.file == "") {
+		return nil, errors.New("exactly one of -store or -file is required")
+	}
+	keys, err := fs.config.NewKeys()
+	if err != nil {
+		return nil, err
+	}
+	if *fs.store != "" {
+		db, err := flowdb.OpenEncrypted(*fs.store, keys)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		return db.Query(flowdb.Query{Filter: fl})
+	}
+	read, err := importFormat(*fs.file, *fs.format)
+	if err != nil {
+		return nil, err
+	}
+	flows, err := loadFlows(keys, *fs.file, read)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(flows, func(f *flow.Flow) bool { return !fl.Match(f) }), nil
+}
+
+// runCurl 执行 sniffy curl 子命令，返回进程退出码
+func runCurl(args []string) int {
+	fs := newFlowFlags("curl")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, curlUsage)
+		fs.PrintDefaults()
+	}
+	var opts flow.CurlOptions
+	fs.BoolVar(&opts.Insecure, "k", false, "添加 --insecure，不校验服务器证书")
+	fs.StringVar(&opts.Proxy, "x", "", "添加 --proxy，经由该代理发送请求，例如 http://127.0.0.1:8080")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	f, err := fs.findFlow()
+	if err == nil && f.Request == nil {
+		err = errors.New("flow has no request")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy curl: %v\n", err)
+		return 1
+	}
+	fmt.Println(f.ToCurl(opts))
+	return 0
+}
@@ -0,0 +1,73 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/f-dong/sniffy/capture/diff"
+)
+
+const diffUsage = `用法:
+  sniffy diff [选项] -store DB A B      比较流数据库中的两个流的状态、头部和消息体
+  sniffy diff [选项] -file FILE A B     比较捕获文件中的两个流，没有流ID的文件可以用从1开始的序号
+
+没有差异时退出码为0，有差异时为1，出错时为2
+`
+
+// runDiff 执行 sniffy diff 子命令，返回进程退出码
+func runDiff(args []string) int {
+	fs := newFlowFlags("diff")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, diffUsage)
+		fs.PrintDefaults()
+	}
+	var opts diff.Options
+	var ignoreHeaders []string
+	fs.Var((*stringList)(&ignoreHeaders), "ignore-header", "不比较的头部，可重复指定，指定后替换默认忽略的 Date 等头部")
+	fs.Var((*stringList)(&opts.IgnorePaths), "ignore-path", "不比较的JSON路径，例如 $.timestamp，可重复指定")
+	fs.BoolVar(&opts.ResponseOnly, "response-only", false, "只比较响应")
+	asJSON := fs.Bool("json", false, "以JSON格式输出差异")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if ignoreHeaders != nil {
+		opts.IgnoreHeaders = ignoreHeaders
+	}
+
+	result, err := diffFlows(fs, &opts)
+	if err == nil {
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(result)
+		} else {
+			err = result.WriteText(os.Stdout)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy diff: %v\n", err)
+		return 2
+	}
+	if !result.Equal() {
+		return 1
+	}
+	return 0
+}
+
+func diffFlows(fs *flowFlags, opts *diff.Options) (*diff.Result, error) {
+	if fs.NArg() != 2 || (*fs.store == "") == (*fs.file == "") {
+		return nil, errors.New("exactly one of -store or -file and two flow ids are required")
+	}
+	flows, err := fs.findFlows(fs.Args())
+	if err != nil {
+		return nil, err
+	}
+	return diff.Flows(flows[0], flows[1], opts), nil
+}
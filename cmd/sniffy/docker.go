@@ -0,0 +1,177 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/docker"
+)
+
+const dockerUsage = `用法:
+  sniffy docker rules [选项]          输出把Docker网络中容器的连接重定向到透明代理监听器的 iptables 规则
+  sniffy docker trust [选项] 容器...  将MITM根证书复制到容器并加入容器的系统信任存储
+
+rules 输出的规则需要以 root 执行，例如 sniffy docker rules -port 8081 | sudo sh。
+代理需要一个监听网桥地址或 0.0.0.0 的透明代理监听器，例如
+  sniffy serve -docker -listen docker=0.0.0.0:8081,transparent
+
+没有 shell 的镜像无法执行 trust，可以在创建容器时挂载证书。Go 程序加载 /etc/ssl/certs 中的所有证书，
+Node.js 需要设置 NODE_EXTRA_CA_CERTS：
+  sniffy cert export -o sniffy-ca.crt
+  docker run -v $PWD/sniffy-ca.crt:/etc/ssl/certs/sniffy-ca.pem:ro -e NODE_EXTRA_CA_CERTS=/etc/ssl/certs/sniffy-ca.pem ...
+`
+
+// trustDir 证书复制到容器中的目录，此后由 trustScript 加入信任存储
+const trustDir = "/tmp"
+
+// trustScript 在容器中把 /tmp/sniffy-ca.crt 加入系统信任存储，支持的发行版与 sniffy cert install 相同，
+// 都不支持时追加到常见的证书包文件
+const trustScript = `set -e
+cert=/tmp/sniffy-ca.crt
+if command -v update-ca-certificates >/dev/null 2>&1; then
+  mkdir -p /usr/local/share/ca-certificates
+  cp "$cert" /usr/local/share/ca-certificates/sniffy-ca.crt
+  update-ca-certificates
+elif command -v update-ca-trust >/dev/null 2>&1; then
+  cp "$cert" /etc/pki/ca-trust/source/anchors/sniffy-ca.crt
+  update-ca-trust extract
+elif [ -f /etc/ssl/certs/ca-certificates.crt ]; then
+  cat "$cert" >> /etc/ssl/certs/ca-certificates.crt
+else
+  echo "no supported trust store found" >&2
+  exit 1
+fi
+rm -f "$cert"
+`
+
+// runDocker 执行 sniffy docker 子命令，返回进程退出码
+func runDocker(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, dockerUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("sniffy docker "+args[0], flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, dockerUsage)
+		fs.PrintDefaults()
+	}
+	host := fs.String("host", "", "Docker守护进程的地址，默认读取 DOCKER_HOST 环境变量或使用 "+docker.DefaultHost)
+	var err error
+	switch args[0] {
+	case "rules":
+		network := fs.String("network", "bridge", "重定向的Docker网络")
+		port := fs.Int("port", 0, "透明代理监听器的端口")
+		ports := fs.String("ports", "80,443", "重定向的目标端口，逗号分隔")
+		remove := fs.Bool("delete", false, "输出删除规则的命令")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		err = dockerRules(*host, *network, *port, *ports, *remove, os.Stdout)
+	case "trust":
+		dir := fs.String("ca-dir", "", "CA证书和私钥所在的目录，默认为 ~/.sniffy")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if fs.NArg() == 0 {
+			fs.Usage()
+			return 2
+		}
+		err = dockerTrust(*host, *dir, fs.Args(), os.Stdout)
+	default:
+		fmt.Fprint(os.Stderr, dockerUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy docker %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// dockerRules 输出把网络 name 中的容器发往 ports 的连接重定向到本机 port 端口的规则
+func dockerRules(host, name string, port int, ports string, remove bool, out io.Writer) error {
+	if port < 1 || port > 65535 {
+		return errors.New("-port must be the port of a transparent listener")
+	}
+	var dports []int
+	for _, s := range splitList(ports) {
+		p, err := strconv.Atoi(s)
+		if err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port %q", s)
+		}
+		dports = append(dports, p)
+	}
+	client, err := docker.NewClient(host)
+	if err != nil {
+		return err
+	}
+	network, err := client.Network(context.Background(), name)
+	if err != nil {
+		return err
+	}
+	rules, err := docker.RedirectRules(network, port, dports, remove)
+	if err != nil {
+		return err
+	}
+
+	subnets := make([]string, len(network.Subnets))
+	for i, s := range network.Subnets {
+		subnets[i] = s.String()
+	}
+	fmt.Fprintf(out, "# Docker network %s (%s, %s)\n", network.Name, network.Bridge, strings.Join(subnets, ", "))
+	for _, rule := range rules {
+		fmt.Fprintln(out, rule)
+	}
+	return nil
+}
+
+// dockerTrust 将MITM根证书加入每个容器的系统信任存储
+func dockerTrust(host, dir string, containers []string, out io.Writer) error {
+	authority, err := loadCA(dir)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: authority.GetCA().Raw})
+	client, err := docker.NewClient(host)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var errs []error
+	for _, name := range containers {
+		if err := trustContainer(ctx, client, name, data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		fmt.Fprintf(out, "Trusted %s in %s\n", authority.GetCA().Subject.CommonName, name)
+	}
+	return errors.Join(errs...)
+}
+
+// trustContainer 将证书复制到容器并以 root 执行 trustScript
+func trustContainer(ctx context.Context, client *docker.Client, name string, cert []byte) error {
+	if err := client.CopyFile(ctx, name, trustDir, "sniffy-ca.crt", cert, 0o644); err != nil {
+		return err
+	}
+	code, output, err := client.Exec(ctx, name, "0", []string{"/bin/sh", "-c", trustScript})
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("trust script exited with status %d: %s", code, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
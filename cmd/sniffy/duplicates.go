@@ -0,0 +1,66 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/f-dong/sniffy/capture/duplicates"
+)
+
+const duplicatesUsage = `用法:
+  sniffy duplicates [选项] -store DB   找出流数据库中窗口内方法、URL和请求体都相同的重复请求
+  sniffy duplicates [选项] -file FILE  分析会话或其他工具的捕获文件
+`
+
+// runDuplicates 执行 sniffy duplicates 子命令，返回进程退出码
+func runDuplicates(args []string) int {
+	fs := newFlowFlags("duplicates")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, duplicatesUsage)
+		fs.PrintDefaults()
+	}
+	expr := fs.String("filter", "", "只分析满足过滤表达式的流，例如 host == api.example.com")
+	output := fs.String("o", "", "报告文件，默认输出到标准输出")
+	asJSON := fs.Bool("json", false, "输出JSON，默认输出文本")
+	window := fs.Duration("window", duplicates.DefaultWindow, "与上一个相同请求的间隔不超过该时间时视为重复")
+	var ignore stringList
+	fs.Var(&ignore, "ignore-param", "比较URL时忽略的查询参数，例如 _，可重复指定")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *window <= 0 {
+		fmt.Fprintf(os.Stderr, "sniffy duplicates: invalid window %v\n", *window)
+		return 2
+	}
+	opts := duplicates.Options{Window: *window, IgnoreParams: ignore}
+	if err := reportDuplicates(fs, *expr, *output, *asJSON, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy duplicates: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func reportDuplicates(fs *flowFlags, expr, output string, asJSON bool, opts duplicates.Options) error {
+	flows, err := filteredFlows(fs, expr)
+	if err != nil {
+		return err
+	}
+	report := duplicates.Analyze(flows, opts)
+	if asJSON {
+		return writeJSON(output, report)
+	}
+	w, closeOutput, err := openOutput(output)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteText(w); err != nil {
+		closeOutput()
+		return err
+	}
+	return closeOutput()
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/flowcsv"
+	"github.com/f-dong/sniffy/capture/jsonl"
+)
+
+const exportUsage = `用法:
+  sniffy export [选项] -store DB   将流数据库中的流导出为每行一个JSON对象（JSON Lines），便于用 jq 处理
+  sniffy export [选项] -file FILE  导出会话或其他工具的捕获文件中的流
+  sniffy export -format csv ...    导出流的摘要为CSV，便于导入电子表格
+
+选择字段示例:
+  sniffy export -store flows.db -fields id,method,url,status,duration_ms | jq 'select(.status >= 500)'
+  sniffy export -store flows.db -format csv -fields time,method,host,path,status,duration_ms -o flows.csv
+`
+
+// runExport 执行 sniffy export 子命令，返回进程退出码
+func runExport(args []string) int {
+	fs := newInputFlags("export", "input-format")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, exportUsage)
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "jsonl", "输出格式 (jsonl, csv)")
+	expr := fs.String("filter", "", "只导出满足过滤表达式的流，例如 status >= 400")
+	output := fs.String("o", "", "输出文件，默认输出到标准输出")
+	fields := fs.String("fields", "", "逗号分隔的输出字段及顺序。jsonl 默认输出全部字段: "+strings.Join(jsonl.Fields, ",")+
+		"；csv 可选 "+strings.Join(flowcsv.Columns, ",")+"，默认为 "+strings.Join(flowcsv.DefaultColumns, ","))
+	bodies := fs.Bool("bodies", false, "jsonl 包含捕获的请求和响应消息体（base64编码）")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := exportFlows(fs, *format, *expr, *output, splitList(*fields), *bodies); err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy export: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func exportFlows(fs *flowFlags, format, expr, output string, fields []string, bodies bool) error {
+	var write func(w io.Writer, flows []*flow.Flow) error
+	switch format {
+	case "jsonl":
+		write = func(w io.Writer, flows []*flow.Flow) error {
+			return jsonl.Write(w, flows, jsonl.Options{Fields: fields, IncludeBodies: bodies})
+		}
+	case "csv":
+		write = func(w io.Writer, flows []*flow.Flow) error {
+			return flowcsv.Write(w, flows, fields)
+		}
+	default:
+		return fmt.Errorf("unsupported export format %q (expected jsonl or csv)", format)
+	}
+	flows, err := filteredFlows(fs, expr)
+	if err != nil {
+		return err
+	}
+	w, closeOutput, err := openOutput(output)
+	if err != nil {
+		return err
+	}
+	if err := write(w, flows); err != nil {
+		closeOutput()
+		return err
+	}
+	return closeOutput()
+}
+
+// splitList 拆分逗号分隔的列表，忽略空白项
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
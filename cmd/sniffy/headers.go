@@ -0,0 +1,58 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/f-dong/sniffy/capture/secheaders"
+)
+
+const headersUsage = `用法:
+  sniffy headers [选项] -store DB      按主机检查流数据库中响应的安全头部
+  sniffy headers [选项] -file FILE     检查会话或其他工具的捕获文件
+`
+
+// runHeaders 执行 sniffy headers 子命令，返回进程退出码
+func runHeaders(args []string) int {
+	fs := newFlowFlags("headers")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, headersUsage)
+		fs.PrintDefaults()
+	}
+	expr := fs.String("filter", "", "只检查满足过滤表达式的流，例如 host == api.example.com")
+	output := fs.String("o", "", "报告文件，默认输出到标准输出")
+	html := fs.Bool("html", false, "输出HTML报告，默认输出JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := reportHeaders(fs, *expr, *output, *html); err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy headers: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func reportHeaders(fs *flowFlags, expr, output string, html bool) error {
+	flows, err := filteredFlows(fs, expr)
+	if err != nil {
+		return err
+	}
+	report := secheaders.Analyze(flows)
+	if !html {
+		return writeJSON(output, report)
+	}
+	w, closeOutput, err := openOutput(output)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteHTML(w); err != nil {
+		closeOutput()
+		return err
+	}
+	return closeOutput()
+}
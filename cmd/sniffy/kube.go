@@ -0,0 +1,125 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/f-dong/sniffy/capture/kube"
+)
+
+const kubeUsage = `用法:
+  sniffy kube init [选项]  在 Pod 的网络命名空间中安装把出站TCP连接重定向到边车的 iptables 规则
+
+init 在 Pod 的 init 容器中以 NET_ADMIN 权限运行，边车以 -uid 指定的用户运行透明代理监听器，例如
+  sniffy serve -listen egress=[::]:15001,transparent
+边车的 downward API 环境变量 SNIFFY_POD_NAME、SNIFFY_POD_NAMESPACE 和 SNIFFY_NODE_NAME
+使每个流记录所在的 Pod，完整的示例见 scripts/kubernetes/sidecar.yaml。
+服务器先发送数据的协议（例如 MySQL、SMTP）要等待客户端的第一个字节超时后才能透传，应当用 -exclude-ports 排除
+`
+
+// runKube 执行 sniffy kube 子命令，返回进程退出码
+func runKube(args []string) int {
+	if len(args) == 0 || args[0] != "init" {
+		fmt.Fprint(os.Stderr, kubeUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("sniffy kube init", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, kubeUsage)
+		fs.PrintDefaults()
+	}
+	port := fs.Int("port", 15001, "边车透明代理监听器的端口")
+	uid := fs.Int("uid", kube.DefaultUID, "边车进程的用户ID，这个用户发起的连接不重定向")
+	ports := fs.String("exclude-ports", "", "不重定向的目标端口，逗号分隔")
+	cidrs := fs.String("exclude-cidrs", "", "不重定向的目标网段，逗号分隔，例如API服务器的地址")
+	ipv6 := fs.Bool("ipv6", true, "同时安装 ip6tables 规则，没有 ip6tables 时跳过")
+	dryRun := fs.Bool("dry-run", false, "只输出命令，不执行")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	egress, err := parseEgress(*port, *uid, *ports, *cidrs)
+	if err == nil {
+		err = installEgress(egress, *ipv6, *dryRun, os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy kube init: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// parseEgress 解析 init 的命令行参数
+func parseEgress(port, uid int, ports, cidrs string) (kube.Egress, error) {
+	e := kube.Egress{Port: port, UID: uid}
+	if uid < 0 {
+		return e, fmt.Errorf("invalid uid %d", uid)
+	}
+	for _, s := range splitList(ports) {
+		p, err := strconv.Atoi(s)
+		if err != nil || p < 1 || p > 65535 {
+			return e, fmt.Errorf("invalid excluded port %q", s)
+		}
+		e.ExcludePorts = append(e.ExcludePorts, p)
+	}
+	for _, s := range splitList(cidrs) {
+		// 单个地址按 /32 或 /128 处理
+		prefix := s
+		if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+			prefix += "/32"
+		} else if ip != nil {
+			prefix += "/128"
+		}
+		_, cidr, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return e, fmt.Errorf("invalid excluded CIDR %q", s)
+		}
+		e.ExcludeCIDRs = append(e.ExcludeCIDRs, cidr)
+	}
+	return e, nil
+}
+
+// installEgress 依次执行安装规则的命令，ipv6 为true且有 ip6tables 时同时安装IPv6规则
+func installEgress(e kube.Egress, ipv6, dryRun bool, out io.Writer) error {
+	steps, err := e.Steps(false)
+	if err != nil {
+		return err
+	}
+	if ipv6 {
+		if _, err := exec.LookPath("ip6tables"); err == nil || dryRun {
+			v6, err := e.Steps(true)
+			if err != nil {
+				return err
+			}
+			steps = append(steps, v6...)
+		} else {
+			fmt.Fprintln(out, "ip6tables not found, skipping IPv6 rules")
+		}
+	}
+
+	for _, step := range steps {
+		fmt.Fprintln(out, step)
+		if dryRun {
+			continue
+		}
+		var output bytes.Buffer
+		cmd := exec.Command(step.Args[0], step.Args[1:]...)
+		cmd.Stdout, cmd.Stderr = &output, &output
+		if err := cmd.Run(); err != nil && !step.MayFail {
+			return fmt.Errorf("%s: %w: %s", step, err, strings.TrimSpace(output.String()))
+		}
+	}
+	return nil
+}
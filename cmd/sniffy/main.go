@@ -6,12 +6,43 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"flag"
 	"github.com/f-dong/sniffy/capture"
+	"github.com/f-dong/sniffy/capture/accesslog"
+	"github.com/f-dong/sniffy/capture/api"
+	"github.com/f-dong/sniffy/capture/archive"
+	"github.com/f-dong/sniffy/capture/breakpoint"
+	"github.com/f-dong/sniffy/capture/cassette"
+	"github.com/f-dong/sniffy/capture/cdp"
+	"github.com/f-dong/sniffy/capture/console"
+	"github.com/f-dong/sniffy/capture/dashboard"
+	"github.com/f-dong/sniffy/capture/docker"
+	"github.com/f-dong/sniffy/capture/ebpf"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/flowdb"
+	"github.com/f-dong/sniffy/capture/har"
+	"github.com/f-dong/sniffy/capture/hooks"
+	"github.com/f-dong/sniffy/capture/logging"
+	"github.com/f-dong/sniffy/capture/pcapng"
+	"github.com/f-dong/sniffy/capture/replay"
+	"github.com/f-dong/sniffy/capture/rules"
+	"github.com/f-dong/sniffy/capture/stats"
+	"github.com/f-dong/sniffy/capture/systemd"
+	"github.com/f-dong/sniffy/capture/timeouts"
+	"github.com/f-dong/sniffy/capture/tlsinfo"
+	"github.com/f-dong/sniffy/capture/watch"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -21,72 +52,944 @@ var (
 	listenAddr = flag.String("addr", "0.0.0.0", "TCP监听地址")
 	listenPort = flag.Int("port", 8080, "TCP监听端口")
 	verbose    = flag.Bool("v", false, "启用详细日志输出")
-	configFile = flag.String("config", "", "配置文件路径")
+	configFile = flag.String("config", "", "配置文件路径 (.yaml, .json, .toml)，收到SIGHUP或 POST /api/v1/reload 时重新加载规则、上游和日志级别")
+	dnsServer  = flag.String("dns", "", "上游解析使用的DNS服务器 (ip[:port])")
+	acceptPP   = flag.Bool("accept-proxy-protocol", false, "解析入站连接的PROXY protocol头部，只接受 -trusted-proxy 指定的对端发送的头部")
+	upstreamPP = flag.Int("upstream-proxy-protocol", 0, "向上游发送的PROXY protocol版本 (0, 1, 2)")
+	upstream   = flag.String("upstream-proxy", "", "经由上游HTTP代理连接所有上游，例如 http://proxy.corp:3128，未指定时使用 HTTP_PROXY、HTTPS_PROXY 和 NO_PROXY 环境变量")
+	noEnvProxy = flag.Bool("ignore-proxy-env", false, "未指定 -upstream-proxy 时不使用代理环境变量，直接连接上游")
+	poolIdle   = flag.Int("pool-max-idle", 8, "每个上游源站保留的空闲keep-alive连接数，0表示不复用上游连接")
+	poolWait   = flag.Duration("pool-idle-timeout", 90*time.Second, "空闲上游连接的保留时间")
+	upstreamH2 = flag.Bool("upstream-h2", false, "与HTTPS上游协商h2，并发复用和合并连接")
+	maxConns   = flag.Int("max-conns", 0, "最大并发客户端连接数，超出时重置连接，0表示按文件描述符限制估算")
+	maxOrigin  = flag.Int("max-origin-requests", 0, "每个源站的最大进行中请求数，超出时返回503，0表示不限制")
+	bodyLimit  = flag.Int64("body-limit", flow.DefaultBodyLimit, "内存中捕获的最大请求体/响应体字节数，更长的内容流式转发且不经过钩子和改写规则，0表示不限制")
+	bodySpill  = flag.String("body-spill-dir", "", "保存超过 -body-limit 的完整内容的目录，为空时只保留开头部分")
+	timeoutOpt = flag.String("timeouts", "", "各阶段的超时 dial=5s,tls=5s,request-header=10s,response-header=30s,idle=90s,flow=2m，未设置的阶段不限制")
+	upAuth     = flag.String("upstream-auth", "", "上游代理认证 (basic:user:password, ntlm:DOMAIN\\user:password, negotiate[:spn], negotiate:user@REALM:password)")
+	procLookup = flag.Bool("process-lookup", false, "查找本机流量的发起进程")
+	dockerOn   = flag.Bool("docker", false, "通过Docker API查找发起连接的容器")
+	dockerHost = flag.String("docker-host", "", "Docker守护进程的地址，默认读取 DOCKER_HOST 环境变量或使用 "+docker.DefaultHost)
+	ebpfCgroup = flag.String("ebpf-cgroup", "", "ebpf 模式的监听器附加eBPF程序的 cgroup v2 目录，其中所有进程的TCP连接被重定向到该监听器，默认为 "+ebpf.DefaultCgroup)
+	ebpfPorts  = flag.String("ebpf-ports", "", "eBPF程序重定向的目标端口，逗号分隔，例如 80,443，默认重定向所有端口")
+	noMITM     = flag.Bool("no-mitm", false, "不解密TLS流量，所有CONNECT直接透传")
+	pinBypass  = flag.Bool("pinning-passthrough", false, "客户端疑似因证书固定拒绝代理的证书时，自动透传该主机")
+	caDir      = flag.String("ca-dir", "", "CA证书存储目录，默认为 ~/.sniffy")
+	keyLogFile = flag.String("keylog-file", os.Getenv("SSLKEYLOGFILE"), "TLS密钥日志文件路径，默认读取 SSLKEYLOGFILE 环境变量")
+	tlsProfile = flag.String("upstream-tls-profile", "", "连接上游时模拟的ClientHello (go, chrome, firefox, safari, ios, edge, randomized)")
+	recordFile = flag.String("record", "", "将所有流录制到磁带文件")
+	replayFile = flag.String("replay", "", "使用磁带文件中录制的响应回答请求，不访问网络")
+	capFilter  = flag.String("capture-filter", "", "捕获过滤表达式，只记录满足条件的流，例如 'host == api.example.com && status >= 400'")
+	redactAuth = flag.Bool("redact-defaults", false, "保存和导出流之前脱敏 Authorization、Proxy-Authorization、Cookie 和 Set-Cookie 头部")
+	detectKeys = flag.Bool("detect-credentials", false, "识别流中的 Bearer 令牌、API密钥、AWS SigV4 签名和 Basic 认证，添加 credential:<类型> 标签")
+	redactKeys = flag.Bool("redact-credentials", false, "脱敏检测到的凭据后再保存，同时启用 -detect-credentials")
+	apiSpec    = flag.String("openapi-spec", "", "检查流是否符合该 OpenAPI 3 规范文件，不符合的流标记为 openapi-violation")
+	sampleRate = flag.Float64("sample-rate", 1, "没有采样规则匹配时记录流的比例，取值0到1，例如0.05表示记录5%")
+	storeFile  = flag.String("store", "", "将流持久化到该数据库文件")
+	passFile   = flag.String("encrypt-passphrase-file", "", "用该文件中的口令加密流数据库、磁带和导出文件，并解密读取的文件")
+	memFlows   = flag.Int("memory-flows", 0, "内存中保留的最大流数量，0表示不限制")
+	memLimit   = flag.Int64("memory-limit", flow.DefaultMemoryLimit, "内存中的流占用的最大字节数，超出时先丢弃最早的流的内容，再丢弃最早的流，0表示不限制")
+	harFile    = flag.String("har", "", "退出时将捕获的流导出为HAR文件")
+	pcapngFile = flag.String("pcapng", "", "退出时将捕获的流导出为pcapng文件，可在Wireshark中分析")
+	saveSess   = flag.String("session", "", "退出时将捕获的流和配置保存为会话文件（.sniffy）")
+	archiveURL = flag.String("archive", "", "定期将新完成的流轮转为会话文件并上传到 s3://bucket/prefix，凭证从 AWS_ACCESS_KEY_ID 等环境变量读取")
+	archiveEP  = flag.String("archive-endpoint", "", "S3兼容存储的地址，例如 http://minio:9000，默认为 AWS S3")
+	archiveReg = flag.String("archive-region", "", "归档存储的区域，默认读取 AWS_REGION 环境变量或使用 us-east-1")
+	archiveDir = flag.String("archive-dir", "", "轮转的会话文件上传前保存的目录，上传失败的文件下次重试")
+	archiveInt = flag.Duration("archive-interval", archive.DefaultInterval, "会话文件轮转和上传的间隔")
+	archiveRet = flag.Duration("archive-retention", 0, "存储中的会话文件保留的时间，超过后删除，0表示永久保留")
+	keepLocal  = flag.Duration("archive-keep-local", 0, "上传后本地会话文件保留的时间，0表示上传后立即删除")
+	harReplay  = flag.String("har-replay", "", "启动后将HAR文件中的请求经由代理重放到真实服务器")
+	replayPass = flag.Bool("replay-passthrough", false, "回放时未录制的请求转发到上游")
+	ctrlAddr   = flag.String("control", "", "控制端口监听地址，提供REST API和Web界面，例如 127.0.0.1:8081 或 unix:/run/sniffy.sock，为空时不启用")
+	watchFiles = flag.Bool("watch", false, "监视脚本和规则文件，修改后自动重新加载")
+	addonOpen  = flag.Bool("addon-fail-open", false, "进程外插件不可用时放行流，默认中止流")
+	otlpAddr   = flag.String("otlp-endpoint", "", "将流作为追踪导出到OTLP/HTTP收集端，例如 http://localhost:4318")
+	streamURL  = flag.String("stream", "", "将完成的流发布到 kafka://broker:9092/topic 或 nats://host:4222/subject")
+	streamBody = flag.Bool("stream-bodies", false, "发布的流记录中包含捕获的消息体")
+	accessLog  = flag.String("access-log", "", "访问日志文件，每个结束的流一行，- 表示标准输出")
+	accessFmt  = flag.String("access-log-format", "combined", "访问日志格式 (common, combined, json)")
+	syslogURL  = flag.String("syslog", "", "以 RFC 5424 格式将访问日志发送到syslog服务器，例如 udp://host:514、tcp://host:514 或 tls://host:6514")
+	syslogFac  = flag.String("syslog-facility", "local0", "发送到syslog的设施 (user, daemon, local0 到 local7 等)")
+	logFormat  = flag.String("log-format", "text", "日志格式 (text, json)")
+	logLevel   = flag.String("log-level", "", "日志级别 (debug, info, warn, error)，默认为 info，指定 -v 时为 debug")
+	logFile    = flag.String("log-file", "", "日志文件路径，为空时写入标准错误")
+	logMaxSize = flag.Int("log-max-size", 0, "日志文件轮转大小（MB），0表示不轮转")
+	traceInj   = flag.Bool("trace-inject", false, "为没有 traceparent 的转发请求生成W3C追踪头部，流按追踪ID索引")
+	corrHeader = flag.String("correlation-header", "", "按该请求头部（如 X-Request-ID）的值索引流，与 -trace-inject 一起使用时为缺少的请求生成")
+	dupWindow  = flag.Duration("duplicate-window", 0, "方法、URL和请求体都相同的请求在该时间内重复出现时添加 duplicate 标签，0表示不检测")
+	statWindow = flag.Duration("stats-window", stats.DefaultWindow, "控制端口流量统计的滚动窗口，0表示不统计")
+	pprofOn    = flag.Bool("pprof", false, "在控制端口的 /debug/pprof/ 下提供 net/http/pprof 性能分析接口")
+	breakWait  = flag.Duration("breakpoint-timeout", 5*time.Minute, "断点暂停超时，超时后流自动继续，0表示一直等待")
+	stopWait   = flag.Duration("shutdown-timeout", 30*time.Second, "优雅关闭时等待正在处理的流完成的最长时间")
+	mapHosts   stringList
+	bypass     stringList
+	bypassALPN stringList
+	bypassFP   stringList
+	upstreamCA stringList
+	insecure   stringList
+	pins       stringList
+	clientCert stringList
+	breaks     stringList
+	mapLocal   stringList
+	mapRemote  stringList
+	headerRule stringList
+	bodyRule   stringList
+	tagRule    stringList
+	mockFiles  stringList
+	harMocks   stringList
+	scripts    stringList
+	addons     stringList
+	otlpHeader stringList
+	logLevels  stringList
+	dupIgnore  stringList
+	proxyUsers stringList
+	allowed    stringList
+	trustedPP  stringList
+	ctrlHosts  stringList
+	rateLimits stringList
+	throttles  stringList
+	faults     stringList
+	hostLimits stringList
+	samples    stringList
+	redactions stringList
+	encryptTo  stringList
+	sessions   stringList
+	identities stringList
+	pacHosts   stringList
+	listens    stringList
 )
 
 func main() {
+	flag.Var(&listens, "listen", "同时运行的命名监听器 name=host:port[,mode] 或 name=unix:path[,mode]，mode 为 auto、http、socks5 或 transparent，共享CA、存储和控制端口，可重复指定")
+	flag.Var(&mapHosts, "map-host", "静态主机映射 host=target，可重复指定")
+	flag.Var(&bypass, "passthrough", "不解密的SNI主机名，支持 *.example.com，可重复指定")
+	flag.Var(&bypassALPN, "passthrough-alpn", "客户端声明该ALPN协议时不解密，可重复指定")
+	flag.Var(&bypassFP, "passthrough-fingerprint", "客户端JA3/JA4指纹匹配时不解密，可重复指定")
+	flag.Var(&upstreamCA, "upstream-ca", "校验上游证书时额外信任的PEM根证书文件，可重复指定")
+	flag.Var(&insecure, "insecure-host", "跳过上游证书校验的主机，* 表示所有主机，可重复指定")
+	flag.Var(&pins, "pin", "上游公钥固定 host=sha256/<base64>，可重复指定")
+	flag.Var(&clientCert, "client-cert", "上游双向TLS客户端证书 host=cert.pem,key.pem 或 host=file.p12[,password]，可重复指定")
+	flag.Var(&breaks, "breakpoint", "断点规则 request|response:[METHOD ]host[/path]，可重复指定")
+	flag.Var(&mapLocal, "map-local", "使用本地文件响应 [METHOD ]host[/path]=path[,latency]，可重复指定")
+	flag.Var(&mapRemote, "map-remote", "改写上游地址 [METHOD ]host[/path]=url[,preserve-host]，可重复指定")
+	flag.Var(&headerRule, "header-rule", "头部改写规则 \"request|response add|set|remove host[/path]|~regex Name[: value]\"，可重复指定")
+	flag.Var(&bodyRule, "body-rule", "内容改写规则 \"request|response host[/path] s/find/replace/[li]\"，可重复指定")
+	flag.Var(&dupIgnore, "duplicate-ignore-param", "判断重复请求时忽略的查询参数，例如 _，可重复指定")
+	flag.Var(&tagRule, "tag-rule", "标签规则 tag=表达式，流结束时为匹配的流添加标签，例如 'slow=duration > 1s'，可重复指定")
+	flag.Var(&mockFiles, "mock-file", "模拟响应定义文件（JSON），可重复指定")
+	flag.Var(&harMocks, "har-mock", "使用HAR文件中的响应回答匹配的请求，可重复指定")
+	flag.Var(&sessions, "load-session", "启动时加载会话文件中的流，也可以是 .har、mitmproxy 的 .mitm/.flows、Charles 的 .chlsj 或 Fiddler 的 .saz 文件，可重复指定")
+	flag.Var(&addons, "addon", "进程外插件的gRPC地址 host:port，协议见 capture/addon/addon.proto，可重复指定")
+	flag.Var(&otlpHeader, "otlp-header", "追踪导出请求附带的头部 Name=value，可重复指定")
+	flag.Var(&proxyUsers, "proxy-user", "要求代理认证，允许的用户 user:password，可重复指定")
+	flag.Var(&allowed, "allow-client", "允许连接代理的客户端IP或CIDR，可重复指定")
+	flag.Var(&ctrlHosts, "control-host", "访问控制端口时允许使用的主机名，例如反向代理的域名，IP地址和 localhost 总是允许，可重复指定")
+	flag.Var(&trustedPP, "trusted-proxy", "允许发送PROXY protocol头部的对端IP或CIDR，使用 -accept-proxy-protocol 时必须指定，可重复指定")
+	flag.Var(&throttles, "throttle", "模拟网络条件 host=profile，profile 为 gprs、2g、edge、3g、3g-good、4g、dsl、wifi 或 down=1mbit,up=256kbit,latency=80ms,jitter=20ms，可重复指定")
+	flag.Var(&hostLimits, "host-timeout", "按主机覆盖超时 host=option=duration[,...]，例如 *.example.com=response-header=2m，可重复指定")
+	flag.Var(&samples, "sample-rule", "采样规则 rate:表达式，按顺序使用第一条匹配的规则，例如 '100%:status >= 500'，可重复指定")
+	flag.Var(&redactions, "redact", "脱敏规则 header|field|pattern|regex[/mask|remove|hash]:target，例如 field/hash:user.email 或 pattern:credit-card，可重复指定")
+	flag.Var(&encryptTo, "encrypt-to", "用 age 公钥 age1... 加密流数据库、磁带和导出文件，可重复指定")
+	flag.Var(&identities, "identity", "读取加密文件时使用的 age 身份文件，可重复指定")
+	flag.Var(&pacHosts, "pac-host", "控制端口的 /api/v1/proxy.pac 中经过代理的主机，支持 *.example.com，其余主机直接连接，可重复指定")
+	flag.Var(&faults, "chaos", "故障注入规则 [METHOD ]host[/path]=delay:500ms|delay:100ms-2s|status:503|reset[:bytes|%]|truncate[:bytes|%]|dns[,probability]，可重复指定")
+	flag.Var(&rateLimits, "rate-limit", "限流规则 client|host=pattern[,rps=N][,burst=N][,conns=N]，可重复指定")
+	flag.Var(&logLevels, "log-subsystem", "按子系统设置日志级别 subsystem=level，子系统为 main、proxy、tls、ca、storage，可重复指定")
+	flag.Var(&scripts, "script", "加载用户脚本（.js、.lua）或WebAssembly插件（.wasm），按指定顺序调用，可重复指定")
+	// 不启动代理的子命令
+	if code, ok := runSubcommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+	// sniffy console 以终端界面运行，日志显示在界面的事件日志中，sniffy serve 与不指定子命令相同
+	consoleMode := len(os.Args) > 1 && os.Args[1] == "console"
+	if consoleMode || (len(os.Args) > 1 && os.Args[1] == "serve") {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	flag.Usage = usage
 	flag.Parse()
+	checkNoArgs()
 
 	// 设置日志格式
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
 	log.Println("Starting sniffy-core...")
 
-	// 创建配置
-	config := DefaultConfig()
-	config.Address = *listenAddr
-	config.Port = *listenPort
-	config.EnableLogging = *verbose
-
-	// 验证配置
-	if err := config.Validate(); err != nil {
+	// 创建并验证配置
+	config, err := loadConfig()
+	if err != nil {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
+	sockets, err := inheritSockets(config)
+	if err != nil {
+		log.Fatalf("Failed to inherit systemd sockets: %v", err)
+	}
+
+	// 设置日志，log 包的输出也转发到 main 子系统
+	logs, err := config.NewLogging()
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	slog.SetDefault(logs.Subsystem(logging.SubsystemMain))
+	proxyLog := logging.NewPrintf(logs.Subsystem(logging.SubsystemProxy))
+	storageLog := logs.Subsystem(logging.SubsystemStorage)
+
+	// 创建数据包处理器
+	handler := capture.NewDefaultPacketHandler(config)
+	handler.SetLogger(proxyLog)
+	authenticator, err := config.NewAuth()
+	if err != nil {
+		log.Fatalf("Invalid proxy authentication: %v", err)
+	}
+	handler.SetAuth(authenticator)
+	limiter, err := config.NewRateLimiter()
+	if err != nil {
+		log.Fatalf("Invalid rate limit: %v", err)
+	}
+	handler.SetRateLimiter(limiter)
+	concurrency, capped := config.NewLimiter()
+	if capped {
+		log.Printf("Max connections %d exceeds the file descriptor limit, capping at %d", config.MaxConnections, concurrency.MaxConns())
+	}
+	handler.SetLimiter(concurrency)
+	faultInjector, err := config.NewChaos()
+	if err != nil {
+		log.Fatalf("Invalid chaos rule: %v", err)
+	}
+	handler.SetChaos(faultInjector)
+	limits, err := config.NewTimeouts()
+	if err != nil {
+		log.Fatalf("Invalid timeouts: %v", err)
+	}
+	if limits == nil {
+		// 重新加载配置时可以添加超时
+		limits = timeouts.New(timeouts.Timeouts{})
+	}
+	handler.SetTimeouts(limits)
+	upstreamDialer, err := config.NewDialer()
+	if err != nil {
+		log.Fatalf("Invalid upstream configuration: %v", err)
+	}
+	handler.SetDialer(upstreamDialer)
+	connPool := config.NewPool(upstreamDialer)
+	handler.SetPool(connPool)
+	bodyPolicy, err := config.NewBodyPolicy()
+	if err != nil {
+		log.Fatalf("Invalid body capture configuration: %v", err)
+	}
+	handler.SetBodyPolicy(bodyPolicy)
+	tlsPolicy := config.NewTLSPolicy()
+	var hostRules *tlsinfo.HostRules
+	if config.ControlAddress != "" || config.PinningPassthrough {
+		// 通过API和证书固定检测添加的拦截/透传规则优先于配置
+		hostRules = tlsinfo.NewHostRules()
+		if tlsPolicy != nil {
+			tlsPolicy = tlsinfo.Chain(hostRules.Policy(), tlsPolicy)
+		} else {
+			tlsPolicy = hostRules.Policy()
+		}
+	}
+	handler.SetTLSPolicy(tlsPolicy)
+	pinning := tlsinfo.NewPinning(nil)
+	if config.PinningPassthrough {
+		pinning = tlsinfo.NewPinning(hostRules)
+	}
+	handler.SetPinning(pinning)
+	breakpoints := config.NewBreakpoints()
+	if (consoleMode || config.ControlAddress != "") && breakpoints == nil {
+		// 终端界面和控制端口可以随时添加断点规则
+		breakpoints = breakpoint.NewManager()
+		breakpoints.SetTimeout(config.BreakpointTimeout)
+	}
+	handler.SetBreakpoints(breakpoints)
+	ruleEngine, err := config.NewRules()
+	if err != nil {
+		log.Fatalf("Invalid rule configuration: %v", err)
+	}
+	if ruleEngine == nil {
+		ruleEngine = rules.NewEngine()
+	}
+	handler.SetRules(ruleEngine)
+	// 有自己规则的命名监听器使用单独的规则引擎
+	listenerRules := make(map[string]*rules.Engine)
+	for _, l := range config.Listeners {
+		engine, err := l.NewRules()
+		if err != nil {
+			log.Fatalf("Invalid rule configuration: %v", err)
+		}
+		if engine != nil {
+			listenerRules[l.Name] = engine
+		}
+	}
+	scriptHooks, err := config.NewHooks()
+	if err != nil {
+		log.Fatalf("Failed to load addons: %v", err)
+	}
+	if scriptHooks == nil {
+		scriptHooks = hooks.NewChain()
+	}
+	handler.SetHooks(scriptHooks)
+	reload := &reloader{
+		load: func() (*Config, error) {
+			c, err := loadConfig()
+			if err == nil {
+				sockets.apply(c)
+			}
+			return c, err
+		},
+		config:    config.Clone(),
+		rules:     ruleEngine,
+		hooks:     scriptHooks,
+		dialer:    upstreamDialer,
+		timeouts:  limits,
+		logs:      logs,
+		listeners: listenerRules,
+	}
+
+	// 加载MITM使用的CA
+	authority, err := config.NewCA()
+	if err != nil {
+		log.Fatalf("Failed to load CA: %v", err)
+	}
+	if authority != nil {
+		handler.SetCA(authority)
+		logs.Subsystem(logging.SubsystemCA).Info("loaded MITM CA", "subject", authority.GetCA().Subject.CommonName, "expires", authority.GetCA().NotAfter)
+	}
+
+	// 打开TLS密钥日志
+	if config.KeyLogFile != "" {
+		keyLog, err := tlsinfo.OpenKeyLogFile(config.KeyLogFile)
+		if err != nil {
+			log.Fatalf("Failed to open key log file: %v", err)
+		}
+		defer keyLog.Close()
+		handler.SetKeyLogWriter(keyLog)
+		logs.Subsystem(logging.SubsystemTLS).Info("writing TLS key log", "file", config.KeyLogFile)
+	}
+
+	// 加密密钥
+	keys, err := config.NewKeys()
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	// 内存存储，加载的会话不受捕获过滤器影响，也不写入持久化存储
+	handler.GetFlowStore().SetLimit(config.MemoryFlows)
+	handler.GetFlowStore().SetMemoryLimit(config.MemoryLimit)
+	for _, path := range config.LoadSessions {
+		read, err := importFormat(path, "")
+		if err != nil {
+			log.Fatalf("Failed to load session: %v", err)
+		}
+		flows, err := loadFlows(keys, path, read)
+		if err != nil {
+			log.Fatalf("Failed to load session: %v", err)
+		}
+		for _, f := range flows {
+			handler.GetFlowStore().Add(f)
+		}
+		storageLog.Info("loaded session", "file", path, "flows", len(flows))
+	}
+
+	// 捕获过滤器
+	captureFilter, err := config.NewCaptureFilter()
+	if err != nil {
+		log.Fatalf("Invalid capture filter: %v", err)
+	}
+	sampler, err := config.NewSampler()
+	if err != nil {
+		log.Fatalf("Invalid sample rule: %v", err)
+	}
+	if captureFilter != nil || sampler != nil {
+		handler.GetFlowStore().SetFilter(func(f *flow.Flow) bool {
+			return captureFilter.Match(f) && sampler.Sample(f)
+		})
+	}
+
+	// 脱敏规则
+	redactor, err := config.NewRedactor()
+	if err != nil {
+		log.Fatalf("Invalid redaction rule: %v", err)
+	}
+	handler.SetRedactor(redactor)
+
+	// 凭据检测
+	handler.SetDetector(config.NewDetector())
+	handler.SetDuplicates(config.NewDuplicates())
+	handler.SetTracing(config.NewTracing())
+
+	// API规范检查
+	validator, err := config.NewValidator()
+	if err != nil {
+		log.Fatalf("Failed to load OpenAPI spec: %v", err)
+	}
+	handler.SetValidator(validator)
+
+	// 容器查找
+	containers, err := config.NewContainers()
+	if err != nil {
+		log.Fatalf("Invalid Docker host: %v", err)
+	}
+	handler.SetContainers(containers)
+	pod, err := config.NewPod()
+	if err != nil {
+		log.Fatalf("Failed to read pod labels: %v", err)
+	}
+	handler.SetPod(pod)
+	redirector, err := config.NewRedirector()
+	if err != nil {
+		log.Fatalf("Failed to attach eBPF programs: %v", err)
+	}
+	if redirector != nil {
+		defer redirector.Close()
+		log.Printf("Redirecting TCP connections in cgroup %s with eBPF", redirector.Cgroup())
+	}
+	handler.SetRedirector(redirector)
+
+	// 持久化存储
+	var flowDB *flowdb.DB
+	if config.StoreFile != "" {
+		flowDB, err = flowdb.OpenEncrypted(config.StoreFile, keys)
+		if err != nil {
+			log.Fatalf("Failed to open flow database: %v", err)
+		}
+		handler.GetFlowStore().OnAdd(flowDB.Add)
+		// 保存通过API修改的标签和备注
+		handler.GetFlowStore().OnUpdate(flowDB.Add)
+		storageLog.Info("storing flows", "file", config.StoreFile, "encrypted", flowDB.Encrypted())
+	}
+
+	// 录制磁带，加密的磁带在退出时写入最后一个数据块
+	var recorder *cassette.Recorder
+	if config.RecordCassette != "" {
+		file, err := keys.Create(config.RecordCassette)
+		if err != nil {
+			log.Fatalf("Failed to open cassette: %v", err)
+		}
+		recorder = cassette.NewRecorder(file)
+		handler.GetFlowStore().OnAdd(recorder.Add)
+		storageLog.Info("recording flows", "file", config.RecordCassette, "encrypted", keys.Enabled())
+	}
+
+	// 访问日志，记录所有结束的流，不受捕获过滤器影响
+	if config.AccessLog != "" {
+		access, err := accesslog.Open(config.AccessLog, config.AccessLogFormat)
+		if err != nil {
+			log.Fatalf("Failed to open access log: %v", err)
+		}
+		defer access.Close()
+		handler.GetEvents().OnFinished(access.Add)
+		storageLog.Info("writing access log", "file", config.AccessLog, "format", config.AccessLogFormat)
+	}
+	if config.Syslog != "" {
+		syslog, err := accesslog.DialSyslog(config.Syslog, config.AccessLogFormat, config.SyslogFacility)
+		if err != nil {
+			log.Fatalf("Failed to connect to syslog: %v", err)
+		}
+		defer syslog.Close()
+		handler.GetEvents().OnFinished(syslog.Add)
+		storageLog.Info("sending access log to syslog", "address", config.Syslog, "facility", config.SyslogFacility)
+	}
+
+	// 导出追踪
+	tracer, err := config.NewOTLPExporter()
+	if err != nil {
+		log.Fatalf("Failed to create OTLP exporter: %v", err)
+	}
+	if tracer != nil {
+		handler.GetFlowStore().OnAdd(tracer.Add)
+		handler.GetFlowStore().OnFlush(tracer.Flush)
+		log.Printf("Exporting flow traces to %s", config.OTLPEndpoint)
+	}
+
+	// 发布完成的流
+	stream, err := config.NewSink()
+	if err != nil {
+		log.Fatalf("Failed to create flow sink: %v", err)
+	}
+	if stream != nil {
+		handler.GetFlowStore().OnAdd(stream.Add)
+		handler.GetFlowStore().OnFlush(stream.Flush)
+		log.Printf("Publishing flows to %s", stripUserinfo(config.StreamURL))
+	}
+
+	// 归档会话文件
+	archiver, err := config.NewArchiver(keys)
+	if err != nil {
+		log.Fatalf("Failed to create session archiver: %v", err)
+	}
+	if archiver != nil {
+		handler.GetFlowStore().OnAdd(archiver.Add)
+		log.Printf("Archiving sessions to %s every %v", config.ArchiveURL, config.ArchiveInterval)
+	}
+
+	// 监视脚本和规则文件
+	if files := config.WatchedFiles(); config.Watch && len(files) > 0 {
+		watcher := watch.New(files, time.Second, func(changed []string) {
+			log.Printf("Reloading after changes to %s", strings.Join(changed, ", "))
+			reload.Files()
+		})
+		go watcher.Run(context.Background())
+		log.Printf("Watching %d script and rule files for changes", len(files))
+	}
 
 	// 创建TCP监听器
-	listener := capture.NewTCPListener(config)
+	trustedProxies, err := config.NewTrustedProxies()
+	if err != nil {
+		log.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+	listener := capture.NewTCPListenerWithHandler(config, handler)
+	listener.SetLogger(proxyLog)
+	listener.SetTrustedProxies(trustedProxies)
+	if sockets.proxy != nil {
+		listener.UseListener(sockets.proxy)
+	}
 
 	// 启动TCP监听器
 	if err := listener.Start(); err != nil {
 		log.Fatalf("Failed to start TCP listener: %v", err)
 	}
 
+	// 启动命名监听器，共享主处理器的CA、存储和其他组件
+	listeners := []*capture.TCPListener{listener}
+	for _, l := range config.Listeners {
+		h, err := handler.ForListener(l.Name, l.Mode, listenerRules[l.Name])
+		if err != nil {
+			log.Fatalf("Failed to create listener %s: %v", l.Name, err)
+		}
+		lc, err := config.NewListenerConfig(l)
+		if err != nil {
+			log.Fatalf("Failed to create listener %s: %v", l.Name, err)
+		}
+		named := capture.NewTCPListenerWithHandler(lc, h)
+		named.SetLogger(proxyLog)
+		named.SetTrustedProxies(trustedProxies)
+		if ln := sockets.listeners[l.Name]; ln != nil {
+			named.UseListener(ln)
+		}
+		if err := named.Start(); err != nil {
+			log.Fatalf("Failed to start listener %s: %v", l.Name, err)
+		}
+		log.Printf("Listener %s (%s) is running on %s", l.Name, cmp.Or(l.Mode, "auto"), named.GetAddress())
+		listeners = append(listeners, named)
+	}
+
 	// 监听系统信号
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// SIGHUP 重新加载配置
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	status := "Proxying on " + listener.GetAddress()
+	go func() {
+		for range reloadChan {
+			notifySystemd(systemd.Reloading())
+			reload.Config()
+			notifySystemd(systemd.Ready(status))
+		}
+	}()
+
 	log.Printf("sniffy-core is running on %s", config.GetListenAddress())
 	log.Println("Press Ctrl+C to stop...")
 
+	// 启动终端界面，退出界面时关闭代理
+	if consoleMode {
+		ui := console.New(handler.GetFlowStore(), breakpoints)
+		replayer, err := config.NewReplayer(authority)
+		if err != nil {
+			log.Fatalf("Failed to create replayer: %v", err)
+		}
+		ui.SetReplayer(replayer)
+		logs.SetOutput(ui)
+		go func() {
+			err := ui.Run(context.Background(), os.Stdin, os.Stdout)
+			logs.SetOutput(os.Stderr)
+			if err != nil {
+				log.Fatalf("Console failed: %v", err)
+			}
+			signalChan <- syscall.SIGINT
+		}()
+	}
+
+	// 启动控制端口
+	var controlListener net.Listener
+	if config.ControlAddress != "" {
+		control := api.New(handler.GetFlowStore())
+		control.SetAllowedHosts(config.AllowedControlHosts())
+		replayer, err := config.NewReplayer(authority)
+		if err != nil {
+			log.Fatalf("Failed to create replayer: %v", err)
+		}
+		control.SetReplayer(replayer)
+		control.SetDialer(upstreamDialer)
+		control.SetBreakpoints(breakpoints)
+		control.SetHostRules(hostRules)
+		control.SetPinning(pinning)
+		control.SetSessionConfig(config.SessionConfig())
+		control.SetEvents(handler.GetEvents())
+		control.SetPool(connPool)
+		control.SetLimiter(concurrency)
+		control.SetSampler(sampler)
+		control.SetReload(func() (api.ReloadResult, error) {
+			restart, err := reload.Config()
+			return api.ReloadResult{Restart: restart}, err
+		})
+		// 流量统计不受捕获过滤器和采样影响
+		if config.StatsWindow > 0 {
+			traffic := stats.New(config.StatsWindow)
+			handler.GetEvents().OnFinished(traffic.Add)
+			control.SetStats(traffic)
+		}
+		if authority != nil {
+			control.SetCA(authority)
+		}
+		proxyPAC, err := config.NewPAC()
+		if err != nil {
+			log.Fatalf("Failed to create PAC file: %v", err)
+		}
+		control.SetPAC(proxyPAC)
+		board := dashboard.New(control)
+		bridge := cdp.New(handler.GetFlowStore(), handler.GetEvents())
+		for _, pattern := range cdp.Patterns {
+			board.Handle(pattern, bridge)
+		}
+		if config.Pprof {
+			board.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
+			board.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+			board.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+			board.Handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+			board.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+		}
+		controlListener = sockets.control
+		if controlListener == nil {
+			if controlListener, err = capture.Listen(config.ControlAddress); err != nil {
+				log.Fatalf("Failed to start control server: %v", err)
+			}
+		}
+		go func() {
+			if err := http.Serve(controlListener, board); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Fatalf("Control server failed: %v", err)
+			}
+		}()
+		if path, ok := capture.SocketPath(config.ControlAddress); ok {
+			log.Printf("Dashboard and API are available on unix socket %s, e.g. curl --unix-socket %s http://sniffy/api/v1/flows", path, path)
+		} else {
+			log.Printf("Dashboard and API are available at http://%s", config.ControlAddress)
+			log.Printf("Chrome DevTools can attach at devtools://devtools/bundled/inspector.html?ws=%s/devtools/page/%s", config.ControlAddress, cdp.TargetID)
+		}
+	}
+
+	// 重放HAR中的请求
+	if config.HARReplayFile != "" {
+		flows, err := loadFlows(keys, config.HARReplayFile, har.Read)
+		if err != nil {
+			log.Fatalf("Failed to load HAR: %v", err)
+		}
+		replayer, err := config.NewReplayer(authority)
+		if err != nil {
+			log.Fatalf("Failed to create replayer: %v", err)
+		}
+		go replayFlows(replayer, flows)
+	}
+
+	// 通知systemd服务已就绪，启用看门狗时定期报告所有监听器仍在运行
+	notifySystemd(systemd.Ready(status))
+	go systemd.Watchdog(context.Background(), func() bool {
+		for _, l := range listeners {
+			if !l.IsRunning() {
+				return false
+			}
+		}
+		return true
+	})
+
 	// 等待关闭信号
 	<-signalChan
 
 	log.Println("Received shutdown signal, gracefully shutting down...")
+	notifySystemd(systemd.Stopping())
 
-	// 创建关闭超时context
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// 停止接受新连接，等待正在处理的流完成，超时后强制关闭
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
 	defer shutdownCancel()
+	if err := shutdownListeners(shutdownCtx, listeners); err != nil {
+		log.Println("Shutdown timeout exceeded, closed remaining connections")
+	} else {
+		log.Println("Shutdown completed")
+	}
+	connPool.Close()
+	// 关闭控制端口，删除 unix 套接字文件
+	if controlListener != nil {
+		controlListener.Close()
+	}
 
-	// 在goroutine中执行关闭操作
-	shutdownComplete := make(chan struct{})
-	go func() {
-		defer close(shutdownComplete)
+	// 导出HAR
+	if config.HARFile != "" {
+		if err := writeFlows(keys, config.HARFile, handler.GetFlowStore().List(), har.Write); err != nil {
+			storageLog.Error("failed to write HAR", "file", config.HARFile, "error", err)
+		} else {
+			storageLog.Info("wrote HAR", "file", config.HARFile, "flows", handler.GetFlowStore().Len())
+		}
+	}
+	if config.SessionFile != "" {
+		if err := saveSession(keys, config.SessionFile, config.SessionConfig(), handler.GetFlowStore().List()); err != nil {
+			storageLog.Error("failed to write session", "file", config.SessionFile, "error", err)
+		} else {
+			storageLog.Info("wrote session", "file", config.SessionFile, "flows", handler.GetFlowStore().Len())
+		}
+	}
+	if config.PcapngFile != "" {
+		if err := writeFlows(keys, config.PcapngFile, handler.GetFlowStore().List(), pcapng.Write); err != nil {
+			storageLog.Error("failed to write pcapng", "file", config.PcapngFile, "error", err)
+		} else {
+			storageLog.Info("wrote pcapng", "file", config.PcapngFile, "flows", handler.GetFlowStore().Len())
+		}
+	}
 
-		// 停止TCP监听器
-		if err := listener.Stop(); err != nil {
-			log.Printf("Error stopping TCP listener: %v", err)
+	if tracer != nil {
+		if err := tracer.Close(); err != nil {
+			log.Printf("Failed to export traces: %v", err)
 		}
+	}
 
-		log.Println("All services stopped successfully")
-	}()
+	if stream != nil {
+		if err := stream.Close(); err != nil {
+			log.Printf("Failed to publish flows: %v", err)
+		}
+	}
 
-	// 等待关闭完成或超时
-	select {
-	case <-shutdownComplete:
-		log.Println("Shutdown completed")
-	case <-shutdownCtx.Done():
-		log.Println("Shutdown timeout exceeded, force exiting")
+	if archiver != nil {
+		archiveCtx, archiveCancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+		if err := archiver.Close(archiveCtx); err != nil {
+			log.Printf("Failed to archive sessions: %v", err)
+		}
+		archiveCancel()
 	}
 
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			storageLog.Error("failed to close cassette", "error", err)
+		}
+	}
+
+	if flowDB != nil {
+		if err := flowDB.Close(); err != nil {
+			storageLog.Error("failed to close flow database", "error", err)
+		}
+	}
+
+	// 删除保存超长内容的临时文件
+	if bodyPolicy != nil && bodyPolicy.SpillDir != "" {
+		os.RemoveAll(bodyPolicy.SpillDir)
+	}
+
+	logs.Close()
+
 	os.Exit(0)
 }
+
+// loadConfig 创建并验证配置，依次用命令行参数的默认值、配置文件、SNIFFY_ 环境变量和显式指定的命令行参数覆盖默认配置。
+// 重新加载配置时再次调用
+func loadConfig() (*Config, error) {
+	config := DefaultConfig()
+	if err := applyFlags(config, nil); err != nil {
+		return nil, err
+	}
+	if *configFile != "" {
+		if err := config.LoadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.ApplyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if err := applyFlags(config, explicit); err != nil {
+		return nil, err
+	}
+	if *verbose && config.LogLevel == "" {
+		config.LogLevel = "debug"
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyFlags 将命令行参数写入配置，only 不为nil时只写入其中显式指定的参数
+func applyFlags(config *Config, only map[string]bool) error {
+	setFlag(only, "addr", &config.Address, *listenAddr)
+	setFlag(only, "port", &config.Port, *listenPort)
+	var named []ListenerConfig
+	for _, l := range listens {
+		lc, err := ParseListener(l)
+		if err != nil {
+			return err
+		}
+		named = append(named, lc)
+	}
+	setFlag(only, "listen", &config.Listeners, named)
+	setFlag(only, "v", &config.EnableLogging, *verbose)
+	setList(only, "map-host", &config.HostMappings, mapHosts)
+	setFlag(only, "dns", &config.DNSServer, *dnsServer)
+	setFlag(only, "accept-proxy-protocol", &config.AcceptProxyProtocol, *acceptPP)
+	setList(only, "trusted-proxy", &config.TrustedProxies, trustedPP)
+	setFlag(only, "upstream-proxy-protocol", &config.UpstreamProxyProtocol, *upstreamPP)
+	setFlag(only, "upstream-proxy", &config.UpstreamProxy, *upstream)
+	setFlag(only, "ignore-proxy-env", &config.IgnoreProxyEnv, *noEnvProxy)
+	setFlag(only, "upstream-auth", &config.UpstreamProxyAuth, *upAuth)
+	setFlag(only, "timeouts", &config.Timeouts, *timeoutOpt)
+	setList(only, "host-timeout", &config.HostTimeouts, hostLimits)
+	setFlag(only, "pool-max-idle", &config.PoolMaxIdle, *poolIdle)
+	setFlag(only, "pool-idle-timeout", &config.PoolIdleTimeout, *poolWait)
+	setFlag(only, "upstream-h2", &config.UpstreamHTTP2, *upstreamH2)
+	setFlag(only, "max-conns", &config.MaxConnections, *maxConns)
+	setFlag(only, "max-origin-requests", &config.MaxOriginRequests, *maxOrigin)
+	setFlag(only, "body-limit", &config.BodyLimit, *bodyLimit)
+	setFlag(only, "body-spill-dir", &config.BodySpillDir, *bodySpill)
+	setFlag(only, "process-lookup", &config.ProcessLookup, *procLookup)
+	setFlag(only, "docker", &config.Docker, *dockerOn)
+	setFlag(only, "docker-host", &config.DockerHost, *dockerHost)
+	setFlag(only, "ebpf-cgroup", &config.EBPFCgroup, *ebpfCgroup)
+	setFlag(only, "ebpf-ports", &config.EBPFPorts, *ebpfPorts)
+	setFlag(only, "no-mitm", &config.MITM, !*noMITM)
+	setFlag(only, "ca-dir", &config.CADir, *caDir)
+	setList(only, "passthrough", &config.PassthroughHosts, bypass)
+	setList(only, "passthrough-alpn", &config.PassthroughALPN, bypassALPN)
+	setList(only, "passthrough-fingerprint", &config.PassthroughFingerprints, bypassFP)
+	setFlag(only, "pinning-passthrough", &config.PinningPassthrough, *pinBypass)
+	setFlag(only, "upstream-tls-profile", &config.UpstreamTLSProfile, *tlsProfile)
+	setFlag(only, "keylog-file", &config.KeyLogFile, *keyLogFile)
+	setList(only, "upstream-ca", &config.UpstreamCAFiles, upstreamCA)
+	setList(only, "insecure-host", &config.InsecureHosts, insecure)
+	setList(only, "pin", &config.Pins, pins)
+	setList(only, "breakpoint", &config.Breakpoints, breaks)
+	setFlag(only, "breakpoint-timeout", &config.BreakpointTimeout, *breakWait)
+	setFlag(only, "shutdown-timeout", &config.ShutdownTimeout, *stopWait)
+	setList(only, "map-local", &config.MapLocal, mapLocal)
+	setList(only, "map-remote", &config.MapRemote, mapRemote)
+	setList(only, "header-rule", &config.HeaderRules, headerRule)
+	setList(only, "body-rule", &config.BodyRules, bodyRule)
+	setList(only, "tag-rule", &config.TagRules, tagRule)
+	setList(only, "mock-file", &config.MockFiles, mockFiles)
+	setFlag(only, "record", &config.RecordCassette, *recordFile)
+	setFlag(only, "replay", &config.ReplayCassette, *replayFile)
+	setFlag(only, "replay-passthrough", &config.ReplayPassthrough, *replayPass)
+	setFlag(only, "capture-filter", &config.CaptureFilter, *capFilter)
+	setFlag(only, "sample-rate", &config.SampleRate, *sampleRate)
+	setList(only, "sample-rule", &config.SampleRules, samples)
+	setList(only, "redact", &config.Redact, redactions)
+	setFlag(only, "redact-defaults", &config.RedactDefaults, *redactAuth)
+	setFlag(only, "detect-credentials", &config.DetectCredentials, *detectKeys)
+	setFlag(only, "trace-inject", &config.TraceInject, *traceInj)
+	setFlag(only, "correlation-header", &config.CorrelationHeader, *corrHeader)
+	setFlag(only, "duplicate-window", &config.DuplicateWindow, *dupWindow)
+	setList(only, "duplicate-ignore-param", &config.DuplicateIgnoreParams, dupIgnore)
+	setFlag(only, "redact-credentials", &config.RedactCredentials, *redactKeys)
+	setFlag(only, "openapi-spec", &config.OpenAPISpec, *apiSpec)
+	setFlag(only, "store", &config.StoreFile, *storeFile)
+	setList(only, "encrypt-to", &config.EncryptRecipients, encryptTo)
+	setFlag(only, "encrypt-passphrase-file", &config.EncryptPassphraseFile, *passFile)
+	setList(only, "identity", &config.IdentityFiles, identities)
+	setFlag(only, "memory-flows", &config.MemoryFlows, *memFlows)
+	setFlag(only, "memory-limit", &config.MemoryLimit, *memLimit)
+	setFlag(only, "har", &config.HARFile, *harFile)
+	setFlag(only, "pcapng", &config.PcapngFile, *pcapngFile)
+	setFlag(only, "session", &config.SessionFile, *saveSess)
+	setList(only, "load-session", &config.LoadSessions, sessions)
+	setFlag(only, "archive", &config.ArchiveURL, *archiveURL)
+	setFlag(only, "archive-endpoint", &config.ArchiveEndpoint, *archiveEP)
+	setFlag(only, "archive-region", &config.ArchiveRegion, *archiveReg)
+	setFlag(only, "archive-dir", &config.ArchiveDir, *archiveDir)
+	setFlag(only, "archive-interval", &config.ArchiveInterval, *archiveInt)
+	setFlag(only, "archive-retention", &config.ArchiveRetention, *archiveRet)
+	setFlag(only, "archive-keep-local", &config.ArchiveKeepLocal, *keepLocal)
+	setList(only, "har-mock", &config.HARMockFiles, harMocks)
+	setFlag(only, "har-replay", &config.HARReplayFile, *harReplay)
+	setList(only, "script", &config.Scripts, scripts)
+	setList(only, "addon", &config.Addons, addons)
+	setFlag(only, "addon-fail-open", &config.AddonFailOpen, *addonOpen)
+	setFlag(only, "watch", &config.Watch, *watchFiles)
+	setFlag(only, "control", &config.ControlAddress, *ctrlAddr)
+	setList(only, "control-host", &config.ControlHosts, ctrlHosts)
+	setFlag(only, "stats-window", &config.StatsWindow, *statWindow)
+	setFlag(only, "pprof", &config.Pprof, *pprofOn)
+	setList(only, "pac-host", &config.PACHosts, pacHosts)
+	setFlag(only, "otlp-endpoint", &config.OTLPEndpoint, *otlpAddr)
+	setList(only, "otlp-header", &config.OTLPHeaders, otlpHeader)
+	setFlag(only, "stream", &config.StreamURL, *streamURL)
+	setFlag(only, "stream-bodies", &config.StreamBodies, *streamBody)
+	setList(only, "proxy-user", &config.ProxyUsers, proxyUsers)
+	setList(only, "allow-client", &config.AllowedClients, allowed)
+	setList(only, "rate-limit", &config.RateLimits, rateLimits)
+	setList(only, "throttle", &config.Throttle, throttles)
+	setList(only, "chaos", &config.Chaos, faults)
+	setFlag(only, "access-log", &config.AccessLog, *accessLog)
+	setFlag(only, "access-log-format", &config.AccessLogFormat, *accessFmt)
+	setFlag(only, "syslog", &config.Syslog, *syslogURL)
+	setFlag(only, "syslog-facility", &config.SyslogFacility, *syslogFac)
+	setFlag(only, "log-format", &config.LogFormat, *logFormat)
+	setFlag(only, "log-level", &config.LogLevel, *logLevel)
+	setList(only, "log-subsystem", &config.LogLevels, logLevels)
+	setFlag(only, "log-file", &config.LogFile, *logFile)
+	setFlag(only, "log-max-size", &config.LogMaxSize, *logMaxSize)
+	var certs []ClientCertConfig
+	for _, c := range clientCert {
+		cc, err := ParseClientCert(c)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cc)
+	}
+	setFlag(only, "client-cert", &config.ClientCerts, certs)
+	return nil
+}
+
+// setFlag 在 only 为nil或包含 name 时将参数的值写入 dst
+func setFlag[T any](only map[string]bool, name string, dst *T, v T) {
+	if only == nil || only[name] {
+		*dst = v
+	}
+}
+
+// setList 与 setFlag 相同，用于可重复指定的参数
+func setList(only map[string]bool, name string, dst *[]string, v stringList) {
+	setFlag(only, name, dst, []string(v))
+}
+
+// notifySystemd 记录通知systemd失败的错误，服务继续运行
+func notifySystemd(err error) {
+	if err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
+}
+
+// shutdownListeners 同时关闭所有监听器，任一监听器超时时返回错误
+func shutdownListeners(ctx context.Context, listeners []*capture.TCPListener) error {
+	errs := make([]error, len(listeners))
+	var wg sync.WaitGroup
+	for i, l := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = l.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// replayFlows 按顺序重放流，重放结果记录为新流
+func replayFlows(replayer *replay.Replayer, flows []*flow.Flow) {
+	for _, f := range flows {
+		result, err := replayer.Replay(context.Background(), f, nil)
+		if err != nil {
+			log.Printf("Replay %s %s failed: %v", f.Request.Method, f.Request.URL, err)
+			continue
+		}
+		log.Printf("Replayed %s %s: %s (flow %s)", f.Request.Method, f.Request.URL, result.Response.Status, result.FlowID)
+	}
+	log.Printf("Replayed %d requests", len(flows))
+}
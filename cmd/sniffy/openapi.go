@@ -0,0 +1,148 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/openapi"
+)
+
+const openapiUsage = `用法:
+  sniffy openapi [选项] -store DB      由流数据库中的流生成 OpenAPI 3 文档
+  sniffy openapi [选项] -file FILE     由会话或其他工具的捕获文件生成文档
+  sniffy openapi -check SPEC -store DB 检查流是否符合 OpenAPI 规范，存在问题时退出码为1
+`
+
+// runOpenAPI 执行 sniffy openapi 子命令，返回进程退出码
+func runOpenAPI(args []string) int {
+	fs := newFlowFlags("openapi")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, openapiUsage)
+		fs.PrintDefaults()
+	}
+	expr := fs.String("filter", "", "只使用满足过滤表达式的流，例如 host == api.example.com")
+	output := fs.String("o", "", "输出文件，默认输出到标准输出")
+	var opts openapi.Options
+	fs.StringVar(&opts.Title, "title", "", "文档标题，默认使用唯一的主机名")
+	fs.StringVar(&opts.Version, "version", "", "API版本，默认为 1.0.0")
+	check := fs.String("check", "", "检查流是否符合该 OpenAPI 规范文件（JSON或YAML），而不是生成文档")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *check != "" {
+		if err := checkOpenAPI(fs, *expr, *check, *output); err != nil {
+			fmt.Fprintf(os.Stderr, "sniffy openapi: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if err := generateOpenAPI(fs, *expr, *output, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy openapi: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func generateOpenAPI(fs *flowFlags, expr, output string, opts openapi.Options) error {
+	flows, err := filteredFlows(fs, expr)
+	if err != nil {
+		return err
+	}
+	return writeJSON(output, openapi.Generate(flows, opts))
+}
+
+// checkOpenAPI 输出不符合规范的流和问题，存在问题时返回错误
+func checkOpenAPI(fs *flowFlags, expr, spec, output string) error {
+	v, err := openapi.LoadValidator(spec)
+	if err != nil {
+		return err
+	}
+	flows, err := filteredFlows(fs, expr)
+	if err != nil {
+		return err
+	}
+	w, closeOutput, err := openOutput(output)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	bad := 0
+	for i, f := range flows {
+		violations := v.Validate(f)
+		if len(violations) == 0 {
+			continue
+		}
+		bad++
+		// 导入的流没有保存的ID，使用 sniffy curl -file 接受的序号
+		id := f.ID
+		if *fs.file != "" {
+			id = strconv.Itoa(i + 1)
+		}
+		fmt.Fprintf(w, "%s %s %s\n", id, f.Request.Method, f.Request.URL)
+		for _, p := range violations {
+			if p.Location != "" {
+				fmt.Fprintf(w, "  %s %s: %s\n", p.Kind, p.Location, p.Message)
+			} else {
+				fmt.Fprintf(w, "  %s: %s\n", p.Kind, p.Message)
+			}
+		}
+	}
+	if bad > 0 {
+		return fmt.Errorf("%d of %d flows violate %s", bad, len(flows), spec)
+	}
+	return nil
+}
+
+// filteredFlows 读取满足过滤表达式的流
+func filteredFlows(fs *flowFlags, expr string) ([]*flow.Flow, error) {
+	if fs.NArg() != 0 {
+		return nil, errors.New("unexpected arguments, use -store or -file")
+	}
+	var fl *filter.Filter
+	if expr != "" {
+		var err error
+		if fl, err = filter.Compile(expr); err != nil {
+			return nil, err
+		}
+	}
+	return fs.flows(fl)
+}
+
+// openOutput 打开输出文件，未指定时使用标准输出
+func openOutput(output string) (io.Writer, func() error, error) {
+	if output == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, file.Close, nil
+}
+
+// writeJSON 将 v 以缩进的JSON写入文件，path 为空时输出到标准输出
+func writeJSON(path string, v any) error {
+	w, closeOutput, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		closeOutput()
+		return err
+	}
+	return closeOutput()
+}
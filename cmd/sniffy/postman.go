@@ -0,0 +1,54 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/f-dong/sniffy/capture/postman"
+)
+
+const postmanUsage = `用法:
+  sniffy postman [选项] -store DB      将流数据库中的流导出为 Postman 集合
+  sniffy postman [选项] -file FILE     将会话或其他工具的捕获文件导出为集合
+`
+
+// runPostman 执行 sniffy postman 子命令，返回进程退出码
+func runPostman(args []string) int {
+	fs := newFlowFlags("postman")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, postmanUsage)
+		fs.PrintDefaults()
+	}
+	expr := fs.String("filter", "", "只导出满足过滤表达式的流，例如 host == api.example.com")
+	output := fs.String("o", "", "集合文件，默认输出到标准输出")
+	env := fs.String("env", "", "将主机地址和令牌变量写入该 Postman 环境文件，集合中只保留变量名")
+	var opts postman.Options
+	fs.StringVar(&opts.Name, "name", "", "集合名称，默认使用唯一的主机名")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := exportPostman(fs, *expr, *output, *env, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy postman: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func exportPostman(fs *flowFlags, expr, output, env string, opts postman.Options) error {
+	flows, err := filteredFlows(fs, expr)
+	if err != nil {
+		return err
+	}
+	c := postman.Export(flows, opts)
+	if env != "" {
+		if err := writeJSON(env, c.SplitEnvironment()); err != nil {
+			return err
+		}
+	}
+	return writeJSON(output, c)
+}
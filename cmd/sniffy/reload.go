@@ -0,0 +1,158 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/dialer"
+	"github.com/f-dong/sniffy/capture/hooks"
+	"github.com/f-dong/sniffy/capture/logging"
+	"github.com/f-dong/sniffy/capture/rules"
+	"github.com/f-dong/sniffy/capture/timeouts"
+)
+
+// hookCloseDelay 重新加载后关闭旧钩子前的等待时间，让正在执行的调用完成
+const hookCloseDelay = 30 * time.Second
+
+// reloadable 可以在运行时重新加载的配置项的 yaml 键，其余配置项修改后需要重启
+var reloadable = map[string]bool{
+	// 规则
+	"map_local": true, "map_remote": true, "header_rules": true, "body_rules": true, "tag_rules": true,
+	"mock_files": true, "har_mock_files": true, "replay_cassette": true, "replay_passthrough": true,
+	// 脚本和插件
+	"scripts": true, "addons": true, "addon_fail_open": true,
+	// 上游
+	"host_mappings": true, "dns_server": true, "upstream_proxy_protocol": true, "upstream_proxy": true,
+	"upstream_proxy_auth": true, "ignore_proxy_env": true, "throttle": true, "timeouts": true, "host_timeouts": true,
+	"upstream_tls_profile": true, "upstream_ca_files": true, "insecure_hosts": true, "pins": true, "client_certs": true,
+	// 日志级别
+	"log_level": true, "log_levels": true,
+}
+
+// reloader 重新加载配置并原子地替换规则、脚本、上游拨号器、超时和日志级别。
+// 新配置的任一部分无效时保留当前配置，已建立的连接不受影响。
+// SIGHUP、控制端口和文件监视触发的重新加载依次执行
+type reloader struct {
+	mu   sync.Mutex
+	load func() (*Config, error)
+
+	// config 当前生效的配置，需要重启的配置项保持启动时的值
+	config *Config
+
+	rules    *rules.Engine
+	hooks    *hooks.Chain
+	dialer   *dialer.Dialer
+	timeouts *timeouts.Policy
+	logs     *logging.Logging
+
+	// listeners 有自己规则的命名监听器的规则引擎，监听器本身修改后需要重启
+	listeners map[string]*rules.Engine
+}
+
+// Files 按当前配置重新加载规则和脚本文件
+func (r *reloader) Files() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.apply(r.config); err != nil {
+		log.Printf("Reload failed, keeping current rules and scripts: %v", err)
+		return
+	}
+	log.Println("Reloaded rules and scripts")
+}
+
+// Config 重新读取配置文件，应用可以在运行时修改的配置项，返回已修改但需要重启才能生效的配置项
+func (r *reloader) Config() ([]string, error) {
+	next, err := r.load()
+	if err != nil {
+		log.Printf("Reload failed, keeping current configuration: %v", err)
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.apply(next); err != nil {
+		log.Printf("Reload failed, keeping current configuration: %v", err)
+		return nil, err
+	}
+	var restart []string
+	current, updated := reflect.ValueOf(r.config).Elem(), reflect.ValueOf(next).Elem()
+	for key, field := range yamlFields(current.Type()) {
+		old, value := current.FieldByIndex(field.Index), updated.FieldByIndex(field.Index)
+		switch {
+		case reloadable[key]:
+			old.Set(value)
+		case !reflect.DeepEqual(old.Interface(), value.Interface()):
+			restart = append(restart, key)
+		}
+	}
+	sort.Strings(restart)
+	log.Println("Reloaded configuration")
+	if len(restart) > 0 {
+		log.Printf("Changes to %s require a restart", strings.Join(restart, ", "))
+	}
+	return restart, nil
+}
+
+// apply 按配置创建所有组件后再依次替换，创建失败时不修改当前配置
+func (r *reloader) apply(c *Config) error {
+	engine, err := c.NewRules()
+	if err != nil {
+		return err
+	}
+	// 命名监听器按启动时的配置重新加载规则文件
+	named := make(map[string]*rules.Engine)
+	for _, l := range r.config.Listeners {
+		if r.listeners[l.Name] == nil {
+			continue
+		}
+		e, err := l.NewRules()
+		if err != nil {
+			return err
+		}
+		named[l.Name] = e
+	}
+	d, err := c.NewDialer()
+	if err != nil {
+		return err
+	}
+	limits, err := c.NewTimeouts()
+	if err != nil {
+		return err
+	}
+	opts, err := c.logOptions()
+	if err != nil {
+		return err
+	}
+	// 插件在创建时连接，最后创建
+	chain, err := c.NewHooks()
+	if err != nil {
+		return err
+	}
+
+	r.rules.Replace(engine)
+	for name, e := range named {
+		r.listeners[name].Replace(e)
+	}
+	r.dialer.Replace(d)
+	r.timeouts.Replace(limits)
+	r.logs.SetLevels(opts.Level, opts.Levels)
+	old := r.hooks.Replace(chain)
+	time.AfterFunc(hookCloseDelay, func() {
+		for _, h := range old {
+			if c, ok := h.(io.Closer); ok {
+				c.Close()
+			}
+		}
+	})
+	return nil
+}
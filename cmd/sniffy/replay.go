@@ -0,0 +1,100 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+const replayUsage = `用法:
+  sniffy replay [选项] -store DB [ID...]   经由运行中的代理重放流数据库中的请求，未指定ID时重放满足 -filter 的所有流
+  sniffy replay [选项] -file FILE [ID|N...]  重放会话、HAR或其他工具的捕获文件中的请求
+重放的请求经过代理的规则和断点，并记录为新流
+`
+
+// runReplay 执行 sniffy replay 子命令，返回进程退出码
+func runReplay(args []string) int {
+	fs := newFlowFlags("replay")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, replayUsage)
+		fs.PrintDefaults()
+	}
+	proxy := fs.String("proxy", "127.0.0.1:8080", "运行中的代理地址 host:port")
+	caDir := fs.String("ca-dir", "", "代理使用的CA所在的目录，默认为 ~/.sniffy")
+	user := fs.String("proxy-user", "", "代理要求认证时使用的用户 user:password")
+	expr := fs.String("filter", "", "未指定ID时只重放满足过滤表达式的流，例如 method == POST")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	failed, err := replayRequests(fs, *proxy, *caDir, *user, *expr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy replay: %v\n", err)
+		return 1
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// replayRequests 依次重放选中的流，返回失败的数量
+func replayRequests(fs *flowFlags, proxy, caDir, user, expr string) (int, error) {
+	host, port, err := net.SplitHostPort(proxy)
+	if err != nil {
+		return 0, fmt.Errorf("invalid proxy address %q: %w", proxy, err)
+	}
+	config := fs.config
+	config.Address = host
+	if config.Port, err = strconv.Atoi(port); err != nil {
+		return 0, fmt.Errorf("invalid proxy address %q", proxy)
+	}
+	if user != "" {
+		config.ProxyUsers = []string{user}
+	}
+
+	if (*fs.store == "") == (*fs.file == "") {
+		return 0, errors.New("exactly one of -store or -file is required")
+	}
+	var flows []*flow.Flow
+	if fs.NArg() > 0 {
+		flows, err = fs.findFlows(fs.Args())
+	} else {
+		flows, err = filteredFlows(fs, expr)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	authority, err := loadCA(caDir)
+	if err != nil {
+		return 0, err
+	}
+	replayer, err := config.NewReplayer(authority)
+	if err != nil {
+		return 0, err
+	}
+	failed := 0
+	for _, f := range flows {
+		if f.Request == nil {
+			continue
+		}
+		result, err := replayer.Replay(context.Background(), f, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", f.Request.Method, f.Request.URL, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s %s: %s (flow %s)\n", f.Request.Method, f.Request.URL, result.Response.Status, result.FlowID)
+	}
+	return failed, nil
+}
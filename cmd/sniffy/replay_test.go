@@ -0,0 +1,116 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/flowdb"
+)
+
+// --- 辅助函数 ---
+
+// replayProxy 记录收到的代理请求的测试代理，只接受 http 请求，拒绝 CONNECT
+type replayProxy struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (p *replayProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		http.Error(w, "no tunnels", http.StatusMethodNotAllowed)
+		return
+	}
+	origin, _, _ := strings.Cut(r.Header.Get(flow.ReplayHeader), " ")
+	p.mu.Lock()
+	p.requests = append(p.requests, strings.Join([]string{r.Method, r.URL.String(), origin, r.Header.Get("Proxy-Authorization")}, " "))
+	p.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Requests 返回收到的请求
+func (p *replayProxy) Requests() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.requests...)
+}
+
+// replayStore 创建保存了 flows 的流数据库
+func replayStore(t *testing.T, flows ...*flow.Flow) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "flows.db")
+	db, err := flowdb.Open(path)
+	require.NoError(t, err)
+	for _, f := range flows {
+		require.NoError(t, db.Put(f))
+	}
+	require.NoError(t, db.Close())
+	return path
+}
+
+// replayFlow 返回测试用的流
+func replayFlow(id, method, url string) *flow.Flow {
+	return &flow.Flow{ID: id, Request: &flow.Request{Method: method, URL: url, Header: http.Header{}}}
+}
+
+// --- 测试代码 ---
+
+func TestRunReplay(t *testing.T) {
+	proxy := &replayProxy{}
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+	store := replayStore(t,
+		replayFlow("a", "GET", "http://example.com/users"),
+		replayFlow("b", "POST", "http://example.com/users"),
+		replayFlow("c", "POST", "https://example.com/login"),
+	)
+	args := []string{"-store", store, "-proxy", srv.Listener.Addr().String(), "-ca-dir", t.TempDir()}
+
+	// 按ID重放，经由代理发送并携带代理认证
+	require.Equal(t, 0, runReplay(append(args, "-proxy-user", "alice:secret", "b", "a")))
+	require.Equal(t, []string{
+		"POST http://example.com/users b Basic YWxpY2U6c2VjcmV0",
+		"GET http://example.com/users a Basic YWxpY2U6c2VjcmV0",
+	}, proxy.Requests())
+
+	// 未指定ID时重放满足过滤条件的流，失败的请求使退出码为1
+	proxy.requests = nil
+	require.Equal(t, 1, runReplay(append(args, "-filter", "method == POST")))
+	require.Equal(t, []string{"POST http://example.com/users b "}, proxy.Requests())
+}
+
+func TestReplayRequests_Errors(t *testing.T) {
+	store := replayStore(t, replayFlow("a", "GET", "http://example.com/"))
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"bad proxy", []string{"-proxy", "127.0.0.1", "-store", store}, "invalid proxy address"},
+		{"bad port", []string{"-proxy", "127.0.0.1:http", "-store", store}, "invalid proxy address"},
+		{"no input", []string{"-proxy", "127.0.0.1:8080"}, "exactly one of -store or -file is required"},
+		{"unknown flow", []string{"-proxy", "127.0.0.1:8080", "-store", store, "missing"}, "flow not found"},
+		{"bad filter", []string{"-proxy", "127.0.0.1:8080", "-store", store, "-filter", "method =="}, "unexpected end of expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFlowFlags("replay")
+			proxy := fs.String("proxy", "", "")
+			expr := fs.String("filter", "", "")
+			require.NoError(t, fs.Parse(tt.args))
+			_, err := replayRequests(fs, *proxy, t.TempDir(), "", *expr)
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
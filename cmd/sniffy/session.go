@@ -0,0 +1,279 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/f-dong/sniffy/capture/charles"
+	"github.com/f-dong/sniffy/capture/curl"
+	"github.com/f-dong/sniffy/capture/fiddler"
+	"github.com/f-dong/sniffy/capture/filter"
+	"github.com/f-dong/sniffy/capture/flow"
+	"github.com/f-dong/sniffy/capture/flowdb"
+	"github.com/f-dong/sniffy/capture/har"
+	"github.com/f-dong/sniffy/capture/mitmproxy"
+	"github.com/f-dong/sniffy/capture/seal"
+	"github.com/f-dong/sniffy/capture/session"
+)
+
+const sessionUsage = `用法:
+  sniffy session info [选项] FILE                  显示会话的元数据和流统计
+  sniffy session export [选项] -store DB FILE      将流数据库中的流导出为会话文件
+  sniffy session import [选项] -store DB FILE...   将会话文件中的流导入流数据库，
+                                                  也可以导入HAR、mitmproxy、Charles、Fiddler 的文件和 curl 命令
+`
+
+// importFormats 可以导入的文件格式
+var importFormats = map[string]func(io.Reader) ([]*flow.Flow, error){
+	"session":   session.Read,
+	"har":       har.Read,
+	"mitmproxy": mitmproxy.Read,
+	"charles":   charles.Read,
+	"fiddler":   fiddler.Read,
+	"curl":      curl.Read,
+}
+
+// importFormat 返回文件的格式，format 为空时按扩展名判断，未知的扩展名视为会话文件
+func importFormat(path, format string) (func(io.Reader) ([]*flow.Flow, error), error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".har":
+			format = "har"
+		case ".mitm", ".flows", ".mitmproxy":
+			format = "mitmproxy"
+		case ".chlsj", ".chls":
+			format = "charles"
+		case ".saz":
+			format = "fiddler"
+		case ".curl":
+			format = "curl"
+		default:
+			format = "session"
+		}
+	}
+	read, ok := importFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+	return read, nil
+}
+
+// sessionFlags 会话子命令共用的选项
+type sessionFlags struct {
+	*flag.FlagSet
+	config *Config
+	store  *string
+	filter *string
+	format *string
+	meta   stringList
+}
+
+func newSessionFlags(name string) *sessionFlags {
+	fs := &sessionFlags{FlagSet: flag.NewFlagSet("sniffy session "+name, flag.ContinueOnError), config: DefaultConfig()}
+	fs.store = fs.String("store", "", "流数据库文件")
+	fs.filter = fs.String("filter", "", "只处理满足过滤表达式的流")
+	fs.format = fs.String("format", "", "导入的文件格式 (session, har, mitmproxy, charles, fiddler, curl)，默认按扩展名判断")
+	fs.StringVar(&fs.config.EncryptPassphraseFile, "encrypt-passphrase-file", "", "加密和解密使用的口令文件")
+	fs.Var((*stringList)(&fs.config.EncryptRecipients), "encrypt-to", "用 age 公钥加密写入的文件，可重复指定")
+	fs.Var((*stringList)(&fs.config.IdentityFiles), "identity", "读取加密文件时使用的 age 身份文件，可重复指定")
+	fs.Var(&fs.meta, "meta", "导出时写入的元数据 key=value，可重复指定")
+	return fs
+}
+
+// runSession 执行 sniffy session 子命令，返回进程退出码
+func runSession(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, sessionUsage)
+		return 2
+	}
+	fs := newSessionFlags(args[0])
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "info":
+		err = fs.info(os.Stdout)
+	case "export":
+		err = fs.export(os.Stdout)
+	case "import":
+		err = fs.importFiles(os.Stdout)
+	default:
+		fmt.Fprint(os.Stderr, sessionUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy session %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// info 显示会话头部、流数量和主要的主机
+func (fs *sessionFlags) info(out io.Writer) error {
+	if fs.NArg() != 1 {
+		return errors.New("exactly one session file is required")
+	}
+	keys, err := fs.config.NewKeys()
+	if err != nil {
+		return err
+	}
+	file, err := keys.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r, err := session.NewReader(file)
+	if err != nil {
+		return err
+	}
+	h := r.Header()
+	fmt.Fprintf(out, "format:  %s v%d\n", h.Format, h.Version)
+	fmt.Fprintf(out, "created: %s\n", h.Created.Format(time.RFC3339))
+	for _, k := range slices.Sorted(maps.Keys(h.Meta)) {
+		fmt.Fprintf(out, "%s: %s\n", k, h.Meta[k])
+	}
+
+	var count int
+	var first, last time.Time
+	hosts := map[string]int{}
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		count++
+		if first.IsZero() || f.StartTime.Before(first) {
+			first = f.StartTime
+		}
+		if f.StartTime.After(last) {
+			last = f.StartTime
+		}
+		if f.Request != nil {
+			hosts[f.Request.Host]++
+		}
+	}
+	fmt.Fprintf(out, "flows:   %d\n", count)
+	if count > 0 {
+		fmt.Fprintf(out, "span:    %s - %s\n", first.Format(time.RFC3339), last.Format(time.RFC3339))
+	}
+	names := slices.SortedFunc(maps.Keys(hosts), func(a, b string) int {
+		return cmp.Or(hosts[b]-hosts[a], strings.Compare(a, b))
+	})
+	for _, host := range names[:min(len(names), 10)] {
+		fmt.Fprintf(out, "  %6d  %s\n", hosts[host], host)
+	}
+	return nil
+}
+
+// export 将流数据库中的流导出为会话文件
+func (fs *sessionFlags) export(out io.Writer) error {
+	if fs.NArg() != 1 || *fs.store == "" {
+		return errors.New("-store and exactly one session file are required")
+	}
+	keys, err := fs.config.NewKeys()
+	if err != nil {
+		return err
+	}
+	q := flowdb.Query{}
+	if *fs.filter != "" {
+		if q.Filter, err = filter.Compile(*fs.filter); err != nil {
+			return err
+		}
+	}
+	meta := map[string]string{}
+	for _, m := range fs.meta {
+		k, v, ok := strings.Cut(m, "=")
+		if !ok {
+			return fmt.Errorf("invalid metadata %q, want key=value", m)
+		}
+		meta[k] = v
+	}
+
+	db, err := flowdb.OpenEncrypted(*fs.store, keys)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	flows, err := db.Query(q)
+	if err != nil {
+		return err
+	}
+	err = writeFlows(keys, fs.Arg(0), flows, func(w io.Writer, flows []*flow.Flow) error {
+		return session.Save(w, &session.Session{Header: session.Header{Meta: meta}, Flows: flows})
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "exported %d flows to %s\n", len(flows), fs.Arg(0))
+	return nil
+}
+
+// importFiles 将会话或其他工具的捕获文件中的流导入流数据库，已存在的流被覆盖
+func (fs *sessionFlags) importFiles(out io.Writer) error {
+	if fs.NArg() == 0 || *fs.store == "" {
+		return errors.New("-store and at least one session file are required")
+	}
+	keys, err := fs.config.NewKeys()
+	if err != nil {
+		return err
+	}
+	var fl *filter.Filter
+	if *fs.filter != "" {
+		if fl, err = filter.Compile(*fs.filter); err != nil {
+			return err
+		}
+	}
+	db, err := flowdb.OpenEncrypted(*fs.store, keys)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	for _, path := range fs.Args() {
+		n, err := importSession(db, keys, path, *fs.format, fl)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "imported %d flows from %s\n", n, path)
+	}
+	return nil
+}
+
+func importSession(db *flowdb.DB, keys *seal.Keys, path, format string, fl *filter.Filter) (int, error) {
+	read, err := importFormat(path, format)
+	if err != nil {
+		return 0, err
+	}
+	flows, err := loadFlows(keys, path, read)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	var n int
+	for _, f := range flows {
+		if !fl.Match(f) {
+			continue
+		}
+		if err := db.Put(f); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,470 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const proxyUsage = `用法:
+  sniffy proxy enable [选项]   把系统的HTTP和HTTPS代理设置为运行中的代理，并保存原来的设置
+  sniffy proxy disable [选项]  恢复 enable 之前的系统代理设置
+支持 macOS (networksetup)、Windows (注册表，-winhttp 时同时设置 WinHTTP) 和 GNOME (gsettings)
+`
+
+// runProxy 执行 sniffy proxy 子命令，返回进程退出码
+func runProxy(args []string) int {
+	if len(args) == 0 || (args[0] != "enable" && args[0] != "disable") {
+		fmt.Fprint(os.Stderr, proxyUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("sniffy proxy "+args[0], flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, proxyUsage)
+		fs.PrintDefaults()
+	}
+	proxy := fs.String("proxy", "127.0.0.1:8080", "运行中的代理地址 host:port")
+	bypass := fs.String("bypass", "localhost,127.0.0.1", "不经过代理的主机，逗号分隔")
+	state := fs.String("state", "", "保存原来设置的文件，默认为 ~/.sniffy/system-proxy.json")
+	winHTTP := fs.Bool("winhttp", false, "Windows 上同时设置 WinHTTP 代理，需要管理员权限")
+	dryRun := fs.Bool("dry-run", false, "只输出要执行的命令，不修改设置")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	sp, err := newSystemProxy(runtime.GOOS, runCommand, *winHTTP)
+	if err == nil && *state == "" {
+		*state, err = defaultProxyState()
+	}
+	if err == nil {
+		if args[0] == "enable" {
+			err = enableProxy(sp, *proxy, splitList(*bypass), *state, *dryRun, os.Stdout)
+		} else {
+			err = disableProxy(sp, *state, *dryRun, os.Stdout)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy proxy %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// systemProxy 一种系统代理设置的读取和修改命令
+type systemProxy interface {
+	// current 读取当前的设置，用于 disable 时恢复
+	current() (map[string]string, error)
+	// enable 返回把代理设置为 host:port 的命令
+	enable(host, port string, bypass []string) ([][]string, error)
+	// restore 返回恢复 saved 的命令，saved 为nil时关闭代理
+	restore(saved map[string]string) ([][]string, error)
+}
+
+// commandRunner 执行命令并返回标准输出
+type commandRunner func(args ...string) (string, error)
+
+// runCommand 执行命令，出错时包含命令的错误输出
+func runCommand(args ...string) (string, error) {
+	out, err := exec.Command(args[0], args[1:]...).Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && len(exit.Stderr) > 0 {
+			return "", fmt.Errorf("%s: %s", args[0], strings.TrimSpace(string(exit.Stderr)))
+		}
+		return "", fmt.Errorf("%s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// newSystemProxy 返回 goos 上的系统代理设置
+func newSystemProxy(goos string, run commandRunner, winHTTP bool) (systemProxy, error) {
+	switch goos {
+	case "darwin":
+		return &macProxy{run: run}, nil
+	case "windows":
+		return &windowsProxy{run: run, winHTTP: winHTTP}, nil
+	case "linux", "freebsd", "openbsd":
+		if _, err := exec.LookPath("gsettings"); err == nil {
+			return &gnomeProxy{run: run}, nil
+		}
+		return nil, errors.New("no supported system proxy settings found (gsettings), set HTTP_PROXY and HTTPS_PROXY instead")
+	}
+	return nil, fmt.Errorf("system proxy settings are not supported on %s", goos)
+}
+
+// defaultProxyState 返回保存原来设置的默认文件
+func defaultProxyState() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".sniffy", "system-proxy.json"), nil
+}
+
+// enableProxy 保存当前设置后把系统代理设置为 proxy。
+// 已经保存过设置时不覆盖，重复执行 enable 后 disable 仍然恢复最初的设置
+func enableProxy(sp systemProxy, proxy string, bypass []string, state string, dryRun bool, out io.Writer) error {
+	host, port, err := net.SplitHostPort(proxy)
+	if err != nil {
+		return fmt.Errorf("invalid proxy address %q: %w", proxy, err)
+	}
+	if _, err := os.Stat(state); errors.Is(err, fs.ErrNotExist) {
+		saved, err := sp.current()
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(saved, "", "  ")
+		if err != nil {
+			return err
+		}
+		if !dryRun {
+			if err := os.MkdirAll(filepath.Dir(state), 0o700); err != nil {
+				return err
+			}
+			if err := os.WriteFile(state, data, 0o600); err != nil {
+				return err
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+	cmds, err := sp.enable(host, port, bypass)
+	if err != nil {
+		return err
+	}
+	if err := runCommands(cmds, dryRun, out); err != nil {
+		return err
+	}
+	if !dryRun {
+		fmt.Fprintf(out, "System proxy set to %s, run sniffy proxy disable to restore\n", proxy)
+	}
+	return nil
+}
+
+// disableProxy 恢复保存的设置，没有保存的设置时关闭系统代理
+func disableProxy(sp systemProxy, state string, dryRun bool, out io.Writer) error {
+	var saved map[string]string
+	data, err := os.ReadFile(state)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		fmt.Fprintf(out, "No saved settings in %s, turning the system proxy off\n", state)
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return fmt.Errorf("invalid saved settings %s: %w", state, err)
+		}
+	}
+	cmds, err := sp.restore(saved)
+	if err != nil {
+		return err
+	}
+	if err := runCommands(cmds, dryRun, out); err != nil {
+		return err
+	}
+	if dryRun || saved == nil {
+		return nil
+	}
+	fmt.Fprintln(out, "System proxy settings restored")
+	return os.Remove(state)
+}
+
+// runCommands 依次输出并执行命令，dryRun 时只输出
+func runCommands(cmds [][]string, dryRun bool, out io.Writer) error {
+	for _, args := range cmds {
+		fmt.Fprintln(out, commandLine(args))
+		if dryRun {
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout, cmd.Stderr = out, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+	}
+	return nil
+}
+
+// commandLine 返回可以复制到shell执行的命令
+func commandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " '\"\\;*<>[]") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// macProxy macOS 每个网络服务的 Web 和安全 Web 代理，由 networksetup 设置
+type macProxy struct {
+	run commandRunner
+}
+
+// macProxyKinds networksetup 的代理类型
+var macProxyKinds = []string{"web", "secureweb"}
+
+// services 返回启用的网络服务，第一行是说明，禁用的服务以 * 开头
+func (m *macProxy) services() ([]string, error) {
+	out, err := m.run("networksetup", "-listallnetworkservices")
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for i, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		line = strings.TrimSpace(line)
+		if i == 0 || line == "" || strings.HasPrefix(line, "*") {
+			continue
+		}
+		services = append(services, line)
+	}
+	if len(services) == 0 {
+		return nil, errors.New("no enabled network services")
+	}
+	return services, nil
+}
+
+// current 保存的键为 "类型 字段 服务"，例如 "web Server Wi-Fi"，绕过列表的类型为 bypass
+func (m *macProxy) current() (map[string]string, error) {
+	services, err := m.services()
+	if err != nil {
+		return nil, err
+	}
+	saved := make(map[string]string)
+	for _, svc := range services {
+		for _, kind := range macProxyKinds {
+			out, err := m.run("networksetup", "-get"+kind+"proxy", svc)
+			if err != nil {
+				return nil, err
+			}
+			for _, line := range strings.Split(out, "\n") {
+				field, value, ok := strings.Cut(line, ":")
+				if field = strings.TrimSpace(field); ok && (field == "Enabled" || field == "Server" || field == "Port") {
+					saved[kind+" "+field+" "+svc] = strings.TrimSpace(value)
+				}
+			}
+		}
+		out, err := m.run("networksetup", "-getproxybypassdomains", svc)
+		if err != nil {
+			return nil, err
+		}
+		// 没有设置时输出一行说明
+		if !strings.Contains(out, "aren't any") {
+			saved["bypass Domains "+svc] = strings.Join(strings.Fields(out), " ")
+		}
+	}
+	return saved, nil
+}
+
+func (m *macProxy) enable(host, port string, bypass []string) ([][]string, error) {
+	services, err := m.services()
+	if err != nil {
+		return nil, err
+	}
+	var cmds [][]string
+	for _, svc := range services {
+		for _, kind := range macProxyKinds {
+			cmds = append(cmds,
+				[]string{"networksetup", "-set" + kind + "proxy", svc, host, port},
+				[]string{"networksetup", "-set" + kind + "proxystate", svc, "on"})
+		}
+		if len(bypass) > 0 {
+			cmds = append(cmds, append([]string{"networksetup", "-setproxybypassdomains", svc}, bypass...))
+		}
+	}
+	return cmds, nil
+}
+
+func (m *macProxy) restore(saved map[string]string) ([][]string, error) {
+	services, err := m.services()
+	if err != nil {
+		return nil, err
+	}
+	var cmds [][]string
+	for _, svc := range services {
+		for _, kind := range macProxyKinds {
+			prefix := kind + " "
+			if server, port := saved[prefix+"Server "+svc], saved[prefix+"Port "+svc]; server != "" && port != "" && port != "0" {
+				cmds = append(cmds, []string{"networksetup", "-set" + kind + "proxy", svc, server, port})
+			}
+			state := "off"
+			if saved[prefix+"Enabled "+svc] == "Yes" {
+				state = "on"
+			}
+			cmds = append(cmds, []string{"networksetup", "-set" + kind + "proxystate", svc, state})
+		}
+		if saved == nil {
+			continue
+		}
+		domains := strings.Fields(saved["bypass Domains "+svc])
+		if len(domains) == 0 {
+			domains = []string{"Empty"}
+		}
+		cmds = append(cmds, append([]string{"networksetup", "-setproxybypassdomains", svc}, domains...))
+	}
+	return cmds, nil
+}
+
+// windowsProxy Windows 当前用户的 Internet 设置，浏览器和 WinINet 程序使用，
+// winHTTP 时把 WinHTTP 的代理同步为 Internet 设置
+type windowsProxy struct {
+	run     commandRunner
+	winHTTP bool
+}
+
+// windowsInternetSettings Internet 设置的注册表键
+const windowsInternetSettings = `HKCU\Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+// windowsProxyValues 保存和恢复的注册表值及其类型
+var windowsProxyValues = []struct{ name, kind string }{
+	{"ProxyEnable", "REG_DWORD"},
+	{"ProxyServer", "REG_SZ"},
+	{"ProxyOverride", "REG_SZ"},
+}
+
+// current 保存存在的注册表值，不存在的值在恢复时删除
+func (w *windowsProxy) current() (map[string]string, error) {
+	saved := make(map[string]string)
+	for _, v := range windowsProxyValues {
+		out, err := w.run("reg", "query", windowsInternetSettings, "/v", v.name)
+		if err != nil {
+			// 值不存在时 reg query 失败
+			continue
+		}
+		// 输出的值行为 "    ProxyEnable    REG_DWORD    0x1"
+		for _, line := range strings.Split(out, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == v.name && fields[1] == v.kind {
+				saved[v.name] = strings.Join(fields[2:], " ")
+			}
+		}
+	}
+	return saved, nil
+}
+
+func (w *windowsProxy) enable(host, port string, bypass []string) ([][]string, error) {
+	values := map[string]string{
+		"ProxyEnable":   "1",
+		"ProxyServer":   net.JoinHostPort(host, port),
+		"ProxyOverride": strings.Join(append(append([]string(nil), bypass...), "<local>"), ";"),
+	}
+	var cmds [][]string
+	for _, v := range windowsProxyValues {
+		cmds = append(cmds, []string{"reg", "add", windowsInternetSettings, "/v", v.name, "/t", v.kind, "/d", values[v.name], "/f"})
+	}
+	return w.syncWinHTTP(cmds), nil
+}
+
+func (w *windowsProxy) restore(saved map[string]string) ([][]string, error) {
+	if saved == nil {
+		return w.syncWinHTTP([][]string{{"reg", "add", windowsInternetSettings, "/v", "ProxyEnable", "/t", "REG_DWORD", "/d", "0", "/f"}}), nil
+	}
+	var cmds [][]string
+	for _, v := range windowsProxyValues {
+		value, ok := saved[v.name]
+		switch {
+		case !ok && v.name == "ProxyEnable":
+			cmds = append(cmds, []string{"reg", "add", windowsInternetSettings, "/v", v.name, "/t", v.kind, "/d", "0", "/f"})
+		case !ok:
+			cmds = append(cmds, []string{"reg", "delete", windowsInternetSettings, "/v", v.name, "/f"})
+		default:
+			if v.kind == "REG_DWORD" {
+				// reg query 以十六进制输出 DWORD
+				n, err := strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid saved %s %q", v.name, value)
+				}
+				value = strconv.FormatUint(n, 10)
+			}
+			cmds = append(cmds, []string{"reg", "add", windowsInternetSettings, "/v", v.name, "/t", v.kind, "/d", value, "/f"})
+		}
+	}
+	return w.syncWinHTTP(cmds), nil
+}
+
+// syncWinHTTP 在修改 Internet 设置之后把 WinHTTP 的代理同步为 Internet 设置
+func (w *windowsProxy) syncWinHTTP(cmds [][]string) [][]string {
+	if !w.winHTTP {
+		return cmds
+	}
+	return append(cmds, []string{"netsh", "winhttp", "import", "proxy", "source=ie"})
+}
+
+// gnomeProxy GNOME 的代理设置，GNOME 应用和读取 gsettings 的浏览器使用
+type gnomeProxy struct {
+	run commandRunner
+}
+
+// gnomeProxyKeys 保存和恢复的 gsettings 键，格式为 "schema key"
+var gnomeProxyKeys = []string{
+	"org.gnome.system.proxy mode",
+	"org.gnome.system.proxy ignore-hosts",
+	"org.gnome.system.proxy.http host",
+	"org.gnome.system.proxy.http port",
+	"org.gnome.system.proxy.https host",
+	"org.gnome.system.proxy.https port",
+}
+
+// current 保存 gsettings get 输出的 GVariant 文本，gsettings set 可以直接使用
+func (g *gnomeProxy) current() (map[string]string, error) {
+	saved := make(map[string]string)
+	for _, key := range gnomeProxyKeys {
+		out, err := g.run(append([]string{"gsettings", "get"}, strings.Fields(key)...)...)
+		if err != nil {
+			return nil, err
+		}
+		saved[key] = strings.TrimSpace(out)
+	}
+	return saved, nil
+}
+
+func (g *gnomeProxy) enable(host, port string, bypass []string) ([][]string, error) {
+	hosts := make([]string, len(bypass))
+	for i, h := range bypass {
+		hosts[i] = strconv.Quote(h)
+	}
+	values := map[string]string{
+		"org.gnome.system.proxy mode":         strconv.Quote("manual"),
+		"org.gnome.system.proxy ignore-hosts": "[" + strings.Join(hosts, ", ") + "]",
+		"org.gnome.system.proxy.http host":    strconv.Quote(host),
+		"org.gnome.system.proxy.http port":    port,
+		"org.gnome.system.proxy.https host":   strconv.Quote(host),
+		"org.gnome.system.proxy.https port":   port,
+	}
+	// 先设置地址再切换模式，避免应用短暂地使用不完整的设置
+	var cmds [][]string
+	for i := len(gnomeProxyKeys) - 1; i >= 0; i-- {
+		key := gnomeProxyKeys[i]
+		cmds = append(cmds, append(append([]string{"gsettings", "set"}, strings.Fields(key)...), values[key]))
+	}
+	return cmds, nil
+}
+
+func (g *gnomeProxy) restore(saved map[string]string) ([][]string, error) {
+	if saved == nil {
+		return [][]string{{"gsettings", "set", "org.gnome.system.proxy", "mode", strconv.Quote("none")}}, nil
+	}
+	var cmds [][]string
+	for i := len(gnomeProxyKeys) - 1; i >= 0; i-- {
+		key := gnomeProxyKeys[i]
+		if value, ok := saved[key]; ok {
+			cmds = append(cmds, append(append([]string{"gsettings", "set"}, strings.Fields(key)...), value))
+		}
+	}
+	return cmds, nil
+}
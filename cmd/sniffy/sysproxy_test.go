@@ -0,0 +1,222 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// fakeRunner 按命令行返回预设输出的 commandRunner，没有预设的命令返回错误
+func fakeRunner(outputs map[string]string) commandRunner {
+	return func(args ...string) (string, error) {
+		out, ok := outputs[strings.Join(args, " ")]
+		if !ok {
+			return "", errors.New("exit status 1")
+		}
+		return out, nil
+	}
+}
+
+// macOutputs 有 Wi-Fi 和禁用的 Ethernet 两个网络服务，Wi-Fi 的 Web 代理已启用
+var macOutputs = map[string]string{
+	"networksetup -listallnetworkservices":      "An asterisk (*) denotes that a network service is disabled.\nWi-Fi\n*Ethernet\n",
+	"networksetup -getwebproxy Wi-Fi":           "Enabled: Yes\nServer: corp.example.com\nPort: 3128\nAuthenticated Proxy Enabled: 0\n",
+	"networksetup -getsecurewebproxy Wi-Fi":     "Enabled: No\nServer: \nPort: 0\nAuthenticated Proxy Enabled: 0\n",
+	"networksetup -getproxybypassdomains Wi-Fi": "*.local\n169.254/16\n",
+}
+
+// windowsOutputs ProxyEnable 和 ProxyServer 存在，ProxyOverride 不存在
+var windowsOutputs = map[string]string{
+	`reg query ` + windowsInternetSettings + ` /v ProxyEnable`: "\r\n" + windowsInternetSettings + "\r\n    ProxyEnable    REG_DWORD    0x1\r\n\r\n",
+	`reg query ` + windowsInternetSettings + ` /v ProxyServer`: "\r\n" + windowsInternetSettings + "\r\n    ProxyServer    REG_SZ    corp.example.com:3128\r\n\r\n",
+}
+
+// gnomeOutputs gsettings get 的输出
+var gnomeOutputs = map[string]string{
+	"gsettings get org.gnome.system.proxy mode":         "'none'\n",
+	"gsettings get org.gnome.system.proxy ignore-hosts": "['localhost', '127.0.0.0/8']\n",
+	"gsettings get org.gnome.system.proxy.http host":    "''\n",
+	"gsettings get org.gnome.system.proxy.http port":    "0\n",
+	"gsettings get org.gnome.system.proxy.https host":   "''\n",
+	"gsettings get org.gnome.system.proxy.https port":   "0\n",
+}
+
+// commandLines 把命令转换为便于比较的命令行
+func commandLines(cmds [][]string) []string {
+	lines := make([]string, len(cmds))
+	for i, args := range cmds {
+		lines[i] = strings.Join(args, " ")
+	}
+	return lines
+}
+
+// --- 测试代码 ---
+
+func TestSystemProxy(t *testing.T) {
+	reg := windowsInternetSettings
+	tests := []struct {
+		name     string
+		proxy    systemProxy
+		current  map[string]string
+		enable   []string
+		restore  []string
+		disabled []string
+	}{
+		{
+			name:  "macos",
+			proxy: &macProxy{run: fakeRunner(macOutputs)},
+			current: map[string]string{
+				"web Enabled Wi-Fi":       "Yes",
+				"web Server Wi-Fi":        "corp.example.com",
+				"web Port Wi-Fi":          "3128",
+				"secureweb Enabled Wi-Fi": "No",
+				"secureweb Server Wi-Fi":  "",
+				"secureweb Port Wi-Fi":    "0",
+				"bypass Domains Wi-Fi":    "*.local 169.254/16",
+			},
+			enable: []string{
+				"networksetup -setwebproxy Wi-Fi 127.0.0.1 8080",
+				"networksetup -setwebproxystate Wi-Fi on",
+				"networksetup -setsecurewebproxy Wi-Fi 127.0.0.1 8080",
+				"networksetup -setsecurewebproxystate Wi-Fi on",
+				"networksetup -setproxybypassdomains Wi-Fi localhost 127.0.0.1",
+			},
+			restore: []string{
+				"networksetup -setwebproxy Wi-Fi corp.example.com 3128",
+				"networksetup -setwebproxystate Wi-Fi on",
+				"networksetup -setsecurewebproxystate Wi-Fi off",
+				"networksetup -setproxybypassdomains Wi-Fi *.local 169.254/16",
+			},
+			disabled: []string{
+				"networksetup -setwebproxystate Wi-Fi off",
+				"networksetup -setsecurewebproxystate Wi-Fi off",
+			},
+		},
+		{
+			name:    "windows",
+			proxy:   &windowsProxy{run: fakeRunner(windowsOutputs), winHTTP: true},
+			current: map[string]string{"ProxyEnable": "0x1", "ProxyServer": "corp.example.com:3128"},
+			enable: []string{
+				"reg add " + reg + " /v ProxyEnable /t REG_DWORD /d 1 /f",
+				"reg add " + reg + " /v ProxyServer /t REG_SZ /d 127.0.0.1:8080 /f",
+				"reg add " + reg + " /v ProxyOverride /t REG_SZ /d localhost;127.0.0.1;<local> /f",
+				"netsh winhttp import proxy source=ie",
+			},
+			restore: []string{
+				"reg add " + reg + " /v ProxyEnable /t REG_DWORD /d 1 /f",
+				"reg add " + reg + " /v ProxyServer /t REG_SZ /d corp.example.com:3128 /f",
+				"reg delete " + reg + " /v ProxyOverride /f",
+				"netsh winhttp import proxy source=ie",
+			},
+			disabled: []string{
+				"reg add " + reg + " /v ProxyEnable /t REG_DWORD /d 0 /f",
+				"netsh winhttp import proxy source=ie",
+			},
+		},
+		{
+			name:  "gnome",
+			proxy: &gnomeProxy{run: fakeRunner(gnomeOutputs)},
+			current: map[string]string{
+				"org.gnome.system.proxy mode":         "'none'",
+				"org.gnome.system.proxy ignore-hosts": "['localhost', '127.0.0.0/8']",
+				"org.gnome.system.proxy.http host":    "''",
+				"org.gnome.system.proxy.http port":    "0",
+				"org.gnome.system.proxy.https host":   "''",
+				"org.gnome.system.proxy.https port":   "0",
+			},
+			enable: []string{
+				"gsettings set org.gnome.system.proxy.https port 8080",
+				`gsettings set org.gnome.system.proxy.https host "127.0.0.1"`,
+				"gsettings set org.gnome.system.proxy.http port 8080",
+				`gsettings set org.gnome.system.proxy.http host "127.0.0.1"`,
+				`gsettings set org.gnome.system.proxy ignore-hosts ["localhost", "127.0.0.1"]`,
+				`gsettings set org.gnome.system.proxy mode "manual"`,
+			},
+			restore: []string{
+				"gsettings set org.gnome.system.proxy.https port 0",
+				"gsettings set org.gnome.system.proxy.https host ''",
+				"gsettings set org.gnome.system.proxy.http port 0",
+				"gsettings set org.gnome.system.proxy.http host ''",
+				"gsettings set org.gnome.system.proxy ignore-hosts ['localhost', '127.0.0.0/8']",
+				"gsettings set org.gnome.system.proxy mode 'none'",
+			},
+			disabled: []string{`gsettings set org.gnome.system.proxy mode "none"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved, err := tt.proxy.current()
+			require.NoError(t, err)
+			require.Equal(t, tt.current, saved)
+
+			// 绕过列表留有容量时 enable 也不修改调用方的切片
+			bypass := make([]string, 2, 4)
+			copy(bypass, []string{"localhost", "127.0.0.1"})
+			cmds, err := tt.proxy.enable("127.0.0.1", "8080", bypass)
+			require.NoError(t, err)
+			require.Equal(t, tt.enable, commandLines(cmds))
+			require.Equal(t, []string{"localhost", "127.0.0.1", ""}, bypass[:3])
+
+			cmds, err = tt.proxy.restore(saved)
+			require.NoError(t, err)
+			require.Equal(t, tt.restore, commandLines(cmds))
+
+			// 没有保存的设置时关闭代理
+			cmds, err = tt.proxy.restore(nil)
+			require.NoError(t, err)
+			require.Equal(t, tt.disabled, commandLines(cmds))
+		})
+	}
+}
+
+func TestSystemProxy_Errors(t *testing.T) {
+	// 没有启用的网络服务
+	mac := &macProxy{run: fakeRunner(map[string]string{"networksetup -listallnetworkservices": "An asterisk (*) denotes that a network service is disabled.\n*Wi-Fi\n"})}
+	_, err := mac.current()
+	require.ErrorContains(t, err, "no enabled network services")
+
+	// 保存的 DWORD 不是十六进制
+	win := &windowsProxy{run: fakeRunner(nil)}
+	_, err = win.restore(map[string]string{"ProxyEnable": "yes"})
+	require.ErrorContains(t, err, `invalid saved ProxyEnable "yes"`)
+
+	gnome := &gnomeProxy{run: fakeRunner(nil)}
+	_, err = gnome.current()
+	require.Error(t, err)
+
+	_, err = newSystemProxy("plan9", fakeRunner(nil), false)
+	require.ErrorContains(t, err, "not supported on plan9")
+}
+
+func TestEnableDisableProxy_DryRun(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "system-proxy.json")
+	sp := &gnomeProxy{run: fakeRunner(gnomeOutputs)}
+
+	var out bytes.Buffer
+	require.NoError(t, enableProxy(sp, "127.0.0.1:8080", []string{"localhost"}, state, true, &out))
+	require.Contains(t, out.String(), `gsettings set org.gnome.system.proxy mode '"manual"'`)
+	// dry run 不保存原来的设置
+	_, err := os.Stat(state)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	out.Reset()
+	require.NoError(t, disableProxy(sp, state, true, &out))
+	require.Equal(t, "No saved settings in "+state+", turning the system proxy off\n"+
+		`gsettings set org.gnome.system.proxy mode '"none"'`+"\n", out.String())
+
+	require.ErrorContains(t, enableProxy(sp, "127.0.0.1", nil, state, true, &out), `invalid proxy address "127.0.0.1"`)
+	require.NoError(t, os.WriteFile(state, []byte("{"), 0o600))
+	require.ErrorContains(t, disableProxy(sp, state, true, &out), "invalid saved settings")
+}
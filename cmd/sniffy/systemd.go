@@ -0,0 +1,96 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/f-dong/sniffy/capture"
+	"github.com/f-dong/sniffy/capture/systemd"
+)
+
+// controlSocketName 分配给控制端口的systemd套接字名称 (FileDescriptorName=control)
+const controlSocketName = "control"
+
+// activatedSockets systemd套接字激活传入的监听套接字。名称为 control 的套接字用于控制端口，
+// 名称与命名监听器相同的套接字用于该监听器，其余的一个套接字用于主监听器
+type activatedSockets struct {
+	proxy     net.Listener
+	control   net.Listener
+	listeners map[string]net.Listener
+}
+
+// inheritSockets 接收systemd传入的套接字并写入对应监听器的地址，不是由systemd按套接字激活启动时各字段为空。
+// 控制端口和监听器的地址替换为套接字的地址，使PAC文件和重放使用实际的监听地址
+func inheritSockets(config *Config) (*activatedSockets, error) {
+	sockets, err := systemd.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	named := make(map[string]bool)
+	for _, l := range config.Listeners {
+		named[l.Name] = true
+	}
+
+	a := &activatedSockets{listeners: make(map[string]net.Listener)}
+	var proxyNames []string
+	for _, s := range sockets {
+		switch {
+		case s.Name == controlSocketName:
+			a.control = s.Listener
+		case named[s.Name]:
+			a.listeners[s.Name] = s.Listener
+		default:
+			a.proxy = s.Listener
+			proxyNames = append(proxyNames, s.Name)
+		}
+	}
+	if len(proxyNames) > 1 {
+		closeSockets(sockets)
+		return nil, fmt.Errorf("systemd passed %d sockets (%v) for the proxy listener, set FileDescriptorName= to %q or a listener name", len(proxyNames), proxyNames, controlSocketName)
+	}
+
+	a.apply(config)
+	return a, nil
+}
+
+// apply 将套接字的地址写入配置，重新加载的配置同样需要，避免地址被报告为需要重启的修改
+func (a *activatedSockets) apply(config *Config) {
+	if a.control != nil {
+		config.ControlAddress = socketAddress(a.control)
+	}
+	if a.proxy != nil {
+		if addr, ok := a.proxy.Addr().(*net.TCPAddr); ok {
+			config.Address, config.Port = addr.IP.String(), addr.Port
+		}
+	}
+	for i, l := range config.Listeners {
+		if ln := a.listeners[l.Name]; ln != nil {
+			config.Listeners[i].Address = socketAddress(ln)
+		}
+	}
+}
+
+// closeSockets 关闭所有传入的套接字
+func closeSockets(sockets []systemd.Socket) {
+	for _, s := range sockets {
+		s.Listener.Close()
+	}
+}
+
+// socketAddress 返回套接字的监听地址，unix 套接字返回 unix:path
+func socketAddress(ln net.Listener) string {
+	switch addr := ln.Addr().(type) {
+	case *net.UnixAddr:
+		return capture.UnixPrefix + addr.Name
+	case *net.TCPAddr:
+		return net.JoinHostPort(addr.IP.String(), strconv.Itoa(addr.Port))
+	default:
+		return addr.String()
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/f-dong/sniffy/capture"
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+const tailUsage = `用法:
+  sniffy tail [选项]  连接运行中的代理的控制端口，每个结束的流输出一行，类似 tail -f
+-format 为 text/template 模板，字段与事件流的 flow.Event 相同，例如 '{{.StatusCode}} {{.Method}} {{.URL}}'
+`
+
+// 终端颜色
+const (
+	tailRed    = "\x1b[31m"
+	tailYellow = "\x1b[33m"
+	tailCyan   = "\x1b[36m"
+	tailReset  = "\x1b[0m"
+)
+
+// runTail 执行 sniffy tail 子命令，返回进程退出码
+func runTail(args []string) int {
+	fs := flag.NewFlagSet("sniffy tail", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, tailUsage)
+		fs.PrintDefaults()
+	}
+	control := fs.String("control", "127.0.0.1:8081", "运行中的代理的控制端口地址 host:port、URL 或 unix:path")
+	expr := fs.String("filter", "", "只输出满足过滤表达式的流，例如 status >= 400")
+	format := fs.String("format", "", "每个流的输出模板，默认输出时间、方法、状态、大小、耗时和URL")
+	noColor := fs.Bool("no-color", false, "不按状态码着色，输出不是终端或设置了 NO_COLOR 时同样不着色")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	line, err := tailFormatter(*format, !*noColor && useColor(os.Stdout))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy tail: %v\n", err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err = tailEvents(ctx, *control, *expr, func(e *flow.Event) error {
+		_, err := fmt.Fprintln(os.Stdout, line(e))
+		return err
+	})
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "sniffy tail: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// useColor 输出是否为终端且没有设置 NO_COLOR
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// tailFormatter 返回把结束事件格式化为一行的函数，format 为空时使用默认格式
+func tailFormatter(format string, color bool) (func(*flow.Event) string, error) {
+	if format == "" {
+		return func(e *flow.Event) string { return tailLine(e, color) }, nil
+	}
+	tmpl, err := template.New("format").Option("missingkey=error").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format: %w", err)
+	}
+	return func(e *flow.Event) string {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, e); err != nil {
+			return fmt.Sprintf("format error: %v", err)
+		}
+		return b.String()
+	}, nil
+}
+
+// tailLine 返回结束事件的默认格式，与终端界面的流列表一致
+func tailLine(e *flow.Event, color bool) string {
+	status, size := "   ", ""
+	switch {
+	case e.Type == flow.EventError:
+		status = "ERR"
+	case e.StatusCode != 0:
+		status = fmt.Sprint(e.StatusCode)
+		size = tailSize(e.BodySize)
+	}
+	d := time.Duration(e.Duration * float64(time.Millisecond))
+	line := fmt.Sprintf("%s %-7s %s %7s %6s %s", e.Time.Local().Format("15:04:05"), e.Method, status, size, tailDuration(d), e.URL)
+	if e.Error != "" {
+		line += " (" + e.Error + ")"
+	}
+	if !color {
+		return line
+	}
+	switch {
+	case e.Type == flow.EventError || e.StatusCode >= 500:
+		return tailRed + line + tailReset
+	case e.StatusCode >= 400:
+		return tailYellow + line + tailReset
+	case e.StatusCode >= 300:
+		return tailCyan + line + tailReset
+	}
+	return line
+}
+
+// tailSize 返回易读的字节数
+func tailSize(n int64) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%db", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1fk", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%.1fm", float64(n)/(1024*1024))
+	}
+}
+
+// tailDuration 返回易读的持续时间
+func tailDuration(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return ""
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	default:
+		return d.Truncate(time.Second).String()
+	}
+}
+
+// tailEvents 订阅控制端口的事件流，对每个结束的流调用 fn，直到 ctx 取消或连接断开
+func tailEvents(ctx context.Context, control, expr string, fn func(*flow.Event) error) error {
+	base, client := control, http.DefaultClient
+	if path, ok := capture.SocketPath(control); ok {
+		// unix 套接字上的请求使用固定的主机名
+		base = "http://sniffy"
+		client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}}
+	} else if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	query := url.Values{"types": {string(flow.EventCompleted) + "," + string(flow.EventError)}}
+	if expr != "" {
+		query.Set("filter", expr)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+"/api/v1/events?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("invalid control address %q: %w", control, err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) == nil && body.Error != "" {
+			return fmt.Errorf("%s: %s", resp.Status, body.Error)
+		}
+		return errors.New(resp.Status)
+	}
+
+	// 按SSE规范，事件的多个 data 行以换行连接，在空行处分发；注释行是心跳
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) == 0 {
+				continue
+			}
+			var e flow.Event
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &e); err != nil {
+				return fmt.Errorf("invalid event: %w", err)
+			}
+			data = data[:0]
+			if err := fn(&e); err != nil {
+				return err
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	return errors.New("event stream closed by the proxy")
+}
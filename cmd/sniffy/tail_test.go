@@ -0,0 +1,137 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/f-dong/sniffy/capture/flow"
+)
+
+// --- 辅助函数 ---
+
+// sseServer 返回按原样写出 stream 的事件流服务器，uri 记录请求的路径、查询参数和 Accept 头部
+func sseServer(t *testing.T, stream string, uri *string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*uri = r.Header.Get("Accept") + " " + r.URL.RequestURI()
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, stream)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// tailEvent 返回测试用的结束事件
+func tailEvent(status int) *flow.Event {
+	return &flow.Event{
+		Type:       flow.EventCompleted,
+		Time:       time.Date(2025, 1, 2, 3, 4, 5, 0, time.Local),
+		Method:     "GET",
+		URL:        "https://example.com/users",
+		StatusCode: status,
+		BodySize:   2048,
+		Duration:   12.5,
+	}
+}
+
+// --- 测试代码 ---
+
+func TestTailFormatter(t *testing.T) {
+	line, err := tailFormatter("", false)
+	require.NoError(t, err)
+	require.Equal(t, "03:04:05 GET     200    2.0k   12ms https://example.com/users", line(tailEvent(200)))
+
+	line, err = tailFormatter("{{.StatusCode}} {{.Method}} {{.URL}}", true)
+	require.NoError(t, err)
+	require.Equal(t, "404 GET https://example.com/users", line(tailEvent(404)))
+
+	// 模板执行失败时输出错误而不是中断
+	line, err = tailFormatter("{{.Missing}}", false)
+	require.NoError(t, err)
+	require.Contains(t, line(tailEvent(200)), "format error:")
+
+	_, err = tailFormatter("{{.URL", false)
+	require.ErrorContains(t, err, "invalid format")
+}
+
+func TestTailLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		color  string
+	}{
+		{"ok", 200, ""},
+		{"redirect", 302, tailCyan},
+		{"client error", 404, tailYellow},
+		{"server error", 503, tailRed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tailEvent(tt.status)
+			plain := tailLine(e, false)
+			if tt.color == "" {
+				require.Equal(t, plain, tailLine(e, true))
+				return
+			}
+			require.Equal(t, tt.color+plain+tailReset, tailLine(e, true))
+		})
+	}
+
+	// 错误结束的流没有状态和大小
+	e := &flow.Event{Type: flow.EventError, Time: tailEvent(0).Time, Method: "CONNECT", URL: "example.com:443", Error: "connection refused"}
+	require.Equal(t, "03:04:05 CONNECT ERR                example.com:443 (connection refused)", tailLine(e, false))
+	require.Equal(t, tailRed+tailLine(e, false)+tailReset, tailLine(e, true))
+}
+
+func TestTailEvents(t *testing.T) {
+	stream := ": heartbeat\n\n" +
+		"event: completed\ndata: {\"type\":\"completed\",\"method\":\"GET\",\"url\":\"https://example.com/a\",\"status_code\":200}\n\n" +
+		// 分成多个 data 行的事件
+		"event: error\ndata: {\"type\":\"error\",\ndata:\"method\":\"POST\",\ndata: \"url\":\"https://example.com/b\",\"error\":\"timeout\"}\n\n"
+	var uri string
+	srv := sseServer(t, stream, &uri)
+
+	line, err := tailFormatter("{{.Type}} {{.Method}} {{.URL}}", false)
+	require.NoError(t, err)
+	var lines []string
+	err = tailEvents(context.Background(), srv.Listener.Addr().String(), "status >= 400", func(e *flow.Event) error {
+		lines = append(lines, line(e))
+		return nil
+	})
+	require.EqualError(t, err, "event stream closed by the proxy")
+	require.Equal(t, []string{"completed GET https://example.com/a", "error POST https://example.com/b"}, lines)
+	require.Equal(t, "text/event-stream /api/v1/events?filter=status+%3E%3D+400&types=completed%2Cerror", uri)
+
+	// fn 的错误结束订阅
+	stop := errors.New("stop")
+	err = tailEvents(context.Background(), srv.URL+"/", "", func(*flow.Event) error { return stop })
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, "text/event-stream /api/v1/events?types=completed%2Cerror", uri)
+}
+
+func TestTailEvents_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid filter"}`)
+	}))
+	defer srv.Close()
+	err := tailEvents(context.Background(), srv.URL, "status >=", func(*flow.Event) error { return nil })
+	require.EqualError(t, err, "400 Bad Request: invalid filter")
+
+	var uri string
+	bad := sseServer(t, "data: {\n\n", &uri)
+	err = tailEvents(context.Background(), bad.URL, "", func(*flow.Event) error { return nil })
+	require.ErrorContains(t, err, "invalid event")
+}
@@ -0,0 +1,68 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/f-dong/sniffy/capture/tlsreport"
+)
+
+const tlsReportUsage = `用法:
+  sniffy tls-report [选项] -store DB   汇总流数据库中每个源站的TLS版本、密码套件、证书链和OCSP装订
+  sniffy tls-report [选项] -file FILE  汇总会话或其他工具的捕获文件
+`
+
+// runTLSReport 执行 sniffy tls-report 子命令，返回进程退出码
+func runTLSReport(args []string) int {
+	fs := newFlowFlags("tls-report")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, tlsReportUsage)
+		fs.PrintDefaults()
+	}
+	expr := fs.String("filter", "", "只汇总满足过滤表达式的流，例如 host == api.example.com")
+	output := fs.String("o", "", "报告文件，默认输出到标准输出")
+	asJSON := fs.Bool("json", false, "输出JSON，默认输出文本")
+	weakOnly := fs.Bool("weak", false, "只输出配置较弱的源站")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := reportTLS(fs, *expr, *output, *asJSON, *weakOnly); err != nil {
+		fmt.Fprintf(os.Stderr, "sniffy tls-report: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func reportTLS(fs *flowFlags, expr, output string, asJSON, weakOnly bool) error {
+	flows, err := filteredFlows(fs, expr)
+	if err != nil {
+		return err
+	}
+	report := tlsreport.Analyze(flows)
+	if asJSON {
+		if weakOnly {
+			weak := report.Origins[:0]
+			for _, o := range report.Origins {
+				if len(o.Findings) > 0 {
+					weak = append(weak, o)
+				}
+			}
+			report.Origins = weak
+		}
+		return writeJSON(output, report)
+	}
+	w, closeOutput, err := openOutput(output)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteText(w, weakOnly); err != nil {
+		closeOutput()
+		return err
+	}
+	return closeOutput()
+}
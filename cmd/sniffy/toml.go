@@ -0,0 +1,526 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tomlParser 将 TOML 文档解析为YAML节点，与YAML配置共用解码和按行号报告错误的逻辑。
+// 支持字符串、整数、浮点数、布尔值、数组、内联表、[表] 和 [[表数组]]，不支持日期时间
+type tomlParser struct {
+	data    []byte
+	pos     int
+	line    int
+	defined map[*yaml.Node]bool
+
+	// sealed 内联表和数组值，定义之后不能再用 [表]、[[表数组]] 或点分隔的键扩展
+	sealed map[*yaml.Node]bool
+}
+
+// parseTOML 解析 TOML 文档，返回顶层的映射节点
+func parseTOML(data []byte) (*yaml.Node, error) {
+	p := &tomlParser{data: data, line: 1, defined: make(map[*yaml.Node]bool), sealed: make(map[*yaml.Node]bool)}
+	root := mappingNode(1)
+	current := root
+	for {
+		p.skipBlank(true)
+		if p.pos >= len(p.data) {
+			return root, nil
+		}
+		line := p.line
+		if p.data[p.pos] == '[' {
+			array := p.hasPrefix("[[")
+			p.pos++
+			if array {
+				p.pos++
+			}
+			p.skipBlank(false)
+			keys, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipBlank(false)
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			if !p.hasPrefix(closing) {
+				return nil, p.errorf("expected %q after table name", closing)
+			}
+			p.pos += len(closing)
+			if current, err = p.table(root, keys, array, line); err != nil {
+				return nil, err
+			}
+		} else {
+			keys, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipBlank(false)
+			if !p.hasPrefix("=") {
+				return nil, p.errorf("expected '=' after key %q", strings.Join(keys, "."))
+			}
+			p.pos++
+			p.skipBlank(false)
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.setKey(current, keys, value, line); err != nil {
+				return nil, err
+			}
+		}
+		p.skipBlank(false)
+		if p.pos < len(p.data) && p.data[p.pos] != '\n' && !p.hasPrefix("\r\n") {
+			return nil, p.errorf("unexpected %q after value", p.data[p.pos])
+		}
+	}
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: "+format, append([]any{p.line}, args...)...)
+}
+
+func (p *tomlParser) hasPrefix(s string) bool {
+	return bytes.HasPrefix(p.data[p.pos:], []byte(s))
+}
+
+// skipBlank 跳过空白和注释，newlines 为 true 时同时跳过换行
+func (p *tomlParser) skipBlank(newlines bool) {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		case newlines && c == '\r' && p.hasPrefix("\r\n"):
+			p.pos++
+		case newlines && c == '\n':
+			p.pos++
+			p.line++
+		default:
+			return
+		}
+	}
+}
+
+// key 解析可能以 . 分隔的键
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		var part string
+		switch {
+		case p.pos >= len(p.data):
+			return nil, p.errorf("expected a key")
+		case p.data[p.pos] == '"':
+			s, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		case p.data[p.pos] == '\'':
+			s, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		default:
+			start := p.pos
+			for p.pos < len(p.data) && isBareKey(p.data[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, p.errorf("invalid key character %q", p.data[p.pos])
+			}
+			part = string(p.data[start:p.pos])
+		}
+		keys = append(keys, part)
+		p.skipBlank(false)
+		if !p.hasPrefix(".") {
+			return keys, nil
+		}
+		p.pos++
+		p.skipBlank(false)
+	}
+}
+
+func isBareKey(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '_' || c == '-'
+}
+
+// value 解析一个值
+func (p *tomlParser) value() (*yaml.Node, error) {
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("expected a value")
+	}
+	line := p.line
+	switch p.data[p.pos] {
+	case '"':
+		s, err := p.basicString()
+		if err != nil {
+			return nil, err
+		}
+		return scalarNode("!!str", s, line), nil
+	case '\'':
+		s, err := p.literalString()
+		if err != nil {
+			return nil, err
+		}
+		return scalarNode("!!str", s, line), nil
+	case '[':
+		return p.array()
+	case '{':
+		return p.inlineTable()
+	}
+
+	start := p.pos
+	for p.pos < len(p.data) && !strings.ContainsRune(" \t\r\n,]}#", rune(p.data[p.pos])) {
+		p.pos++
+	}
+	token := string(p.data[start:p.pos])
+	switch token {
+	case "true", "false":
+		return scalarNode("!!bool", token, line), nil
+	case "inf", "+inf":
+		return scalarNode("!!float", ".inf", line), nil
+	case "-inf":
+		return scalarNode("!!float", "-.inf", line), nil
+	case "nan", "+nan", "-nan":
+		return scalarNode("!!float", ".nan", line), nil
+	}
+	number := strings.ReplaceAll(token, "_", "")
+	digits := strings.TrimLeft(number, "+-")
+	base := 10
+	if len(digits) > 2 && digits[0] == '0' && strings.ContainsRune("xob", rune(digits[1])) {
+		base = 0
+	}
+	if base == 0 || digits != "" && strings.Trim(digits, "0123456789") == "" && (digits == "0" || digits[0] != '0') {
+		if n, err := strconv.ParseInt(number, base, 64); err == nil {
+			return scalarNode("!!int", strconv.FormatInt(n, 10), line), nil
+		}
+	} else if f, err := strconv.ParseFloat(number, 64); err == nil && digits != "" && digits[0] >= '0' && digits[0] <= '9' {
+		return scalarNode("!!float", strconv.FormatFloat(f, 'g', -1, 64), line), nil
+	}
+	if len(token) >= 10 && token[4] == '-' && token[7] == '-' {
+		return nil, p.errorf("date and time values are not supported, use a string")
+	}
+	if token == "" {
+		return nil, p.errorf("expected a value")
+	}
+	return nil, p.errorf("invalid value %q", token)
+}
+
+// array 解析数组，元素之间可以换行
+func (p *tomlParser) array() (*yaml.Node, error) {
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: p.line}
+	p.pos++
+	for {
+		p.skipBlank(true)
+		if p.hasPrefix("]") {
+			p.pos++
+			p.sealed[list] = true
+			return list, nil
+		}
+		item, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list.Content = append(list.Content, item)
+		p.skipBlank(true)
+		switch {
+		case p.hasPrefix(","):
+			p.pos++
+		case p.hasPrefix("]"):
+			p.pos++
+			p.sealed[list] = true
+			return list, nil
+		default:
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+// inlineTable 解析内联表 {a = 1, b = "x"}
+func (p *tomlParser) inlineTable() (*yaml.Node, error) {
+	table := mappingNode(p.line)
+	p.pos++
+	p.skipBlank(false)
+	if p.hasPrefix("}") {
+		p.pos++
+		p.sealed[table] = true
+		return table, nil
+	}
+	for {
+		line := p.line
+		keys, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if !p.hasPrefix("=") {
+			return nil, p.errorf("expected '=' after key %q", strings.Join(keys, "."))
+		}
+		p.pos++
+		p.skipBlank(false)
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.setKey(table, keys, value, line); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		switch {
+		case p.hasPrefix(","):
+			p.pos++
+			p.skipBlank(false)
+		case p.hasPrefix("}"):
+			p.pos++
+			p.sealed[table] = true
+			return table, nil
+		default:
+			return nil, p.errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
+
+// basicString 解析 "..." 或 """...""" 字符串并处理转义
+func (p *tomlParser) basicString() (string, error) {
+	multiline := p.hasPrefix(`"""`)
+	if multiline {
+		p.pos += 3
+		p.trimFirstNewline()
+	} else {
+		p.pos++
+	}
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.data) {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.data[p.pos]
+		switch {
+		case multiline && p.hasPrefix(`"""`):
+			p.pos += 3
+			// 结束符前最多还可以有两个引号
+			for i := 0; i < 2 && p.hasPrefix(`"`); i++ {
+				b.WriteByte('"')
+				p.pos++
+			}
+			return b.String(), nil
+		case !multiline && c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\n':
+			if !multiline {
+				return "", p.errorf("unterminated string")
+			}
+			b.WriteByte(c)
+			p.pos++
+			p.line++
+		case c == '\\':
+			p.pos++
+			if p.pos >= len(p.data) {
+				return "", p.errorf("unterminated string")
+			}
+			if err := p.escape(&b, multiline); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// escape 处理反斜杠之后的转义序列
+func (p *tomlParser) escape(b *strings.Builder, multiline bool) error {
+	c := p.data[p.pos]
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.data) {
+			return p.errorf("invalid unicode escape")
+		}
+		r, err := strconv.ParseUint(string(p.data[p.pos:p.pos+n]), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return p.errorf("invalid unicode escape")
+		}
+		b.WriteRune(rune(r))
+		p.pos += n
+	case ' ', '\t', '\r', '\n':
+		// 行尾的反斜杠去掉之后的空白和换行
+		if !multiline {
+			return p.errorf("invalid escape sequence")
+		}
+		p.pos--
+		for p.pos < len(p.data) && strings.ContainsRune(" \t\r\n", rune(p.data[p.pos])) {
+			if p.data[p.pos] == '\n' {
+				p.line++
+			}
+			p.pos++
+		}
+	default:
+		return p.errorf("invalid escape sequence \\%c", c)
+	}
+	return nil
+}
+
+// literalString 解析 '...' 或 ”'...”' 字符串，不处理转义
+func (p *tomlParser) literalString() (string, error) {
+	multiline := p.hasPrefix("'''")
+	if multiline {
+		p.pos += 3
+		p.trimFirstNewline()
+	} else {
+		p.pos++
+	}
+	start := p.pos
+	for p.pos < len(p.data) {
+		switch {
+		case multiline && p.hasPrefix("'''"):
+			end := p.pos
+			p.pos += 3
+			for i := 0; i < 2 && p.hasPrefix("'"); i++ {
+				p.pos++
+				end++
+			}
+			return string(p.data[start:end]), nil
+		case !multiline && p.data[p.pos] == '\'':
+			p.pos++
+			return string(p.data[start : p.pos-1]), nil
+		case p.data[p.pos] == '\n':
+			if !multiline {
+				return "", p.errorf("unterminated string")
+			}
+			p.line++
+		}
+		p.pos++
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// trimFirstNewline 去掉多行字符串开头紧跟的换行
+func (p *tomlParser) trimFirstNewline() {
+	if p.hasPrefix("\r\n") {
+		p.pos += 2
+		p.line++
+	} else if p.hasPrefix("\n") {
+		p.pos++
+		p.line++
+	}
+}
+
+// table 进入 [表] 或在 [[表数组]] 中添加一个表
+func (p *tomlParser) table(root *yaml.Node, keys []string, array bool, line int) (*yaml.Node, error) {
+	node := root
+	for i, key := range keys {
+		child := lookup(node, key)
+		last := i == len(keys)-1
+		switch {
+		case child == nil && last && array:
+			child = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line}
+			node.Content = append(node.Content, scalarNode("!!str", key, line), child)
+		case child == nil:
+			child = mappingNode(line)
+			node.Content = append(node.Content, scalarNode("!!str", key, line), child)
+		case p.sealed[child]:
+			return nil, sealedError(key, line)
+		}
+		if child.Kind == yaml.SequenceNode {
+			if last && array {
+				table := mappingNode(line)
+				child.Content = append(child.Content, table)
+				return table, nil
+			}
+			if len(child.Content) == 0 || child.Content[len(child.Content)-1].Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("line %d: key %q is not a table", line, key)
+			}
+			child = child.Content[len(child.Content)-1]
+		}
+		if child.Kind != yaml.MappingNode || (last && array) {
+			return nil, fmt.Errorf("line %d: key %q is already defined", line, key)
+		}
+		node = child
+	}
+	if p.defined[node] {
+		return nil, fmt.Errorf("line %d: table %q is already defined", line, strings.Join(keys, "."))
+	}
+	p.defined[node] = true
+	return node, nil
+}
+
+// setKey 在表中设置可能以 . 分隔的键
+func (p *tomlParser) setKey(table *yaml.Node, keys []string, value *yaml.Node, line int) error {
+	for _, key := range keys[:len(keys)-1] {
+		child := lookup(table, key)
+		switch {
+		case child == nil:
+			child = mappingNode(line)
+			table.Content = append(table.Content, scalarNode("!!str", key, line), child)
+		case p.sealed[child]:
+			return sealedError(key, line)
+		case child.Kind != yaml.MappingNode:
+			return fmt.Errorf("line %d: key %q is not a table", line, key)
+		}
+		table = child
+	}
+	key := keys[len(keys)-1]
+	if lookup(table, key) != nil {
+		return fmt.Errorf("line %d: duplicate key %q", line, key)
+	}
+	table.Content = append(table.Content, scalarNode("!!str", key, line), value)
+	return nil
+}
+
+func sealedError(key string, line int) error {
+	return fmt.Errorf("line %d: key %q is an inline value and cannot be extended", line, key)
+}
+
+// lookup 返回映射节点中键的值，没有时返回nil
+func lookup(table *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(table.Content); i += 2 {
+		if table.Content[i].Value == key {
+			return table.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func mappingNode(line int) *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line}
+}
+
+func scalarNode(tag, value string, line int) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Line: line}
+}
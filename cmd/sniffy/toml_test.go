@@ -0,0 +1,151 @@
+// Copyright 2025 The f-dong Authors
+// SPDX-License-Identifier: Apache-2.0
+// Use of this source code is governed by an Apache 2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// --- 辅助函数 ---
+
+// decodeTOML 解析 TOML 文档并解码为通用的映射
+func decodeTOML(t *testing.T, src string) map[string]any {
+	t.Helper()
+	root, err := parseTOML([]byte(src))
+	require.NoError(t, err)
+	var out map[string]any
+	require.NoError(t, root.Decode(&out))
+	return out
+}
+
+// --- 测试代码 ---
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]any
+	}{
+		{
+			name: "basic string escapes",
+			src:  `s = "a\tb\n\"q\" \\ \u00e9 \U0001F600"`,
+			want: map[string]any{"s": "a\tb\n\"q\" \\ é 😀"},
+		},
+		{
+			name: "literal string",
+			src:  `s = 'C:\path\*'`,
+			want: map[string]any{"s": `C:\path\*`},
+		},
+		{
+			name: "multiline basic string",
+			src:  "s = \"\"\"\nfirst \\\n    second\nthird\"\"\"\"",
+			want: map[string]any{"s": "first second\nthird\""},
+		},
+		{
+			name: "multiline literal string",
+			src:  "s = '''\nraw \\n\n'''",
+			want: map[string]any{"s": "raw \\n\n"},
+		},
+		{
+			name: "numbers and booleans",
+			src:  "i = 1_000\nh = 0xff\nn = -7\nf = 1.5e3\nb = false",
+			want: map[string]any{"i": 1000, "h": 255, "n": -7, "f": 1500.0, "b": false},
+		},
+		{
+			name: "infinity",
+			src:  "a = inf\nb = +inf\nc = -inf",
+			want: map[string]any{"a": math.Inf(1), "b": math.Inf(1), "c": math.Inf(-1)},
+		},
+		{
+			name: "dotted keys",
+			src:  "a.b = 1\na.c = \"x\"\n\"d.e\".f = true",
+			want: map[string]any{
+				"a":   map[string]any{"b": 1, "c": "x"},
+				"d.e": map[string]any{"f": true},
+			},
+		},
+		{
+			name: "arrays and inline tables",
+			src:  "list = [\n  1, # first\n  2,\n]\nx = {a = 1, b.c = [\"y\"]}",
+			want: map[string]any{
+				"list": []any{1, 2},
+				"x":    map[string]any{"a": 1, "b": map[string]any{"c": []any{"y"}}},
+			},
+		},
+		{
+			name: "tables",
+			src:  "top = 1\n[server]\nport = 80\n[server.tls]\nenabled = true\n[other]",
+			want: map[string]any{
+				"top":    1,
+				"server": map[string]any{"port": 80, "tls": map[string]any{"enabled": true}},
+				"other":  map[string]any{},
+			},
+		},
+		{
+			name: "array of tables",
+			src:  "[[listeners]]\nname = \"a\"\n[listeners.tls]\non = true\n[[listeners]]\nname = \"b\"",
+			want: map[string]any{
+				"listeners": []any{
+					map[string]any{"name": "a", "tls": map[string]any{"on": true}},
+					map[string]any{"name": "b"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, decodeTOML(t, tt.src))
+		})
+	}
+}
+
+func TestParseTOML_NaN(t *testing.T) {
+	got := decodeTOML(t, "a = nan\nb = -nan\nc = [+nan]")
+	require.True(t, math.IsNaN(got["a"].(float64)))
+	require.True(t, math.IsNaN(got["b"].(float64)))
+	require.True(t, math.IsNaN(got["c"].([]any)[0].(float64)))
+}
+
+func TestParseTOML_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{"duplicate key", "a = 1\nb = 2\na = 3", `line 3: duplicate key "a"`},
+		{"duplicate dotted key", "a.b = 1\n\na.b = 2", `line 3: duplicate key "b"`},
+		{"redefined table", "[a]\nx = 1\n[b]\n[a]", `line 4: table "a" is already defined`},
+		{"table over value", "a = 1\n[a]", `line 2: key "a" is already defined`},
+		{"dotted key over value", "a = 1\na.b = 2", `line 2: key "a" is not a table`},
+		{"array of tables over table", "[a]\n[[a]]", `line 2: key "a" is already defined`},
+		{"extend inline table with dotted key", "x = {a = 1}\nx.b = 2", `line 2: key "x" is an inline value and cannot be extended`},
+		{"extend inline table with table", "x = {a = 1}\n\n[x]", `line 3: key "x" is an inline value and cannot be extended`},
+		{"extend inline table with subtable", "x = {a = {b = 1}}\n[x.a.c]", `line 2: key "x" is an inline value and cannot be extended`},
+		{"extend nested inline table", "x = {a = {b = 1}, a.c = 2}", `line 1: key "a" is an inline value and cannot be extended`},
+		{"extend static array", "x = [{a = 1}]\n[[x]]", `line 2: key "x" is an inline value and cannot be extended`},
+		{"offset datetime", "d = 2024-01-02T03:04:05Z", "line 1: date and time values are not supported"},
+		{"local date", "a = 1\nd = 2024-01-02", "line 2: date and time values are not supported"},
+		{"invalid escape", `s = "\q"`, `line 1: invalid escape sequence \q`},
+		{"invalid unicode escape", `s = "\uZZZZ"`, "line 1: invalid unicode escape"},
+		{"unterminated string", "a = 1\ns = \"abc\nb = 2", "line 2: unterminated string"},
+		{"unterminated multiline string", "s = \"\"\"\nabc", "line 2: unterminated string"},
+		{"missing equals", "a 1", `line 1: expected '=' after key "a"`},
+		{"missing value", "a =", "line 1: expected a value"},
+		{"trailing characters", "a = 1 2", `line 1: unexpected '2' after value`},
+		{"unclosed table header", "[a\nb = 1", `line 1: expected "]" after table name`},
+		{"invalid value", "a = yes", `line 1: invalid value "yes"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML([]byte(tt.src))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.err)
+		})
+	}
+}